@@ -5,7 +5,6 @@ import (
 
 	"github.com/fern4lvarez/piladb/config/vars"
 	"github.com/fern4lvarez/piladb/pila"
-	"github.com/fern4lvarez/piladb/pkg/uuid"
 )
 
 // CONFIG represents the name of the database that will hold
@@ -17,11 +16,18 @@ const CONFIG = "_config"
 // updated and consumed by piladb.
 type Config struct {
 	Values *pila.Database
+
+	// FeatureFlags gates new behavior of piladb
+	// behind named flags.
+	FeatureFlags map[string]bool
 }
 
 // NewConfig creates a new Config with empty values.
 func NewConfig() *Config {
-	return &Config{Values: pila.NewDatabase(CONFIG)}
+	return &Config{
+		Values:       pila.NewDatabase(CONFIG),
+		FeatureFlags: make(map[string]bool),
+	}
 }
 
 // Default sets the default values to the Config.
@@ -34,7 +40,7 @@ func (c *Config) Default() *Config {
 
 // Get gets a config value from a key.
 func (c *Config) Get(key string) interface{} {
-	s, ok := c.Values.Stacks[uuid.New(CONFIG+key)]
+	s, ok := c.Values.StackByName(key)
 	if !ok {
 		return nil
 	}
@@ -43,10 +49,10 @@ func (c *Config) Get(key string) interface{} {
 
 // Set sets a config value having a key and the value.
 func (c *Config) Set(key string, value interface{}) {
-	s, ok := c.Values.Stacks[uuid.New(CONFIG+key)]
+	s, ok := c.Values.StackByName(key)
 	if !ok {
 		sID := c.Values.CreateStack(key, time.Now().UTC())
-		s, _ = c.Values.Stacks[sID]
+		s, _ = c.Values.Stack(sID)
 	}
 
 	s.Push(value)
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/fern4lvarez/piladb/config/vars"
-	"github.com/fern4lvarez/piladb/pkg/uuid"
 )
 
 func TestNewConfig(t *testing.T) {
@@ -15,13 +14,16 @@ func TestNewConfig(t *testing.T) {
 	if config.Values == nil {
 		t.Fatal(errors.New("Config is nil"))
 	}
+	if config.FeatureFlags == nil {
+		t.Fatal(errors.New("FeatureFlags is nil"))
+	}
 
 	inputOutput := []struct {
 		input, output interface{}
 	}{
 		{config.Values.Name, CONFIG},
-		{config.Values.ID, uuid.New(CONFIG)},
 		{len(config.Values.Stacks), 0},
+		{len(config.FeatureFlags), 0},
 	}
 
 	for _, io := range inputOutput {
@@ -69,7 +71,7 @@ func TestConfigSet(t *testing.T) {
 
 	for _, expectedValue := range expectedValues {
 		config.Set("foo", expectedValue)
-		s, _ := config.Values.Stacks[uuid.New(CONFIG+"foo")]
+		s, _ := config.Values.StackByName("foo")
 		if value := s.Peek(); value != expectedValue {
 			t.Errorf("Values is %s, expected %s", value, expectedValue)
 		}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// EncryptionKeys returns the value of ENCRYPTION_KEYS as a Keyring,
+// or nil if it is empty or not valid, i.e. stacks can not be encrypted.
+// Type: *pila.Keyring, Default: nil
+func (c *Config) EncryptionKeys() *pila.Keyring {
+	keys, err := ParseEncryptionKeys(stringValue(c.Get(vars.EncryptionKeys), vars.EncryptionKeysDefault))
+	if err != nil {
+		return nil
+	}
+	return keys
+}
+
+// ParseEncryptionKeys parses comma-separated encryption keys written
+// as id:key, where key is encoded in base64 and is 16, 24 or 32 bytes
+// long, e.g.
+//
+//	2024:q83vEjRWeJCrze8SNFZ4kA==,2025:ASNFZ4mrze8BI0VniavN7w==
+//
+// The last key is the current one of the Keyring. It returns nil if s
+// holds no key, and an error if an ID is missing or duplicated, or if
+// a key is not valid.
+func ParseEncryptionKeys(s string) (*pila.Keyring, error) {
+	var keys *pila.Keyring
+
+	for _, k := range strings.Split(s, ",") {
+		if k = strings.TrimSpace(k); k == "" {
+			continue
+		}
+
+		i := strings.IndexByte(k, ':')
+		if i == -1 {
+			return nil, fmt.Errorf("encryption key %s has no ID", k)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(k[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s is not base64", strings.TrimSpace(k[:i]))
+		}
+		if keys == nil {
+			keys = pila.NewKeyring()
+		}
+		if err := keys.Add(strings.TrimSpace(k[:i]), key); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
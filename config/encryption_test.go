@@ -0,0 +1,63 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+)
+
+func TestParseEncryptionKeys(t *testing.T) {
+	s := " 2024: q83vEjRWeJCrze8SNFZ4kA== ,2025:ASNFZ4mrze8BI0VniavN7wEjRWeJq83vASNFZ4mrze8=,"
+
+	keys, err := ParseEncryptionKeys(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids, expected := keys.IDs(), []string{"2024", "2025"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("IDs are %v, expected %v", ids, expected)
+	}
+	if current := keys.Current(); current != "2025" {
+		t.Errorf("current key is %s, expected %s", current, "2025")
+	}
+
+	if keys, err := ParseEncryptionKeys(""); err != nil || keys != nil {
+		t.Errorf("keys are %v and error %v, expected none", keys, err)
+	}
+}
+
+func TestParseEncryptionKeys_Error(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output string
+	}{
+		{"2024", "encryption key 2024 has no ID"},
+		{":q83vEjRWeJCrze8SNFZ4kA==", "missing encryption key ID"},
+		{"2024:foo!", "encryption key 2024 is not base64"},
+		{"2024:Zm9v", "encryption key 2024: crypto/aes: invalid key size 3"},
+		{"2024:q83vEjRWeJCrze8SNFZ4kA==,2024:q83vEjRWeJCrze8SNFZ4kA==", "encryption key 2024 already exists"},
+	}
+
+	for _, io := range inputOutput {
+		if _, err := ParseEncryptionKeys(io.input); err == nil || err.Error() != io.output {
+			t.Errorf("error of %q is %v, expected %v", io.input, err, io.output)
+		}
+	}
+}
+
+func TestEncryptionKeys(t *testing.T) {
+	c := NewConfig()
+	if keys := c.EncryptionKeys(); keys != nil {
+		t.Errorf("keys are %v, expected none", keys)
+	}
+
+	c.Set(vars.EncryptionKeys, "2024:q83vEjRWeJCrze8SNFZ4kA==")
+	if keys := c.EncryptionKeys(); keys == nil || keys.Current() != "2024" {
+		t.Errorf("keys are %v, expected %v", keys, "2024")
+	}
+
+	c.Set(vars.EncryptionKeys, "2024")
+	if keys := c.EncryptionKeys(); keys != nil {
+		t.Errorf("keys are %v, expected none", keys)
+	}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+)
+
+// ReadFile reads the config values of the file in path,
+// see Parse for its format.
+func ReadFile(path string) (map[string]interface{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Parse reads config values written as flat YAML or TOML, i.e. one
+// `key: value` or `key = value` pair per line. Keys are config names,
+// case insensitive and with either dashes or underscores, e.g. port or
+// max-stack-size. Values are integers or strings, which may be quoted.
+// Empty lines and comments starting with # are ignored. It returns an
+// error for unknown keys, and for nested values or sections, which are
+// not supported.
+func Parse(r io.Reader) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+
+		i := strings.IndexAny(line, ":=")
+		if i == -1 {
+			return nil, fmt.Errorf("line %d: expected key and value, got %s", n, line)
+		}
+		key := strings.ToUpper(strings.Replace(strings.TrimSpace(line[:i]), "-", "_", -1))
+		if !isName(key) {
+			return nil, fmt.Errorf("line %d: unknown key %s", n, line[:i])
+		}
+
+		value, err := parseValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		values[key] = value
+	}
+
+	return values, scanner.Err()
+}
+
+// parseValue returns the integer or string value of a
+// config key, stripping quotes and trailing comments.
+func parseValue(s string) (interface{}, error) {
+	if s == "" {
+		return nil, fmt.Errorf("missing value, nested values are not supported")
+	}
+
+	if quote := s[0]; quote == '"' || quote == '\'' {
+		end := strings.IndexByte(s[1:], quote)
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated string %s", s)
+		}
+		return s[1 : end+1], nil
+	}
+
+	if i := strings.Index(s, " #"); i != -1 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if i, err := strconv.Atoi(s); err == nil {
+		return i, nil
+	}
+	return s, nil
+}
+
+// isName determines whether a key is the name of a config value.
+func isName(key string) bool {
+	for _, name := range vars.Names {
+		if key == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+)
+
+func TestParse(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output map[string]interface{}
+	}{
+		{"", map[string]interface{}{}},
+		{`---
+# pilad config
+port: 8080
+max-stack-size: 100 # elements
+persist_dir: "/var/lib/piladb # data"
+LOG_LEVEL: off
+`, map[string]interface{}{
+			vars.Port:         8080,
+			vars.MaxStackSize: 100,
+			vars.PersistDir:   "/var/lib/piladb # data",
+			vars.LogLevel:     "off",
+		}},
+		{`# pilad config
+port = 8080
+read_timeout = 10
+persist_dir = 'C:\piladb'
+log_level = "info"
+`, map[string]interface{}{
+			vars.Port:        8080,
+			vars.ReadTimeout: 10,
+			vars.PersistDir:  `C:\piladb`,
+			vars.LogLevel:    "info",
+		}},
+	}
+
+	for _, io := range inputOutput {
+		values, err := Parse(strings.NewReader(io.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(values, io.output) {
+			t.Errorf("values are %v, expected %v", values, io.output)
+		}
+	}
+}
+
+func TestParse_Error(t *testing.T) {
+	inputs := []string{
+		"port",
+		"foo: 1",
+		"[server]\nport = 8080",
+		"persistence:\n  dir: /tmp",
+		`persist_dir: "/tmp`,
+	}
+
+	for _, input := range inputs {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("err is nil for %s", input)
+		}
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "piladb-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString("port: 8080\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	values, err := ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]interface{}{vars.Port: 8080}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("values are %v, expected %v", values, expected)
+	}
+
+	if _, err := ReadFile(f.Name() + "foo"); err == nil {
+		t.Error("err is nil")
+	}
+}
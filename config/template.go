@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// StackTemplate is a named set of Stack presets, created
+// along with a Database.
+type StackTemplate struct {
+	Name   string
+	Stacks []StackPreset
+}
+
+// StackPreset represents the options of a Stack
+// created from a StackTemplate.
+type StackPreset struct {
+	Name    string
+	Type    pila.Structure
+	MaxSize int
+	Policy  pila.OverflowPolicy
+	TTL     time.Duration
+}
+
+// StackTemplates returns the value of STACK_TEMPLATES by name,
+// or no templates if it is not valid.
+// Type: map[string]StackTemplate, Default: {}
+func (c *Config) StackTemplates() map[string]StackTemplate {
+	templates, err := ParseStackTemplates(stringValue(c.Get(vars.StackTemplates), vars.StackTemplatesDefault))
+	if err != nil {
+		return map[string]StackTemplate{}
+	}
+	return templates
+}
+
+// ParseStackTemplates parses semicolon-separated templates written
+// as name:stack,stack..., where each stack is its name optionally
+// followed by query parameters, e.g.
+//
+//	worker-queues:jobs?type=queue&max_size=1000&policy=drop_oldest,failed?ttl=24h
+//
+// Parameters are type, max_size, policy and ttl, and are validated
+// as when creating a Stack. It returns an error if a template or
+// stack name is missing or duplicated, or if a parameter is invalid.
+func ParseStackTemplates(s string) (map[string]StackTemplate, error) {
+	templates := make(map[string]StackTemplate)
+
+	for _, t := range strings.Split(s, ";") {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+
+		i := strings.IndexByte(t, ':')
+		if i == -1 {
+			return nil, fmt.Errorf("template %s has no stacks", t)
+		}
+		template := StackTemplate{Name: strings.TrimSpace(t[:i])}
+		if template.Name == "" {
+			return nil, fmt.Errorf("template %s has no name", t)
+		}
+		if _, ok := templates[template.Name]; ok {
+			return nil, fmt.Errorf("template %s is duplicated", template.Name)
+		}
+
+		names := make(map[string]bool)
+		for _, p := range strings.Split(t[i+1:], ",") {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			preset, err := parseStackPreset(p)
+			if err != nil {
+				return nil, fmt.Errorf("template %s: %v", template.Name, err)
+			}
+			if names[preset.Name] {
+				return nil, fmt.Errorf("template %s: stack %s is duplicated", template.Name, preset.Name)
+			}
+			names[preset.Name] = true
+			template.Stacks = append(template.Stacks, preset)
+		}
+		if len(template.Stacks) == 0 {
+			return nil, fmt.Errorf("template %s has no stacks", template.Name)
+		}
+
+		templates[template.Name] = template
+	}
+
+	return templates, nil
+}
+
+// parseStackPreset parses a stack of a template, given
+// as its name followed by optional query parameters.
+func parseStackPreset(s string) (StackPreset, error) {
+	preset := StackPreset{Type: pila.StructureStack}
+
+	name, query := s, ""
+	if i := strings.IndexByte(s, '?'); i != -1 {
+		name, query = s[:i], s[i+1:]
+	}
+	if preset.Name = strings.TrimSpace(name); preset.Name == "" {
+		return preset, fmt.Errorf("stack %s has no name", s)
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return preset, fmt.Errorf("stack %s: %v", preset.Name, err)
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := params.Get(key)
+		switch key {
+		case "type":
+			preset.Type = pila.Structure(value)
+			switch preset.Type {
+			case pila.StructureStack, pila.StructureQueue, pila.StructurePriority:
+			default:
+				return preset, fmt.Errorf("stack %s: unknown type %s", preset.Name, value)
+			}
+		case "max_size":
+			if preset.MaxSize, err = strconv.Atoi(value); err != nil || preset.MaxSize < 1 {
+				return preset, fmt.Errorf("stack %s: max_size must be a positive integer, got %s", preset.Name, value)
+			}
+		case "policy":
+			preset.Policy = pila.OverflowPolicy(value)
+			if preset.Policy != pila.OverflowReject && preset.Policy != pila.OverflowDropOldest {
+				return preset, fmt.Errorf("stack %s: unknown policy %s", preset.Name, value)
+			}
+		case "ttl":
+			if preset.TTL, err = time.ParseDuration(value); err != nil || preset.TTL <= 0 {
+				return preset, fmt.Errorf("stack %s: ttl must be a positive duration, got %s", preset.Name, value)
+			}
+		default:
+			return preset, fmt.Errorf("stack %s: unknown parameter %s", preset.Name, key)
+		}
+	}
+
+	switch {
+	case preset.Policy != "" && preset.MaxSize == 0:
+		return preset, fmt.Errorf("stack %s: policy %s requires max_size", preset.Name, preset.Policy)
+	case preset.Policy == "" && preset.MaxSize > 0:
+		preset.Policy = pila.OverflowReject
+	}
+
+	return preset, nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestParseStackTemplates(t *testing.T) {
+	s := " worker-queues: jobs?type=queue&max_size=1000&policy=drop_oldest, failed?ttl=24h ;cache:hot?max_size=10&ttl=5m;"
+	expected := map[string]StackTemplate{
+		"worker-queues": {
+			Name: "worker-queues",
+			Stacks: []StackPreset{
+				{Name: "jobs", Type: pila.StructureQueue, MaxSize: 1000, Policy: pila.OverflowDropOldest},
+				{Name: "failed", Type: pila.StructureStack, TTL: 24 * time.Hour},
+			},
+		},
+		"cache": {
+			Name: "cache",
+			Stacks: []StackPreset{
+				{Name: "hot", Type: pila.StructureStack, MaxSize: 10, Policy: pila.OverflowReject, TTL: 5 * time.Minute},
+			},
+		},
+	}
+
+	templates, err := ParseStackTemplates(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(templates, expected) {
+		t.Errorf("templates are %v, expected %v", templates, expected)
+	}
+
+	if templates, err := ParseStackTemplates(""); err != nil || len(templates) != 0 {
+		t.Errorf("templates are %v and error %v, expected none", templates, err)
+	}
+}
+
+func TestParseStackTemplates_Error(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output string
+	}{
+		{"queues", "template queues has no stacks"},
+		{"queues:", "template queues has no stacks"},
+		{":jobs", "template :jobs has no name"},
+		{"queues:jobs;queues:tasks", "template queues is duplicated"},
+		{"queues:jobs,jobs?type=queue", "template queues: stack jobs is duplicated"},
+		{"queues:?type=queue", "template queues: stack ?type=queue has no name"},
+		{"queues:jobs?type=heap", "template queues: stack jobs: unknown type heap"},
+		{"queues:jobs?max_size=0", "template queues: stack jobs: max_size must be a positive integer, got 0"},
+		{"queues:jobs?max_size=10&policy=drop", "template queues: stack jobs: unknown policy drop"},
+		{"queues:jobs?policy=reject", "template queues: stack jobs: policy reject requires max_size"},
+		{"queues:jobs?ttl=-1s", "template queues: stack jobs: ttl must be a positive duration, got -1s"},
+		{"queues:jobs?spill=10", "template queues: stack jobs: unknown parameter spill"},
+		{"queues:jobs?%zz", `template queues: stack jobs: invalid URL escape "%zz"`},
+	}
+
+	for _, io := range inputOutput {
+		if _, err := ParseStackTemplates(io.input); err == nil || err.Error() != io.output {
+			t.Errorf("error of %q is %v, expected %v", io.input, err, io.output)
+		}
+	}
+}
+
+func TestStackTemplates(t *testing.T) {
+	c := NewConfig()
+	if templates := c.StackTemplates(); len(templates) != 0 {
+		t.Errorf("templates are %v, expected none", templates)
+	}
+
+	c.Set(vars.StackTemplates, "queues:jobs")
+	if templates := c.StackTemplates(); len(templates) != 1 || templates["queues"].Stacks[0].Name != "jobs" {
+		t.Errorf("templates are %v, expected %v", templates, "queues")
+	}
+
+	c.Set(vars.StackTemplates, "queues")
+	if templates := c.StackTemplates(); len(templates) != 0 {
+		t.Errorf("templates are %v, expected none", templates)
+	}
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+)
+
+// ConfigError represents an invalid config value.
+type ConfigError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface.
+func (e ConfigError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// Validate checks all the config values and returns the
+// list of errors found. It returns an empty list if the
+// Config is valid.
+func (c *Config) Validate() []ConfigError {
+	errs := []ConfigError{}
+
+	if port, ok := c.rawInt(vars.Port); ok && (port < 1025 || port > 65535) {
+		errs = append(errs, ConfigError{vars.Port, fmt.Sprintf("%d is out of range 1025-65535", port)})
+	} else if !ok {
+		errs = append(errs, ConfigError{vars.Port, "must be an integer"})
+	}
+
+	if size, ok := c.rawInt(vars.MaxStackSize); ok && size < -1 {
+		errs = append(errs, ConfigError{vars.MaxStackSize, fmt.Sprintf("%d must be -1 or greater", size)})
+	} else if !ok {
+		errs = append(errs, ConfigError{vars.MaxStackSize, "must be an integer"})
+	}
+
+	if size, ok := c.rawInt(vars.MaxElementSize); ok && (size < -1 || size == 0) {
+		errs = append(errs, ConfigError{vars.MaxElementSize, fmt.Sprintf("%d must be -1 or greater than 0", size)})
+	} else if !ok {
+		errs = append(errs, ConfigError{vars.MaxElementSize, "must be an integer"})
+	}
+
+	for _, key := range []string{vars.ReadTimeout, vars.WriteTimeout} {
+		if timeout, ok := c.rawInt(key); ok && timeout <= 0 {
+			errs = append(errs, ConfigError{key, fmt.Sprintf("%d must be greater than 0", timeout)})
+		} else if !ok {
+			errs = append(errs, ConfigError{key, "must be an integer"})
+		}
+	}
+
+	switch c.Get(vars.PersistDir).(type) {
+	case nil, string:
+	default:
+		errs = append(errs, ConfigError{vars.PersistDir, "must be a string"})
+	}
+
+	if logLevel := c.Get(vars.LogLevel); logLevel != nil && c.LogLevel() != logLevel {
+		errs = append(errs, ConfigError{vars.LogLevel, fmt.Sprintf("%v must be one of %s", logLevel, strings.Join(LogLevels, ", "))})
+	}
+
+	for _, key := range []string{vars.RateLimitClient, vars.RateLimitStack, vars.MaxDatabases, vars.MaxStacksPerDatabase, vars.MaxMemory} {
+		if rateLimit, ok := c.rawInt(key); ok && rateLimit < 0 {
+			errs = append(errs, ConfigError{key, fmt.Sprintf("%d must be 0 or greater", rateLimit)})
+		} else if !ok {
+			errs = append(errs, ConfigError{key, "must be an integer"})
+		}
+	}
+
+	switch c.Get(vars.SpillDir).(type) {
+	case nil, string:
+	default:
+		errs = append(errs, ConfigError{vars.SpillDir, "must be a string"})
+	}
+
+	for _, key := range []string{vars.CORSOrigins, vars.CORSMethods, vars.CORSHeaders} {
+		switch c.Get(key).(type) {
+		case nil, string:
+		default:
+			errs = append(errs, ConfigError{key, "must be a string"})
+		}
+	}
+
+	switch templates := c.Get(vars.StackTemplates).(type) {
+	case nil:
+	case string:
+		if _, err := ParseStackTemplates(templates); err != nil {
+			errs = append(errs, ConfigError{vars.StackTemplates, err.Error()})
+		}
+	default:
+		errs = append(errs, ConfigError{vars.StackTemplates, "must be a string"})
+	}
+
+	switch keys := c.Get(vars.EncryptionKeys).(type) {
+	case nil:
+	case string:
+		if _, err := ParseEncryptionKeys(keys); err != nil {
+			errs = append(errs, ConfigError{vars.EncryptionKeys, err.Error()})
+		}
+	default:
+		errs = append(errs, ConfigError{vars.EncryptionKeys, "must be a string"})
+	}
+
+	return errs
+}
+
+// rawInt returns the integer value of a config key, without
+// falling back to any default. A key that is not set is
+// considered valid and its default value is returned.
+func (c *Config) rawInt(key string) (int, bool) {
+	switch value := c.Get(key).(type) {
+	case nil:
+		return vars.DefaultInt(key), true
+	case int:
+		return value, true
+	case float64:
+		return int(value), true
+	case string:
+		i, err := strconv.Atoi(value)
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+)
+
+func TestConfigValidate(t *testing.T) {
+	c := NewConfig().Default()
+
+	if errs := c.Validate(); len(errs) != 0 {
+		t.Errorf("errors are %v, expected none", errs)
+	}
+
+	c.Set(vars.Port, 8080)
+	c.Set(vars.MaxStackSize, "100")
+	c.Set(vars.MaxElementSize, -1)
+	c.Set(vars.ReadTimeout, 10.0)
+	c.Set(vars.PersistDir, "/tmp/piladb")
+	c.Set(vars.LogLevel, "off")
+	c.Set(vars.RateLimitClient, 100)
+	c.Set(vars.RateLimitStack, "10")
+	c.Set(vars.SpillDir, "/tmp/piladb-spill")
+	c.Set(vars.CORSOrigins, "*")
+	c.Set(vars.MaxDatabases, 10)
+	c.Set(vars.MaxStacksPerDatabase, "100")
+	c.Set(vars.MaxMemory, 1<<30)
+	if errs := c.Validate(); len(errs) != 0 {
+		t.Errorf("errors are %v, expected none", errs)
+	}
+}
+
+func TestConfigValidate_Errors(t *testing.T) {
+	c := NewConfig()
+	c.Set(vars.Port, 80)
+	c.Set(vars.MaxStackSize, -5)
+	c.Set(vars.MaxElementSize, 0)
+	c.Set(vars.ReadTimeout, "foo")
+	c.Set(vars.WriteTimeout, 0)
+	c.Set(vars.PersistDir, 8)
+	c.Set(vars.LogLevel, "trace")
+	c.Set(vars.RateLimitClient, -1)
+	c.Set(vars.RateLimitStack, "foo")
+	c.Set(vars.MaxDatabases, -2)
+	c.Set(vars.SpillDir, false)
+	c.Set(vars.CORSMethods, 8)
+	c.Set(vars.StackTemplates, "queues:jobs?type=heap")
+	c.Set(vars.EncryptionKeys, "2024")
+
+	expectedErrs := []ConfigError{
+		{vars.Port, "80 is out of range 1025-65535"},
+		{vars.MaxStackSize, "-5 must be -1 or greater"},
+		{vars.MaxElementSize, "0 must be -1 or greater than 0"},
+		{vars.ReadTimeout, "must be an integer"},
+		{vars.WriteTimeout, "0 must be greater than 0"},
+		{vars.PersistDir, "must be a string"},
+		{vars.LogLevel, "trace must be one of debug, info, warn, error, off"},
+		{vars.RateLimitClient, "-1 must be 0 or greater"},
+		{vars.RateLimitStack, "must be an integer"},
+		{vars.MaxDatabases, "-2 must be 0 or greater"},
+		{vars.SpillDir, "must be a string"},
+		{vars.CORSMethods, "must be a string"},
+		{vars.StackTemplates, "template queues: stack jobs: unknown type heap"},
+		{vars.EncryptionKeys, "encryption key 2024 has no ID"},
+	}
+
+	if errs := c.Validate(); !reflect.DeepEqual(errs, expectedErrs) {
+		t.Errorf("errors are %v, expected %v", errs, expectedErrs)
+	}
+}
+
+func TestConfigErrorError(t *testing.T) {
+	err := ConfigError{Field: vars.Port, Message: "must be an integer"}
+
+	if expected := "PORT: must be an integer"; err.Error() != expected {
+		t.Errorf("error is %s, expected %s", err.Error(), expected)
+	}
+}
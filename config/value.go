@@ -2,6 +2,7 @@ package config
 
 import (
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/fern4lvarez/piladb/config/vars"
@@ -14,6 +15,21 @@ func (c *Config) MaxStackSize() int {
 	return intValue(maxSize, vars.MaxStackSizeDefault)
 }
 
+// MaxElementSize returns the value of MAX_ELEMENT_SIZE,
+// -1 if unlimited.
+// Type: int, Default: 1048576
+func (c *Config) MaxElementSize() int {
+	maxSize := c.Get(vars.MaxElementSize)
+	if maxSize == -1 {
+		return -1
+	}
+
+	if s := intValue(maxSize, vars.MaxElementSizeDefault); s > 0 || s == -1 {
+		return s
+	}
+	return vars.MaxElementSizeDefault
+}
+
 // ReadTimeout returns the value of READ_TIMEOUT.
 // Type: time.Duration, Default: 30
 func (c *Config) ReadTimeout() time.Duration {
@@ -36,12 +52,134 @@ func (c *Config) Port() int {
 	port := c.Get(vars.Port)
 	t := intValue(port, vars.PortDefault)
 
-	if t < 1025 || t > 65536 {
+	if t < 1025 || t > 65535 {
 		return vars.PortDefault
 	}
 	return t
 }
 
+// PersistDir returns the value of PERSIST_DIR.
+// Type: string, Default: ""
+func (c *Config) PersistDir() string {
+	persistDir := c.Get(vars.PersistDir)
+	return stringValue(persistDir, vars.PersistDirDefault)
+}
+
+// SpillDir returns the value of SPILL_DIR.
+// Type: string, Default: ""
+func (c *Config) SpillDir() string {
+	spillDir := c.Get(vars.SpillDir)
+	return stringValue(spillDir, vars.SpillDirDefault)
+}
+
+// CORSOrigins returns the value of CORS_ORIGINS,
+// split by commas.
+// Type: []string, Default: []
+func (c *Config) CORSOrigins() []string {
+	origins := c.Get(vars.CORSOrigins)
+	return listValue(origins, vars.CORSOriginsDefault)
+}
+
+// CORSMethods returns the value of CORS_METHODS,
+// split by commas.
+// Type: []string, Default: [GET POST PUT DELETE PATCH]
+func (c *Config) CORSMethods() []string {
+	methods := c.Get(vars.CORSMethods)
+	return listValue(methods, vars.CORSMethodsDefault)
+}
+
+// CORSHeaders returns the value of CORS_HEADERS,
+// split by commas.
+// Type: []string, Default: [Authorization Content-Type]
+func (c *Config) CORSHeaders() []string {
+	headers := c.Get(vars.CORSHeaders)
+	return listValue(headers, vars.CORSHeadersDefault)
+}
+
+// MaxDatabases returns the value of MAX_DATABASES,
+// 0 if unlimited.
+// Type: int, Default: 0
+func (c *Config) MaxDatabases() int {
+	maxDatabases := c.Get(vars.MaxDatabases)
+	if m := intValue(maxDatabases, vars.MaxDatabasesDefault); m > 0 {
+		return m
+	}
+	return vars.MaxDatabasesDefault
+}
+
+// MaxStacksPerDatabase returns the value of MAX_STACKS_PER_DATABASE,
+// 0 if unlimited.
+// Type: int, Default: 0
+func (c *Config) MaxStacksPerDatabase() int {
+	maxStacks := c.Get(vars.MaxStacksPerDatabase)
+	if m := intValue(maxStacks, vars.MaxStacksPerDatabaseDefault); m > 0 {
+		return m
+	}
+	return vars.MaxStacksPerDatabaseDefault
+}
+
+// MaxMemory returns the value of MAX_MEMORY,
+// 0 if unlimited.
+// Type: int64, Default: 0
+func (c *Config) MaxMemory() int64 {
+	maxMemory := c.Get(vars.MaxMemory)
+	if m := intValue(maxMemory, vars.MaxMemoryDefault); m > 0 {
+		return int64(m)
+	}
+	return vars.MaxMemoryDefault
+}
+
+// RateLimitClient returns the value of RATE_LIMIT_CLIENT,
+// 0 if unlimited.
+// Type: int, Default: 0
+func (c *Config) RateLimitClient() int {
+	rateLimit := c.Get(vars.RateLimitClient)
+	if r := intValue(rateLimit, vars.RateLimitClientDefault); r > 0 {
+		return r
+	}
+	return vars.RateLimitClientDefault
+}
+
+// RateLimitStack returns the value of RATE_LIMIT_STACK,
+// 0 if unlimited.
+// Type: int, Default: 0
+func (c *Config) RateLimitStack() int {
+	rateLimit := c.Get(vars.RateLimitStack)
+	if r := intValue(rateLimit, vars.RateLimitStackDefault); r > 0 {
+		return r
+	}
+	return vars.RateLimitStackDefault
+}
+
+const (
+	// LogLevelDebug logs the details of every handled request.
+	LogLevelDebug = "debug"
+	// LogLevelInfo logs every request and event of pilad.
+	LogLevelInfo = "info"
+	// LogLevelWarn logs unexpected events only.
+	LogLevelWarn = "warn"
+	// LogLevelError logs errors only.
+	LogLevelError = "error"
+	// LogLevelOff disables logging.
+	LogLevelOff = "off"
+)
+
+// LogLevels are the valid values of LOG_LEVEL,
+// from the most to the least verbose.
+var LogLevels = []string{LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError, LogLevelOff}
+
+// LogLevel returns the value of LOG_LEVEL, one of LogLevels.
+// Type: string, Default: info
+func (c *Config) LogLevel() string {
+	logLevel := stringValue(c.Get(vars.LogLevel), vars.LogLevelDefault)
+	for _, l := range LogLevels {
+		if logLevel == l {
+			return logLevel
+		}
+	}
+	return vars.LogLevelDefault
+}
+
 // intValue returns an Integer value given another value as an
 // interface. If conversion fails, a default value is used.
 func intValue(value interface{}, defaultValue int) int {
@@ -63,3 +201,25 @@ func intValue(value interface{}, defaultValue int) int {
 		return defaultValue
 	}
 }
+
+// stringValue returns a String value given another value as an
+// interface. If it is not a string, a default value is used.
+func stringValue(value interface{}, defaultValue string) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return defaultValue
+}
+
+// listValue returns the non-empty items of a comma-separated String
+// value given another value as an interface. If it is not a string,
+// a default value is used.
+func listValue(value interface{}, defaultValue string) []string {
+	items := []string{}
+	for _, item := range strings.Split(stringValue(value, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
@@ -32,6 +33,35 @@ func TestMaxStackSize(t *testing.T) {
 	}
 }
 
+func TestMaxElementSize(t *testing.T) {
+	c := NewConfig()
+
+	inputOutput := []struct {
+		input  interface{}
+		output int
+	}{
+		{nil, vars.MaxElementSizeDefault},
+		{1024, 1024},
+		{2048.0, 2048},
+		{"512", 512},
+		{-1, -1},
+		{"-1", -1},
+		{0, vars.MaxElementSizeDefault},
+		{-35, vars.MaxElementSizeDefault},
+		{"foo", vars.MaxElementSizeDefault},
+	}
+
+	for _, io := range inputOutput {
+		if io.input != nil {
+			c.Set(vars.MaxElementSize, io.input)
+		}
+
+		if s := c.MaxElementSize(); s != io.output {
+			t.Errorf("MaxElementSize is %d, expected %d", s, io.output)
+		}
+	}
+}
+
 func TestReadTimeout(t *testing.T) {
 	c := NewConfig()
 
@@ -94,6 +124,8 @@ func TestPort(t *testing.T) {
 		{"foo", vars.PortDefault},
 		{[]byte("foo"), vars.PortDefault},
 		{6736373635, vars.PortDefault},
+		{65535, 65535},
+		{65536, vars.PortDefault},
 	}
 
 	for _, io := range inputOutput {
@@ -104,3 +136,169 @@ func TestPort(t *testing.T) {
 		}
 	}
 }
+
+func TestRateLimit(t *testing.T) {
+	c := NewConfig()
+
+	inputOutput := []struct {
+		input  interface{}
+		output int
+	}{
+		{nil, 0},
+		{100, 100},
+		{23.7, 23},
+		{"10", 10},
+		{-1, 0},
+		{-3.0, 0},
+		{"foo", 0},
+	}
+
+	for _, io := range inputOutput {
+		if io.input != nil {
+			c.Set(vars.RateLimitClient, io.input)
+			c.Set(vars.RateLimitStack, io.input)
+		}
+
+		if r := c.RateLimitClient(); r != io.output {
+			t.Errorf("RateLimitClient is %d, expected %d", r, io.output)
+		}
+		if r := c.RateLimitStack(); r != io.output {
+			t.Errorf("RateLimitStack is %d, expected %d", r, io.output)
+		}
+	}
+}
+
+func TestMaxDatabasesStacksMemory(t *testing.T) {
+	c := NewConfig()
+
+	inputOutput := []struct {
+		input  interface{}
+		output int
+	}{
+		{nil, 0},
+		{100, 100},
+		{23.7, 23},
+		{"10", 10},
+		{-1, 0},
+		{"foo", 0},
+	}
+
+	for _, io := range inputOutput {
+		if io.input != nil {
+			c.Set(vars.MaxDatabases, io.input)
+			c.Set(vars.MaxStacksPerDatabase, io.input)
+			c.Set(vars.MaxMemory, io.input)
+		}
+
+		if m := c.MaxDatabases(); m != io.output {
+			t.Errorf("MaxDatabases is %d, expected %d", m, io.output)
+		}
+		if m := c.MaxStacksPerDatabase(); m != io.output {
+			t.Errorf("MaxStacksPerDatabase is %d, expected %d", m, io.output)
+		}
+		if m := c.MaxMemory(); m != int64(io.output) {
+			t.Errorf("MaxMemory is %d, expected %d", m, io.output)
+		}
+	}
+}
+
+func TestPersistDir(t *testing.T) {
+	c := NewConfig()
+
+	inputOutput := []struct {
+		input  interface{}
+		output string
+	}{
+		{"/tmp/piladb", "/tmp/piladb"},
+		{"", ""},
+		{8, vars.PersistDirDefault},
+	}
+
+	for _, io := range inputOutput {
+		c.Set(vars.PersistDir, io.input)
+
+		if s := c.PersistDir(); s != io.output {
+			t.Errorf("PersistDir is %s, expected %s", s, io.output)
+		}
+	}
+}
+
+func TestSpillDir(t *testing.T) {
+	c := NewConfig()
+
+	inputOutput := []struct {
+		input  interface{}
+		output string
+	}{
+		{"/tmp/piladb-spill", "/tmp/piladb-spill"},
+		{"", ""},
+		{8, vars.SpillDirDefault},
+	}
+
+	for _, io := range inputOutput {
+		c.Set(vars.SpillDir, io.input)
+
+		if s := c.SpillDir(); s != io.output {
+			t.Errorf("SpillDir is %s, expected %s", s, io.output)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	c := NewConfig()
+	if origins := c.CORSOrigins(); len(origins) != 0 {
+		t.Errorf("CORSOrigins is %v, expected none", origins)
+	}
+	if methods, expected := c.CORSMethods(), []string{"GET", "POST", "PUT", "DELETE", "PATCH"}; !reflect.DeepEqual(methods, expected) {
+		t.Errorf("CORSMethods is %v, expected %v", methods, expected)
+	}
+	if headers, expected := c.CORSHeaders(), []string{"Authorization", "Content-Type"}; !reflect.DeepEqual(headers, expected) {
+		t.Errorf("CORSHeaders is %v, expected %v", headers, expected)
+	}
+
+	inputOutput := []struct {
+		input  interface{}
+		output []string
+	}{
+		{"https://example.com", []string{"https://example.com"}},
+		{" https://a.example.com, https://b.example.com ,", []string{"https://a.example.com", "https://b.example.com"}},
+		{"", []string{}},
+		{8, []string{}},
+	}
+
+	for _, io := range inputOutput {
+		c.Set(vars.CORSOrigins, io.input)
+
+		if origins := c.CORSOrigins(); !reflect.DeepEqual(origins, io.output) {
+			t.Errorf("CORSOrigins is %v, expected %v", origins, io.output)
+		}
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	c := NewConfig()
+	if s := c.LogLevel(); s != vars.LogLevelDefault {
+		t.Errorf("LogLevel is %s, expected %s", s, vars.LogLevelDefault)
+	}
+
+	inputOutput := []struct {
+		input  interface{}
+		output string
+	}{
+		{LogLevelOff, LogLevelOff},
+		{LogLevelInfo, LogLevelInfo},
+		{LogLevelDebug, LogLevelDebug},
+		{LogLevelWarn, LogLevelWarn},
+		{LogLevelError, LogLevelError},
+		{"trace", vars.LogLevelDefault},
+		{8, vars.LogLevelDefault},
+	}
+
+	for _, io := range inputOutput {
+		c.Set(vars.LogLevel, io.input)
+
+		if s := c.LogLevel(); s != io.output {
+			t.Errorf("LogLevel is %s, expected %s", s, io.output)
+		}
+	}
+}
@@ -10,6 +10,14 @@ const (
 	// of MaxStackSize.
 	MaxStackSizeDefault = -1
 
+	// MaxElementSize is the maximum size in bytes
+	// of an element pushed into a stack, -1 if
+	// unlimited.
+	MaxElementSize = "MAX_ELEMENT_SIZE"
+	// MaxElementSizeDefault represents the default
+	// value of MaxElementSize, 1 MB.
+	MaxElementSizeDefault = 1 << 20
+
 	// ReadTimeout is the maximun duration
 	// before timing out the read of a request
 	// to pilad.
@@ -27,13 +35,114 @@ const (
 	WriteTimeoutDefault = 45
 
 	// Port is the TCP port number where pilad
-	// is running. Port number range is 1025-65536.
+	// is running. Port number range is 1025-65535.
 	Port = "PORT"
 	// PortDefault represents the default value
 	// of Port.
 	PortDefault = 1205
+
+	// PersistDir is the directory where pilad
+	// stores the append-only log of operations.
+	PersistDir = "PERSIST_DIR"
+	// PersistDirDefault represents the default value
+	// of PersistDir, i.e. no persistence.
+	PersistDirDefault = ""
+
+	// LogLevel is the logging level of pilad,
+	// one of debug, info, warn, error or off.
+	LogLevel = "LOG_LEVEL"
+	// LogLevelDefault represents the default value
+	// of LogLevel.
+	LogLevelDefault = "info"
+
+	// RateLimitClient is the maximum number of requests
+	// per second served to a client, identified by its
+	// token or IP address, 0 if unlimited.
+	RateLimitClient = "RATE_LIMIT_CLIENT"
+	// RateLimitClientDefault represents the default
+	// value of RateLimitClient.
+	RateLimitClientDefault = 0
+
+	// RateLimitStack is the maximum number of requests
+	// per second served on a stack, 0 if unlimited.
+	RateLimitStack = "RATE_LIMIT_STACK"
+	// RateLimitStackDefault represents the default
+	// value of RateLimitStack.
+	RateLimitStackDefault = 0
+
+	// SpillDir is the directory where pilad stores
+	// the elements of stacks that spill to disk.
+	SpillDir = "SPILL_DIR"
+	// SpillDirDefault represents the default value of
+	// SpillDir, i.e. stacks can not spill to disk.
+	SpillDirDefault = ""
+
+	// CORSOrigins is the comma-separated list of origins
+	// allowed to call pilad from a browser, * being any
+	// origin.
+	CORSOrigins = "CORS_ORIGINS"
+	// CORSOriginsDefault represents the default value of
+	// CORSOrigins, i.e. CORS requests are not allowed.
+	CORSOriginsDefault = ""
+
+	// CORSMethods is the comma-separated list of methods
+	// allowed in CORS requests.
+	CORSMethods = "CORS_METHODS"
+	// CORSMethodsDefault represents the default value
+	// of CORSMethods.
+	CORSMethodsDefault = "GET,POST,PUT,DELETE,PATCH"
+
+	// CORSHeaders is the comma-separated list of headers
+	// allowed in CORS requests.
+	CORSHeaders = "CORS_HEADERS"
+	// CORSHeadersDefault represents the default value
+	// of CORSHeaders.
+	CORSHeadersDefault = "Authorization,Content-Type"
+
+	// StackTemplates are the templates of Stacks created
+	// along with a Database, as semicolon-separated
+	// name:stack,stack... pairs, where each stack is its
+	// name followed by type, max_size, policy and ttl
+	// query parameters, e.g. queues:jobs?type=queue&ttl=1h.
+	StackTemplates = "STACK_TEMPLATES"
+	// StackTemplatesDefault represents the default value
+	// of StackTemplates, i.e. no templates.
+	StackTemplatesDefault = ""
+
+	// EncryptionKeys are the AES keys encrypting the
+	// elements of encrypted stacks, as comma-separated
+	// id:key pairs, where each key is encoded in base64
+	// and the last one encrypts new elements.
+	EncryptionKeys = "ENCRYPTION_KEYS"
+	// EncryptionKeysDefault represents the default value
+	// of EncryptionKeys, i.e. stacks can not be encrypted.
+	EncryptionKeysDefault = ""
+
+	// MaxDatabases is the maximum number of databases
+	// of pilad, 0 if unlimited.
+	MaxDatabases = "MAX_DATABASES"
+	// MaxDatabasesDefault represents the default
+	// value of MaxDatabases.
+	MaxDatabasesDefault = 0
+
+	// MaxStacksPerDatabase is the maximum number of stacks
+	// of a database, 0 if unlimited.
+	MaxStacksPerDatabase = "MAX_STACKS_PER_DATABASE"
+	// MaxStacksPerDatabaseDefault represents the default
+	// value of MaxStacksPerDatabase.
+	MaxStacksPerDatabaseDefault = 0
+
+	// MaxMemory is the maximum memory in bytes used by
+	// the elements of every database, 0 if unlimited.
+	MaxMemory = "MAX_MEMORY"
+	// MaxMemoryDefault represents the default
+	// value of MaxMemory.
+	MaxMemoryDefault = 0
 )
 
+// Names are the names of all the config values.
+var Names = []string{MaxStackSize, MaxElementSize, ReadTimeout, WriteTimeout, Port, PersistDir, LogLevel, RateLimitClient, RateLimitStack, SpillDir, CORSOrigins, CORSMethods, CORSHeaders, StackTemplates, EncryptionKeys, MaxDatabases, MaxStacksPerDatabase, MaxMemory}
+
 // Env returns the environment variable name
 // given a config name.
 func Env(name string) string {
@@ -46,12 +155,48 @@ func DefaultInt(name string) int {
 	switch name {
 	case MaxStackSize:
 		return MaxStackSizeDefault
+	case MaxElementSize:
+		return MaxElementSizeDefault
 	case ReadTimeout:
 		return ReadTimeoutDefault
 	case WriteTimeout:
 		return WriteTimeoutDefault
 	case Port:
 		return PortDefault
+	case RateLimitClient:
+		return RateLimitClientDefault
+	case RateLimitStack:
+		return RateLimitStackDefault
+	case MaxDatabases:
+		return MaxDatabasesDefault
+	case MaxStacksPerDatabase:
+		return MaxStacksPerDatabaseDefault
+	case MaxMemory:
+		return MaxMemoryDefault
 	}
 	return -1
 }
+
+// DefaultString returns the default value of a config
+// name of string type.
+func DefaultString(name string) string {
+	switch name {
+	case PersistDir:
+		return PersistDirDefault
+	case LogLevel:
+		return LogLevelDefault
+	case SpillDir:
+		return SpillDirDefault
+	case CORSOrigins:
+		return CORSOriginsDefault
+	case CORSMethods:
+		return CORSMethodsDefault
+	case CORSHeaders:
+		return CORSHeadersDefault
+	case StackTemplates:
+		return StackTemplatesDefault
+	case EncryptionKeys:
+		return EncryptionKeysDefault
+	}
+	return ""
+}
@@ -17,9 +17,15 @@ func TestDefaultInt(t *testing.T) {
 		output int
 	}{
 		{MaxStackSize, MaxStackSizeDefault},
+		{MaxElementSize, MaxElementSizeDefault},
 		{ReadTimeout, ReadTimeoutDefault},
 		{WriteTimeout, WriteTimeoutDefault},
 		{Port, PortDefault},
+		{RateLimitClient, RateLimitClientDefault},
+		{RateLimitStack, RateLimitStackDefault},
+		{MaxDatabases, MaxDatabasesDefault},
+		{MaxStacksPerDatabase, MaxStacksPerDatabaseDefault},
+		{MaxMemory, MaxMemoryDefault},
 		{"foo", -1},
 	}
 
@@ -29,3 +35,26 @@ func TestDefaultInt(t *testing.T) {
 		}
 	}
 }
+
+func TestDefaultString(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output string
+	}{
+		{PersistDir, PersistDirDefault},
+		{LogLevel, LogLevelDefault},
+		{SpillDir, SpillDirDefault},
+		{CORSOrigins, CORSOriginsDefault},
+		{CORSMethods, CORSMethodsDefault},
+		{CORSHeaders, CORSHeadersDefault},
+		{StackTemplates, StackTemplatesDefault},
+		{EncryptionKeys, EncryptionKeysDefault},
+		{"foo", ""},
+	}
+
+	for _, io := range inputOutput {
+		if o := DefaultString(io.input); o != io.output {
+			t.Errorf("DefaultString is %v, expected %v", o, io.output)
+		}
+	}
+}
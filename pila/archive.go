@@ -0,0 +1,47 @@
+package pila
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// archiveDump represents an archived Stack.
+type archiveDump struct {
+	Version int       `json:"version"`
+	Stack   stackDump `json:"stack"`
+}
+
+// WriteArchive writes the Stack, i.e. its elements and options, into
+// w using gzip-compressed JSON encoding. Expired elements are not
+// included.
+func (s *Stack) WriteArchive(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	if err := json.NewEncoder(zw).Encode(archiveDump{Version: dumpVersion, Stack: s.dump()}); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// ReadArchive reads a Stack previously written by WriteArchive from r.
+// The Stack is not added to any Database. A Stack that spilled to disk
+// spills into spillDir, unless it is empty, and an encrypted Stack is
+// decrypted with keys.
+func ReadArchive(r io.Reader, spillDir string, keys *Keyring) (*Stack, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var dump archiveDump
+	if err := json.NewDecoder(zr).Decode(&dump); err != nil {
+		return nil, err
+	}
+	if dump.Version != dumpVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", dump.Version)
+	}
+	return dump.Stack.stack(spillDir, keys)
+}
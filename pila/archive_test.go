@@ -0,0 +1,105 @@
+package pila
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStackWriteReadArchive(t *testing.T) {
+	now := time.Now().UTC()
+	s := NewStructureWithLimit(StructureQueue, "s", now, 10, OverflowDropOldest)
+	s.Push("foo")
+	s.Push(8.0)
+	s.Push(map[string]interface{}{"a": "b"})
+	s.RateLimit = 5
+	s.SetHistoryDepth(3)
+	s.Update(now)
+
+	var buf bytes.Buffer
+	if err := s.WriteArchive(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gzip.NewReader(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Errorf("archive is not compressed: %v", err)
+	}
+
+	loaded, err := ReadArchive(&buf, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ID.String() != s.ID.String() || loaded.Name != s.Name || loaded.Database != nil {
+		t.Errorf("stack is %s %s, expected %s %s", loaded.ID, loaded.Name, s.ID, s.Name)
+	}
+	// the elements are pushed again
+	status, expected := loaded.Status(), s.Status()
+	status.PushedAt, expected.PushedAt = nil, nil
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("status is %+v, expected %+v", status, expected)
+	}
+	for _, expected := range []interface{}{"foo", 8.0, map[string]interface{}{"a": "b"}} {
+		if element, _ := loaded.Pop(); !reflect.DeepEqual(element, expected) {
+			t.Errorf("element is %v, expected %v", element, expected)
+		}
+	}
+}
+
+func TestReadArchive_Error(t *testing.T) {
+	var unsupported bytes.Buffer
+	zw := gzip.NewWriter(&unsupported)
+	zw.Write([]byte(`{"version":0,"stack":{"name":"s"}}`))
+	zw.Close()
+
+	inputs := []*bytes.Buffer{
+		bytes.NewBufferString(`{"version":1}`),
+		&unsupported,
+	}
+	for _, input := range inputs {
+		if _, err := ReadArchive(input, "", nil); err == nil {
+			t.Error("err is nil, expected an error")
+		}
+	}
+
+	var truncated bytes.Buffer
+	s := NewStack("s", time.Now())
+	s.Push(strings.Repeat("a", 1024))
+	_ = s.WriteArchive(&truncated)
+	if _, err := ReadArchive(bytes.NewReader(truncated.Bytes()[:truncated.Len()/2]), "", nil); err == nil {
+		t.Error("err is nil, expected an error on a truncated archive")
+	}
+}
+
+func TestStackWriteReadArchive_Encrypted(t *testing.T) {
+	keys := testKeyring(t, "a")
+	s := NewStack("s", time.Now())
+	_ = s.SetEncryption(keys)
+	s.Push("foo")
+	s.Push("bar")
+
+	var buf bytes.Buffer
+	if err := s.WriteArchive(&buf); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	if _, err := ReadArchive(bytes.NewReader(archive), "", nil); err == nil {
+		t.Error("err is nil, expected error")
+	}
+	if _, err := ReadArchive(bytes.NewReader(archive), "", testKeyring(t, "b")); err == nil {
+		t.Error("err is nil, expected error")
+	}
+
+	loaded, err := ReadArchive(bytes.NewReader(archive), "", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Encryption() != keys {
+		t.Error("stack is not encrypted")
+	}
+	if elements := loaded.PopN(2); !reflect.DeepEqual(elements, []interface{}{"bar", "foo"}) {
+		t.Errorf("elements are %v, expected %v", elements, []interface{}{"bar", "foo"})
+	}
+}
@@ -0,0 +1,366 @@
+// Package client provides a Go client of the pilad REST API.
+//
+//	c, err := client.Dial("localhost:1205")
+//	s := c.Database("db").Stack("stack")
+//	err = s.Push("foo")
+//	element, err := s.Pop()
+//
+// A Client keeps a pool of connections to the server, failing over to
+// other servers if it is unreachable, and retries requests. Pushes are
+// sent with an Idempotency-Key, so they are retried too without being
+// pushed twice. A Pipeline pushes many elements in batches.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/uuid"
+)
+
+const (
+	// DefaultTimeout is the default timeout of a request.
+	DefaultTimeout = 10 * time.Second
+	// DefaultRetries is the default number of times a
+	// failed idempotent request is retried.
+	DefaultRetries = 3
+	// DefaultRetryWait is the default period of time
+	// to wait before the first retry of a request.
+	DefaultRetryWait = 100 * time.Millisecond
+	// DefaultPoolSize is the default number of idle
+	// connections kept open to every server.
+	DefaultPoolSize = 64
+)
+
+var (
+	// ErrGone is returned when the requested database
+	// or stack does not exist.
+	ErrGone = errors.New("resource is gone")
+
+	// ErrConflict is returned when creating a database or a stack
+	// that already exists, or pushing into a full stack.
+	ErrConflict = errors.New("conflict")
+
+	// ErrEmpty is returned when popping from an empty stack.
+	ErrEmpty = errors.New("stack is empty")
+
+	// ErrModified is returned when conditionally popping
+	// from a stack that was modified since it was read.
+	ErrModified = errors.New("stack was modified")
+)
+
+// Error is returned when pilad responds with an
+// unexpected status code.
+type Error struct {
+	Method     string
+	URL        string
+	StatusCode int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: unexpected status %d %s",
+		e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Client is a client of a pilad server. Its fields must not be
+// modified once it is in use.
+type Client struct {
+	// Addr is the host and port of the server
+	Addr string
+
+	// HTTPClient executes the requests, its Timeout
+	// being the timeout of every request
+	HTTPClient *http.Client
+
+	// Retries is the number of times a failed idempotent request,
+	// i.e. one that can be safely repeated, is retried. Requests
+	// fail on network errors and 5xx status codes.
+	Retries int
+
+	// RetryWait is the period of time to wait before the first
+	// retry of a request, doubled on every retry, unless Backoff
+	// is set.
+	RetryWait time.Duration
+
+	// Backoff, if not nil, returns the period of
+	// time to wait before every retry of a request.
+	Backoff Backoff
+
+	// Failover are the addresses of other servers, e.g. followers
+	// or nodes of the same cluster, the requests are sent to, in
+	// order, once the current server is unreachable.
+	Failover []string
+
+	// current is the index of the address of the
+	// current server, Addr being the first one
+	current int32
+}
+
+// Dial returns a Client of the pilad server listening on addr, e.g.
+// localhost:1205, failing over to the failover addresses, if any,
+// with the default timeout, retries and pool size. It returns an
+// error if no server is reachable.
+func Dial(addr string, failover ...string) (*Client, error) {
+	c := &Client{
+		Addr:       addr,
+		HTTPClient: &http.Client{Timeout: DefaultTimeout, Transport: NewTransport(DefaultPoolSize)},
+		Retries:    DefaultRetries,
+		RetryWait:  DefaultRetryWait,
+		Failover:   failover,
+	}
+
+	if _, err := c.do("GET", "/_status", nil, nil, true, nil); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewTransport returns an HTTP transport keeping up to
+// poolSize idle connections open to every server, so
+// they are reused by the requests of a Client.
+func NewTransport(poolSize int) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConnsPerHost: poolSize,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// Backoff returns the period of time to wait
+// before the retry-th retry of a request.
+type Backoff func(retry int) time.Duration
+
+// ConstantBackoff returns a Backoff waiting
+// the same period of time before every retry.
+func ConstantBackoff(wait time.Duration) Backoff {
+	return func(int) time.Duration {
+		return wait
+	}
+}
+
+// ExponentialBackoff returns a Backoff waiting wait before the first
+// retry, doubled on every retry up to max, if max is positive.
+func ExponentialBackoff(wait, max time.Duration) Backoff {
+	return func(retry int) time.Duration {
+		d := wait
+		for i := 1; i < retry && (max <= 0 || d < max); i++ {
+			d *= 2
+		}
+		if max > 0 && d > max {
+			return max
+		}
+		return d
+	}
+}
+
+// Jitter returns a Backoff waiting a random period of time between
+// half and the whole period of time of b, so clients failing at once
+// do not retry at once.
+func Jitter(b Backoff) Backoff {
+	return func(retry int) time.Duration {
+		d := b(retry)
+		if d <= 1 {
+			return d
+		}
+		return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	}
+}
+
+// Status represents the status of a pilad server.
+type Status struct {
+	Code             string    `json:"status"`
+	Version          string    `json:"version"`
+	Host             string    `json:"host"`
+	PID              int       `json:"pid"`
+	StartedAt        time.Time `json:"started_at"`
+	RunningFor       float64   `json:"running_for"`
+	NumberGoroutines int       `json:"number_goroutines"`
+	MemoryAlloc      string    `json:"memory_alloc"`
+}
+
+// Status returns the status of the server.
+func (c *Client) Status() (Status, error) {
+	var status Status
+	_, err := c.do("GET", "/_status", nil, nil, true, &status)
+	return status, err
+}
+
+// Databases returns the status of the databases of the server.
+func (c *Client) Databases() (pila.Status, error) {
+	var status pila.Status
+	_, err := c.do("GET", "/databases", nil, nil, true, &status)
+	return status, err
+}
+
+// Database returns a handle of the database called name. The
+// database is not created, see Database.Create.
+func (c *Client) Database(name string) *Database {
+	return &Database{Name: name, client: c}
+}
+
+// do executes a request with an optional JSON body, retrying it if
+// idempotent, and decodes the JSON response into v, if not nil. It
+// returns the status code of successful responses. Status codes 410
+// and 409 return ErrGone and ErrConflict, and any other than 200, 201
+// and 204 return an *Error.
+func (c *Client) do(method, path string, query url.Values, body interface{}, idempotent bool, v interface{}) (int, error) {
+	return c.doKey(method, path, query, body, idempotent, "", v)
+}
+
+// push executes a push request, as do does, sending a new Idempotency-Key
+// so it is retried without pushing its elements twice.
+func (c *Client) push(path string, query url.Values, body interface{}) error {
+	_, err := c.doKey("POST", path, query, body, true, uuid.NewRandom().String(), nil)
+	return err
+}
+
+// doKey executes a request as do does, with an
+// Idempotency-Key header if key is not empty.
+func (c *Client) doKey(method, path string, query url.Values, body interface{}, idempotent bool, key string, v interface{}) (int, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return 0, err
+		}
+	}
+
+	retries := 0
+	if idempotent {
+		retries = c.Retries
+	}
+	// requests not sent, as the server was unreachable, are sent
+	// to every failover server without waiting, nor retrying them
+	failovers := 0
+
+	for retry := 0; ; {
+		addr := c.addr()
+		u := url.URL{Scheme: "http", Host: addr, Path: path, RawQuery: query.Encode()}
+		res, err := c.send(method, u.String(), payload, key)
+		if err == nil && res.StatusCode < http.StatusInternalServerError {
+			defer res.Body.Close()
+			return res.StatusCode, decode(method, u.String(), res, v)
+		}
+		if err == nil {
+			res.Body.Close()
+			err = &Error{Method: method, URL: u.String(), StatusCode: res.StatusCode}
+		} else {
+			c.failover(addr)
+		}
+
+		if isDialError(err) && failovers < len(c.Failover) {
+			failovers++
+			continue
+		}
+		if retry >= retries {
+			return 0, err
+		}
+		retry++
+		failovers = 0
+		time.Sleep(c.backoff(retry))
+	}
+}
+
+// send executes a single request.
+func (c *Client) send(method, rawurl string, payload []byte, key string) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, rawurl, body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	return c.HTTPClient.Do(req)
+}
+
+// addr returns the address of the current server.
+func (c *Client) addr() string {
+	return c.addrAt(atomic.LoadInt32(&c.current))
+}
+
+// addrAt returns the address of the i-th server.
+func (c *Client) addrAt(i int32) string {
+	if i == 0 || int(i) > len(c.Failover) {
+		return c.Addr
+	}
+	return c.Failover[i-1]
+}
+
+// failover makes the server after the one at addr the current
+// one, unless another request already failed over from it.
+func (c *Client) failover(addr string) {
+	if len(c.Failover) == 0 {
+		return
+	}
+	i := atomic.LoadInt32(&c.current)
+	if c.addrAt(i) != addr {
+		return
+	}
+	atomic.CompareAndSwapInt32(&c.current, i, (i+1)%int32(len(c.Failover)+1))
+}
+
+// backoff returns the period of time to
+// wait before the retry-th retry of a request.
+func (c *Client) backoff(retry int) time.Duration {
+	if c.Backoff != nil {
+		return c.Backoff(retry)
+	}
+	return ExponentialBackoff(c.RetryWait, 0)(retry)
+}
+
+// isDialError returns whether err is a network error
+// on connecting to a server, so nothing was sent.
+func isDialError(err error) bool {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	e, ok := err.(*net.OpError)
+	return ok && e.Op == "dial"
+}
+
+// decode checks the status code of a response, and
+// decodes its JSON body into v, if not nil.
+func decode(method, rawurl string, res *http.Response, v interface{}) error {
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+	case http.StatusNoContent:
+		return nil
+	case http.StatusGone:
+		return ErrGone
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusPreconditionFailed:
+		return ErrModified
+	default:
+		return &Error{Method: method, URL: rawurl, StatusCode: res.StatusCode}
+	}
+
+	if v == nil {
+		_, err := io.Copy(ioutil.Discard, res.Body)
+		return err
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
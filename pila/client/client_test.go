@@ -0,0 +1,299 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// response is a canned response of a fake pilad server.
+type response struct {
+	code int
+	body string
+}
+
+// fakeServer returns a server answering each "METHOD /path?query"
+// request with its canned response, and recording the body of the
+// last request into body.
+func fakeServer(t *testing.T, responses map[string]response, body *string) (*httptest.Server, *Client) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.RequestURI()
+		res, ok := responses[key]
+		if !ok {
+			t.Errorf("unexpected request %s", key)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if body != nil {
+			b, _ := ioutil.ReadAll(r.Body)
+			*body = string(b)
+		}
+		w.WriteHeader(res.code)
+		w.Write([]byte(res.body))
+	}))
+
+	c := &Client{
+		Addr:       strings.TrimPrefix(server.URL, "http://"),
+		HTTPClient: &http.Client{Timeout: time.Second},
+	}
+	return server, c
+}
+
+func TestDial(t *testing.T) {
+	server, _ := fakeServer(t, map[string]response{
+		"GET /_status": {http.StatusOK, `{"status":"OK"}`},
+	}, nil)
+	defer server.Close()
+
+	c, err := Dial(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Retries != DefaultRetries || c.RetryWait != DefaultRetryWait || c.HTTPClient.Timeout != DefaultTimeout {
+		t.Errorf("client %v has no default values", c)
+	}
+	if transport, ok := c.HTTPClient.Transport.(*http.Transport); !ok || transport.MaxIdleConnsPerHost != DefaultPoolSize {
+		t.Errorf("transport is %v, expected a pool of %d connections", c.HTTPClient.Transport, DefaultPoolSize)
+	}
+}
+
+func TestDial_Failover(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	downAddr := strings.TrimPrefix(down.URL, "http://")
+	down.Close()
+
+	server, _ := fakeServer(t, map[string]response{
+		"GET /_status": {http.StatusOK, `{"status":"OK"}`},
+	}, nil)
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	c, err := Dial(downAddr, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current := c.addr(); current != addr {
+		t.Errorf("current address is %s, expected %s", current, addr)
+	}
+}
+
+func TestDial_Error(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	if _, err := Dial(addr); err == nil {
+		t.Error("err is nil")
+	}
+	server.Close()
+
+	if _, err := Dial(addr); err == nil {
+		t.Error("err is nil")
+	}
+}
+
+func TestClientDo_Retries(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`8`))
+	}))
+	defer server.Close()
+
+	c := &Client{
+		Addr:       strings.TrimPrefix(server.URL, "http://"),
+		HTTPClient: http.DefaultClient,
+		Retries:    2,
+		RetryWait:  time.Millisecond,
+	}
+
+	var size int
+	if _, err := c.do("GET", "/", nil, nil, true, &size); err != nil {
+		t.Fatal(err)
+	}
+	if size != 8 {
+		t.Errorf("size is %d, expected %d", size, 8)
+	}
+	if requests != 3 {
+		t.Errorf("requests are %d, expected %d", requests, 3)
+	}
+
+	// not idempotent requests are not retried
+	requests = 0
+	_, err := c.do("POST", "/", nil, nil, false, nil)
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("err is %v, expected status %d", err, http.StatusServiceUnavailable)
+	}
+	if requests != 1 {
+		t.Errorf("requests are %d, expected %d", requests, 1)
+	}
+}
+
+func TestClientDo_Failover(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`8`))
+	}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	downAddr := strings.TrimPrefix(down.URL, "http://")
+	down.Close()
+
+	c := &Client{
+		Addr:       downAddr,
+		HTTPClient: http.DefaultClient,
+		Failover:   []string{downAddr, addr},
+	}
+
+	// requests not sent fail over even if not idempotent
+	if _, err := c.do("POST", "/", nil, nil, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if current := c.addr(); current != addr {
+		t.Errorf("current address is %s, expected %s", current, addr)
+	}
+	if _, err := c.do("GET", "/", nil, nil, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("requests are %d, expected %d", requests, 2)
+	}
+
+	// failing over from the last server goes back to the first one
+	c.failover(addr)
+	if current := c.addr(); current != downAddr {
+		t.Errorf("current address is %s, expected %s", current, downAddr)
+	}
+	c.Failover = nil
+	if _, err := c.do("GET", "/", nil, nil, true, nil); err == nil {
+		t.Error("err is nil")
+	}
+}
+
+func TestClientPush_IdempotencyKey(t *testing.T) {
+	var requests int32
+	keys := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys[r.Header.Get("Idempotency-Key")] = true
+		if atomic.AddInt32(&requests, 1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"element":"foo"}`))
+	}))
+	defer server.Close()
+
+	c := &Client{
+		Addr:       strings.TrimPrefix(server.URL, "http://"),
+		HTTPClient: http.DefaultClient,
+		Retries:    1,
+		Backoff:    ConstantBackoff(time.Millisecond),
+	}
+
+	// pushes are retried with the same key
+	if err := c.push("/", nil, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 || len(keys) != 1 || keys[""] {
+		t.Errorf("requests are %d with keys %v, expected %d with a single key", requests, keys, 2)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	inputOutput := []struct {
+		input  Backoff
+		retry  int
+		output time.Duration
+	}{
+		{ConstantBackoff(time.Second), 1, time.Second},
+		{ConstantBackoff(time.Second), 5, time.Second},
+		{ExponentialBackoff(time.Second, 0), 1, time.Second},
+		{ExponentialBackoff(time.Second, 0), 4, 8 * time.Second},
+		{ExponentialBackoff(time.Second, 5*time.Second), 4, 5 * time.Second},
+		{ExponentialBackoff(time.Second, 5*time.Second), 100, 5 * time.Second},
+	}
+
+	for _, io := range inputOutput {
+		if d := io.input(io.retry); d != io.output {
+			t.Errorf("wait before retry %d is %v, expected %v", io.retry, d, io.output)
+		}
+	}
+
+	jitter := Jitter(ConstantBackoff(time.Second))
+	for i := 0; i < 100; i++ {
+		if d := jitter(1); d < time.Second/2 || d > time.Second {
+			t.Fatalf("wait is %v, expected between %v and %v", d, time.Second/2, time.Second)
+		}
+	}
+}
+
+func TestClientDo_Error(t *testing.T) {
+	server, c := fakeServer(t, map[string]response{
+		"GET /gone":     {http.StatusGone, ""},
+		"GET /conflict": {http.StatusConflict, ""},
+		"GET /bad":      {http.StatusBadRequest, ""},
+		"GET /json":     {http.StatusOK, "{"},
+	}, nil)
+	defer server.Close()
+
+	inputOutput := []struct {
+		input  string
+		output error
+	}{
+		{"/gone", ErrGone},
+		{"/conflict", ErrConflict},
+	}
+	for _, io := range inputOutput {
+		if _, err := c.do("GET", io.input, nil, nil, true, nil); err != io.output {
+			t.Errorf("err is %v, expected %v", err, io.output)
+		}
+	}
+
+	_, err := c.do("GET", "/bad", nil, nil, true, nil)
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusBadRequest || e.Error() == "" {
+		t.Errorf("err is %v, expected status %d", err, http.StatusBadRequest)
+	}
+
+	var v interface{}
+	if _, err := c.do("GET", "/json", nil, nil, true, &v); err == nil {
+		t.Error("err is nil")
+	}
+
+	if _, err := c.do("POST", "/", nil, func() {}, false, nil); err == nil {
+		t.Error("err is nil")
+	}
+}
+
+func TestClientStatusDatabases(t *testing.T) {
+	server, c := fakeServer(t, map[string]response{
+		"GET /_status":   {http.StatusOK, `{"status":"OK","version":"v1","pid":42}`},
+		"GET /databases": {http.StatusOK, `{"number_of_databases":1,"databases":[{"id":"1","name":"db","number_of_stacks":2}]}`},
+	}, nil)
+	defer server.Close()
+
+	status, err := c.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Code != "OK" || status.Version != "v1" || status.PID != 42 {
+		t.Errorf("status is %v, expected %v", status, `{"status":"OK","version":"v1","pid":42}`)
+	}
+
+	databases, err := c.Databases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if databases.NumberDatabases != 1 || databases.Databases[0].Name != "db" || databases.Databases[0].NumberStacks != 2 {
+		t.Errorf("databases are %v", databases)
+	}
+}
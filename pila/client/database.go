@@ -0,0 +1,71 @@
+package client
+
+import (
+	"net/url"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// Database is a handle of a database of a pilad server,
+// identified by its name.
+type Database struct {
+	Name string
+
+	client *Client
+}
+
+// Create creates the database. It returns ErrConflict
+// if the database already exists.
+func (db *Database) Create() error {
+	_, err := db.client.do("PUT", "/databases", url.Values{"name": {db.Name}}, nil, true, nil)
+	return err
+}
+
+// Delete deletes the database and all its stacks. It
+// returns ErrGone if the database does not exist.
+func (db *Database) Delete() error {
+	_, err := db.client.do("DELETE", db.path(), nil, nil, true, nil)
+	return err
+}
+
+// Stacks returns the status of the stacks of the database.
+func (db *Database) Stacks() (pila.StacksStatus, error) {
+	var status pila.StacksStatus
+	_, err := db.client.do("GET", db.path()+"/stacks", nil, nil, true, &status)
+	return status, err
+}
+
+// Stack returns a handle of the stack called name. The
+// stack is not created, see Stack.Create.
+func (db *Database) Stack(name string) *Stack {
+	return &Stack{Name: name, Database: db}
+}
+
+// Transaction applies a list of operations on stacks of the database
+// atomically, and returns the element of every operation. It returns
+// ErrConflict if the transaction was rolled back.
+func (db *Database) Transaction(ops []Operation) ([]interface{}, error) {
+	var elements []element
+	if _, err := db.client.do("POST", db.path()+"/_transaction", nil, ops, false, &elements); err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(elements))
+	for i, e := range elements {
+		values[i] = e.Value
+	}
+	return values, nil
+}
+
+// Operation is an operation of a transaction, where Op is one of
+// push, pop or flush, and Stack is the name of a stack.
+type Operation struct {
+	Op      string      `json:"op"`
+	Stack   string      `json:"stack"`
+	Element interface{} `json:"element,omitempty"`
+}
+
+// path returns the path of the database resource.
+func (db *Database) path() string {
+	return "/databases/" + db.Name
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestDatabaseCreateDelete(t *testing.T) {
+	server, c := fakeServer(t, map[string]response{
+		"PUT /databases?name=db":    {http.StatusCreated, `{"id":"1","name":"db"}`},
+		"PUT /databases?name=taken": {http.StatusConflict, ""},
+		"DELETE /databases/db":      {http.StatusNoContent, ""},
+		"DELETE /databases/gone":    {http.StatusGone, ""},
+	}, nil)
+	defer server.Close()
+
+	if err := c.Database("db").Create(); err != nil {
+		t.Error(err)
+	}
+	if err := c.Database("taken").Create(); err != ErrConflict {
+		t.Errorf("err is %v, expected %v", err, ErrConflict)
+	}
+	if err := c.Database("db").Delete(); err != nil {
+		t.Error(err)
+	}
+	if err := c.Database("gone").Delete(); err != ErrGone {
+		t.Errorf("err is %v, expected %v", err, ErrGone)
+	}
+}
+
+func TestDatabaseTransaction(t *testing.T) {
+	var body string
+	server, c := fakeServer(t, map[string]response{
+		"POST /databases/db/_transaction":   {http.StatusOK, `[{"element":"foo"},{"element":"foo"}]`},
+		"POST /databases/gone/_transaction": {http.StatusGone, ""},
+	}, &body)
+	defer server.Close()
+
+	values, err := c.Database("db").Transaction([]Operation{
+		{Op: "push", Stack: "stack", Element: "foo"},
+		{Op: "pop", Stack: "stack"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []interface{}{"foo", "foo"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("values are %v, expected %v", values, expected)
+	}
+	if expected := `[{"op":"push","stack":"stack","element":"foo"},{"op":"pop","stack":"stack"}]`; body != expected {
+		t.Errorf("body is %s, expected %s", body, expected)
+	}
+
+	if _, err := c.Database("gone").Transaction(nil); err != ErrGone {
+		t.Errorf("err is %v, expected %v", err, ErrGone)
+	}
+}
+
+func TestDatabaseStacks(t *testing.T) {
+	server, c := fakeServer(t, map[string]response{
+		"GET /databases/db/stacks":   {http.StatusOK, `{"stacks":[{"name":"stack","peek":"foo","size":1}]}`},
+		"GET /databases/gone/stacks": {http.StatusGone, ""},
+	}, nil)
+	defer server.Close()
+
+	status, err := c.Database("db").Stacks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Stacks) != 1 || status.Stacks[0].Name != "stack" || status.Stacks[0].Size != 1 {
+		t.Errorf("stacks are %v", status)
+	}
+
+	if _, err := c.Database("gone").Stacks(); err != ErrGone {
+		t.Errorf("err is %v, expected %v", err, ErrGone)
+	}
+}
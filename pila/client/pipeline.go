@@ -0,0 +1,216 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBatchSize is the default number of elements
+	// pushed by a Pipeline in a single request.
+	DefaultBatchSize = 100
+	// DefaultFlushInterval is the default period of time
+	// an element waits in a Pipeline before being pushed.
+	DefaultFlushInterval = 50 * time.Millisecond
+	// DefaultPipelineDepth is the default number of batches
+	// waiting to be pushed before Pipeline.Push blocks.
+	DefaultPipelineDepth = 8
+)
+
+// ErrPipelineClosed is returned when pushing
+// into a Pipeline that was closed.
+var ErrPipelineClosed = errors.New("pipeline is closed")
+
+// PipelineOptions configure a Pipeline.
+type PipelineOptions struct {
+	// BatchSize is the number of elements pushed in a single
+	// request, DefaultBatchSize if 0.
+	BatchSize int
+	// FlushInterval is the period of time after which a batch that
+	// is not full is pushed anyway, DefaultFlushInterval if 0, or
+	// never if negative, i.e. until Flush is called.
+	FlushInterval time.Duration
+	// Depth is the number of batches waiting to be pushed before
+	// Push blocks, DefaultPipelineDepth if 0.
+	Depth int
+}
+
+// Pipeline pushes elements into a stack in batches, which are pushed
+// in the background while the next batch is filled, so pushing many
+// elements takes a request for every batch, and Push does not wait
+// for them. Batches are pushed one at a time, in order, so elements
+// keep their order in the stack. Once a batch fails, the following
+// ones are discarded, and the error is returned by Push, Flush and
+// Close. A Pipeline is safe for concurrent use.
+type Pipeline struct {
+	stack    *Stack
+	size     int
+	interval time.Duration
+
+	// batch is the batch being filled, and generation
+	// the number of batches taken before it
+	batch      []interface{}
+	generation uint64
+	closed     bool
+	// mu protects batch, generation and closed
+	mu sync.Mutex
+
+	// batches are the batches to push, sent into in order
+	// while holding sendMu, and pending the ones not pushed
+	batches chan []interface{}
+	sendMu  sync.Mutex
+	pending sync.WaitGroup
+
+	err   error
+	errMu sync.Mutex
+}
+
+// Pipeline returns a new Pipeline pushing elements into the stack.
+// It must be closed once done, so its last elements are pushed.
+func (s *Stack) Pipeline(opts PipelineOptions) *Pipeline {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.Depth <= 0 {
+		opts.Depth = DefaultPipelineDepth
+	}
+
+	p := &Pipeline{
+		stack:    s,
+		size:     opts.BatchSize,
+		interval: opts.FlushInterval,
+		batches:  make(chan []interface{}, opts.Depth),
+	}
+	go p.run()
+	return p
+}
+
+// run pushes the batches of the Pipeline until it is closed.
+func (p *Pipeline) run() {
+	for batch := range p.batches {
+		if p.Err() == nil {
+			if err := p.stack.PushN(batch); err != nil {
+				p.setErr(err)
+			}
+		}
+		p.pending.Done()
+	}
+}
+
+// Push adds an element, which must be encodable as JSON, to the
+// Pipeline, blocking only if too many batches are waiting to be
+// pushed. It returns the error of a batch that failed, if any.
+func (p *Pipeline) Push(v interface{}) error {
+	if err := p.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPipelineClosed
+	}
+	p.batch = append(p.batch, v)
+	if len(p.batch) == 1 && p.interval > 0 {
+		generation := p.generation
+		time.AfterFunc(p.interval, func() {
+			p.flush(generation)
+		})
+	}
+	if len(p.batch) < p.size {
+		p.mu.Unlock()
+		return nil
+	}
+	p.send(p.take())
+	return nil
+}
+
+// flush sends the batch being filled to be pushed, if it is
+// still the one of the given generation and is not empty.
+func (p *Pipeline) flush(generation uint64) {
+	p.mu.Lock()
+	if p.closed || p.generation != generation || len(p.batch) == 0 {
+		p.mu.Unlock()
+		return
+	}
+	p.send(p.take())
+}
+
+// take returns the batch being filled, starting a new one.
+// It must be called while holding mu.
+func (p *Pipeline) take() []interface{} {
+	batch := p.batch
+	p.batch = nil
+	p.generation++
+	p.pending.Add(1)
+	return batch
+}
+
+// send sends a batch taken while holding mu to be pushed, and
+// releases mu. Batches are sent in the order they were taken.
+func (p *Pipeline) send(batch []interface{}) {
+	p.sendMu.Lock()
+	p.mu.Unlock()
+	p.batches <- batch
+	p.sendMu.Unlock()
+}
+
+// Flush pushes the elements added to the Pipeline, waits until they
+// are pushed, and returns the error of a batch that failed, if any.
+func (p *Pipeline) Flush() error {
+	p.mu.Lock()
+	if len(p.batch) > 0 {
+		p.send(p.take())
+	} else {
+		p.mu.Unlock()
+	}
+
+	p.pending.Wait()
+	return p.Err()
+}
+
+// Close pushes the elements added to the Pipeline, as Flush does,
+// and closes it, so no more elements can be pushed.
+func (p *Pipeline) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return p.Err()
+	}
+	p.closed = true
+	var batch []interface{}
+	if len(p.batch) > 0 {
+		batch = p.take()
+	}
+
+	p.sendMu.Lock()
+	p.mu.Unlock()
+	if batch != nil {
+		p.batches <- batch
+	}
+	close(p.batches)
+	p.sendMu.Unlock()
+
+	p.pending.Wait()
+	return p.Err()
+}
+
+// Err returns the error of the first batch that failed, if any.
+func (p *Pipeline) Err() error {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	return p.err
+}
+
+// setErr records the error of a batch, unless one was recorded.
+func (p *Pipeline) setErr(err error) {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bulkServer returns a server recording the elements of
+// the bulk pushes it receives, failing them if fail is set.
+func bulkServer(t *testing.T, fail bool) (*httptest.Server, *Client, func() [][]interface{}) {
+	var mu sync.Mutex
+	var batches [][]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Method + " " + r.URL.RequestURI(); key != "POST /databases/db/stacks/stack/_bulk" {
+			t.Errorf("unexpected request %s", key)
+		}
+		if fail {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		var batch []interface{}
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+		w.Write([]byte(`{}`))
+	}))
+
+	c := &Client{
+		Addr:       strings.TrimPrefix(server.URL, "http://"),
+		HTTPClient: &http.Client{Timeout: time.Second},
+	}
+	return server, c, func() [][]interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return batches
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	server, c, batches := bulkServer(t, false)
+	defer server.Close()
+
+	p := c.Database("db").Stack("stack").Pipeline(PipelineOptions{BatchSize: 2, FlushInterval: -1, Depth: 1})
+	for i := 0; i < 5; i++ {
+		if err := p.Push(float64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]interface{}{{0.0, 1.0}, {2.0, 3.0}, {4.0}}
+	if !reflect.DeepEqual(batches(), expected) {
+		t.Errorf("batches are %v, expected %v", batches(), expected)
+	}
+
+	if err := p.Push(5.0); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(batches()); n != 4 {
+		t.Errorf("batches are %d, expected %d", n, 4)
+	}
+	if err := p.Push(6.0); err != ErrPipelineClosed {
+		t.Errorf("err is %v, expected %v", err, ErrPipelineClosed)
+	}
+	if err := p.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPipeline_FlushInterval(t *testing.T) {
+	server, c, batches := bulkServer(t, false)
+	defer server.Close()
+
+	p := c.Database("db").Stack("stack").Pipeline(PipelineOptions{FlushInterval: time.Millisecond})
+	defer p.Close()
+	if err := p.Push("foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100 && len(batches()) == 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if expected := [][]interface{}{{"foo"}}; !reflect.DeepEqual(batches(), expected) {
+		t.Errorf("batches are %v, expected %v", batches(), expected)
+	}
+}
+
+func TestPipeline_Concurrent(t *testing.T) {
+	server, c, batches := bulkServer(t, false)
+	defer server.Close()
+
+	p := c.Database("db").Stack("stack").Pipeline(PipelineOptions{BatchSize: 7})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				p.Push("foo")
+			}
+		}()
+	}
+	wg.Wait()
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	for _, batch := range batches() {
+		n += len(batch)
+	}
+	if n != 500 {
+		t.Errorf("pushed elements are %d, expected %d", n, 500)
+	}
+}
+
+func TestPipeline_Error(t *testing.T) {
+	server, c, _ := bulkServer(t, true)
+	defer server.Close()
+
+	p := c.Database("db").Stack("stack").Pipeline(PipelineOptions{BatchSize: 1})
+	p.Push("foo")
+	if err := p.Flush(); err != ErrConflict {
+		t.Errorf("err is %v, expected %v", err, ErrConflict)
+	}
+	if err := p.Push("bar"); err != ErrConflict {
+		t.Errorf("err is %v, expected %v", err, ErrConflict)
+	}
+	if err := p.Close(); err != ErrConflict {
+		t.Errorf("err is %v, expected %v", err, ErrConflict)
+	}
+}
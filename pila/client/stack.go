@@ -0,0 +1,155 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// Stack is a handle of a stack of a pilad server,
+// identified by its name and its database.
+type Stack struct {
+	Name     string
+	Database *Database
+}
+
+// element represents the payload of a stack element.
+type element struct {
+	Value interface{} `json:"element"`
+}
+
+// Create creates the stack. It returns ErrConflict
+// if the stack already exists.
+func (s *Stack) Create() error {
+	return s.create(url.Values{"name": {s.Name}})
+}
+
+// CreateWithLimit creates the stack, which contains at most
+// maxSize elements. policy, either reject or drop_oldest,
+// determines what happens when pushing into the full stack.
+func (s *Stack) CreateWithLimit(maxSize int, policy string) error {
+	return s.create(url.Values{
+		"name":     {s.Name},
+		"max_size": {strconv.Itoa(maxSize)},
+		"policy":   {policy},
+	})
+}
+
+// create creates the stack given the query of the request.
+func (s *Stack) create(query url.Values) error {
+	_, err := s.client().do("PUT", s.Database.path()+"/stacks", query, nil, true, nil)
+	return err
+}
+
+// Delete deletes the stack.
+func (s *Stack) Delete() error {
+	_, err := s.client().do("DELETE", s.path(), url.Values{"full": {""}}, nil, true, nil)
+	return err
+}
+
+// Status returns the status of the stack.
+func (s *Stack) Status() (pila.StackStatus, error) {
+	var status pila.StackStatus
+	_, err := s.client().do("GET", s.path(), nil, nil, true, &status)
+	return status, err
+}
+
+// Push pushes an element, which must be encodable as JSON, on top
+// of the stack. It returns ErrConflict if the stack is full.
+func (s *Stack) Push(v interface{}) error {
+	return s.PushWithTTL(v, 0)
+}
+
+// PushWithTTL pushes an element on top of the stack,
+// which expires after ttl if it is positive.
+func (s *Stack) PushWithTTL(v interface{}, ttl time.Duration) error {
+	var query url.Values
+	if ttl > 0 {
+		query = url.Values{"ttl": {ttl.String()}}
+	}
+
+	return s.client().push(s.path(), query, element{Value: v})
+}
+
+// Pop removes and returns the element on top of the stack.
+// It returns ErrEmpty if the stack is empty.
+func (s *Stack) Pop() (interface{}, error) {
+	return s.pop(nil)
+}
+
+// PopIfVersion removes and returns the element on top of the stack
+// only if its version, as given by Status, is still version. It
+// returns ErrModified otherwise, and ErrEmpty if the stack is empty.
+func (s *Stack) PopIfVersion(version uint64) (interface{}, error) {
+	return s.pop(url.Values{"if_version": {strconv.FormatUint(version, 10)}})
+}
+
+// pop pops the element on top of the stack given a query.
+func (s *Stack) pop(query url.Values) (interface{}, error) {
+	var e element
+	code, err := s.client().do("DELETE", s.path(), query, nil, false, &e)
+	if err != nil {
+		return nil, err
+	}
+	if code == http.StatusNoContent {
+		return nil, ErrEmpty
+	}
+	return e.Value, nil
+}
+
+// PushN pushes elements, which must be encodable as JSON, on top of
+// the stack in order, so the last one ends up on top. It returns
+// ErrConflict if the stack has no room for all of them, in which
+// case none is pushed.
+func (s *Stack) PushN(vs []interface{}) error {
+	return s.client().push(s.path()+"/_bulk", nil, vs)
+}
+
+// PopN removes and returns up to n elements from the top of the
+// stack, the top one first. The slice is empty if the stack is empty.
+func (s *Stack) PopN(n int) ([]interface{}, error) {
+	var elements struct {
+		Values []interface{} `json:"elements"`
+	}
+	query := url.Values{"count": {strconv.Itoa(n)}}
+	if _, err := s.client().do("DELETE", s.path()+"/_bulk", query, nil, false, &elements); err != nil {
+		return nil, err
+	}
+	return elements.Values, nil
+}
+
+// Peek returns the element on top of the stack,
+// or nil if it is empty.
+func (s *Stack) Peek() (interface{}, error) {
+	var e element
+	if _, err := s.client().do("GET", s.path(), url.Values{"peek": {""}}, nil, true, &e); err != nil {
+		return nil, err
+	}
+	return e.Value, nil
+}
+
+// Size returns the number of elements of the stack.
+func (s *Stack) Size() (int, error) {
+	var size int
+	_, err := s.client().do("GET", s.path(), url.Values{"size": {""}}, nil, true, &size)
+	return size, err
+}
+
+// Flush removes all the elements of the stack.
+func (s *Stack) Flush() error {
+	_, err := s.client().do("DELETE", s.path(), url.Values{"flush": {""}}, nil, true, nil)
+	return err
+}
+
+// client returns the Client of the stack.
+func (s *Stack) client() *Client {
+	return s.Database.client
+}
+
+// path returns the path of the stack resource.
+func (s *Stack) path() string {
+	return s.Database.path() + "/stacks/" + s.Name
+}
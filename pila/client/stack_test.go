@@ -0,0 +1,166 @@
+package client
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStackCreateDelete(t *testing.T) {
+	server, c := fakeServer(t, map[string]response{
+		"PUT /databases/db/stacks?name=stack":                             {http.StatusCreated, `{}`},
+		"PUT /databases/db/stacks?max_size=10&name=limited&policy=reject": {http.StatusCreated, `{}`},
+		"PUT /databases/db/stacks?name=taken":                             {http.StatusConflict, ""},
+		"DELETE /databases/db/stacks/stack?full=":                         {http.StatusNoContent, ""},
+	}, nil)
+	defer server.Close()
+
+	db := c.Database("db")
+	if err := db.Stack("stack").Create(); err != nil {
+		t.Error(err)
+	}
+	if err := db.Stack("limited").CreateWithLimit(10, "reject"); err != nil {
+		t.Error(err)
+	}
+	if err := db.Stack("taken").Create(); err != ErrConflict {
+		t.Errorf("err is %v, expected %v", err, ErrConflict)
+	}
+	if err := db.Stack("stack").Delete(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStackPush(t *testing.T) {
+	var body string
+	server, c := fakeServer(t, map[string]response{
+		"POST /databases/db/stacks/stack":         {http.StatusOK, `{"element":{"foo":1}}`},
+		"POST /databases/db/stacks/stack?ttl=30s": {http.StatusOK, `{"element":"foo"}`},
+		"POST /databases/db/stacks/full":          {http.StatusConflict, ""},
+	}, &body)
+	defer server.Close()
+
+	stack := c.Database("db").Stack("stack")
+	if err := stack.Push(map[string]int{"foo": 1}); err != nil {
+		t.Error(err)
+	}
+	if expected := `{"element":{"foo":1}}`; body != expected {
+		t.Errorf("body is %s, expected %s", body, expected)
+	}
+
+	if err := stack.PushWithTTL("foo", 30*time.Second); err != nil {
+		t.Error(err)
+	}
+	if expected := `{"element":"foo"}`; body != expected {
+		t.Errorf("body is %s, expected %s", body, expected)
+	}
+
+	if err := c.Database("db").Stack("full").Push("foo"); err != ErrConflict {
+		t.Errorf("err is %v, expected %v", err, ErrConflict)
+	}
+}
+
+func TestStackPushNPopN(t *testing.T) {
+	var body string
+	server, c := fakeServer(t, map[string]response{
+		"POST /databases/db/stacks/stack/_bulk":           {http.StatusOK, `{}`},
+		"POST /databases/db/stacks/full/_bulk":            {http.StatusConflict, ""},
+		"DELETE /databases/db/stacks/stack/_bulk?count=2": {http.StatusOK, `{"elements":["bar","foo"]}`},
+		"DELETE /databases/db/stacks/gone/_bulk?count=2":  {http.StatusGone, ""},
+	}, &body)
+	defer server.Close()
+
+	db := c.Database("db")
+	if err := db.Stack("stack").PushN([]interface{}{"foo", "bar"}); err != nil {
+		t.Error(err)
+	}
+	if expected := `["foo","bar"]`; body != expected {
+		t.Errorf("body is %s, expected %s", body, expected)
+	}
+	if err := db.Stack("full").PushN([]interface{}{"foo"}); err != ErrConflict {
+		t.Errorf("err is %v, expected %v", err, ErrConflict)
+	}
+
+	elements, err := db.Stack("stack").PopN(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []interface{}{"bar", "foo"}; !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+	if _, err := db.Stack("gone").PopN(2); err != ErrGone {
+		t.Errorf("err is %v, expected %v", err, ErrGone)
+	}
+}
+
+func TestStackPopPeek(t *testing.T) {
+	server, c := fakeServer(t, map[string]response{
+		"DELETE /databases/db/stacks/stack":              {http.StatusOK, `{"element":"foo"}`},
+		"DELETE /databases/db/stacks/empty":              {http.StatusNoContent, ""},
+		"DELETE /databases/db/stacks/gone":               {http.StatusGone, ""},
+		"DELETE /databases/db/stacks/stack?if_version=3": {http.StatusOK, `{"element":"bar"}`},
+		"DELETE /databases/db/stacks/stack?if_version=2": {http.StatusPreconditionFailed, ""},
+		"GET /databases/db/stacks/stack?peek=":           {http.StatusOK, `{"element":8}`},
+		"GET /databases/db/stacks/gone?peek=":            {http.StatusGone, ""},
+	}, nil)
+	defer server.Close()
+
+	db := c.Database("db")
+	if e, err := db.Stack("stack").Pop(); err != nil || e != "foo" {
+		t.Errorf("element is %v, expected %v", e, "foo")
+	}
+	if _, err := db.Stack("empty").Pop(); err != ErrEmpty {
+		t.Errorf("err is %v, expected %v", err, ErrEmpty)
+	}
+	if _, err := db.Stack("gone").Pop(); err != ErrGone {
+		t.Errorf("err is %v, expected %v", err, ErrGone)
+	}
+	if e, err := db.Stack("stack").PopIfVersion(3); err != nil || e != "bar" {
+		t.Errorf("element is %v, expected %v", e, "bar")
+	}
+	if _, err := db.Stack("stack").PopIfVersion(2); err != ErrModified {
+		t.Errorf("err is %v, expected %v", err, ErrModified)
+	}
+
+	if e, err := db.Stack("stack").Peek(); err != nil || e != 8.0 {
+		t.Errorf("element is %v, expected %v", e, 8)
+	}
+	if _, err := db.Stack("gone").Peek(); err != ErrGone {
+		t.Errorf("err is %v, expected %v", err, ErrGone)
+	}
+}
+
+func TestStackSizeFlush(t *testing.T) {
+	server, c := fakeServer(t, map[string]response{
+		"GET /databases/db/stacks/stack?size=":     {http.StatusOK, `3`},
+		"DELETE /databases/db/stacks/stack?flush=": {http.StatusOK, `{}`},
+		"DELETE /databases/db/stacks/gone?flush=":  {http.StatusGone, ""},
+	}, nil)
+	defer server.Close()
+
+	stack := c.Database("db").Stack("stack")
+	if size, err := stack.Size(); err != nil || size != 3 {
+		t.Errorf("size is %d, expected %d", size, 3)
+	}
+	if err := stack.Flush(); err != nil {
+		t.Error(err)
+	}
+	if err := c.Database("db").Stack("gone").Flush(); err != ErrGone {
+		t.Errorf("err is %v, expected %v", err, ErrGone)
+	}
+}
+
+func TestStackStatus(t *testing.T) {
+	server, c := fakeServer(t, map[string]response{
+		"GET /databases/db/stacks/stack": {http.StatusOK, `{"name":"stack","peek":"foo","size":1,"max_size":5}`},
+	}, nil)
+	defer server.Close()
+
+	status, err := c.Database("db").Stack("stack").Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Name != "stack" || status.Peek != "foo" || status.Size != 1 || status.MaxSize != 5 {
+		t.Errorf("status is %v", status)
+	}
+}
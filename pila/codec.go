@@ -0,0 +1,207 @@
+package pila
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/fern4lvarez/piladb/pkg/cbor"
+	"github.com/fern4lvarez/piladb/pkg/msgpack"
+)
+
+// Codec encodes Elements in a media type other than JSON, which is
+// the encoding of Element itself. An Element is encoded as a map with
+// an "element" key, and "priority" and "content_type" keys if it has
+// them, like its JSON encoding, but binary values are kept as they
+// are instead of encoded in base64, if the media type allows it.
+type Codec interface {
+	// ContentType returns the media type of the encoding.
+	ContentType() string
+	// Marshal returns the encoding of an Element.
+	Marshal(element Element) ([]byte, error)
+	// Unmarshal decodes data into an Element. The data may
+	// be reused once Unmarshal returns.
+	Unmarshal(data []byte, element *Element) error
+}
+
+// codecs are the registered Codecs, by media type.
+var codecs = struct {
+	m  map[string]Codec
+	mu sync.RWMutex
+}{m: make(map[string]Codec)}
+
+func init() {
+	RegisterCodec(msgpackCodec{}, "application/x-msgpack")
+	RegisterCodec(cborCodec{})
+}
+
+// RegisterCodec makes a Codec available by its media type, and by
+// any given alias, replacing the Codec registered before for them.
+func RegisterCodec(codec Codec, aliases ...string) {
+	codecs.mu.Lock()
+	defer codecs.mu.Unlock()
+
+	codecs.m[codec.ContentType()] = codec
+	for _, alias := range aliases {
+		codecs.m[alias] = codec
+	}
+}
+
+// LookupCodec returns the Codec registered for a media type,
+// and whether there is any.
+func LookupCodec(mediaType string) (Codec, bool) {
+	codecs.mu.RLock()
+	defer codecs.mu.RUnlock()
+
+	codec, ok := codecs.m[mediaType]
+	return codec, ok
+}
+
+// CodecContentTypes returns the media types, including aliases,
+// of the registered Codecs, sorted.
+func CodecContentTypes() []string {
+	codecs.mu.RLock()
+	defer codecs.mu.RUnlock()
+
+	contentTypes := make([]string, 0, len(codecs.m))
+	for contentType := range codecs.m {
+		contentTypes = append(contentTypes, contentType)
+	}
+	sort.Strings(contentTypes)
+	return contentTypes
+}
+
+// codecValue returns the map encoding an Element with a Codec. Numbers
+// without fractional part are given as integers, as they are likely
+// to be so, but were decoded as float64 from JSON.
+func codecValue(element Element) map[string]interface{} {
+	m := map[string]interface{}{"element": codecNumbers(element.Value)}
+	if element.Priority != nil {
+		m["priority"] = *element.Priority
+	}
+	if element.ContentType != "" {
+		m["content_type"] = element.ContentType
+	}
+	return m
+}
+
+// maxExactInt is the greatest integer a float64 holds exactly.
+const maxExactInt = 1 << 53
+
+// codecNumbers returns value with its integer float64 numbers, if
+// any, converted into int64. Values of types that Codecs do not know
+// are converted into the values of their JSON encoding.
+func codecNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, string, []byte, int, int64, uint64:
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) <= maxExactInt {
+			return int64(v)
+		}
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = codecNumbers(item)
+		}
+		return items
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = codecNumbers(item)
+		}
+		return m
+	default:
+		var decoded interface{}
+		if b, err := json.Marshal(v); err == nil && json.Unmarshal(b, &decoded) == nil {
+			return codecNumbers(decoded)
+		}
+	}
+	return value
+}
+
+// decodeCodecValue decodes into an Element the map encoding it
+// with a Codec. Values that are not binary are converted into the
+// values they would have if the Element was decoded from JSON.
+func (element *Element) decodeCodecValue(value interface{}) error {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return errors.New("element is not a map")
+	}
+
+	element.Priority, element.ContentType = nil, ""
+	if priority, ok := m["priority"]; ok && priority != nil {
+		p, ok := codecFloat(priority)
+		if !ok {
+			return errors.New("priority is not a number")
+		}
+		element.Priority = &p
+	}
+	if contentType, ok := m["content_type"]; ok && contentType != nil {
+		if element.ContentType, ok = contentType.(string); !ok {
+			return errors.New("content_type is not a string")
+		}
+	}
+
+	if data, ok := m["element"].([]byte); ok && element.ContentType != "" {
+		element.Value, element.raw = data, nil
+		return nil
+	}
+	if m["element"] == nil {
+		element.Value, element.raw = nil, nil
+		return nil
+	}
+	raw, err := json.Marshal(m["element"])
+	if err != nil {
+		return err
+	}
+	return element.decodeValue(raw)
+}
+
+// codecFloat returns a decoded number as float64.
+func codecFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// msgpackCodec is the Codec of MessagePack.
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+func (msgpackCodec) Marshal(element Element) ([]byte, error) {
+	return msgpack.Marshal(codecValue(element))
+}
+
+func (msgpackCodec) Unmarshal(data []byte, element *Element) error {
+	value, err := msgpack.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	return element.decodeCodecValue(value)
+}
+
+// cborCodec is the Codec of CBOR.
+type cborCodec struct{}
+
+func (cborCodec) ContentType() string { return "application/cbor" }
+
+func (cborCodec) Marshal(element Element) ([]byte, error) {
+	return cbor.Marshal(codecValue(element))
+}
+
+func (cborCodec) Unmarshal(data []byte, element *Element) error {
+	value, err := cbor.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	return element.decodeCodecValue(value)
+}
@@ -0,0 +1,144 @@
+package pila
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fern4lvarez/piladb/pkg/cbor"
+	"github.com/fern4lvarez/piladb/pkg/msgpack"
+)
+
+func TestLookupCodec(t *testing.T) {
+	for _, contentType := range []string{"application/msgpack", "application/x-msgpack", "application/cbor"} {
+		codec, ok := LookupCodec(contentType)
+		if !ok {
+			t.Fatalf("codec of %s not found", contentType)
+		}
+		if codec.ContentType() == "" {
+			t.Errorf("codec of %s has no content type", contentType)
+		}
+	}
+
+	if _, ok := LookupCodec("application/json"); ok {
+		t.Error("codec of application/json found, expected none")
+	}
+}
+
+type testCodec struct{ msgpackCodec }
+
+func (testCodec) ContentType() string { return "application/x-test" }
+
+func TestRegisterCodec(t *testing.T) {
+	RegisterCodec(testCodec{}, "application/x-test-alias")
+	defer func() {
+		codecs.mu.Lock()
+		delete(codecs.m, "application/x-test")
+		delete(codecs.m, "application/x-test-alias")
+		codecs.mu.Unlock()
+	}()
+
+	if codec, ok := LookupCodec("application/x-test-alias"); !ok || codec.ContentType() != "application/x-test" {
+		t.Errorf("codec is %v, %v, expected application/x-test", codec, ok)
+	}
+
+	expected := []string{"application/cbor", "application/msgpack", "application/x-msgpack", "application/x-test", "application/x-test-alias"}
+	if contentTypes := CodecContentTypes(); !reflect.DeepEqual(contentTypes, expected) {
+		t.Errorf("content types are %v, expected %v", contentTypes, expected)
+	}
+}
+
+func TestCodecMarshal(t *testing.T) {
+	priority := 2.5
+	inputOutput := []struct {
+		input  Element
+		output map[string]interface{}
+	}{
+		{Element{Value: "foo"}, map[string]interface{}{"element": "foo"}},
+		{Element{Value: map[string]interface{}{"one": 1.0, "half": 0.5}, Priority: &priority},
+			map[string]interface{}{"element": map[string]interface{}{"one": int64(1), "half": 0.5}, "priority": 2.5}},
+		{Element{Value: []interface{}{1e20, nil}}, map[string]interface{}{"element": []interface{}{1e20, nil}}},
+		{Element{Value: []byte("hello"), ContentType: "text/plain"},
+			map[string]interface{}{"element": []byte("hello"), "content_type": "text/plain"}},
+		{Element{Value: struct {
+			N int `json:"n"`
+		}{2}}, map[string]interface{}{"element": map[string]interface{}{"n": int64(2)}}},
+	}
+
+	for _, io := range inputOutput {
+		m, err := (msgpackCodec{}).Marshal(io.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value, _ := msgpack.Unmarshal(m); !reflect.DeepEqual(value, io.output) {
+			t.Errorf("msgpack value is %v, expected %v", value, io.output)
+		}
+
+		c, err := (cborCodec{}).Marshal(io.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value, _ := cbor.Unmarshal(c); !reflect.DeepEqual(value, io.output) {
+			t.Errorf("cbor value is %v, expected %v", value, io.output)
+		}
+	}
+}
+
+func TestCodecUnmarshal(t *testing.T) {
+	priority := 2.0
+	elements := []Element{
+		{Value: "foo"},
+		{Value: map[string]interface{}{"one": 1.0, "half": 0.5}, Priority: &priority},
+		{Value: nil},
+		{Value: []byte("hello"), ContentType: "text/plain"},
+	}
+
+	for _, codec := range []Codec{msgpackCodec{}, cborCodec{}} {
+		for _, expected := range elements {
+			b, _ := codec.Marshal(expected)
+			var element Element
+			if err := codec.Unmarshal(b, &element); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(element.Value, expected.Value) || !reflect.DeepEqual(element.Priority, expected.Priority) || element.ContentType != expected.ContentType {
+				t.Errorf("%s: element is %v, expected %v", codec.ContentType(), element, expected)
+			}
+		}
+	}
+}
+
+func TestCodecUnmarshal_StackValue(t *testing.T) {
+	// binary elements may be given in base64 too
+	b, _ := msgpack.Marshal(map[string]interface{}{"element": "aGVsbG8=", "content_type": "text/plain"})
+	var element Element
+	if err := (msgpackCodec{}).Unmarshal(b, &element); err != nil {
+		t.Fatal(err)
+	}
+	value, err := element.StackValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (Binary{ContentType: "text/plain", Data: []byte("hello")}); !reflect.DeepEqual(value, expected) {
+		t.Errorf("value is %v, expected %v", value, expected)
+	}
+}
+
+func TestCodecUnmarshal_Error(t *testing.T) {
+	inputs := []interface{}{
+		"foo",
+		map[string]interface{}{"element": 1, "priority": "high"},
+		map[string]interface{}{"element": 1, "content_type": 1},
+	}
+
+	for _, input := range inputs {
+		b, _ := cbor.Marshal(input)
+		var element Element
+		if err := (cborCodec{}).Unmarshal(b, &element); err == nil {
+			t.Errorf("%v: err is nil, expected error", input)
+		}
+	}
+
+	var element Element
+	if err := (cborCodec{}).Unmarshal([]byte{0xff}, &element); err == nil {
+		t.Error("err is nil, expected error")
+	}
+}
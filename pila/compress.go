@@ -0,0 +1,170 @@
+package pila
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// compressedKind is the type of the value of a compressedElement.
+type compressedKind byte
+
+const (
+	compressedString compressedKind = iota
+	compressedBytes
+	compressedBinary
+	compressedJSON
+)
+
+// compressedElement represents a value of a Stack stored compressed
+// with DEFLATE: the data of a string, []byte or Binary, or the JSON
+// encoding of other values, which are decoded back on read.
+type compressedElement struct {
+	kind        compressedKind
+	contentType string
+	data        []byte
+}
+
+// flateWriters reuses the writers compressing the elements,
+// which are expensive to allocate.
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		// Do not check error as the level is valid.
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// SetCompress makes the Stack store compressed the elements pushed
+// from now on whose size, as given by ElementSize, is at least n bytes,
+// trading CPU for memory. Elements are only compressed if it makes them
+// smaller. Compression is disabled if n is not positive, which is the
+// default, on Stacks not kept in memory and on encrypted Stacks. Elements
+// already in the Stack are not affected.
+func (s *Stack) SetCompress(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt64(&s.compress, int64(n))
+}
+
+// Compress returns the minimum size in bytes of the elements
+// stored compressed by the Stack, 0 if compression is disabled.
+func (s *Stack) Compress() int {
+	return int(atomic.LoadInt64(&s.compress))
+}
+
+// compressElement returns an element of the Stack to store, as given
+// by push, with its value compressed if it is large enough.
+func (s *Stack) compressElement(element interface{}) interface{} {
+	min := s.Compress()
+	if min == 0 || s.store != StoreMemory || s.Encryption() != nil {
+		return element
+	}
+
+	switch e := element.(type) {
+	case prioritizedElement:
+		e.value = s.compressElement(e.value)
+		return e
+	case expiringElement:
+		e.value = s.compressElement(e.value)
+		return e
+	case taggedElement:
+		e.value = s.compressElement(e.value)
+		return e
+	case compressedElement, sealedElement:
+		// moved from another Stack
+		return element
+	}
+	if ElementSize(element) < min {
+		return element
+	}
+
+	var c compressedElement
+	var data []byte
+	switch v := element.(type) {
+	case string:
+		c.kind, data = compressedString, []byte(v)
+	case []byte:
+		c.kind, data = compressedBytes, v
+	case Binary:
+		c.kind, c.contentType, data = compressedBinary, v.ContentType, v.Data
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return element
+		}
+		c.kind = compressedJSON
+	}
+
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	w.Reset(&buf)
+	_, err := w.Write(data)
+	if err == nil {
+		err = w.Close()
+	}
+	flateWriters.Put(w)
+	if err != nil || buf.Len() >= len(data) {
+		return element
+	}
+	c.data = buf.Bytes()
+	return c
+}
+
+// value returns the value of the compressedElement. It
+// returns nil if the data can not be decompressed.
+func (c compressedElement) value() interface{} {
+	r := flate.NewReader(bytes.NewReader(c.data))
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil
+	}
+
+	switch c.kind {
+	case compressedString:
+		return string(data)
+	case compressedBytes:
+		return data
+	case compressedBinary:
+		return Binary{ContentType: c.contentType, Data: data}
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil
+	}
+	return value
+}
+
+// alive returns whether an element of a Stack is not expired at date
+// t, like unwrap, without decompressing it.
+func alive(element interface{}, t time.Time) bool {
+	if e, ok := element.(prioritizedElement); ok {
+		element = e.value
+	}
+	if e, ok := element.(expiringElement); ok {
+		return t.Before(e.expiresAt)
+	}
+	return true
+}
+
+// stored returns the value of an element of a Stack as stored,
+// i.e. a compressedElement if it is compressed, or a sealedElement
+// if it is encrypted.
+func stored(element interface{}) interface{} {
+	if e, ok := element.(prioritizedElement); ok {
+		element = e.value
+	}
+	if e, ok := element.(expiringElement); ok {
+		element = e.value
+	}
+	if e, ok := element.(taggedElement); ok {
+		element = e.value
+	}
+	return element
+}
@@ -0,0 +1,106 @@
+package pila
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStackCompress(t *testing.T) {
+	s := NewStack("s", time.Now())
+	if s.Compress() != 0 {
+		t.Errorf("compress is %d, expected %d", s.Compress(), 0)
+	}
+	s.SetCompress(-1)
+	if s.Compress() != 0 {
+		t.Errorf("compress is %d, expected %d", s.Compress(), 0)
+	}
+	s.SetCompress(64)
+	if s.Compress() != 64 || s.Status().Compress != 64 {
+		t.Errorf("compress is %d, expected %d", s.Compress(), 64)
+	}
+
+	long := strings.Repeat("piladb ", 100)
+	values := []interface{}{
+		"small",
+		long,
+		[]byte(long),
+		Binary{ContentType: "text/plain", Data: []byte(long)},
+		map[string]interface{}{"text": long, "n": 8.0},
+		[]interface{}{long, long},
+	}
+	for _, value := range values {
+		if err := s.Push(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the compressed elements use less memory than their size
+	if memory := s.Memory(); memory > int64(len(long)) {
+		t.Errorf("memory is %d, expected less than %d", memory, len(long))
+	}
+	if !reflect.DeepEqual(s.Peek(), values[len(values)-1]) {
+		t.Errorf("peek is %v, expected %v", s.Peek(), values[len(values)-1])
+	}
+	for i := len(values) - 1; i >= 0; i-- {
+		if value, ok := s.Pop(); !ok || !reflect.DeepEqual(value, values[i]) {
+			t.Errorf("element is %v, expected %v", value, values[i])
+		}
+	}
+	if s.Memory() != 0 {
+		t.Errorf("memory is %d, expected %d", s.Memory(), 0)
+	}
+}
+
+func TestStackCompress_Wrapped(t *testing.T) {
+	long := strings.Repeat("a", 1024)
+	s := NewPriority("s", time.Now())
+	s.SetCompress(1)
+	s.SetUnique(UniqueReject)
+	s.SetHistoryDepth(1)
+	_ = s.PushWithPriority(long, 2, time.Now().Add(time.Hour))
+	_ = s.PushWithPriority("b", 1, time.Time{})
+
+	if element, ok := stored(s.base.Peek()).(compressedElement); !ok || len(element.data) >= len(long) {
+		t.Errorf("element is stored as %T, expected compressed", stored(s.base.Peek()))
+	}
+	if err := s.Push(long); err != ErrDuplicate {
+		t.Errorf("err is %v, expected %v", err, ErrDuplicate)
+	}
+	if value, _ := s.Pop(); value != long {
+		t.Errorf("element is %v, expected %v", value, long)
+	}
+	if value, _ := s.Undo(); value != long {
+		t.Errorf("undone element is %v, expected %v", value, long)
+	}
+	if s.Size() != 2 {
+		t.Errorf("size is %d, expected %d", s.Size(), 2)
+	}
+}
+
+func TestStackCompress_Restore(t *testing.T) {
+	long := strings.Repeat("a", 1024)
+	pila := NewPila()
+	db := NewDatabase("db")
+	_ = pila.AddDatabase(db)
+	s := NewStack("s", time.Now())
+	s.SetCompress(128)
+	_ = s.Push(long)
+	_ = db.AddStack(s)
+
+	var buf bytes.Buffer
+	if err := pila.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewPila()
+	if err := loaded.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	ldb, _ := loaded.DatabaseByName("db")
+	ls, _ := ldb.StackByName("s")
+	if ls.Compress() != 128 || ls.Peek() != long || ls.Memory() != s.Memory() {
+		t.Errorf("stack has compress %d and memory %d, expected %d and %d", ls.Compress(), ls.Memory(), 128, s.Memory())
+	}
+}
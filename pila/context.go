@@ -0,0 +1,81 @@
+package pila
+
+import "context"
+
+// PushCtx pushes an element on top of the Stack like Push, unless ctx
+// is done, in which case nothing is pushed and the error of ctx is
+// returned.
+func (s *Stack) PushCtx(ctx context.Context, element interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Push(element)
+}
+
+// PushWithOptionsCtx pushes an element into the Stack like
+// PushWithOptions, unless ctx is done, in which case nothing
+// is pushed and the error of ctx is returned.
+func (s *Stack) PushWithOptionsCtx(ctx context.Context, element interface{}, opts PushOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.PushWithOptions(element, opts)
+}
+
+// PushNCtx pushes elements into the Stack like PushN, unless ctx
+// is done, in which case none of them is pushed and the error of
+// ctx is returned.
+func (s *Stack) PushNCtx(ctx context.Context, elements []interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.PushN(elements)
+}
+
+// PopCtx removes and returns the element on top of the Stack like
+// Pop, unless ctx is done, in which case nothing is popped and the
+// error of ctx is returned.
+func (s *Stack) PopCtx(ctx context.Context) (interface{}, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	value, ok := s.Pop()
+	return value, ok, nil
+}
+
+// PopNCtx removes and returns up to n elements from the top of the
+// Stack like PopN. If ctx is done before all of them are popped, the
+// popped ones are put back in place and the error of ctx is returned.
+func (s *Stack) PopNCtx(ctx context.Context, n int) ([]interface{}, error) {
+	popped := make([]interface{}, 0)
+	values := make([]interface{}, 0)
+	for len(popped) < n {
+		if err := ctx.Err(); err != nil {
+			for i := len(popped) - 1; i >= 0; i-- {
+				s.undoPop(popped[i])
+			}
+			return nil, err
+		}
+		element, value, ok := s.pop()
+		if !ok {
+			break
+		}
+		popped = append(popped, element)
+		values = append(values, value)
+	}
+
+	for _, element := range popped {
+		s.remember(element)
+	}
+	return values, nil
+}
+
+// PopWaitCtx removes and returns the element on top of the Stack like
+// PopWait, waiting for an element to be pushed until ctx is done, in
+// which case the error of ctx is returned.
+func (s *Stack) PopWaitCtx(ctx context.Context) (interface{}, error) {
+	if value, ok := s.PopWait(ctx.Done()); ok {
+		return value, nil
+	}
+	return nil, ctx.Err()
+}
@@ -0,0 +1,115 @@
+package pila
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// canceledContext returns a Context that is done already.
+func canceledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestStackPushCtx(t *testing.T) {
+	stack := NewStack("stack", time.Now())
+	priority := 1.0
+
+	if err := stack.PushCtx(canceledContext(), "foo"); err != context.Canceled {
+		t.Errorf("err is %v, expected %v", err, context.Canceled)
+	}
+	if err := stack.PushWithOptionsCtx(canceledContext(), "foo", PushOptions{Priority: &priority}); err != context.Canceled {
+		t.Errorf("err is %v, expected %v", err, context.Canceled)
+	}
+	if err := stack.PushNCtx(canceledContext(), []interface{}{"foo", "bar"}); err != context.Canceled {
+		t.Errorf("err is %v, expected %v", err, context.Canceled)
+	}
+	if stack.Size() != 0 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 0)
+	}
+
+	ctx := context.Background()
+	if err := stack.PushCtx(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := stack.PushWithOptionsCtx(ctx, "bar", PushOptions{ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stack.PushNCtx(ctx, []interface{}{"baz"}); err != nil {
+		t.Fatal(err)
+	}
+	if elements := stack.Elements(0, 10); !reflect.DeepEqual(elements, []interface{}{"baz", "bar", "foo"}) {
+		t.Errorf("elements are %v, expected %v", elements, []interface{}{"baz", "bar", "foo"})
+	}
+}
+
+func TestStackPopCtx(t *testing.T) {
+	stack := NewStack("stack", time.Now())
+	_ = stack.Push("foo")
+
+	if _, ok, err := stack.PopCtx(canceledContext()); ok || err != context.Canceled {
+		t.Errorf("popped %v with err %v, expected %v and %v", ok, err, false, context.Canceled)
+	}
+	if stack.Size() != 1 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 1)
+	}
+
+	value, ok, err := stack.PopCtx(context.Background())
+	if !ok || err != nil || value != "foo" {
+		t.Errorf("popped %v, %v with err %v, expected %v, %v and %v", value, ok, err, "foo", true, nil)
+	}
+	if _, ok, err := stack.PopCtx(context.Background()); ok || err != nil {
+		t.Errorf("popped %v with err %v, expected %v and %v", ok, err, false, nil)
+	}
+}
+
+func TestStackPopNCtx(t *testing.T) {
+	stack := NewQueue("queue", time.Now())
+	stack.SetHistoryDepth(5)
+	_ = stack.PushN([]interface{}{"foo", "bar", "baz"})
+
+	if _, err := stack.PopNCtx(canceledContext(), 2); err != context.Canceled {
+		t.Errorf("err is %v, expected %v", err, context.Canceled)
+	}
+	if elements := stack.Elements(0, 10); !reflect.DeepEqual(elements, []interface{}{"foo", "bar", "baz"}) {
+		t.Errorf("elements are %v, expected %v", elements, []interface{}{"foo", "bar", "baz"})
+	}
+
+	elements, err := stack.PopNCtx(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(elements, []interface{}{"foo", "bar"}) {
+		t.Errorf("elements are %v, expected %v", elements, []interface{}{"foo", "bar"})
+	}
+	if history := stack.History(10); len(history) != 2 {
+		t.Errorf("history is %v, expected %d elements", history, 2)
+	}
+
+	elements, err = stack.PopNCtx(context.Background(), 5)
+	if err != nil || !reflect.DeepEqual(elements, []interface{}{"baz"}) {
+		t.Errorf("elements are %v with err %v, expected %v", elements, err, []interface{}{"baz"})
+	}
+}
+
+func TestStackPopWaitCtx(t *testing.T) {
+	stack := NewStack("stack", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := stack.PopWaitCtx(ctx); err != context.DeadlineExceeded {
+		t.Errorf("err is %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = stack.Push("foo")
+	}()
+	value, err := stack.PopWaitCtx(context.Background())
+	if err != nil || value != "foo" {
+		t.Errorf("popped %v with err %v, expected %v", value, err, "foo")
+	}
+}
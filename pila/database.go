@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fern4lvarez/piladb/pkg/uuid"
@@ -11,6 +13,16 @@ import (
 
 // Database represents a piladb database.
 type Database struct {
+	// memory is the approximate memory in bytes used by the elements
+	// of the Stacks, and maxMemory its limit, 0 if unlimited. They are
+	// the first fields to guarantee 64-bit alignment for atomic
+	// operations on 32-bit platforms.
+	memory, maxMemory int64
+	// spill is the number of elements kept in memory by the
+	// Stacks of the Database spilling to disk, unless they
+	// are created otherwise, 0 if they do not spill
+	spill int64
+
 	// ID is a unique identifier of the database
 	ID fmt.Stringer
 	// Name of the database
@@ -19,6 +31,14 @@ type Database struct {
 	Pila *Pila
 	// Stacks associated to Database mapped by their ID
 	Stacks map[fmt.Stringer]*Stack
+
+	// names maps the Stacks by their name
+	names map[string]*Stack
+
+	// mu protects the access to Stacks and names
+	mu sync.RWMutex
+	// txMu serializes the Transactions of the Database
+	txMu sync.Mutex
 }
 
 // NewDatabase creates a new Database given a name,
@@ -26,18 +46,29 @@ type Database struct {
 func NewDatabase(name string) *Database {
 	stacks := make(map[fmt.Stringer]*Stack)
 	return &Database{
-		ID:     uuid.New(name),
+		ID:     uuid.NewRandom(),
 		Name:   name,
 		Stacks: stacks,
+		names:  make(map[string]*Stack),
 	}
 }
 
 // CreateStack creates a new Stack, given a name and a creation date,
-// which is associated to the Database.
+// which is associated to the Database. If a Stack called `name`
+// already exists, it will be replaced.
 func (db *Database) CreateStack(name string, t time.Time) fmt.Stringer {
 	stack := NewStack(name, t)
 	stack.SetDatabase(db)
+
+	db.mu.Lock()
+	if old, ok := db.names[name]; ok {
+		delete(db.Stacks, old.ID)
+	}
 	db.Stacks[stack.ID] = stack
+	db.names[name] = stack
+	db.mu.Unlock()
+	db.changed()
+
 	return stack.ID
 }
 
@@ -49,12 +80,19 @@ func (db *Database) AddStack(stack *Stack) error {
 	}
 
 	stack.SetDatabase(db)
-	if _, ok := db.Stacks[stack.ID]; ok {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.Stacks[stack.ID]; ok || db.taken(stack, stack.Name) || db.names[stack.ID.String()] != nil {
 		stack.Database = nil
 		return fmt.Errorf("database %v already contains stack %v", db.Name, stack.Name)
 	}
 
 	db.Stacks[stack.ID] = stack
+	db.names[stack.Name] = stack
+	atomic.AddInt64(&db.memory, stack.Memory())
+	db.changed()
 	return nil
 }
 
@@ -62,59 +100,291 @@ func (db *Database) AddStack(stack *Stack) error {
 // returning true if it succeeded. It will return false if the
 // Stack wasn't added to the Database.
 func (db *Database) RemoveStack(id fmt.Stringer) bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	stack, ok := db.Stacks[id]
 	if !ok {
 		return false
 	}
+	atomic.AddInt64(&db.memory, -stack.Memory())
 	stack.Database = nil
-	stack.base = nil
+	// flush instead of dropping the base stack, as it may
+	// still be in use by concurrent operations
+	stack.Flush()
+	_ = stack.close()
 	delete(db.Stacks, id)
+	delete(db.names, stack.Name)
+	db.changed()
 	return true
 }
 
+// close closes the Stacks of the Database that spill to
+// disk, once the Database is not used anymore.
+func (db *Database) close() {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, stack := range db.Stacks {
+		_ = stack.close()
+	}
+}
+
+// RenameStack renames the Stack given by an ID, which keeps its
+// ID. It returns ErrNameTaken if another Stack of the Database is
+// already called name, or has name as ID.
+func (db *Database) RenameStack(id fmt.Stringer, name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stack, ok := db.Stacks[id]
+	if !ok {
+		return fmt.Errorf("stack %v not found", id)
+	}
+	if db.taken(stack, name) {
+		return ErrNameTaken
+	}
+
+	delete(db.names, stack.Name)
+	stack.Name = name
+	db.names[name] = stack
+	db.changed()
+	return nil
+}
+
+// TransferStack moves a Stack given an id from the Database into dst,
+// along with its elements and settings, keeping its ID and name. It
+// returns ErrNameTaken if dst already has a Stack with the same name
+// or ID, and ErrMemoryLimit if its elements would exceed the MaxMemory
+// of dst. Settings referring to other Stacks by name, like its dead
+// letter Stack, are then resolved in dst.
+func (db *Database) TransferStack(id fmt.Stringer, dst *Database) error {
+	if dst == db {
+		return fmt.Errorf("stack %v already in database %v", id, db.Name)
+	}
+
+	// lock both Databases always in the same
+	// order to avoid concurrent transfers to
+	// deadlock
+	first, second := db, dst
+	if dst.ID.String() < db.ID.String() {
+		first, second = dst, db
+	}
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	second.mu.Lock()
+	defer second.mu.Unlock()
+
+	stack, ok := db.Stacks[id]
+	if !ok {
+		return fmt.Errorf("stack %v not found", id)
+	}
+	if _, ok := dst.Stacks[stack.ID]; ok || dst.taken(stack, stack.Name) || dst.names[stack.ID.String()] != nil {
+		return ErrNameTaken
+	}
+	memory := stack.Memory()
+	if max := dst.MaxMemory(); max > 0 && dst.Memory()+memory > max {
+		return ErrMemoryLimit
+	}
+
+	delete(db.Stacks, stack.ID)
+	delete(db.names, stack.Name)
+	atomic.AddInt64(&db.memory, -memory)
+
+	stack.SetDatabase(dst)
+	dst.Stacks[stack.ID] = stack
+	dst.names[stack.Name] = stack
+	atomic.AddInt64(&dst.memory, memory)
+
+	db.changed()
+	dst.changed()
+	return nil
+}
+
+// taken determines whether name belongs to a Stack of the Database
+// other than stack, either as its name or as its ID, so looking up
+// Stacks by ID or name is never ambiguous. It must be called
+// holding the lock.
+func (db *Database) taken(stack *Stack, name string) bool {
+	if other, ok := db.names[name]; ok && other != stack {
+		return true
+	}
+	other, ok := db.Stacks[uuid.UUID(name)]
+	return ok && other != stack
+}
+
+// rename sets the name of the Database.
+func (db *Database) rename(name string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.Name = name
+}
+
+// Stack determines if a Stack given by an ID is part of
+// the Database, returning a pointer to the Stack and a
+// boolean flag.
+func (db *Database) Stack(id fmt.Stringer) (*Stack, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	stack, ok := db.Stacks[id]
+	return stack, ok
+}
+
+// StackByName determines if a Stack given by its name is part
+// of the Database, returning a pointer to the Stack and a
+// boolean flag.
+func (db *Database) StackByName(name string) (*Stack, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	stack, ok := db.names[name]
+	return stack, ok
+}
+
+// ResolveStack returns the Stack of the Database given by either
+// its ID or its name, and a boolean flag. IDs are looked up first.
+func (db *Database) ResolveStack(idOrName string) (*Stack, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if stack, ok := db.Stacks[uuid.UUID(idOrName)]; ok {
+		return stack, true
+	}
+	stack, ok := db.names[idOrName]
+	return stack, ok
+}
+
+// ForEachStack calls fn for each Stack of the Database, sorted
+// by name. Iteration stops if fn returns false.
+// The Stacks are collected under a read lock, so fn is free to
+// call any other method of the Database.
+func (db *Database) ForEachStack(fn func(s *Stack) bool) {
+	for _, s := range db.sortedStacks() {
+		if !fn(s) {
+			return
+		}
+	}
+}
+
+// ForEachStackParallel calls fn for each Stack of the Database
+// concurrently, using a pool of the given number of workers. It
+// returns once fn has been called for every Stack.
+func (db *Database) ForEachStackParallel(fn func(s *Stack), workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	stacks := make(chan *Stack)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for s := range stacks {
+				fn(s)
+			}
+		}()
+	}
+
+	for _, s := range db.sortedStacks() {
+		stacks <- s
+	}
+	close(stacks)
+	wg.Wait()
+}
+
+// Flush flushes every Stack of the Database, emptying them without
+// removing them from the Database, and returns the Stacks that were
+// not empty, sorted by name.
+func (db *Database) Flush() []*Stack {
+	var flushed []*Stack
+	db.ForEachStack(func(s *Stack) bool {
+		if s.Size() > 0 {
+			s.Flush()
+			flushed = append(flushed, s)
+		}
+		return true
+	})
+	return flushed
+}
+
+// Empty returns true if every Stack of the Database is empty.
+func (db *Database) Empty() bool {
+	empty := true
+	db.ForEachStack(func(s *Stack) bool {
+		empty = s.Size() == 0
+		return empty
+	})
+	return empty
+}
+
+// sortedStacks returns the list of Stacks of the Database
+// sorted by name.
+func (db *Database) sortedStacks() []*Stack {
+	db.mu.RLock()
+	stacks := make(stacksByName, 0, len(db.Stacks))
+	for _, s := range db.Stacks {
+		stacks = append(stacks, s)
+	}
+	db.mu.RUnlock()
+
+	sort.Sort(stacks)
+	return stacks
+}
+
+// numberStacks returns the number of Stacks of the Database.
+func (db *Database) numberStacks() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.Stacks)
+}
+
 // Status returns the status of the Database.
 func (db *Database) Status() DatabaseStatus {
 	dbs := DatabaseStatus{}
 	dbs.ID = db.ID.String()
 	dbs.Name = db.Name
-	dbs.NumberStacks = len(db.Stacks)
 
-	var ss sort.StringSlice = make([]string, len(db.Stacks))
-	n := 0
-	for sID := range db.Stacks {
-		ss[n] = sID.String()
-		n++
-	}
+	var ss sort.StringSlice = []string{}
+	db.ForEachStack(func(s *Stack) bool {
+		ss = append(ss, s.ID.String())
+		return true
+	})
 	ss.Sort()
+	dbs.NumberStacks = len(ss)
 	dbs.Stacks = ss
+	dbs.Memory = db.Memory()
+	dbs.MaxMemory = db.MaxMemory()
+	dbs.Spill = db.Spill()
 
 	return dbs
 }
 
-// StacksStatus returns the status of the Stacks of Database.
-func (db *Database) StacksStatus() StacksStatus {
-	var n int
-	ss := make([]StackStatus, len(db.Stacks))
-	for _, s := range db.Stacks {
-		s.CreatedAt = s.CreatedAt.Local()
-		s.UpdatedAt = s.UpdatedAt.Local()
-		s.ReadAt = s.ReadAt.Local()
-		ss[n] = s.Status()
-		n++
-	}
+// StacksStatus returns the status of the Stacks of Database
+// matching opts, in their order.
+func (db *Database) StacksStatus(opts StacksOptions) StacksStatus {
+	ss := []StackStatus{}
+	db.ForEachStack(func(s *Stack) bool {
+		if opts.Match(s.Name) {
+			ss = append(ss, s.Status())
+		}
+		return true
+	})
+	opts.SortStacks(ss)
 
-	status := StacksStatus{Stacks: ss}
-	sort.Sort(status)
-	return status
+	return StacksStatus{Stacks: ss}
 }
 
 // StacksKV returns the status of the Stacks of Database
 // in a key-value format.
 func (db *Database) StacksKV() StacksKV {
 	kv := make(map[string]interface{})
-	for _, s := range db.Stacks {
+	db.ForEachStack(func(s *Stack) bool {
 		kv[s.Name] = s.Peek()
-	}
+		return true
+	})
 
 	stacksKV := StacksKV{Stacks: kv}
 	return stacksKV
@@ -126,6 +396,9 @@ type DatabaseStatus struct {
 	Name         string   `json:"name"`
 	NumberStacks int      `json:"number_of_stacks"`
 	Stacks       []string `json:"stacks,omitempty"`
+	Memory       int64    `json:"memory"`
+	MaxMemory    int64    `json:"max_memory,omitempty"`
+	Spill        int      `json:"spill,omitempty"`
 }
 
 // ToJSON converts a DatabaseStatus into JSON.
@@ -136,3 +409,11 @@ func (databaseStatus DatabaseStatus) ToJSON() []byte {
 	b, _ := json.Marshal(databaseStatus)
 	return b
 }
+
+// stacksByName implements sort.Interface to sort
+// a list of Stacks by name.
+type stacksByName []*Stack
+
+func (stacks stacksByName) Len() int           { return len(stacks) }
+func (stacks stacksByName) Less(i, j int) bool { return stacks[i].Name < stacks[j].Name }
+func (stacks stacksByName) Swap(i, j int)      { stacks[i], stacks[j] = stacks[j], stacks[i] }
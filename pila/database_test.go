@@ -1,16 +1,24 @@
 package pila
 
 import (
+	"fmt"
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/uuid"
 )
 
 func TestNewDatabase(t *testing.T) {
 	db := NewDatabase("test-1")
 
-	if db.ID.String() != "2b87e5d8b7d3d853514c8d0801fbcf46" {
-		t.Errorf("db.ID is %v, expected %v", db.ID, "2b87e5d8b7d3d853514c8d0801fbcf46")
+	if len(db.ID.String()) != 32 {
+		t.Errorf("db.ID is %v, expected a UUID", db.ID)
+	}
+	if db2 := NewDatabase("test-1"); db2.ID == db.ID {
+		t.Errorf("db2.ID is %v, expected a different one", db2.ID)
 	}
 	if db.Name != "test-1" {
 		t.Errorf("db.Name is %v, expected %v", db.Name, "test-1")
@@ -97,6 +105,104 @@ func TestDatabaseAddStack_ErrorDBAlreadyContainsStack(t *testing.T) {
 	}
 }
 
+func TestDatabaseRenameStack(t *testing.T) {
+	db := NewDatabase("db")
+	stack := NewStack("stack", time.Now())
+	_ = db.AddStack(stack)
+	_ = db.AddStack(NewStack("other", time.Now()))
+	oldID := stack.ID
+
+	if err := db.RenameStack(stack.ID, "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if stack.Name != "renamed" || stack.ID != oldID {
+		t.Errorf("stack is %v %v, expected %v %v", stack.Name, stack.ID, "renamed", oldID)
+	}
+	if s, ok := db.StackByName("renamed"); !ok || s != stack {
+		t.Errorf("database has no Stack %v", "renamed")
+	}
+	if _, ok := db.StackByName("stack"); ok {
+		t.Errorf("database has Stack %v", "stack")
+	}
+
+	if err := db.RenameStack(stack.ID, "other"); err != ErrNameTaken {
+		t.Errorf("err is %v, expected %v", err, ErrNameTaken)
+	}
+	other, _ := db.StackByName("other")
+	if err := db.RenameStack(stack.ID, other.ID.String()); err != ErrNameTaken {
+		t.Errorf("err is %v, expected %v", err, ErrNameTaken)
+	}
+	if err := db.RenameStack(uuid.New("foo"), "foo"); err == nil {
+		t.Error("err is nil, expected error")
+	}
+}
+
+func TestDatabaseTransferStack(t *testing.T) {
+	db := NewDatabase("db")
+	dst := NewDatabase("dst")
+	stack := NewStack("stack", time.Now())
+	_ = db.AddStack(stack)
+	_ = stack.Push("foo")
+	id := stack.ID
+	memory := stack.Memory()
+
+	if err := db.TransferStack(stack.ID, dst); err != nil {
+		t.Fatal(err)
+	}
+	if stack.Database != dst || stack.ID != id || stack.Name != "stack" {
+		t.Errorf("stack is %v %v in %v, expected %v %v in %v", stack.Name, stack.ID, stack.Database, "stack", id, dst)
+	}
+	if s, ok := dst.Stack(id); !ok || s != stack {
+		t.Errorf("database %v has no Stack %v", dst.Name, id)
+	}
+	if s, ok := dst.StackByName("stack"); !ok || s != stack {
+		t.Errorf("database %v has no Stack %v", dst.Name, "stack")
+	}
+	if _, ok := db.Stack(id); ok {
+		t.Errorf("database %v has Stack %v", db.Name, id)
+	}
+	if _, ok := db.StackByName("stack"); ok {
+		t.Errorf("database %v has Stack %v", db.Name, "stack")
+	}
+	if db.Memory() != 0 || dst.Memory() != memory {
+		t.Errorf("memory is %d and %d, expected %d and %d", db.Memory(), dst.Memory(), 0, memory)
+	}
+	if stack.Peek() != "foo" {
+		t.Errorf("peek is %v, expected %v", stack.Peek(), "foo")
+	}
+}
+
+func TestDatabaseTransferStack_Error(t *testing.T) {
+	db := NewDatabase("db")
+	dst := NewDatabase("dst")
+	stack := NewStack("stack", time.Now())
+	_ = db.AddStack(stack)
+	_ = stack.Push("foo")
+	_ = dst.AddStack(NewStack("stack", time.Now()))
+
+	if err := db.TransferStack(stack.ID, db); err == nil {
+		t.Error("err is nil, expected error")
+	}
+	if err := db.TransferStack(uuid.New("foo"), dst); err == nil {
+		t.Error("err is nil, expected error")
+	}
+	if err := db.TransferStack(stack.ID, dst); err != ErrNameTaken {
+		t.Errorf("err is %v, expected %v", err, ErrNameTaken)
+	}
+
+	full := NewDatabase("full")
+	full.SetMaxMemory(1)
+	if err := db.TransferStack(stack.ID, full); err != ErrMemoryLimit {
+		t.Errorf("err is %v, expected %v", err, ErrMemoryLimit)
+	}
+	if stack.Database != db {
+		t.Errorf("stack database is %v, expected %v", stack.Database, db)
+	}
+	if _, ok := db.Stack(stack.ID); !ok {
+		t.Errorf("database %v has no Stack %v", db.Name, stack.ID)
+	}
+}
+
 func TestDatabaseRemoveStack(t *testing.T) {
 	db := NewDatabase("test-db")
 	stack := NewStack("test-stack", time.Now())
@@ -105,6 +211,7 @@ func TestDatabaseRemoveStack(t *testing.T) {
 	if err != nil {
 		t.Fatal("err is not nil")
 	}
+	stack.Push("foo")
 
 	ok := db.RemoveStack(stack.ID)
 	if !ok {
@@ -120,8 +227,8 @@ func TestDatabaseRemoveStack(t *testing.T) {
 		t.Errorf("stack %s still associated to database %s", stack.Name, stack.Database.Name)
 	}
 
-	if stack.base != nil {
-		t.Errorf("stack %s still points to a base stack", stack.Name)
+	if stack.Size() != 0 {
+		t.Errorf("stack %s still contains elements", stack.Name)
 	}
 
 }
@@ -136,17 +243,174 @@ func TestDatabaseRemoveStack_False(t *testing.T) {
 	}
 }
 
+func TestDatabaseStack(t *testing.T) {
+	db := NewDatabase("db")
+	id := db.CreateStack("stack", time.Now())
+
+	stack, ok := db.Stack(id)
+	if !ok {
+		t.Fatalf("stack %v not found", id)
+	}
+	if stack.ID != id {
+		t.Errorf("stack.ID is %v, expected %v", stack.ID, id)
+	}
+
+	if _, ok := db.Stack(NewStack("nostack", time.Now()).ID); ok {
+		t.Error("stack nostack found")
+	}
+}
+
+func TestDatabaseResolveStack(t *testing.T) {
+	db := NewDatabase("db")
+	stack := NewStack("stack", time.Now())
+	_ = db.AddStack(stack)
+
+	inputOutput := []struct {
+		input  string
+		output *Stack
+	}{
+		{"stack", stack},
+		{stack.ID.String(), stack},
+		{"foo", nil},
+	}
+
+	for _, io := range inputOutput {
+		if s, ok := db.ResolveStack(io.input); s != io.output || ok != (io.output != nil) {
+			t.Errorf("Stack is %v, %v, expected %v for %s", s, ok, io.output, io.input)
+		}
+	}
+
+	if err := db.AddStack(NewStack(stack.ID.String(), time.Now())); err == nil {
+		t.Error("err is nil, expected error")
+	}
+	db.RemoveStack(stack.ID)
+	if _, ok := db.StackByName("stack"); ok {
+		t.Errorf("database has Stack called %v", "stack")
+	}
+}
+
+func TestDatabase_Concurrent(t *testing.T) {
+	db := NewDatabase("db")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				stack := NewStack(fmt.Sprintf("stack-%d-%d", i, j), time.Now())
+				if err := db.AddStack(stack); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, ok := db.Stack(stack.ID); !ok {
+					t.Errorf("stack %v not found", stack.Name)
+				}
+				_ = db.Status()
+				_ = db.StacksStatus(StacksOptions{})
+				if j%2 == 0 {
+					db.RemoveStack(stack.ID)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := db.Status().NumberStacks; n != 20*25 {
+		t.Errorf("number of stacks is %d, expected %d", n, 20*25)
+	}
+}
+
+func TestDatabaseForEachStack(t *testing.T) {
+	db := NewDatabase("db")
+	for _, name := range []string{"s2", "s0", "s1"} {
+		db.CreateStack(name, time.Now())
+	}
+
+	var names []string
+	db.ForEachStack(func(s *Stack) bool {
+		names = append(names, s.Name)
+		return true
+	})
+
+	if expected := []string{"s0", "s1", "s2"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("names are %v, expected %v", names, expected)
+	}
+}
+
+func TestDatabaseForEachStack_Stop(t *testing.T) {
+	db := NewDatabase("db")
+	for _, name := range []string{"s2", "s0", "s1"} {
+		db.CreateStack(name, time.Now())
+	}
+
+	var names []string
+	db.ForEachStack(func(s *Stack) bool {
+		names = append(names, s.Name)
+		return false
+	})
+
+	if expected := []string{"s0"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("names are %v, expected %v", names, expected)
+	}
+}
+
+func TestDatabaseForEachStackParallel(t *testing.T) {
+	db := NewDatabase("db")
+	for _, name := range []string{"s2", "s0", "s1", "s3"} {
+		db.CreateStack(name, time.Now())
+	}
+
+	var mu sync.Mutex
+	var names []string
+	db.ForEachStackParallel(func(s *Stack) {
+		s.Push(s.Name)
+
+		mu.Lock()
+		names = append(names, s.Name)
+		mu.Unlock()
+	}, 2)
+
+	sort.Strings(names)
+	if expected := []string{"s0", "s1", "s2", "s3"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("names are %v, expected %v", names, expected)
+	}
+
+	db.ForEachStack(func(s *Stack) bool {
+		if peek := s.Peek(); peek != s.Name {
+			t.Errorf("peek is %v, expected %v", peek, s.Name)
+		}
+		return true
+	})
+}
+
+func TestDatabaseForEachStackParallel_NoWorkers(t *testing.T) {
+	db := NewDatabase("db")
+	db.CreateStack("s0", time.Now())
+
+	var n int
+	db.ForEachStackParallel(func(s *Stack) {
+		n++
+	}, 0)
+
+	if n != 1 {
+		t.Errorf("fn was called %d times, expected %d", n, 1)
+	}
+}
+
 func TestDatabaseStatus(t *testing.T) {
 	db := NewDatabase("db")
 	s0ID := db.CreateStack("s0", time.Now())
 	s1ID := db.CreateStack("s1", time.Now())
 	s2ID := db.CreateStack("s2", time.Now())
 
+	stacks := []string{s0ID.String(), s1ID.String(), s2ID.String()}
+	sort.Strings(stacks)
 	expectedStatus := DatabaseStatus{
-		ID:           "8cfa8cb55c92fa403369a13fd12a8e01",
+		ID:           db.ID.String(),
 		Name:         "db",
 		NumberStacks: 3,
-		Stacks:       []string{s0ID.String(), s2ID.String(), s1ID.String()},
+		Stacks:       stacks,
 	}
 
 	if status := db.Status(); !reflect.DeepEqual(status, expectedStatus) {
@@ -158,7 +422,7 @@ func TestDatabaseStatus_Empty(t *testing.T) {
 	db := NewDatabase("db")
 
 	expectedStatus := DatabaseStatus{
-		ID:           "8cfa8cb55c92fa403369a13fd12a8e01",
+		ID:           db.ID.String(),
 		Name:         "db",
 		NumberStacks: 0,
 		Stacks:       []string{},
@@ -177,7 +441,7 @@ func TestDatabaseStatusToJSON(t *testing.T) {
 		Stacks:       []string{"stack1", "stack2", "stack3"},
 	}
 
-	expectedToJSON := `{"id":"123456789","name":"db","number_of_stacks":3,"stacks":["stack1","stack2","stack3"]}`
+	expectedToJSON := `{"id":"123456789","name":"db","number_of_stacks":3,"stacks":["stack1","stack2","stack3"],"memory":0}`
 
 	if toJSON := databaseStatus.ToJSON(); string(toJSON) != expectedToJSON {
 		t.Errorf("toJSON is %s, expected %s", string(toJSON), expectedToJSON)
@@ -192,7 +456,7 @@ func TestDatabaseStatusToJSON_Empty(t *testing.T) {
 		NumberStacks: 0,
 	}
 
-	expectedToJSON := `{"id":"123456789","name":"db","number_of_stacks":0}`
+	expectedToJSON := `{"id":"123456789","name":"db","number_of_stacks":0,"memory":0}`
 
 	if toJSON := databaseStatus.ToJSON(); string(toJSON) != expectedToJSON {
 		t.Errorf("toJSON is %s, expected %s", string(toJSON), expectedToJSON)
@@ -219,11 +483,31 @@ func TestDatabaseStacksStatus(t *testing.T) {
 		Stacks: []StackStatus{s1.Status(), s2.Status(), s3.Status()},
 	}
 
-	if status := db.StacksStatus(); !reflect.DeepEqual(status, expectedStatus) {
+	if status := db.StacksStatus(StacksOptions{}); !reflect.DeepEqual(status, expectedStatus) {
 		t.Errorf("status is %v, expected %v", status, expectedStatus)
 	}
 }
 
+func TestDatabaseStacksStatus_Options(t *testing.T) {
+	db := NewDatabase("db")
+	for i, name := range []string{"jobs-a", "jobs-b", "tasks"} {
+		s := NewStack(name, time.Now())
+		for j := 0; j < i; j++ {
+			s.Push(j)
+		}
+		_ = db.AddStack(s)
+	}
+
+	status := db.StacksStatus(StacksOptions{Filter: "jobs-*", Sort: SortBySize, Desc: true})
+	var names []string
+	for _, s := range status.Stacks {
+		names = append(names, s.Name)
+	}
+	if expected := []string{"jobs-b", "jobs-a"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("stacks are %v, expected %v", names, expected)
+	}
+}
+
 func TestDatabaseStacksStatus_Empty(t *testing.T) {
 	db := NewDatabase("db")
 
@@ -231,7 +515,7 @@ func TestDatabaseStacksStatus_Empty(t *testing.T) {
 		Stacks: []StackStatus{},
 	}
 
-	if status := db.StacksStatus(); !reflect.DeepEqual(status, expectedStatus) {
+	if status := db.StacksStatus(StacksOptions{}); !reflect.DeepEqual(status, expectedStatus) {
 		t.Errorf("status is %v, expected %v", status, expectedStatus)
 	}
 }
@@ -275,3 +559,46 @@ func TestDatabaseStacksKV_Empty(t *testing.T) {
 		t.Errorf("key-value is %v, expected %v", kv, expectedKV)
 	}
 }
+
+func TestDatabaseFlush(t *testing.T) {
+	db := NewDatabase("db")
+	foo := db.Stacks[db.CreateStack("foo", time.Now())]
+	bar := db.Stacks[db.CreateStack("bar", time.Now())]
+	baz := db.Stacks[db.CreateStack("baz", time.Now())]
+	_ = foo.Push(1)
+	_ = foo.Push(2)
+	_ = baz.Push(3)
+
+	if db.Empty() {
+		t.Error("db is empty")
+	}
+
+	flushed := db.Flush()
+	if !reflect.DeepEqual(flushed, []*Stack{baz, foo}) {
+		t.Errorf("flushed stacks are %v, expected %v", flushed, []*Stack{baz, foo})
+	}
+	for _, s := range []*Stack{foo, bar, baz} {
+		if size := s.Size(); size != 0 {
+			t.Errorf("stack %s size is %d, expected 0", s.Name, size)
+		}
+	}
+	if len(db.Stacks) != 3 {
+		t.Errorf("db has %d stacks, expected 3", len(db.Stacks))
+	}
+	if !db.Empty() {
+		t.Error("db is not empty")
+	}
+	if memory := db.Memory(); memory != 0 {
+		t.Errorf("db memory is %d, expected 0", memory)
+	}
+
+	if flushed := db.Flush(); len(flushed) != 0 {
+		t.Errorf("flushed stacks are %v, expected none", flushed)
+	}
+}
+
+func TestDatabaseEmpty_NoStacks(t *testing.T) {
+	if db := NewDatabase("db"); !db.Empty() {
+		t.Error("db is not empty")
+	}
+}
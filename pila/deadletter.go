@@ -0,0 +1,73 @@
+package pila
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidDeadLetter is returned when setting a DeadLetter whose
+// MaxDeliveries is not positive, or whose Stack is the Stack itself.
+var ErrInvalidDeadLetter = errors.New("invalid dead letter")
+
+// DeadLetter is the Stack of the same Database that the elements
+// popped by the groups of a Stack are moved into once they were
+// delivered MaxDeliveries times without being acknowledged.
+type DeadLetter struct {
+	// Stack is the name of the dead-letter Stack
+	Stack string `json:"stack"`
+	// MaxDeliveries is the number of times an element
+	// is delivered before being dead-lettered
+	MaxDeliveries int `json:"max_deliveries"`
+}
+
+// SetDeadLetter sets the DeadLetter of the Stack, or removes it if its
+// Stack is empty, which is the default, so elements whose acknowledgement
+// timed out are redelivered forever. Elements are dead-lettered by
+// Redeliver, and only if the dead-letter Stack exists by then, see
+// DeadLetterStack. ErrInvalidDeadLetter is returned if d is not valid.
+func (s *Stack) SetDeadLetter(d DeadLetter) error {
+	if d.Stack != "" && (d.MaxDeliveries < 1 || d.Stack == s.Name) {
+		return ErrInvalidDeadLetter
+	}
+
+	s.groupsMu.Lock()
+	defer s.groupsMu.Unlock()
+	if d.Stack == "" {
+		s.deadLetter = nil
+		return nil
+	}
+	s.deadLetter = &d
+	return nil
+}
+
+// DeadLetter returns the DeadLetter of the Stack,
+// or false if it has none.
+func (s *Stack) DeadLetter() (DeadLetter, bool) {
+	s.groupsMu.Lock()
+	defer s.groupsMu.Unlock()
+	if s.deadLetter == nil {
+		return DeadLetter{}, false
+	}
+	return *s.deadLetter, true
+}
+
+// DeadLetterStack returns the dead-letter Stack of the Stack, or false
+// if it has no DeadLetter, is not associated to any Database, or its
+// Database has no Stack with such name.
+func (s *Stack) DeadLetterStack() (*Stack, bool) {
+	d, ok := s.DeadLetter()
+	if !ok || s.Database == nil {
+		return nil, false
+	}
+	return s.Database.StackByName(d.Stack)
+}
+
+// deliveryKey returns the key identifying a value of the Stack
+// pushed back by Redeliver, to count its deliveries once popped
+// again. Elements with equal values share their key.
+func deliveryKey(value interface{}) string {
+	// Do not check error as the values of a Stack
+	// are valid for a JSON encoding.
+	b, _ := json.Marshal(value)
+	return string(b)
+}
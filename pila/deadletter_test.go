@@ -0,0 +1,106 @@
+package pila
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStackSetDeadLetter(t *testing.T) {
+	stack := NewStack("jobs", time.Now())
+	if d, ok := stack.DeadLetter(); ok {
+		t.Errorf("dead letter is %v, expected none", d)
+	}
+
+	for _, d := range []DeadLetter{
+		{Stack: "dead", MaxDeliveries: 0},
+		{Stack: "dead", MaxDeliveries: -1},
+		{Stack: "jobs", MaxDeliveries: 3},
+	} {
+		if err := stack.SetDeadLetter(d); err != ErrInvalidDeadLetter {
+			t.Errorf("err is %v, expected %v for %v", err, ErrInvalidDeadLetter, d)
+		}
+	}
+
+	expected := DeadLetter{Stack: "dead", MaxDeliveries: 3}
+	if err := stack.SetDeadLetter(expected); err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := stack.DeadLetter(); !ok || d != expected {
+		t.Errorf("dead letter is %v, %v, expected %v, true", d, ok, expected)
+	}
+
+	if err := stack.SetDeadLetter(DeadLetter{}); err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := stack.DeadLetter(); ok {
+		t.Errorf("dead letter is %v, expected none", d)
+	}
+}
+
+func TestStackDeadLetterStack(t *testing.T) {
+	db := NewDatabase("db")
+	stack := NewStack("jobs", time.Now())
+	_ = stack.SetDeadLetter(DeadLetter{Stack: "dead", MaxDeliveries: 1})
+	if _, ok := stack.DeadLetterStack(); ok {
+		t.Error("dead-letter stack found without database")
+	}
+
+	_ = db.AddStack(stack)
+	if _, ok := stack.DeadLetterStack(); ok {
+		t.Error("dead-letter stack found, expected none")
+	}
+
+	dead := NewStack("dead", time.Now())
+	_ = db.AddStack(dead)
+	if s, ok := stack.DeadLetterStack(); !ok || s != dead {
+		t.Errorf("dead-letter stack is %v, %v, expected %v, true", s, ok, dead)
+	}
+}
+
+func TestStackRedeliver_DeadLetter(t *testing.T) {
+	now := time.Now()
+	db := NewDatabase("db")
+	stack := NewStack("jobs", now)
+	dead := NewStack("dead", now)
+	_ = db.AddStack(stack)
+	_ = db.AddStack(dead)
+	_ = stack.AddGroup("workers", time.Minute)
+	_ = stack.SetDeadLetter(DeadLetter{Stack: "dead", MaxDeliveries: 2})
+	_ = stack.PushN([]interface{}{"bar", "foo"})
+
+	p, _, _ := stack.PopGroup("workers", "alice", now)
+	if p.Value != "foo" || p.Deliveries != 1 {
+		t.Errorf("pending element is %v, expected foo delivered once", p)
+	}
+	if values, dl := stack.Redeliver(now.Add(time.Minute)); !reflect.DeepEqual(values, []interface{}{"foo"}) || len(dl.Values) != 0 {
+		t.Errorf("redelivered elements are %v and dead-lettered %v, expected %v and none", values, dl.Values, []interface{}{"foo"})
+	}
+
+	now = now.Add(time.Minute)
+	p, _, _ = stack.PopGroup("workers", "bob", now)
+	if p.Value != "foo" || p.Deliveries != 2 {
+		t.Errorf("pending element is %v, expected foo delivered twice", p)
+	}
+	values, dl := stack.Redeliver(now.Add(time.Minute))
+	if len(values) != 0 || dl.Stack != dead || !reflect.DeepEqual(dl.Values, []interface{}{"foo"}) {
+		t.Errorf("redelivered elements are %v and dead-lettered %v into %v, expected none and %v into dead", values, dl.Values, dl.Stack, []interface{}{"foo"})
+	}
+	if dead.Peek() != "foo" || stack.Peek() != "bar" {
+		t.Errorf("dead-letter peek is %v and stack peek %v, expected foo and bar", dead.Peek(), stack.Peek())
+	}
+	if status := stack.Groups()[0]; status.Pending != 0 || status.Redelivered != 1 || status.DeadLettered != 1 {
+		t.Errorf("group status is %v, expected 0 pending, 1 redelivered and 1 dead-lettered", status)
+	}
+
+	// elements are redelivered without a dead-letter stack
+	p, _, _ = stack.PopGroup("workers", "alice", now)
+	db.RemoveStack(dead.ID)
+	if values, _ := stack.Redeliver(now.Add(time.Minute)); !reflect.DeepEqual(values, []interface{}{"bar"}) {
+		t.Errorf("redelivered elements are %v, expected %v", values, []interface{}{"bar"})
+	}
+	p, _, _ = stack.PopGroup("workers", "alice", now)
+	if p.Value != "bar" || p.Deliveries != 2 {
+		t.Errorf("pending element is %v, expected bar delivered twice", p)
+	}
+}
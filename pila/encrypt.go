@@ -0,0 +1,264 @@
+package pila
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrNoKeys is returned when encrypting elements
+// with a Keyring that does not hold any key.
+var ErrNoKeys = errors.New("no encryption keys")
+
+// ErrUnknownKey is returned when decrypting an element
+// encrypted with a key that is not in the Keyring.
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Keyring holds the AES keys, by ID, encrypting the elements of
+// Stacks with AES-GCM. The current key, i.e. the last added one,
+// encrypts new elements, and the former ones decrypt the elements
+// encrypted before the current key was added.
+type Keyring struct {
+	aeads map[string]cipher.AEAD
+	// ids are the IDs of the keys,
+	// the current one at the end
+	ids []string
+	mu  sync.RWMutex
+}
+
+// NewKeyring returns an empty Keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{aeads: make(map[string]cipher.AEAD)}
+}
+
+// Add adds a key of 16, 24 or 32 bytes, selecting AES-128, AES-192
+// or AES-256, as the current key of the Keyring, given its ID, which
+// must not be empty nor identify another key of the Keyring.
+func (k *Keyring) Add(id string, key []byte) error {
+	if id == "" {
+		return errors.New("missing encryption key ID")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("encryption key %s: %v", id, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("encryption key %s: %v", id, err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.aeads[id]; ok {
+		return fmt.Errorf("encryption key %s already exists", id)
+	}
+	k.aeads[id] = aead
+	k.ids = append(k.ids, id)
+	return nil
+}
+
+// Current returns the ID of the current key of the
+// Keyring, or an empty string if it holds no key.
+func (k *Keyring) Current() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if len(k.ids) == 0 {
+		return ""
+	}
+	return k.ids[len(k.ids)-1]
+}
+
+// IDs returns the IDs of the keys of the Keyring,
+// in the order they were added.
+func (k *Keyring) IDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return append([]string{}, k.ids...)
+}
+
+// Sealed represents a value of a Stack encrypted with a key of a
+// Keyring: the JSON encoding of its Element, sealed with AES-GCM
+// and prefixed by its nonce.
+type Sealed struct {
+	// Key is the ID of the key encrypting the value
+	Key  string `json:"key"`
+	Data []byte `json:"data"`
+}
+
+// Seal encrypts a value of a Stack with the current key of the
+// Keyring. It returns ErrNoKeys if the Keyring holds no key.
+func (k *Keyring) Seal(value interface{}) (Sealed, error) {
+	k.mu.RLock()
+	var id string
+	var aead cipher.AEAD
+	if len(k.ids) > 0 {
+		id = k.ids[len(k.ids)-1]
+		aead = k.aeads[id]
+	}
+	k.mu.RUnlock()
+	if aead == nil {
+		return Sealed{}, ErrNoKeys
+	}
+
+	plain, err := json.Marshal(NewElement(value))
+	if err != nil {
+		return Sealed{}, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return Sealed{}, err
+	}
+	// the key ID is authenticated along with the value
+	return Sealed{Key: id, Data: aead.Seal(nonce, nonce, plain, []byte(id))}, nil
+}
+
+// Open decrypts a value sealed with a key of the Keyring. It returns
+// ErrUnknownKey if the Keyring does not hold such key, or an error
+// if the value was not sealed by it.
+func (k *Keyring) Open(sealed Sealed) (interface{}, error) {
+	k.mu.RLock()
+	aead, ok := k.aeads[sealed.Key]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	if len(sealed.Data) < aead.NonceSize() {
+		return nil, errors.New("sealed value is too short")
+	}
+	nonce, data := sealed.Data[:aead.NonceSize()], sealed.Data[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, data, []byte(sealed.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	var element Element
+	if err := json.Unmarshal(plain, &element); err != nil {
+		return nil, err
+	}
+	return element.StackValue()
+}
+
+// Keyring returns the Keyring encrypting the elements of the
+// encrypted Stacks of the Pila, nil if they are not allowed.
+func (p *Pila) Keyring() *Keyring {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.keys
+}
+
+// SetKeyring sets the Keyring encrypting the elements of the encrypted
+// Stacks of the Pila, restored from snapshots or created by pilad, or
+// disallows them if keys is nil. Stacks already created are not affected.
+func (p *Pila) SetKeyring(keys *Keyring) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = keys
+}
+
+// AddKey adds a key as the current one of the Keyring of the Pila, as
+// Keyring.Add does, creating the Keyring if it has none.
+func (p *Pila) AddKey(id string, key []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys := p.keys
+	if keys == nil {
+		keys = NewKeyring()
+	}
+	if err := keys.Add(id, key); err != nil {
+		return err
+	}
+	p.keys = keys
+	return nil
+}
+
+// sealedElement represents a value of a Stack stored encrypted,
+// along with the Keyring decrypting it.
+type sealedElement struct {
+	keys   *Keyring
+	sealed Sealed
+}
+
+// value returns the value of the sealedElement. It
+// returns nil if the data can not be decrypted.
+func (e sealedElement) value() interface{} {
+	value, err := e.keys.Open(e.sealed)
+	if err != nil {
+		return nil
+	}
+	return value
+}
+
+// SetEncryption makes the Stack store encrypted the elements pushed
+// from now on, with the current key of keys, or not encrypted if keys
+// is nil, which is the default. Elements already in the Stack are not
+// affected. ErrNoKeys is returned if keys holds no key, and
+// ErrUnsupported if the Stack is not kept in memory or is unique, as
+// the elements would be kept in plain in its Store or in its index. Encrypted
+// elements are not compressed.
+func (s *Stack) SetEncryption(keys *Keyring) error {
+	if keys != nil {
+		if keys.Current() == "" {
+			return ErrNoKeys
+		}
+		if s.store != StoreMemory || s.Unique() != "" {
+			return ErrUnsupported
+		}
+	}
+
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	s.keys = keys
+	return nil
+}
+
+// Encryption returns the Keyring encrypting the elements
+// of the Stack, nil if they are not encrypted.
+func (s *Stack) Encryption() *Keyring {
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+	return s.keys
+}
+
+// encryptElement returns an element of the Stack to store, as given
+// by push, with its value encrypted if the Stack is encrypted.
+func (s *Stack) encryptElement(element interface{}) interface{} {
+	keys := s.Encryption()
+	if keys == nil {
+		return element
+	}
+
+	switch e := element.(type) {
+	case prioritizedElement:
+		e.value = s.encryptElement(e.value)
+		return e
+	case expiringElement:
+		e.value = s.encryptElement(e.value)
+		return e
+	case taggedElement:
+		e.value = s.encryptElement(e.value)
+		return e
+	case sealedElement:
+		return e
+	case compressedElement:
+		element = e.value()
+	}
+
+	// Do not check error as the Keyring has a current key, and
+	// values of Stacks can be encoded to JSON, but keep the
+	// element as given just in case.
+	sealed, err := keys.Seal(element)
+	if err != nil {
+		return element
+	}
+	return sealedElement{keys: keys, sealed: sealed}
+}
@@ -0,0 +1,285 @@
+package pila
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKeyring returns a Keyring holding the
+// given IDs, each one with a different key.
+func testKeyring(t *testing.T, ids ...string) *Keyring {
+	keys := NewKeyring()
+	for i, id := range ids {
+		if err := keys.Add(id, bytes.Repeat([]byte{byte(i + 1)}, 32)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return keys
+}
+
+func TestKeyring(t *testing.T) {
+	keys := NewKeyring()
+	if keys.Current() != "" || len(keys.IDs()) != 0 {
+		t.Errorf("keys are %v, expected none", keys.IDs())
+	}
+	if _, err := keys.Seal("foo"); err != ErrNoKeys {
+		t.Errorf("err is %v, expected %v", err, ErrNoKeys)
+	}
+
+	if err := keys.Add("a", make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Add("b", make([]byte, 32)); err != nil {
+		t.Fatal(err)
+	}
+	if keys.Current() != "b" || !reflect.DeepEqual(keys.IDs(), []string{"a", "b"}) {
+		t.Errorf("keys are %v, expected %v", keys.IDs(), []string{"a", "b"})
+	}
+
+	errs := []error{
+		keys.Add("", make([]byte, 16)),
+		keys.Add("c", make([]byte, 8)),
+		keys.Add("a", make([]byte, 16)),
+	}
+	for i, err := range errs {
+		if err == nil {
+			t.Errorf("%d: err is nil, expected error", i)
+		}
+	}
+	if keys.Current() != "b" {
+		t.Errorf("current key is %s, expected %s", keys.Current(), "b")
+	}
+}
+
+func TestKeyringSealOpen(t *testing.T) {
+	keys := testKeyring(t, "a")
+	values := []interface{}{
+		"foo",
+		8.0,
+		map[string]interface{}{"foo": []interface{}{"bar", true}},
+		Binary{ContentType: "image/png", Data: []byte{0x89, 0x50}},
+		nil,
+	}
+
+	for _, value := range values {
+		sealed, err := keys.Seal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sealed.Key != "a" {
+			t.Errorf("key is %s, expected %s", sealed.Key, "a")
+		}
+		if bytes.Contains(sealed.Data, []byte("foo")) {
+			t.Errorf("sealed data %x contains the value in plain", sealed.Data)
+		}
+		opened, err := keys.Open(sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(opened, value) {
+			t.Errorf("value is %v, expected %v", opened, value)
+		}
+	}
+
+	// the same value is sealed differently every time
+	s1, _ := keys.Seal("foo")
+	s2, _ := keys.Seal("foo")
+	if bytes.Equal(s1.Data, s2.Data) {
+		t.Errorf("sealed data is %x both times, expected different", s1.Data)
+	}
+}
+
+func TestKeyringOpen_Error(t *testing.T) {
+	keys := testKeyring(t, "a", "b")
+	sealed, err := keys.Seal("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := append([]byte{}, sealed.Data...)
+	tampered[len(tampered)-1] ^= 1
+	inputOutput := []struct {
+		input  Sealed
+		output error
+	}{
+		{Sealed{Key: "c", Data: sealed.Data}, ErrUnknownKey},
+		{Sealed{Key: "a", Data: sealed.Data}, nil},
+		{Sealed{Key: "b", Data: tampered}, nil},
+		{Sealed{Key: "b", Data: sealed.Data[:4]}, nil},
+		{Sealed{Key: "b", Data: testKeyring(t, "b", "x").mustSeal(t, "foo").Data}, nil},
+	}
+
+	for i, io := range inputOutput {
+		_, err := keys.Open(io.input)
+		if err == nil || (io.output != nil && err != io.output) {
+			t.Errorf("%d: err is %v, expected %v", i, err, io.output)
+		}
+	}
+}
+
+// mustSeal seals a value with the Keyring, failing the test on error.
+func (k *Keyring) mustSeal(t *testing.T, value interface{}) Sealed {
+	sealed, err := k.Seal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sealed
+}
+
+func TestPilaKeyring(t *testing.T) {
+	p := NewPila()
+	if p.Keyring() != nil {
+		t.Errorf("keyring is %v, expected nil", p.Keyring())
+	}
+
+	if err := p.AddKey("a", make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+	keys := p.Keyring()
+	if keys == nil || keys.Current() != "a" {
+		t.Fatalf("keyring is %v, expected key %s", keys, "a")
+	}
+	if err := p.AddKey("b", make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+	if p.Keyring() != keys || keys.Current() != "b" {
+		t.Errorf("current key is %s, expected %s", keys.Current(), "b")
+	}
+	if err := p.AddKey("b", make([]byte, 16)); err == nil {
+		t.Error("err is nil, expected error")
+	}
+
+	p.SetKeyring(nil)
+	if err := p.AddKey("c", make([]byte, 8)); err == nil || p.Keyring() != nil {
+		t.Errorf("keyring is %v and err %v, expected nil and error", p.Keyring(), err)
+	}
+}
+
+func TestStackSetEncryption(t *testing.T) {
+	s := NewStack("s", time.Now())
+	if s.Encryption() != nil || s.Status().Encrypted {
+		t.Error("stack is encrypted, expected not")
+	}
+
+	if err := s.SetEncryption(NewKeyring()); err != ErrNoKeys {
+		t.Errorf("err is %v, expected %v", err, ErrNoKeys)
+	}
+	keys := testKeyring(t, "a")
+	if err := s.SetEncryption(keys); err != nil {
+		t.Fatal(err)
+	}
+	if s.Encryption() != keys || !s.Status().Encrypted {
+		t.Error("stack is not encrypted, expected it")
+	}
+	if err := s.SetEncryption(nil); err != nil || s.Encryption() != nil {
+		t.Errorf("stack is encrypted with err %v, expected not", err)
+	}
+
+	unique := NewStack("unique", time.Now())
+	unique.SetUnique(UniqueReject)
+	if err := unique.SetEncryption(keys); err != ErrUnsupported {
+		t.Errorf("err is %v, expected %v", err, ErrUnsupported)
+	}
+	dir, err := ioutil.TempDir("", "piladb-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	spill, err := NewSpillStack("spill", time.Now(), dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.close()
+	if err := spill.SetEncryption(keys); err != ErrUnsupported {
+		t.Errorf("err is %v, expected %v", err, ErrUnsupported)
+	}
+}
+
+func TestStackEncryption(t *testing.T) {
+	keys := testKeyring(t, "a")
+	s := NewStack("s", time.Now())
+	s.SetCompress(1)
+	if err := s.SetEncryption(keys); err != nil {
+		t.Fatal(err)
+	}
+
+	long := strings.Repeat("piladb ", 100)
+	values := []interface{}{
+		"foo",
+		long,
+		Binary{ContentType: "text/plain", Data: []byte(long)},
+		map[string]interface{}{"text": long, "n": 8.0},
+	}
+	for _, value := range values {
+		if err := s.Push(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the elements are stored sealed, and not compressed
+	s.base.Range(func(element interface{}) bool {
+		if _, ok := stored(element).(sealedElement); !ok {
+			t.Errorf("element is %T, expected sealedElement", stored(element))
+		}
+		return true
+	})
+
+	// the elements are decrypted with the former key after a rotation
+	if err := keys.Add("b", bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Push("bar")
+	if !reflect.DeepEqual(s.Peek(), "bar") {
+		t.Errorf("peek is %v, expected %v", s.Peek(), "bar")
+	}
+	if value, ok := s.Pop(); !ok || value != "bar" {
+		t.Errorf("element is %v, expected %v", value, "bar")
+	}
+	for i := len(values) - 1; i >= 0; i-- {
+		if value, ok := s.Pop(); !ok || !reflect.DeepEqual(value, values[i]) {
+			t.Errorf("element is %v, expected %v", value, values[i])
+		}
+	}
+	if s.Memory() != 0 {
+		t.Errorf("memory is %d, expected %d", s.Memory(), 0)
+	}
+}
+
+func TestStackEncryption_Wrapped(t *testing.T) {
+	s := NewPriority("s", time.Now())
+	if err := s.SetEncryption(testKeyring(t, "a")); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = s.PushWithPriority("low", 1, time.Time{})
+	_ = s.PushWithPriority("high", 2, time.Now().Add(time.Hour))
+
+	if value, ok := s.Pop(); !ok || value != "high" {
+		t.Errorf("element is %v, expected %v", value, "high")
+	}
+	if value, ok := s.Pop(); !ok || value != "low" {
+		t.Errorf("element is %v, expected %v", value, "low")
+	}
+}
+
+func TestStackEncryption_Move(t *testing.T) {
+	keys := testKeyring(t, "a")
+	from := NewStack("from", time.Now())
+	if err := from.SetEncryption(keys); err != nil {
+		t.Fatal(err)
+	}
+	to := NewStack("to", time.Now())
+
+	_ = from.Push("foo")
+	if _, err := from.MoveTo(to, 1); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := to.Pop(); !ok || value != "foo" {
+		t.Errorf("element is %v, expected %v", value, "foo")
+	}
+}
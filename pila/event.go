@@ -0,0 +1,123 @@
+package pila
+
+import "encoding/json"
+
+// EventOp is the operation that triggered an Event.
+type EventOp string
+
+const (
+	// EventPush is triggered when an element is pushed into a Stack.
+	EventPush EventOp = "push"
+	// EventPop is triggered when an element is popped from a Stack.
+	EventPop EventOp = "pop"
+	// EventFlush is triggered when a Stack is flushed.
+	EventFlush EventOp = "flush"
+	// EventRotate is triggered when the element on top of a
+	// Stack is moved to its bottom.
+	EventRotate EventOp = "rotate"
+	// EventSweep is triggered when the element at the bottom
+	// of a Stack is removed.
+	EventSweep EventOp = "sweep"
+	// EventReverse is triggered when the order of the
+	// elements of a Stack is reversed.
+	EventReverse EventOp = "reverse"
+	// EventSort is triggered when the elements of a Stack are sorted.
+	EventSort EventOp = "sort"
+	// EventHighWatermark is triggered when the size of a Stack
+	// rises to its high watermark, see Watermarks.
+	EventHighWatermark EventOp = "high_watermark"
+	// EventLowWatermark is triggered when the size of a Stack
+	// falls to its low watermark, see Watermarks.
+	EventLowWatermark EventOp = "low_watermark"
+)
+
+// Event represents an operation executed on a Stack.
+type Event struct {
+	Op EventOp `json:"op"`
+	// Element is the pushed or popped element, the size of
+	// the Stack on watermark Events, nil on FLUSH, REVERSE and SORT
+	Element interface{} `json:"element,omitempty"`
+}
+
+// ToJSON converts an Event into JSON.
+func (e Event) ToJSON() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// Subscribe registers a function that is called with every Event
+// of the Stack, right after the operation is executed, and returns
+// a function to unregister it. The function is called synchronously
+// by the goroutine executing the operation, so it must not block
+// nor operate on the Stack. Events of concurrent operations may be
+// received in a different order than they were applied.
+func (s *Stack) Subscribe(fn func(Event)) (unsubscribe func()) {
+	s.observersMu.Lock()
+	defer s.observersMu.Unlock()
+
+	if s.observers == nil {
+		s.observers = make(map[int]func(Event))
+	}
+	id := s.nextObserver
+	s.nextObserver++
+	s.observers[id] = fn
+
+	return func() {
+		s.observersMu.Lock()
+		defer s.observersMu.Unlock()
+		delete(s.observers, id)
+	}
+}
+
+// Pushed returns a channel that receives a value after elements are
+// pushed into the Stack, and a function to stop it. Pushes that happen
+// while a value is pending are coalesced, so the receiver must not
+// assume a single element was pushed.
+func (s *Stack) Pushed() (pushed <-chan struct{}, stop func()) {
+	return PushedAny(s)
+}
+
+// PushedAny returns a channel that receives a value after elements are
+// pushed into any of the stacks, and a function to stop it, so they can
+// be waited for at once. Like Pushed, pushes are coalesced, and the
+// receiver must check every Stack.
+func PushedAny(stacks ...*Stack) (pushed <-chan struct{}, stop func()) {
+	ch := make(chan struct{}, 1)
+	stops := make([]func(), len(stacks))
+	for i, s := range stacks {
+		stops[i] = s.Subscribe(func(e Event) {
+			if e.Op != EventPush {
+				return
+			}
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		})
+	}
+	return ch, func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+// notify calls the subscribed functions with an Event, checks
+// the Watermarks of the Stack, and notifies the watchers of its
+// Pila, if any, that it changed.
+func (s *Stack) notify(e Event) {
+	s.publish(e)
+	s.checkWatermarks()
+
+	if db := s.Database; db != nil {
+		db.changed()
+	}
+}
+
+// publish calls the subscribed functions with an Event.
+func (s *Stack) publish(e Event) {
+	s.observersMu.RLock()
+	for _, fn := range s.observers {
+		fn(e)
+	}
+	s.observersMu.RUnlock()
+}
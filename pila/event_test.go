@@ -0,0 +1,111 @@
+package pila
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventToJSON(t *testing.T) {
+	inputOutput := []struct {
+		input  Event
+		output string
+	}{
+		{Event{Op: EventPush, Element: "foo"}, `{"op":"push","element":"foo"}`},
+		{Event{Op: EventPop, Element: 8}, `{"op":"pop","element":8}`},
+		{Event{Op: EventFlush}, `{"op":"flush"}`},
+	}
+
+	for _, io := range inputOutput {
+		if b, err := io.input.ToJSON(); err != nil || string(b) != io.output {
+			t.Errorf("json is %s, expected %s", b, io.output)
+		}
+	}
+}
+
+func TestStackSubscribe(t *testing.T) {
+	now := time.Now()
+	stack := NewStackWithLimit("stack", now, 1, OverflowReject)
+
+	var events, others []Event
+	unsubscribe := stack.Subscribe(func(e Event) {
+		events = append(events, e)
+	})
+	stack.Subscribe(func(e Event) {
+		others = append(others, e)
+	})
+
+	_ = stack.PushWithExpiration("foo", now.Add(time.Hour))
+	_ = stack.Push("bar")
+	stack.Pop()
+	stack.Pop()
+	_ = stack.Push("baz")
+	unsubscribe()
+	stack.Flush()
+
+	expected := []Event{
+		{Op: EventPush, Element: "foo"},
+		{Op: EventPop, Element: "foo"},
+		{Op: EventPush, Element: "baz"},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("events are %v, expected %v", events, expected)
+	}
+
+	expected = append(expected, Event{Op: EventFlush})
+	if !reflect.DeepEqual(others, expected) {
+		t.Errorf("events are %v, expected %v", others, expected)
+	}
+}
+
+func TestStackPushed(t *testing.T) {
+	stack := NewStack("stack", time.Now())
+	pushed, stop := stack.Pushed()
+
+	_ = stack.Push("foo")
+	_ = stack.Push("bar")
+	stack.Pop()
+
+	select {
+	case <-pushed:
+	default:
+		t.Fatal("no value received, expected one after push")
+	}
+	select {
+	case <-pushed:
+		t.Error("value received, expected pushes to be coalesced")
+	default:
+	}
+
+	stop()
+	_ = stack.Push("baz")
+	select {
+	case <-pushed:
+		t.Error("value received, expected none after stop")
+	default:
+	}
+}
+
+func TestPushedAny(t *testing.T) {
+	foo := NewStack("foo", time.Now())
+	bar := NewStack("bar", time.Now())
+	pushed, stop := PushedAny(foo, bar)
+
+	for _, stack := range []*Stack{foo, bar} {
+		_ = stack.Push("baz")
+		select {
+		case <-pushed:
+		default:
+			t.Fatalf("no value received, expected one after push into %s", stack.Name)
+		}
+	}
+
+	stop()
+	_ = foo.Push("baz")
+	_ = bar.Push("baz")
+	select {
+	case <-pushed:
+		t.Error("value received, expected none after stop")
+	default:
+	}
+}
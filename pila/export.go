@@ -0,0 +1,39 @@
+package pila
+
+import "time"
+
+// ForEachElement calls fn for each element of the Stack, in the order
+// they were pushed, so pushing them in such order recreates the Stack:
+// from the bottom to the top of a StructureStack, and from the front
+// to the back of a StructureQueue. The Elements keep their priority in
+// a StructurePriority, but not their expiration date, and expired ones
+// are skipped. It stops once fn returns false.
+//
+// The elements are read at once, as a consistent view of the Stack, but
+// only references to them are kept, and fn is called without locking
+// the Stack, so fn can take its time to encode them.
+func (s *Stack) ForEachElement(fn func(e Element) bool) {
+	now := time.Now()
+
+	elements := make([]interface{}, 0, s.SizeApprox())
+	s.base.Range(func(element interface{}) bool {
+		elements = append(elements, element)
+		return true
+	})
+
+	// Range starts from the last pushed element
+	for i := len(elements) - 1; i >= 0; i-- {
+		value, alive := unwrap(elements[i], now)
+		if !alive {
+			continue
+		}
+		e := NewElement(value)
+		if s.Type == StructurePriority {
+			p := priority(elements[i])
+			e.Priority = &p
+		}
+		if !fn(e) {
+			return
+		}
+	}
+}
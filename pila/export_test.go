@@ -0,0 +1,52 @@
+package pila
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStackForEachElement(t *testing.T) {
+	now := time.Now()
+	one, two := 1.0, 2.0
+
+	stack := NewStack("stack", now)
+	queue := NewQueue("queue", now)
+	heap := NewPriority("heap", now)
+	for _, s := range []*Stack{stack, queue} {
+		_ = s.Push("foo")
+		_ = s.PushWithExpiration("bar", now.Add(-time.Second))
+		_ = s.Push(Binary{ContentType: "text/plain", Data: []byte("baz")})
+	}
+	_ = heap.PushWithPriority("foo", 2, time.Time{})
+	_ = heap.PushWithPriority("bar", 1, time.Time{})
+
+	inputOutput := []struct {
+		input  *Stack
+		output []Element
+	}{
+		{stack, []Element{{Value: "foo"}, {Value: []byte("baz"), ContentType: "text/plain"}}},
+		{queue, []Element{{Value: "foo"}, {Value: []byte("baz"), ContentType: "text/plain"}}},
+		{heap, []Element{{Value: "foo", Priority: &two}, {Value: "bar", Priority: &one}}},
+	}
+
+	for _, io := range inputOutput {
+		var elements []Element
+		io.input.ForEachElement(func(e Element) bool {
+			elements = append(elements, e)
+			return true
+		})
+		if !reflect.DeepEqual(elements, io.output) {
+			t.Errorf("elements are %v, expected %v for %s", elements, io.output, io.input.Name)
+		}
+	}
+
+	var elements []Element
+	stack.ForEachElement(func(e Element) bool {
+		elements = append(elements, e)
+		return false
+	})
+	if len(elements) != 1 {
+		t.Errorf("elements are %v, expected only one", elements)
+	}
+}
@@ -0,0 +1,292 @@
+package pila
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/uuid"
+)
+
+var (
+	// ErrGroupExists is returned when adding a group
+	// to a Stack that already has one with its name.
+	ErrGroupExists = errors.New("group already exists")
+	// ErrGroupNotExist is returned when operating on
+	// a group that the Stack does not have.
+	ErrGroupNotExist = errors.New("group does not exist")
+	// ErrPendingNotExist is returned when acknowledging an
+	// element that is not pending in a group, e.g. because
+	// its acknowledgement timed out and it was redelivered.
+	ErrPendingNotExist = errors.New("pending element does not exist")
+)
+
+// PendingElement represents an element popped from a Stack by a
+// consumer of a group, which is pending until it is acknowledged.
+type PendingElement struct {
+	ID       string `json:"id"`
+	Consumer string `json:"consumer"`
+	Element
+	DeliveredAt time.Time `json:"delivered_at"`
+	Deadline    time.Time `json:"deadline"`
+	// Deliveries is the number of times the element was
+	// delivered, counting the redeliveries
+	Deliveries int `json:"deliveries"`
+
+	// value is the popped value of the element
+	value interface{}
+}
+
+// GroupStatus represents the status of a group of consumers of a Stack.
+type GroupStatus struct {
+	Name         string `json:"name"`
+	AckTimeout   string `json:"ack_timeout"`
+	Pending      int    `json:"pending"`
+	Delivered    int64  `json:"delivered"`
+	Acked        int64  `json:"acked"`
+	Redelivered  int64  `json:"redelivered"`
+	DeadLettered int64  `json:"dead_lettered"`
+}
+
+// group represents a group of consumers of a Stack, whose elements
+// popped by them are pending until acknowledged within ackTimeout.
+type group struct {
+	ackTimeout time.Duration
+	// pending are the PendingElements by ID
+	pending map[string]PendingElement
+
+	delivered, acked, redelivered, deadLettered int64
+}
+
+// AddGroup adds to the Stack a group of consumers called name, whose
+// popped elements must be acknowledged within ackTimeout, or they are
+// redelivered, see Redeliver. If the Stack already has a group called
+// name, ErrGroupExists is returned.
+func (s *Stack) AddGroup(name string, ackTimeout time.Duration) error {
+	s.groupsMu.Lock()
+	defer s.groupsMu.Unlock()
+	if _, ok := s.groups[name]; ok {
+		return ErrGroupExists
+	}
+	if s.groups == nil {
+		s.groups = make(map[string]*group)
+	}
+	s.groups[name] = &group{ackTimeout: ackTimeout, pending: make(map[string]PendingElement)}
+	return nil
+}
+
+// RemoveGroup removes the group of consumers called name from the
+// Stack, pushing back its pending elements, which are returned. If
+// the Stack has no such group, ErrGroupNotExist is returned.
+func (s *Stack) RemoveGroup(name string) ([]interface{}, error) {
+	s.groupsMu.Lock()
+	defer s.groupsMu.Unlock()
+	g, ok := s.groups[name]
+	if !ok {
+		return nil, ErrGroupNotExist
+	}
+	delete(s.groups, name)
+
+	values := []interface{}{}
+	for _, p := range sortedPending(g) {
+		if err := s.pushWithSize(p.value, 0); err == nil {
+			values = append(values, p.value)
+		}
+	}
+	return values, nil
+}
+
+// Groups returns the status of the groups of
+// consumers of the Stack, sorted by name.
+func (s *Stack) Groups() []GroupStatus {
+	s.groupsMu.Lock()
+	defer s.groupsMu.Unlock()
+
+	groups := make([]GroupStatus, 0, len(s.groups))
+	for name, g := range s.groups {
+		groups = append(groups, GroupStatus{
+			Name:         name,
+			AckTimeout:   g.ackTimeout.String(),
+			Pending:      len(g.pending),
+			Delivered:    g.delivered,
+			Acked:        g.acked,
+			Redelivered:  g.redelivered,
+			DeadLettered: g.deadLettered,
+		})
+	}
+	sort.Sort(groupsByName(groups))
+	return groups
+}
+
+// PopGroup pops the element on top of the Stack at date t for the
+// consumer of the group called name, and returns it as pending until
+// it is acknowledged with Ack. If the Stack was empty, it returns
+// false. If the Stack has no such group, ErrGroupNotExist is returned.
+func (s *Stack) PopGroup(name, consumer string, t time.Time) (PendingElement, bool, error) {
+	s.groupsMu.Lock()
+	defer s.groupsMu.Unlock()
+	g, ok := s.groups[name]
+	if !ok {
+		return PendingElement{}, false, ErrGroupNotExist
+	}
+
+	value, ok := s.Pop()
+	if !ok {
+		return PendingElement{}, false, nil
+	}
+
+	p := PendingElement{
+		ID:          uuid.NewRandom().String(),
+		Consumer:    consumer,
+		Element:     NewElement(value),
+		DeliveredAt: t,
+		Deadline:    t.Add(g.ackTimeout),
+		Deliveries:  s.delivery(value),
+		value:       value,
+	}
+	g.pending[p.ID] = p
+	g.delivered++
+	return p, true, nil
+}
+
+// Ack acknowledges the element pending in the group called name given
+// its ID, which is forgotten. If the Stack has no such group,
+// ErrGroupNotExist is returned, and if the element is not pending,
+// ErrPendingNotExist.
+func (s *Stack) Ack(name, id string) error {
+	s.groupsMu.Lock()
+	defer s.groupsMu.Unlock()
+	g, ok := s.groups[name]
+	if !ok {
+		return ErrGroupNotExist
+	}
+	if _, ok := g.pending[id]; !ok {
+		return ErrPendingNotExist
+	}
+	delete(g.pending, id)
+	g.acked++
+	return nil
+}
+
+// Pending returns the elements pending in the group called name,
+// the first delivered first. If the Stack has no such group,
+// ErrGroupNotExist is returned.
+func (s *Stack) Pending(name string) ([]PendingElement, error) {
+	s.groupsMu.Lock()
+	defer s.groupsMu.Unlock()
+	g, ok := s.groups[name]
+	if !ok {
+		return nil, ErrGroupNotExist
+	}
+	return sortedPending(g), nil
+}
+
+// DeadLettered are the elements moved by Redeliver into the
+// dead-letter Stack of a Stack.
+type DeadLettered struct {
+	Stack  *Stack
+	Values []interface{}
+}
+
+// Redeliver pushes back into the Stack the elements pending in its
+// groups whose acknowledgement timed out at date t, so they are popped
+// again, and returns them. Elements that were delivered as many times
+// as the MaxDeliveries of the DeadLetter of the Stack are pushed into
+// the dead-letter Stack instead, and returned as DeadLettered. Elements
+// that can not be pushed, e.g. because the Stack is full, stay pending
+// until the next call.
+func (s *Stack) Redeliver(t time.Time) ([]interface{}, DeadLettered) {
+	deadLetter, _ := s.DeadLetterStack()
+
+	s.groupsMu.Lock()
+	defer s.groupsMu.Unlock()
+
+	var values []interface{}
+	dead := DeadLettered{Stack: deadLetter}
+	for _, g := range s.groups {
+		for _, p := range sortedPending(g) {
+			if t.Before(p.Deadline) {
+				continue
+			}
+			if deadLetter != nil && s.deadLetter != nil && p.Deliveries >= s.deadLetter.MaxDeliveries {
+				if err := deadLetter.pushWithSize(p.value, 0); err != nil {
+					continue
+				}
+				delete(g.pending, p.ID)
+				g.deadLettered++
+				dead.Values = append(dead.Values, p.value)
+				continue
+			}
+			if err := s.pushWithSize(p.value, 0); err != nil {
+				continue
+			}
+			delete(g.pending, p.ID)
+			g.redelivered++
+			s.redelivered(p.value, p.Deliveries)
+			values = append(values, p.value)
+		}
+	}
+	return values, dead
+}
+
+// redelivered records that a value pushed back by Redeliver was
+// delivered the given number of times. It must be called while
+// holding groupsMu.
+func (s *Stack) redelivered(value interface{}, deliveries int) {
+	if s.deliveries == nil {
+		s.deliveries = make(map[string][]int)
+	}
+	key := deliveryKey(value)
+	s.deliveries[key] = append(s.deliveries[key], deliveries)
+}
+
+// delivery returns the number of times a value popped by a group
+// was delivered, counting this delivery, given the ones recorded
+// when pushed back. It must be called while holding groupsMu.
+func (s *Stack) delivery(value interface{}) int {
+	if len(s.deliveries) == 0 {
+		return 1
+	}
+	key := deliveryKey(value)
+	counts, ok := s.deliveries[key]
+	if !ok {
+		return 1
+	}
+	if len(counts) == 1 {
+		delete(s.deliveries, key)
+	} else {
+		s.deliveries[key] = counts[1:]
+	}
+	return counts[0] + 1
+}
+
+// sortedPending returns the elements pending in
+// the group g, the first delivered first.
+func sortedPending(g *group) []PendingElement {
+	pending := make([]PendingElement, 0, len(g.pending))
+	for _, p := range g.pending {
+		pending = append(pending, p)
+	}
+	sort.Sort(pendingByDelivery(pending))
+	return pending
+}
+
+// groupsByName sorts a list of GroupStatus by name.
+type groupsByName []GroupStatus
+
+func (gs groupsByName) Len() int           { return len(gs) }
+func (gs groupsByName) Less(i, j int) bool { return gs[i].Name < gs[j].Name }
+func (gs groupsByName) Swap(i, j int)      { gs[i], gs[j] = gs[j], gs[i] }
+
+// pendingByDelivery sorts a list of PendingElements
+// by delivery date, and by ID among equals.
+type pendingByDelivery []PendingElement
+
+func (ps pendingByDelivery) Len() int { return len(ps) }
+func (ps pendingByDelivery) Less(i, j int) bool {
+	if ps[i].DeliveredAt.Equal(ps[j].DeliveredAt) {
+		return ps[i].ID < ps[j].ID
+	}
+	return ps[i].DeliveredAt.Before(ps[j].DeliveredAt)
+}
+func (ps pendingByDelivery) Swap(i, j int) { ps[i], ps[j] = ps[j], ps[i] }
@@ -0,0 +1,139 @@
+package pila
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStackGroups(t *testing.T) {
+	now := time.Now()
+	stack := NewStack("test-stack", now)
+	if groups := stack.Groups(); len(groups) != 0 {
+		t.Errorf("groups are %v, expected none", groups)
+	}
+
+	if err := stack.AddGroup("workers", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := stack.AddGroup("workers", time.Minute); err != ErrGroupExists {
+		t.Errorf("err is %v, expected %v", err, ErrGroupExists)
+	}
+	if err := stack.AddGroup("auditors", time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []GroupStatus{
+		{Name: "auditors", AckTimeout: "1s"},
+		{Name: "workers", AckTimeout: "1m0s"},
+	}
+	if groups := stack.Groups(); !reflect.DeepEqual(groups, expected) {
+		t.Errorf("groups are %v, expected %v", groups, expected)
+	}
+
+	if _, err := stack.RemoveGroup("foo"); err != ErrGroupNotExist {
+		t.Errorf("err is %v, expected %v", err, ErrGroupNotExist)
+	}
+	if values, err := stack.RemoveGroup("auditors"); err != nil || len(values) != 0 {
+		t.Errorf("removed group has pending %v, %v, expected none, nil", values, err)
+	}
+	if groups := stack.Groups(); len(groups) != 1 || groups[0].Name != "workers" {
+		t.Errorf("groups are %v, expected only workers", groups)
+	}
+}
+
+func TestStackPopGroup(t *testing.T) {
+	now := time.Now()
+	stack := NewStack("test-stack", now)
+	if _, _, err := stack.PopGroup("workers", "alice", now); err != ErrGroupNotExist {
+		t.Errorf("err is %v, expected %v", err, ErrGroupNotExist)
+	}
+
+	_ = stack.AddGroup("workers", time.Minute)
+	if _, ok, err := stack.PopGroup("workers", "alice", now); ok || err != nil {
+		t.Errorf("pop is %v, %v, expected false, nil", ok, err)
+	}
+
+	_ = stack.PushN([]interface{}{"foo", "bar", Binary{ContentType: "image/png", Data: []byte{1}}})
+	p1, ok, err := stack.PopGroup("workers", "alice", now)
+	if !ok || err != nil {
+		t.Fatalf("pop is %v, %v, expected true, nil", ok, err)
+	}
+	if p1.ID == "" || p1.Consumer != "alice" || p1.ContentType != "image/png" ||
+		!reflect.DeepEqual(p1.Value, []byte{1}) || !p1.Deadline.Equal(now.Add(time.Minute)) {
+		t.Errorf("pending element is %v", p1)
+	}
+	p2, _, _ := stack.PopGroup("workers", "bob", now.Add(time.Second))
+	if p2.Value != "bar" || p2.Consumer != "bob" {
+		t.Errorf("pending element is %v, expected bar of bob", p2)
+	}
+	if stack.Size() != 1 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 1)
+	}
+
+	pending, err := stack.Pending("workers")
+	if err != nil || len(pending) != 2 || pending[0].ID != p1.ID || pending[1].ID != p2.ID {
+		t.Errorf("pending elements are %v, %v, expected %v", pending, err, []PendingElement{p1, p2})
+	}
+	if _, err := stack.Pending("foo"); err != ErrGroupNotExist {
+		t.Errorf("err is %v, expected %v", err, ErrGroupNotExist)
+	}
+
+	if err := stack.Ack("foo", p1.ID); err != ErrGroupNotExist {
+		t.Errorf("err is %v, expected %v", err, ErrGroupNotExist)
+	}
+	if err := stack.Ack("workers", p1.ID); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+	if err := stack.Ack("workers", p1.ID); err != ErrPendingNotExist {
+		t.Errorf("err is %v, expected %v", err, ErrPendingNotExist)
+	}
+
+	status := stack.Groups()[0]
+	if status.Pending != 1 || status.Delivered != 2 || status.Acked != 1 {
+		t.Errorf("group status is %v, expected 1 pending, 2 delivered and 1 acked", status)
+	}
+}
+
+func TestStackRedeliver(t *testing.T) {
+	now := time.Now()
+	stack := NewStack("test-stack", now)
+	_ = stack.AddGroup("workers", time.Minute)
+	_ = stack.PushN([]interface{}{"foo", "bar"})
+	p, _, _ := stack.PopGroup("workers", "alice", now)
+
+	if values, _ := stack.Redeliver(now.Add(time.Second)); len(values) != 0 {
+		t.Errorf("redelivered elements are %v, expected none", values)
+	}
+	if values, _ := stack.Redeliver(now.Add(time.Minute)); !reflect.DeepEqual(values, []interface{}{"bar"}) {
+		t.Errorf("redelivered elements are %v, expected %v", values, []interface{}{"bar"})
+	}
+	if stack.Size() != 2 || stack.Peek() != "bar" {
+		t.Errorf("stack has size %d and peek %v, expected %d and %v", stack.Size(), stack.Peek(), 2, "bar")
+	}
+	if err := stack.Ack("workers", p.ID); err != ErrPendingNotExist {
+		t.Errorf("err is %v, expected %v", err, ErrPendingNotExist)
+	}
+	if status := stack.Groups()[0]; status.Pending != 0 || status.Redelivered != 1 {
+		t.Errorf("group status is %v, expected 0 pending and 1 redelivered", status)
+	}
+
+	// elements that can not be pushed back stay pending
+	stack.MaxSize, stack.Policy = 2, OverflowReject
+	stack.PopGroup("workers", "alice", now)
+	_ = stack.Push("baz")
+	if values, _ := stack.Redeliver(now.Add(time.Hour)); len(values) != 0 {
+		t.Errorf("redelivered elements are %v, expected none", values)
+	}
+	if pending, _ := stack.Pending("workers"); len(pending) != 1 {
+		t.Errorf("pending elements are %v, expected 1", pending)
+	}
+
+	stack.Pop()
+	if values, err := stack.RemoveGroup("workers"); err != nil || !reflect.DeepEqual(values, []interface{}{"bar"}) {
+		t.Errorf("removed group pushed back %v, %v, expected %v, nil", values, err, []interface{}{"bar"})
+	}
+	if stack.Size() != 2 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 2)
+	}
+}
@@ -0,0 +1,122 @@
+package pila
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoHistory is returned when undoing a POP operation
+// on a Stack that keeps no popped element.
+var ErrNoHistory = errors.New("no popped element to undo")
+
+// SetHistoryDepth makes the Stack keep up to n of the last elements
+// popped with Pop, PopN or PopIf, so their POP operations can be
+// undone, or none if n is not positive, discarding the ones kept.
+// Elements removed by other operations, like SWEEP, MOVE or
+// Transactions, are not kept.
+func (s *Stack) SetHistoryDepth(n int) {
+	if n < 0 {
+		n = 0
+	}
+
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	s.historyDepth = n
+	if len(s.history) > n {
+		s.history = append([]interface{}{}, s.history[len(s.history)-n:]...)
+	}
+}
+
+// HistoryDepth returns the maximum number of popped
+// elements kept by the Stack, 0 if it keeps none.
+func (s *Stack) HistoryDepth() int {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	return s.historyDepth
+}
+
+// History returns up to limit of the popped elements kept by
+// the Stack, the last popped first.
+func (s *Stack) History(limit int) []interface{} {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	values := make([]interface{}, 0, sliceLen(len(s.history), limit))
+	for i := len(s.history) - 1; i >= 0 && len(values) < limit; i-- {
+		value, _ := unwrap(s.history[i], time.Time{})
+		values = append(values, value)
+	}
+	return values
+}
+
+// Undo undoes the last POP operation kept by the Stack, putting its
+// element back on top, and returns it. Popped elements that expired
+// since are discarded. If there is none, ErrNoHistory is returned.
+// Like PUSH operations, it fails with ErrStackFull if the Stack is
+// full, whatever its policy, with ErrMemoryLimit if its Database has
+// no room for the element, and with ErrDuplicate if the Stack is
+// unique and already contains it. The element is kept if it fails.
+func (s *Stack) Undo() (interface{}, error) {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	// expired elements are not restored
+	now := time.Now()
+	n := len(s.history)
+	for n > 0 {
+		if alive(s.history[n-1], now) {
+			break
+		}
+		n--
+	}
+	s.history = s.history[:n]
+	if n == 0 {
+		return nil, ErrNoHistory
+	}
+
+	element := s.history[n-1]
+	if err := s.checkMemory(element); err != nil {
+		return nil, err
+	}
+	s.pushMu.Lock()
+	defer s.pushMu.Unlock()
+	if s.MaxSize > 0 && s.Size() >= s.MaxSize {
+		return nil, ErrStackFull
+	}
+	if s.indexHas(element) {
+		return nil, ErrDuplicate
+	}
+
+	s.history = s.history[:n-1]
+	s.undoPop(element)
+	value, _ := unwrap(element, now)
+	return value, nil
+}
+
+// remember keeps a popped element, as stored, in the history
+// of the Stack, discarding the oldest one if it is full.
+func (s *Stack) remember(element interface{}) {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	if s.historyDepth == 0 {
+		return
+	}
+	if len(s.history) == s.historyDepth {
+		copy(s.history, s.history[1:])
+		s.history = s.history[:len(s.history)-1]
+	}
+	s.history = append(s.history, element)
+}
+
+// sliceLen returns the length of a slice of up to
+// limit elements taken from n elements.
+func sliceLen(n, limit int) int {
+	if limit < n {
+		n = limit
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n
+}
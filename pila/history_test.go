@@ -0,0 +1,118 @@
+package pila
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStackUndo(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+	stack.Push("foo")
+	stack.Pop()
+	if _, err := stack.Undo(); err != ErrNoHistory {
+		t.Errorf("err is %v, expected %v", err, ErrNoHistory)
+	}
+
+	stack.SetHistoryDepth(2)
+	if stack.HistoryDepth() != 2 || stack.Status().History != 2 {
+		t.Errorf("stack history depth is %d, expected %d", stack.HistoryDepth(), 2)
+	}
+	_ = stack.PushN([]interface{}{"foo", "bar", "baz"})
+	stack.PopN(2)
+	if _, _, err := stack.PopIf(func(value interface{}, version uint64) bool { return true }); err != nil {
+		t.Fatal(err)
+	}
+	if history := stack.History(10); !reflect.DeepEqual(history, []interface{}{"foo", "bar"}) {
+		t.Errorf("stack history is %v, expected %v", history, []interface{}{"foo", "bar"})
+	}
+	if history := stack.History(1); !reflect.DeepEqual(history, []interface{}{"foo"}) {
+		t.Errorf("stack history is %v, expected %v", history, []interface{}{"foo"})
+	}
+
+	for _, expected := range []interface{}{"foo", "bar"} {
+		if value, err := stack.Undo(); err != nil || value != expected {
+			t.Errorf("undone element is %v, %v, expected %v", value, err, expected)
+		}
+	}
+	if _, err := stack.Undo(); err != ErrNoHistory {
+		t.Errorf("err is %v, expected %v", err, ErrNoHistory)
+	}
+	if stack.Size() != 2 || stack.Peek() != "bar" {
+		t.Errorf("stack has size %d and peek %v, expected %d and %v", stack.Size(), stack.Peek(), 2, "bar")
+	}
+
+	stack.SetHistoryDepth(0)
+	stack.Pop()
+	if history := stack.History(10); len(history) != 0 {
+		t.Errorf("stack history is %v, expected none", history)
+	}
+}
+
+func TestStackUndo_Queue(t *testing.T) {
+	queue := NewQueue("test-queue", time.Now())
+	queue.SetHistoryDepth(1)
+	_ = queue.PushN([]interface{}{"foo", "bar"})
+	queue.Pop()
+
+	if value, err := queue.Undo(); err != nil || value != "foo" {
+		t.Errorf("undone element is %v, %v, expected %v", value, err, "foo")
+	}
+	if queue.Peek() != "foo" {
+		t.Errorf("queue peek is %v, expected %v", queue.Peek(), "foo")
+	}
+}
+
+func TestStackUndo_Expired(t *testing.T) {
+	now := time.Now()
+	stack := NewStack("test-stack", now)
+	stack.SetHistoryDepth(3)
+	stack.Push("foo")
+	stack.PushWithExpiration("bar", now.Add(50*time.Millisecond))
+	stack.Pop()
+	stack.Pop()
+	time.Sleep(60 * time.Millisecond)
+
+	if value, err := stack.Undo(); err != nil || value != "foo" {
+		t.Errorf("undone element is %v, %v, expected %v", value, err, "foo")
+	}
+	if _, err := stack.Undo(); err != ErrNoHistory {
+		t.Errorf("err is %v, expected %v", err, ErrNoHistory)
+	}
+}
+
+func TestStackUndo_Errors(t *testing.T) {
+	stack := NewStackWithLimit("test-stack", time.Now(), 1, OverflowDropOldest)
+	stack.SetHistoryDepth(1)
+	stack.Push("foo")
+	stack.Pop()
+	stack.Push("bar")
+	if _, err := stack.Undo(); err != ErrStackFull {
+		t.Errorf("err is %v, expected %v", err, ErrStackFull)
+	}
+
+	unique := NewStack("test-unique", time.Now())
+	unique.SetUnique(UniqueReject)
+	unique.SetHistoryDepth(1)
+	unique.Push("foo")
+	unique.Pop()
+	unique.Push("foo")
+	if _, err := unique.Undo(); err != ErrDuplicate {
+		t.Errorf("err is %v, expected %v", err, ErrDuplicate)
+	}
+
+	db := NewDatabase("db")
+	db.SetMaxMemory(1)
+	limited := NewStack("test-limited", time.Now())
+	_ = db.AddStack(limited)
+	limited.SetHistoryDepth(1)
+	limited.history = append(limited.history, "foo")
+	if _, err := limited.Undo(); err != ErrMemoryLimit {
+		t.Errorf("err is %v, expected %v", err, ErrMemoryLimit)
+	}
+
+	// failed undos keep the element
+	if history := unique.History(10); !reflect.DeepEqual(history, []interface{}{"foo"}) {
+		t.Errorf("stack history is %v, expected %v", history, []interface{}{"foo"})
+	}
+}
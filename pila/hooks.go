@@ -0,0 +1,114 @@
+package pila
+
+import "sync/atomic"
+
+// Hooks are functions called around the operations of a Stack, so
+// embedders can validate, enrich or replicate its elements. Nil
+// functions are ignored.
+type Hooks struct {
+	// BeforePush is called with every element pushed by Push,
+	// PushWithOptions, PushN and the operations built on them,
+	// before it is pushed, returning the element to push instead.
+	// If it returns an error, the element is not pushed and the
+	// error is returned, e.g. by Push. Elements moved from other
+	// Stacks, or pushed back for redelivery, are not passed to it.
+	BeforePush func(s *Stack, element interface{}) (interface{}, error)
+	// AfterPush is called with every element right after it
+	// is pushed, like the functions subscribed to the Events
+	// of the Stack, so it must not block nor operate on it.
+	AfterPush func(s *Stack, element interface{})
+	// AfterPop is called with every element right after it is
+	// popped, with the same restrictions as AfterPush.
+	AfterPop func(s *Stack, element interface{})
+}
+
+// hooksEntry are Hooks registered by Use with an id.
+type hooksEntry struct {
+	id    int
+	hooks Hooks
+}
+
+// Use registers the Hooks of the Stack, and returns a function to
+// unregister them. Hooks are called in the order they are registered,
+// so BeforePush functions receive the element returned by the previous
+// ones.
+func (s *Stack) Use(h Hooks) (remove func()) {
+	s.hooksMu.Lock()
+	id := s.nextHooks
+	s.nextHooks++
+	s.hooks = append(s.hooks, hooksEntry{id: id, hooks: h})
+	atomic.StoreInt32(&s.hasHooks, 1)
+	s.hooksMu.Unlock()
+
+	var unsubscribe func()
+	if h.AfterPush != nil || h.AfterPop != nil {
+		unsubscribe = s.Subscribe(func(e Event) {
+			switch {
+			case e.Op == EventPush && h.AfterPush != nil:
+				h.AfterPush(s, e.Element)
+			case e.Op == EventPop && h.AfterPop != nil:
+				h.AfterPop(s, e.Element)
+			}
+		})
+	}
+
+	return func() {
+		if unsubscribe != nil {
+			unsubscribe()
+		}
+
+		s.hooksMu.Lock()
+		defer s.hooksMu.Unlock()
+		for i, entry := range s.hooks {
+			if entry.id == id {
+				s.hooks = append(s.hooks[:i:i], s.hooks[i+1:]...)
+				break
+			}
+		}
+		if len(s.hooks) == 0 {
+			atomic.StoreInt32(&s.hasHooks, 0)
+		}
+	}
+}
+
+// beforePush returns the element to push instead of element, given
+// by the BeforePush Hooks of the Stack, or the error of the first one
+// rejecting it. The Hooks are called without holding any lock of the
+// Stack, so they can operate on it.
+func (s *Stack) beforePush(element interface{}) (interface{}, error) {
+	if atomic.LoadInt32(&s.hasHooks) == 0 {
+		return element, nil
+	}
+
+	s.hooksMu.RLock()
+	entries := s.hooks
+	s.hooksMu.RUnlock()
+
+	for _, entry := range entries {
+		if entry.hooks.BeforePush == nil {
+			continue
+		}
+		var err error
+		if element, err = entry.hooks.BeforePush(s, element); err != nil {
+			return nil, err
+		}
+	}
+	return element, nil
+}
+
+// beforePushN returns the elements to push instead of elements,
+// given by beforePush, or the error of the first one rejected.
+func (s *Stack) beforePushN(elements []interface{}) ([]interface{}, error) {
+	if atomic.LoadInt32(&s.hasHooks) == 0 {
+		return elements, nil
+	}
+
+	pushed := make([]interface{}, len(elements))
+	for i, element := range elements {
+		var err error
+		if pushed[i], err = s.beforePush(element); err != nil {
+			return nil, err
+		}
+	}
+	return pushed, nil
+}
@@ -0,0 +1,130 @@
+package pila
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStackUse(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+	errOdd := errors.New("odd number")
+
+	var pushed, popped []interface{}
+	removeValidation := stack.Use(Hooks{
+		BeforePush: func(s *Stack, element interface{}) (interface{}, error) {
+			if n, ok := element.(int); ok && n%2 != 0 {
+				return nil, errOdd
+			}
+			return element, nil
+		},
+	})
+	stack.Use(Hooks{
+		BeforePush: func(s *Stack, element interface{}) (interface{}, error) {
+			if n, ok := element.(int); ok {
+				return n * 10, nil
+			}
+			return element, nil
+		},
+		AfterPush: func(s *Stack, element interface{}) { pushed = append(pushed, element) },
+		AfterPop:  func(s *Stack, element interface{}) { popped = append(popped, element) },
+	})
+
+	priority := 1.0
+	inputOutput := []struct {
+		push func() error
+		err  error
+	}{
+		{func() error { return stack.Push(2) }, nil},
+		{func() error { return stack.Push(3) }, errOdd},
+		{func() error { return stack.PushWithOptions(4, PushOptions{Tag: "a"}) }, nil},
+		{func() error { return stack.PushWithOptions(5, PushOptions{}) }, errOdd},
+		{func() error { return stack.PushWithExpiration(6, time.Now().Add(time.Hour)) }, nil},
+		{func() error { return stack.PushWithPriority(8, priority, time.Time{}) }, nil},
+		{func() error { return stack.PushN([]interface{}{10, 11}) }, errOdd},
+		{func() error { return stack.PushN([]interface{}{"foo", 12}) }, nil},
+	}
+	for i, io := range inputOutput {
+		if err := io.push(); err != io.err {
+			t.Errorf("push %d err is %v, expected %v", i, err, io.err)
+		}
+	}
+
+	expected := []interface{}{20, 40, 60, 80, "foo", 120}
+	if !reflect.DeepEqual(pushed, expected) {
+		t.Errorf("pushed are %v, expected %v", pushed, expected)
+	}
+	if value, _, _, _ := stack.PeekWithMetadata(""); value != 120 {
+		t.Errorf("peek is %v, expected %v", value, 120)
+	}
+
+	// once removed, odd numbers are not rejected
+	removeValidation()
+	if err := stack.Push(7); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := stack.Pop(); !ok || value != 70 {
+		t.Errorf("pop is %v, expected %v", value, 70)
+	}
+	if value, ok := stack.Pop(); !ok || value != 120 || !reflect.DeepEqual(popped, []interface{}{70, 120}) {
+		t.Errorf("popped are %v, expected %v", popped, []interface{}{70, 120})
+	}
+}
+
+func TestStackUse_Remove(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+	calls := 0
+	remove := stack.Use(Hooks{
+		BeforePush: func(s *Stack, element interface{}) (interface{}, error) {
+			calls++
+			// hooks can operate on the Stack
+			return s.Size(), nil
+		},
+		AfterPop: func(s *Stack, element interface{}) { calls++ },
+	})
+
+	_ = stack.Push("foo")
+	stack.Pop()
+	remove()
+	_ = stack.Push("bar")
+	stack.Pop()
+
+	if calls != 2 {
+		t.Errorf("calls are %d, expected %d", calls, 2)
+	}
+}
+
+func TestStackUse_Internal(t *testing.T) {
+	src := NewStack("src", time.Now())
+	dst := NewStack("dst", time.Now())
+	_ = src.Push("foo")
+	_ = src.AddGroup("g", time.Minute)
+
+	calls := 0
+	hooks := Hooks{
+		BeforePush: func(s *Stack, element interface{}) (interface{}, error) {
+			calls++
+			return nil, errors.New("rejected")
+		},
+	}
+	src.Use(hooks)
+	dst.Use(hooks)
+
+	// moved and redelivered elements are not passed to BeforePush
+	if _, err := src.PopPush(dst); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dst.PopPush(src); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := src.PopGroup("g", "c", time.Now()); !ok || err != nil {
+		t.Fatalf("pop group is %v, %v, expected an element", ok, err)
+	}
+	if values, _ := src.Redeliver(time.Now().Add(time.Hour)); len(values) != 1 {
+		t.Errorf("redelivered are %v, expected %v", values, []interface{}{"foo"})
+	}
+	if calls != 0 || src.Size() != 1 {
+		t.Errorf("calls are %d and size is %d, expected %d and %d", calls, src.Size(), 0, 1)
+	}
+}
@@ -0,0 +1,149 @@
+package pila
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Operations whose latency is kept by OpLatencies.
+const (
+	OpPush = "push"
+	OpPop  = "pop"
+	OpPeek = "peek"
+)
+
+const (
+	// histogramMin is the upper bound of the first bucket of a Histogram.
+	histogramMin = time.Microsecond
+	// histogramBucketsPerDouble is the number of buckets of a Histogram
+	// every time durations double, so the bound of a bucket is about 19%
+	// greater than the previous one.
+	histogramBucketsPerDouble = 4
+	// histogramBuckets is the number of buckets of a Histogram, the last
+	// one counting the durations greater than about a minute.
+	histogramBuckets = 26*histogramBucketsPerDouble + 2
+)
+
+// Histogram is a streaming histogram of durations. It counts them into
+// buckets whose bounds grow exponentially, from a microsecond to about
+// a minute, so it takes a fixed amount of memory, and the quantiles it
+// returns are off by 19% at most. It is safe for concurrent use without
+// locking.
+type Histogram struct {
+	counts [histogramBuckets]uint64
+	count  uint64
+}
+
+// Observe records a duration.
+func (h *Histogram) Observe(d time.Duration) {
+	atomic.AddUint64(&h.counts[histogramBucket(d)], 1)
+	atomic.AddUint64(&h.count, 1)
+}
+
+// histogramBucket returns the index of the bucket counting d.
+func histogramBucket(d time.Duration) int {
+	if d <= histogramMin {
+		return 0
+	}
+	i := int(math.Ceil(histogramBucketsPerDouble * math.Log2(float64(d)/float64(histogramMin))))
+	if i >= histogramBuckets {
+		return histogramBuckets - 1
+	}
+	return i
+}
+
+// histogramBound returns the upper bound of the bucket i.
+func histogramBound(i int) time.Duration {
+	return time.Duration(float64(histogramMin) * math.Exp2(float64(i)/histogramBucketsPerDouble))
+}
+
+// Count returns the number of durations observed.
+func (h *Histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+// Quantile returns the q-quantile, from 0 to 1, of the durations
+// observed, as the upper bound of the bucket counting it, or 0 if
+// none was observed.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	var counts [histogramBuckets]uint64
+	var total uint64
+	for i := range counts {
+		counts[i] = atomic.LoadUint64(&h.counts[i])
+		total += counts[i]
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var cumulative uint64
+	for i, count := range counts {
+		cumulative += count
+		if cumulative >= rank {
+			return histogramBound(i)
+		}
+	}
+	return histogramBound(histogramBuckets - 1)
+}
+
+// Percentiles summarize the latencies of an operation,
+// in milliseconds.
+type Percentiles struct {
+	Count uint64  `json:"count"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+}
+
+// Percentiles returns the 50th, 95th and 99th
+// percentiles of the durations observed.
+func (h *Histogram) Percentiles() Percentiles {
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	return Percentiles{
+		Count: h.Count(),
+		P50:   ms(h.Quantile(.50)),
+		P95:   ms(h.Quantile(.95)),
+		P99:   ms(h.Quantile(.99)),
+	}
+}
+
+// OpLatencies keeps a Histogram of the latency of
+// every operation: OpPush, OpPop and OpPeek.
+type OpLatencies struct {
+	// histograms are never modified once created,
+	// so they are accessed without locking
+	histograms map[string]*Histogram
+}
+
+// NewOpLatencies returns new empty OpLatencies.
+func NewOpLatencies() *OpLatencies {
+	return &OpLatencies{histograms: map[string]*Histogram{
+		OpPush: new(Histogram),
+		OpPop:  new(Histogram),
+		OpPeek: new(Histogram),
+	}}
+}
+
+// Observe records the latency of an operation.
+// Unknown operations are ignored.
+func (l *OpLatencies) Observe(op string, d time.Duration) {
+	if h, ok := l.histograms[op]; ok {
+		h.Observe(d)
+	}
+}
+
+// Percentiles returns the Percentiles of every operation.
+func (l *OpLatencies) Percentiles() map[string]Percentiles {
+	percentiles := make(map[string]Percentiles, len(l.histograms))
+	for op, h := range l.histograms {
+		percentiles[op] = h.Percentiles()
+	}
+	return percentiles
+}
@@ -0,0 +1,115 @@
+package pila
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistogramBucket(t *testing.T) {
+	inputOutput := []struct {
+		input  time.Duration
+		output int
+	}{
+		{0, 0},
+		{time.Microsecond, 0},
+		{time.Microsecond + 1, 1},
+		{2 * time.Microsecond, histogramBucketsPerDouble},
+		{time.Millisecond, 40},
+		{time.Hour, histogramBuckets - 1},
+	}
+
+	for _, io := range inputOutput {
+		if i := histogramBucket(io.input); i != io.output {
+			t.Errorf("bucket of %v is %d, expected %d", io.input, i, io.output)
+		}
+		if bound := histogramBound(io.output); io.output < histogramBuckets-1 && io.input > bound {
+			t.Errorf("%v is greater than the bound %v of its bucket", io.input, bound)
+		}
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	var h Histogram
+	if q := h.Quantile(.5); q != 0 {
+		t.Errorf("quantile of empty histogram is %v, expected 0", q)
+	}
+
+	for i := 0; i < 90; i++ {
+		h.Observe(time.Microsecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.Observe(time.Millisecond)
+	}
+
+	if count := h.Count(); count != 100 {
+		t.Errorf("count is %d, expected %d", count, 100)
+	}
+	if q := h.Quantile(.5); q != time.Microsecond {
+		t.Errorf("median is %v, expected %v", q, time.Microsecond)
+	}
+	if q := h.Quantile(.95); q < time.Millisecond || q > time.Millisecond*119/100 {
+		t.Errorf("95th percentile is %v, expected about %v", q, time.Millisecond)
+	}
+	if q := h.Quantile(0); q != time.Microsecond {
+		t.Errorf("minimum is %v, expected %v", q, time.Microsecond)
+	}
+}
+
+func TestHistogramPercentiles(t *testing.T) {
+	var h Histogram
+	// a bucket bound, so the percentiles are exact
+	h.Observe(2048 * time.Microsecond)
+
+	p := h.Percentiles()
+	if p.Count != 1 {
+		t.Errorf("count is %d, expected %d", p.Count, 1)
+	}
+	if p.P50 != 2.048 || p.P95 != 2.048 || p.P99 != 2.048 {
+		t.Errorf("percentiles are %+v, expected 2.048ms", p)
+	}
+}
+
+func TestHistogram_Concurrent(t *testing.T) {
+	var h Histogram
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h.Observe(time.Duration(j) * time.Microsecond)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if count := h.Count(); count != 1000 {
+		t.Errorf("count is %d, expected %d", count, 1000)
+	}
+}
+
+func TestOpLatencies(t *testing.T) {
+	latencies := NewOpLatencies()
+	latencies.Observe(OpPush, time.Millisecond)
+	latencies.Observe(OpPush, time.Millisecond)
+	latencies.Observe(OpPeek, time.Millisecond)
+	latencies.Observe("foo", time.Millisecond)
+
+	percentiles := latencies.Percentiles()
+	if len(percentiles) != 3 {
+		t.Errorf("percentiles are %v, expected push, pop and peek", percentiles)
+	}
+	if count := percentiles[OpPush].Count; count != 2 {
+		t.Errorf("push count is %d, expected %d", count, 2)
+	}
+	if count := percentiles[OpPop].Count; count != 0 {
+		t.Errorf("pop count is %d, expected %d", count, 0)
+	}
+	if count := percentiles[OpPeek].Count; count != 1 {
+		t.Errorf("peek count is %d, expected %d", count, 1)
+	}
+	if _, ok := percentiles["foo"]; ok {
+		t.Error("unknown operation foo was observed")
+	}
+}
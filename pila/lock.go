@@ -0,0 +1,66 @@
+package pila
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrStackLocked is returned when locking or unlocking
+// a Stack that is locked by another owner.
+var ErrStackLocked = errors.New("stack is locked")
+
+// ErrNoLockOwner is returned when locking a Stack without owner.
+var ErrNoLockOwner = errors.New("lock owner is empty")
+
+// Lock locks the Stack for owner at date t until ttl elapses, so
+// writes from other owners are rejected, see Locked. Locking a
+// Stack already locked by owner extends its lock. If it is locked
+// by another owner, ErrStackLocked is returned. The date until
+// which the Stack is locked is returned.
+func (s *Stack) Lock(owner string, ttl time.Duration, t time.Time) (time.Time, error) {
+	if owner == "" {
+		return time.Time{}, ErrNoLockOwner
+	}
+
+	s.lockMu.Lock()
+	defer s.lockMu.Unlock()
+	if s.lockOwner != "" && s.lockOwner != owner && t.Before(s.lockExpiresAt) {
+		return time.Time{}, ErrStackLocked
+	}
+	s.lockOwner = owner
+	s.lockExpiresAt = t.Add(ttl)
+	return s.lockExpiresAt, nil
+}
+
+// Unlock releases the lock of owner on the Stack at date t. Unlocking
+// a Stack that is not locked does nothing. If it is locked by another
+// owner, ErrStackLocked is returned.
+func (s *Stack) Unlock(owner string, t time.Time) error {
+	s.lockMu.Lock()
+	defer s.lockMu.Unlock()
+	if s.lockOwner != "" && s.lockOwner != owner && t.Before(s.lockExpiresAt) {
+		return ErrStackLocked
+	}
+	s.lockOwner = ""
+	s.lockExpiresAt = time.Time{}
+	return nil
+}
+
+// Locked determines whether the Stack is locked at date t by an
+// owner other than owner, so writes from owner must be rejected.
+func (s *Stack) Locked(owner string, t time.Time) bool {
+	s.lockMu.Lock()
+	defer s.lockMu.Unlock()
+	return s.lockOwner != "" && s.lockOwner != owner && t.Before(s.lockExpiresAt)
+}
+
+// LockedUntil returns the date until which the Stack is
+// locked, and false if it is not locked at date t.
+func (s *Stack) LockedUntil(t time.Time) (time.Time, bool) {
+	s.lockMu.Lock()
+	defer s.lockMu.Unlock()
+	if s.lockOwner == "" || !t.Before(s.lockExpiresAt) {
+		return time.Time{}, false
+	}
+	return s.lockExpiresAt, true
+}
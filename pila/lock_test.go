@@ -0,0 +1,69 @@
+package pila
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStackLock(t *testing.T) {
+	now := time.Now()
+	stack := NewStack("test-stack", now)
+	if stack.Locked("alice", now) {
+		t.Error("stack is locked, expected unlocked")
+	}
+	if _, ok := stack.LockedUntil(now); ok || stack.Status().LockedUntil != nil {
+		t.Error("stack has a lock, expected none")
+	}
+
+	if _, err := stack.Lock("", time.Minute, now); err != ErrNoLockOwner {
+		t.Errorf("err is %v, expected %v", err, ErrNoLockOwner)
+	}
+	until, err := stack.Lock("alice", time.Minute, now)
+	if err != nil || !until.Equal(now.Add(time.Minute)) {
+		t.Errorf("lock is %v, %v, expected %v, nil", until, err, now.Add(time.Minute))
+	}
+	if stack.Locked("alice", now) {
+		t.Error("stack is locked for its owner, expected unlocked")
+	}
+	if !stack.Locked("bob", now) || !stack.Locked("", now) {
+		t.Error("stack is unlocked for other owners, expected locked")
+	}
+	if stack.Status().LockedUntil == nil {
+		t.Error("stack status has no lock, expected one")
+	}
+
+	if _, err := stack.Lock("bob", time.Minute, now); err != ErrStackLocked {
+		t.Errorf("err is %v, expected %v", err, ErrStackLocked)
+	}
+	if err := stack.Unlock("bob", now); err != ErrStackLocked {
+		t.Errorf("err is %v, expected %v", err, ErrStackLocked)
+	}
+
+	// the owner extends its lock
+	later := now.Add(30 * time.Second)
+	if until, err := stack.Lock("alice", time.Minute, later); err != nil || !until.Equal(later.Add(time.Minute)) {
+		t.Errorf("lock is %v, %v, expected %v, nil", until, err, later.Add(time.Minute))
+	}
+
+	// an expired lock is taken by another owner
+	expired := later.Add(time.Minute)
+	if stack.Locked("bob", expired) {
+		t.Error("stack is locked after expiring, expected unlocked")
+	}
+	if _, ok := stack.LockedUntil(expired); ok {
+		t.Error("stack has a lock after expiring, expected none")
+	}
+	if _, err := stack.Lock("bob", time.Minute, expired); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+
+	if err := stack.Unlock("bob", expired); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+	if stack.Locked("alice", expired) {
+		t.Error("stack is locked after unlocking, expected unlocked")
+	}
+	if err := stack.Unlock("alice", expired); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+}
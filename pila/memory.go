@@ -0,0 +1,119 @@
+package pila
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrMemoryLimit is returned when pushing an element into a Stack
+// whose Database reached its MaxMemory.
+var ErrMemoryLimit = errors.New("memory limit of database reached")
+
+// elementOverhead is the approximate memory in bytes used by
+// a Stack to hold an element, regardless of its value.
+const elementOverhead = 32
+
+// Memory returns the approximate memory in bytes used by the
+// elements of the Stack. It is accounted on every operation
+// adding or removing elements, so it is cheap to call.
+func (s *Stack) Memory() int64 {
+	return atomic.LoadInt64(&s.memory)
+}
+
+// account adds delta bytes to the memory used by
+// the Stack and its Database, if any.
+func (s *Stack) account(delta int64) {
+	atomic.AddInt64(&s.memory, delta)
+	if db := s.Database; db != nil {
+		atomic.AddInt64(&db.memory, delta)
+	}
+}
+
+// checkMemory returns ErrMemoryLimit if pushing the elements into
+// the Stack would exceed the MaxMemory of its Database.
+func (s *Stack) checkMemory(elements ...interface{}) error {
+	db := s.Database
+	if db == nil {
+		return nil
+	}
+	max := db.MaxMemory()
+	if max <= 0 {
+		return nil
+	}
+
+	memory := db.Memory()
+	for _, element := range elements {
+		memory += elementMemory(element)
+	}
+	if memory > max {
+		return ErrMemoryLimit
+	}
+	return nil
+}
+
+// Memory returns the approximate memory in bytes used by
+// the elements of all the Stacks of the Database.
+func (db *Database) Memory() int64 {
+	return atomic.LoadInt64(&db.memory)
+}
+
+// MaxMemory returns the maximum memory in bytes that the elements
+// of the Stacks of the Database can use, 0 if unlimited.
+func (db *Database) MaxMemory() int64 {
+	return atomic.LoadInt64(&db.maxMemory)
+}
+
+// SetMaxMemory sets the maximum memory in bytes that the elements of
+// the Stacks of the Database can use, unlimited if n is not positive.
+// Once reached, pushing elements fails with ErrMemoryLimit, but the
+// elements already in the Stacks are kept.
+func (db *Database) SetMaxMemory(n int64) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt64(&db.maxMemory, n)
+}
+
+// elementMemory returns the approximate memory in bytes
+// used by an element of a Stack, as stored.
+func elementMemory(element interface{}) int64 {
+	switch e := stored(element).(type) {
+	case compressedElement:
+		return elementOverhead + int64(len(e.contentType)+len(e.data))
+	case sealedElement:
+		return elementOverhead + int64(len(e.sealed.Key)+len(e.sealed.Data))
+	}
+	value, _ := unwrap(element, time.Time{})
+	return elementOverhead + valueMemory(value)
+}
+
+// valueMemory returns the approximate memory in bytes used by a
+// value, walking the types decoded from JSON instead of encoding it.
+func valueMemory(value interface{}) int64 {
+	switch v := value.(type) {
+	case nil, bool:
+		return 1
+	case float64, int, int64:
+		return 8
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	case Binary:
+		return int64(len(v.ContentType) + len(v.Data))
+	case []interface{}:
+		var n int64
+		for _, e := range v {
+			n += 16 + valueMemory(e)
+		}
+		return n
+	case map[string]interface{}:
+		var n int64
+		for k, e := range v {
+			n += 16 + int64(len(k)) + valueMemory(e)
+		}
+		return n
+	}
+	return int64(ElementSize(value))
+}
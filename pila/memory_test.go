@@ -0,0 +1,87 @@
+package pila
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStackMemory(t *testing.T) {
+	now := time.Now()
+	db := NewDatabase("db")
+	stack := NewStack("stack", now)
+	other := NewStack("other", now)
+	_ = db.AddStack(stack)
+
+	_ = stack.Push("foo")
+	_ = stack.PushWithExpiration(map[string]interface{}{"a": []interface{}{1.0, true}}, now.Add(time.Hour))
+	_ = stack.PushWithExpiration("bar", now.Add(-time.Second))
+	_ = other.Push("baz")
+
+	expected := int64(3*elementOverhead + 3 + (16 + 1 + (16 + 8) + (16 + 1)) + 3)
+	if memory := stack.Memory(); memory != expected {
+		t.Errorf("stack memory is %d, expected %d", memory, expected)
+	}
+	if memory := db.Memory(); memory != expected {
+		t.Errorf("database memory is %d, expected %d", memory, expected)
+	}
+
+	stack.Expire(now)
+	expected -= elementOverhead + 3
+	if memory := stack.Memory(); memory != expected {
+		t.Errorf("stack memory is %d, expected %d after expiring", memory, expected)
+	}
+
+	_ = db.AddStack(other)
+	expected += elementOverhead + 3
+	if memory := db.Memory(); memory != expected {
+		t.Errorf("database memory is %d, expected %d after adding a stack", memory, expected)
+	}
+
+	stack.Pop()
+	stack.Pop()
+	if memory := stack.Memory(); memory != 0 {
+		t.Errorf("stack memory is %d, expected %d after popping", memory, 0)
+	}
+
+	_ = stack.Push("foo")
+	stack.Flush()
+	if memory := stack.Memory(); memory != 0 {
+		t.Errorf("stack memory is %d, expected %d after flushing", memory, 0)
+	}
+
+	db.RemoveStack(other.ID)
+	if memory := db.Memory(); memory != 0 {
+		t.Errorf("database memory is %d, expected %d after removing a stack", memory, 0)
+	}
+}
+
+func TestDatabaseMaxMemory(t *testing.T) {
+	db := NewDatabase("db")
+	stack := NewStack("stack", time.Now())
+	_ = db.AddStack(stack)
+	if max := db.MaxMemory(); max != 0 {
+		t.Errorf("max memory is %d, expected %d", max, 0)
+	}
+
+	db.SetMaxMemory(2*elementOverhead + 6)
+	if err := stack.Push("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := stack.PushN([]interface{}{"bar", "baz"}); err != ErrMemoryLimit {
+		t.Errorf("err is %v, expected %v", err, ErrMemoryLimit)
+	}
+	if err := stack.Push("bar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := stack.Push("baz"); err != ErrMemoryLimit {
+		t.Errorf("err is %v, expected %v", err, ErrMemoryLimit)
+	}
+	if size := stack.Size(); size != 2 {
+		t.Errorf("size is %d, expected %d", size, 2)
+	}
+
+	db.SetMaxMemory(-1)
+	if err := stack.Push("baz"); err != nil || db.MaxMemory() != 0 {
+		t.Errorf("err is %v and max memory %d, expected nil and %d", err, db.MaxMemory(), 0)
+	}
+}
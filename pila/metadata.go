@@ -0,0 +1,141 @@
+package pila
+
+import (
+	"errors"
+	"time"
+)
+
+// MaxTagSize is the maximum size in bytes of the tag of an element.
+const MaxTagSize = 128
+
+// ErrInvalidTag is returned when pushing an element with a tag
+// longer than MaxTagSize or with non-printable ASCII characters.
+var ErrInvalidTag = errors.New("invalid tag, expected up to 128 printable ASCII characters")
+
+// Metadata is the metadata stored along with every element of a Stack.
+type Metadata struct {
+	// PushedAt is the date when the element was pushed
+	PushedAt time.Time
+	// Tag is the tag given by the client pushing
+	// the element, if any, see PushOptions
+	Tag string
+}
+
+// taggedElement represents an element of a Stack along with its
+// Metadata. It wraps the value as stored, and it is wrapped by its
+// expiringElement, if it expires.
+type taggedElement struct {
+	value    interface{}
+	pushedAt int64
+	tag      string
+}
+
+// validTag returns whether tag is a valid tag of an element.
+func validTag(tag string) bool {
+	if len(tag) > MaxTagSize {
+		return false
+	}
+	for i := 0; i < len(tag); i++ {
+		if tag[i] < 0x20 || tag[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// withMetadata returns an element of a Stack, as given by push, with
+// the given Metadata, unless it already has any, e.g. because it was
+// moved from another Stack.
+func withMetadata(element interface{}, m Metadata) interface{} {
+	switch e := element.(type) {
+	case prioritizedElement:
+		e.value = withMetadata(e.value, m)
+		return e
+	case expiringElement:
+		e.value = withMetadata(e.value, m)
+		return e
+	case taggedElement:
+		return e
+	}
+	return taggedElement{value: element, pushedAt: m.PushedAt.UnixNano(), tag: m.Tag}
+}
+
+// metadata returns the Metadata of an element of a Stack.
+func metadata(element interface{}) Metadata {
+	if e, ok := element.(prioritizedElement); ok {
+		element = e.value
+	}
+	if e, ok := element.(expiringElement); ok {
+		element = e.value
+	}
+	if e, ok := element.(taggedElement); ok {
+		return Metadata{PushedAt: time.Unix(0, e.pushedAt), Tag: e.tag}
+	}
+	return Metadata{}
+}
+
+// PopWithMetadata removes and returns the element on top of the
+// Stack like Pop, along with its Metadata.
+func (s *Stack) PopWithMetadata() (interface{}, Metadata, bool) {
+	element, value, ok := s.pop()
+	if !ok {
+		return nil, Metadata{}, false
+	}
+	s.remember(element)
+	return value, metadata(element), true
+}
+
+// PeekWithMetadata returns the element on top of the Stack along with
+// its Metadata and the Version of the Stack, like PeekVersion. If tag is
+// not empty, it returns the element closest to the top of the Stack that
+// was pushed with such tag instead. It returns false if there is no
+// such element.
+func (s *Stack) PeekWithMetadata(tag string) (interface{}, Metadata, uint64, bool) {
+	now := time.Now()
+	s.Expire(now)
+
+	if tag == "" {
+		var peek interface{}
+		var found bool
+		version := s.base.Version()
+		// The condition never pops, it only reads
+		// the top of the Stack and its Version.
+		s.base.PopIf(func(element interface{}, v uint64) bool {
+			peek, found, version = element, true, v
+			return false
+		})
+		if !found {
+			return nil, Metadata{}, version, false
+		}
+		value, _ := unwrap(peek, now)
+		return value, metadata(peek), version, true
+	}
+
+	// Range starts from the last pushed element, which is the
+	// top of a stack and the bottom of a queue, and it is not
+	// ordered by priority.
+	all := s.Type == StructureQueue || s.Type == StructurePriority
+	var peek interface{}
+	var found bool
+	var max float64
+	version := s.base.Version()
+	s.base.Range(func(element interface{}) bool {
+		if !alive(element, now) || metadata(element).Tag != tag {
+			return true
+		}
+		if s.Type == StructurePriority {
+			if p := priority(element); !found || p > max {
+				peek, max = element, p
+			}
+		} else {
+			peek = element
+		}
+		found = true
+		return all
+	})
+	if !found {
+		return nil, Metadata{}, version, false
+	}
+	value, _ := unwrap(peek, now)
+	return value, metadata(peek), version, true
+}
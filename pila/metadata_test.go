@@ -0,0 +1,209 @@
+package pila
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStackPushWithOptions_Tag(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+
+	before := time.Now()
+	_ = stack.Push("foo")
+	value, m, _, ok := stack.PeekWithMetadata("")
+	if !ok || value != "foo" {
+		t.Fatalf("peek is %v, %v, expected %v, true", value, ok, "foo")
+	}
+	if m.PushedAt.Before(before) || m.PushedAt.After(time.Now()) || m.Tag != "" {
+		t.Errorf("metadata is %v, expected pushed after %v with no tag", m, before)
+	}
+
+	pushedAt := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := stack.PushWithOptions("bar", PushOptions{Tag: "client-1", PushedAt: pushedAt}); err != nil {
+		t.Fatal(err)
+	}
+	if value, m, _, _ := stack.PeekWithMetadata(""); value != "bar" || !m.PushedAt.Equal(pushedAt) || m.Tag != "client-1" {
+		t.Errorf("peek is %v, %v, expected %v, %v", value, m, "bar", Metadata{PushedAt: pushedAt, Tag: "client-1"})
+	}
+
+	for _, tag := range []string{strings.Repeat("a", MaxTagSize+1), "new\nline", "ñ"} {
+		if err := stack.PushWithOptions("baz", PushOptions{Tag: tag}); err != ErrInvalidTag {
+			t.Errorf("err is %v, expected %v for %q", err, ErrInvalidTag, tag)
+		}
+	}
+	if stack.Size() != 2 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 2)
+	}
+}
+
+func TestStackPopWithMetadata(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+	if value, m, ok := stack.PopWithMetadata(); ok {
+		t.Errorf("pop is %v, %v, expected none", value, m)
+	}
+
+	_ = stack.PushWithOptions("foo", PushOptions{Tag: "a", ExpiresAt: time.Now().Add(time.Hour)})
+	_ = stack.PushWithOptions("bar", PushOptions{Tag: "b"})
+	if value, m, ok := stack.PopWithMetadata(); !ok || value != "bar" || m.Tag != "b" {
+		t.Errorf("pop is %v, %v, %v, expected %v with tag %v", value, m, ok, "bar", "b")
+	}
+	if value, m, ok := stack.PopWithMetadata(); !ok || value != "foo" || m.Tag != "a" {
+		t.Errorf("pop is %v, %v, %v, expected %v with tag %v", value, m, ok, "foo", "a")
+	}
+}
+
+func TestStackPeekWithMetadata_Tag(t *testing.T) {
+	low, high, other := 1.0, 3.0, 5.0
+	priority := NewPriority("test-priority", time.Now())
+	_ = priority.PushWithOptions("low", PushOptions{Tag: "a", Priority: &low})
+	_ = priority.PushWithOptions("high", PushOptions{Tag: "a", Priority: &high})
+	_ = priority.PushWithOptions("other", PushOptions{Tag: "b", Priority: &other})
+
+	inputOutput := []struct {
+		stack  *Stack
+		tag    string
+		output interface{}
+		found  bool
+	}{
+		{NewStack("test-stack", time.Now()), "a", "foo2", true},
+		{NewStack("test-stack", time.Now()), "b", "bar", true},
+		{NewStack("test-stack", time.Now()), "c", nil, false},
+		{NewStack("test-stack", time.Now()), "", "bar", true},
+		{NewQueue("test-queue", time.Now()), "a", "foo1", true},
+		{NewQueue("test-queue", time.Now()), "", "foo1", true},
+		{priority, "a", "high", true},
+		{priority, "", "other", true},
+	}
+
+	for _, io := range inputOutput {
+		if io.stack.Type != StructurePriority && io.stack.Size() == 0 {
+			_ = io.stack.PushWithOptions("foo1", PushOptions{Tag: "a"})
+			_ = io.stack.PushWithOptions("foo2", PushOptions{Tag: "a"})
+			_ = io.stack.PushWithOptions("expired", PushOptions{Tag: "a", ExpiresAt: time.Now().Add(-time.Second)})
+			_ = io.stack.PushWithOptions("bar", PushOptions{Tag: "b"})
+		}
+
+		value, m, _, found := io.stack.PeekWithMetadata(io.tag)
+		if value != io.output || found != io.found {
+			t.Errorf("%s peek of tag %q is %v, %v, expected %v, %v", io.stack.Type, io.tag, value, found, io.output, io.found)
+		}
+		if found && io.tag != "" && m.Tag != io.tag {
+			t.Errorf("tag is %q, expected %q", m.Tag, io.tag)
+		}
+	}
+}
+
+func TestStackMetadata_Stored(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keys := NewKeyring()
+	_ = keys.Add("a", bytes.Repeat([]byte{1}, 32))
+
+	compressed := NewStack("compressed", time.Now())
+	compressed.SetCompress(1)
+	encrypted := NewStack("encrypted", time.Now())
+	if err := encrypted.SetEncryption(keys); err != nil {
+		t.Fatal(err)
+	}
+	spill, err := NewSpillStack("spill", time.Now(), dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.close()
+
+	pushedAt := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	long := strings.Repeat("foo", 100)
+	for _, stack := range []*Stack{compressed, encrypted, spill} {
+		_ = stack.PushWithOptions(long, PushOptions{Tag: "a", PushedAt: pushedAt})
+		_ = stack.Push("bar")
+
+		if value, ok := stack.Pop(); !ok || value != "bar" {
+			t.Errorf("%s pop is %v, expected %v", stack.Name, value, "bar")
+		}
+		value, m, ok := stack.PopWithMetadata()
+		if !ok || value != long || m.Tag != "a" || !m.PushedAt.Equal(pushedAt) {
+			t.Errorf("%s pop has metadata %v, expected %v", stack.Name, m, Metadata{PushedAt: pushedAt, Tag: "a"})
+		}
+	}
+}
+
+func TestStackMetadata_PopPush(t *testing.T) {
+	src := NewStack("src", time.Now())
+	dst := NewStack("dst", time.Now())
+	pushedAt := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	_ = src.PushWithOptions("foo", PushOptions{Tag: "a", PushedAt: pushedAt})
+
+	if _, err := src.PopPush(dst); err != nil {
+		t.Fatal(err)
+	}
+	if _, m, _, _ := dst.PeekWithMetadata(""); m.Tag != "a" || !m.PushedAt.Equal(pushedAt) {
+		t.Errorf("metadata is %v, expected %v", m, Metadata{PushedAt: pushedAt, Tag: "a"})
+	}
+}
+
+func TestPilaSnapshotRestore_Metadata(t *testing.T) {
+	pila := NewPila()
+	db := NewDatabase("db")
+	_ = pila.AddDatabase(db)
+	s := NewStack("s", time.Now())
+	_ = db.AddStack(s)
+
+	pushedAt := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	_ = s.PushWithOptions("foo", PushOptions{Tag: "a", PushedAt: pushedAt})
+	_ = s.PushWithOptions("bar", PushOptions{PushedAt: pushedAt.Add(time.Second)})
+
+	var buf bytes.Buffer
+	if err := pila.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewPila()
+	if err := loaded.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	ls := loaded.Databases[db.ID].Stacks[s.ID]
+	if value, m, ok := ls.PopWithMetadata(); !ok || value != "bar" || m.Tag != "" || !m.PushedAt.Equal(pushedAt.Add(time.Second)) {
+		t.Errorf("pop is %v, %v, expected %v pushed at %v", value, m, "bar", pushedAt.Add(time.Second))
+	}
+	if value, m, ok := ls.PopWithMetadata(); !ok || value != "foo" || m.Tag != "a" || !m.PushedAt.Equal(pushedAt) {
+		t.Errorf("pop is %v, %v, expected %v pushed at %v with tag %v", value, m, "foo", pushedAt, "a")
+	}
+}
+
+func TestElementWithMetadata(t *testing.T) {
+	pushedAt := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	element := NewElement("foo").WithMetadata(Metadata{PushedAt: pushedAt, Tag: "a"})
+
+	expected := `{"element":"foo","pushed_at":"2016-01-02T03:04:05Z","tag":"a"}`
+	b, err := element.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != expected {
+		t.Errorf("json is %s, expected %s", b, expected)
+	}
+
+	var decoded Element
+	if err := decoded.Decode(strings.NewReader(`{"element":"foo","tag":"a"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Tag != "a" {
+		t.Errorf("tag is %q, expected %q", decoded.Tag, "a")
+	}
+	var buf bytes.Buffer
+	decoded.PushedAt = element.PushedAt
+	if err := decoded.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("json is %s, expected %s", buf.String(), expected)
+	}
+}
@@ -0,0 +1,66 @@
+package pila
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteMetrics writes the metrics of the Pila into w, in the Prometheus
+// text exposition format: the number of Databases, and the size and the
+// number of PUSH and POP operations of every Stack, labeled by Database
+// and Stack names.
+func (p *Pila) WriteMetrics(w io.Writer) error {
+	type dbStack struct {
+		database string
+		stack    *Stack
+	}
+
+	var databases int
+	var stacks []dbStack
+	p.ForEachDatabase(func(db *Database) bool {
+		databases++
+		db.ForEachStack(func(s *Stack) bool {
+			stacks = append(stacks, dbStack{db.Name, s})
+			return true
+		})
+		return true
+	})
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# HELP piladb_databases Number of databases.")
+	fmt.Fprintln(bw, "# TYPE piladb_databases gauge")
+	fmt.Fprintln(bw, "piladb_databases", databases)
+
+	metrics := []struct {
+		name, help, kind string
+		value            func(s *Stack) int64
+	}{
+		{"piladb_stack_size", "Number of elements of a stack.", "gauge",
+			func(s *Stack) int64 { return int64(s.SizeApprox()) }},
+		{"piladb_stack_pushes_total", "Number of elements pushed into a stack.", "counter",
+			(*Stack).Pushes},
+		{"piladb_stack_pops_total", "Number of elements popped from a stack.", "counter",
+			(*Stack).Pops},
+	}
+	for _, m := range metrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.kind)
+		for _, s := range stacks {
+			fmt.Fprintf(bw, "%s{database=\"%s\",stack=\"%s\"} %d\n",
+				m.name, escapeLabel(s.database), escapeLabel(s.stack.Name), m.value(s.stack))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// labelReplacer escapes the characters of a label value
+// in the Prometheus text exposition format.
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value.
+func escapeLabel(value string) string {
+	return labelReplacer.Replace(value)
+}
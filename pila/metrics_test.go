@@ -0,0 +1,63 @@
+package pila
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPilaWriteMetrics(t *testing.T) {
+	p := NewPila()
+	db := NewDatabase("db")
+	_ = p.AddDatabase(db)
+	_ = p.AddDatabase(NewDatabase("empty"))
+
+	s0 := NewStack("s0", time.Now())
+	s1 := NewStack(`"s\1"`, time.Now())
+	_ = db.AddStack(s0)
+	_ = db.AddStack(s1)
+	_ = s0.Push("foo")
+	_ = s0.Push("bar")
+	s0.Pop()
+	_ = s1.Push(8)
+
+	var b bytes.Buffer
+	if err := p.WriteMetrics(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP piladb_databases Number of databases.
+# TYPE piladb_databases gauge
+piladb_databases 2
+# HELP piladb_stack_size Number of elements of a stack.
+# TYPE piladb_stack_size gauge
+piladb_stack_size{database="db",stack="\"s\\1\""} 1
+piladb_stack_size{database="db",stack="s0"} 1
+# HELP piladb_stack_pushes_total Number of elements pushed into a stack.
+# TYPE piladb_stack_pushes_total counter
+piladb_stack_pushes_total{database="db",stack="\"s\\1\""} 1
+piladb_stack_pushes_total{database="db",stack="s0"} 2
+# HELP piladb_stack_pops_total Number of elements popped from a stack.
+# TYPE piladb_stack_pops_total counter
+piladb_stack_pops_total{database="db",stack="\"s\\1\""} 0
+piladb_stack_pops_total{database="db",stack="s0"} 1
+`
+	if b.String() != expected {
+		t.Errorf("metrics are\n%s\nexpected\n%s", b.String(), expected)
+	}
+}
+
+func TestStackPushesPops(t *testing.T) {
+	stack := NewStackWithLimit("stack", time.Now(), 1, OverflowDropOldest)
+	_ = stack.Push("foo")
+	_ = stack.Push("bar")
+	stack.Pop()
+	stack.Pop()
+
+	if pushes := stack.Pushes(); pushes != 2 {
+		t.Errorf("pushes are %d, expected %d", pushes, 2)
+	}
+	if pops := stack.Pops(); pops != 1 {
+		t.Errorf("pops are %d, expected %d", pops, 1)
+	}
+}
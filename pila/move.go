@@ -0,0 +1,138 @@
+package pila
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSameStack is returned when moving or copying
+// the elements of a Stack into itself.
+var ErrSameStack = errors.New("source and destination are the same stack")
+
+// ErrEmptyStack is returned when popping an element
+// to be pushed into another Stack from an empty Stack.
+var ErrEmptyStack = errors.New("stack is empty")
+
+// MoveTo removes up to n elements from the top of the Stack and pushes
+// them into dst, so they are popped from dst in the same order they
+// would have been popped from the Stack. Expiration dates and priorities
+// of the elements are kept. If the elements can not be pushed into dst,
+// none of them is moved and the error of PushN is returned. It returns
+// the moved elements, the top one first.
+//
+// Like Transactions, MoveTo is not isolated from operations executed
+// concurrently on any of the Stacks.
+func (s *Stack) MoveTo(dst *Stack, n int) ([]interface{}, error) {
+	if s == dst {
+		return nil, ErrSameStack
+	}
+
+	popped := make([]interface{}, 0)
+	values := make([]interface{}, 0)
+	for len(popped) < n {
+		element, value, ok := s.pop()
+		if !ok {
+			break
+		}
+		popped = append(popped, element)
+		values = append(values, value)
+	}
+
+	if err := s.transfer(dst, popped); err != nil {
+		for i := len(popped) - 1; i >= 0; i-- {
+			s.undoPop(popped[i])
+		}
+		return nil, err
+	}
+	return values, nil
+}
+
+// CopyTo pushes up to n elements from the top of the Stack into dst,
+// like MoveTo, without removing them from the Stack. It returns the
+// copied elements, the top one first.
+func (s *Stack) CopyTo(dst *Stack, n int) ([]interface{}, error) {
+	if s == dst {
+		return nil, ErrSameStack
+	}
+
+	now := time.Now()
+	s.Expire(now)
+
+	copied := make([]interface{}, 0)
+	values := make([]interface{}, 0)
+	for _, element := range s.base.Slice(0, n) {
+		if value, alive := unwrap(element, now); alive {
+			copied = append(copied, element)
+			values = append(values, value)
+		}
+	}
+
+	if err := s.transfer(dst, copied); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// PopPush removes the element on top of the Stack and pushes it into
+// dst as a single operation, keeping its expiration date and priority.
+// If the Stack is empty, ErrEmptyStack is returned. If the element can
+// not be pushed into dst, it is put back on top of the Stack and the
+// error of PushN is returned. It returns the transferred element.
+//
+// Both Stacks stay locked during the operation, so PopPush operations
+// involving any of them are serialized, and the element can not be lost
+// in between. They are still not isolated from other operations.
+func (s *Stack) PopPush(dst *Stack) (interface{}, error) {
+	if s == dst {
+		return nil, ErrSameStack
+	}
+	defer lockPair(s, dst)()
+
+	element, value, ok := s.pop()
+	if !ok {
+		return nil, ErrEmptyStack
+	}
+	if err := s.transfer(dst, []interface{}{element}); err != nil {
+		s.undoPop(element)
+		return nil, err
+	}
+	return value, nil
+}
+
+// lockPair locks two different Stacks for a PopPush operation, always
+// in the order of their IDs, so concurrent operations locking the same
+// Stacks do not deadlock. It returns the function unlocking them.
+func lockPair(a, b *Stack) func() {
+	if b.ID.String() < a.ID.String() {
+		a, b = b, a
+	}
+	a.popPushMu.Lock()
+	b.popPushMu.Lock()
+	return func() {
+		b.popPushMu.Unlock()
+		a.popPushMu.Unlock()
+	}
+}
+
+// transfer pushes elements of the Stack, as stored and in the order
+// they are popped from it, into dst, keeping such order.
+func (s *Stack) transfer(dst *Stack, elements []interface{}) error {
+	if len(elements) == 0 {
+		return nil
+	}
+
+	ordered := make([]interface{}, len(elements))
+	copy(ordered, elements)
+	if dst.Type == StructureStack {
+		// the last pushed element is the first popped one
+		for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+			ordered[i], ordered[j] = ordered[j], ordered[i]
+		}
+	}
+
+	if s.hasExpiring() {
+		atomic.StoreInt32(&dst.expiring, 1)
+	}
+	return dst.pushN(ordered)
+}
@@ -0,0 +1,160 @@
+package pila
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStackMoveTo(t *testing.T) {
+	now := time.Now()
+	src := NewStack("src", now)
+	_ = src.Push("foo")
+	_ = src.PushWithExpiration("bar", now.Add(time.Hour))
+	_ = src.Push("baz")
+
+	stack := NewStack("stack", now)
+	queue := NewQueue("queue", now)
+	full := NewStackWithLimit("full", now, 1, OverflowReject)
+
+	if _, err := src.MoveTo(src, 1); err != ErrSameStack {
+		t.Errorf("err is %v, expected %v", err, ErrSameStack)
+	}
+
+	if _, err := src.MoveTo(full, 2); err != ErrStackFull {
+		t.Errorf("err is %v, expected %v", err, ErrStackFull)
+	}
+	if elements := src.Elements(0, 10); !reflect.DeepEqual(elements, []interface{}{"baz", "bar", "foo"}) {
+		t.Errorf("src has elements %v, expected %v after rollback", elements, []interface{}{"baz", "bar", "foo"})
+	}
+
+	moved, err := src.MoveTo(stack, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(moved, []interface{}{"baz", "bar"}) {
+		t.Errorf("moved elements are %v, expected %v", moved, []interface{}{"baz", "bar"})
+	}
+	if elements := stack.Elements(0, 10); !reflect.DeepEqual(elements, moved) {
+		t.Errorf("stack has elements %v, expected %v", elements, moved)
+	}
+	if !stack.hasExpiring() {
+		t.Error("stack has no expiring elements, expected the moved one")
+	}
+
+	moved, err = stack.MoveTo(queue, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elements := queue.Elements(0, 10); !reflect.DeepEqual(elements, moved) || len(moved) != 2 {
+		t.Errorf("queue has elements %v, expected %v", elements, moved)
+	}
+	if stack.Size() != 0 || src.Size() != 1 {
+		t.Errorf("stacks have sizes %d and %d, expected %d and %d", stack.Size(), src.Size(), 0, 1)
+	}
+}
+
+func TestStackCopyTo(t *testing.T) {
+	now := time.Now()
+	src := NewQueue("src", now)
+	_ = src.Push("foo")
+	_ = src.PushWithExpiration("bar", now.Add(-time.Second))
+	_ = src.Push("baz")
+	dst := NewStack("dst", now)
+	_ = dst.Push(1)
+
+	if _, err := src.CopyTo(src, 1); err != ErrSameStack {
+		t.Errorf("err is %v, expected %v", err, ErrSameStack)
+	}
+
+	copied, err := src.CopyTo(dst, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(copied, []interface{}{"foo", "baz"}) {
+		t.Errorf("copied elements are %v, expected %v", copied, []interface{}{"foo", "baz"})
+	}
+	if elements := dst.Elements(0, 10); !reflect.DeepEqual(elements, []interface{}{"foo", "baz", 1}) {
+		t.Errorf("dst has elements %v, expected %v", elements, []interface{}{"foo", "baz", 1})
+	}
+	if elements := src.Elements(0, 10); !reflect.DeepEqual(elements, copied) {
+		t.Errorf("src has elements %v, expected %v", elements, copied)
+	}
+
+	dst.SetMaxElementSize(1)
+	if _, err := src.CopyTo(dst, 1); err != ErrElementTooLarge {
+		t.Errorf("err is %v, expected %v", err, ErrElementTooLarge)
+	}
+}
+
+func TestStackPopPush(t *testing.T) {
+	now := time.Now()
+	src := NewQueue("src", now)
+	_ = src.Push("foo")
+	_ = src.PushWithExpiration("bar", now.Add(time.Hour))
+	dst := NewStack("dst", now)
+	_ = dst.Push(1)
+	full := NewStackWithLimit("full", now, 1, OverflowReject)
+	_ = full.Push(2)
+
+	if _, err := src.PopPush(src); err != ErrSameStack {
+		t.Errorf("err is %v, expected %v", err, ErrSameStack)
+	}
+
+	if _, err := src.PopPush(full); err != ErrStackFull {
+		t.Errorf("err is %v, expected %v", err, ErrStackFull)
+	}
+	if elements := src.Elements(0, 10); !reflect.DeepEqual(elements, []interface{}{"foo", "bar"}) {
+		t.Errorf("src has elements %v, expected %v after rollback", elements, []interface{}{"foo", "bar"})
+	}
+
+	for _, expected := range []interface{}{"foo", "bar"} {
+		element, err := src.PopPush(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if element != expected {
+			t.Errorf("element is %v, expected %v", element, expected)
+		}
+	}
+	if elements := dst.Elements(0, 10); !reflect.DeepEqual(elements, []interface{}{"bar", "foo", 1}) {
+		t.Errorf("dst has elements %v, expected %v", elements, []interface{}{"bar", "foo", 1})
+	}
+	if !dst.hasExpiring() {
+		t.Error("dst has no expiring elements, expected the transferred one")
+	}
+
+	if _, err := src.PopPush(dst); err != ErrEmptyStack {
+		t.Errorf("err is %v, expected %v", err, ErrEmptyStack)
+	}
+	if src.Size() != 0 || dst.Size() != 3 {
+		t.Errorf("stacks have sizes %d and %d, expected %d and %d", src.Size(), dst.Size(), 0, 3)
+	}
+}
+
+func TestStackPopPush_Concurrent(t *testing.T) {
+	now := time.Now()
+	a := NewStack("a", now)
+	b := NewStack("b", now)
+	for i := 0; i < 100; i++ {
+		_ = a.Push(i)
+		_ = b.Push(i)
+	}
+
+	var wg sync.WaitGroup
+	for _, pair := range [][2]*Stack{{a, b}, {b, a}} {
+		wg.Add(1)
+		go func(src, dst *Stack) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				_, _ = src.PopPush(dst)
+			}
+		}(pair[0], pair[1])
+	}
+	wg.Wait()
+
+	if size := a.Size() + b.Size(); size != 200 {
+		t.Errorf("stacks have %d elements, expected %d", size, 200)
+	}
+}
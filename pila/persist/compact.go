@@ -0,0 +1,165 @@
+package persist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+const (
+	// snapshotFileName is the name of the snapshot of the
+	// Pila inside the persistence directory, which contains
+	// the Records compacted so far.
+	snapshotFileName = "pila.snapshot"
+	// compactingFileName is the name of the log file being
+	// compacted, which is no longer appended to.
+	compactingFileName = "pila.log.compacting"
+)
+
+// Compaction describes the compaction of a Log.
+type Compaction struct {
+	// Records is the number of Records compacted
+	Records int `json:"records"`
+	// Size is the size in bytes of the compacted Records
+	Size int64 `json:"size"`
+	// SnapshotSize is the size in bytes of the resulting snapshot
+	SnapshotSize int64 `json:"snapshot_size"`
+	// Duration is the time taken by the compaction, in seconds
+	Duration float64 `json:"duration"`
+}
+
+// Compact rewrites the Records of the Log as a snapshot of the Pila
+// they result in, so the Log does not grow unbounded, and returns the
+// Compaction. The log file is rotated first, so Records are appended
+// to a new one meanwhile, and the snapshot is built from the previous
+// one and the rotated log file, apart from the Pila being served, so
+// Append is never blocked. keys are the Keyring of the Pila, if it has
+// encrypted Stacks. Only one compaction runs at a time.
+//
+// If a compaction fails or the process stops meanwhile, the next
+// compaction or Replay completes it.
+func (l *Log) Compact(keys *pila.Keyring) (Compaction, error) {
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+
+	start := time.Now()
+	if err := l.recover(keys); err != nil {
+		return Compaction{}, err
+	}
+	compaction, err := l.rotate()
+	if err != nil {
+		return compaction, err
+	}
+	if compaction.SnapshotSize, err = l.compact(keys); err != nil {
+		return compaction, err
+	}
+	compaction.Duration = time.Since(start).Seconds()
+	return compaction, nil
+}
+
+// rotate renames the log file as the one being compacted, and opens
+// a new one to append the next Records to. It returns the Compaction
+// of the rotated log file.
+func (l *Log) rotate() (Compaction, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.f.Sync(); err != nil {
+		return Compaction{}, err
+	}
+	path := filepath.Join(l.Dir, logFileName)
+	if err := os.Rename(path, filepath.Join(l.Dir, compactingFileName)); err != nil {
+		return Compaction{}, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return Compaction{}, err
+	}
+	l.f.Close()
+
+	compaction := Compaction{Records: l.records, Size: l.size}
+	l.f = f
+	l.size, l.records = 0, 0
+	return compaction, nil
+}
+
+// compact writes a new snapshot resulting from replaying the log file
+// being compacted on top of the current snapshot, and removes the
+// log file. It returns the size in bytes of the new snapshot.
+func (l *Log) compact(keys *pila.Keyring) (int64, error) {
+	spillDir, err := ioutil.TempDir(l.Dir, "compact")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(spillDir)
+
+	// Spilling Stacks are loaded into spillDir, so the
+	// snapshot keeps them apart from the served ones.
+	p := pila.NewPila()
+	p.SetKeyring(keys)
+	p.SetSpillDir(spillDir)
+	defer func() {
+		for _, db := range p.Databases {
+			p.RemoveDatabase(db.ID)
+		}
+	}()
+
+	snapshot := filepath.Join(l.Dir, snapshotFileName)
+	if err := p.Load(snapshot); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if _, err := replayFile(filepath.Join(l.Dir, compactingFileName), p); err != nil {
+		return 0, err
+	}
+
+	tmp := snapshot + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	if err := p.Snapshot(f); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+
+	// Once the log file is removed, the complete temporary
+	// snapshot is the one to keep, see recover.
+	if err := os.Remove(filepath.Join(l.Dir, compactingFileName)); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, snapshot); err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(snapshot)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// recover completes a compaction of the Log that was interrupted: if
+// the log file being compacted still exists, it is compacted again,
+// and otherwise the temporary snapshot, if any, is complete and kept.
+func (l *Log) recover(keys *pila.Keyring) error {
+	snapshot := filepath.Join(l.Dir, snapshotFileName)
+	if _, err := os.Stat(filepath.Join(l.Dir, compactingFileName)); err == nil {
+		os.Remove(snapshot + ".tmp")
+		_, err := l.compact(keys)
+		return err
+	}
+	if err := os.Rename(snapshot+".tmp", snapshot); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package persist
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// appendRecords appends records to l, failing the test on error.
+func appendRecords(t *testing.T, l *Log, records []Record) {
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// replayed returns the elements of the stack of database
+// db of the Pila resulting from replaying the Log in dir.
+func replayed(t *testing.T, dir string) []interface{} {
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+	db, ok := p.DatabaseByName("db")
+	if !ok {
+		t.Fatal("database db not found")
+	}
+	stack, ok := db.StackByName("stack")
+	if !ok {
+		t.Fatal("stack not found")
+	}
+	return stack.Elements(0, 10)
+}
+
+func TestLogCompact(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, l, []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "foo"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "bar"},
+		{Op: OpPop, Time: now, Database: "db", Stack: "stack"},
+	})
+	size := l.Size()
+	if l.Records() != 5 || size == 0 {
+		t.Errorf("log has %d records of %d bytes, expected %d records", l.Records(), size, 5)
+	}
+
+	compaction, err := l.Compact(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compaction.Records != 5 || compaction.Size != size || compaction.SnapshotSize == 0 {
+		t.Errorf("compaction is %+v, expected 5 records of %d bytes", compaction, size)
+	}
+	if l.Records() != 0 || l.Size() != 0 {
+		t.Errorf("log has %d records of %d bytes, expected none", l.Records(), l.Size())
+	}
+
+	// the records are appended after the snapshot
+	appendRecords(t, l, []Record{
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "baz"},
+	})
+	if _, err := l.Compact(nil); err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, l, []Record{
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: 42},
+	})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if elements, expected := replayed(t, dir), []interface{}{42.0, "baz", "foo"}; !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 2 {
+		t.Errorf("files are %v, expected the log file and the snapshot", files)
+	}
+}
+
+func TestLogReplay_InterruptedCompaction(t *testing.T) {
+	now := time.Now()
+	for _, interrupted := range []string{"rotated", "written"} {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+
+		l, err := Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendRecords(t, l, []Record{
+			{Op: OpCreateDatabase, Time: now, Database: "db"},
+			{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack"},
+			{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "foo"},
+		})
+		if _, err := l.rotate(); err != nil {
+			t.Fatal(err)
+		}
+		appendRecords(t, l, []Record{
+			{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "bar"},
+		})
+		if interrupted == "written" {
+			// the snapshot is written but not renamed
+			if _, err := l.compact(nil); err != nil {
+				t.Fatal(err)
+			}
+			snapshot := filepath.Join(dir, snapshotFileName)
+			if err := os.Rename(snapshot, snapshot+".tmp"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		l.Close()
+
+		if elements, expected := replayed(t, dir), []interface{}{"bar", "foo"}; !reflect.DeepEqual(elements, expected) {
+			t.Errorf("elements are %v, expected %v when %s", elements, expected, interrupted)
+		}
+		if _, err := os.Stat(filepath.Join(dir, compactingFileName)); !os.IsNotExist(err) {
+			t.Errorf("log file being compacted exists when %s", interrupted)
+		}
+	}
+}
+
+func TestLogCompact_Encrypted(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	keys := pila.NewKeyring()
+	_ = keys.Add("a", make([]byte, 32))
+	now := time.Now()
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := keys.Seal("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, l, []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack", Encrypted: true},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Sealed: &sealed},
+	})
+	if _, err := l.Compact(nil); err == nil {
+		t.Error("err is nil, expected error without keys")
+	}
+	if _, err := l.Compact(keys); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	l, _ = Open(dir)
+	defer l.Close()
+	p := pila.NewPila()
+	p.SetKeyring(keys)
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+	db, _ := p.DatabaseByName("db")
+	stack, _ := db.StackByName("stack")
+	if peek := stack.Peek(); peek != "secret" {
+		t.Errorf("peek is %v, expected %v", peek, "secret")
+	}
+}
@@ -0,0 +1,477 @@
+// Package persist provides an append-only log that records every
+// operation that modifies a Pila, so its content can be restored by
+// replaying the log.
+package persist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/uuid"
+)
+
+// logFileName is the name of the log file inside
+// the persistence directory.
+const logFileName = "pila.log"
+
+// Op is an operation recorded in the Log.
+type Op string
+
+const (
+	// OpCreateDatabase records the creation of a Database.
+	OpCreateDatabase Op = "CREATE_DATABASE"
+	// OpDeleteDatabase records the deletion of a Database.
+	OpDeleteDatabase Op = "DELETE_DATABASE"
+	// OpRenameDatabase records the renaming of a Database.
+	OpRenameDatabase Op = "RENAME_DATABASE"
+	// OpCreateStack records the creation of a Stack.
+	OpCreateStack Op = "CREATE_STACK"
+	// OpDeleteStack records the deletion of a Stack.
+	OpDeleteStack Op = "DELETE_STACK"
+	// OpRenameStack records the renaming of a Stack.
+	OpRenameStack Op = "RENAME_STACK"
+	// OpPush records a PUSH operation on a Stack.
+	OpPush Op = "PUSH"
+	// OpPop records a POP operation on a Stack.
+	OpPop Op = "POP"
+	// OpFlush records a FLUSH operation on a Stack.
+	OpFlush Op = "FLUSH"
+	// OpRotate records a ROTATE operation on a Stack.
+	OpRotate Op = "ROTATE"
+	// OpSweep records a SWEEP operation on a Stack.
+	OpSweep Op = "SWEEP"
+	// OpReverse records a REVERSE operation on a Stack.
+	OpReverse Op = "REVERSE"
+	// OpSort records a SORT operation on a Stack.
+	OpSort Op = "SORT"
+	// OpMove records the move of elements from a Stack to another.
+	OpMove Op = "MOVE"
+	// OpCopy records the copy of elements from a Stack to another.
+	OpCopy Op = "COPY"
+	// OpUndo records the undoing of the last POP operation on a Stack.
+	OpUndo Op = "UNDO"
+	// OpSetWatermarks records the change of the Watermarks of a Stack.
+	OpSetWatermarks Op = "SET_WATERMARKS"
+	// OpSetWindow records the change of the Window of a Stack.
+	OpSetWindow Op = "SET_WINDOW"
+	// OpTransferStack records the transfer of a Stack
+	// to another Database.
+	OpTransferStack Op = "TRANSFER_STACK"
+	// OpRestore records the replacement of the whole
+	// content of the Pila by a snapshot.
+	OpRestore Op = "RESTORE"
+)
+
+// Record is an entry of the Log. Databases and Stacks are
+// identified by name.
+type Record struct {
+	Op       Op          `json:"op"`
+	Time     time.Time   `json:"time"`
+	Database string      `json:"database"`
+	Stack    string      `json:"stack,omitempty"`
+	Element  interface{} `json:"element,omitempty"`
+	// Name is the new name of a renamed Database or Stack
+	Name string `json:"name,omitempty"`
+	// ExpiresAt is the expiration date of a pushed element, if any
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Priority is the priority of a pushed element, if any
+	Priority *float64 `json:"priority,omitempty"`
+	// ContentType is the content type of a pushed Binary
+	// element, whose data is encoded in base64
+	ContentType string `json:"content_type,omitempty"`
+	// Tag is the tag of a pushed element, if any
+	Tag string `json:"tag,omitempty"`
+	// Type is the Structure of a created Stack
+	Type pila.Structure `json:"type,omitempty"`
+	// MaxSize and Policy are the limit of a created Stack, if any
+	MaxSize int                 `json:"max_size,omitempty"`
+	Policy  pila.OverflowPolicy `json:"policy,omitempty"`
+	// RateLimit is the requests per second limit
+	// of a created Stack, if overridden
+	RateLimit int `json:"rate_limit,omitempty"`
+	// TTL is the time to live of the elements
+	// of a created Stack, if any
+	TTL time.Duration `json:"ttl,omitempty"`
+	// Spill is the number of elements kept in memory by a created
+	// Stack spilling to disk, or by default by the Stacks of a
+	// created Database, if any
+	Spill int `json:"spill,omitempty"`
+	// Store is the name of the Store of a created Stack,
+	// if other than the pila.StoreMemory
+	Store string `json:"store,omitempty"`
+	// Unique is the UniquePolicy of a created Stack, if any
+	Unique pila.UniquePolicy `json:"unique,omitempty"`
+	// History is the number of popped elements kept
+	// by a created Stack, if any
+	History int `json:"history,omitempty"`
+	// Compress is the minimum size in bytes of the elements
+	// stored compressed by a created Stack, if any
+	Compress int `json:"compress,omitempty"`
+	// Encrypted tells whether a created Stack
+	// stores its elements encrypted
+	Encrypted bool `json:"encrypted,omitempty"`
+	// Sealed is a pushed element of an encrypted Stack,
+	// instead of Element and ContentType
+	Sealed *pila.Sealed `json:"sealed,omitempty"`
+	// Watermarks are the Watermarks of a created Stack, if
+	// any, or the ones set on a Stack, nil if removed
+	Watermarks *pila.Watermarks `json:"watermarks,omitempty"`
+	// Window is the Window set on a Stack, nil if removed
+	Window *pila.Window `json:"window,omitempty"`
+	// ToDatabase and ToStack are the destination of moved
+	// or copied elements, and Count their number. ToDatabase
+	// is also the destination of a transferred Stack
+	ToDatabase string `json:"to_database,omitempty"`
+	ToStack    string `json:"to_stack,omitempty"`
+	Count      int    `json:"count,omitempty"`
+	// By and Order are the field and the order
+	// the elements of a sorted Stack are sorted by
+	By    string         `json:"by,omitempty"`
+	Order pila.SortOrder `json:"order,omitempty"`
+	// MaxMemory is the memory limit of a created Database, if any
+	MaxMemory int64 `json:"max_memory,omitempty"`
+	// ID is the ID of a created Database or Stack
+	ID string `json:"id,omitempty"`
+	// Snapshot is the snapshot of a restored Pila,
+	// as written by pila.Pila.Snapshot
+	Snapshot json.RawMessage `json:"snapshot,omitempty"`
+}
+
+// Log is an append-only log of Records stored in a directory, which
+// is compacted into a snapshot of the Pila, see Compact.
+type Log struct {
+	// Dir is the directory containing the log file
+	Dir string
+
+	// size and records are the size in bytes and the number
+	// of Records of the log file, i.e. since the last compaction
+	size    int64
+	records int
+
+	// mu protects the log file, size and records
+	mu sync.Mutex
+	f  *os.File
+
+	// compactMu is held while compacting the Log
+	compactMu sync.Mutex
+}
+
+// Open opens the Log stored in dir, creating the directory and the
+// log file if they do not exist. New Records are appended to the
+// existing ones.
+func Open(dir string) (*Log, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &Log{
+		Dir:  dir,
+		size: info.Size(),
+		f:    f,
+	}, nil
+}
+
+// Append writes a Record at the end of the Log.
+func (l *Log) Append(record Record) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n, err := l.f.Write(append(b, '\n'))
+	l.size += int64(n)
+	if err == nil {
+		l.records++
+	}
+	return err
+}
+
+// Size returns the size in bytes of the Records
+// appended to the Log since it was last compacted.
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
+
+// Records returns the number of Records appended to
+// the Log since it was last compacted.
+func (l *Log) Records() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.records
+}
+
+// Close syncs and closes the Log.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.f.Sync(); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+// Replay loads the snapshot of the Log into a Pila, if it was ever
+// compacted, and applies all the Records appended since then, in the
+// same order they were appended. A truncated last Record, caused by
+// an interrupted write, is ignored. A compaction that was interrupted
+// is completed first, using the Keyring of the Pila.
+func (l *Log) Replay(p *pila.Pila) error {
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+
+	if err := l.recover(p.Keyring()); err != nil {
+		return err
+	}
+	if err := p.Load(filepath.Join(l.Dir, snapshotFileName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	records, err := replayFile(filepath.Join(l.Dir, logFileName), p)
+	l.mu.Lock()
+	l.records = records
+	l.mu.Unlock()
+	return err
+}
+
+// replayFile applies the Records of the log file at path to a Pila,
+// ignoring a truncated last one, and returns how many were applied.
+func replayFile(path string, p *pila.Pila) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	for n := 0; ; n++ {
+		var record Record
+		err := dec.Decode(&record)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		if err := Apply(p, record); err != nil {
+			return n, err
+		}
+	}
+}
+
+// Apply executes the operation of a Record on a Pila.
+func Apply(p *pila.Pila, record Record) error {
+	switch record.Op {
+	case OpCreateDatabase:
+		db := pila.NewDatabase(record.Database)
+		if record.ID != "" {
+			db.ID = uuid.UUID(record.ID)
+		}
+		db.SetMaxMemory(record.MaxMemory)
+		db.SetSpill(record.Spill)
+		return p.AddDatabase(db)
+	case OpDeleteDatabase:
+		db, ok := p.DatabaseByName(record.Database)
+		if !ok || !p.RemoveDatabase(db.ID) {
+			return fmt.Errorf("database %s not found", record.Database)
+		}
+		return nil
+	case OpRenameDatabase:
+		db, ok := p.DatabaseByName(record.Database)
+		if !ok {
+			return fmt.Errorf("database %s not found", record.Database)
+		}
+		return p.RenameDatabase(db.ID, record.Name)
+	case OpRestore:
+		return p.Restore(bytes.NewReader(record.Snapshot))
+	}
+
+	db, ok := p.DatabaseByName(record.Database)
+	if !ok {
+		return fmt.Errorf("database %s not found", record.Database)
+	}
+
+	if record.Op == OpRenameStack {
+		stack, ok := db.StackByName(record.Stack)
+		if !ok {
+			return fmt.Errorf("stack %s not found in database %s", record.Stack, record.Database)
+		}
+		return db.RenameStack(stack.ID, record.Name)
+	}
+
+	if record.Op == OpTransferStack {
+		stack, ok := db.StackByName(record.Stack)
+		if !ok {
+			return fmt.Errorf("stack %s not found in database %s", record.Stack, record.Database)
+		}
+		toDB, ok := p.DatabaseByName(record.ToDatabase)
+		if !ok {
+			return fmt.Errorf("database %s not found", record.ToDatabase)
+		}
+		return db.TransferStack(stack.ID, toDB)
+	}
+
+	if record.Op == OpCreateStack {
+		stack := pila.NewStructureWithLimit(record.Type, record.Stack, record.Time, record.MaxSize, record.Policy)
+		dir, store := p.SpillDir(), record.Store
+		if store == "" && record.Spill > 0 {
+			store = pila.StoreSpill
+		}
+		if store == pila.StoreSpill && (dir == "" || stack.Type != pila.StructureStack) {
+			store = pila.StoreMemory
+		}
+		if store != "" && store != pila.StoreMemory {
+			var err error
+			if stack, err = pila.NewStackWithStore(record.Type, record.Stack, record.Time, store, pila.StoreOptions{Dir: dir, Spill: record.Spill}); err != nil {
+				return err
+			}
+			stack.MaxSize, stack.Policy = record.MaxSize, record.Policy
+		}
+		if record.ID != "" {
+			stack.ID = uuid.UUID(record.ID)
+		}
+		stack.RateLimit = record.RateLimit
+		stack.TTL = record.TTL
+		stack.SetUnique(record.Unique)
+		stack.SetHistoryDepth(record.History)
+		stack.SetCompress(record.Compress)
+		if record.Encrypted {
+			keys := p.Keyring()
+			if keys == nil {
+				return pila.ErrNoKeys
+			}
+			if err := stack.SetEncryption(keys); err != nil {
+				return err
+			}
+		}
+		if record.Watermarks != nil {
+			if err := stack.SetWatermarks(*record.Watermarks); err != nil {
+				return err
+			}
+		}
+		if err := db.AddStack(stack); err != nil {
+			return err
+		}
+		stack.Update(record.Time)
+		return nil
+	}
+
+	stack, ok := db.StackByName(record.Stack)
+	if !ok {
+		return fmt.Errorf("stack %s not found in database %s", record.Stack, record.Database)
+	}
+
+	switch record.Op {
+	case OpDeleteStack:
+		stack.Flush()
+		db.RemoveStack(stack.ID)
+		return nil
+	case OpSetWatermarks:
+		w := pila.Watermarks{High: pila.NoWatermark, Low: pila.NoWatermark}
+		if record.Watermarks != nil {
+			w = *record.Watermarks
+		}
+		return stack.SetWatermarks(w)
+	case OpSetWindow:
+		var w pila.Window
+		if record.Window != nil {
+			w = *record.Window
+		}
+		return stack.SetWindow(w)
+	case OpPush:
+		element, err := pushedElement(p, record)
+		if err != nil {
+			return err
+		}
+		opts := pila.PushOptions{Priority: record.Priority, Tag: record.Tag, PushedAt: record.Time}
+		if record.ExpiresAt != nil {
+			opts.ExpiresAt = *record.ExpiresAt
+		}
+		if err := stack.PushWithOptions(element, opts); err != nil {
+			return err
+		}
+	case OpPop:
+		stack.Pop()
+	case OpFlush:
+		stack.Flush()
+	case OpRotate:
+		if _, _, err := stack.Rotate(); err != nil {
+			return err
+		}
+	case OpSweep:
+		if _, _, err := stack.Sweep(); err != nil {
+			return err
+		}
+	case OpReverse:
+		if err := stack.Reverse(); err != nil {
+			return err
+		}
+	case OpSort:
+		if err := stack.Sort(record.By, record.Order); err != nil {
+			return err
+		}
+	case OpUndo:
+		if _, err := stack.Undo(); err != nil {
+			return err
+		}
+	case OpMove, OpCopy:
+		toDB, ok := p.DatabaseByName(record.ToDatabase)
+		if !ok {
+			return fmt.Errorf("database %s not found", record.ToDatabase)
+		}
+		to, ok := toDB.StackByName(record.ToStack)
+		if !ok {
+			return fmt.Errorf("stack %s not found in database %s", record.ToStack, record.ToDatabase)
+		}
+		transfer := stack.MoveTo
+		if record.Op == OpCopy {
+			transfer = stack.CopyTo
+		}
+		if _, err := transfer(to, record.Count); err != nil {
+			return err
+		}
+		to.Update(record.Time)
+	default:
+		return fmt.Errorf("unknown operation %s", record.Op)
+	}
+	stack.Update(record.Time)
+	return nil
+}
+
+// pushedElement returns the element pushed by an OpPush Record,
+// decrypting it with the Keyring of the Pila if it is sealed.
+func pushedElement(p *pila.Pila, record Record) (interface{}, error) {
+	if record.Sealed == nil {
+		return pila.Element{Value: record.Element, ContentType: record.ContentType}.StackValue()
+	}
+	keys := p.Keyring()
+	if keys == nil {
+		return nil, pila.ErrNoKeys
+	}
+	return keys.Open(*record.Sealed)
+}
@@ -0,0 +1,882 @@
+package persist
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "piladb-persist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLogReplay(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2016, time.May, 12, 15, 34, 56, 0, time.UTC)
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db", MaxMemory: 1024, ID: "8cfa8cb55c92fa403369a13fd12a8e01"},
+		{Op: OpCreateDatabase, Time: now, Database: "tmp"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack", ID: "a0bfff209889f6f782997a7bd5b3d536"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "flushed"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "deleted"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "limited", MaxSize: 1, Policy: pila.OverflowDropOldest, RateLimit: 5, TTL: time.Minute},
+		{Op: OpPush, Time: now, Database: "db", Stack: "limited", Element: "foo"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "limited", Element: "bar"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "foo"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: 42},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "bar"},
+		{Op: OpPop, Time: now.Add(time.Second), Database: "db", Stack: "stack"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "flushed", Element: "foo"},
+		{Op: OpFlush, Time: now, Database: "db", Stack: "flushed"},
+		{Op: OpDeleteStack, Time: now, Database: "db", Stack: "deleted"},
+		{Op: OpDeleteDatabase, Time: now, Database: "tmp"},
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := p.Status().NumberDatabases; n != 1 {
+		t.Fatalf("number of databases is %d, expected %d", n, 1)
+	}
+	db, ok := p.DatabaseByName("db")
+	if !ok {
+		t.Fatal("database db not found")
+	}
+	if db.ID.String() != "8cfa8cb55c92fa403369a13fd12a8e01" {
+		t.Errorf("database ID is %v, expected %v", db.ID, "8cfa8cb55c92fa403369a13fd12a8e01")
+	}
+	if n := db.Status().NumberStacks; n != 3 {
+		t.Errorf("number of stacks is %d, expected %d", n, 3)
+	}
+	if max := db.MaxMemory(); max != 1024 {
+		t.Errorf("database max memory is %d, expected %d", max, 1024)
+	}
+
+	stack, _ := db.StackByName("stack")
+	if stack.ID.String() != "a0bfff209889f6f782997a7bd5b3d536" {
+		t.Errorf("stack ID is %v, expected %v", stack.ID, "a0bfff209889f6f782997a7bd5b3d536")
+	}
+	if stack.Size() != 2 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 2)
+	}
+	if peek := stack.Peek(); peek != 42.0 {
+		t.Errorf("stack peek is %v, expected %v", peek, 42.0)
+	}
+	if !stack.CreatedAt.Equal(now) {
+		t.Errorf("stack created at %v, expected %v", stack.CreatedAt, now)
+	}
+	if !stack.UpdatedAt.Equal(now.Add(time.Second)) {
+		t.Errorf("stack updated at %v, expected %v", stack.UpdatedAt, now.Add(time.Second))
+	}
+
+	if flushed, _ := db.StackByName("flushed"); flushed.Size() != 0 {
+		t.Errorf("stack size is %d, expected %d", flushed.Size(), 0)
+	}
+
+	limited, _ := db.StackByName("limited")
+	if limited.RateLimit != 5 {
+		t.Errorf("stack rate limit is %d, expected %d", limited.RateLimit, 5)
+	}
+	if limited.TTL != time.Minute {
+		t.Errorf("stack ttl is %v, expected %v", limited.TTL, time.Minute)
+	}
+	if limited.MaxSize != 1 || limited.Policy != pila.OverflowDropOldest {
+		t.Errorf("stack limit is %d %s, expected %d %s", limited.MaxSize, limited.Policy, 1, pila.OverflowDropOldest)
+	}
+	if limited.Size() != 1 || limited.Peek() != "bar" {
+		t.Errorf("stack %s is not limited", limited.Name)
+	}
+}
+
+func TestLogReplay_ExpiresAt(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	expired, alive := now.Add(-time.Second), now.Add(time.Hour)
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "foo", ExpiresAt: &alive},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "bar", ExpiresAt: &expired},
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := p.DatabaseByName("db")
+	stack, _ := db.StackByName("stack")
+	if stack.Size() != 1 || stack.Peek() != "foo" {
+		t.Errorf("stack contains expired elements")
+	}
+	if removed := stack.Expire(alive); removed != 2 {
+		t.Errorf("removed is %d, expected %d", removed, 2)
+	}
+}
+
+func TestLogReplay_Tag(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	pushedAt := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	records := []Record{
+		{Op: OpCreateDatabase, Time: pushedAt, Database: "db"},
+		{Op: OpCreateStack, Time: pushedAt, Database: "db", Stack: "stack"},
+		{Op: OpPush, Time: pushedAt, Database: "db", Stack: "stack", Element: "foo", Tag: "client-1"},
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := p.DatabaseByName("db")
+	stack, _ := db.StackByName("stack")
+	if value, m, ok := stack.PopWithMetadata(); !ok || value != "foo" || m.Tag != "client-1" || !m.PushedAt.Equal(pushedAt) {
+		t.Errorf("pop is %v, %v, expected %v pushed at %v with tag %v", value, m, "foo", pushedAt, "client-1")
+	}
+}
+
+func TestLogReplay_Truncated(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	content := `{"op":"CREATE_DATABASE","time":"2016-05-12T15:34:56Z","database":"db"}
+{"op":"CREATE_STA`
+	if err := ioutil.WriteFile(filepath.Join(dir, logFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.DatabaseByName("db"); !ok {
+		t.Error("database db not found")
+	}
+}
+
+func TestLogReplay_Error(t *testing.T) {
+	inputOutput := []string{
+		`{"op":"PUSH","database":"db","stack":"stack","element":1}`,
+		`{"op":"DELETE_DATABASE","database":"db"}`,
+		`{"op":"CREATE_DATABASE","database":"db"}
+{"op":"POP","database":"db","stack":"stack"}`,
+		`{"op":"CREATE_DATABASE","database":"db"}
+{"op":"CREATE_DATABASE","database":"db"}`,
+		`{"op":"CREATE_DATABASE","database":"db"}
+{"op":"CREATE_STACK","database":"db","stack":"stack"}
+{"op":"FOO","database":"db","stack":"stack"}`,
+		`{"op":"CREATE_DATABASE","database":"db"}
+{"op":"CREATE_STACK","database":"db","stack":"stack","max_size":1,"policy":"reject"}
+{"op":"PUSH","database":"db","stack":"stack","element":1}
+{"op":"PUSH","database":"db","stack":"stack","element":2}`,
+		`foo`,
+	}
+
+	for _, input := range inputOutput {
+		dir := tempDir(t)
+		if err := ioutil.WriteFile(filepath.Join(dir, logFileName), []byte(input), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		l, err := Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := l.Replay(pila.NewPila()); err == nil {
+			t.Errorf("err is nil for %s", input)
+		}
+
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestOpen_Error(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(filepath.Join(file, "dir")); err == nil {
+		t.Error("err is nil")
+	}
+}
+
+func TestLogReplay_Queue(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "queue", Type: pila.StructureQueue},
+		{Op: OpPush, Time: now, Database: "db", Stack: "queue", Element: "foo"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "queue", Element: "bar"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "queue", Element: "baz"},
+		{Op: OpPop, Time: now, Database: "db", Stack: "queue"},
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := p.DatabaseByName("db")
+	queue, _ := db.StackByName("queue")
+	if queue.Type != pila.StructureQueue {
+		t.Errorf("type is %s, expected %s", queue.Type, pila.StructureQueue)
+	}
+	if queue.Size() != 2 || queue.Peek() != "bar" {
+		t.Errorf("queue has size %d and peek %v, expected %d and %v", queue.Size(), queue.Peek(), 2, "bar")
+	}
+}
+
+func TestLogReplay_Priority(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	high, low := 5.0, 1.0
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "p", Type: pila.StructurePriority},
+		{Op: OpPush, Time: now, Database: "db", Stack: "p", Element: "foo", Priority: &high},
+		{Op: OpPush, Time: now, Database: "db", Stack: "p", Element: "bar", Priority: &low},
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := p.DatabaseByName("db")
+	stack, _ := db.StackByName("p")
+	if stack.Type != pila.StructurePriority || stack.Peek() != "foo" {
+		t.Errorf("stack has type %s and peek %v, expected %s and %v", stack.Type, stack.Peek(), pila.StructurePriority, "foo")
+	}
+}
+
+func TestLogReplay_Rotate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "foo"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "bar"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "baz"},
+		{Op: OpRotate, Time: now, Database: "db", Stack: "stack"},
+		{Op: OpSweep, Time: now, Database: "db", Stack: "stack"},
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := p.DatabaseByName("db")
+	stack, _ := db.StackByName("stack")
+	base, _ := stack.Base()
+	if stack.Size() != 2 || stack.Peek() != "bar" || base != "foo" {
+		t.Errorf("stack has size %d, peek %v and base %v, expected %d, %v and %v",
+			stack.Size(), stack.Peek(), base, 2, "bar", "foo")
+	}
+}
+
+func TestLogReplay_ReverseSort(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: map[string]interface{}{"n": 2.0}},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: map[string]interface{}{"n": 3.0}},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: map[string]interface{}{"n": 1.0}},
+		{Op: OpSort, Time: now, Database: "db", Stack: "stack", By: "n", Order: pila.SortDescending},
+		{Op: OpReverse, Time: now, Database: "db", Stack: "stack"},
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := p.DatabaseByName("db")
+	stack, _ := db.StackByName("stack")
+	expected := []interface{}{
+		map[string]interface{}{"n": 1.0},
+		map[string]interface{}{"n": 2.0},
+		map[string]interface{}{"n": 3.0},
+	}
+	if elements := stack.Elements(0, 10); !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+}
+
+func TestLogReplay_MoveCopy(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db"},
+		{Op: OpCreateDatabase, Time: now, Database: "other"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack"},
+		{Op: OpCreateStack, Time: now, Database: "other", Stack: "stack"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "foo"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "bar"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "baz"},
+		{Op: OpMove, Time: now, Database: "db", Stack: "stack", ToDatabase: "other", ToStack: "stack", Count: 2},
+		{Op: OpCopy, Time: now, Database: "db", Stack: "stack", ToDatabase: "other", ToStack: "stack", Count: 1},
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := p.DatabaseByName("db")
+	stack, _ := db.StackByName("stack")
+	if elements := stack.Elements(0, 10); !reflect.DeepEqual(elements, []interface{}{"foo"}) {
+		t.Errorf("stack has elements %v, expected %v", elements, []interface{}{"foo"})
+	}
+
+	other, _ := p.DatabaseByName("other")
+	stack, _ = other.StackByName("stack")
+	if elements := stack.Elements(0, 10); !reflect.DeepEqual(elements, []interface{}{"foo", "baz", "bar"}) {
+		t.Errorf("stack has elements %v, expected %v", elements, []interface{}{"foo", "baz", "bar"})
+	}
+}
+
+func TestLogReplay_Rename(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "foo"},
+		{Op: OpRenameStack, Time: now, Database: "db", Stack: "stack", Name: "renamed"},
+		{Op: OpRenameDatabase, Time: now, Database: "db", Name: "db2"},
+		{Op: OpPush, Time: now, Database: "db2", Stack: "renamed", Element: "bar"},
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := p.DatabaseByName("db"); ok {
+		t.Error("database db exists")
+	}
+	db, ok := p.DatabaseByName("db2")
+	if !ok {
+		t.Fatal("database db2 does not exist")
+	}
+	stack, ok := db.StackByName("renamed")
+	if !ok {
+		t.Fatal("stack renamed does not exist")
+	}
+	if stack.Size() != 2 || stack.Peek() != "bar" {
+		t.Errorf("stack has size %d and peek %v, expected %d and %v", stack.Size(), stack.Peek(), 2, "bar")
+	}
+}
+
+func TestLogReplay_Restore(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	restored := pila.NewPila()
+	db := pila.NewDatabase("new")
+	_ = restored.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now())
+	_ = db.AddStack(stack)
+	_ = stack.Push("foo")
+	var snapshot bytes.Buffer
+	if err := restored.Snapshot(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "old"},
+		{Op: OpCreateStack, Time: now, Database: "old", Stack: "stack"},
+		{Op: OpRestore, Time: now, Snapshot: snapshot.Bytes()},
+		{Op: OpPush, Time: now, Database: "new", Stack: "stack", Element: "bar"},
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := p.DatabaseByName("old"); ok {
+		t.Error("database old exists")
+	}
+	db, ok := p.DatabaseByName("new")
+	if !ok {
+		t.Fatal("database new does not exist")
+	}
+	stack, ok = db.StackByName("stack")
+	if !ok {
+		t.Fatal("stack does not exist in database new")
+	}
+	if stack.Size() != 2 || stack.Peek() != "bar" {
+		t.Errorf("stack has size %d and peek %v, expected %d and %v", stack.Size(), stack.Peek(), 2, "bar")
+	}
+}
+
+func TestLogReplay_Transfer(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db"},
+		{Op: OpCreateDatabase, Time: now, Database: "other"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "foo"},
+		{Op: OpTransferStack, Time: now, Database: "db", Stack: "stack", ToDatabase: "other"},
+		{Op: OpPush, Time: now, Database: "other", Stack: "stack", Element: "bar"},
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := p.DatabaseByName("db")
+	if _, ok := db.StackByName("stack"); ok {
+		t.Error("stack exists in database db")
+	}
+	other, _ := p.DatabaseByName("other")
+	stack, ok := other.StackByName("stack")
+	if !ok {
+		t.Fatal("stack does not exist in database other")
+	}
+	if stack.Size() != 2 || stack.Peek() != "bar" {
+		t.Errorf("stack has size %d and peek %v, expected %d and %v", stack.Size(), stack.Peek(), 2, "bar")
+	}
+}
+
+func TestLogReplay_Binary(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: []byte("hello"), ContentType: "text/plain"},
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := p.DatabaseByName("db")
+	stack, _ := db.StackByName("stack")
+	expected := pila.Binary{ContentType: "text/plain", Data: []byte("hello")}
+	if peek, ok := stack.Peek().(pila.Binary); !ok || peek.ContentType != expected.ContentType || string(peek.Data) != string(expected.Data) {
+		t.Errorf("peek is %v, expected %v", stack.Peek(), expected)
+	}
+}
+
+func TestLogReplay_Spill(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	spillDir := tempDir(t)
+	defer os.RemoveAll(spillDir)
+
+	now := time.Now().UTC()
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db", Spill: 2},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack", Spill: 3},
+	}
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, io := range []struct {
+		spillDir string
+		spill    int
+	}{
+		{spillDir, 3},
+		{"", 0},
+	} {
+		p := pila.NewPila()
+		p.SetSpillDir(io.spillDir)
+		if err := l.Replay(p); err != nil {
+			t.Fatal(err)
+		}
+
+		db, _ := p.DatabaseByName("db")
+		if db.Spill() != 2 {
+			t.Errorf("database spill is %d, expected %d", db.Spill(), 2)
+		}
+		if stack, _ := db.StackByName("stack"); stack.Spill() != io.spill {
+			t.Errorf("stack spill is %d, expected %d", stack.Spill(), io.spill)
+		}
+	}
+}
+
+func TestLogReplay_Unique(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack", Unique: pila.UniqueReject},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "foo"},
+	}
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := p.DatabaseByName("db")
+	stack, _ := db.StackByName("stack")
+	if stack.Unique() != pila.UniqueReject {
+		t.Errorf("stack unique is %s, expected %s", stack.Unique(), pila.UniqueReject)
+	}
+	if err := stack.Push("foo"); err != pila.ErrDuplicate {
+		t.Errorf("err is %v, expected %v", err, pila.ErrDuplicate)
+	}
+}
+
+func TestLogReplay_Undo(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack", History: 2, Compress: 16},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "foo"},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Element: "bar"},
+		{Op: OpPop, Time: now, Database: "db", Stack: "stack"},
+		{Op: OpPop, Time: now, Database: "db", Stack: "stack"},
+		{Op: OpUndo, Time: now, Database: "db", Stack: "stack"},
+	}
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := p.DatabaseByName("db")
+	stack, _ := db.StackByName("stack")
+	if stack.HistoryDepth() != 2 {
+		t.Errorf("stack history depth is %d, expected %d", stack.HistoryDepth(), 2)
+	}
+	if stack.Compress() != 16 {
+		t.Errorf("stack compress is %d, expected %d", stack.Compress(), 16)
+	}
+	if stack.Size() != 1 || stack.Peek() != "foo" {
+		t.Errorf("stack has size %d and peek %v, expected %d and %v", stack.Size(), stack.Peek(), 1, "foo")
+	}
+	if history := stack.History(10); !reflect.DeepEqual(history, []interface{}{"bar"}) {
+		t.Errorf("stack history is %v, expected %v", history, []interface{}{"bar"})
+	}
+}
+
+func TestLogReplay_Encrypted(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	keys := pila.NewKeyring()
+	_ = keys.Add("a", make([]byte, 32))
+	sealed, err := keys.Seal(pila.Binary{ContentType: "text/plain", Data: []byte("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack", Encrypted: true},
+		{Op: OpPush, Time: now, Database: "db", Stack: "stack", Sealed: &sealed},
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := l.Replay(pila.NewPila()); err != pila.ErrNoKeys {
+		t.Errorf("err is %v, expected %v", err, pila.ErrNoKeys)
+	}
+
+	p := pila.NewPila()
+	p.SetKeyring(keys)
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := p.DatabaseByName("db")
+	stack, _ := db.StackByName("stack")
+	if stack.Encryption() != keys {
+		t.Error("stack is not encrypted")
+	}
+	if peek, ok := stack.Peek().(pila.Binary); !ok || string(peek.Data) != "hello" {
+		t.Errorf("peek is %v, expected %v", stack.Peek(), "hello")
+	}
+
+	p = pila.NewPila()
+	_ = p.AddKey("b", make([]byte, 32))
+	if err := l.Replay(p); err != pila.ErrUnknownKey {
+		t.Errorf("err is %v, expected %v", err, pila.ErrUnknownKey)
+	}
+}
+
+func TestLogReplay_Watermarks(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	records := []Record{
+		{Op: OpCreateDatabase, Time: now, Database: "db"},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "stack", Watermarks: &pila.Watermarks{High: 10, Low: 0}},
+		{Op: OpCreateStack, Time: now, Database: "db", Stack: "other"},
+		{Op: OpSetWatermarks, Time: now, Database: "db", Stack: "other", Watermarks: &pila.Watermarks{High: pila.NoWatermark, Low: 5}},
+		{Op: OpSetWatermarks, Time: now, Database: "db", Stack: "stack"},
+	}
+	for _, record := range records {
+		if err := l.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := pila.NewPila()
+	if err := l.Replay(p); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := p.DatabaseByName("db")
+	stack, _ := db.StackByName("stack")
+	if w, ok := stack.Watermarks(); ok {
+		t.Errorf("stack watermarks are %v, expected none", w)
+	}
+	other, _ := db.StackByName("other")
+	if w, ok := other.Watermarks(); !ok || w != (pila.Watermarks{High: pila.NoWatermark, Low: 5}) {
+		t.Errorf("stack watermarks are %v, %v, expected %v", w, ok, pila.Watermarks{High: pila.NoWatermark, Low: 5})
+	}
+
+	if err := Apply(p, Record{Op: OpSetWatermarks, Time: now, Database: "db", Stack: "stack", Watermarks: &pila.Watermarks{High: 1, Low: 1}}); err != pila.ErrInvalidWatermarks {
+		t.Errorf("err is %v, expected %v", err, pila.ErrInvalidWatermarks)
+	}
+}
@@ -0,0 +1,460 @@
+package pila
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/uuid"
+)
+
+// dumpVersion is the version of the format used to persist a Pila.
+// It must be increased on every incompatible change of the format.
+const dumpVersion = 1
+
+// pilaDump represents the persisted state of a Pila.
+type pilaDump struct {
+	Version   int            `json:"version"`
+	Databases []databaseDump `json:"databases"`
+}
+
+// databaseDump represents the persisted state of a Database.
+type databaseDump struct {
+	ID        string      `json:"id,omitempty"`
+	Name      string      `json:"name"`
+	Stacks    []stackDump `json:"stacks"`
+	MaxMemory int64       `json:"max_memory,omitempty"`
+	Spill     int         `json:"spill,omitempty"`
+}
+
+// stackDump represents the persisted state of a Stack. Elements are
+// ordered as they were pushed, i.e. from bottom to top of a stack, so
+// they can be restored by pushing them in the same order. If any element expires, Expirations contains the
+// expiration date of every element in the same order, being zero for
+// the ones that do not expire. Likewise, Priorities contains the
+// priority of every element of a priority queue, and ContentTypes
+// the content type of every element, being empty for the ones that
+// are not Binary, whose data is encoded in base64. PushedAt contains
+// the date when every element was pushed, and Tags their tags, if any
+// element has one, being empty for the ones that do not. The elements of
+// an encrypted Stack are in Sealed instead, sealed with the current
+// key of its Keyring.
+type stackDump struct {
+	ID           string         `json:"id,omitempty"`
+	Name         string         `json:"name"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	ReadAt       time.Time      `json:"read_at"`
+	Elements     []interface{}  `json:"elements"`
+	Expirations  []time.Time    `json:"expirations,omitempty"`
+	Priorities   []float64      `json:"priorities,omitempty"`
+	ContentTypes []string       `json:"content_types,omitempty"`
+	PushedAt     []time.Time    `json:"pushed_at,omitempty"`
+	Tags         []string       `json:"tags,omitempty"`
+	Type         Structure      `json:"type,omitempty"`
+	MaxSize      int            `json:"max_size,omitempty"`
+	Policy       OverflowPolicy `json:"overflow_policy,omitempty"`
+	RateLimit    int            `json:"rate_limit,omitempty"`
+	TTL          time.Duration  `json:"ttl,omitempty"`
+	Spill        int            `json:"spill,omitempty"`
+	Store        string         `json:"store,omitempty"`
+	Unique       UniquePolicy   `json:"unique,omitempty"`
+	History      int            `json:"history,omitempty"`
+	Compress     int            `json:"compress,omitempty"`
+	Encrypted    bool           `json:"encrypted,omitempty"`
+	Sealed       []Sealed       `json:"sealed,omitempty"`
+	Watermarks   *Watermarks    `json:"watermarks,omitempty"`
+	Window       *Window        `json:"window,omitempty"`
+}
+
+// Snapshot writes the whole content of the Pila, i.e. all its Databases,
+// Stacks and elements, into w using JSON encoding.
+func (p *Pila) Snapshot(w io.Writer) error {
+	return p.SnapshotCtx(context.Background(), w)
+}
+
+// SnapshotCtx writes the content of the Pila into w like Snapshot. If
+// ctx is done while the Stacks are dumped, nothing is written and the
+// error of ctx is returned.
+func (p *Pila) SnapshotCtx(ctx context.Context, w io.Writer) error {
+	dump := pilaDump{
+		Version:   dumpVersion,
+		Databases: []databaseDump{},
+	}
+
+	var err error
+	p.ForEachDatabase(func(db *Database) bool {
+		dbDump := databaseDump{
+			ID:        db.ID.String(),
+			Name:      db.Name,
+			Stacks:    []stackDump{},
+			MaxMemory: db.MaxMemory(),
+			Spill:     db.Spill(),
+		}
+		db.ForEachStack(func(s *Stack) bool {
+			if err = ctx.Err(); err != nil {
+				return false
+			}
+			dbDump.Stacks = append(dbDump.Stacks, s.dump())
+			return true
+		})
+		dump.Databases = append(dump.Databases, dbDump)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(dump)
+}
+
+// Restore reads a Pila previously written by Snapshot from r, and
+// replaces the Databases of the Pila with the loaded ones. The
+// Pila is left untouched if an error is returned.
+func (p *Pila) Restore(r io.Reader) error {
+	return p.RestoreCtx(context.Background(), r)
+}
+
+// RestoreCtx reads a Pila from r and replaces the Databases of the
+// Pila like Restore. If ctx is done while the Stacks are loaded, the
+// Pila is left untouched and the error of ctx is returned.
+func (p *Pila) RestoreCtx(ctx context.Context, r io.Reader) error {
+	loaded, err := p.read(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, db := range p.Databases {
+		db.Pila = nil
+		db.close()
+	}
+	for _, db := range loaded.Databases {
+		db.Pila = p
+	}
+	p.Databases = loaded.Databases
+	p.names = loaded.names
+	p.changed()
+	return nil
+}
+
+// read reads a Pila previously written by Snapshot from r into a
+// new Pila, whose Stacks spill and are encrypted like the ones of p.
+func (p *Pila) read(ctx context.Context, r io.Reader) (*Pila, error) {
+	var dump pilaDump
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return nil, err
+	}
+	if dump.Version != dumpVersion {
+		return nil, fmt.Errorf("unsupported dump version %d", dump.Version)
+	}
+
+	loaded := NewPila()
+	if err := loaded.load(ctx, dump, p.SpillDir(), p.Keyring()); err != nil {
+		for _, db := range loaded.Databases {
+			db.close()
+		}
+		return nil, err
+	}
+	return loaded, nil
+}
+
+// load adds to the Pila the Databases and Stacks of dump,
+// until ctx is done. Encrypted Stacks are encrypted with keys.
+func (p *Pila) load(ctx context.Context, dump pilaDump, spillDir string, keys *Keyring) error {
+	for _, dbDump := range dump.Databases {
+		db := NewDatabase(dbDump.Name)
+		if dbDump.ID != "" {
+			db.ID = uuid.UUID(dbDump.ID)
+		}
+		if err := p.AddDatabase(db); err != nil {
+			return fmt.Errorf("database %s: %v", dbDump.Name, err)
+		}
+		for _, sDump := range dbDump.Stacks {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			s, err := sDump.stack(spillDir, keys)
+			if err == nil {
+				err = db.AddStack(s)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		db.SetMaxMemory(dbDump.MaxMemory)
+		db.SetSpill(dbDump.Spill)
+	}
+	return nil
+}
+
+// SaveTo writes the content of the Pila into the stream w, like
+// Snapshot, of which it is the former name.
+func (p *Pila) SaveTo(w io.Writer) error {
+	return p.Snapshot(w)
+}
+
+// LoadFrom reads the content of the Pila from the stream r, like
+// Restore, of which it is the former name.
+func (p *Pila) LoadFrom(r io.Reader) error {
+	return p.Restore(r)
+}
+
+// Save writes the content of the Pila into the file given by path,
+// which is replaced atomically.
+func (p *Pila) Save(path string) error {
+	return p.SaveCtx(context.Background(), path)
+}
+
+// SaveCtx writes the content of the Pila into the file given by path
+// like Save. If ctx is done meanwhile, the file is left untouched and
+// the error of ctx is returned.
+func (p *Pila) SaveCtx(ctx context.Context, path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := p.SnapshotCtx(ctx, f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// Load reads the content of the Pila from the file given by path.
+func (p *Pila) Load(path string) error {
+	return p.LoadCtx(context.Background(), path)
+}
+
+// LoadCtx reads the content of the Pila from the file given by path
+// like Load. If ctx is done meanwhile, the Pila is left untouched and
+// the error of ctx is returned.
+func (p *Pila) LoadCtx(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return p.RestoreCtx(ctx, f)
+}
+
+// dump returns the persisted state of the Stack.
+// Expired elements are not included.
+func (s *Stack) dump() stackDump {
+	now := time.Now()
+	elements := make([]interface{}, 0, s.Size())
+	var expirations []time.Time
+	var priorities []float64
+	var contentTypes []string
+	var pushedAt []time.Time
+	var tags []string
+	var sealed []Sealed
+	var binary, tagged bool
+	keys := s.Encryption()
+	s.base.Range(func(element interface{}) bool {
+		value, alive := unwrap(element, now)
+		if !alive {
+			return true
+		}
+		if keys != nil {
+			// Do not check error as the Keyring of the Stack
+			// has a current key, and its values can be
+			// encoded to JSON.
+			e, _ := keys.Seal(value)
+			sealed = append(sealed, e)
+		} else {
+			e := NewElement(value)
+			elements = append(elements, e.Value)
+			contentTypes = append(contentTypes, e.ContentType)
+			binary = binary || e.ContentType != ""
+		}
+		if s.Type == StructurePriority {
+			priorities = append(priorities, priority(element))
+		}
+		m := metadata(element)
+		pushedAt = append(pushedAt, m.PushedAt.UTC())
+		tags = append(tags, m.Tag)
+		tagged = tagged || m.Tag != ""
+		if e, ok := element.(prioritizedElement); ok {
+			element = e.value
+		}
+		if s.hasExpiring() {
+			var expiresAt time.Time
+			if e, ok := element.(expiringElement); ok {
+				expiresAt = e.expiresAt
+			}
+			expirations = append(expirations, expiresAt)
+		}
+		return true
+	})
+
+	// reverse elements to get them in push order
+	for i, j := 0, len(elements)-1; i < j; i, j = i+1, j-1 {
+		elements[i], elements[j] = elements[j], elements[i]
+	}
+	for i, j := 0, len(expirations)-1; i < j; i, j = i+1, j-1 {
+		expirations[i], expirations[j] = expirations[j], expirations[i]
+	}
+	for i, j := 0, len(priorities)-1; i < j; i, j = i+1, j-1 {
+		priorities[i], priorities[j] = priorities[j], priorities[i]
+	}
+	for i, j := 0, len(sealed)-1; i < j; i, j = i+1, j-1 {
+		sealed[i], sealed[j] = sealed[j], sealed[i]
+	}
+	if !binary {
+		contentTypes = nil
+	}
+	for i, j := 0, len(contentTypes)-1; i < j; i, j = i+1, j-1 {
+		contentTypes[i], contentTypes[j] = contentTypes[j], contentTypes[i]
+	}
+	for i, j := 0, len(pushedAt)-1; i < j; i, j = i+1, j-1 {
+		pushedAt[i], pushedAt[j] = pushedAt[j], pushedAt[i]
+	}
+	if !tagged {
+		tags = nil
+	}
+	for i, j := 0, len(tags)-1; i < j; i, j = i+1, j-1 {
+		tags[i], tags[j] = tags[j], tags[i]
+	}
+
+	var watermarks *Watermarks
+	if w, ok := s.Watermarks(); ok {
+		watermarks = &w
+	}
+	var window *Window
+	if w, _, ok := s.Window(); ok {
+		window = &w
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var store string
+	if s.store != StoreMemory {
+		store = s.store
+	}
+
+	return stackDump{
+		ID:           s.ID.String(),
+		Name:         s.Name,
+		CreatedAt:    s.CreatedAt,
+		UpdatedAt:    s.UpdatedAt,
+		ReadAt:       s.ReadAt,
+		Elements:     elements,
+		Expirations:  expirations,
+		Priorities:   priorities,
+		ContentTypes: contentTypes,
+		PushedAt:     pushedAt,
+		Tags:         tags,
+		Type:         s.Type,
+		MaxSize:      s.MaxSize,
+		Policy:       s.Policy,
+		RateLimit:    s.RateLimit,
+		TTL:          s.TTL,
+		Spill:        s.Spill(),
+		Store:        store,
+		Unique:       s.Unique(),
+		History:      s.HistoryDepth(),
+		Compress:     s.Compress(),
+		Encrypted:    keys != nil,
+		Sealed:       sealed,
+		Watermarks:   watermarks,
+		Window:       window,
+	}
+}
+
+// stack creates a new Stack from its persisted state, in the same
+// Store, given spillDir as directory. A Stack that spilled to disk
+// spills into spillDir, unless it is empty. An encrypted Stack is
+// decrypted and encrypted again with keys.
+func (sDump stackDump) stack(spillDir string, keys *Keyring) (*Stack, error) {
+	s := NewStructureWithLimit(sDump.Type, sDump.Name, sDump.CreatedAt, sDump.MaxSize, sDump.Policy)
+	store := sDump.Store
+	if store == "" && sDump.Spill > 0 {
+		store = StoreSpill
+	}
+	if store == StoreSpill && (spillDir == "" || s.Type != StructureStack) {
+		store = StoreMemory
+	}
+	if store != "" && store != StoreMemory {
+		var err error
+		if s, err = NewStackWithStore(sDump.Type, sDump.Name, sDump.CreatedAt, store, StoreOptions{Dir: spillDir, Spill: sDump.Spill}); err != nil {
+			return nil, fmt.Errorf("stack %s: %v", sDump.Name, err)
+		}
+		s.MaxSize, s.Policy = sDump.MaxSize, sDump.Policy
+	}
+	if sDump.ID != "" {
+		s.ID = uuid.UUID(sDump.ID)
+	}
+	s.RateLimit = sDump.RateLimit
+	s.TTL = sDump.TTL
+	s.SetUnique(sDump.Unique)
+	s.SetHistoryDepth(sDump.History)
+	s.SetCompress(sDump.Compress)
+	elements := sDump.Elements
+	if sDump.Encrypted {
+		if keys == nil {
+			return nil, fmt.Errorf("stack %s: %v", sDump.Name, ErrNoKeys)
+		}
+		if err := s.SetEncryption(keys); err != nil {
+			return nil, fmt.Errorf("stack %s: %v", sDump.Name, err)
+		}
+		elements = make([]interface{}, len(sDump.Sealed))
+		for i, sealed := range sDump.Sealed {
+			value, err := keys.Open(sealed)
+			if err != nil {
+				return nil, fmt.Errorf("stack %s: %v", sDump.Name, err)
+			}
+			elements[i] = value
+		}
+	}
+	for i, element := range elements {
+		var opts PushOptions
+		if i < len(sDump.Expirations) {
+			opts.ExpiresAt = sDump.Expirations[i]
+		}
+		if i < len(sDump.Priorities) {
+			opts.Priority = &sDump.Priorities[i]
+		}
+		if i < len(sDump.PushedAt) {
+			opts.PushedAt = sDump.PushedAt[i]
+		}
+		if i < len(sDump.Tags) && validTag(sDump.Tags[i]) {
+			opts.Tag = sDump.Tags[i]
+		}
+		if i < len(sDump.ContentTypes) && sDump.ContentTypes[i] != "" {
+			if value, err := (Element{Value: element, ContentType: sDump.ContentTypes[i]}).StackValue(); err == nil {
+				element = value
+			}
+		}
+		s.PushWithOptions(element, opts)
+	}
+	// watermarks are set once restored, so they are not crossed
+	if sDump.Watermarks != nil {
+		if err := s.SetWatermarks(*sDump.Watermarks); err != nil {
+			return nil, fmt.Errorf("stack %s: %v", sDump.Name, err)
+		}
+	}
+	if sDump.Window != nil {
+		if err := s.SetWindow(*sDump.Window); err != nil {
+			return nil, fmt.Errorf("stack %s: %v", sDump.Name, err)
+		}
+	}
+	s.UpdatedAt = sDump.UpdatedAt
+	s.ReadAt = sDump.ReadAt
+	return s, nil
+}
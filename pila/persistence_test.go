@@ -0,0 +1,498 @@
+package pila
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPilaSnapshotRestore(t *testing.T) {
+	now := time.Now().UTC()
+	pila := NewPila()
+	db0 := NewDatabase("db0")
+	db1 := NewDatabase("db1")
+	_ = pila.AddDatabase(db0)
+	_ = pila.AddDatabase(db1)
+
+	s0 := NewStack("s0", now)
+	s0.Push("foo")
+	s0.Push(8.0)
+	s0.Push(map[string]interface{}{"a": "b"})
+	s0.Update(now)
+	_ = db0.AddStack(s0)
+	db0.CreateStack("s1", now)
+
+	var buf bytes.Buffer
+	if err := pila.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewPila()
+	loaded.CreateDatabase("old")
+	if err := loaded.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(loaded.Status(), pila.Status()) {
+		t.Errorf("status is %v, expected %v", loaded.Status(), pila.Status())
+	}
+
+	db, ok := loaded.Database(db0.ID)
+	if !ok {
+		t.Fatalf("database %s not loaded", db0.Name)
+	}
+	if db.Pila != loaded {
+		t.Errorf("database %s is not linked to the loaded pila", db.Name)
+	}
+	if db2, ok := loaded.DatabaseByName(db0.Name); !ok || db2 != db {
+		t.Errorf("database %s not found by name", db0.Name)
+	}
+	if _, ok := loaded.DatabaseByName("old"); ok {
+		t.Error("database old was not replaced")
+	}
+
+	s, ok := db.Stacks[s0.ID]
+	if !ok {
+		t.Fatalf("stack %s not loaded", s0.Name)
+	}
+	if s.Size() != 3 {
+		t.Errorf("stack size is %d, expected %d", s.Size(), 3)
+	}
+	if !s.UpdatedAt.Equal(now) {
+		t.Errorf("stack UpdatedAt is %v, expected %v", s.UpdatedAt, now)
+	}
+
+	for _, expected := range []interface{}{map[string]interface{}{"a": "b"}, 8.0, "foo"} {
+		if element, _ := s.Pop(); !reflect.DeepEqual(element, expected) {
+			t.Errorf("element is %v, expected %v", element, expected)
+		}
+	}
+}
+
+func TestPilaSnapshotRestore_Expirations(t *testing.T) {
+	now := time.Now().UTC()
+	pila := NewPila()
+	db := NewDatabase("db")
+	_ = pila.AddDatabase(db)
+	s := NewStack("s", now)
+	_ = db.AddStack(s)
+	s.PushWithExpiration("foo", now.Add(time.Hour))
+	s.PushWithExpiration("expired", now.Add(-time.Second))
+	s.Push("bar")
+
+	var buf bytes.Buffer
+	if err := pila.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewPila()
+	if err := loaded.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	ls := loaded.Databases[db.ID].Stacks[s.ID]
+	if ls.Size() != 2 {
+		t.Errorf("stack size is %d, expected %d", ls.Size(), 2)
+	}
+	if removed := ls.Expire(now.Add(2 * time.Hour)); removed != 1 {
+		t.Errorf("removed is %d, expected %d", removed, 1)
+	}
+	if peek := ls.Peek(); peek != "bar" {
+		t.Errorf("peek is %v, expected %v", peek, "bar")
+	}
+}
+
+func TestPilaSnapshotRestore_Limit(t *testing.T) {
+	pila := NewPila()
+	db := NewDatabase("db")
+	db.SetMaxMemory(1024)
+	_ = pila.AddDatabase(db)
+	s := NewStackWithLimit("s", time.Now(), 2, OverflowDropOldest)
+	s.RateLimit = 5
+	s.TTL = time.Hour
+	_ = db.AddStack(s)
+	s.Push("foo")
+
+	var buf bytes.Buffer
+	if err := pila.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewPila()
+	if err := loaded.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	ls := loaded.Databases[db.ID].Stacks[s.ID]
+	if ls.RateLimit != 5 {
+		t.Errorf("stack rate limit is %d, expected %d", ls.RateLimit, 5)
+	}
+	if ls.TTL != time.Hour {
+		t.Errorf("stack ttl is %v, expected %v", ls.TTL, time.Hour)
+	}
+	if ls.MaxSize != 2 || ls.Policy != OverflowDropOldest {
+		t.Errorf("stack limit is %d %s, expected %d %s", ls.MaxSize, ls.Policy, 2, OverflowDropOldest)
+	}
+	ldb := loaded.Databases[db.ID]
+	if ldb.MaxMemory() != 1024 || ldb.Memory() != db.Memory() {
+		t.Errorf("database memory is %d of %d, expected %d of %d", ldb.Memory(), ldb.MaxMemory(), db.Memory(), 1024)
+	}
+}
+
+func TestPilaSaveToLoadFrom(t *testing.T) {
+	pila := NewPila()
+	db := NewDatabase("db")
+	_ = pila.AddDatabase(db)
+	s := NewStack("s", time.Now())
+	s.Push("foo")
+	_ = db.AddStack(s)
+
+	var buf bytes.Buffer
+	if err := pila.SaveTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewPila()
+	loaded.CreateDatabase("old")
+	if err := loaded.LoadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.DatabaseByName("old"); ok {
+		t.Error("database old exists")
+	}
+	ldb, ok := loaded.DatabaseByName("db")
+	if !ok {
+		t.Fatal("database db does not exist")
+	}
+	if ls, ok := ldb.StackByName("s"); !ok || ls.Peek() != "foo" {
+		t.Errorf("stack s is not loaded with its elements")
+	}
+
+	if err := loaded.LoadFrom(strings.NewReader("not json")); err == nil {
+		t.Error("err is nil")
+	}
+}
+
+func TestPilaSnapshot_Error(t *testing.T) {
+	pila := NewPila()
+	db := NewDatabase("db")
+	_ = pila.AddDatabase(db)
+	s := NewStack("s", time.Now())
+	s.Push(make(chan int))
+	_ = db.AddStack(s)
+
+	if err := pila.Snapshot(ioutil.Discard); err == nil {
+		t.Error("err is nil")
+	}
+}
+
+func TestPilaRestore_Error(t *testing.T) {
+	inputs := []string{
+		`not json`,
+		`{"version":0,"databases":[]}`,
+		`{"version":1,"databases":[{"name":"db","stacks":[]},{"name":"db","stacks":[]}]}`,
+		`{"version":1,"databases":[{"name":"db","stacks":[{"name":"s"},{"name":"s"}]}]}`,
+	}
+
+	for _, input := range inputs {
+		pila := NewPila()
+		pila.CreateDatabase("db0")
+
+		if err := pila.Restore(strings.NewReader(input)); err == nil {
+			t.Errorf("err is nil for %s", input)
+		}
+
+		if len(pila.Databases) != 1 {
+			t.Errorf("pila has %d databases, expected %d", len(pila.Databases), 1)
+		}
+	}
+}
+
+func TestPilaSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "piladb.json")
+
+	pila := NewPila()
+	db := NewDatabase("db")
+	_ = pila.AddDatabase(db)
+	db.CreateStack("s", time.Now())
+
+	if err := pila.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewPila()
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(loaded.Status(), pila.Status()) {
+		t.Errorf("status is %v, expected %v", loaded.Status(), pila.Status())
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("directory contains %d files, expected %d", len(files), 1)
+	}
+}
+
+func TestPilaSave_Error(t *testing.T) {
+	pila := NewPila()
+	if err := pila.Save("/non/existing/dir/piladb.json"); err == nil {
+		t.Error("err is nil")
+	}
+}
+
+func TestPilaLoad_Error(t *testing.T) {
+	pila := NewPila()
+	if err := pila.Load("/non/existing/dir/piladb.json"); err == nil {
+		t.Error("err is nil")
+	}
+}
+
+func TestPilaSnapshotRestoreCtx(t *testing.T) {
+	pila := NewPila()
+	db := NewDatabase("db")
+	_ = pila.AddDatabase(db)
+	db.CreateStack("s", time.Now())
+
+	var buf bytes.Buffer
+	if err := pila.SnapshotCtx(canceledContext(), &buf); err != context.Canceled {
+		t.Errorf("err is %v, expected %v", err, context.Canceled)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("snapshot is %s, expected nothing written", buf.String())
+	}
+
+	if err := pila.SnapshotCtx(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewPila()
+	_ = loaded.AddDatabase(NewDatabase("other"))
+	if err := loaded.RestoreCtx(canceledContext(), bytes.NewReader(buf.Bytes())); err != context.Canceled {
+		t.Errorf("err is %v, expected %v", err, context.Canceled)
+	}
+	if _, ok := loaded.DatabaseByName("other"); !ok {
+		t.Error("database was removed by a canceled restore")
+	}
+
+	if err := loaded.RestoreCtx(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Status(), pila.Status()) {
+		t.Errorf("status is %v, expected %v", loaded.Status(), pila.Status())
+	}
+}
+
+func TestPilaSaveLoadCtx(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "piladb.json")
+
+	pila := NewPila()
+	db := NewDatabase("db")
+	_ = pila.AddDatabase(db)
+	db.CreateStack("s", time.Now())
+
+	if err := pila.SaveCtx(canceledContext(), path); err != context.Canceled {
+		t.Errorf("err is %v, expected %v", err, context.Canceled)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("err is %v, expected the file not to exist", err)
+	}
+
+	if err := pila.SaveCtx(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewPila()
+	if err := loaded.LoadCtx(canceledContext(), path); err != context.Canceled {
+		t.Errorf("err is %v, expected %v", err, context.Canceled)
+	}
+	if err := loaded.LoadCtx(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Status(), pila.Status()) {
+		t.Errorf("status is %v, expected %v", loaded.Status(), pila.Status())
+	}
+}
+
+func TestPilaSnapshotRestore_Queue(t *testing.T) {
+	pila := NewPila()
+	db := NewDatabase("db")
+	_ = pila.AddDatabase(db)
+	q := NewQueue("q", time.Now())
+	_ = db.AddStack(q)
+	_ = q.PushN([]interface{}{"foo", "bar"})
+
+	var buf bytes.Buffer
+	if err := pila.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewPila()
+	if err := loaded.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	lq := loaded.Databases[db.ID].Stacks[q.ID]
+	if lq.Type != StructureQueue {
+		t.Errorf("type is %s, expected %s", lq.Type, StructureQueue)
+	}
+	if elements := lq.PopN(2); !reflect.DeepEqual(elements, []interface{}{"foo", "bar"}) {
+		t.Errorf("elements are %v, expected %v", elements, []interface{}{"foo", "bar"})
+	}
+}
+
+func TestPilaSnapshotRestore_Priority(t *testing.T) {
+	pila := NewPila()
+	db := NewDatabase("db")
+	_ = pila.AddDatabase(db)
+	p := NewPriority("p", time.Now())
+	_ = db.AddStack(p)
+	_ = p.PushWithPriority("foo", 5, time.Time{})
+	_ = p.PushWithPriority("bar", 1, time.Now().Add(time.Hour))
+	_ = p.PushWithPriority("baz", 5, time.Time{})
+
+	var buf bytes.Buffer
+	if err := pila.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewPila()
+	if err := loaded.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	lp := loaded.Databases[db.ID].Stacks[p.ID]
+	if lp.Type != StructurePriority {
+		t.Errorf("type is %s, expected %s", lp.Type, StructurePriority)
+	}
+	if elements := lp.PopN(3); !reflect.DeepEqual(elements, []interface{}{"baz", "foo", "bar"}) {
+		t.Errorf("elements are %v, expected %v", elements, []interface{}{"baz", "foo", "bar"})
+	}
+}
+
+func TestPilaSnapshotRestore_Binary(t *testing.T) {
+	pila := NewPila()
+	db := NewDatabase("db")
+	_ = pila.AddDatabase(db)
+	s := NewStack("s", time.Now())
+	_ = db.AddStack(s)
+	_ = s.Push("foo")
+	_ = s.Push(Binary{ContentType: "image/png", Data: []byte{0x89, 'P', 'N', 'G'}})
+
+	var buf bytes.Buffer
+	if err := pila.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewPila()
+	if err := loaded.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	ls := loaded.Databases[db.ID].Stacks[s.ID]
+	expected := []interface{}{Binary{ContentType: "image/png", Data: []byte{0x89, 'P', 'N', 'G'}}, "foo"}
+	if elements := ls.PopN(2); !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+}
+
+func TestPilaSnapshotRestore_Encrypted(t *testing.T) {
+	keys := testKeyring(t, "a")
+	pila := NewPila()
+	pila.SetKeyring(keys)
+	db := NewDatabase("db")
+	_ = pila.AddDatabase(db)
+	p := NewPriority("p", time.Now())
+	_ = p.SetEncryption(keys)
+	_ = db.AddStack(p)
+	_ = p.PushWithPriority("foo", 5, time.Time{})
+	_ = p.PushWithPriority(Binary{ContentType: "image/png", Data: []byte{0x89, 'P'}}, 1, time.Now().Add(time.Hour))
+	_ = p.PushWithPriority("baz", 5, time.Time{})
+
+	// the snapshot is sealed with the current key
+	_ = keys.Add("b", bytes.Repeat([]byte{2}, 32))
+	var buf bytes.Buffer
+	if err := pila.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "foo") || strings.Contains(buf.String(), `"key":"a"`) {
+		t.Errorf("snapshot %s is not sealed with key b", buf.String())
+	}
+	snapshot := buf.Bytes()
+
+	if err := NewPila().Restore(bytes.NewReader(snapshot)); err == nil {
+		t.Error("err is nil, expected error")
+	}
+	loaded := NewPila()
+	loaded.SetKeyring(testKeyring(t, "c", "b"))
+	if err := loaded.Restore(bytes.NewReader(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+
+	lp := loaded.Databases[db.ID].Stacks[p.ID]
+	if !lp.Status().Encrypted || lp.Encryption() != loaded.Keyring() {
+		t.Error("stack is not encrypted with the keyring of the pila")
+	}
+	expected := []interface{}{"baz", "foo", Binary{ContentType: "image/png", Data: []byte{0x89, 'P'}}}
+	if elements := lp.PopN(3); !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+}
+
+func TestPilaSnapshotRestore_Watermarks(t *testing.T) {
+	pila := NewPila()
+	db := NewDatabase("db")
+	_ = pila.AddDatabase(db)
+	stack := NewStack("stack", time.Now())
+	_ = stack.SetWatermarks(Watermarks{High: 2, Low: NoWatermark})
+	_ = db.AddStack(stack)
+	stack.Push("foo")
+	stack.Push("bar")
+
+	var buf bytes.Buffer
+	if err := pila.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// restoring the elements does not cross the watermarks
+	loaded := NewPila()
+	var alerts []Event
+	loaded.OnWatermark(func(_ *Database, _ *Stack, e Event) {
+		alerts = append(alerts, e)
+	})
+	if err := loaded.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("alerts are %v, expected none", alerts)
+	}
+
+	ls := loaded.Databases[db.ID].Stacks[stack.ID]
+	if w, ok := ls.Watermarks(); !ok || w != (Watermarks{High: 2, Low: NoWatermark}) {
+		t.Errorf("watermarks are %v, %v, expected %v", w, ok, Watermarks{High: 2, Low: NoWatermark})
+	}
+	ls.Pop()
+	ls.Push("bar")
+	if expected := []Event{{Op: EventHighWatermark, Element: 2}}; !reflect.DeepEqual(alerts, expected) {
+		t.Errorf("alerts are %v, expected %v", alerts, expected)
+	}
+}
@@ -6,12 +6,46 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/uuid"
 )
 
+// ErrNameTaken is returned when renaming a Database or a
+// Stack with the name of another existing one.
+var ErrNameTaken = errors.New("name already taken")
+
 // Pila contains a reference to all the existing Databases, i.e.
 // the currently running piladb instance.
 type Pila struct {
 	Databases map[fmt.Stringer]*Database
+
+	// names maps the Databases by their name
+	names map[string]*Database
+
+	// spillDir is where Stacks that spill to
+	// disk are stored, empty if not allowed
+	spillDir string
+
+	// keys encrypt the elements of encrypted
+	// Stacks, nil if they are not allowed
+	keys *Keyring
+
+	// mu protects the access to Databases, names, spillDir and keys
+	mu sync.RWMutex
+
+	// watchers are the channels notified when the
+	// Pila changes, by id, see Changed
+	watchers    map[int]chan struct{}
+	nextWatcher int
+	watchersMu  sync.RWMutex
+
+	// watermarkFn is called with the Stacks crossing
+	// their Watermarks, if any, see OnWatermark
+	watermarkFn func(db *Database, s *Stack, e Event)
+	watermarkMu sync.RWMutex
 }
 
 // Status contains the status of the Pila instance.
@@ -25,6 +59,7 @@ func NewPila() *Pila {
 	databases := make(map[fmt.Stringer]*Database)
 	pila := &Pila{
 		Databases: databases,
+		names:     make(map[string]*Database),
 	}
 	return pila
 }
@@ -36,62 +71,186 @@ func NewPila() *Pila {
 func (p *Pila) CreateDatabase(name string) fmt.Stringer {
 	db := NewDatabase(name)
 	db.Pila = p
+
+	p.mu.Lock()
+	if old, ok := p.names[name]; ok {
+		delete(p.Databases, old.ID)
+	}
 	p.Databases[db.ID] = db
+	p.names[name] = db
+	p.mu.Unlock()
+	p.changed()
+
 	return db.ID
 }
 
 // AddDatabase adds a given Database to the Pila. It returns and error if the Database
-// already had an assigned Pila, or if the Pila already contained the Database.
+// already had an assigned Pila, or if the Pila already contained the Database, i.e.
+// another Database has its ID or its name.
 func (p *Pila) AddDatabase(db *Database) error {
 	if db.Pila != nil {
 		return errors.New("database already added to a pila")
 	}
-	if _, ok := p.Databases[db.ID]; ok {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.Databases[db.ID]; ok || p.taken(db, db.Name) || p.names[db.ID.String()] != nil {
 		return errors.New("pila already contains database")
 	}
 
 	db.Pila = p
 	p.Databases[db.ID] = db
+	p.names[db.Name] = db
+	p.changed()
 	return nil
 }
 
 // RemoveDatabase deletes a Database given an ID from the Pila and returns
 // true if it succeeded.
 func (p *Pila) RemoveDatabase(id fmt.Stringer) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	db, ok := p.Databases[id]
 	if !ok {
 		return false
 	}
 
 	delete(p.Databases, id)
+	delete(p.names, db.Name)
 	db.Pila = nil
+	db.close()
+	p.changed()
 	return true
 }
 
+// RenameDatabase renames the Database given by an ID, which keeps its
+// ID. It returns ErrNameTaken if another Database is already called
+// name, or has name as ID.
+func (p *Pila) RenameDatabase(id fmt.Stringer, name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	db, ok := p.Databases[id]
+	if !ok {
+		return fmt.Errorf("database %v not found", id)
+	}
+	if p.taken(db, name) {
+		return ErrNameTaken
+	}
+
+	delete(p.names, db.Name)
+	db.rename(name)
+	p.names[name] = db
+	p.changed()
+	return nil
+}
+
+// taken determines whether name belongs to a Database of the Pila
+// other than db, either as its name or as its ID, so looking up
+// Databases by ID or name is never ambiguous. It must be called
+// holding the lock.
+func (p *Pila) taken(db *Database, name string) bool {
+	if other, ok := p.names[name]; ok && other != db {
+		return true
+	}
+	other, ok := p.Databases[uuid.UUID(name)]
+	return ok && other != db
+}
+
 // Database determines if a Database given by an ID is part
 // of the Pila, returning a pointer to the Database and a boolean
 // flag.
 func (p *Pila) Database(id fmt.Stringer) (*Database, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	db, ok := p.Databases[id]
 	return db, ok
 }
 
+// DatabaseByName determines if a Database given by its name
+// is part of the Pila, returning a pointer to the Database
+// and a boolean flag.
+func (p *Pila) DatabaseByName(name string) (*Database, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	db, ok := p.names[name]
+	return db, ok
+}
+
+// ResolveDatabase returns the Database of the Pila given by either
+// its ID or its name, and a boolean flag. IDs are looked up first.
+func (p *Pila) ResolveDatabase(idOrName string) (*Database, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if db, ok := p.Databases[uuid.UUID(idOrName)]; ok {
+		return db, true
+	}
+	db, ok := p.names[idOrName]
+	return db, ok
+}
+
+// ForEachDatabase calls fn for each Database of the Pila, sorted
+// by name. Iteration stops if fn returns false.
+// The Databases are collected under a read lock, so fn is free to
+// call any other method of the Pila.
+func (p *Pila) ForEachDatabase(fn func(db *Database) bool) {
+	p.mu.RLock()
+	dbs := make(databasesByName, 0, len(p.Databases))
+	for _, db := range p.Databases {
+		dbs = append(dbs, db)
+	}
+	p.mu.RUnlock()
+
+	sort.Sort(dbs)
+	for _, db := range dbs {
+		if !fn(db) {
+			return
+		}
+	}
+}
+
+// Expire removes the elements of all the Stacks of the Pila
+// that are expired at date t, and returns how many were removed.
+func (p *Pila) Expire(t time.Time) int {
+	removed := 0
+	p.ForEachDatabase(func(db *Database) bool {
+		db.ForEachStack(func(s *Stack) bool {
+			removed += s.Expire(t)
+			return true
+		})
+		return true
+	})
+	return removed
+}
+
 // Status returns the status of the Pila.
 func (p *Pila) Status() Status {
-	ps := Status{}
-	ps.NumberDatabases = len(p.Databases)
+	return p.FilteredStatus(nil)
+}
 
-	dbs := make([]DatabaseStatus, len(p.Databases))
-	n := 0
-	for _, db := range p.Databases {
+// FilteredStatus returns the status of the Pila, containing only
+// the Databases for which keep returns true, or all if it is nil.
+func (p *Pila) FilteredStatus(keep func(db *Database) bool) Status {
+	ps := Status{}
+	dbs := []DatabaseStatus{}
+	p.ForEachDatabase(func(db *Database) bool {
+		if keep != nil && !keep(db) {
+			return true
+		}
 		ds := DatabaseStatus{
 			ID:           db.ID.String(),
 			Name:         db.Name,
-			NumberStacks: len(db.Stacks),
+			NumberStacks: db.numberStacks(),
 		}
-		dbs[n] = ds
-		n++
-	}
+		dbs = append(dbs, ds)
+		return true
+	})
+	ps.NumberDatabases = len(dbs)
 	ps.Databases = dbs
 
 	return ps
@@ -105,3 +264,11 @@ func (pilaStatus Status) ToJSON() []byte {
 	b, _ := json.Marshal(pilaStatus)
 	return b
 }
+
+// databasesByName implements sort.Interface to sort
+// a list of Databases by name.
+type databasesByName []*Database
+
+func (dbs databasesByName) Len() int           { return len(dbs) }
+func (dbs databasesByName) Less(i, j int) bool { return dbs[i].Name < dbs[j].Name }
+func (dbs databasesByName) Swap(i, j int)      { dbs[i], dbs[j] = dbs[j], dbs[i] }
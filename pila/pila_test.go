@@ -1,8 +1,13 @@
 package pila
 
 import (
+	"fmt"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/uuid"
 )
 
 func TestNewPila(t *testing.T) {
@@ -62,6 +67,10 @@ func TestPilaAddDatabase_Error(t *testing.T) {
 	if err := pila.AddDatabase(db2); err == nil {
 		t.Error("err is nil")
 	}
+
+	if err := pila.AddDatabase(NewDatabase(db.ID.String())); err == nil {
+		t.Error("err is nil")
+	}
 }
 
 func TestPilaRemoveDatabase(t *testing.T) {
@@ -91,6 +100,46 @@ func TestPilaRemoveDatabase_False(t *testing.T) {
 	}
 }
 
+func TestPilaRenameDatabase(t *testing.T) {
+	pila := NewPila()
+	db := NewDatabase("test")
+	_ = pila.AddDatabase(db)
+	_ = pila.AddDatabase(NewDatabase("other"))
+	stack := NewStack("stack", time.Now())
+	_ = db.AddStack(stack)
+	oldID := db.ID
+
+	if err := pila.RenameDatabase(db.ID, "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if db.Name != "renamed" || db.ID != oldID {
+		t.Errorf("database is %v %v, expected %v %v", db.Name, db.ID, "renamed", oldID)
+	}
+	if db2, ok := pila.DatabaseByName("renamed"); !ok || db2 != db {
+		t.Errorf("pila has no Database %v", "renamed")
+	}
+	if _, ok := pila.DatabaseByName("test"); ok {
+		t.Errorf("pila has Database %v", "test")
+	}
+	if s, ok := db.StackByName("stack"); !ok || s != stack {
+		t.Errorf("database has no Stack %v", "stack")
+	}
+
+	if err := pila.RenameDatabase(db.ID, "renamed"); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+	if err := pila.RenameDatabase(db.ID, "other"); err != ErrNameTaken {
+		t.Errorf("err is %v, expected %v", err, ErrNameTaken)
+	}
+	other, _ := pila.DatabaseByName("other")
+	if err := pila.RenameDatabase(db.ID, other.ID.String()); err != ErrNameTaken {
+		t.Errorf("err is %v, expected %v", err, ErrNameTaken)
+	}
+	if err := pila.RenameDatabase(uuid.New("foo"), "foo"); err == nil {
+		t.Error("err is nil, expected error")
+	}
+}
+
 func TestPilaDatabase(t *testing.T) {
 	pila := NewPila()
 	db := NewDatabase("test")
@@ -118,18 +167,158 @@ func TestPilaDatabase_False(t *testing.T) {
 	}
 }
 
+func TestPilaResolveDatabase(t *testing.T) {
+	pila := NewPila()
+	db := NewDatabase("test")
+	_ = pila.AddDatabase(db)
+
+	inputOutput := []struct {
+		input  string
+		output *Database
+	}{
+		{"test", db},
+		{db.ID.String(), db},
+		{"foo", nil},
+	}
+
+	for _, io := range inputOutput {
+		if db2, ok := pila.ResolveDatabase(io.input); db2 != io.output || ok != (io.output != nil) {
+			t.Errorf("Database is %v, %v, expected %v for %s", db2, ok, io.output, io.input)
+		}
+	}
+
+	if _, ok := pila.DatabaseByName(db.ID.String()); ok {
+		t.Errorf("pila has Database called %v", db.ID)
+	}
+	pila.RemoveDatabase(db.ID)
+	if _, ok := pila.DatabaseByName("test"); ok {
+		t.Errorf("pila has Database called %v", "test")
+	}
+}
+
+func TestPilaExpire(t *testing.T) {
+	now := time.Now()
+	pila := NewPila()
+	for _, name := range []string{"db0", "db1"} {
+		db := NewDatabase(name)
+		_ = pila.AddDatabase(db)
+		stack := NewStack("stack", now)
+		_ = db.AddStack(stack)
+		stack.Push("foo")
+		stack.PushWithExpiration("bar", now)
+	}
+
+	if removed := pila.Expire(now); removed != 2 {
+		t.Errorf("removed is %d, expected %d", removed, 2)
+	}
+}
+
+func TestPilaForEachDatabase(t *testing.T) {
+	pila := NewPila()
+	for _, name := range []string{"db2", "db0", "db1"} {
+		pila.CreateDatabase(name)
+	}
+
+	var names []string
+	pila.ForEachDatabase(func(db *Database) bool {
+		names = append(names, db.Name)
+		return true
+	})
+
+	if expected := []string{"db0", "db1", "db2"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("names are %v, expected %v", names, expected)
+	}
+}
+
+func TestPilaForEachDatabase_Stop(t *testing.T) {
+	pila := NewPila()
+	for _, name := range []string{"db2", "db0", "db1"} {
+		pila.CreateDatabase(name)
+	}
+
+	var names []string
+	pila.ForEachDatabase(func(db *Database) bool {
+		names = append(names, db.Name)
+		return db.Name != "db1"
+	})
+
+	if expected := []string{"db0", "db1"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("names are %v, expected %v", names, expected)
+	}
+}
+
+func TestPilaForEachDatabase_Concurrent(t *testing.T) {
+	pila := NewPila()
+	for i := 0; i < 10; i++ {
+		pila.CreateDatabase(fmt.Sprintf("db%d", i))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 10; i < 100; i++ {
+			pila.CreateDatabase(fmt.Sprintf("db%d", i))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			pila.RemoveDatabase(NewDatabase(fmt.Sprintf("db%d", i)).ID)
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		var last string
+		pila.ForEachDatabase(func(db *Database) bool {
+			if db.Name < last {
+				t.Errorf("database %s iterated after %s", db.Name, last)
+				return false
+			}
+			last = db.Name
+			return true
+		})
+	}
+	wg.Wait()
+}
+
 func TestPilaStatusToJSON(t *testing.T) {
 	pila := NewPila()
 	db0 := NewDatabase("db0")
 	pila.AddDatabase(db0)
 
-	expectedStatus := `{"number_of_databases":1,"databases":[{"id":"714e49277eb730717e413b167b76ef78","name":"db0","number_of_stacks":0}]}`
+	expectedStatus := fmt.Sprintf(`{"number_of_databases":1,"databases":[{"id":"%v","name":"db0","number_of_stacks":0,"memory":0}]}`, db0.ID)
 
 	if status := pila.Status().ToJSON(); string(status) != expectedStatus {
 		t.Errorf("status is %s, expected %s", string(status), expectedStatus)
 	}
 }
 
+func TestPilaStatusToJSON_Sorted(t *testing.T) {
+	pila := NewPila()
+	db1ID := pila.CreateDatabase("db1")
+	db0ID := pila.CreateDatabase("db0")
+
+	expectedStatus := fmt.Sprintf(`{"number_of_databases":2,"databases":[{"id":"%v","name":"db0","number_of_stacks":0,"memory":0},{"id":"%v","name":"db1","number_of_stacks":0,"memory":0}]}`, db0ID, db1ID)
+
+	if status := pila.Status().ToJSON(); string(status) != expectedStatus {
+		t.Errorf("status is %s, expected %s", string(status), expectedStatus)
+	}
+}
+
+func TestPilaFilteredStatus(t *testing.T) {
+	pila := NewPila()
+	db1ID := pila.CreateDatabase("db1")
+	pila.CreateDatabase("db0")
+
+	expectedStatus := fmt.Sprintf(`{"number_of_databases":1,"databases":[{"id":"%v","name":"db1","number_of_stacks":0,"memory":0}]}`, db1ID)
+
+	status := pila.FilteredStatus(func(db *Database) bool { return db.Name == "db1" })
+	if json := status.ToJSON(); string(json) != expectedStatus {
+		t.Errorf("status is %s, expected %s", string(json), expectedStatus)
+	}
+}
+
 func TestPilaStatusToJSON_Empty(t *testing.T) {
 	pila := NewPila()
 
@@ -0,0 +1,122 @@
+package pila
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// Preview describes what a destructive operation would remove, as
+// returned by the Preview functions, which do not change anything.
+type Preview struct {
+	// Databases and Stacks are the numbers of Databases
+	// and Stacks that would be deleted
+	Databases int `json:"databases"`
+	Stacks    int `json:"stacks"`
+	// Elements is the number of elements that would be removed,
+	// and Memory the approximate memory in bytes they use
+	Elements int   `json:"elements"`
+	Memory   int64 `json:"memory"`
+	// Affected are the Stacks whose elements would be removed,
+	// sorted by Database and Stack name
+	Affected []StackPreview `json:"affected"`
+}
+
+// StackPreview describes a Stack affected by a destructive operation.
+type StackPreview struct {
+	Database string `json:"database,omitempty"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Size     int    `json:"size"`
+	Memory   int64  `json:"memory"`
+}
+
+// ToJSON converts a Preview into JSON.
+func (preview Preview) ToJSON() []byte {
+	// Do not check error as the Preview type does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(preview)
+	return b
+}
+
+// add adds the elements of stack to the Preview.
+func (preview *Preview) add(stack *Stack) {
+	sp := StackPreview{
+		ID:     stack.ID.String(),
+		Name:   stack.Name,
+		Size:   stack.Size(),
+		Memory: stack.Memory(),
+	}
+	if db := stack.Database; db != nil {
+		sp.Database = db.Name
+	}
+	preview.Elements += sp.Size
+	preview.Memory += sp.Memory
+	preview.Affected = append(preview.Affected, sp)
+}
+
+// addDatabase adds db and all its Stacks to the Preview.
+func (preview *Preview) addDatabase(db *Database) {
+	preview.Databases++
+	db.ForEachStack(func(s *Stack) bool {
+		preview.Stacks++
+		preview.add(s)
+		return true
+	})
+}
+
+// PreviewFlush returns what Flush would remove from the Stack.
+func (s *Stack) PreviewFlush() Preview {
+	preview := Preview{Affected: []StackPreview{}}
+	preview.add(s)
+	return preview
+}
+
+// PreviewDelete returns what deleting the Stack would remove.
+func (s *Stack) PreviewDelete() Preview {
+	preview := s.PreviewFlush()
+	preview.Stacks = 1
+	return preview
+}
+
+// PreviewFlush returns what Flush would remove from the Database,
+// being the affected Stacks the ones that are not empty.
+func (db *Database) PreviewFlush() Preview {
+	preview := Preview{Affected: []StackPreview{}}
+	db.ForEachStack(func(s *Stack) bool {
+		if s.Size() > 0 {
+			preview.add(s)
+		}
+		return true
+	})
+	return preview
+}
+
+// PreviewDelete returns what deleting the Database,
+// along with all its Stacks, would remove.
+func (db *Database) PreviewDelete() Preview {
+	preview := Preview{Affected: []StackPreview{}}
+	preview.addDatabase(db)
+	return preview
+}
+
+// PreviewRestore reads a Pila previously written by Snapshot from r,
+// and returns what Restore would remove from the Pila, being all its
+// Databases. It returns the same error as RestoreCtx if the snapshot
+// cannot be restored.
+func (p *Pila) PreviewRestore(ctx context.Context, r io.Reader) (Preview, error) {
+	loaded, err := p.read(ctx, r)
+	if err != nil {
+		return Preview{}, err
+	}
+	for _, db := range loaded.Databases {
+		db.close()
+	}
+
+	preview := Preview{Affected: []StackPreview{}}
+	p.ForEachDatabase(func(db *Database) bool {
+		preview.addDatabase(db)
+		return true
+	})
+	return preview, nil
+}
@@ -0,0 +1,98 @@
+package pila
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStackPreview(t *testing.T) {
+	db := NewDatabase("db")
+	stack := NewStack("stack", time.Now())
+	_ = db.AddStack(stack)
+	stack.Push("foo")
+	stack.Push("bar")
+
+	affected := []StackPreview{{Database: "db", ID: stack.ID.String(), Name: "stack", Size: 2, Memory: stack.Memory()}}
+	inputOutput := []struct {
+		input  Preview
+		output Preview
+	}{
+		{stack.PreviewFlush(), Preview{Elements: 2, Memory: stack.Memory(), Affected: affected}},
+		{stack.PreviewDelete(), Preview{Stacks: 1, Elements: 2, Memory: stack.Memory(), Affected: affected}},
+	}
+
+	for _, io := range inputOutput {
+		if !reflect.DeepEqual(io.input, io.output) {
+			t.Errorf("preview is %v, expected %v", io.input, io.output)
+		}
+	}
+	if stack.Size() != 2 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 2)
+	}
+}
+
+func TestDatabasePreview(t *testing.T) {
+	db := NewDatabase("db")
+	full := NewStack("full", time.Now())
+	empty := NewStack("empty", time.Now())
+	_ = db.AddStack(full)
+	_ = db.AddStack(empty)
+	full.Push("foo")
+
+	flush := db.PreviewFlush()
+	if flush.Stacks != 0 || flush.Elements != 1 || len(flush.Affected) != 1 || flush.Affected[0].Name != "full" {
+		t.Errorf("flush preview is %v, expected only %s affected", flush, "full")
+	}
+
+	del := db.PreviewDelete()
+	if del.Databases != 1 || del.Stacks != 2 || del.Elements != 1 || del.Memory != full.Memory() || len(del.Affected) != 2 {
+		t.Errorf("delete preview is %v, expected %d stacks affected", del, 2)
+	}
+	if del.Affected[0].Name != "empty" || del.Affected[1].Name != "full" {
+		t.Errorf("affected stacks are %v, expected sorted by name", del.Affected)
+	}
+	if full.Size() != 1 {
+		t.Errorf("stack size is %d, expected %d", full.Size(), 1)
+	}
+}
+
+func TestPilaPreviewRestore(t *testing.T) {
+	p := NewPila()
+	db := NewDatabase("db")
+	_ = p.AddDatabase(db)
+	stack := NewStack("stack", time.Now())
+	_ = db.AddStack(stack)
+	stack.Push("foo")
+
+	var buf bytes.Buffer
+	if err := NewPila().Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	preview, err := p.PreviewRestore(context.Background(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Databases != 1 || preview.Stacks != 1 || preview.Elements != 1 {
+		t.Errorf("preview is %v, expected %d database removed", preview, 1)
+	}
+	if _, ok := p.Database(db.ID); !ok || stack.Size() != 1 {
+		t.Error("pila changed on preview")
+	}
+
+	if _, err := p.PreviewRestore(context.Background(), strings.NewReader("foo")); err == nil {
+		t.Error("err is nil, expected an error")
+	}
+}
+
+func TestPreviewToJSON(t *testing.T) {
+	preview := Preview{Databases: 1, Affected: []StackPreview{}}
+	expected := `{"databases":1,"stacks":0,"elements":0,"memory":0,"affected":[]}`
+	if b := preview.ToJSON(); string(b) != expected {
+		t.Errorf("preview JSON is %s, expected %s", b, expected)
+	}
+}
@@ -0,0 +1,187 @@
+package pila
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/protobuf"
+)
+
+// The encodings of this file follow the messages of proto/piladb.proto.
+
+// protoTime returns a date as a Unix time in nanoseconds,
+// or 0 if it is zero.
+func protoTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// appendProtoTime appends a date field, if not nil.
+func appendProtoTime(b []byte, field int, t *time.Time) []byte {
+	if t == nil {
+		return b
+	}
+	return protobuf.AppendInt(b, field, protoTime(*t))
+}
+
+// ToProto converts an Element into a protobuf Element message.
+func (element Element) ToProto() ([]byte, error) {
+	var b []byte
+	if data, ok := element.Value.([]byte); ok && element.ContentType != "" {
+		b = protobuf.AppendBytes(b, 1, data)
+	} else {
+		value := []byte(element.raw)
+		if value == nil {
+			var err error
+			if value, err = json.Marshal(element.Value); err != nil {
+				return nil, err
+			}
+		}
+		b = protobuf.AppendBytes(b, 1, value)
+	}
+	if element.Priority != nil {
+		b = protobuf.AppendDouble(b, 2, *element.Priority)
+	}
+	if element.ContentType != "" {
+		b = protobuf.AppendString(b, 3, element.ContentType)
+	}
+	return b, nil
+}
+
+// DecodeProto decodes a protobuf Element message into an Element.
+// Its value is decoded from JSON, unless it has a content type.
+// It returns an error if the value is missing.
+func (element *Element) DecodeProto(b []byte) error {
+	var value []byte
+	r := protobuf.NewReader(b)
+	for {
+		field, _, ok := r.Next()
+		if !ok {
+			break
+		}
+		switch field {
+		case 1:
+			value = r.Bytes()
+		case 2:
+			priority := r.Double()
+			element.Priority = &priority
+		case 3:
+			element.ContentType = r.String()
+		default:
+			r.Skip()
+		}
+	}
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		return errors.New("missing element value")
+	}
+
+	// b may be reused after decoding, so the value is copied
+	value = append([]byte(nil), value...)
+	if element.ContentType != "" {
+		element.Value, element.raw = value, nil
+		return nil
+	}
+	return element.decodeValue(value)
+}
+
+// ToProto converts a StackStatus into a protobuf StackStatus message.
+func (stackStatus StackStatus) ToProto() ([]byte, error) {
+	peek, err := json.Marshal(stackStatus.Peek)
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	b = protobuf.AppendString(b, 1, stackStatus.ID)
+	b = protobuf.AppendString(b, 2, stackStatus.Name)
+	b = protobuf.AppendBytes(b, 3, peek)
+	b = protobuf.AppendInt(b, 4, int64(stackStatus.Size))
+	b = protobuf.AppendInt(b, 5, int64(stackStatus.SizeApprox))
+	b = protobuf.AppendUint(b, 6, stackStatus.Version)
+	b = protobuf.AppendInt(b, 7, int64(stackStatus.PeakSize))
+	b = protobuf.AppendInt(b, 8, stackStatus.Pushes)
+	b = protobuf.AppendInt(b, 9, stackStatus.Pops)
+	b = protobuf.AppendInt(b, 10, stackStatus.Memory)
+	b = protobuf.AppendInt(b, 11, protoTime(stackStatus.CreatedAt))
+	b = protobuf.AppendInt(b, 12, protoTime(stackStatus.UpdatedAt))
+	b = protobuf.AppendInt(b, 13, protoTime(stackStatus.ReadAt))
+	b = appendProtoTime(b, 14, stackStatus.PushedAt)
+	b = appendProtoTime(b, 15, stackStatus.PoppedAt)
+	b = protobuf.AppendString(b, 16, string(stackStatus.Type))
+	b = protobuf.AppendInt(b, 17, int64(stackStatus.MaxSize))
+	b = protobuf.AppendString(b, 18, string(stackStatus.Policy))
+	b = protobuf.AppendInt(b, 19, int64(stackStatus.RateLimit))
+	b = protobuf.AppendInt(b, 20, int64(stackStatus.Spill))
+	b = protobuf.AppendString(b, 21, string(stackStatus.Unique))
+	b = protobuf.AppendInt(b, 22, int64(stackStatus.History))
+	b = protobuf.AppendInt(b, 23, int64(stackStatus.Compress))
+	b = protobuf.AppendBool(b, 24, stackStatus.Archived)
+	b = appendProtoTime(b, 25, stackStatus.LockedUntil)
+	b = protobuf.AppendString(b, 26, stackStatus.TTL)
+	b = protobuf.AppendBool(b, 27, stackStatus.Encrypted)
+	if w := stackStatus.Watermarks; w != nil {
+		b = protobuf.AppendInt(b, 28, int64(w.High))
+		b = protobuf.AppendInt(b, 29, int64(w.Low))
+	}
+	b = protobuf.AppendString(b, 30, stackStatus.Store)
+	return b, nil
+}
+
+// ToProto converts a StacksStatus into a protobuf StacksStatus message.
+func (stacksStatus StacksStatus) ToProto() ([]byte, error) {
+	var b []byte
+	for _, stackStatus := range stacksStatus.Stacks {
+		s, err := stackStatus.ToProto()
+		if err != nil {
+			return nil, err
+		}
+		b = protobuf.AppendBytes(b, 1, s)
+	}
+	return b, nil
+}
+
+// ToProto converts a DatabaseStatus into a protobuf DatabaseStatus message.
+func (databaseStatus DatabaseStatus) ToProto() []byte {
+	var b []byte
+	b = protobuf.AppendString(b, 1, databaseStatus.ID)
+	b = protobuf.AppendString(b, 2, databaseStatus.Name)
+	b = protobuf.AppendInt(b, 3, int64(databaseStatus.NumberStacks))
+	for _, stack := range databaseStatus.Stacks {
+		b = protobuf.AppendString(b, 4, stack)
+	}
+	b = protobuf.AppendInt(b, 5, databaseStatus.Memory)
+	b = protobuf.AppendInt(b, 6, databaseStatus.MaxMemory)
+	b = protobuf.AppendInt(b, 7, int64(databaseStatus.Spill))
+	return b
+}
+
+// ToProto converts Stats into a protobuf Stats message.
+func (stats Stats) ToProto() []byte {
+	var b []byte
+	b = protobuf.AppendInt(b, 1, int64(stats.NumberDatabases))
+	b = protobuf.AppendInt(b, 2, int64(stats.NumberStacks))
+	b = protobuf.AppendInt(b, 3, int64(stats.Size))
+	b = protobuf.AppendInt(b, 4, int64(stats.PeakSize))
+	b = protobuf.AppendInt(b, 5, stats.Pushes)
+	b = protobuf.AppendInt(b, 6, stats.Pops)
+	b = protobuf.AppendInt(b, 7, stats.Memory)
+	b = appendProtoTime(b, 8, stats.PushedAt)
+	b = appendProtoTime(b, 9, stats.PoppedAt)
+	return b
+}
+
+// ToProto converts Percentiles into a protobuf Percentiles message.
+func (percentiles Percentiles) ToProto() []byte {
+	var b []byte
+	b = protobuf.AppendUint(b, 1, percentiles.Count)
+	b = protobuf.AppendDouble(b, 2, percentiles.P50)
+	b = protobuf.AppendDouble(b, 3, percentiles.P95)
+	b = protobuf.AppendDouble(b, 4, percentiles.P99)
+	return b
+}
@@ -0,0 +1,209 @@
+package pila
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/protobuf"
+)
+
+// protoFields decodes the fields of a message, keeping the values of
+// repeated ones in order. Varints are decoded as uint64, fixed64 as
+// float64, and bytes as string.
+func protoFields(t *testing.T, b []byte) map[int][]interface{} {
+	fields := make(map[int][]interface{})
+	r := protobuf.NewReader(b)
+	for {
+		field, wire, ok := r.Next()
+		if !ok {
+			break
+		}
+		var v interface{}
+		switch wire {
+		case protobuf.WireVarint:
+			v = r.Uint()
+		case protobuf.WireFixed64:
+			v = r.Double()
+		case protobuf.WireBytes:
+			v = r.String()
+		default:
+			r.Skip()
+		}
+		fields[field] = append(fields[field], v)
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+func TestElementToProto(t *testing.T) {
+	priority := 2.5
+	inputOutput := []struct {
+		input  Element
+		output map[int][]interface{}
+	}{
+		{Element{Value: "foo"}, map[int][]interface{}{1: {`"foo"`}}},
+		{Element{Value: map[string]interface{}{"one": 1.0}, Priority: &priority}, map[int][]interface{}{1: {`{"one":1}`}, 2: {2.5}}},
+		{Element{Value: []byte("hello"), ContentType: "text/plain"}, map[int][]interface{}{1: {"hello"}, 3: {"text/plain"}}},
+	}
+
+	for _, io := range inputOutput {
+		b, err := io.input.ToProto()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fields := protoFields(t, b); !reflect.DeepEqual(fields, io.output) {
+			t.Errorf("fields are %v, expected %v", fields, io.output)
+		}
+	}
+
+	if _, err := (Element{Value: make(chan int)}).ToProto(); err == nil {
+		t.Error("err is nil, expected UnsupportedTypeError")
+	}
+}
+
+func TestElementDecodeProto(t *testing.T) {
+	priority := 2.5
+	elements := []Element{
+		{Value: "foo"},
+		{Value: map[string]interface{}{"one": 1.0}, Priority: &priority},
+		{Value: []byte("hello"), ContentType: "text/plain"},
+	}
+
+	for _, expected := range elements {
+		b, _ := expected.ToProto()
+		var element Element
+		if err := element.DecodeProto(b); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(element.Value, expected.Value) || !reflect.DeepEqual(element.Priority, expected.Priority) || element.ContentType != expected.ContentType {
+			t.Errorf("element is %v, expected %v", element, expected)
+		}
+
+		// the element does not keep the message
+		for i := range b {
+			b[i] = 0
+		}
+		if !reflect.DeepEqual(element.Value, expected.Value) {
+			t.Errorf("element value is %v after reusing the message, expected %v", element.Value, expected.Value)
+		}
+	}
+}
+
+func TestElementDecodeProto_Error(t *testing.T) {
+	inputs := [][]byte{
+		nil,
+		protobuf.AppendString(nil, 3, "text/plain"),
+		protobuf.AppendString(nil, 1, "{"),
+		{0x0a, 0x05, '"'},
+	}
+
+	for _, input := range inputs {
+		var element Element
+		if err := element.DecodeProto(input); err == nil {
+			t.Errorf("%x: err is nil, expected error", input)
+		}
+	}
+}
+
+func TestStackStatusToProto(t *testing.T) {
+	now := time.Now()
+	stack := NewStack("stack", now)
+	stack.TTL = 90 * time.Minute
+	_ = stack.Push("foo")
+	status := stack.Status()
+
+	b, err := status.ToProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := protoFields(t, b)
+	if fields[1][0] != status.ID || fields[2][0] != "stack" || fields[3][0] != `"foo"` || fields[4][0] != uint64(1) {
+		t.Errorf("fields are %v", fields)
+	}
+	if fields[11][0] != uint64(now.UnixNano()) || fields[14][0] != uint64(status.PushedAt.UnixNano()) {
+		t.Errorf("dates are %v and %v", fields[11], fields[14])
+	}
+	if _, ok := fields[15]; ok {
+		t.Errorf("popped_at is %v, expected none", fields[15])
+	}
+	if fields[26][0] != "1h30m0s" {
+		t.Errorf("ttl is %v, expected %v", fields[26][0], "1h30m0s")
+	}
+	if fields[27][0] != uint64(0) {
+		t.Errorf("encrypted is %v, expected %v", fields[27][0], 0)
+	}
+	if _, ok := fields[28]; ok {
+		t.Errorf("high_watermark is %v, expected none", fields[28])
+	}
+
+	watermarked := status
+	watermarked.Watermarks = &Watermarks{High: 10, Low: NoWatermark}
+	b, err = watermarked.ToProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields := protoFields(t, b); fields[28][0] != uint64(10) || fields[29][0] != ^uint64(0) {
+		t.Errorf("watermarks are %v and %v, expected %v and %v", fields[28], fields[29], 10, -1)
+	}
+
+	stacks := StacksStatus{Stacks: []StackStatus{status, status}}
+	b, err = stacks.ToProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields := protoFields(t, b); len(fields[1]) != 2 {
+		t.Errorf("stacks are %v, expected 2 of them", fields[1])
+	}
+
+	status.Peek = make(chan int)
+	if _, err := status.ToProto(); err == nil {
+		t.Error("err is nil, expected UnsupportedTypeError")
+	}
+	if _, err := (StacksStatus{Stacks: []StackStatus{status}}).ToProto(); err == nil {
+		t.Error("err is nil, expected UnsupportedTypeError")
+	}
+}
+
+func TestDatabaseStatusToProto(t *testing.T) {
+	status := DatabaseStatus{ID: "id", Name: "db", NumberStacks: 2, Stacks: []string{"a", "b"}, Memory: 10}
+	expected := map[int][]interface{}{
+		1: {"id"},
+		2: {"db"},
+		3: {uint64(2)},
+		4: {"a", "b"},
+		5: {uint64(10)},
+		6: {uint64(0)},
+		7: {uint64(0)},
+	}
+	if fields := protoFields(t, status.ToProto()); !reflect.DeepEqual(fields, expected) {
+		t.Errorf("fields are %v, expected %v", fields, expected)
+	}
+}
+
+func TestStatsToProto(t *testing.T) {
+	now := time.Now()
+	stats := Stats{NumberDatabases: 1, NumberStacks: 2, Size: 3, PushedAt: &now}
+	fields := protoFields(t, stats.ToProto())
+	if fields[1][0] != uint64(1) || fields[2][0] != uint64(2) || fields[3][0] != uint64(3) || fields[8][0] != uint64(now.UnixNano()) {
+		t.Errorf("fields are %v", fields)
+	}
+	if _, ok := fields[9]; ok {
+		t.Errorf("popped_at is %v, expected none", fields[9])
+	}
+}
+
+func TestPercentilesToProto(t *testing.T) {
+	percentiles := Percentiles{Count: 3, P50: 0.5, P95: 1.5, P99: 2}
+	expected := map[int][]interface{}{
+		1: {uint64(3)},
+		2: {0.5},
+		3: {1.5},
+		4: {2.0},
+	}
+	if fields := protoFields(t, percentiles.ToProto()); !reflect.DeepEqual(fields, expected) {
+		t.Errorf("fields are %v, expected %v", fields, expected)
+	}
+}
@@ -0,0 +1,62 @@
+package pila
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// RateWindow is the sliding window over which
+	// the rates of operations on Stacks are measured.
+	RateWindow = time.Minute
+	// rateBuckets is the number of buckets of a rateCounter,
+	// each of them counting the operations of a slice of
+	// the RateWindow.
+	rateBuckets = 12
+)
+
+// rateCounter counts operations in a sliding window, as a ring
+// of buckets. The zero value is an empty rateCounter.
+type rateCounter struct {
+	counts [rateBuckets]int64
+	// slots are the slices of the RateWindow, since the
+	// Unix epoch, counted by the buckets
+	slots [rateBuckets]int64
+
+	mu sync.Mutex
+}
+
+// rateSlot returns the slice of the RateWindow t belongs to.
+func rateSlot(t time.Time) int64 {
+	return t.UnixNano() / int64(RateWindow/rateBuckets)
+}
+
+// add counts an operation at time now.
+func (rc *rateCounter) add(now time.Time) {
+	slot := rateSlot(now)
+	i := slot % rateBuckets
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.slots[i] != slot {
+		rc.slots[i] = slot
+		rc.counts[i] = 0
+	}
+	rc.counts[i]++
+}
+
+// rate returns the operations per second counted
+// in the RateWindow until now.
+func (rc *rateCounter) rate(now time.Time) float64 {
+	slot := rateSlot(now)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	var count int64
+	for i := range rc.counts {
+		if slot-rc.slots[i] < rateBuckets {
+			count += rc.counts[i]
+		}
+	}
+	return float64(count) / RateWindow.Seconds()
+}
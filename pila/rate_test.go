@@ -0,0 +1,55 @@
+package pila
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateCounter(t *testing.T) {
+	var rc rateCounter
+	now := time.Unix(1000, 0)
+	if rate := rc.rate(now); rate != 0 {
+		t.Errorf("rate is %v, expected 0", rate)
+	}
+
+	for i := 0; i < 30; i++ {
+		rc.add(now)
+	}
+	for i := 0; i < 30; i++ {
+		rc.add(now.Add(RateWindow / 2))
+	}
+
+	inputOutput := []struct {
+		input  time.Time
+		output float64
+	}{
+		{now, 1},
+		{now.Add(RateWindow / 2), 1},
+		{now.Add(RateWindow), 0.5},
+		{now.Add(RateWindow * 3 / 2), 0},
+	}
+	for _, io := range inputOutput {
+		if rate := rc.rate(io.input); rate != io.output {
+			t.Errorf("rate is %v, expected %v at %v", rate, io.output, io.input)
+		}
+	}
+
+	// buckets are reused once their slot is out of the window
+	rc.add(now.Add(RateWindow * 2))
+	if rate := rc.rate(now.Add(RateWindow * 2)); rate != 1/RateWindow.Seconds() {
+		t.Errorf("rate is %v, expected %v", rate, 1/RateWindow.Seconds())
+	}
+}
+
+func TestStackRates(t *testing.T) {
+	stack := NewStack("stack", time.Now())
+	_ = stack.PushN([]interface{}{1, 2, 3})
+	stack.Pop()
+
+	if rate := stack.PushRate(); rate != 3/RateWindow.Seconds() {
+		t.Errorf("push rate is %v, expected %v", rate, 3/RateWindow.Seconds())
+	}
+	if rate := stack.PopRate(); rate != 1/RateWindow.Seconds() {
+		t.Errorf("pop rate is %v, expected %v", rate, 1/RateWindow.Seconds())
+	}
+}
@@ -0,0 +1,143 @@
+package pila
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Query is a search of the elements of a Stack, created with ParseQuery.
+type Query struct {
+	// path is the field path of a JSONPath query, empty for substrings
+	path []string
+	// value is the JSON encoded value the field is compared to,
+	// nil if the field only needs to exist, or the substring
+	value []byte
+}
+
+// ParseQuery parses a query of elements, which is either a simple
+// JSONPath expression, such as $.user.name == "ada", matching JSON
+// objects with such field equal to the value, or just $.user.name,
+// matching the ones having the field, or otherwise a substring of
+// the elements. The value is given in JSON, or as a bare string.
+func ParseQuery(q string) (Query, error) {
+	if q == "" {
+		return Query{}, errors.New("empty query")
+	}
+	if !strings.HasPrefix(q, "$.") {
+		return Query{value: []byte(q)}, nil
+	}
+
+	path, value := q[2:], ""
+	hasValue := false
+	if i := strings.Index(path, "=="); i >= 0 {
+		path, value, hasValue = path[:i], strings.TrimSpace(path[i+2:]), true
+	}
+
+	var query Query
+	for _, field := range strings.Split(strings.TrimSpace(path), ".") {
+		if field == "" {
+			return Query{}, errors.New("invalid field path " + path)
+		}
+		query.path = append(query.path, field)
+	}
+	if !hasValue {
+		return query, nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		v = value
+	}
+	// Do not check error as the value is either
+	// decoded from JSON, or a string.
+	query.value, _ = json.Marshal(v)
+	return query, nil
+}
+
+// Match returns whether a value of an element matches the Query.
+func (q Query) Match(value interface{}) bool {
+	if q.path == nil {
+		return q.contains(value)
+	}
+
+	for _, field := range q.path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if value, ok = object[field]; !ok {
+			return false
+		}
+	}
+	if q.value == nil {
+		return true
+	}
+
+	b, err := json.Marshal(value)
+	return err == nil && bytes.Equal(b, q.value)
+}
+
+// contains returns whether value contains the substring
+// of the Query, or its JSON encoding does.
+func (q Query) contains(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.Contains(v, string(q.value))
+	case []byte:
+		return bytes.Contains(v, q.value)
+	}
+
+	b, err := json.Marshal(value)
+	return err == nil && bytes.Contains(b, q.value)
+}
+
+// SearchMatch is an element of a Stack matching a Query.
+type SearchMatch struct {
+	// Depth is the position of the element in the Stack,
+	// 0 being the next element to be popped
+	Depth int         `json:"depth"`
+	Value interface{} `json:"element"`
+}
+
+// Search returns up to limit elements of the Stack matching q, ordered
+// by depth, and the total number of matching elements. The elements
+// are matched as the Stack is iterated, keeping only the returned
+// ones, so big Stacks are searched without copying them. Elements of a
+// StructurePriority are ordered from the last pushed instead, and so
+// is their depth. Expired elements are removed before searching.
+func (s *Stack) Search(q Query, limit int) ([]SearchMatch, int) {
+	s.Expire(time.Now())
+
+	// Range starts from the back of a StructureQueue, so
+	// only the last matches are kept, and reversed later
+	fromBack := s.Type == StructureQueue
+
+	var matches []SearchMatch
+	var total, depth int
+	s.base.Range(func(element interface{}) bool {
+		value, _ := unwrap(element, time.Time{})
+		if q.Match(value) {
+			total++
+			match := SearchMatch{Depth: depth, Value: value}
+			switch {
+			case len(matches) < limit:
+				matches = append(matches, match)
+			case fromBack && limit > 0:
+				matches = append(matches[1:], match)
+			}
+		}
+		depth++
+		return true
+	})
+
+	if fromBack {
+		for i, j := 0, len(matches)-1; i <= j; i, j = i+1, j-1 {
+			matches[i], matches[j] = matches[j], matches[i]
+			matches[i].Depth, matches[j].Depth = depth-1-matches[i].Depth, depth-1-matches[j].Depth
+		}
+	}
+	return matches, total
+}
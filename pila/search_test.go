@@ -0,0 +1,97 @@
+package pila
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	user := map[string]interface{}{
+		"name": "ada",
+		"age":  36.0,
+		"tags": []interface{}{"math"},
+	}
+	element := map[string]interface{}{"user": user, "admin": true}
+
+	inputOutput := []struct {
+		input  string
+		value  interface{}
+		output bool
+	}{
+		{"ada", "adams", true},
+		{"ada", "bob", false},
+		{"ada", []byte("ada"), true},
+		{"ada", element, true},
+		{"36", element, true},
+		{"37", 8, false},
+		{`$.user.name == "ada"`, element, true},
+		{"$.user.name==ada", element, true},
+		{"$.user.name == bob", element, false},
+		{"$.user.age == 36", element, true},
+		{"$.user.age == 36", map[string]interface{}{"user": map[string]interface{}{"age": 36}}, true},
+		{`$.user.tags == ["math"]`, element, true},
+		{"$.admin == true", element, true},
+		{"$.admin == false", element, false},
+		{"$.admin", element, true},
+		{"$.user.email", element, false},
+		{"$.user.name.first", element, false},
+		{"$.user", "ada", false},
+	}
+
+	for _, io := range inputOutput {
+		q, err := ParseQuery(io.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match := q.Match(io.value); match != io.output {
+			t.Errorf("match is %v, expected %v for %s on %v", match, io.output, io.input, io.value)
+		}
+	}
+}
+
+func TestParseQuery_Error(t *testing.T) {
+	for _, input := range []string{"", "$.", "$.user..name", "$. == 8"} {
+		if _, err := ParseQuery(input); err == nil {
+			t.Errorf("err is nil for %q", input)
+		}
+	}
+}
+
+func TestStackSearch(t *testing.T) {
+	q, _ := ParseQuery("a")
+	now := time.Now().UTC()
+
+	stack := NewStack("stack", now)
+	queue := NewQueue("queue", now)
+	for _, s := range []*Stack{stack, queue} {
+		for _, element := range []string{"a1", "b", "a2", "c", "a3"} {
+			s.Push(element)
+		}
+		s.PushWithExpiration("a4", now.Add(-time.Second))
+	}
+
+	inputOutput := []struct {
+		stack  *Stack
+		limit  int
+		output []SearchMatch
+	}{
+		{stack, 10, []SearchMatch{{0, "a3"}, {2, "a2"}, {4, "a1"}}},
+		{stack, 2, []SearchMatch{{0, "a3"}, {2, "a2"}}},
+		{queue, 10, []SearchMatch{{0, "a1"}, {2, "a2"}, {4, "a3"}}},
+		{queue, 2, []SearchMatch{{0, "a1"}, {2, "a2"}}},
+		{queue, 1, []SearchMatch{{0, "a1"}}},
+		{stack, 0, nil},
+		{queue, 0, nil},
+	}
+
+	for _, io := range inputOutput {
+		matches, total := io.stack.Search(q, io.limit)
+		if !reflect.DeepEqual(matches, io.output) || total != 3 {
+			t.Errorf("matches are %v and %d, expected %v and %d", matches, total, io.output, 3)
+		}
+	}
+	if stack.Size() != 5 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 5)
+	}
+}
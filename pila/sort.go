@@ -0,0 +1,171 @@
+package pila
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/stack"
+)
+
+// SortOrder is the order in which Sort leaves the elements
+// of a Stack, from its top.
+type SortOrder string
+
+const (
+	// SortAscending leaves the smallest element on top of the Stack.
+	SortAscending SortOrder = "asc"
+	// SortDescending leaves the greatest element on top of the Stack.
+	SortDescending SortOrder = "desc"
+)
+
+// reorderer returns the base of the Stack as a stack.Reorderer, after
+// removing its expired elements. Priority Stacks are ordered by their
+// priorities and Stacks spilling to disk do not keep their elements
+// in memory, so they are not supported.
+func (s *Stack) reorderer() (stack.Reorderer, error) {
+	r, ok := s.base.(stack.Reorderer)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	s.Expire(time.Now())
+	return r, nil
+}
+
+// Reverse reverses the order of the elements of the
+// Stack, so the one at its bottom is on top.
+func (s *Stack) Reverse() error {
+	r, err := s.reorderer()
+	if err != nil {
+		return err
+	}
+
+	// Do not check error as the elements
+	// are always reversed.
+	r.Reorder(func(elements []interface{}) error {
+		for i, j := 0, len(elements)-1; i < j; i, j = i+1, j-1 {
+			elements[i], elements[j] = elements[j], elements[i]
+		}
+		return nil
+	})
+	s.notify(Event{Op: EventReverse})
+	return nil
+}
+
+// Sort sorts the elements of the Stack in order, comparing the field
+// by of the JSON objects, which may be a path such as user.age, or the
+// elements themselves if by is empty. The compared values must be
+// either all numbers or all strings. Otherwise, e.g. if an element
+// is Binary or has no such field, the Stack is not modified and an
+// error describing the element is returned. The sort is stable.
+func (s *Stack) Sort(by string, order SortOrder) error {
+	if order != SortAscending && order != SortDescending {
+		return fmt.Errorf("invalid sort order %q, expected %s or %s", order, SortAscending, SortDescending)
+	}
+	var path []string
+	if by != "" {
+		path = strings.Split(by, ".")
+		for _, field := range path {
+			if field == "" {
+				return fmt.Errorf("invalid field path %s", by)
+			}
+		}
+	}
+
+	r, err := s.reorderer()
+	if err != nil {
+		return err
+	}
+
+	err = r.Reorder(func(elements []interface{}) error {
+		keys, err := sortKeys(elements, path)
+		if err != nil {
+			return err
+		}
+		sort.Stable(byKey{keys: keys, elements: elements, desc: order == SortDescending})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.notify(Event{Op: EventSort})
+	return nil
+}
+
+// sortKey is the value an element of a Stack is sorted by,
+// either a number or a string.
+type sortKey struct {
+	number   float64
+	str      string
+	isString bool
+}
+
+// sortKeys returns the sortKeys of elements, being the field at path
+// of their values, or an error if they can not be compared.
+func sortKeys(elements []interface{}, path []string) ([]sortKey, error) {
+	keys := make([]sortKey, len(elements))
+	for i, element := range elements {
+		value, _ := unwrap(element, time.Time{})
+		if _, ok := value.(Binary); ok {
+			return nil, fmt.Errorf("element %d is binary, not JSON", i)
+		}
+
+		for j, field := range path {
+			object, ok := value.(map[string]interface{})
+			if !ok && j == 0 {
+				return nil, fmt.Errorf("element %d is not a JSON object", i)
+			}
+			if !ok {
+				return nil, fmt.Errorf("element %d is not a JSON object at %s", i, strings.Join(path[:j], "."))
+			}
+			if value, ok = object[field]; !ok {
+				return nil, fmt.Errorf("element %d has no field %s", i, strings.Join(path[:j+1], "."))
+			}
+		}
+
+		switch v := value.(type) {
+		case string:
+			keys[i] = sortKey{str: v, isString: true}
+		case float64:
+			keys[i] = sortKey{number: v}
+		case int:
+			keys[i] = sortKey{number: float64(v)}
+		case int64:
+			keys[i] = sortKey{number: float64(v)}
+		case uint64:
+			keys[i] = sortKey{number: float64(v)}
+		default:
+			return nil, fmt.Errorf("element %d is neither a number nor a string", i)
+		}
+		if keys[i].isString != keys[0].isString {
+			return nil, fmt.Errorf("element %d can not be compared with element 0, as they are a number and a string", i)
+		}
+	}
+	return keys, nil
+}
+
+// byKey implements sort.Interface to sort
+// elements by their sortKeys.
+type byKey struct {
+	keys     []sortKey
+	elements []interface{}
+	desc     bool
+}
+
+func (b byKey) Len() int { return len(b.keys) }
+
+func (b byKey) Less(i, j int) bool {
+	if b.desc {
+		i, j = j, i
+	}
+	if b.keys[i].isString {
+		return b.keys[i].str < b.keys[j].str
+	}
+	return b.keys[i].number < b.keys[j].number
+}
+
+func (b byKey) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+	b.elements[i], b.elements[j] = b.elements[j], b.elements[i]
+}
@@ -0,0 +1,148 @@
+package pila
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStackReverse(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+	_ = stack.PushN([]interface{}{"foo", 8, "bar"})
+	_ = stack.PushWithExpiration("expired", time.Now().Add(-time.Second))
+	version := stack.Version()
+
+	var events []Event
+	stack.Subscribe(func(e Event) {
+		events = append(events, e)
+	})
+
+	if err := stack.Reverse(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []interface{}{"foo", 8, "bar"}; !reflect.DeepEqual(stack.Elements(0, 10), expected) {
+		t.Errorf("elements are %v, expected %v", stack.Elements(0, 10), expected)
+	}
+	if stack.Version() <= version {
+		t.Errorf("stack.Version() is %d, expected greater than %d", stack.Version(), version)
+	}
+	if expected := []Event{{Op: EventReverse}}; !reflect.DeepEqual(events, expected) {
+		t.Errorf("events are %v, expected %v", events, expected)
+	}
+
+	queue := NewQueue("test-queue", time.Now())
+	_ = queue.PushN([]interface{}{"foo", 8, "bar"})
+	if err := queue.Reverse(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []interface{}{"bar", 8, "foo"}; !reflect.DeepEqual(queue.Elements(0, 10), expected) {
+		t.Errorf("elements are %v, expected %v", queue.Elements(0, 10), expected)
+	}
+}
+
+func TestStackReverse_Unsupported(t *testing.T) {
+	priority := NewPriority("test-priority", time.Now())
+	if err := priority.Reverse(); err != ErrUnsupported {
+		t.Errorf("err is %v, expected %v", err, ErrUnsupported)
+	}
+	if err := priority.Sort("", SortAscending); err != ErrUnsupported {
+		t.Errorf("err is %v, expected %v", err, ErrUnsupported)
+	}
+
+	dir, err := ioutil.TempDir("", "piladb-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spill, err := NewSpillStack("test-spill", time.Now(), dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.close()
+	if err := spill.Reverse(); err != ErrUnsupported {
+		t.Errorf("err is %v, expected %v", err, ErrUnsupported)
+	}
+}
+
+func TestStackSort(t *testing.T) {
+	ada := map[string]interface{}{"name": "ada", "age": 36.0}
+	alan := map[string]interface{}{"name": "alan", "age": 41.0}
+	grace := map[string]interface{}{"name": "grace", "age": 36.0}
+	users := []interface{}{alan, ada, grace}
+
+	inputOutput := []struct {
+		elements []interface{}
+		by       string
+		order    SortOrder
+		output   []interface{}
+	}{
+		{[]interface{}{2.0, 3, "x"}, "", SortAscending, nil},
+		{[]interface{}{2.0, 3, 1.5}, "", SortAscending, []interface{}{1.5, 2.0, 3}},
+		{[]interface{}{2.0, 3, 1.5}, "", SortDescending, []interface{}{3, 2.0, 1.5}},
+		{[]interface{}{"b", "c", "a"}, "", SortAscending, []interface{}{"a", "b", "c"}},
+		// the last pushed ada is on top, so it keeps
+		// preceding grace, as the sort is stable
+		{users, "age", SortAscending, []interface{}{grace, ada, alan}},
+		{users, "age", SortDescending, []interface{}{alan, grace, ada}},
+		{users, "name", SortAscending, []interface{}{ada, alan, grace}},
+		{[]interface{}{map[string]interface{}{"user": ada}, map[string]interface{}{"user": alan}}, "user.age", SortDescending,
+			[]interface{}{map[string]interface{}{"user": alan}, map[string]interface{}{"user": ada}}},
+		{[]interface{}{}, "age", SortAscending, []interface{}{}},
+	}
+
+	for _, io := range inputOutput {
+		stack := NewStack("test-stack", time.Now())
+		_ = stack.PushN(io.elements)
+
+		err := stack.Sort(io.by, io.order)
+		if io.output == nil {
+			if err == nil {
+				t.Errorf("stack.Sort(%q, %q) of %v is nil, expected error", io.by, io.order, io.elements)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("stack.Sort(%q, %q) of %v is %v, expected nil", io.by, io.order, io.elements, err)
+			continue
+		}
+		if elements := stack.Elements(0, 10); !reflect.DeepEqual(elements, io.output) {
+			t.Errorf("elements are %v, expected %v", elements, io.output)
+		}
+	}
+}
+
+func TestStackSort_Error(t *testing.T) {
+	binary := Binary{ContentType: "text/plain", Data: []byte("hello")}
+
+	inputOutput := []struct {
+		elements []interface{}
+		by       string
+		order    SortOrder
+		err      string
+	}{
+		{[]interface{}{1.0, 2.0}, "", "up", `invalid sort order "up", expected asc or desc`},
+		{[]interface{}{1.0, 2.0}, "user..age", SortAscending, "invalid field path user..age"},
+		{[]interface{}{1.0, binary}, "", SortAscending, "element 0 is binary, not JSON"},
+		{[]interface{}{1.0, "2"}, "", SortAscending, "element 1 can not be compared with element 0, as they are a number and a string"},
+		{[]interface{}{true}, "", SortAscending, "element 0 is neither a number nor a string"},
+		{[]interface{}{map[string]interface{}{"age": 3.0}, 4.0}, "age", SortAscending, "element 0 is not a JSON object"},
+		{[]interface{}{map[string]interface{}{"name": "ada"}}, "age", SortAscending, "element 0 has no field age"},
+		{[]interface{}{map[string]interface{}{"user": "ada"}}, "user.age", SortAscending, "element 0 is not a JSON object at user"},
+	}
+
+	for _, io := range inputOutput {
+		stack := NewStack("test-stack", time.Now())
+		_ = stack.PushN(io.elements)
+		version := stack.Version()
+
+		if err := stack.Sort(io.by, io.order); err == nil || err.Error() != io.err {
+			t.Errorf("err is %v, expected %v", err, io.err)
+		}
+		if stack.Version() != version {
+			t.Errorf("stack.Version() is %d, expected %d", stack.Version(), version)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package pila
+
+import (
+	"encoding/json"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/stack"
+)
+
+// NewSpillStack creates a new Stack like NewStack, which keeps in memory
+// only its k topmost elements, or up to twice k, and spills the rest of
+// them into its own file, created in dir, paging them in on demand. Only
+// the StructureStack type can spill to disk. Spilled elements are encoded
+// as JSON, keeping their expiration date and content type.
+func NewSpillStack(name string, t time.Time, dir string, k int) (*Stack, error) {
+	return NewStackWithStore(StructureStack, name, t, StoreSpill, StoreOptions{Dir: dir, Spill: k})
+}
+
+// Spill returns the minimum number of elements kept in memory
+// by a Stack that spills to disk, or 0 if it does not.
+func (s *Stack) Spill() int {
+	if base, ok := s.base.(*stack.SpillStack); ok {
+		return base.K()
+	}
+	return 0
+}
+
+// close closes the Store of a Stack implementing io.Closer, like the
+// file of a Stack that spills to disk, which is removed, so it must be
+// called once the Stack is not used anymore.
+func (s *Stack) close() error {
+	if base, ok := s.base.(io.Closer); ok {
+		return base.Close()
+	}
+	return nil
+}
+
+// Spill returns the minimum number of elements kept in memory by
+// the Stacks of the Database spilling to disk, or 0 if they do not.
+func (db *Database) Spill() int {
+	return int(atomic.LoadInt64(&db.spill))
+}
+
+// SetSpill sets the minimum number of elements kept in memory by the
+// Stacks of the Database spilling to disk, or makes them not spill if
+// k is not positive. It is a default for the Stacks created afterwards
+// with NewSpillStack, as creating them is up to the caller.
+func (db *Database) SetSpill(k int) {
+	if k < 0 {
+		k = 0
+	}
+	atomic.StoreInt64(&db.spill, int64(k))
+}
+
+// SpillDir returns the directory where the Stacks that spill to disk
+// store their elements, empty if they are not allowed.
+func (p *Pila) SpillDir() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.spillDir
+}
+
+// SetSpillDir sets the directory where the Stacks that spill to disk
+// store their elements, or disallows them if dir is empty. Stacks
+// already created are not moved.
+func (p *Pila) SetSpillDir(dir string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.spillDir = dir
+}
+
+// spilledElement is the JSON representation of an element
+// of a Stack stored on disk.
+type spilledElement struct {
+	Element
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// elementCodec implements stack.Codec for the elements of a Stack.
+type elementCodec struct{}
+
+// Encode encodes an element of a Stack as a spilledElement.
+func (elementCodec) Encode(element interface{}) ([]byte, error) {
+	var e spilledElement
+	if expiring, ok := element.(expiringElement); ok {
+		e.ExpiresAt = &expiring.expiresAt
+		element = expiring.value
+	}
+	m := metadata(element)
+	if tagged, ok := element.(taggedElement); ok {
+		element = tagged.value
+	}
+	e.Element = NewElement(element).WithMetadata(m)
+	return json.Marshal(e)
+}
+
+// Decode decodes an element of a Stack encoded by Encode.
+func (elementCodec) Decode(data []byte) (interface{}, error) {
+	var e spilledElement
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	value, err := e.StackValue()
+	if err != nil {
+		return nil, err
+	}
+	if e.PushedAt != nil {
+		value = taggedElement{value: value, pushedAt: e.PushedAt.UnixNano(), tag: e.Tag}
+	}
+	if e.ExpiresAt != nil {
+		return expiringElement{value: value, expiresAt: *e.ExpiresAt}, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,168 @@
+package pila
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewSpillStack(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	stack, err := NewSpillStack("test-stack", now, dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stack.Spill() != 2 {
+		t.Errorf("stack spill is %d, expected %d", stack.Spill(), 2)
+	}
+	if stack.Type != StructureStack {
+		t.Errorf("stack type is %s, expected %s", stack.Type, StructureStack)
+	}
+	if NewStack("test-stack", now).Spill() != 0 {
+		t.Error("stack spill is not 0")
+	}
+
+	if _, err := NewSpillStack("test-stack", now, "/this/does/not/exist", 2); err == nil {
+		t.Error("err is nil, expected an error")
+	}
+}
+
+func TestSpillStack_Elements(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	stack, _ := NewSpillStack("test-stack", now, dir, 1)
+	stack.PushWithExpiration("expired", now.Add(-time.Second))
+	stack.Push(Binary{ContentType: "text/plain", Data: []byte("hello")})
+	stack.PushWithExpiration(map[string]interface{}{"a": "b"}, now.Add(time.Hour))
+	stack.Push("foo")
+	stack.Push("bar")
+
+	if n := stack.Expire(now); n != 1 {
+		t.Errorf("expired elements are %d, expected %d", n, 1)
+	}
+
+	expectedElements := []interface{}{
+		"bar",
+		"foo",
+		map[string]interface{}{"a": "b"},
+		Binary{ContentType: "text/plain", Data: []byte("hello")},
+	}
+	for _, expected := range expectedElements {
+		if element, ok := stack.Pop(); !ok || !reflect.DeepEqual(element, expected) {
+			t.Errorf("popped element is %v, expected %v", element, expected)
+		}
+	}
+	if stack.Size() != 0 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 0)
+	}
+}
+
+func TestDatabaseRemoveStack_Spill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := NewDatabase("db")
+	stack, _ := NewSpillStack("test-stack", time.Now(), dir, 1)
+	_ = db.AddStack(stack)
+	stack.Push("foo")
+	stack.Push("bar")
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("spill files are %d, expected %d", len(files), 1)
+	}
+	db.RemoveStack(stack.ID)
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("spill files are %d, expected %d", len(files), 0)
+	}
+}
+
+func TestDatabaseSetSpill(t *testing.T) {
+	db := NewDatabase("db")
+	if db.Spill() != 0 || db.Status().Spill != 0 {
+		t.Errorf("database spill is %d, expected %d", db.Spill(), 0)
+	}
+
+	db.SetSpill(8)
+	if db.Spill() != 8 || db.Status().Spill != 8 {
+		t.Errorf("database spill is %d, expected %d", db.Spill(), 8)
+	}
+
+	db.SetSpill(-1)
+	if db.Spill() != 0 {
+		t.Errorf("database spill is %d, expected %d", db.Spill(), 0)
+	}
+}
+
+func TestPilaSnapshotRestore_Spill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	pila := NewPila()
+	pila.SetSpillDir(dir)
+	db := NewDatabase("db")
+	db.SetSpill(4)
+	_ = pila.AddDatabase(db)
+	stack, _ := NewSpillStack("s", now, dir, 2)
+	_ = db.AddStack(stack)
+	for _, element := range []string{"a", "b", "c", "d", "e"} {
+		stack.Push(element)
+	}
+
+	var buf bytes.Buffer
+	if err := pila.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+
+	loaded := NewPila()
+	loaded.SetSpillDir(dir)
+	if err := loaded.Restore(bytes.NewReader(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Status(), pila.Status()) {
+		t.Errorf("status is %v, expected %v", loaded.Status(), pila.Status())
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Errorf("spill files are %d, expected %d", len(files), 2)
+	}
+
+	inMemory := NewPila()
+	if err := inMemory.Restore(bytes.NewReader(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	if spill := inMemory.Databases[db.ID].Spill(); spill != 4 {
+		t.Errorf("database spill is %d, expected %d", spill, 4)
+	}
+	restored, _ := inMemory.Databases[db.ID].Stack(stack.ID)
+	if restored.Spill() != 0 || restored.Size() != 5 {
+		t.Errorf("stack spill and size are %d and %d, expected %d and %d", restored.Spill(), restored.Size(), 0, 5)
+	}
+
+	if err := loaded.Restore(bytes.NewReader(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Errorf("spill files are %d, expected %d", len(files), 2)
+	}
+}
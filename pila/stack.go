@@ -1,17 +1,99 @@
 package pila
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fern4lvarez/piladb/pkg/stack"
 	"github.com/fern4lvarez/piladb/pkg/uuid"
 )
 
-// Stack represents a stack entity in piladb.
+// ErrStackFull is returned when pushing an element into a Stack
+// that reached its MaxSize with the OverflowReject policy.
+var ErrStackFull = errors.New("stack is full")
+
+// ErrElementTooLarge is returned when pushing an element into
+// a Stack that is larger than its max element size.
+var ErrElementTooLarge = errors.New("element is too large")
+
+// ErrConditionFailed is returned when popping an element
+// from a Stack whose top does not meet the given condition.
+var ErrConditionFailed = errors.New("condition on the stack not met")
+
+// ErrUnsupported is returned when executing an operation
+// that the Structure of a Stack does not support.
+var ErrUnsupported = errors.New("operation not supported by the stack type")
+
+// OverflowPolicy determines what happens when pushing an element
+// into a Stack that reached its MaxSize.
+type OverflowPolicy string
+
+const (
+	// OverflowReject rejects the pushed element.
+	OverflowReject OverflowPolicy = "reject"
+	// OverflowDropOldest evicts the oldest element, i.e. the
+	// bottom of a stack or the front of a queue, to make room
+	// for the pushed element.
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+)
+
+// Structure determines the order in which
+// the elements of a Stack are popped.
+type Structure string
+
+const (
+	// StructureStack pops the last pushed element first (LIFO).
+	StructureStack Structure = "stack"
+	// StructureQueue pops the first pushed element first (FIFO).
+	StructureQueue Structure = "queue"
+	// StructurePriority pops the element with the highest
+	// priority first, and the last pushed one among equals.
+	StructurePriority Structure = "priority"
+)
+
+// Stack represents a stack entity in piladb. It can also
+// behave as a queue or a priority queue, see NewQueue and
+// NewPriority.
 type Stack struct {
+	// sizeApprox keeps a lock-free count of the elements of the Stack.
+	// It is the first field, followed by the other counters, to guarantee
+	// 64-bit alignment for atomic operations on 32-bit platforms.
+	sizeApprox int64
+
+	// pushes and pops count the PUSH and POP operations
+	// on the Stack, for instrumentation purposes
+	pushes, pops int64
+
+	// peakSize is the largest size reached by the Stack
+	peakSize int64
+
+	// pushRate and popRate count the recent PUSH and POP
+	// operations, to measure their rates
+	pushRate, popRate rateCounter
+
+	// pushedAt and poppedAt are the dates, in nanoseconds since
+	// the Unix epoch, of the last PUSH and POP operations, 0 if none
+	pushedAt, poppedAt int64
+
+	// maxElementSize is the maximum size in bytes of
+	// an element pushed into the Stack, 0 if unlimited
+	maxElementSize int64
+
+	// compress is the minimum size in bytes of the elements
+	// stored compressed, 0 if they are not compressed
+	compress int64
+
+	// memory is the approximate memory in bytes
+	// used by the elements of the Stack
+	memory int64
+
 	// ID is a unique identifier of the Stack
 	ID fmt.Stringer
 
@@ -38,8 +120,111 @@ type Stack struct {
 	// when one of these events happens, but it needs to be set by hand.
 	ReadAt time.Time
 
+	// Type is the Structure of the Stack
+	Type Structure
+
+	// MaxSize is the maximum number of elements of the Stack,
+	// 0 if unlimited
+	MaxSize int
+
+	// Policy determines what happens when pushing an element
+	// into a Stack that reached its MaxSize
+	Policy OverflowPolicy
+
+	// RateLimit is the maximum number of requests per second
+	// served on the Stack, 0 if the global limit applies
+	RateLimit int
+
+	// TTL is the time to live of the elements pushed
+	// without their own expiration, 0 if they do not expire
+	TTL time.Duration
+
 	// base represents the Stack data structure
 	base stack.Stacker
+
+	// store is the name of the Store of base
+	store string
+
+	// pushMu serializes PUSH operations on a Stack with
+	// a MaxSize or a UniquePolicy
+	pushMu sync.Mutex
+
+	// txMu is held for reading by the PUSH, POP, FLUSH, ROTATE,
+	// BASE and SWEEP operations on the Stack, and for writing by
+	// the Transactions updating it, so they are isolated
+	txMu sync.RWMutex
+
+	// popPushMu serializes the PopPush operations
+	// popping from or pushing into the Stack
+	popPushMu sync.Mutex
+
+	// unique determines what happens when pushing an element that
+	// the Stack already contains, empty if duplicates are allowed,
+	// and index counts the elements of a unique Stack by key
+	unique  UniquePolicy
+	index   map[string]int
+	indexMu sync.Mutex
+
+	// expiring is set to 1 once an element with an
+	// expiration date is pushed into the Stack
+	expiring int32
+
+	// mu protects the access to UpdatedAt and ReadAt
+	mu sync.RWMutex
+
+	// observers are the functions subscribed to the Events
+	// of the Stack, by subscription id
+	observers    map[int]func(Event)
+	nextObserver int
+	observersMu  sync.RWMutex
+
+	// history keeps the last popped elements, as stored,
+	// up to historyDepth, the last popped one at the end
+	history      []interface{}
+	historyDepth int
+	historyMu    sync.Mutex
+
+	// lockOwner is the owner locking the Stack
+	// until lockExpiresAt, empty if unlocked
+	lockOwner     string
+	lockExpiresAt time.Time
+	lockMu        sync.Mutex
+
+	// groups are the groups of consumers of the Stack, by name,
+	// deadLetter is its DeadLetter, nil if none, and deliveries
+	// are the numbers of deliveries of the elements pushed back
+	// by Redeliver, by deliveryKey, the first pushed back first
+	groups     map[string]*group
+	deadLetter *DeadLetter
+	deliveries map[string][]int
+	groupsMu   sync.Mutex
+
+	// keys encrypt the elements of the Stack, if any
+	keys   *Keyring
+	keysMu sync.RWMutex
+
+	// hooks are the Hooks of the Stack, in the order they were
+	// registered, and hasHooks is 1 if there are any
+	hooks     []hooksEntry
+	nextHooks int
+	hasHooks  int32
+	hooksMu   sync.RWMutex
+
+	// watermarks trigger Events when the size of the Stack crosses
+	// them, nil if none, watermarkSize is its size when they were
+	// last checked, and hasWatermarks is 1 if there are any
+	watermarks    *Watermarks
+	watermarkSize int
+	watermarksMu  sync.Mutex
+	hasWatermarks int32
+
+	// window is the Window of the Stack, nil if none, windowEnd
+	// the end of its current window, and hasWindow is 1 if it
+	// has a Window
+	window    *Window
+	windowEnd time.Time
+	windowMu  sync.Mutex
+	hasWindow int32
 }
 
 // NewStack creates a new Stack given a name and a creation date,
@@ -47,41 +232,838 @@ type Stack struct {
 func NewStack(name string, t time.Time) *Stack {
 	s := &Stack{}
 	s.Name = name
-	s.SetID()
+	s.ID = uuid.NewRandom()
 	s.CreatedAt = t
+	s.Type = StructureStack
 	s.base = stack.NewStack()
+	s.store = StoreMemory
 	return s
 }
 
-// Push an element on top of the Stack.
-func (s *Stack) Push(element interface{}) {
-	s.base.Push(element)
+// NewStackWithLimit creates a new Stack given a name and a creation
+// date, which contains at most n elements. policy determines what
+// happens when pushing an element into the full Stack.
+func NewStackWithLimit(name string, t time.Time, n int, policy OverflowPolicy) *Stack {
+	s := NewStack(name, t)
+	s.MaxSize = n
+	s.Policy = policy
+	return s
+}
+
+// NewQueue creates a new Stack given a name and a creation date, with
+// the StructureQueue type: elements are popped in the same order they
+// were pushed, so the top of the Stack is the first pushed element.
+func NewQueue(name string, t time.Time) *Stack {
+	s := NewStack(name, t)
+	s.Type = StructureQueue
+	s.base = stack.NewQueue()
+	return s
+}
+
+// NewQueueWithLimit creates a new queue like NewQueue, which contains
+// at most n elements. policy determines what happens when pushing an
+// element into the full queue.
+func NewQueueWithLimit(name string, t time.Time, n int, policy OverflowPolicy) *Stack {
+	s := NewQueue(name, t)
+	s.MaxSize = n
+	s.Policy = policy
+	return s
+}
+
+// NewPriority creates a new Stack given a name and a creation date,
+// with the StructurePriority type: elements pushed with a higher
+// priority are popped first, see PushWithPriority. Elements without
+// priority have priority 0.
+func NewPriority(name string, t time.Time) *Stack {
+	s := NewStack(name, t)
+	s.Type = StructurePriority
+	s.base = stack.NewHeap()
+	return s
+}
+
+// NewPriorityWithLimit creates a new priority queue like NewPriority,
+// which contains at most n elements. policy determines what happens
+// when pushing an element into the full priority queue.
+func NewPriorityWithLimit(name string, t time.Time, n int, policy OverflowPolicy) *Stack {
+	s := NewPriority(name, t)
+	s.MaxSize = n
+	s.Policy = policy
+	return s
+}
+
+// NewStructureWithLimit creates a new Stack of type structure given a
+// name and a creation date, calling NewStackWithLimit, NewQueueWithLimit
+// or NewPriorityWithLimit.
+func NewStructureWithLimit(structure Structure, name string, t time.Time, n int, policy OverflowPolicy) *Stack {
+	switch structure {
+	case StructureQueue:
+		return NewQueueWithLimit(name, t, n, policy)
+	case StructurePriority:
+		return NewPriorityWithLimit(name, t, n, policy)
+	}
+	return NewStackWithLimit(name, t, n, policy)
+}
+
+// Push an element on top of the Stack. If the Stack reached its
+// MaxSize, ErrStackFull is returned with the OverflowReject policy,
+// and the element at the bottom is evicted with OverflowDropOldest.
+// If the element is larger than the max element size of the Stack,
+// ErrElementTooLarge is returned. If the Stack is unique and already
+// contains the element, ErrDuplicate is returned with the UniqueReject
+// policy, and the element is moved to the top with UniqueMoveToTop.
+// The element is passed to the BeforePush Hooks of the Stack first.
+func (s *Stack) Push(element interface{}) error {
+	element, err := s.beforePush(element)
+	if err != nil {
+		return err
+	}
+	return s.pushWithSize(element, 0)
+}
+
+// pushWithSize pushes an element like Push, whose size is measured
+// with ElementSize unless size is positive, without passing it to
+// the Hooks of the Stack.
+func (s *Stack) pushWithSize(element interface{}, size int) error {
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+	return s.pushWithSizeLocked(element, size)
+}
+
+// pushWithSizeLocked pushes an element like pushWithSize,
+// holding the txMu of the Stack already.
+func (s *Stack) pushWithSizeLocked(element interface{}, size int) error {
+	if s.Unique() != "" {
+		return s.pushNLocked([]interface{}{element})
+	}
+	if err := s.checkElementSize(element, size); err != nil {
+		return err
+	}
+	if err := s.checkMemory(element); err != nil {
+		return err
+	}
+	if s.MaxSize <= 0 {
+		s.push(element)
+		return nil
+	}
+
+	s.pushMu.Lock()
+	defer s.pushMu.Unlock()
+
+	if s.Policy == OverflowDropOldest {
+		s.push(element)
+		s.evict()
+		return nil
+	}
+
+	if s.Size() >= s.MaxSize {
+		return ErrStackFull
+	}
+	s.push(element)
+	return nil
+}
+
+// PushWithExpiration pushes an element on top of the Stack
+// that expires at date t. Expired elements are discarded, even
+// if they are not on top of the Stack.
+func (s *Stack) PushWithExpiration(element interface{}, t time.Time) error {
+	element, err := s.beforePush(element)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&s.expiring, 1)
+	return s.pushWithSize(expiringElement{value: element, expiresAt: t}, 0)
+}
+
+// PushWithPriority pushes an element into the Stack with a priority,
+// which determines its position in a Stack of the StructurePriority
+// type, and is ignored by the other types. If t is not zero, the element
+// expires at such date, like in PushWithExpiration.
+func (s *Stack) PushWithPriority(element interface{}, priority float64, t time.Time) error {
+	element, err := s.beforePush(element)
+	if err != nil {
+		return err
+	}
+	if !t.IsZero() {
+		atomic.StoreInt32(&s.expiring, 1)
+		element = expiringElement{value: element, expiresAt: t}
+	}
+	return s.pushWithSize(prioritizedElement{value: element, priority: priority}, 0)
+}
+
+// PushOptions are the options of a PUSH operation, see PushWithOptions.
+type PushOptions struct {
+	// Priority of the element, if not nil, see PushWithPriority
+	Priority *float64
+	// ExpiresAt is the date when the element expires,
+	// if not zero, see PushWithExpiration
+	ExpiresAt time.Time
+	// If is the condition on the Version of the Stack
+	// for the element to be pushed, if not nil
+	If func(version uint64) bool
+	// Size is the size in bytes of the element, if positive,
+	// so it is not measured again, see Element.Size
+	Size int
+	// Tag is the tag of the element, if not empty, which is
+	// returned in its Metadata, see PeekWithMetadata
+	Tag string
+	// PushedAt is the date when the element was pushed,
+	// if not zero, e.g. when it is restored
+	PushedAt time.Time
+}
+
+// PushWithOptions pushes an element into the Stack like Push, with
+// the priority and expiration date of opts. If opts.If is not nil,
+// the element is pushed only if it returns true for the Version of
+// the Stack, which are checked and pushed as a single atomic
+// operation, so the element is pushed only if the Stack was not
+// modified since it was read. Otherwise, ErrConditionFailed is
+// returned. Conditional pushes into a unique Stack with the
+// UniqueMoveToTop policy return ErrUnsupported. ErrInvalidTag is
+// returned if opts.Tag is not valid.
+func (s *Stack) PushWithOptions(element interface{}, opts PushOptions) error {
+	if !validTag(opts.Tag) {
+		return ErrInvalidTag
+	}
+	element, err := s.beforePush(element)
+	if err != nil {
+		return err
+	}
+	if opts.Tag != "" || !opts.PushedAt.IsZero() {
+		if opts.PushedAt.IsZero() {
+			opts.PushedAt = time.Now()
+		}
+		element = taggedElement{value: element, pushedAt: opts.PushedAt.UnixNano(), tag: opts.Tag}
+	}
+	if !opts.ExpiresAt.IsZero() {
+		atomic.StoreInt32(&s.expiring, 1)
+		element = expiringElement{value: element, expiresAt: opts.ExpiresAt}
+	}
+	if opts.Priority != nil {
+		element = prioritizedElement{value: element, priority: *opts.Priority}
+	}
+	if opts.If == nil {
+		return s.pushWithSize(element, opts.Size)
+	}
+
+	if err := s.checkElementSize(element, opts.Size); err != nil {
+		return err
+	}
+	if err := s.checkMemory(element); err != nil {
+		return err
+	}
+
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+	s.pushMu.Lock()
+	defer s.pushMu.Unlock()
+
+	switch s.Unique() {
+	case UniqueMoveToTop:
+		return ErrUnsupported
+	case UniqueReject:
+		if _, _, err := s.dedup([]interface{}{element}); err != nil {
+			return err
+		}
+	}
+	limited := s.MaxSize > 0
+	if limited && s.Policy != OverflowDropOldest && s.Size() >= s.MaxSize {
+		return ErrStackFull
+	}
+	if !s.pushIf(element, opts.If) {
+		return ErrConditionFailed
+	}
+	if limited && s.Policy == OverflowDropOldest {
+		s.evict()
+	}
+	return nil
+}
+
+// PushN pushes elements into the Stack in order, like successive
+// calls to Push, without interleaving other PushN operations.
+// If the Stack has a MaxSize and the OverflowReject policy, and
+// there is no room for all the elements, none of them is pushed
+// and ErrStackFull is returned. Likewise, none of them is pushed
+// and ErrElementTooLarge is returned if any of them is too large,
+// or ErrDuplicate if the Stack is unique with the UniqueReject
+// policy and any of them is duplicated, or an error if the
+// BeforePush Hooks of the Stack reject any of them.
+func (s *Stack) PushN(elements []interface{}) error {
+	elements, err := s.beforePushN(elements)
+	if err != nil {
+		return err
+	}
+	return s.pushN(elements)
+}
+
+// pushN pushes elements into the Stack like PushN,
+// without passing them to the Hooks of the Stack.
+func (s *Stack) pushN(elements []interface{}) error {
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+	return s.pushNLocked(elements)
+}
+
+// pushNLocked pushes elements like pushN,
+// holding the txMu of the Stack already.
+func (s *Stack) pushNLocked(elements []interface{}) error {
+	for _, element := range elements {
+		if err := s.checkElementSize(element, 0); err != nil {
+			return err
+		}
+	}
+	if err := s.checkMemory(elements...); err != nil {
+		return err
+	}
+
+	s.pushMu.Lock()
+	defer s.pushMu.Unlock()
+
+	var present map[string]bool
+	if s.Unique() != "" {
+		var err error
+		if elements, present, err = s.dedup(elements); err != nil {
+			return err
+		}
+	}
+
+	limited := s.MaxSize > 0
+	if limited && s.Policy != OverflowDropOldest && s.Size()-len(present)+len(elements) > s.MaxSize {
+		return ErrStackFull
+	}
+
+	s.removeKeys(present)
+	for _, element := range elements {
+		s.push(element)
+	}
+	if limited && s.Policy == OverflowDropOldest {
+		s.evict()
+	}
+	return nil
+}
+
+// SetMaxElementSize sets the maximum size in bytes of the
+// elements pushed into the Stack, unlimited if n is not positive.
+// Elements already in the Stack are not affected.
+func (s *Stack) SetMaxElementSize(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt64(&s.maxElementSize, int64(n))
+}
+
+// MaxElementSize returns the maximum size in bytes of the
+// elements pushed into the Stack, 0 if unlimited.
+func (s *Stack) MaxElementSize() int {
+	return int(atomic.LoadInt64(&s.maxElementSize))
+}
+
+// checkElementSize returns ErrElementTooLarge if an element is
+// larger than the max element size of the Stack. The element is
+// measured with ElementSize unless size is positive.
+func (s *Stack) checkElementSize(element interface{}, size int) error {
+	max := s.MaxElementSize()
+	if max == 0 {
+		return nil
+	}
+
+	if size <= 0 {
+		value, _ := unwrap(element, time.Time{})
+		size = ElementSize(value)
+	}
+	if size > max {
+		return ErrElementTooLarge
+	}
+	return nil
+}
+
+// push adds an element on top of the Stack
+// regardless of its MaxSize.
+func (s *Stack) push(element interface{}) {
+	s.pushIf(element, nil)
+}
+
+// pushIf adds an element on top of the Stack regardless of its
+// MaxSize, if cond is nil or returns true for its Version, as a
+// single atomic operation. It returns false if cond returned false.
+func (s *Stack) pushIf(element interface{}, cond func(version uint64) bool) bool {
+	value, _ := unwrap(element, time.Time{})
+	now := time.Now()
+	element = s.encryptElement(s.compressElement(withMetadata(element, Metadata{PushedAt: now})))
+	if cond == nil {
+		s.base.Push(element)
+	} else if !s.base.PushIf(element, cond) {
+		return false
+	}
+	s.indexAdd(element)
+	s.account(elementMemory(element))
+	s.updatePeakSize(atomic.AddInt64(&s.sizeApprox, 1))
+	atomic.AddInt64(&s.pushes, 1)
+	atomic.StoreInt64(&s.pushedAt, now.UnixNano())
+	s.pushRate.add(now)
+
+	s.notify(Event{Op: EventPush, Element: value})
+	return true
+}
+
+// evict removes the oldest elements of the Stack exceeding its
+// MaxSize, and the expired ones.
+func (s *Stack) evict() {
+	kept := 0
+	var freed int64
+	now := time.Now()
+	removed := s.base.Filter(func(element interface{}) bool {
+		if !alive(element, now) || kept == s.MaxSize {
+			freed += elementMemory(element)
+			s.indexRemove(element)
+			return false
+		}
+		kept++
+		return true
+	})
+	atomic.AddInt64(&s.sizeApprox, -int64(removed))
+	s.account(-freed)
 }
 
 // Pop removes and returns the element on top of the Stack.
 // If the Stack was empty, it returns false.
 func (s *Stack) Pop() (interface{}, bool) {
-	return s.base.Pop()
+	element, value, ok := s.pop()
+	if ok {
+		s.remember(element)
+	}
+	return value, ok
+}
+
+// pop removes the element on top of the Stack, discarding the
+// expired ones, and returns it as stored and its value. If the
+// Stack was empty, it returns false.
+func (s *Stack) pop() (interface{}, interface{}, bool) {
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+	return s.popLocked()
+}
+
+// popLocked removes the element on top of the Stack like
+// pop, holding the txMu of the Stack already.
+func (s *Stack) popLocked() (interface{}, interface{}, bool) {
+	now := time.Now()
+	for {
+		element, ok := s.base.Pop()
+		if !ok {
+			return nil, nil, false
+		}
+		atomic.AddInt64(&s.sizeApprox, -1)
+		s.indexRemove(element)
+		s.account(-elementMemory(element))
+
+		if value, alive := unwrap(element, now); alive {
+			atomic.AddInt64(&s.pops, 1)
+			atomic.StoreInt64(&s.poppedAt, now.UnixNano())
+			s.popRate.add(now)
+			s.notify(Event{Op: EventPop, Element: value})
+			return element, value, true
+		}
+	}
+}
+
+// PopIf removes and returns the element on top of the Stack only if
+// cond returns true for its value and the Version of the Stack, which
+// are checked and popped as a single atomic operation, so the element
+// is popped only if the Stack was not modified since it was peeked.
+// Otherwise, ErrConditionFailed is returned. If the Stack was empty,
+// it returns false.
+func (s *Stack) PopIf(cond func(value interface{}, version uint64) bool) (interface{}, bool, error) {
+	now := time.Now()
+	s.Expire(now)
+
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+	checked := false
+	element, ok := s.base.PopIf(func(element interface{}, version uint64) bool {
+		checked = true
+		value, alive := unwrap(element, now)
+		return alive && cond(value, version)
+	})
+	if !ok && checked {
+		return nil, false, ErrConditionFailed
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	atomic.AddInt64(&s.sizeApprox, -1)
+	s.indexRemove(element)
+	s.account(-elementMemory(element))
+	atomic.AddInt64(&s.pops, 1)
+	atomic.StoreInt64(&s.poppedAt, now.UnixNano())
+	s.popRate.add(now)
+	s.remember(element)
+
+	value, _ := unwrap(element, now)
+	s.notify(Event{Op: EventPop, Element: value})
+	return value, true, nil
+}
+
+// PopWait removes and returns the element on top of the Stack. If
+// the Stack is empty, it waits for an element to be pushed until done
+// is closed, in which case it returns false.
+func (s *Stack) PopWait(done <-chan struct{}) (interface{}, bool) {
+	// subscribe before popping, so no push is missed
+	pushed, stop := s.Pushed()
+	defer stop()
+
+	for {
+		if value, ok := s.Pop(); ok {
+			return value, true
+		}
+		select {
+		case <-pushed:
+		case <-done:
+			return nil, false
+		}
+	}
+}
+
+// PopN removes and returns up to n elements from the top of
+// the Stack, the top one first. It returns an empty slice if
+// the Stack was empty.
+func (s *Stack) PopN(n int) []interface{} {
+	size := s.SizeApprox()
+	if n < size {
+		size = n
+	}
+	if size < 0 {
+		size = 0
+	}
+
+	elements := make([]interface{}, 0, size)
+	for len(elements) < n {
+		value, ok := s.Pop()
+		if !ok {
+			break
+		}
+		elements = append(elements, value)
+	}
+	return elements
+}
+
+// Elements returns up to limit elements of the Stack, in the order
+// they would be popped, skipping the first offset ones. The Stack is
+// not modified, besides removing its expired elements.
+func (s *Stack) Elements(offset, limit int) []interface{} {
+	s.Expire(time.Now())
+
+	elements := s.base.Slice(offset, limit)
+	for i, element := range elements {
+		elements[i], _ = unwrap(element, time.Time{})
+	}
+	return elements
+}
+
+// rotator returns the base of the Stack as a stack.Rotator, after
+// removing its expired elements, so ROTATE, BASE and SWEEP do not
+// operate on them. Priority stacks have no bottom, so they are not
+// supported.
+func (s *Stack) rotator() (stack.Rotator, error) {
+	r, ok := s.base.(stack.Rotator)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	s.Expire(time.Now())
+	return r, nil
+}
+
+// Rotate moves the element on top of the Stack to its bottom,
+// and returns it. If the Stack was empty, it returns false.
+func (s *Stack) Rotate() (interface{}, bool, error) {
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+
+	r, err := s.rotator()
+	if err != nil {
+		return nil, false, err
+	}
+
+	element, ok := r.Rotate()
+	if !ok {
+		return nil, false, nil
+	}
+	value, _ := unwrap(element, time.Time{})
+	s.notify(Event{Op: EventRotate, Element: value})
+	return value, true, nil
+}
+
+// Base returns the element at the bottom of the Stack.
+func (s *Stack) Base() (interface{}, error) {
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+
+	r, err := s.rotator()
+	if err != nil {
+		return nil, err
+	}
+
+	value, _ := unwrap(r.Base(), time.Time{})
+	return value, nil
 }
 
-// Size returns the size of the Stack.
+// Sweep removes and returns the element at the bottom of the
+// Stack. If the Stack was empty, it returns false.
+func (s *Stack) Sweep() (interface{}, bool, error) {
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+
+	r, err := s.rotator()
+	if err != nil {
+		return nil, false, err
+	}
+
+	element, ok := r.Sweep()
+	if !ok {
+		return nil, false, nil
+	}
+	atomic.AddInt64(&s.sizeApprox, -1)
+	s.indexRemove(element)
+	s.account(-elementMemory(element))
+	now := time.Now()
+	atomic.AddInt64(&s.pops, 1)
+	atomic.StoreInt64(&s.poppedAt, now.UnixNano())
+	s.popRate.add(now)
+
+	value, _ := unwrap(element, time.Time{})
+	s.notify(Event{Op: EventSweep, Element: value})
+	return value, true, nil
+}
+
+// undoPush removes the last pushed element of the Stack,
+// to roll back a PUSH operation.
+func (s *Stack) undoPush() {
+	last, ok := s.base.(interface {
+		PopLast() (interface{}, bool)
+	})
+	if !ok {
+		s.popLocked()
+		return
+	}
+	if element, ok := last.PopLast(); ok {
+		atomic.AddInt64(&s.sizeApprox, -1)
+		s.indexRemove(element)
+		s.account(-elementMemory(element))
+	}
+}
+
+// undoPop puts back an element, as returned by pop,
+// into the Stack, to roll back a POP operation.
+func (s *Stack) undoPop(element interface{}) {
+	q, ok := s.base.(*stack.Queue)
+	if !ok {
+		s.push(element)
+		return
+	}
+	q.PushFront(element)
+	atomic.AddInt64(&s.sizeApprox, 1)
+	s.indexAdd(element)
+	s.account(elementMemory(element))
+}
+
+// Size returns the size of the Stack. It is the authoritative
+// size, see SizeApprox for a cheaper alternative.
 func (s *Stack) Size() int {
-	return s.base.Size()
+	if !s.hasExpiring() {
+		return s.base.Size()
+	}
+
+	size := 0
+	now := time.Now()
+	s.base.Range(func(element interface{}) bool {
+		if alive(element, now) {
+			size++
+		}
+		return true
+	})
+	return size
+}
+
+// SizeApprox returns the size of the Stack without acquiring
+// any lock. It is best-effort: under concurrent PUSH and POP
+// operations it may lag behind Size, so it must only be used
+// for monitoring purposes.
+func (s *Stack) SizeApprox() int {
+	return int(atomic.LoadInt64(&s.sizeApprox))
+}
+
+// Pushes returns the number of elements pushed into
+// the Stack since it was created.
+func (s *Stack) Pushes() int64 {
+	return atomic.LoadInt64(&s.pushes)
+}
+
+// Pops returns the number of elements popped from
+// the Stack since it was created.
+func (s *Stack) Pops() int64 {
+	return atomic.LoadInt64(&s.pops)
+}
+
+// PushRate returns the number of elements pushed into the
+// Stack per second, over the last RateWindow.
+func (s *Stack) PushRate() float64 {
+	return s.pushRate.rate(time.Now())
+}
+
+// PopRate returns the number of elements popped from the
+// Stack per second, over the last RateWindow.
+func (s *Stack) PopRate() float64 {
+	return s.popRate.rate(time.Now())
+}
+
+// PeakSize returns the largest size reached by the
+// Stack since it was created, as counted by SizeApprox.
+func (s *Stack) PeakSize() int {
+	return int(atomic.LoadInt64(&s.peakSize))
+}
+
+// updatePeakSize sets the peak size of the
+// Stack to size, if it is larger.
+func (s *Stack) updatePeakSize(size int64) {
+	for {
+		peak := atomic.LoadInt64(&s.peakSize)
+		if size <= peak || atomic.CompareAndSwapInt64(&s.peakSize, peak, size) {
+			return
+		}
+	}
+}
+
+// PushedAt returns the date of the last PUSH
+// operation, and false if there was none.
+func (s *Stack) PushedAt() (time.Time, bool) {
+	return unixNanoDate(atomic.LoadInt64(&s.pushedAt))
+}
+
+// PoppedAt returns the date of the last POP
+// operation, and false if there was none.
+func (s *Stack) PoppedAt() (time.Time, bool) {
+	return unixNanoDate(atomic.LoadInt64(&s.poppedAt))
+}
+
+// unixNanoDate returns the date given in nanoseconds
+// since the Unix epoch, and false if it is 0.
+func unixNanoDate(nsec int64) (time.Time, bool) {
+	if nsec == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nsec), true
 }
 
 // Peek returns the element on top of the Stack.
 func (s *Stack) Peek() interface{} {
-	return s.base.Peek()
+	if !s.hasExpiring() {
+		value, _ := unwrap(s.base.Peek(), time.Time{})
+		return value
+	}
+
+	// Range starts from the last pushed element, which is the
+	// top of a stack and the bottom of a queue, and it is not
+	// ordered by priority.
+	all := s.Type == StructureQueue || s.Type == StructurePriority
+	var peek interface{}
+	var found bool
+	var max float64
+	now := time.Now()
+	s.base.Range(func(element interface{}) bool {
+		value, alive := unwrap(element, now)
+		if !alive {
+			return true
+		}
+		if s.Type == StructurePriority {
+			if p := priority(element); !found || p > max {
+				peek, max = value, p
+			}
+		} else {
+			peek = value
+		}
+		found = true
+		return all
+	})
+	return peek
+}
+
+// Version returns the version of the Stack, which is incremented
+// every time the Stack is modified. See PopIf.
+func (s *Stack) Version() uint64 {
+	return s.base.Version()
+}
+
+// PeekVersion returns the element on top of the Stack along with
+// the Version of the Stack, both read at once, after removing the
+// expired elements.
+func (s *Stack) PeekVersion() (interface{}, uint64) {
+	now := time.Now()
+	s.Expire(now)
+
+	var peek interface{}
+	version := s.base.Version()
+	// The condition never pops, it only reads
+	// the top of the Stack and its Version.
+	s.base.PopIf(func(element interface{}, v uint64) bool {
+		peek, _ = unwrap(element, now)
+		version = v
+		return false
+	})
+	return peek, version
+}
+
+// Expire removes the elements of the Stack that are expired at
+// date t, wherever they are, and returns how many were removed.
+func (s *Stack) Expire(t time.Time) int {
+	if !s.hasExpiring() {
+		return 0
+	}
+
+	var freed int64
+	removed := s.base.Filter(func(element interface{}) bool {
+		if !alive(element, t) {
+			freed += elementMemory(element)
+			s.indexRemove(element)
+			return false
+		}
+		return true
+	})
+	atomic.AddInt64(&s.sizeApprox, -int64(removed))
+	s.account(-freed)
+	return removed
+}
+
+// hasExpiring returns true if an element with an expiration
+// date was ever pushed into the Stack.
+func (s *Stack) hasExpiring() bool {
+	return atomic.LoadInt32(&s.expiring) == 1
 }
 
 // Flush flushes the content of the Stack.
 func (s *Stack) Flush() {
+	s.txMu.RLock()
+	defer s.txMu.RUnlock()
+	s.flushLocked()
+}
+
+// flushLocked flushes the content of the Stack like
+// Flush, holding the txMu of the Stack already.
+func (s *Stack) flushLocked() {
 	s.base.Flush()
+	atomic.StoreInt64(&s.sizeApprox, 0)
+	s.indexReset()
+	freed := atomic.SwapInt64(&s.memory, 0)
+	if db := s.Database; db != nil {
+		atomic.AddInt64(&db.memory, -freed)
+	}
+	s.notify(Event{Op: EventFlush})
 }
 
 // Update takes a date and updates UpdateAt and ReadAt
 // fields of the Stack.
 func (s *Stack) Update(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.UpdatedAt = t
 	s.ReadAt = t
 }
@@ -89,25 +1071,15 @@ func (s *Stack) Update(t time.Time) {
 // Read takes a date and updates ReadAt field
 // of the Stack.
 func (s *Stack) Read(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.ReadAt = t
 }
 
-// SetDatabase links the Stack with a given Database and
-// recalculates its ID.
+// SetDatabase links the Stack with a given Database.
 func (s *Stack) SetDatabase(db *Database) {
 	s.Database = db
-	s.SetID()
-}
-
-// SetID recalculates the id of the Stack based on its
-// Database name and its own name.
-func (s *Stack) SetID() {
-	if s.Database != nil {
-		s.ID = uuid.New(s.Database.Name + s.Name)
-		return
-	}
-
-	s.ID = uuid.New(s.Name)
 }
 
 // SizeToJSON returns the size of the Stack encoded as json.
@@ -124,17 +1096,196 @@ func (s *Stack) Status() StackStatus {
 	status.ID = s.ID.String()
 	status.Name = s.Name
 	status.Size = s.Size()
-	status.Peek = s.Peek()
+	status.SizeApprox = s.SizeApprox()
+	status.Peek, status.Version = s.PeekVersion()
+	status.PeakSize = s.PeakSize()
+	status.Pushes = s.Pushes()
+	status.Pops = s.Pops()
+	status.Memory = s.Memory()
 	status.CreatedAt = s.CreatedAt.Local()
+	if t, ok := s.PushedAt(); ok {
+		t = t.Local()
+		status.PushedAt = &t
+	}
+	if t, ok := s.PoppedAt(); ok {
+		t = t.Local()
+		status.PoppedAt = &t
+	}
+	// Type is only set for queues, so the
+	// status of stacks remains unchanged.
+	if s.Type == StructureQueue {
+		status.Type = s.Type
+	}
+	status.MaxSize = s.MaxSize
+	status.Policy = s.Policy
+	status.RateLimit = s.RateLimit
+	if s.TTL > 0 {
+		status.TTL = s.TTL.String()
+	}
+	status.Spill = s.Spill()
+	if s.store != StoreMemory {
+		status.Store = s.store
+	}
+	status.Unique = s.Unique()
+	status.History = s.HistoryDepth()
+	status.Compress = s.Compress()
+	status.Encrypted = s.Encryption() != nil
+	if w, ok := s.Watermarks(); ok {
+		status.Watermarks = &w
+	}
+	if t, ok := s.LockedUntil(time.Now()); ok {
+		t = t.Local()
+		status.LockedUntil = &t
+	}
+
+	s.mu.RLock()
 	status.UpdatedAt = s.UpdatedAt.Local()
 	status.ReadAt = s.ReadAt.Local()
+	s.mu.RUnlock()
 
 	return status
 }
 
+// expiringElement represents an element of a Stack
+// that expires at a given date.
+type expiringElement struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// prioritizedElement represents an element of a
+// Stack pushed with a priority. It wraps the value,
+// or its expiringElement if it expires.
+type prioritizedElement struct {
+	value    interface{}
+	priority float64
+}
+
+// Priority returns the priority of the element,
+// implementing stack.Prioritizer.
+func (e prioritizedElement) Priority() float64 {
+	return e.priority
+}
+
+// priority returns the priority of an element of a Stack.
+func priority(element interface{}) float64 {
+	if e, ok := element.(prioritizedElement); ok {
+		return e.priority
+	}
+	return 0
+}
+
+// unwrap returns the value of an element of a Stack, and
+// whether it is still alive, i.e. not expired, at date t.
+func unwrap(element interface{}, t time.Time) (interface{}, bool) {
+	if e, ok := element.(prioritizedElement); ok {
+		element = e.value
+	}
+	alive := true
+	if e, ok := element.(expiringElement); ok {
+		element, alive = e.value, t.Before(e.expiresAt)
+	}
+	if e, ok := element.(taggedElement); ok {
+		element = e.value
+	}
+	switch e := element.(type) {
+	case compressedElement:
+		element = e.value()
+	case sealedElement:
+		element = e.value()
+	}
+	return element, alive
+}
+
+// ElementSize returns the size in bytes of a value of a Stack: the
+// length of its data if it is Binary, bytes or a string, or the
+// length of its JSON encoding otherwise.
+func ElementSize(value interface{}) int {
+	switch v := value.(type) {
+	case Binary:
+		return len(v.Data)
+	case []byte:
+		return len(v)
+	case string:
+		return len(v)
+	}
+
+	b, _ := json.Marshal(value)
+	return len(b)
+}
+
+// Binary represents an element of arbitrary bytes, along
+// with the media type of its content.
+type Binary struct {
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
 // Element represents the payload of a Stack element.
 type Element struct {
 	Value interface{} `json:"element"`
+	// Priority of the element, if any
+	Priority *float64 `json:"priority,omitempty"`
+	// ContentType is the media type of a Binary element, whose
+	// Value is its data encoded in base64
+	ContentType string `json:"content_type,omitempty"`
+	// PushedAt is the date when the element was pushed,
+	// if it is given along with its Metadata
+	PushedAt *time.Time `json:"pushed_at,omitempty"`
+	// Tag is the tag of the element, if any
+	Tag string `json:"tag,omitempty"`
+	// raw is the JSON encoding of Value, if it was
+	// decoded, so it is not encoded again
+	raw json.RawMessage
+}
+
+// elementJSON is the JSON encoding of an Element,
+// keeping the encoding of its Value.
+type elementJSON struct {
+	Value       json.RawMessage `json:"element"`
+	Priority    *float64        `json:"priority"`
+	ContentType string          `json:"content_type"`
+	Tag         string          `json:"tag"`
+}
+
+// NewElement returns the Element of a value of a Stack.
+func NewElement(value interface{}) Element {
+	if b, ok := value.(Binary); ok {
+		return Element{Value: b.Data, ContentType: b.ContentType}
+	}
+	return Element{Value: value}
+}
+
+// WithMetadata returns the Element along with the Metadata of
+// the element of a Stack it was returned from.
+func (element Element) WithMetadata(m Metadata) Element {
+	if !m.PushedAt.IsZero() {
+		element.PushedAt = &m.PushedAt
+	}
+	element.Tag = m.Tag
+	return element
+}
+
+// StackValue returns the value of the Element to be pushed into a
+// Stack, which is a Binary if the Element has a ContentType.
+func (element Element) StackValue() (interface{}, error) {
+	if element.ContentType == "" {
+		return element.Value, nil
+	}
+
+	var data []byte
+	switch v := element.Value.(type) {
+	case []byte:
+		data = v
+	case string:
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("binary element is not encoded in base64")
+	}
+	return Binary{ContentType: element.ContentType, Data: data}, nil
 }
 
 // ToJSON converts an Element into JSON.
@@ -142,8 +1293,125 @@ func (element Element) ToJSON() ([]byte, error) {
 	return json.Marshal(element)
 }
 
+// Size returns the size in bytes of the Value of an Element decoded
+// from JSON, like ElementSize, but from the encoding it was decoded
+// from instead of encoding it again. It returns 0 if the Element was
+// not decoded or it is binary.
+func (element Element) Size() int {
+	if element.raw == nil || element.ContentType != "" {
+		return 0
+	}
+	if s, ok := element.Value.(string); ok {
+		return len(s)
+	}
+	return len(element.raw)
+}
+
+// WriteJSON writes the JSON encoding of the Element into buf, like
+// ToJSON, but reusing the encoding of its Value if it was decoded.
+func (element Element) WriteJSON(buf *bytes.Buffer) error {
+	if element.raw == nil {
+		b, err := element.ToJSON()
+		buf.Write(b)
+		return err
+	}
+
+	buf.WriteString(`{"element":`)
+	if err := json.Compact(buf, element.raw); err != nil {
+		return err
+	}
+	if element.Priority != nil {
+		// Do not check error as a float64 is
+		// suitable for a JSON encoding.
+		b, _ := json.Marshal(*element.Priority)
+		buf.WriteString(`,"priority":`)
+		buf.Write(b)
+	}
+	if element.ContentType != "" {
+		// Do not check error as a string is
+		// suitable for a JSON encoding.
+		b, _ := json.Marshal(element.ContentType)
+		buf.WriteString(`,"content_type":`)
+		buf.Write(b)
+	}
+	if element.PushedAt != nil {
+		// Do not check error as a date is
+		// suitable for a JSON encoding.
+		b, _ := json.Marshal(*element.PushedAt)
+		buf.WriteString(`,"pushed_at":`)
+		buf.Write(b)
+	}
+	if element.Tag != "" {
+		b, _ := json.Marshal(element.Tag)
+		buf.WriteString(`,"tag":`)
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
 // Decode decodes json data into an Element.
 func (element *Element) Decode(r io.Reader) error {
-	decoder := json.NewDecoder(r)
-	return decoder.Decode(element)
+	var e elementJSON
+	if err := json.NewDecoder(r).Decode(&e); err != nil {
+		return err
+	}
+	element.Priority = e.Priority
+	element.ContentType = e.ContentType
+	element.Tag = e.Tag
+	return element.decodeValue(e.Value)
+}
+
+// decodeValue decodes the JSON encoding of the Value of
+// the Element, keeping it. A missing Value decodes into nil.
+func (element *Element) decodeValue(raw json.RawMessage) error {
+	element.Value, element.raw = nil, nil
+	if raw == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, &element.Value); err != nil {
+		return err
+	}
+	element.raw = raw
+	return nil
+}
+
+// DecodeStrict decodes json data into an Element, like Decode, but
+// it also requires the data to be an object containing only a non-null
+// "element" key, and optionally "priority" and "content_type" keys.
+func (element *Element) DecodeStrict(r io.Reader) error {
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&fields); err != nil {
+		return err
+	}
+
+	value, ok := fields["element"]
+	if !ok {
+		return errors.New("missing element key")
+	}
+	for key := range fields {
+		if key != "element" && key != "priority" && key != "content_type" && key != "tag" {
+			return errors.New("unknown keys besides element, priority, content_type and tag")
+		}
+	}
+	if string(value) == "null" {
+		return errors.New("element is null")
+	}
+
+	if priority, ok := fields["priority"]; ok {
+		if err := json.Unmarshal(priority, &element.Priority); err != nil {
+			return err
+		}
+	}
+	if contentType, ok := fields["content_type"]; ok {
+		if err := json.Unmarshal(contentType, &element.ContentType); err != nil {
+			return err
+		}
+	}
+	if tag, ok := fields["tag"]; ok {
+		if err := json.Unmarshal(tag, &element.Tag); err != nil {
+			return err
+		}
+	}
+	return element.decodeValue(value)
 }
@@ -2,6 +2,9 @@ package pila
 
 import (
 	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
 	"time"
 )
 
@@ -14,13 +17,35 @@ type StackStatuser interface {
 
 // StackStatus represents the status of a Stack.
 type StackStatus struct {
-	ID        string      `json:"id"`
-	Name      string      `json:"name"`
-	Peek      interface{} `json:"peek"`
-	Size      int         `json:"size"`
-	CreatedAt time.Time   `json:"created_at"`
-	UpdatedAt time.Time   `json:"updated_at"`
-	ReadAt    time.Time   `json:"read_at"`
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Peek        interface{}    `json:"peek"`
+	Size        int            `json:"size"`
+	SizeApprox  int            `json:"size_approx"`
+	Version     uint64         `json:"version"`
+	PeakSize    int            `json:"peak_size"`
+	Pushes      int64          `json:"pushes"`
+	Pops        int64          `json:"pops"`
+	Memory      int64          `json:"memory"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	ReadAt      time.Time      `json:"read_at"`
+	PushedAt    *time.Time     `json:"pushed_at,omitempty"`
+	PoppedAt    *time.Time     `json:"popped_at,omitempty"`
+	Type        Structure      `json:"type,omitempty"`
+	MaxSize     int            `json:"max_size,omitempty"`
+	Policy      OverflowPolicy `json:"overflow_policy,omitempty"`
+	RateLimit   int            `json:"rate_limit,omitempty"`
+	TTL         string         `json:"ttl,omitempty"`
+	Spill       int            `json:"spill,omitempty"`
+	Store       string         `json:"store,omitempty"`
+	Unique      UniquePolicy   `json:"unique,omitempty"`
+	History     int            `json:"history,omitempty"`
+	Compress    int            `json:"compress,omitempty"`
+	Encrypted   bool           `json:"encrypted,omitempty"`
+	Watermarks  *Watermarks    `json:"watermarks,omitempty"`
+	Archived    bool           `json:"archived,omitempty"`
+	LockedUntil *time.Time     `json:"locked_until,omitempty"`
 }
 
 // ToJSON converts a StackStatus into JSON.
@@ -63,3 +88,78 @@ type StacksKV struct {
 func (stacksKV StacksKV) ToJSON() ([]byte, error) {
 	return json.Marshal(stacksKV)
 }
+
+// StacksSort represents the order of a list of Stacks.
+type StacksSort string
+
+const (
+	// SortByName sorts Stacks by name.
+	SortByName StacksSort = "name"
+	// SortBySize sorts Stacks by number of elements.
+	SortBySize StacksSort = "size"
+	// SortByUpdated sorts Stacks by date of last update.
+	SortByUpdated StacksSort = "updated"
+)
+
+// StacksOptions determines which Stacks are listed, and their order.
+type StacksOptions struct {
+	// Filter is a pattern, as in path.Match, matching the
+	// names of the listed Stacks, e.g. jobs-*, all if empty
+	Filter string
+	// Sort is the order of the Stacks, by name if empty
+	Sort StacksSort
+	// Desc reverses the order of the Stacks, which are
+	// sorted by name anyway when they are equal
+	Desc bool
+}
+
+// Validate returns an error if Sort is unknown
+// or Filter is a malformed pattern.
+func (opts StacksOptions) Validate() error {
+	switch opts.Sort {
+	case "", SortByName, SortBySize, SortByUpdated:
+	default:
+		return fmt.Errorf("unknown sort %s", opts.Sort)
+	}
+	if _, err := path.Match(opts.Filter, ""); err != nil {
+		return fmt.Errorf("malformed filter %s", opts.Filter)
+	}
+	return nil
+}
+
+// Match determines whether a Stack named name is listed.
+func (opts StacksOptions) Match(name string) bool {
+	if opts.Filter == "" {
+		return true
+	}
+	ok, _ := path.Match(opts.Filter, name)
+	return ok
+}
+
+// SortStacks sorts a list of StackStatus in place.
+func (opts StacksOptions) SortStacks(stacks []StackStatus) {
+	sort.Sort(stacksStatusBy{stacks: stacks, opts: opts})
+}
+
+// stacksStatusBy sorts a list of StackStatus given StacksOptions.
+type stacksStatusBy struct {
+	stacks []StackStatus
+	opts   StacksOptions
+}
+
+func (s stacksStatusBy) Len() int      { return len(s.stacks) }
+func (s stacksStatusBy) Swap(i, j int) { s.stacks[i], s.stacks[j] = s.stacks[j], s.stacks[i] }
+
+func (s stacksStatusBy) Less(i, j int) bool {
+	a, b := s.stacks[i], s.stacks[j]
+	if s.opts.Desc {
+		a, b = b, a
+	}
+	switch {
+	case s.opts.Sort == SortBySize && a.Size != b.Size:
+		return a.Size < b.Size
+	case s.opts.Sort == SortByUpdated && !a.UpdatedAt.Equal(b.UpdatedAt):
+		return a.UpdatedAt.Before(b.UpdatedAt)
+	}
+	return a.Name < b.Name
+}
@@ -18,12 +18,19 @@ func TestStackStatusJSON(t *testing.T) {
 	stack.Push(8)
 	stack.Push(5.87)
 	stack.Push([]byte("test"))
+	stack.Pop()
+	stack.Push([]byte("test"))
 	stack.Update(after)
+	pushedAt, _ := stack.PushedAt()
+	poppedAt, _ := stack.PoppedAt()
 
-	expectedStatus := fmt.Sprintf(`{"id":"2f44edeaa249ba81db20e9ddf000ba65","name":"test-stack","peek":"dGVzdA==","size":4,"created_at":"%v","updated_at":"%v","read_at":"%v"}`,
+	expectedStatus := fmt.Sprintf(`{"id":"%v","name":"test-stack","peek":"dGVzdA==","size":4,"size_approx":4,"version":6,"peak_size":4,"pushes":5,"pops":1,"memory":152,"created_at":"%v","updated_at":"%v","read_at":"%v","pushed_at":"%v","popped_at":"%v"}`,
+		stack.ID,
 		date.Format(now.Local()),
 		date.Format(after.Local()),
-		date.Format(after.Local()))
+		date.Format(after.Local()),
+		date.Format(pushedAt.Local()),
+		date.Format(poppedAt.Local()))
 	if status, err := stack.Status().ToJSON(); err != nil {
 		t.Fatal(err)
 	} else if string(status) != expectedStatus {
@@ -36,7 +43,8 @@ func TestStackStatusJSON_Empty(t *testing.T) {
 	stack := NewStack("test-stack", now)
 	stack.Update(now)
 
-	expectedStatus := fmt.Sprintf(`{"id":"2f44edeaa249ba81db20e9ddf000ba65","name":"test-stack","peek":null,"size":0,"created_at":"%v","updated_at":"%v","read_at":"%v"}`,
+	expectedStatus := fmt.Sprintf(`{"id":"%v","name":"test-stack","peek":null,"size":0,"size_approx":0,"version":0,"peak_size":0,"pushes":0,"pops":0,"memory":0,"created_at":"%v","updated_at":"%v","read_at":"%v"}`,
+		stack.ID,
 		date.Format(now.Local()),
 		date.Format(now.Local()),
 		date.Format(now.Local()))
@@ -91,10 +99,12 @@ func TestStacksStatusJSON(t *testing.T) {
 	stacksStatus := StacksStatus{
 		Stacks: []StackStatus{stack1.Status(), stack2.Status()},
 	}
+	pushedAt1, _ := stack1.PushedAt()
+	pushedAt2, _ := stack2.PushedAt()
 
-	expectedStatus := fmt.Sprintf(`{"stacks":[{"id":"a0bfff209889f6f782997a7bd5b3d536","name":"test-stack-1","peek":"dGVzdA==","size":4,"created_at":"%v","updated_at":"%v","read_at":"%v"},{"id":"f0d682fdfb3396c6f21e6f4d1d0da1cd","name":"test-stack-2","peek":999,"size":3,"created_at":"%v","updated_at":"%v","read_at":"%v"}]}`,
-		date.Format(now.Local()), date.Format(after.Local()), date.Format(after.Local()),
-		date.Format(now.Local()), date.Format(after.Local()), date.Format(after.Local()))
+	expectedStatus := fmt.Sprintf(`{"stacks":[{"id":"%v","name":"test-stack-1","peek":"dGVzdA==","size":4,"size_approx":4,"version":4,"peak_size":4,"pushes":4,"pops":0,"memory":152,"created_at":"%v","updated_at":"%v","read_at":"%v","pushed_at":"%v"},{"id":"%v","name":"test-stack-2","peek":999,"size":3,"size_approx":3,"version":3,"peak_size":3,"pushes":3,"pops":0,"memory":110,"created_at":"%v","updated_at":"%v","read_at":"%v","pushed_at":"%v"}]}`,
+		stack1.ID, date.Format(now.Local()), date.Format(after.Local()), date.Format(after.Local()), date.Format(pushedAt1.Local()),
+		stack2.ID, date.Format(now.Local()), date.Format(after.Local()), date.Format(after.Local()), date.Format(pushedAt2.Local()))
 	if status, err := stacksStatus.ToJSON(); err != nil {
 		t.Fatal(err)
 	} else if string(status) != expectedStatus {
@@ -231,3 +241,75 @@ func TestStacksKVJSON_Error(t *testing.T) {
 		}
 	}
 }
+
+func TestStacksOptionsValidate(t *testing.T) {
+	inputOutput := []struct {
+		input  StacksOptions
+		output bool
+	}{
+		{StacksOptions{}, true},
+		{StacksOptions{Filter: "jobs-*", Sort: SortBySize, Desc: true}, true},
+		{StacksOptions{Sort: SortByName}, true},
+		{StacksOptions{Sort: SortByUpdated}, true},
+		{StacksOptions{Sort: "memory"}, false},
+		{StacksOptions{Filter: "jobs-["}, false},
+	}
+
+	for _, io := range inputOutput {
+		if err := io.input.Validate(); (err == nil) != io.output {
+			t.Errorf("validation of %v is %v, expected valid %v", io.input, err, io.output)
+		}
+	}
+}
+
+func TestStacksOptionsMatch(t *testing.T) {
+	inputOutput := []struct {
+		filter, name string
+		output       bool
+	}{
+		{"", "jobs", true},
+		{"jobs", "jobs", true},
+		{"jobs", "jobs-1", false},
+		{"jobs-*", "jobs-1", true},
+		{"jobs-*", "tasks-1", false},
+		{"*-[0-9]", "tasks-1", true},
+	}
+
+	for _, io := range inputOutput {
+		if output := (StacksOptions{Filter: io.filter}).Match(io.name); output != io.output {
+			t.Errorf("match of %s with %s is %v, expected %v", io.name, io.filter, output, io.output)
+		}
+	}
+}
+
+func TestStacksOptionsSortStacks(t *testing.T) {
+	now := time.Now()
+	stacks := []StackStatus{
+		{Name: "b", Size: 2, UpdatedAt: now},
+		{Name: "a", Size: 1, UpdatedAt: now.Add(time.Second)},
+		{Name: "c", Size: 2, UpdatedAt: now.Add(-time.Second)},
+	}
+
+	inputOutput := []struct {
+		input  StacksOptions
+		output []string
+	}{
+		{StacksOptions{}, []string{"a", "b", "c"}},
+		{StacksOptions{Desc: true}, []string{"c", "b", "a"}},
+		{StacksOptions{Sort: SortBySize}, []string{"a", "b", "c"}},
+		{StacksOptions{Sort: SortBySize, Desc: true}, []string{"c", "b", "a"}},
+		{StacksOptions{Sort: SortByUpdated}, []string{"c", "b", "a"}},
+		{StacksOptions{Sort: SortByUpdated, Desc: true}, []string{"a", "b", "c"}},
+	}
+
+	for _, io := range inputOutput {
+		io.input.SortStacks(stacks)
+		var names []string
+		for _, s := range stacks {
+			names = append(names, s.Name)
+		}
+		if !reflect.DeepEqual(names, io.output) {
+			t.Errorf("stacks sorted by %v are %v, expected %v", io.input, names, io.output)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package pila
 import (
 	"bytes"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -15,8 +16,8 @@ func TestNewStack(t *testing.T) {
 		t.Fatal("stack is nil")
 	}
 
-	if stack.ID.String() != "2f44edeaa249ba81db20e9ddf000ba65" {
-		t.Errorf("stack.ID is %s, expected %s", stack.ID.String(), "2f44edeaa249ba81db20e9ddf000ba65")
+	if len(stack.ID.String()) != 32 {
+		t.Errorf("stack.ID is %s, expected a UUID", stack.ID.String())
 	}
 	if stack.Name != "test-stack" {
 		t.Errorf("stack.Name is %s, expected %s", stack.Name, "test-stack")
@@ -86,6 +87,387 @@ func TestStackPop_False(t *testing.T) {
 	}
 }
 
+func TestStackPushN(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+	if err := stack.PushN([]interface{}{"foo", 8, "bar"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if stack.Size() != 3 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 3)
+	}
+	if stack.Pushes() != 3 {
+		t.Errorf("stack.Pushes() is %d, expected %d", stack.Pushes(), 3)
+	}
+	if stack.Peek() != "bar" {
+		t.Errorf("stack.Peek() is %v, expected %v", stack.Peek(), "bar")
+	}
+}
+
+func TestStackPushN_Limit(t *testing.T) {
+	stack := NewStackWithLimit("test-stack", time.Now(), 3, OverflowReject)
+	_ = stack.Push("foo")
+
+	if err := stack.PushN([]interface{}{"bar", "baz", "qux"}); err != ErrStackFull {
+		t.Errorf("err is %v, expected %v", err, ErrStackFull)
+	}
+	if stack.Size() != 1 {
+		t.Errorf("stack is modified by a rejected push")
+	}
+	if err := stack.PushN([]interface{}{"bar", "baz"}); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+
+	stack = NewStackWithLimit("test-stack", time.Now(), 2, OverflowDropOldest)
+	if err := stack.PushN([]interface{}{"foo", "bar", "baz"}); err != nil {
+		t.Fatal(err)
+	}
+	if elements := stack.PopN(3); !reflect.DeepEqual(elements, []interface{}{"baz", "bar"}) {
+		t.Errorf("elements are %v, expected %v", elements, []interface{}{"baz", "bar"})
+	}
+}
+
+func TestStackPopN(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+	_ = stack.PushN([]interface{}{"foo", 8, "bar"})
+
+	inputOutput := []struct {
+		input  int
+		output []interface{}
+	}{
+		{2, []interface{}{"bar", 8}},
+		{2, []interface{}{"foo"}},
+		{2, []interface{}{}},
+	}
+
+	for _, io := range inputOutput {
+		if elements := stack.PopN(io.input); !reflect.DeepEqual(elements, io.output) {
+			t.Errorf("elements are %v, expected %v", elements, io.output)
+		}
+	}
+	if stack.Pops() != 3 {
+		t.Errorf("stack.Pops() is %d, expected %d", stack.Pops(), 3)
+	}
+}
+
+func TestStackRotate(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+	if _, ok, err := stack.Rotate(); ok || err != nil {
+		t.Errorf("stack.Rotate() is %v, %v, expected false and nil", ok, err)
+	}
+
+	_ = stack.PushN([]interface{}{"foo", 8, "bar"})
+	_ = stack.PushWithExpiration("expired", time.Now().Add(-time.Second))
+
+	var events []Event
+	stack.Subscribe(func(e Event) {
+		events = append(events, e)
+	})
+
+	element, ok, err := stack.Rotate()
+	if !ok || err != nil {
+		t.Fatalf("stack.Rotate() is %v, %v, expected true and nil", ok, err)
+	}
+	if element != "bar" {
+		t.Errorf("element is %v, expected %v", element, "bar")
+	}
+	if base, _ := stack.Base(); base != "bar" {
+		t.Errorf("stack.Base() is %v, expected %v", base, "bar")
+	}
+	if stack.Peek() != 8 {
+		t.Errorf("stack.Peek() is %v, expected %v", stack.Peek(), 8)
+	}
+	if stack.Size() != 3 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 3)
+	}
+	if expected := []Event{{Op: EventRotate, Element: "bar"}}; !reflect.DeepEqual(events, expected) {
+		t.Errorf("events are %v, expected %v", events, expected)
+	}
+}
+
+func TestStackSweep(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+	if _, ok, err := stack.Sweep(); ok || err != nil {
+		t.Errorf("stack.Sweep() is %v, %v, expected false and nil", ok, err)
+	}
+
+	_ = stack.PushN([]interface{}{"foo", 8, "bar"})
+
+	element, ok, err := stack.Sweep()
+	if !ok || err != nil {
+		t.Fatalf("stack.Sweep() is %v, %v, expected true and nil", ok, err)
+	}
+	if element != "foo" {
+		t.Errorf("element is %v, expected %v", element, "foo")
+	}
+	if stack.Peek() != "bar" {
+		t.Errorf("stack.Peek() is %v, expected %v", stack.Peek(), "bar")
+	}
+	if base, _ := stack.Base(); base != 8 {
+		t.Errorf("stack.Base() is %v, expected %v", base, 8)
+	}
+	if stack.SizeApprox() != 2 {
+		t.Errorf("stack.SizeApprox() is %d, expected %d", stack.SizeApprox(), 2)
+	}
+	if stack.Pops() != 1 {
+		t.Errorf("stack.Pops() is %d, expected %d", stack.Pops(), 1)
+	}
+}
+
+func TestQueueRotate(t *testing.T) {
+	queue := NewQueue("test-queue", time.Now())
+	_ = queue.PushN([]interface{}{"foo", 8, "bar"})
+
+	if element, _, _ := queue.Rotate(); element != "foo" {
+		t.Errorf("element is %v, expected %v", element, "foo")
+	}
+	if queue.Peek() != 8 {
+		t.Errorf("queue.Peek() is %v, expected %v", queue.Peek(), 8)
+	}
+	if element, _, _ := queue.Sweep(); element != "foo" {
+		t.Errorf("element is %v, expected %v", element, "foo")
+	}
+	if base, _ := queue.Base(); base != "bar" {
+		t.Errorf("queue.Base() is %v, expected %v", base, "bar")
+	}
+}
+
+func TestPriorityRotate_Unsupported(t *testing.T) {
+	priority := NewPriority("test-priority", time.Now())
+	_ = priority.Push("foo")
+
+	if _, _, err := priority.Rotate(); err != ErrUnsupported {
+		t.Errorf("err is %v, expected %v", err, ErrUnsupported)
+	}
+	if _, err := priority.Base(); err != ErrUnsupported {
+		t.Errorf("err is %v, expected %v", err, ErrUnsupported)
+	}
+	if _, _, err := priority.Sweep(); err != ErrUnsupported {
+		t.Errorf("err is %v, expected %v", err, ErrUnsupported)
+	}
+}
+
+func TestStackElements(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+	_ = stack.PushN([]interface{}{"foo", 8, "bar"})
+	_ = stack.PushWithExpiration("expired", time.Now().Add(-time.Second))
+	_ = stack.PushWithExpiration("baz", time.Now().Add(time.Hour))
+
+	inputOutput := []struct {
+		offset, limit int
+		output        []interface{}
+	}{
+		{0, 10, []interface{}{"baz", "bar", 8, "foo"}},
+		{1, 2, []interface{}{"bar", 8}},
+		{4, 2, []interface{}{}},
+	}
+
+	for _, io := range inputOutput {
+		if elements := stack.Elements(io.offset, io.limit); !reflect.DeepEqual(elements, io.output) {
+			t.Errorf("elements are %v, expected %v", elements, io.output)
+		}
+	}
+	if stack.Size() != 4 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 4)
+	}
+}
+
+func TestPriorityElements(t *testing.T) {
+	priority := NewPriority("test-priority", time.Now())
+	_ = priority.PushWithPriority("low", 1, time.Time{})
+	_ = priority.PushWithPriority("high", 5, time.Time{})
+	_ = priority.Push("zero")
+
+	expected := []interface{}{"high", "low", "zero"}
+	if elements := priority.Elements(0, 10); !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+}
+
+func TestStackMaxElementSize(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+	stack.SetMaxElementSize(5)
+	if stack.MaxElementSize() != 5 {
+		t.Errorf("stack.MaxElementSize() is %d, expected %d", stack.MaxElementSize(), 5)
+	}
+
+	inputOutput := []struct {
+		input  interface{}
+		output error
+	}{
+		{"foo", nil},
+		{"foobar", ErrElementTooLarge},
+		{12345, nil},
+		{123456, ErrElementTooLarge},
+		{Binary{ContentType: "text/plain", Data: []byte("hello")}, nil},
+		{Binary{ContentType: "text/plain", Data: []byte("hello!")}, ErrElementTooLarge},
+	}
+
+	for _, io := range inputOutput {
+		if err := stack.Push(io.input); err != io.output {
+			t.Errorf("err is %v, expected %v for %v", err, io.output, io.input)
+		}
+	}
+	if err := stack.PushWithExpiration("foobar", time.Now().Add(time.Hour)); err != ErrElementTooLarge {
+		t.Errorf("err is %v, expected %v", err, ErrElementTooLarge)
+	}
+	if err := stack.PushN([]interface{}{"foo", "foobar"}); err != ErrElementTooLarge {
+		t.Errorf("err is %v, expected %v", err, ErrElementTooLarge)
+	}
+	if stack.Size() != 3 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 3)
+	}
+
+	stack.SetMaxElementSize(-1)
+	if err := stack.Push("foobar"); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+}
+
+func TestElementSize(t *testing.T) {
+	inputOutput := []struct {
+		input  interface{}
+		output int
+	}{
+		{"foo", 3},
+		{[]byte("hello"), 5},
+		{Binary{Data: []byte("hi")}, 2},
+		{8, 1},
+		{map[string]int{"one": 1}, 9},
+		{nil, 4},
+	}
+
+	for _, io := range inputOutput {
+		if size := ElementSize(io.input); size != io.output {
+			t.Errorf("size is %d, expected %d for %v", size, io.output, io.input)
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	queue := NewQueue("test-queue", time.Now())
+	if queue.Type != StructureQueue {
+		t.Errorf("queue.Type is %s, expected %s", queue.Type, StructureQueue)
+	}
+
+	for _, element := range []interface{}{"foo", 8, "bar"} {
+		if err := queue.Push(element); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if queue.Peek() != "foo" {
+		t.Errorf("queue.Peek() is %v, expected %v", queue.Peek(), "foo")
+	}
+	if status := queue.Status(); status.Type != StructureQueue || status.Peek != "foo" {
+		t.Errorf("status has type %s and peek %v, expected %s and %v", status.Type, status.Peek, StructureQueue, "foo")
+	}
+	if elements := queue.PopN(3); !reflect.DeepEqual(elements, []interface{}{"foo", 8, "bar"}) {
+		t.Errorf("elements are %v, expected %v", elements, []interface{}{"foo", 8, "bar"})
+	}
+}
+
+func TestQueue_Expiration(t *testing.T) {
+	now := time.Now()
+	queue := NewQueue("test-queue", now)
+	_ = queue.PushWithExpiration("foo", now.Add(-time.Second))
+	_ = queue.Push("bar")
+	_ = queue.PushWithExpiration("baz", now.Add(time.Hour))
+
+	if queue.Peek() != "bar" {
+		t.Errorf("queue.Peek() is %v, expected %v", queue.Peek(), "bar")
+	}
+	if queue.Size() != 2 {
+		t.Errorf("queue.Size() is %d, expected %d", queue.Size(), 2)
+	}
+	if element, _ := queue.Pop(); element != "bar" {
+		t.Errorf("element is %v, expected %v", element, "bar")
+	}
+}
+
+func TestQueue_DropOldest(t *testing.T) {
+	queue := NewQueueWithLimit("test-queue", time.Now(), 2, OverflowDropOldest)
+	for _, element := range []interface{}{"foo", "bar", "baz"} {
+		if err := queue.Push(element); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if queue.SizeApprox() != 2 {
+		t.Errorf("queue.SizeApprox() is %d, expected %d", queue.SizeApprox(), 2)
+	}
+	if elements := queue.PopN(3); !reflect.DeepEqual(elements, []interface{}{"bar", "baz"}) {
+		t.Errorf("elements are %v, expected %v", elements, []interface{}{"bar", "baz"})
+	}
+}
+
+func TestPriority(t *testing.T) {
+	now := time.Now()
+	p := NewPriority("test-priority", now)
+	if p.Type != StructurePriority {
+		t.Errorf("p.Type is %s, expected %s", p.Type, StructurePriority)
+	}
+
+	_ = p.PushWithPriority("low", 1, time.Time{})
+	_ = p.Push("zero")
+	_ = p.PushWithPriority("high", 5, time.Time{})
+	_ = p.PushWithPriority("expired", 10, now.Add(-time.Second))
+	_ = p.PushWithPriority("alive", 3, now.Add(time.Hour))
+
+	if p.Peek() != "high" {
+		t.Errorf("p.Peek() is %v, expected %v", p.Peek(), "high")
+	}
+	if p.Size() != 4 {
+		t.Errorf("p.Size() is %d, expected %d", p.Size(), 4)
+	}
+	expected := []interface{}{"high", "alive", "low", "zero"}
+	if elements := p.PopN(5); !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+}
+
+func TestPriority_Limit(t *testing.T) {
+	p := NewPriorityWithLimit("test-priority", time.Now(), 2, OverflowDropOldest)
+	_ = p.PushWithPriority("foo", 9, time.Time{})
+	_ = p.PushWithPriority("bar", 1, time.Time{})
+	_ = p.PushWithPriority("baz", 5, time.Time{})
+
+	if elements := p.PopN(3); !reflect.DeepEqual(elements, []interface{}{"baz", "bar"}) {
+		t.Errorf("elements are %v, expected %v", elements, []interface{}{"baz", "bar"})
+	}
+}
+
+func TestStackPushWithPriority(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+	_ = stack.PushWithPriority("foo", 5, time.Time{})
+	_ = stack.PushWithPriority("bar", 1, time.Time{})
+
+	if elements := stack.PopN(2); !reflect.DeepEqual(elements, []interface{}{"bar", "foo"}) {
+		t.Errorf("elements are %v, expected %v", elements, []interface{}{"bar", "foo"})
+	}
+}
+
+func TestNewStructureWithLimit(t *testing.T) {
+	inputOutput := []struct {
+		input  Structure
+		output Structure
+	}{
+		{StructureStack, StructureStack},
+		{StructureQueue, StructureQueue},
+		{StructurePriority, StructurePriority},
+		{"", StructureStack},
+	}
+
+	for _, io := range inputOutput {
+		s := NewStructureWithLimit(io.input, "test", time.Now(), 1, OverflowReject)
+		if s.Type != io.output {
+			t.Errorf("type is %s, expected %s", s.Type, io.output)
+		}
+		if s.MaxSize != 1 || s.Policy != OverflowReject {
+			t.Errorf("stack limit is %d %s, expected %d %s", s.MaxSize, s.Policy, 1, OverflowReject)
+		}
+	}
+}
+
 func TestStackSize(t *testing.T) {
 	stack := NewStack("test-stack", time.Now())
 	if stack.Size() != 0 {
@@ -107,6 +489,218 @@ func TestStackSize(t *testing.T) {
 	}
 }
 
+func TestStackSizeApprox(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+	if stack.SizeApprox() != 0 {
+		t.Errorf("stack.SizeApprox() is %d, expected %d", stack.SizeApprox(), 0)
+	}
+
+	for i := 0; i < 15; i++ {
+		stack.Push(i)
+	}
+	if stack.SizeApprox() != 15 {
+		t.Errorf("stack.SizeApprox() is %d, expected %d", stack.SizeApprox(), 15)
+	}
+
+	for i := 0; i < 20; i++ {
+		stack.Pop()
+	}
+	if stack.SizeApprox() != 0 {
+		t.Errorf("stack.SizeApprox() is %d, expected %d", stack.SizeApprox(), 0)
+	}
+
+	stack.Push(1)
+	stack.Push(2)
+	stack.Flush()
+	if stack.SizeApprox() != 0 {
+		t.Errorf("stack.SizeApprox() is %d, expected %d", stack.SizeApprox(), 0)
+	}
+}
+
+func TestStackSizeApprox_Concurrent(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				stack.Push(j)
+				_ = stack.SizeApprox()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stack.SizeApprox() != stack.Size() {
+		t.Errorf("stack.SizeApprox() is %d, expected %d", stack.SizeApprox(), stack.Size())
+	}
+}
+
+func TestStack_Concurrent(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				stack.Push(j)
+				_ = stack.Peek()
+				_ = stack.Size()
+				stack.Update(time.Now())
+				_ = stack.Status()
+				if _, ok := stack.Pop(); !ok {
+					t.Error("stack is empty, expected not to be")
+				}
+				stack.Read(time.Now())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stack.Size() != 0 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 0)
+	}
+}
+
+func TestNewStackWithLimit(t *testing.T) {
+	stack := NewStackWithLimit("test-stack", time.Now(), 10, OverflowDropOldest)
+
+	if stack.MaxSize != 10 {
+		t.Errorf("stack.MaxSize is %d, expected %d", stack.MaxSize, 10)
+	}
+	if stack.Policy != OverflowDropOldest {
+		t.Errorf("stack.Policy is %s, expected %s", stack.Policy, OverflowDropOldest)
+	}
+
+	status := stack.Status()
+	if status.MaxSize != 10 || status.Policy != OverflowDropOldest {
+		t.Errorf("status is %v, expected to contain limit", status)
+	}
+}
+
+func TestStackPush_Reject(t *testing.T) {
+	stack := NewStackWithLimit("test-stack", time.Now(), 2, OverflowReject)
+
+	for _, element := range []interface{}{"foo", "bar"} {
+		if err := stack.Push(element); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stack.Push("baz"); err != ErrStackFull {
+		t.Errorf("err is %v, expected %v", err, ErrStackFull)
+	}
+	if err := stack.PushWithExpiration("baz", time.Now().Add(time.Hour)); err != ErrStackFull {
+		t.Errorf("err is %v, expected %v", err, ErrStackFull)
+	}
+
+	if stack.Size() != 2 || stack.Peek() != "bar" {
+		t.Errorf("stack is modified by a rejected push")
+	}
+
+	_, _ = stack.Pop()
+	if err := stack.Push("baz"); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+}
+
+func TestStackPush_DropOldest(t *testing.T) {
+	stack := NewStackWithLimit("test-stack", time.Now(), 2, OverflowDropOldest)
+
+	for _, element := range []interface{}{"foo", "bar", "baz"} {
+		if err := stack.Push(element); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stack.Size() != 2 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 2)
+	}
+	if stack.SizeApprox() != 2 {
+		t.Errorf("stack.SizeApprox() is %d, expected %d", stack.SizeApprox(), 2)
+	}
+	for _, expected := range []interface{}{"baz", "bar"} {
+		if element, _ := stack.Pop(); element != expected {
+			t.Errorf("element is %v, expected %v", element, expected)
+		}
+	}
+}
+
+func TestStackPush_Concurrent(t *testing.T) {
+	stack := NewStackWithLimit("test-stack", time.Now(), 10, OverflowReject)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_ = stack.Push(j)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stack.Size() != 10 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 10)
+	}
+}
+
+func TestStackPushWithExpiration(t *testing.T) {
+	now := time.Now()
+	stack := NewStack("test-stack", now)
+	stack.Push("foo")
+	stack.PushWithExpiration("expired", now.Add(-time.Second))
+	stack.PushWithExpiration("bar", now.Add(time.Hour))
+	stack.PushWithExpiration("expired", now.Add(-time.Second))
+
+	if stack.Size() != 2 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 2)
+	}
+	if peek := stack.Peek(); peek != "bar" {
+		t.Errorf("stack.Peek() is %v, expected %v", peek, "bar")
+	}
+
+	for _, expected := range []interface{}{"bar", "foo"} {
+		if element, ok := stack.Pop(); !ok || element != expected {
+			t.Errorf("element is %v, expected %v", element, expected)
+		}
+	}
+	if element, ok := stack.Pop(); ok {
+		t.Errorf("element is %v, expected stack to be empty", element)
+	}
+	if stack.SizeApprox() != 0 {
+		t.Errorf("stack.SizeApprox() is %d, expected %d", stack.SizeApprox(), 0)
+	}
+}
+
+func TestStackExpire(t *testing.T) {
+	now := time.Now()
+	stack := NewStack("test-stack", now)
+
+	stack.Push("foo")
+	if removed := stack.Expire(now); removed != 0 {
+		t.Errorf("removed is %d, expected %d", removed, 0)
+	}
+
+	stack.PushWithExpiration("expired", now.Add(time.Second))
+	stack.PushWithExpiration("bar", now.Add(time.Hour))
+	stack.Push("baz")
+
+	if removed := stack.Expire(now.Add(time.Minute)); removed != 1 {
+		t.Errorf("removed is %d, expected %d", removed, 1)
+	}
+	if stack.SizeApprox() != 3 {
+		t.Errorf("stack.SizeApprox() is %d, expected %d", stack.SizeApprox(), 3)
+	}
+	if stack.base.Size() != 3 {
+		t.Errorf("stack.base.Size() is %d, expected %d", stack.base.Size(), 3)
+	}
+}
+
 func TestStackPeek(t *testing.T) {
 	stack := NewStack("test-stack", time.Now())
 	stack.Push("test")
@@ -171,24 +765,18 @@ func TestStackRead(t *testing.T) {
 	}
 }
 
-func TestStackSetID(t *testing.T) {
+func TestStackSetDatabase(t *testing.T) {
 	db := NewDatabase("test-db")
 
 	stack := NewStack("test-stack", time.Now())
-	stack.Database = db
-	stack.SetID()
+	id := stack.ID
+	stack.SetDatabase(db)
 
-	if stack.ID.String() != "378c2601e338a49341d9858081452226" {
-		t.Errorf("stack.ID is %s, expected %s", stack.ID.String(), "378c2601e338a49341d9858081452226")
+	if stack.Database != db {
+		t.Errorf("stack.Database is %v, expected %v", stack.Database, db)
 	}
-}
-
-func TestStackSetID_NoDatabase(t *testing.T) {
-	stack := NewStack("test-stack", time.Now())
-	stack.SetID()
-
-	if stack.ID.String() != "2f44edeaa249ba81db20e9ddf000ba65" {
-		t.Errorf("stack.ID is %s, expected %s", stack.ID.String(), "2f44edeaa249ba81db20e9ddf000ba65")
+	if stack.ID != id {
+		t.Errorf("stack.ID is %s, expected %s", stack.ID, id)
 	}
 }
 
@@ -231,6 +819,54 @@ func TestElementJSON(t *testing.T) {
 
 }
 
+func TestNewElement(t *testing.T) {
+	inputOutput := []struct {
+		input  interface{}
+		output string
+	}{
+		{"foo", `{"element":"foo"}`},
+		{Binary{ContentType: "text/plain", Data: []byte("hello")}, `{"element":"aGVsbG8=","content_type":"text/plain"}`},
+	}
+
+	for _, io := range inputOutput {
+		if b, _ := NewElement(io.input).ToJSON(); string(b) != io.output {
+			t.Errorf("element is %s, expected %s", b, io.output)
+		}
+	}
+}
+
+func TestElementStackValue(t *testing.T) {
+	inputOutput := []struct {
+		input  Element
+		output interface{}
+	}{
+		{Element{Value: "aGVsbG8="}, "aGVsbG8="},
+		{Element{Value: "aGVsbG8=", ContentType: "text/plain"}, Binary{ContentType: "text/plain", Data: []byte("hello")}},
+		{Element{Value: []byte("hello"), ContentType: "text/plain"}, Binary{ContentType: "text/plain", Data: []byte("hello")}},
+	}
+
+	for _, io := range inputOutput {
+		if value, err := io.input.StackValue(); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(value, io.output) {
+			t.Errorf("value is %v, expected %v", value, io.output)
+		}
+	}
+}
+
+func TestElementStackValue_Error(t *testing.T) {
+	elements := []Element{
+		{Value: "not base64!", ContentType: "text/plain"},
+		{Value: 8, ContentType: "text/plain"},
+	}
+
+	for _, element := range elements {
+		if _, err := element.StackValue(); err == nil {
+			t.Errorf("err is nil for %v, expected error", element.Value)
+		}
+	}
+}
+
 func TestElementJSON_Error(t *testing.T) {
 	// From https://golang.org/src/encoding/json/encode.go?s=5438:5481#L125
 	// Channel, complex, and function values cannot be encoded in JSON.
@@ -299,3 +935,285 @@ func TestElementDecode_Error(t *testing.T) {
 		}
 	}
 }
+
+func TestElementDecodeStrict(t *testing.T) {
+	r := bytes.NewBufferString(`{"element":{"one":1}}`)
+
+	var element Element
+	if err := element.DecodeStrict(r); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{"one": 1.0}
+	if !reflect.DeepEqual(element.Value, expected) {
+		t.Errorf("element is %#v, expected %#v", element.Value, expected)
+	}
+}
+
+func TestElementDecodeStrict_Priority(t *testing.T) {
+	r := bytes.NewBufferString(`{"element":"foo","priority":2.5}`)
+
+	var element Element
+	if err := element.DecodeStrict(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if element.Value != "foo" || element.Priority == nil || *element.Priority != 2.5 {
+		t.Errorf("element is %v, expected %v with priority %v", element.Value, "foo", 2.5)
+	}
+}
+
+func TestElementDecodeStrict_ContentType(t *testing.T) {
+	r := bytes.NewBufferString(`{"element":"aGVsbG8=","content_type":"text/plain"}`)
+
+	var element Element
+	if err := element.DecodeStrict(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if element.Value != "aGVsbG8=" || element.ContentType != "text/plain" {
+		t.Errorf("element is %v with content type %s, expected %v with content type %s",
+			element.Value, element.ContentType, "aGVsbG8=", "text/plain")
+	}
+}
+
+func TestElementDecodeStrict_Error(t *testing.T) {
+	elementReaders := []string{
+		`{`,
+		`[1, 2]`,
+		`{}`,
+		`{"elemnt":1}`,
+		`{"element":1,"foo":2}`,
+		`{"element":1,"priority":2,"foo":3}`,
+		`{"element":1,"priority":"high"}`,
+		`{"element":1,"content_type":2}`,
+		`{"priority":2}`,
+		`{"element":null}`,
+	}
+
+	for _, elementReader := range elementReaders {
+		r := bytes.NewBufferString(elementReader)
+
+		var element Element
+		if err := element.DecodeStrict(r); err == nil {
+			t.Errorf("err is nil for %s, expected error", elementReader)
+		}
+	}
+}
+
+func TestStackPopIf(t *testing.T) {
+	stack := NewStack("stack", time.Now())
+	always := func(interface{}, uint64) bool { return true }
+	if _, ok, err := stack.PopIf(always); ok || err != nil {
+		t.Errorf("PopIf on an empty stack is %v and %v, expected false and nil", ok, err)
+	}
+
+	_ = stack.Push("foo")
+	_ = stack.PushWithExpiration("bar", time.Now().Add(-time.Second))
+	peek, version := stack.PeekVersion()
+	if peek != "foo" || version != 3 {
+		t.Errorf("peek and version are %v and %d, expected %v and %d", peek, version, "foo", 3)
+	}
+
+	_ = stack.Push("baz")
+	if _, ok, err := stack.PopIf(func(value interface{}, v uint64) bool { return v == version }); ok || err != ErrConditionFailed {
+		t.Errorf("PopIf is %v and %v, expected false and %v", ok, err, ErrConditionFailed)
+	}
+	if stack.Size() != 2 || stack.Pops() != 0 {
+		t.Errorf("stack has size %d and %d pops, expected %d and %d", stack.Size(), stack.Pops(), 2, 0)
+	}
+
+	value, ok, err := stack.PopIf(func(value interface{}, v uint64) bool {
+		return value == "baz" && v == version+1
+	})
+	if !ok || err != nil || value != "baz" {
+		t.Errorf("PopIf is %v, %v and %v, expected %v, true and nil", value, ok, err, "baz")
+	}
+	if stack.Peek() != "foo" || stack.SizeApprox() != 1 || stack.Pops() != 1 {
+		t.Errorf("stack has peek %v, size %d and %d pops, expected %v, %d and %d",
+			stack.Peek(), stack.SizeApprox(), stack.Pops(), "foo", 1, 1)
+	}
+}
+
+func TestStackPopWait(t *testing.T) {
+	stack := NewStack("stack", time.Now())
+	_ = stack.Push("foo")
+
+	done := make(chan struct{})
+	if value, ok := stack.PopWait(done); !ok || value != "foo" {
+		t.Errorf("PopWait is %v and %v, expected %v and true", value, ok, "foo")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = stack.Push("bar")
+	}()
+	if value, ok := stack.PopWait(done); !ok || value != "bar" {
+		t.Errorf("PopWait is %v and %v, expected %v and true", value, ok, "bar")
+	}
+
+	close(done)
+	if value, ok := stack.PopWait(done); ok {
+		t.Errorf("PopWait is %v and %v, expected nil and false", value, ok)
+	}
+}
+
+func TestStackPushWithOptions(t *testing.T) {
+	stack := NewStack("test-stack", time.Now())
+	version := stack.Version()
+	priority := 1.0
+	expiresAt := time.Now().Add(time.Hour)
+
+	if err := stack.PushWithOptions("foo", PushOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stack.PushWithOptions("bar", PushOptions{If: func(v uint64) bool { return v == version }}); err != ErrConditionFailed {
+		t.Errorf("err is %v, expected %v", err, ErrConditionFailed)
+	}
+	if stack.Size() != 1 || stack.Version() != version+1 {
+		t.Errorf("stack has size %d and version %d, expected %d and %d", stack.Size(), stack.Version(), 1, version+1)
+	}
+	err := stack.PushWithOptions("bar", PushOptions{Priority: &priority, ExpiresAt: expiresAt, If: func(v uint64) bool { return v == version+1 }})
+	if err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+	if stack.Peek() != "bar" || !stack.hasExpiring() {
+		t.Errorf("peek is %v, expected %v", stack.Peek(), "bar")
+	}
+
+	limited := NewStackWithLimit("limited", time.Now(), 1, OverflowReject)
+	_ = limited.Push("foo")
+	always := func(uint64) bool { return true }
+	if err := limited.PushWithOptions("bar", PushOptions{If: always}); err != ErrStackFull {
+		t.Errorf("err is %v, expected %v", err, ErrStackFull)
+	}
+	limited.Policy = OverflowDropOldest
+	if err := limited.PushWithOptions("bar", PushOptions{If: always}); err != nil || limited.Size() != 1 || limited.Peek() != "bar" {
+		t.Errorf("err is %v, size %d and peek %v, expected nil, %d and %v", err, limited.Size(), limited.Peek(), 1, "bar")
+	}
+
+	unique := NewStack("unique", time.Now())
+	unique.SetUnique(UniqueReject)
+	_ = unique.Push("foo")
+	if err := unique.PushWithOptions("foo", PushOptions{If: always}); err != ErrDuplicate {
+		t.Errorf("err is %v, expected %v", err, ErrDuplicate)
+	}
+	unique.SetUnique(UniqueMoveToTop)
+	if err := unique.PushWithOptions("bar", PushOptions{If: always}); err != ErrUnsupported {
+		t.Errorf("err is %v, expected %v", err, ErrUnsupported)
+	}
+}
+
+func BenchmarkStackPushPop(b *testing.B) {
+	s := NewStack("stack", time.Now())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = s.Push("element")
+		s.Pop()
+	}
+}
+
+func TestElementWriteJSON(t *testing.T) {
+	priority := 2.5
+	elements := []Element{
+		{Value: "foo"},
+		{Value: []byte("hello"), ContentType: "text/plain"},
+		{Value: "foo", Priority: &priority},
+	}
+
+	for _, element := range elements {
+		expected, _ := element.ToJSON()
+
+		var buf bytes.Buffer
+		if err := element.WriteJSON(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != string(expected) {
+			t.Errorf("JSON is %s, expected %s", buf.String(), expected)
+		}
+	}
+}
+
+func TestElementWriteJSON_Decoded(t *testing.T) {
+	inputOutput := []struct {
+		input, output string
+	}{
+		{`{"element":"foo"}`, `{"element":"foo"}`},
+		{`{ "element" : { "one": 1.0, "two": [1, 2] } }`, `{"element":{"one":1.0,"two":[1,2]}}`},
+		{`{"element":"foo","priority":2.5}`, `{"element":"foo","priority":2.5}`},
+		{`{"element":"aGVsbG8=","content_type":"text/plain"}`, `{"element":"aGVsbG8=","content_type":"text/plain"}`},
+		{`{"element":null}`, `{"element":null}`},
+		{`{}`, `{"element":null}`},
+	}
+
+	for _, io := range inputOutput {
+		var element Element
+		if err := element.Decode(bytes.NewBufferString(io.input)); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := element.WriteJSON(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != io.output {
+			t.Errorf("JSON is %s, expected %s", buf.String(), io.output)
+		}
+	}
+}
+
+func BenchmarkElementDecodeWriteJSON(b *testing.B) {
+	input := []byte(`{"element":{"id":1,"name":"element","tags":["a","b"]}}`)
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var element Element
+		_ = element.Decode(bytes.NewReader(input))
+		buf.Reset()
+		_ = element.WriteJSON(&buf)
+	}
+}
+
+func TestElementSize_Decoded(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output int
+	}{
+		{`{"element":"foo"}`, 3},
+		{`{"element":{"one":1}}`, len(`{"one":1}`)},
+		{`{"element":"aGVsbG8=","content_type":"text/plain"}`, 0},
+	}
+
+	for _, io := range inputOutput {
+		var element Element
+		if err := element.Decode(bytes.NewBufferString(io.input)); err != nil {
+			t.Fatal(err)
+		}
+		if size := element.Size(); size != io.output {
+			t.Errorf("size of %s is %d, expected %d", io.input, size, io.output)
+		}
+	}
+
+	if size := (Element{Value: "foo"}).Size(); size != 0 {
+		t.Errorf("size is %d, expected 0", size)
+	}
+}
+
+func TestStackPushWithOptions_Size(t *testing.T) {
+	stack := NewStack("stack", time.Now())
+	stack.SetMaxElementSize(4)
+
+	if err := stack.PushWithOptions("foo", PushOptions{Size: 5}); err != ErrElementTooLarge {
+		t.Errorf("err is %v, expected %v", err, ErrElementTooLarge)
+	}
+	always := func(uint64) bool { return true }
+	if err := stack.PushWithOptions("foo", PushOptions{Size: 5, If: always}); err != ErrElementTooLarge {
+		t.Errorf("err is %v, expected %v", err, ErrElementTooLarge)
+	}
+	if err := stack.PushWithOptions("foo", PushOptions{Size: 3}); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+	if err := stack.PushWithOptions("foobar", PushOptions{}); err != ErrElementTooLarge {
+		t.Errorf("err is %v, expected %v", err, ErrElementTooLarge)
+	}
+}
@@ -0,0 +1,140 @@
+package pila
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Stats contains the statistics of the Stacks of a Pila, aggregated.
+type Stats struct {
+	NumberDatabases int `json:"number_of_databases"`
+	NumberStacks    int `json:"number_of_stacks"`
+	// Size is the total number of elements
+	Size int `json:"size"`
+	// PeakSize is the largest peak size of a Stack
+	PeakSize int   `json:"peak_size"`
+	Pushes   int64 `json:"pushes"`
+	Pops     int64 `json:"pops"`
+	// Memory is the approximate memory in bytes used by the elements
+	Memory   int64      `json:"memory"`
+	PushedAt *time.Time `json:"pushed_at,omitempty"`
+	PoppedAt *time.Time `json:"popped_at,omitempty"`
+}
+
+// Stats returns the statistics of all the Stacks of the Pila. As
+// they are collected without locking the Stacks, they are
+// best-effort under concurrent operations.
+func (p *Pila) Stats() Stats {
+	return p.FilteredStats(nil)
+}
+
+// FilteredStats returns the statistics of the Stacks of the Databases
+// for which keep returns true, or of all of them if it is nil.
+func (p *Pila) FilteredStats(keep func(db *Database) bool) Stats {
+	var stats Stats
+	var pushedAt, poppedAt time.Time
+	p.ForEachDatabase(func(db *Database) bool {
+		if keep != nil && !keep(db) {
+			return true
+		}
+		stats.NumberDatabases++
+		stats.Memory += db.Memory()
+		db.ForEachStack(func(s *Stack) bool {
+			stats.NumberStacks++
+			stats.Size += s.SizeApprox()
+			if peak := s.PeakSize(); peak > stats.PeakSize {
+				stats.PeakSize = peak
+			}
+			stats.Pushes += s.Pushes()
+			stats.Pops += s.Pops()
+			if t, ok := s.PushedAt(); ok && t.After(pushedAt) {
+				pushedAt = t
+			}
+			if t, ok := s.PoppedAt(); ok && t.After(poppedAt) {
+				poppedAt = t
+			}
+			return true
+		})
+		return true
+	})
+
+	if !pushedAt.IsZero() {
+		pushedAt = pushedAt.Local()
+		stats.PushedAt = &pushedAt
+	}
+	if !poppedAt.IsZero() {
+		poppedAt = poppedAt.Local()
+		stats.PoppedAt = &poppedAt
+	}
+	return stats
+}
+
+// StackStats contains the statistics of a Stack.
+type StackStats struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	Memory int64  `json:"memory"`
+	Pushes int64  `json:"pushes"`
+	Pops   int64  `json:"pops"`
+	// PushRate and PopRate are the operations per
+	// second over the last RateWindow
+	PushRate float64 `json:"push_rate"`
+	PopRate  float64 `json:"pop_rate"`
+}
+
+// DatabaseStats contains the statistics of the Stacks of a Database,
+// sorted by name, and their totals.
+type DatabaseStats struct {
+	ID           string       `json:"id"`
+	Name         string       `json:"name"`
+	NumberStacks int          `json:"number_of_stacks"`
+	Size         int          `json:"size"`
+	Memory       int64        `json:"memory"`
+	Pushes       int64        `json:"pushes"`
+	Pops         int64        `json:"pops"`
+	PushRate     float64      `json:"push_rate"`
+	PopRate      float64      `json:"pop_rate"`
+	Stacks       []StackStats `json:"stacks"`
+}
+
+// ToJSON converts a DatabaseStats into JSON.
+func (stats DatabaseStats) ToJSON() []byte {
+	// Do not check error as the DatabaseStats type does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(stats)
+	return b
+}
+
+// Stats returns the statistics of the Stacks of the Database. Like
+// the ones of a Pila, they are best-effort under concurrent operations.
+func (db *Database) Stats() DatabaseStats {
+	stats := DatabaseStats{
+		ID:     db.ID.String(),
+		Name:   db.Name,
+		Stacks: []StackStats{},
+	}
+	db.ForEachStack(func(s *Stack) bool {
+		stackStats := StackStats{
+			ID:       s.ID.String(),
+			Name:     s.Name,
+			Size:     s.SizeApprox(),
+			Memory:   s.Memory(),
+			Pushes:   s.Pushes(),
+			Pops:     s.Pops(),
+			PushRate: s.PushRate(),
+			PopRate:  s.PopRate(),
+		}
+		stats.Stacks = append(stats.Stacks, stackStats)
+
+		stats.NumberStacks++
+		stats.Size += stackStats.Size
+		stats.Memory += stackStats.Memory
+		stats.Pushes += stackStats.Pushes
+		stats.Pops += stackStats.Pops
+		stats.PushRate += stackStats.PushRate
+		stats.PopRate += stackStats.PopRate
+		return true
+	})
+	return stats
+}
@@ -0,0 +1,92 @@
+package pila
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPilaStats(t *testing.T) {
+	p := NewPila()
+	if stats := p.Stats(); stats != (Stats{}) {
+		t.Errorf("stats are %v, expected empty", stats)
+	}
+
+	db := NewDatabase("db")
+	_ = p.AddDatabase(db)
+	_ = p.AddDatabase(NewDatabase("empty"))
+	s1 := NewStack("s1", time.Now())
+	s2 := NewStack("s2", time.Now())
+	_ = db.AddStack(s1)
+	_ = db.AddStack(s2)
+
+	_ = s1.PushN([]interface{}{1, 2, 3})
+	s1.Pop()
+	s1.Pop()
+	_ = s2.Push("foo")
+	s2.Pop()
+	lastPushedAt, _ := s2.PushedAt()
+	lastPoppedAt, _ := s2.PoppedAt()
+
+	stats := p.Stats()
+	if stats.NumberDatabases != 2 || stats.NumberStacks != 2 {
+		t.Errorf("stats have %d databases and %d stacks, expected %d and %d",
+			stats.NumberDatabases, stats.NumberStacks, 2, 2)
+	}
+	if stats.Size != 1 || stats.PeakSize != 3 {
+		t.Errorf("stats have size %d and peak size %d, expected %d and %d", stats.Size, stats.PeakSize, 1, 3)
+	}
+	if stats.Pushes != 4 || stats.Pops != 3 {
+		t.Errorf("stats have %d pushes and %d pops, expected %d and %d", stats.Pushes, stats.Pops, 4, 3)
+	}
+	if stats.PushedAt == nil || !stats.PushedAt.Equal(lastPushedAt) {
+		t.Errorf("stats.PushedAt is %v, expected %v", stats.PushedAt, lastPushedAt)
+	}
+	if stats.PoppedAt == nil || !stats.PoppedAt.Equal(lastPoppedAt) {
+		t.Errorf("stats.PoppedAt is %v, expected %v", stats.PoppedAt, lastPoppedAt)
+	}
+}
+
+func TestPilaFilteredStats(t *testing.T) {
+	p := NewPila()
+	db := NewDatabase("db")
+	_ = p.AddDatabase(db)
+	_ = p.AddDatabase(NewDatabase("other"))
+	s := NewStack("s", time.Now())
+	_ = db.AddStack(s)
+	_ = s.Push("foo")
+
+	stats := p.FilteredStats(func(db *Database) bool { return db.Name == "other" })
+	if stats.NumberDatabases != 1 || stats.NumberStacks != 0 || stats.Size != 0 {
+		t.Errorf("stats have %d databases, %d stacks and size %d, expected %d, %d and %d",
+			stats.NumberDatabases, stats.NumberStacks, stats.Size, 1, 0, 0)
+	}
+}
+
+func TestDatabaseStats(t *testing.T) {
+	db := NewDatabase("db")
+	if stats := db.Stats(); stats.NumberStacks != 0 || len(stats.Stacks) != 0 || stats.Name != "db" || stats.ID != db.ID.String() {
+		t.Errorf("stats are %+v, expected empty", stats)
+	}
+
+	s1 := NewStack("s1", time.Now())
+	s2 := NewStack("s2", time.Now())
+	_ = db.AddStack(s2)
+	_ = db.AddStack(s1)
+	_ = s1.PushN([]interface{}{1, 2, 3})
+	s1.Pop()
+	_ = s2.Push("foo")
+
+	stats := db.Stats()
+	if stats.NumberStacks != 2 || len(stats.Stacks) != 2 || stats.Stacks[0].Name != "s1" || stats.Stacks[1].ID != s2.ID.String() {
+		t.Fatalf("stats are %+v", stats)
+	}
+	if stats.Size != 3 || stats.Pushes != 4 || stats.Pops != 1 || stats.Memory != s1.Memory()+s2.Memory() {
+		t.Errorf("stats have size %d, %d pushes, %d pops and memory %d", stats.Size, stats.Pushes, stats.Pops, stats.Memory)
+	}
+	if stats.PushRate != 4/RateWindow.Seconds() || stats.PopRate != stats.Stacks[0].PopRate {
+		t.Errorf("stats have push rate %v and pop rate %v", stats.PushRate, stats.PopRate)
+	}
+	if s := stats.Stacks[0]; s.Size != 2 || s.Pushes != 3 || s.Pops != 1 || s.PopRate != 1/RateWindow.Seconds() {
+		t.Errorf("stack stats are %+v", s)
+	}
+}
@@ -0,0 +1,140 @@
+package pila
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/stack"
+)
+
+const (
+	// StoreMemory is the name of the default Store,
+	// keeping the elements of a Stack in memory.
+	StoreMemory = "memory"
+	// StoreSpill is the name of the Store keeping in memory only the
+	// topmost elements of a Stack of type stack, and spilling the rest
+	// of them into a file, see NewSpillStack.
+	StoreSpill = "spill"
+)
+
+// ErrUnknownStore is returned when creating a Stack
+// with a Store that is not registered.
+var ErrUnknownStore = errors.New("unknown store")
+
+// Store is the storage of the elements of a Stack, which PUSH, POP,
+// PEEK, SIZE and FLUSH operate on. It must be safe for concurrent use.
+// A Store implementing io.Closer is closed once its Stack is deleted.
+type Store interface {
+	stack.Stacker
+}
+
+// StoreOptions are the options a Store is created with.
+type StoreOptions struct {
+	// Structure is the type of the Stack
+	Structure Structure
+	// Dir is the directory where the Store
+	// may keep its files, empty if none
+	Dir string
+	// Spill is the minimum number of elements kept in memory
+	// by a Store keeping the rest of them elsewhere
+	Spill int
+	// Codec encodes the elements of the Stack,
+	// for a Store keeping them out of memory
+	Codec stack.Codec
+}
+
+// StoreFunc creates a new empty Store given its options.
+type StoreFunc func(opts StoreOptions) (Store, error)
+
+// stores are the registered StoreFuncs, by name.
+var stores = struct {
+	m  map[string]StoreFunc
+	mu sync.RWMutex
+}{m: make(map[string]StoreFunc)}
+
+func init() {
+	RegisterStore(StoreMemory, newMemoryStore)
+	RegisterStore(StoreSpill, newSpillStore)
+}
+
+// RegisterStore makes a Store available by name, replacing
+// the Store registered before with the same name.
+func RegisterStore(name string, fn StoreFunc) {
+	stores.mu.Lock()
+	defer stores.mu.Unlock()
+
+	stores.m[name] = fn
+}
+
+// LookupStore returns the StoreFunc registered with a name,
+// and whether there is any.
+func LookupStore(name string) (StoreFunc, bool) {
+	stores.mu.RLock()
+	defer stores.mu.RUnlock()
+
+	fn, ok := stores.m[name]
+	return fn, ok
+}
+
+// StoreNames returns the names of the registered Stores, sorted.
+func StoreNames() []string {
+	stores.mu.RLock()
+	defer stores.mu.RUnlock()
+
+	names := make([]string, 0, len(stores.m))
+	for name := range stores.m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewStackWithStore creates a new Stack of type structure given a name
+// and a creation date, keeping its elements in the Store registered
+// as store. ErrUnknownStore is returned if there is no such Store.
+func NewStackWithStore(structure Structure, name string, t time.Time, store string, opts StoreOptions) (*Stack, error) {
+	fn, ok := LookupStore(store)
+	if !ok {
+		return nil, ErrUnknownStore
+	}
+
+	s := NewStructureWithLimit(structure, name, t, 0, "")
+	opts.Structure = s.Type
+	opts.Codec = elementCodec{}
+	base, err := fn(opts)
+	if err != nil {
+		return nil, err
+	}
+	s.base = base
+	s.store = store
+	return s, nil
+}
+
+// Store returns the name of the Store keeping
+// the elements of the Stack.
+func (s *Stack) Store() string {
+	return s.store
+}
+
+// newMemoryStore creates the Store of
+// the StoreMemory, by Structure.
+func newMemoryStore(opts StoreOptions) (Store, error) {
+	switch opts.Structure {
+	case StructureQueue:
+		return stack.NewQueue(), nil
+	case StructurePriority:
+		return stack.NewHeap(), nil
+	}
+	return stack.NewStack(), nil
+}
+
+// newSpillStore creates the Store of the StoreSpill,
+// which requires a directory and the StructureStack type.
+func newSpillStore(opts StoreOptions) (Store, error) {
+	if opts.Dir == "" || opts.Structure != StructureStack {
+		return nil, errors.New("spill store requires a directory and type stack")
+	}
+	return stack.NewSpillStack(opts.Dir, opts.Spill, opts.Codec)
+}
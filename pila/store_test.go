@@ -0,0 +1,164 @@
+package pila
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/stack"
+)
+
+// testStore is a Store keeping the elements of a Stack of
+// type stack in memory, which records its creation and closing.
+type testStore struct {
+	*stack.Stack
+	opts   StoreOptions
+	closed bool
+}
+
+// Close marks the testStore as closed.
+func (s *testStore) Close() error {
+	s.closed = true
+	return nil
+}
+
+// registerTestStore registers a testStore as "test", and
+// returns the ones created, which fail without Dir.
+func registerTestStore() *[]*testStore {
+	var created []*testStore
+	RegisterStore("test", func(opts StoreOptions) (Store, error) {
+		if opts.Dir == "" {
+			return nil, errors.New("no dir")
+		}
+		s := &testStore{Stack: stack.NewStack(), opts: opts}
+		created = append(created, s)
+		return s, nil
+	})
+	return &created
+}
+
+func TestRegisterStore(t *testing.T) {
+	created := registerTestStore()
+
+	if names := StoreNames(); !reflect.DeepEqual(names, []string{StoreMemory, StoreSpill, "test"}) {
+		t.Errorf("store names are %v, expected %v", names, []string{StoreMemory, StoreSpill, "test"})
+	}
+	if _, ok := LookupStore("test"); !ok {
+		t.Error("test store is not registered")
+	}
+	if _, ok := LookupStore("bolt"); ok {
+		t.Error("bolt store is registered")
+	}
+
+	now := time.Now()
+	s, err := NewStackWithStore(StructureStack, "test-stack", now, "test", StoreOptions{Dir: "dir", Spill: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Store() != "test" || s.Status().Store != "test" {
+		t.Errorf("stack store is %s, expected %s", s.Store(), "test")
+	}
+	if len(*created) != 1 {
+		t.Fatalf("created stores are %d, expected %d", len(*created), 1)
+	}
+	store := (*created)[0]
+	if expected := (StoreOptions{Structure: StructureStack, Dir: "dir", Spill: 3, Codec: elementCodec{}}); store.opts != expected {
+		t.Errorf("store options are %v, expected %v", store.opts, expected)
+	}
+
+	s.Push("foo")
+	s.Push("bar")
+	if store.Size() != 2 || s.Peek() != "bar" {
+		t.Errorf("store size and stack peek are %d and %v, expected %d and %v", store.Size(), s.Peek(), 2, "bar")
+	}
+
+	db := NewDatabase("db")
+	_ = db.AddStack(s)
+	db.RemoveStack(s.ID)
+	if !store.closed {
+		t.Error("store is not closed")
+	}
+}
+
+func TestNewStackWithStore(t *testing.T) {
+	registerTestStore()
+	now := time.Now()
+
+	s, err := NewStackWithStore(StructureQueue, "test-queue", now, StoreMemory, StoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Push("foo")
+	s.Push("bar")
+	if s.Type != StructureQueue || s.Store() != StoreMemory || s.Peek() != "foo" {
+		t.Errorf("stack type, store and peek are %s, %s and %v, expected %s, %s and %v", s.Type, s.Store(), s.Peek(), StructureQueue, StoreMemory, "foo")
+	}
+	if s.Status().Store != "" {
+		t.Errorf("stack status store is %s, expected empty", s.Status().Store)
+	}
+	if NewPriority("test-priority", now).Store() != StoreMemory {
+		t.Error("priority queue store is not memory")
+	}
+
+	if _, err := NewStackWithStore(StructureStack, "test-stack", now, "bolt", StoreOptions{}); err != ErrUnknownStore {
+		t.Errorf("err is %v, expected %v", err, ErrUnknownStore)
+	}
+	if _, err := NewStackWithStore(StructureStack, "test-stack", now, "test", StoreOptions{}); err == nil {
+		t.Error("err is nil, expected an error")
+	}
+	if _, err := NewStackWithStore(StructureQueue, "test-queue", now, StoreSpill, StoreOptions{Dir: "dir"}); err == nil {
+		t.Error("err is nil, expected an error")
+	}
+}
+
+func TestStackStore_Unsupported(t *testing.T) {
+	registerTestStore()
+
+	s, _ := NewStackWithStore(StructureStack, "test-stack", time.Now(), "test", StoreOptions{Dir: "dir"})
+	s.SetCompress(1)
+	s.Push("foo")
+	if _, ok := stored(s.base.Peek()).(compressedElement); ok {
+		t.Error("element is stored compressed")
+	}
+	if err := s.SetEncryption(testKeyring(t, "a")); err != ErrUnsupported {
+		t.Errorf("err is %v, expected %v", err, ErrUnsupported)
+	}
+}
+
+func TestPilaSnapshotRestore_Store(t *testing.T) {
+	created := registerTestStore()
+
+	pila := NewPila()
+	pila.SetSpillDir("dir")
+	db := NewDatabase("db")
+	_ = pila.AddDatabase(db)
+	s, _ := NewStackWithStore(StructureStack, "s", time.Now().UTC(), "test", StoreOptions{Dir: "dir"})
+	_ = db.AddStack(s)
+	s.Push("foo")
+	s.Push("bar")
+
+	var buf bytes.Buffer
+	if err := pila.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+
+	loaded := NewPila()
+	loaded.SetSpillDir("dir")
+	if err := loaded.Restore(bytes.NewReader(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Status(), pila.Status()) {
+		t.Errorf("status is %v, expected %v", loaded.Status(), pila.Status())
+	}
+	restored, _ := loaded.Databases[db.ID].Stack(s.ID)
+	if restored.Store() != "test" || len(*created) != 2 || (*created)[1].Size() != 2 {
+		t.Errorf("stack store is %s, expected %s with %d elements", restored.Store(), "test", 2)
+	}
+
+	if err := NewPila().Restore(bytes.NewReader(snapshot)); err == nil {
+		t.Error("err is nil, expected an error")
+	}
+}
@@ -0,0 +1,152 @@
+package pila
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TxOp is the kind of an operation of a Transaction.
+type TxOp string
+
+const (
+	// TxPush pushes an element on top of a Stack.
+	TxPush TxOp = "push"
+	// TxPop removes the element on top of a Stack.
+	TxPop TxOp = "pop"
+	// TxFlush flushes the content of a Stack.
+	TxFlush TxOp = "flush"
+)
+
+// TxOperation represents an operation on a Stack
+// executed as part of a Transaction.
+type TxOperation struct {
+	Op      TxOp
+	Stack   *Stack
+	Element interface{}
+}
+
+// undo reverts an operation already applied to a Stack.
+type undo func()
+
+// Transaction applies a list of operations on Stacks of the Database
+// in order, so either all of them succeed or none is applied: if an
+// operation fails, the already applied ones are rolled back and an
+// error is returned. Updated Stacks are updated with the date t.
+// It returns the element of every operation, i.e. the pushed one
+// for PUSH, the popped one for POP, and nil for FLUSH.
+//
+// Transactions of a Database are executed one at a time, and they are
+// isolated from the PUSH, POP, FLUSH, ROTATE, BASE and SWEEP operations
+// on the updated Stacks, which wait for the Transaction to finish.
+// Elements evicted from Stacks with the OverflowDropOldest policy, or
+// moved to the top of Stacks with the UniqueMoveToTop policy, are not
+// restored on rollback.
+func (db *Database) Transaction(ops []TxOperation, t time.Time) ([]interface{}, error) {
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+
+	stacks, err := db.txStacks(ops)
+	if err != nil {
+		return nil, err
+	}
+	// Stacks are locked in the same order by
+	// every Transaction, so they do not deadlock
+	sort.Sort(stacksByID(stacks))
+	for _, s := range stacks {
+		s.txMu.Lock()
+		defer s.txMu.Unlock()
+	}
+
+	elements := make([]interface{}, 0, len(ops))
+	undos := make([]undo, 0, len(ops))
+
+	for i, op := range ops {
+		element, u, err := db.apply(op)
+		if err != nil {
+			for j := len(undos) - 1; j >= 0; j-- {
+				undos[j]()
+			}
+			return nil, fmt.Errorf("operation %d: %v", i, err)
+		}
+		elements = append(elements, element)
+		undos = append(undos, u)
+	}
+
+	for _, op := range ops {
+		op.Stack.Update(t)
+	}
+	return elements, nil
+}
+
+// txStacks returns the Stacks updated by the operations of a
+// Transaction, once each, or an error if any of them is missing
+// or is not part of the Database. They are checked before being
+// locked, as the Database is locked before its Stacks otherwise.
+func (db *Database) txStacks(ops []TxOperation) ([]*Stack, error) {
+	var stacks []*Stack
+	seen := make(map[*Stack]bool, len(ops))
+	for i, op := range ops {
+		stack := op.Stack
+		if stack == nil {
+			return nil, fmt.Errorf("operation %d: missing stack", i)
+		}
+		if s, ok := db.Stack(stack.ID); !ok || s != stack {
+			return nil, fmt.Errorf("operation %d: stack %v is not part of database %v", i, stack.Name, db.Name)
+		}
+		if !seen[stack] {
+			seen[stack] = true
+			stacks = append(stacks, stack)
+		}
+	}
+	return stacks, nil
+}
+
+// apply executes a single operation of a Transaction, returning
+// its element and the way to revert it. The txMu of its Stack
+// is held by the Transaction.
+func (db *Database) apply(op TxOperation) (interface{}, undo, error) {
+	stack := op.Stack
+	switch op.Op {
+	case TxPush:
+		element, err := stack.beforePush(op.Element)
+		if err == nil {
+			err = stack.pushWithSizeLocked(element, 0)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("stack %v: %v", stack.Name, err)
+		}
+		return op.Element, stack.undoPush, nil
+
+	case TxPop:
+		popped, element, ok := stack.popLocked()
+		if !ok {
+			return nil, nil, fmt.Errorf("stack %v is empty", stack.Name)
+		}
+		return element, func() { stack.undoPop(popped) }, nil
+
+	case TxFlush:
+		elements := make([]interface{}, 0, stack.Size())
+		stack.base.Range(func(element interface{}) bool {
+			elements = append(elements, element)
+			return true
+		})
+		stack.flushLocked()
+		return nil, func() {
+			// elements were collected from the last pushed
+			for i := len(elements) - 1; i >= 0; i-- {
+				stack.pushWithSizeLocked(elements[i], 0)
+			}
+		}, nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown operation %s", op.Op)
+}
+
+// stacksByID implements sort.Interface to sort
+// a list of Stacks by ID.
+type stacksByID []*Stack
+
+func (stacks stacksByID) Len() int           { return len(stacks) }
+func (stacks stacksByID) Less(i, j int) bool { return stacks[i].ID.String() < stacks[j].ID.String() }
+func (stacks stacksByID) Swap(i, j int)      { stacks[i], stacks[j] = stacks[j], stacks[i] }
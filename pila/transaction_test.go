@@ -0,0 +1,244 @@
+package pila
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDatabaseTransaction(t *testing.T) {
+	now := time.Now().UTC()
+	db := NewDatabase("db")
+	s0 := NewStack("s0", now)
+	s1 := NewStack("s1", now)
+	_ = db.AddStack(s0)
+	_ = db.AddStack(s1)
+	s0.Push("foo")
+	s1.Push("bar")
+
+	after := now.Add(time.Minute)
+	elements, err := db.Transaction([]TxOperation{
+		{Op: TxPush, Stack: s0, Element: 1},
+		{Op: TxPop, Stack: s0},
+		{Op: TxPop, Stack: s0},
+		{Op: TxFlush, Stack: s1},
+		{Op: TxPush, Stack: s1, Element: "baz"},
+	}, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []interface{}{1, 1, "foo", nil, "baz"}; !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+	if s0.Size() != 0 {
+		t.Errorf("stack size is %d, expected %d", s0.Size(), 0)
+	}
+	if s1.Size() != 1 || s1.Peek() != "baz" {
+		t.Errorf("stack %s is not updated", s1.Name)
+	}
+	if !s0.UpdatedAt.Equal(after) || !s1.UpdatedAt.Equal(after) {
+		t.Errorf("stacks are not updated at %v", after)
+	}
+}
+
+func TestDatabaseTransaction_Rollback(t *testing.T) {
+	now := time.Now().UTC()
+	db := NewDatabase("db")
+	s0 := NewStack("s0", now)
+	s1 := NewStack("s1", now)
+	_ = db.AddStack(s0)
+	_ = db.AddStack(s1)
+	s0.Push("foo")
+	s1.Push("bar")
+	s1.Push("baz")
+
+	other := NewStack("other", now)
+	_ = NewDatabase("other").AddStack(other)
+
+	inputs := [][]TxOperation{
+		{
+			{Op: TxPush, Stack: s0, Element: 1},
+			{Op: TxFlush, Stack: s1},
+			{Op: TxPop, Stack: s1},
+		},
+		{
+			{Op: TxPop, Stack: s0},
+			{Op: TxPush, Stack: s1, Element: 2},
+			{Op: "foo", Stack: s0},
+		},
+		{
+			{Op: TxPop, Stack: s1},
+			{Op: TxPush, Stack: other, Element: 3},
+		},
+		{
+			{Op: TxFlush, Stack: s0},
+			{Op: TxPush},
+		},
+	}
+
+	full := NewStackWithLimit("full", now, 1, OverflowReject)
+	_ = db.AddStack(full)
+	full.Push("foo")
+	inputs = append(inputs, []TxOperation{
+		{Op: TxPop, Stack: s0},
+		{Op: TxPush, Stack: full, Element: 4},
+	})
+
+	for _, ops := range inputs {
+		if _, err := db.Transaction(ops, now.Add(time.Minute)); err == nil {
+			t.Errorf("err is nil for %v", ops)
+		}
+
+		if s0.Size() != 1 || s0.Peek() != "foo" {
+			t.Errorf("stack %s is modified after rollback", s0.Name)
+		}
+		if s1.Size() != 2 || s1.Peek() != "baz" {
+			t.Errorf("stack %s is modified after rollback", s1.Name)
+		}
+		if e, _ := s1.Pop(); e != "baz" {
+			t.Errorf("element is %v, expected %v", e, "baz")
+		}
+		if e := s1.Peek(); e != "bar" {
+			t.Errorf("element is %v, expected %v", e, "bar")
+		}
+		s1.Push("baz")
+
+		if other.Size() != 0 {
+			t.Errorf("stack %s is modified", other.Name)
+		}
+		if !s0.UpdatedAt.IsZero() || !s1.UpdatedAt.IsZero() {
+			t.Error("stacks are updated after rollback")
+		}
+	}
+}
+
+func TestDatabaseTransaction_RollbackQueue(t *testing.T) {
+	now := time.Now().UTC()
+	db := NewDatabase("db")
+	q := NewQueue("q", now)
+	_ = db.AddStack(q)
+	_ = q.PushN([]interface{}{"foo", "bar", "baz"})
+
+	ops := []TxOperation{
+		{Op: TxPop, Stack: q},
+		{Op: TxPush, Stack: q, Element: "qux"},
+		{Op: TxFlush, Stack: q},
+		{Op: TxPop, Stack: q},
+	}
+	if _, err := db.Transaction(ops, now); err == nil {
+		t.Fatal("err is nil")
+	}
+
+	if elements := q.PopN(4); !reflect.DeepEqual(elements, []interface{}{"foo", "bar", "baz"}) {
+		t.Errorf("elements are %v, expected %v", elements, []interface{}{"foo", "bar", "baz"})
+	}
+	if q.SizeApprox() != 0 {
+		t.Errorf("q.SizeApprox() is %d, expected %d", q.SizeApprox(), 0)
+	}
+}
+
+func TestDatabaseTransaction_RollbackPriority(t *testing.T) {
+	now := time.Now().UTC()
+	db := NewDatabase("db")
+	p := NewPriority("p", now)
+	_ = db.AddStack(p)
+	_ = p.PushWithPriority("foo", 1, time.Time{})
+	_ = p.PushWithPriority("bar", 5, time.Time{})
+
+	ops := []TxOperation{
+		{Op: TxPop, Stack: p},
+		{Op: TxPush, Stack: p, Element: "baz"},
+		{Op: "foo", Stack: p},
+	}
+	if _, err := db.Transaction(ops, now); err == nil {
+		t.Fatal("err is nil")
+	}
+
+	if elements := p.PopN(3); !reflect.DeepEqual(elements, []interface{}{"bar", "foo"}) {
+		t.Errorf("elements are %v, expected %v", elements, []interface{}{"bar", "foo"})
+	}
+}
+
+func TestDatabaseTransaction_Isolation(t *testing.T) {
+	now := time.Now().UTC()
+	db := NewDatabase("db")
+	s0 := NewStack("s0", now)
+	s1 := NewStack("s1", now)
+	_ = db.AddStack(s0)
+	_ = db.AddStack(s1)
+
+	// push into s0 concurrently while the Transaction is
+	// applied, which must wait until it is rolled back
+	applied := make(chan struct{})
+	unsubscribe := s0.Subscribe(func(e Event) {
+		if e.Op == EventPush && e.Element == "tx" {
+			close(applied)
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	defer unsubscribe()
+	pushed := make(chan error)
+	go func() {
+		<-applied
+		pushed <- s0.Push("concurrent")
+	}()
+
+	_, err := db.Transaction([]TxOperation{
+		{Op: TxPush, Stack: s0, Element: "tx"},
+		{Op: TxPop, Stack: s1},
+	}, now)
+	if err == nil {
+		t.Fatal("err is nil, expected error")
+	}
+	if err := <-pushed; err != nil {
+		t.Fatal(err)
+	}
+
+	if elements, expected := s0.Elements(0, 10), []interface{}{"concurrent"}; !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+}
+
+func TestDatabaseTransaction_IsolationRotate(t *testing.T) {
+	now := time.Now().UTC()
+	db := NewDatabase("db")
+	s0 := NewStack("s0", now)
+	s1 := NewStack("s1", now)
+	_ = db.AddStack(s0)
+	_ = db.AddStack(s1)
+	s0.Push("a")
+
+	// rotate s0 concurrently while the Transaction is applied, which
+	// must wait until it is rolled back, or the pushed element would
+	// be moved to the bottom and not removed on rollback
+	applied := make(chan struct{})
+	unsubscribe := s0.Subscribe(func(e Event) {
+		if e.Op == EventPush && e.Element == "tx" {
+			close(applied)
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	defer unsubscribe()
+	rotated := make(chan error)
+	go func() {
+		<-applied
+		_, _, err := s0.Rotate()
+		rotated <- err
+	}()
+
+	_, err := db.Transaction([]TxOperation{
+		{Op: TxPush, Stack: s0, Element: "tx"},
+		{Op: TxPop, Stack: s1},
+	}, now)
+	if err == nil {
+		t.Fatal("err is nil, expected error")
+	}
+	if err := <-rotated; err != nil {
+		t.Fatal(err)
+	}
+
+	if elements, expected := s0.Elements(0, 10), []interface{}{"a"}; !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+}
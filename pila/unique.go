@@ -0,0 +1,176 @@
+package pila
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDuplicate is returned when pushing an element into a unique
+// Stack with the UniqueReject policy that already contains it.
+var ErrDuplicate = errors.New("element already in the stack")
+
+// UniquePolicy determines what happens when pushing an element into
+// a unique Stack, i.e. one without duplicated elements, that already
+// contains it.
+type UniquePolicy string
+
+const (
+	// UniqueReject rejects the pushed element.
+	UniqueReject UniquePolicy = "reject"
+	// UniqueMoveToTop removes the element already in the Stack,
+	// so the pushed one takes its place on top.
+	UniqueMoveToTop UniquePolicy = "move_to_top"
+)
+
+// SetUnique makes the Stack unique with the given policy, indexing
+// its elements so they are found on every PUSH operation, or allows
+// duplicated elements again if policy is empty. Elements that are
+// already duplicated in the Stack are kept.
+func (s *Stack) SetUnique(policy UniquePolicy) {
+	s.pushMu.Lock()
+	defer s.pushMu.Unlock()
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	s.unique = policy
+	s.index = nil
+	if policy == "" {
+		return
+	}
+
+	s.index = make(map[string]int)
+	s.base.Range(func(element interface{}) bool {
+		s.index[elementKey(element)]++
+		return true
+	})
+}
+
+// Unique returns the UniquePolicy of the Stack,
+// empty if it allows duplicated elements.
+func (s *Stack) Unique() UniquePolicy {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	return s.unique
+}
+
+// dedup returns the elements to push into a unique Stack, and the keys
+// of the ones it already contains, which must be removed before pushing
+// them with the UniqueMoveToTop policy. Only the last of the elements
+// that are equal is kept. With the UniqueReject policy, ErrDuplicate is
+// returned if any element is already in the Stack or given twice.
+func (s *Stack) dedup(elements []interface{}) ([]interface{}, map[string]bool, error) {
+	// expired elements are not duplicated
+	s.Expire(time.Now())
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	keys := make([]string, len(elements))
+	last := make(map[string]int, len(elements))
+	for i, element := range elements {
+		keys[i] = elementKey(element)
+		if _, ok := last[keys[i]]; ok && s.unique == UniqueReject {
+			return nil, nil, ErrDuplicate
+		}
+		last[keys[i]] = i
+	}
+
+	kept := make([]interface{}, 0, len(last))
+	present := make(map[string]bool)
+	for i, element := range elements {
+		if last[keys[i]] != i {
+			continue
+		}
+		if s.index[keys[i]] > 0 {
+			if s.unique == UniqueReject {
+				return nil, nil, ErrDuplicate
+			}
+			present[keys[i]] = true
+		}
+		kept = append(kept, element)
+	}
+	return kept, present, nil
+}
+
+// removeKeys removes the elements of the Stack whose key is in keys.
+func (s *Stack) removeKeys(keys map[string]bool) {
+	if len(keys) == 0 {
+		return
+	}
+
+	var freed int64
+	removed := s.base.Filter(func(element interface{}) bool {
+		if !keys[elementKey(element)] {
+			return true
+		}
+		freed += elementMemory(element)
+		s.indexRemove(element)
+		return false
+	})
+	atomic.AddInt64(&s.sizeApprox, -int64(removed))
+	s.account(-freed)
+}
+
+// indexAdd adds an element, as stored, to
+// the index of a unique Stack.
+func (s *Stack) indexAdd(element interface{}) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	if s.index != nil {
+		s.index[elementKey(element)]++
+	}
+}
+
+// indexRemove removes an element, as stored, from
+// the index of a unique Stack.
+func (s *Stack) indexRemove(element interface{}) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	if s.index == nil {
+		return
+	}
+	key := elementKey(element)
+	if s.index[key] > 1 {
+		s.index[key]--
+		return
+	}
+	delete(s.index, key)
+}
+
+// indexHas returns whether a unique Stack
+// contains an element, as stored.
+func (s *Stack) indexHas(element interface{}) bool {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	return s.index[elementKey(element)] > 0
+}
+
+// indexReset empties the index of a unique Stack.
+func (s *Stack) indexReset() {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	if s.index != nil {
+		s.index = make(map[string]int)
+	}
+}
+
+// elementKey returns the key of an element, as stored, in the index
+// of a unique Stack, so equal values have the same key regardless of
+// their priority and expiration date.
+func elementKey(element interface{}) string {
+	value, _ := unwrap(element, time.Time{})
+	if b, ok := value.([]byte); ok {
+		return "b" + string(b)
+	}
+	// Do not check error as elements are
+	// values that can be encoded to JSON.
+	data, _ := json.Marshal(value)
+	return "j" + string(data)
+}
@@ -0,0 +1,216 @@
+package pila
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStackSetUnique(t *testing.T) {
+	stack := NewStack("stack", time.Now().UTC())
+	stack.Push("foo")
+	stack.Push("foo")
+
+	if stack.Unique() != "" {
+		t.Errorf("stack unique is %s, expected none", stack.Unique())
+	}
+
+	stack.SetUnique(UniqueReject)
+	if stack.Unique() != UniqueReject {
+		t.Errorf("stack unique is %s, expected %s", stack.Unique(), UniqueReject)
+	}
+	if err := stack.Push("foo"); err != ErrDuplicate {
+		t.Errorf("err is %v, expected %v", err, ErrDuplicate)
+	}
+	if stack.Size() != 2 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 2)
+	}
+
+	stack.Pop()
+	if err := stack.Push("foo"); err != ErrDuplicate {
+		t.Errorf("err is %v, expected %v", err, ErrDuplicate)
+	}
+	stack.Pop()
+	if err := stack.Push("foo"); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+
+	stack.SetUnique("")
+	if err := stack.Push("foo"); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+	if stack.Size() != 2 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 2)
+	}
+}
+
+func TestStackPush_UniqueReject(t *testing.T) {
+	stack := NewStack("stack", time.Now().UTC())
+	stack.SetUnique(UniqueReject)
+
+	inputOutput := []struct {
+		input  interface{}
+		output error
+	}{
+		{"foo", nil},
+		{"foo", ErrDuplicate},
+		{8, nil},
+		{8.0, ErrDuplicate},
+		{"8", nil},
+		{[]byte("foo"), nil},
+		{[]byte("foo"), ErrDuplicate},
+		{map[string]interface{}{"a": 1, "b": 2}, nil},
+		{map[string]interface{}{"b": 2, "a": 1}, ErrDuplicate},
+		{[]interface{}{"foo"}, nil},
+	}
+
+	for _, io := range inputOutput {
+		if err := stack.Push(io.input); err != io.output {
+			t.Errorf("err is %v, expected %v for %v", err, io.output, io.input)
+		}
+	}
+	if stack.Size() != 6 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 6)
+	}
+
+	if err := stack.PushN([]interface{}{"bar", "baz", "bar"}); err != ErrDuplicate {
+		t.Errorf("err is %v, expected %v", err, ErrDuplicate)
+	}
+	if err := stack.PushN([]interface{}{"bar", "foo"}); err != ErrDuplicate {
+		t.Errorf("err is %v, expected %v", err, ErrDuplicate)
+	}
+	if stack.Size() != 6 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 6)
+	}
+	if err := stack.PushWithPriority("foo", 1, time.Time{}); err != ErrDuplicate {
+		t.Errorf("err is %v, expected %v", err, ErrDuplicate)
+	}
+}
+
+func TestStackPush_UniqueMoveToTop(t *testing.T) {
+	stack := NewStack("stack", time.Now().UTC())
+	stack.SetUnique(UniqueMoveToTop)
+
+	for _, element := range []string{"a", "b", "c", "a"} {
+		if err := stack.Push(element); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stack.PushN([]interface{}{"d", "b", "d"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []interface{}{"d", "b", "a", "c"}
+	if elements := stack.Elements(0, 10); !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+	if stack.Size() != 4 || stack.SizeApprox() != 4 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 4)
+	}
+	if memory := stack.Memory(); memory != 4*elementMemory("a") {
+		t.Errorf("stack memory is %d, expected %d", memory, 4*elementMemory("a"))
+	}
+}
+
+func TestStackPush_UniqueLimit(t *testing.T) {
+	stack := NewStackWithLimit("stack", time.Now().UTC(), 2, OverflowReject)
+	stack.SetUnique(UniqueMoveToTop)
+	stack.Push("a")
+	stack.Push("b")
+
+	if err := stack.Push("a"); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+	if err := stack.Push("c"); err != ErrStackFull {
+		t.Errorf("err is %v, expected %v", err, ErrStackFull)
+	}
+	if stack.Peek() != "a" || stack.Size() != 2 {
+		t.Errorf("stack peek and size are %v and %d, expected %v and %d", stack.Peek(), stack.Size(), "a", 2)
+	}
+}
+
+func TestStackPush_UniqueExpired(t *testing.T) {
+	stack := NewStack("stack", time.Now().UTC())
+	stack.SetUnique(UniqueReject)
+	stack.PushWithExpiration("foo", time.Now().Add(-time.Second))
+
+	if err := stack.Push("foo"); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+	if stack.Size() != 1 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 1)
+	}
+}
+
+func TestStackFlush_Unique(t *testing.T) {
+	stack := NewQueue("queue", time.Now().UTC())
+	stack.SetUnique(UniqueReject)
+	stack.Push("foo")
+	stack.Push("bar")
+
+	if element, _, _ := stack.Sweep(); element != "bar" {
+		t.Errorf("swept element is %v, expected %v", element, "bar")
+	}
+	if err := stack.Push("bar"); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+
+	stack.Flush()
+	if err := stack.Push("foo"); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+}
+
+func TestTransaction_Unique(t *testing.T) {
+	db := NewDatabase("db")
+	stack := NewStack("stack", time.Now().UTC())
+	stack.SetUnique(UniqueReject)
+	_ = db.AddStack(stack)
+	stack.Push("foo")
+
+	_, err := db.Transaction([]TxOperation{
+		{Op: TxPop, Stack: stack},
+		{Op: TxPush, Stack: stack, Element: "bar"},
+		{Op: TxPush, Stack: stack, Element: "bar"},
+	}, time.Now().UTC())
+	if err == nil {
+		t.Error("err is nil, expected duplicated element")
+	}
+
+	if err := stack.Push("foo"); err != ErrDuplicate {
+		t.Errorf("err is %v, expected %v", err, ErrDuplicate)
+	}
+	if err := stack.Push("bar"); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+}
+
+func TestPilaSnapshotRestore_Unique(t *testing.T) {
+	pila := NewPila()
+	db := NewDatabase("db")
+	_ = pila.AddDatabase(db)
+	stack := NewStack("stack", time.Now().UTC())
+	stack.SetUnique(UniqueMoveToTop)
+	_ = db.AddStack(stack)
+	stack.Push("foo")
+	stack.Push("bar")
+
+	var buf bytes.Buffer
+	if err := pila.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewPila()
+	if err := loaded.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, _ := loaded.Databases[db.ID].Stack(stack.ID)
+	if restored.Status().Unique != UniqueMoveToTop {
+		t.Errorf("stack unique is %s, expected %s", restored.Status().Unique, UniqueMoveToTop)
+	}
+	restored.Push("foo")
+	if restored.Size() != 2 || restored.Peek() != "foo" {
+		t.Errorf("stack size and peek are %d and %v, expected %d and %v", restored.Size(), restored.Peek(), 2, "foo")
+	}
+}
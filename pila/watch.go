@@ -0,0 +1,46 @@
+package pila
+
+// Changed returns a channel that receives a value after the Pila
+// changes, i.e. a Database or a Stack is created, removed or renamed,
+// or a Stack is modified, and a function to stop it. Changes that
+// happen while a value is pending are coalesced, so the receiver must
+// not assume a single change happened.
+func (p *Pila) Changed() (changed <-chan struct{}, stop func()) {
+	ch := make(chan struct{}, 1)
+
+	p.watchersMu.Lock()
+	defer p.watchersMu.Unlock()
+	if p.watchers == nil {
+		p.watchers = make(map[int]chan struct{})
+	}
+	id := p.nextWatcher
+	p.nextWatcher++
+	p.watchers[id] = ch
+
+	return ch, func() {
+		p.watchersMu.Lock()
+		defer p.watchersMu.Unlock()
+		delete(p.watchers, id)
+	}
+}
+
+// changed notifies the watchers of the Pila that it changed.
+func (p *Pila) changed() {
+	p.watchersMu.RLock()
+	defer p.watchersMu.RUnlock()
+
+	for _, ch := range p.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// changed notifies the watchers of the Pila of the
+// Database, if any, that the Database changed.
+func (db *Database) changed() {
+	if p := db.Pila; p != nil {
+		p.changed()
+	}
+}
@@ -0,0 +1,64 @@
+package pila
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPilaChanged(t *testing.T) {
+	p := NewPila()
+	changed, stop := p.Changed()
+
+	expectChange := func(op string) {
+		select {
+		case <-changed:
+		case <-time.After(time.Second):
+			t.Errorf("no change after %s", op)
+		}
+	}
+
+	dbID := p.CreateDatabase("db")
+	expectChange("creating database")
+
+	db, _ := p.Database(dbID)
+	stackID := db.CreateStack("stack", time.Now())
+	expectChange("creating stack")
+
+	stack := db.Stacks[stackID]
+	_ = stack.Push("foo")
+	expectChange("pushing")
+
+	// changes are coalesced
+	_ = stack.Push("bar")
+	stack.Pop()
+	expectChange("pushing and popping")
+	select {
+	case <-changed:
+		t.Error("change was not coalesced")
+	default:
+	}
+
+	if err := db.RenameStack(stackID, "stack2"); err != nil {
+		t.Fatal(err)
+	}
+	expectChange("renaming stack")
+
+	db.RemoveStack(stackID)
+	expectChange("removing stack")
+
+	if err := p.RenameDatabase(dbID, "db2"); err != nil {
+		t.Fatal(err)
+	}
+	expectChange("renaming database")
+
+	p.RemoveDatabase(dbID)
+	expectChange("removing database")
+
+	stop()
+	p.CreateDatabase("db3")
+	select {
+	case <-changed:
+		t.Error("change after stop")
+	default:
+	}
+}
@@ -0,0 +1,134 @@
+package pila
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// NoWatermark disables a watermark of Watermarks.
+const NoWatermark = -1
+
+// ErrInvalidWatermarks is returned when setting Watermarks
+// whose high watermark is not above their low watermark.
+var ErrInvalidWatermarks = errors.New("invalid watermarks")
+
+// Watermarks are sizes of a Stack that trigger an Event when its
+// size crosses them, so it can be alerted of growing or draining.
+type Watermarks struct {
+	// High triggers EventHighWatermark when the size of the Stack
+	// rises to it or above, NoWatermark if disabled
+	High int `json:"high"`
+	// Low triggers EventLowWatermark when the size of the Stack
+	// falls to it or below, NoWatermark if disabled
+	Low int `json:"low"`
+}
+
+// Validate returns ErrInvalidWatermarks if High is not positive,
+// Low is negative, or High is not above Low, unless disabled.
+func (w Watermarks) Validate() error {
+	if w.High != NoWatermark && w.High < 1 {
+		return ErrInvalidWatermarks
+	}
+	if w.Low != NoWatermark && w.Low < 0 {
+		return ErrInvalidWatermarks
+	}
+	if w.High != NoWatermark && w.Low != NoWatermark && w.High <= w.Low {
+		return ErrInvalidWatermarks
+	}
+	return nil
+}
+
+// SetWatermarks sets the Watermarks of the Stack, evaluated from its
+// current size on, or removes them if both are NoWatermark, which is
+// the default. Once the size of the Stack rises to the high watermark,
+// EventHighWatermark is triggered, and it is not triggered again until
+// the size falls below it. Likewise, EventLowWatermark is triggered once
+// the size falls to the low watermark. Both carry the size of the Stack
+// as their element. Sizes are evaluated after every operation triggering
+// an Event, so elements removed on expiration are noticed late.
+func (s *Stack) SetWatermarks(w Watermarks) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+
+	s.watermarksMu.Lock()
+	defer s.watermarksMu.Unlock()
+
+	if w.High == NoWatermark && w.Low == NoWatermark {
+		s.watermarks = nil
+		atomic.StoreInt32(&s.hasWatermarks, 0)
+		return nil
+	}
+	s.watermarks = &w
+	s.watermarkSize = s.SizeApprox()
+	atomic.StoreInt32(&s.hasWatermarks, 1)
+	return nil
+}
+
+// Watermarks returns the Watermarks of the Stack,
+// or false if it has none.
+func (s *Stack) Watermarks() (Watermarks, bool) {
+	s.watermarksMu.Lock()
+	defer s.watermarksMu.Unlock()
+
+	if s.watermarks == nil {
+		return Watermarks{High: NoWatermark, Low: NoWatermark}, false
+	}
+	return *s.watermarks, true
+}
+
+// checkWatermarks triggers the Events of the Watermarks of the Stack
+// crossed since they were last evaluated, if any.
+func (s *Stack) checkWatermarks() {
+	if atomic.LoadInt32(&s.hasWatermarks) == 0 {
+		return
+	}
+
+	var events []Event
+	s.watermarksMu.Lock()
+	if w := s.watermarks; w != nil {
+		prev, size := s.watermarkSize, s.SizeApprox()
+		s.watermarkSize = size
+		if w.High != NoWatermark && prev < w.High && size >= w.High {
+			events = append(events, Event{Op: EventHighWatermark, Element: size})
+		}
+		if w.Low != NoWatermark && prev > w.Low && size <= w.Low {
+			events = append(events, Event{Op: EventLowWatermark, Element: size})
+		}
+	}
+	s.watermarksMu.Unlock()
+
+	for _, e := range events {
+		s.publish(e)
+		if db := s.Database; db != nil {
+			db.watermark(s, e)
+		}
+	}
+}
+
+// OnWatermark registers a function that is called with every Stack of
+// the Pila crossing its Watermarks, and the triggered Event, replacing
+// the former one, or none if fn is nil. Like the functions subscribed to
+// Stacks, it is called synchronously, so it must not block nor operate
+// on the Stack.
+func (p *Pila) OnWatermark(fn func(db *Database, s *Stack, e Event)) {
+	p.watermarkMu.Lock()
+	defer p.watermarkMu.Unlock()
+	p.watermarkFn = fn
+}
+
+// watermark calls the function registered with OnWatermark
+// on the Pila of the Database, if any.
+func (db *Database) watermark(s *Stack, e Event) {
+	p := db.Pila
+	if p == nil {
+		return
+	}
+
+	p.watermarkMu.RLock()
+	fn := p.watermarkFn
+	p.watermarkMu.RUnlock()
+	if fn != nil {
+		fn(db, s, e)
+	}
+}
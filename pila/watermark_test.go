@@ -0,0 +1,118 @@
+package pila
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatermarksValidate(t *testing.T) {
+	inputOutput := []struct {
+		input  Watermarks
+		output error
+	}{
+		{Watermarks{High: NoWatermark, Low: NoWatermark}, nil},
+		{Watermarks{High: 10, Low: NoWatermark}, nil},
+		{Watermarks{High: NoWatermark, Low: 0}, nil},
+		{Watermarks{High: 10, Low: 2}, nil},
+		{Watermarks{High: 0, Low: NoWatermark}, ErrInvalidWatermarks},
+		{Watermarks{High: NoWatermark, Low: -2}, ErrInvalidWatermarks},
+		{Watermarks{High: 2, Low: 2}, ErrInvalidWatermarks},
+		{Watermarks{High: 2, Low: 10}, ErrInvalidWatermarks},
+	}
+
+	for _, io := range inputOutput {
+		if err := io.input.Validate(); err != io.output {
+			t.Errorf("error is %v, expected %v for %v", err, io.output, io.input)
+		}
+	}
+}
+
+func TestStackSetWatermarks(t *testing.T) {
+	stack := NewStack("stack", time.Now())
+	if _, ok := stack.Watermarks(); ok {
+		t.Error("stack has watermarks")
+	}
+	if stack.Status().Watermarks != nil {
+		t.Error("stack status has watermarks")
+	}
+
+	if err := stack.SetWatermarks(Watermarks{High: 1, Low: 1}); err != ErrInvalidWatermarks {
+		t.Errorf("error is %v, expected %v", err, ErrInvalidWatermarks)
+	}
+
+	expected := Watermarks{High: 3, Low: 0}
+	if err := stack.SetWatermarks(expected); err != nil {
+		t.Fatal(err)
+	}
+	if w, ok := stack.Watermarks(); !ok || w != expected {
+		t.Errorf("watermarks are %v, %v, expected %v", w, ok, expected)
+	}
+	if w := stack.Status().Watermarks; w == nil || *w != expected {
+		t.Errorf("status watermarks are %v, expected %v", w, expected)
+	}
+
+	if err := stack.SetWatermarks(Watermarks{High: NoWatermark, Low: NoWatermark}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stack.Watermarks(); ok {
+		t.Error("stack has watermarks")
+	}
+}
+
+func TestStackWatermarks_Events(t *testing.T) {
+	p := NewPila()
+	db := NewDatabase("db")
+	_ = p.AddDatabase(db)
+	stack := NewStack("stack", time.Now())
+	_ = db.AddStack(stack)
+	stack.Push("foo")
+
+	var events, alerts []Event
+	stack.Subscribe(func(e Event) {
+		if e.Op == EventHighWatermark || e.Op == EventLowWatermark {
+			events = append(events, e)
+		}
+	})
+	p.OnWatermark(func(d *Database, s *Stack, e Event) {
+		if d != db || s != stack {
+			t.Errorf("alerted database %v and stack %v, expected %v and %v", d, s, db, stack)
+		}
+		alerts = append(alerts, e)
+	})
+
+	_ = stack.SetWatermarks(Watermarks{High: 3, Low: 0})
+	stack.Push("bar")
+	stack.Push("baz")
+	stack.Push("qux")
+	stack.Pop()
+	stack.Push("qux")
+	stack.PopN(3)
+	stack.Pop()
+	stack.Pop()
+	stack.Push("foo")
+	stack.Push("bar")
+	stack.Push("baz")
+	stack.Flush()
+
+	expected := []Event{
+		{Op: EventHighWatermark, Element: 3},
+		{Op: EventLowWatermark, Element: 0},
+		{Op: EventHighWatermark, Element: 3},
+		{Op: EventLowWatermark, Element: 0},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("events are %v, expected %v", events, expected)
+	}
+	if !reflect.DeepEqual(alerts, expected) {
+		t.Errorf("alerts are %v, expected %v", alerts, expected)
+	}
+
+	p.OnWatermark(nil)
+	_ = stack.SetWatermarks(Watermarks{High: NoWatermark, Low: NoWatermark})
+	stack.Push("foo")
+	stack.Pop()
+	if len(events) != len(expected) {
+		t.Errorf("events are %v, expected %v", events, expected)
+	}
+}
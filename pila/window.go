@@ -0,0 +1,162 @@
+package pila
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/cron"
+)
+
+// ErrInvalidWindow is returned when setting a Window without
+// either a positive duration or a valid schedule, or whose To
+// Stack is the Stack itself.
+var ErrInvalidWindow = errors.New("invalid window")
+
+// Window makes a Stack time-windowed: its elements are removed at the
+// end of every window, given either by a fixed duration or by a cron
+// schedule, see CloseWindow.
+type Window struct {
+	// Every is the duration of the windows, which are aligned
+	// to it, e.g. every hour on the hour, if not zero
+	Every time.Duration `json:"every,omitempty"`
+	// Schedule is the cron expression of the ends of the
+	// windows, in UTC, if not empty, see cron.Parse
+	Schedule string `json:"schedule,omitempty"`
+	// To is the name of the Stack of the same Database the
+	// elements of a closed window are pushed into, as a single
+	// array, if not empty
+	To string `json:"to,omitempty"`
+	// Archive tells whether the elements of a closed window
+	// are archived, which is left to the embedder, e.g. pilad
+	Archive bool `json:"archive,omitempty"`
+}
+
+// Validate returns ErrInvalidWindow unless the Window
+// has either a positive duration or a valid schedule.
+func (w Window) Validate() error {
+	if (w.Every > 0) == (w.Schedule != "") || w.Every < 0 {
+		return ErrInvalidWindow
+	}
+	if w.Schedule != "" {
+		s, err := cron.Parse(w.Schedule)
+		if err != nil || s.Next(time.Now()).IsZero() {
+			return ErrInvalidWindow
+		}
+	}
+	return nil
+}
+
+// Next returns the end of the window following t,
+// the zero date if the Window is not valid.
+func (w Window) Next(t time.Time) time.Time {
+	if w.Every > 0 {
+		return t.Truncate(w.Every).Add(w.Every)
+	}
+	s, err := cron.Parse(w.Schedule)
+	if err != nil {
+		return time.Time{}
+	}
+	return s.Next(t)
+}
+
+// ClosedWindow represents a window of a Stack closed by
+// CloseWindow, with the elements it contained.
+type ClosedWindow struct {
+	// End is the date when the window ended
+	End time.Time
+	// Elements are the elements removed from the Stack,
+	// in the order they would have been popped
+	Elements []interface{}
+	// To is the Stack the Elements were pushed into, as a
+	// single array, nil if none, and Err the error on
+	// pushing them, if any
+	To  *Stack
+	Err error
+}
+
+// SetWindow sets the Window of the Stack, or removes it if it has
+// neither a duration nor a schedule, which is the default. The current
+// window ends at the end given by its Next date. ErrInvalidWindow is
+// returned if w is not valid.
+func (s *Stack) SetWindow(w Window) error {
+	if w.Every == 0 && w.Schedule == "" {
+		s.windowMu.Lock()
+		defer s.windowMu.Unlock()
+		s.window = nil
+		atomic.StoreInt32(&s.hasWindow, 0)
+		return nil
+	}
+	if err := w.Validate(); err != nil || w.To == s.Name {
+		return ErrInvalidWindow
+	}
+
+	s.windowMu.Lock()
+	defer s.windowMu.Unlock()
+	s.window = &w
+	s.windowEnd = w.Next(time.Now())
+	atomic.StoreInt32(&s.hasWindow, 1)
+	return nil
+}
+
+// Window returns the Window of the Stack and the end
+// of the current window, or false if it has none.
+func (s *Stack) Window() (Window, time.Time, bool) {
+	s.windowMu.Lock()
+	defer s.windowMu.Unlock()
+	if s.window == nil {
+		return Window{}, time.Time{}, false
+	}
+	return *s.window, s.windowEnd, true
+}
+
+// CloseWindow closes the current window of the Stack if it ended by t,
+// removing all its elements as a single operation, and starts the next
+// one. If the Window has a To Stack, and the Database of the Stack has
+// it, the elements are pushed into it as a single array, in the order
+// they would have been popped. It returns false if the Stack has no
+// Window, or the current window did not end by t.
+func (s *Stack) CloseWindow(t time.Time) (ClosedWindow, bool) {
+	if atomic.LoadInt32(&s.hasWindow) == 0 {
+		return ClosedWindow{}, false
+	}
+
+	s.windowMu.Lock()
+	if s.window == nil || t.Before(s.windowEnd) {
+		s.windowMu.Unlock()
+		return ClosedWindow{}, false
+	}
+	w, closed := *s.window, ClosedWindow{End: s.windowEnd}
+	s.windowEnd = w.Next(t)
+	s.windowMu.Unlock()
+
+	closed.Elements = s.drain(t)
+	if w.To != "" && s.Database != nil && len(closed.Elements) > 0 {
+		if to, ok := s.Database.StackByName(w.To); ok {
+			closed.To = to
+			closed.Err = to.Push(closed.Elements)
+		}
+	}
+	return closed, true
+}
+
+// drain removes all the elements of the Stack as a single
+// operation, and returns the ones alive at t, in the order
+// they would have been popped.
+func (s *Stack) drain(t time.Time) []interface{} {
+	elements := make([]interface{}, 0)
+	var freed int64
+	removed := s.base.Filter(func(element interface{}) bool {
+		if value, alive := unwrap(element, t); alive {
+			elements = append(elements, value)
+		}
+		freed += elementMemory(element)
+		return false
+	})
+	atomic.AddInt64(&s.sizeApprox, -int64(removed))
+	s.indexReset()
+	s.account(-freed)
+
+	s.notify(Event{Op: EventFlush})
+	return elements
+}
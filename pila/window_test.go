@@ -0,0 +1,122 @@
+package pila
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWindowValidate(t *testing.T) {
+	inputOutput := []struct {
+		input Window
+		valid bool
+	}{
+		{Window{Every: time.Hour}, true},
+		{Window{Schedule: "@daily", To: "foo", Archive: true}, true},
+		{Window{}, false},
+		{Window{Every: -time.Hour}, false},
+		{Window{Every: time.Hour, Schedule: "@daily"}, false},
+		{Window{Schedule: "foo"}, false},
+		{Window{Schedule: "0 0 30 2 *"}, false},
+	}
+
+	for _, io := range inputOutput {
+		if err := io.input.Validate(); (err == nil) != io.valid {
+			t.Errorf("err is %v for %v, expected valid %v", err, io.input, io.valid)
+		}
+	}
+}
+
+func TestWindowNext(t *testing.T) {
+	now := time.Date(2016, 1, 6, 10, 17, 30, 0, time.UTC)
+
+	inputOutput := []struct {
+		input  Window
+		output time.Time
+	}{
+		{Window{Every: time.Hour}, time.Date(2016, 1, 6, 11, 0, 0, 0, time.UTC)},
+		{Window{Every: 15 * time.Minute}, time.Date(2016, 1, 6, 10, 30, 0, 0, time.UTC)},
+		{Window{Schedule: "@daily"}, time.Date(2016, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{Window{Schedule: "foo"}, time.Time{}},
+	}
+
+	for _, io := range inputOutput {
+		if next := io.input.Next(now); !next.Equal(io.output) {
+			t.Errorf("next of %v is %v, expected %v", io.input, next, io.output)
+		}
+	}
+}
+
+func TestStackSetWindow(t *testing.T) {
+	stack := NewStack("stack", time.Now())
+
+	if _, _, ok := stack.Window(); ok {
+		t.Error("stack has a window, expected none")
+	}
+	if err := stack.SetWindow(Window{Every: time.Hour, To: "stack"}); err != ErrInvalidWindow {
+		t.Errorf("err is %v, expected %v", err, ErrInvalidWindow)
+	}
+	if err := stack.SetWindow(Window{Schedule: "foo"}); err != ErrInvalidWindow {
+		t.Errorf("err is %v, expected %v", err, ErrInvalidWindow)
+	}
+
+	window := Window{Every: time.Hour, To: "other"}
+	if err := stack.SetWindow(window); err != nil {
+		t.Fatal(err)
+	}
+	if w, end, ok := stack.Window(); !ok || w != window || !end.After(time.Now()) {
+		t.Errorf("window is %v ending at %v, expected %v", w, end, window)
+	}
+
+	if err := stack.SetWindow(Window{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := stack.Window(); ok {
+		t.Error("stack has a window, expected none")
+	}
+}
+
+func TestStackCloseWindow(t *testing.T) {
+	db := NewDatabase("db")
+	stack := NewStack("stack", time.Now())
+	to := NewStack("to", time.Now())
+	_ = db.AddStack(stack)
+	_ = db.AddStack(to)
+
+	if _, ok := stack.CloseWindow(time.Now()); ok {
+		t.Error("window closed, expected no window")
+	}
+
+	_ = stack.SetWindow(Window{Every: time.Hour, To: "to"})
+	_ = stack.Push("foo")
+	_ = stack.PushWithExpiration("expired", time.Now().Add(time.Minute))
+	_ = stack.Push("bar")
+
+	if _, ok := stack.CloseWindow(time.Now()); ok {
+		t.Error("window closed, expected it not to end yet")
+	}
+
+	_, end, _ := stack.Window()
+	closed, ok := stack.CloseWindow(end.Add(time.Minute))
+	if !ok {
+		t.Fatal("window not closed")
+	}
+	expected := []interface{}{"bar", "foo"}
+	if !closed.End.Equal(end) || !reflect.DeepEqual(closed.Elements, expected) || closed.To != to || closed.Err != nil {
+		t.Errorf("closed window is %v, expected %v ending at %v", closed, expected, end)
+	}
+	if stack.Size() != 0 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 0)
+	}
+	if value, ok := to.Pop(); !ok || !reflect.DeepEqual(value, expected) {
+		t.Errorf("to pops %v, expected %v", value, expected)
+	}
+	if _, next, _ := stack.Window(); !next.Equal(end.Add(time.Hour)) {
+		t.Errorf("next window ends at %v, expected %v", next, end.Add(time.Hour))
+	}
+
+	// closing an empty window pushes nothing
+	if closed, ok := stack.CloseWindow(end.Add(time.Hour)); !ok || len(closed.Elements) != 0 || closed.To != nil || to.Size() != 0 {
+		t.Errorf("closed window is %v, expected no elements", closed)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fern4lvarez/piladb/pila/client"
+)
+
+// errUsage is returned when a command is unknown or
+// receives a wrong number of arguments.
+var errUsage = errors.New("wrong command or number of arguments")
+
+// command executes the commands of pilactl with a Client,
+// reading elements from stdin and writing the output to stdout,
+// either in plain text or JSON.
+type command struct {
+	client *client.Client
+	stdin  io.Reader
+	stdout io.Writer
+	json   bool
+}
+
+// commandSpec describes a command of pilactl.
+type commandSpec struct {
+	// args is the usage of the arguments
+	args string
+	// minArgs and maxArgs are the allowed number of arguments
+	minArgs, maxArgs int
+	help             string
+	run              func(cmd *command, args []string) error
+}
+
+// commands are the available commands of pilactl, by name.
+var commands = map[string]commandSpec{
+	"status":          {"", 0, 0, "Print the status of pilad", (*command).status},
+	"databases":       {"", 0, 0, "List the databases", (*command).databases},
+	"create-database": {"DATABASE", 1, 1, "Create a database", (*command).createDatabase},
+	"delete-database": {"DATABASE", 1, 1, "Delete a database", (*command).deleteDatabase},
+	"stacks":          {"DATABASE", 1, 1, "List the stacks of a database", (*command).stacks},
+	"create-stack":    {"DATABASE STACK", 2, 2, "Create a stack", (*command).createStack},
+	"delete-stack":    {"DATABASE STACK", 2, 2, "Delete a stack", (*command).deleteStack},
+	"stack":           {"DATABASE STACK", 2, 2, "Print the status of a stack", (*command).stack},
+	"push":            {"DATABASE STACK [ELEMENT]", 2, 3, "Push an element, or every line of stdin if not given", (*command).push},
+	"pop":             {"DATABASE STACK", 2, 2, "Pop and print the element on top of a stack", (*command).pop},
+	"peek":            {"DATABASE STACK", 2, 2, "Print the element on top of a stack", (*command).peek},
+	"size":            {"DATABASE STACK", 2, 2, "Print the size of a stack", (*command).size},
+	"flush":           {"DATABASE STACK", 2, 2, "Remove all the elements of a stack", (*command).flush},
+}
+
+// commandNames returns the names of the commands in alphabetical order.
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// printCommands writes the usage of every command.
+func printCommands(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, name := range commandNames() {
+		spec := commands[name]
+		fmt.Fprintf(tw, "  %s %s\t%s\n", name, spec.args, spec.help)
+	}
+	tw.Flush()
+}
+
+// run executes the command given by the first argument with
+// the remaining ones. It returns errUsage if the command is
+// unknown or the number of arguments is wrong.
+func (cmd *command) run(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	spec, ok := commands[args[0]]
+	if !ok {
+		return errUsage
+	}
+	if args = args[1:]; len(args) < spec.minArgs || len(args) > spec.maxArgs {
+		return errUsage
+	}
+	return spec.run(cmd, args)
+}
+
+func (cmd *command) status(args []string) error {
+	status, err := cmd.client.Status()
+	if err != nil {
+		return err
+	}
+	if cmd.json {
+		return cmd.printJSON(status)
+	}
+
+	tw := cmd.table()
+	fmt.Fprintf(tw, "status:\t%s\n", status.Code)
+	fmt.Fprintf(tw, "version:\t%s\n", status.Version)
+	fmt.Fprintf(tw, "host:\t%s\n", status.Host)
+	fmt.Fprintf(tw, "pid:\t%d\n", status.PID)
+	fmt.Fprintf(tw, "started_at:\t%s\n", status.StartedAt)
+	fmt.Fprintf(tw, "running_for:\t%gs\n", status.RunningFor)
+	fmt.Fprintf(tw, "number_goroutines:\t%d\n", status.NumberGoroutines)
+	fmt.Fprintf(tw, "memory_alloc:\t%s\n", status.MemoryAlloc)
+	return tw.Flush()
+}
+
+func (cmd *command) databases(args []string) error {
+	status, err := cmd.client.Databases()
+	if err != nil {
+		return err
+	}
+	if cmd.json {
+		return cmd.printJSON(status)
+	}
+
+	tw := cmd.table()
+	fmt.Fprintln(tw, "NAME\tSTACKS")
+	for _, db := range status.Databases {
+		fmt.Fprintf(tw, "%s\t%d\n", db.Name, db.NumberStacks)
+	}
+	return tw.Flush()
+}
+
+func (cmd *command) createDatabase(args []string) error {
+	return cmd.client.Database(args[0]).Create()
+}
+
+func (cmd *command) deleteDatabase(args []string) error {
+	return cmd.client.Database(args[0]).Delete()
+}
+
+func (cmd *command) stacks(args []string) error {
+	status, err := cmd.client.Database(args[0]).Stacks()
+	if err != nil {
+		return err
+	}
+	if cmd.json {
+		return cmd.printJSON(status)
+	}
+
+	tw := cmd.table()
+	fmt.Fprintln(tw, "NAME\tSIZE\tPEEK")
+	for _, stack := range status.Stacks {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", stack.Name, stack.Size, format(stack.Peek))
+	}
+	return tw.Flush()
+}
+
+func (cmd *command) createStack(args []string) error {
+	return cmd.stackArg(args).Create()
+}
+
+func (cmd *command) deleteStack(args []string) error {
+	return cmd.stackArg(args).Delete()
+}
+
+func (cmd *command) stack(args []string) error {
+	status, err := cmd.stackArg(args).Status()
+	if err != nil {
+		return err
+	}
+	if cmd.json {
+		return cmd.printJSON(status)
+	}
+
+	tw := cmd.table()
+	fmt.Fprintf(tw, "name:\t%s\n", status.Name)
+	fmt.Fprintf(tw, "size:\t%d\n", status.Size)
+	fmt.Fprintf(tw, "peek:\t%s\n", format(status.Peek))
+	fmt.Fprintf(tw, "created_at:\t%s\n", status.CreatedAt)
+	fmt.Fprintf(tw, "updated_at:\t%s\n", status.UpdatedAt)
+	if status.MaxSize > 0 {
+		fmt.Fprintf(tw, "max_size:\t%d\n", status.MaxSize)
+		fmt.Fprintf(tw, "overflow_policy:\t%s\n", status.Policy)
+	}
+	return tw.Flush()
+}
+
+// push pushes the element given as argument or, if not given,
+// every non-empty line of stdin. Elements are parsed as JSON,
+// and pushed as strings if they are not valid JSON.
+func (cmd *command) push(args []string) error {
+	stack := cmd.stackArg(args)
+	if len(args) == 3 {
+		return stack.Push(parse(args[2]))
+	}
+
+	scanner := bufio.NewScanner(cmd.stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := stack.Push(parse(line)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (cmd *command) pop(args []string) error {
+	element, err := cmd.stackArg(args).Pop()
+	if err != nil {
+		return err
+	}
+	return cmd.printElement(element)
+}
+
+func (cmd *command) peek(args []string) error {
+	element, err := cmd.stackArg(args).Peek()
+	if err != nil {
+		return err
+	}
+	return cmd.printElement(element)
+}
+
+func (cmd *command) size(args []string) error {
+	size, err := cmd.stackArg(args).Size()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(cmd.stdout, size)
+	return err
+}
+
+func (cmd *command) flush(args []string) error {
+	return cmd.stackArg(args).Flush()
+}
+
+// stackArg returns the stack given by the
+// DATABASE and STACK arguments.
+func (cmd *command) stackArg(args []string) *client.Stack {
+	return cmd.client.Database(args[0]).Stack(args[1])
+}
+
+// table returns a tabwriter writing into stdout.
+func (cmd *command) table() *tabwriter.Writer {
+	return tabwriter.NewWriter(cmd.stdout, 0, 8, 2, ' ', 0)
+}
+
+// printElement prints an element, wrapped in an
+// {"element": value} object in JSON mode.
+func (cmd *command) printElement(element interface{}) error {
+	if cmd.json {
+		return cmd.printJSON(map[string]interface{}{"element": element})
+	}
+	_, err := fmt.Fprintln(cmd.stdout, format(element))
+	return err
+}
+
+// printJSON prints a value encoded as JSON.
+func (cmd *command) printJSON(v interface{}) error {
+	return json.NewEncoder(cmd.stdout).Encode(v)
+}
+
+// parse returns the value of an element encoded as JSON,
+// or the element itself if it is not valid JSON.
+func parse(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	return v
+}
+
+// format returns the plain text representation of an element:
+// strings are printed as they are, and other values as JSON.
+func format(element interface{}) string {
+	if s, ok := element.(string); ok {
+		return s
+	}
+
+	// Do not check error as elements are
+	// decoded from JSON responses.
+	b, _ := json.Marshal(element)
+	return string(b)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fern4lvarez/piladb/pila/client"
+)
+
+// fakeServer returns a server answering each "METHOD /path?query"
+// request with its canned status code and body, and recording the
+// bodies of the received requests.
+func fakeServer(t *testing.T, responses map[string]string, bodies *[]string) (*httptest.Server, *command) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.RequestURI()
+		res, ok := responses[key]
+		if !ok {
+			t.Errorf("unexpected request %s", key)
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+
+		if bodies != nil {
+			b, _ := ioutil.ReadAll(r.Body)
+			*bodies = append(*bodies, string(b))
+		}
+		if res == "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(res))
+	}))
+
+	c := &client.Client{
+		Addr:       strings.TrimPrefix(server.URL, "http://"),
+		HTTPClient: http.DefaultClient,
+	}
+	return server, &command{client: c, stdout: &bytes.Buffer{}}
+}
+
+func TestCommandRun(t *testing.T) {
+	server, cmd := fakeServer(t, map[string]string{
+		"GET /_status":                             `{"status":"OK","version":"v1","host":"linux_amd64","pid":42}`,
+		"GET /databases":                           `{"number_of_databases":1,"databases":[{"id":"1","name":"db","number_of_stacks":2}]}`,
+		"PUT /databases?name=db":                   `{}`,
+		"DELETE /databases/db":                     "",
+		"GET /databases/db/stacks":                 `{"stacks":[{"name":"s0","peek":"foo","size":1},{"name":"s1","peek":{"a":1},"size":3}]}`,
+		"PUT /databases/db/stacks?name=stack":      `{}`,
+		"DELETE /databases/db/stacks/stack?full=":  "",
+		"GET /databases/db/stacks/stack":           `{"name":"stack","peek":8,"size":1,"max_size":5,"overflow_policy":"reject"}`,
+		"DELETE /databases/db/stacks/stack":        `{"element":"foo"}`,
+		"GET /databases/db/stacks/stack?peek=":     `{"element":[1,2]}`,
+		"GET /databases/db/stacks/stack?size=":     `3`,
+		"DELETE /databases/db/stacks/stack?flush=": `{}`,
+	}, nil)
+	defer server.Close()
+
+	inputOutput := []struct {
+		input  string
+		output string
+	}{
+		{"status", "status:             OK\nversion:            v1\nhost:               linux_amd64\npid:                42\n"},
+		{"databases", "NAME  STACKS\ndb    2\n"},
+		{"create-database db", ""},
+		{"delete-database db", ""},
+		{"stacks db", "NAME  SIZE  PEEK\ns0    1     foo\ns1    3     {\"a\":1}\n"},
+		{"create-stack db stack", ""},
+		{"delete-stack db stack", ""},
+		{"stack db stack", "name:             stack\nsize:             1\npeek:             8\n"},
+		{"pop db stack", "foo\n"},
+		{"peek db stack", "[1,2]\n"},
+		{"size db stack", "3\n"},
+		{"flush db stack", ""},
+	}
+
+	for _, io := range inputOutput {
+		stdout := &bytes.Buffer{}
+		cmd.stdout = stdout
+		if err := cmd.run(strings.Fields(io.input)); err != nil {
+			t.Errorf("err is %v for %s", err, io.input)
+			continue
+		}
+		if !strings.HasPrefix(stdout.String(), io.output) {
+			t.Errorf("output is %q, expected %q", stdout.String(), io.output)
+		}
+	}
+}
+
+func TestCommandRun_JSON(t *testing.T) {
+	server, cmd := fakeServer(t, map[string]string{
+		"GET /databases":                       `{"number_of_databases":1,"databases":[{"id":"1","name":"db","number_of_stacks":2}]}`,
+		"DELETE /databases/db/stacks/stack":    `{"element":"foo"}`,
+		"GET /databases/db/stacks/stack?peek=": `{"element":null}`,
+	}, nil)
+	defer server.Close()
+	cmd.json = true
+
+	inputOutput := []struct {
+		input  string
+		output string
+	}{
+		{"databases", `{"number_of_databases":1,"databases":[{"id":"1","name":"db","number_of_stacks":2,"memory":0}]}` + "\n"},
+		{"pop db stack", `{"element":"foo"}` + "\n"},
+		{"peek db stack", `{"element":null}` + "\n"},
+	}
+
+	for _, io := range inputOutput {
+		stdout := &bytes.Buffer{}
+		cmd.stdout = stdout
+		if err := cmd.run(strings.Fields(io.input)); err != nil {
+			t.Errorf("err is %v for %s", err, io.input)
+			continue
+		}
+		if stdout.String() != io.output {
+			t.Errorf("output is %q, expected %q", stdout.String(), io.output)
+		}
+	}
+}
+
+func TestCommandPush(t *testing.T) {
+	var bodies []string
+	server, cmd := fakeServer(t, map[string]string{
+		"POST /databases/db/stacks/stack": `{}`,
+	}, &bodies)
+	defer server.Close()
+
+	if err := cmd.run([]string{"push", "db", "stack", `{"a":1}`}); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd.stdin = strings.NewReader("foo\n\n8\n[1, 2]\n")
+	if err := cmd.run([]string{"push", "db", "stack"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`{"element":{"a":1}}`,
+		`{"element":"foo"}`,
+		`{"element":8}`,
+		`{"element":[1,2]}`,
+	}
+	if strings.Join(bodies, " ") != strings.Join(expected, " ") {
+		t.Errorf("bodies are %v, expected %v", bodies, expected)
+	}
+}
+
+func TestCommandRun_Error(t *testing.T) {
+	server, cmd := fakeServer(t, map[string]string{
+		"DELETE /databases/db/stacks/stack": "",
+	}, nil)
+	defer server.Close()
+
+	inputOutput := []struct {
+		input  []string
+		output error
+	}{
+		{nil, errUsage},
+		{[]string{"foo"}, errUsage},
+		{[]string{"pop", "db"}, errUsage},
+		{[]string{"push", "db", "stack", "foo", "bar"}, errUsage},
+		{[]string{"pop", "db", "stack"}, client.ErrEmpty},
+	}
+
+	for _, io := range inputOutput {
+		if err := cmd.run(io.input); err != io.output {
+			t.Errorf("err is %v for %v, expected %v", err, io.input, io.output)
+		}
+	}
+}
+
+func TestPrintCommands(t *testing.T) {
+	var b bytes.Buffer
+	printCommands(&b)
+
+	for name := range commands {
+		if !strings.Contains(b.String(), "  "+name+" ") {
+			t.Errorf("command %s is not printed", name)
+		}
+	}
+}
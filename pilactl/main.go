@@ -0,0 +1,57 @@
+// Binary pilactl provides a command line client of a running
+// pilad server.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila/client"
+)
+
+// These vars represent the command line flags.
+var (
+	addrFlag string
+	jsonFlag bool
+)
+
+func init() {
+	flag.StringVar(&addrFlag, "addr", fmt.Sprintf("localhost:%d", vars.PortDefault), "Address of the pilad server")
+	flag.BoolVar(&jsonFlag, "json", false, "Print the output as JSON")
+	flag.Usage = usage
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	c, err := client.Dial(addrFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "pilactl:", err)
+		os.Exit(1)
+	}
+
+	cmd := &command{client: c, stdin: os.Stdin, stdout: os.Stdout, json: jsonFlag}
+	if err := cmd.run(flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "pilactl:", err)
+		if err == errUsage {
+			usage()
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// usage prints the usage of pilactl.
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: pilactl [flags] COMMAND [ARGS]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	printCommands(os.Stderr)
+	fmt.Fprintln(os.Stderr, "\nFlags:")
+	flag.PrintDefaults()
+}
@@ -5,26 +5,73 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
-	"time"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fern4lvarez/piladb/pilad/server"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+	"github.com/fern4lvarez/piladb/pkg/version"
+)
+
+var (
+	// opts are the Options of the server,
+	// set from the command line flags
+	opts        = server.DefaultOptions()
+	versionFlag bool
 )
 
+func init() {
+	opts.RegisterFlags(flag.CommandLine)
+	flag.BoolVar(&versionFlag, "v", false, "Version")
+}
+
 func main() {
 	flag.Parse()
 	if versionFlag {
 		fmt.Println(v())
 		return
 	}
+	flag.Visit(func(f *flag.Flag) {
+		opts.Explicit[f.Name] = true
+	})
+	run()
+}
+
+// run runs the server until it is shut down.
+func run() {
+	s, err := server.New(opts)
+	if err, ok := err.(server.InvalidConfigError); ok {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		logger.Fatal("error on starting", "error", err)
+	}
 
-	conn := NewConn()
-	conn.buildConfig()
-	logo(conn)
+	// Shut down on SIGINT or SIGTERM, unless
+	// already done on POST /_shutdown.
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		select {
+		case sig := <-signals:
+			logger.Info("shutting down", "signal", sig)
+			s.Shutdown()
+		case <-s.Conn.Shutdown.Requested():
+			logger.Info("shutting down")
+		}
+	}()
 
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", conn.Config.Port()),
-		Handler:      Router(conn),
-		ReadTimeout:  conn.Config.ReadTimeout() * time.Second,
-		WriteTimeout: conn.Config.WriteTimeout() * time.Second,
+	if err := s.Wait(); err != nil {
+		logger.Fatal("error on serving", "error", err)
 	}
-	log.Fatal(srv.ListenAndServe())
+}
+
+// v returns the version using pkg/version
+func v() string {
+	return version.Version(version.VERSION)
 }
@@ -9,13 +9,13 @@ import (
 // TestMain is a hack to get 100% test coverage.
 func TestMain(t *testing.T) {
 	os.Setenv("PILADB_PORT", "35343")
-	go main()
+	go run()
 	time.Sleep(5 * time.Millisecond)
 	os.Setenv("PILADB_PORT", "")
 }
 
 func TestMainVersion(t *testing.T) {
 	versionFlag = true
-	go main()
+	main()
 	t.Log(v())
 }
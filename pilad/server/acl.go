@@ -0,0 +1,311 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// ACLRules represents the network access rules of pilad, as lists of
+// CIDR blocks or single IP addresses.
+type ACLRules struct {
+	// Allow are the only clients allowed, any client if empty
+	Allow []string `json:"allow"`
+	// Deny are the clients denied, even if allowed
+	Deny []string `json:"deny"`
+	// Databases are the only clients allowed to access
+	// a Database, by name, on top of Allow and Deny
+	Databases map[string][]string `json:"databases"`
+}
+
+// ToJSON converts ACLRules into JSON.
+func (rules ACLRules) ToJSON() []byte {
+	// Do not check error as ACLRules do not
+	// contain types that could cause such case.
+	b, _ := json.Marshal(rules)
+	return b
+}
+
+// ACL enforces the ACLRules of pilad on the IP addresses of clients.
+// Its rules can be replaced while pilad is running.
+type ACL struct {
+	rules     ACLRules
+	allow     []*net.IPNet
+	deny      []*net.IPNet
+	databases map[string][]*net.IPNet
+
+	// mu protects the access to the rules
+	mu sync.RWMutex
+}
+
+// NewACL returns an ACL allowing any client.
+func NewACL() *ACL {
+	acl := &ACL{}
+	// Do not check error as empty rules are valid.
+	_ = acl.Set(ACLRules{})
+	return acl
+}
+
+// Set replaces the rules of the ACL. It returns an error, keeping the
+// former rules, if any of them is not a CIDR block nor an IP address,
+// or if a Database has no name.
+func (acl *ACL) Set(rules ACLRules) error {
+	allow, err := parseCIDRs(rules.Allow)
+	if err != nil {
+		return err
+	}
+	deny, err := parseCIDRs(rules.Deny)
+	if err != nil {
+		return err
+	}
+	databases := make(map[string][]*net.IPNet)
+	for name, cidrs := range rules.Databases {
+		if name == "" {
+			return fmt.Errorf("missing database name")
+		}
+		if databases[name], err = parseCIDRs(cidrs); err != nil {
+			return fmt.Errorf("database %s: %v", name, err)
+		}
+	}
+
+	if rules.Allow == nil {
+		rules.Allow = []string{}
+	}
+	if rules.Deny == nil {
+		rules.Deny = []string{}
+	}
+	if rules.Databases == nil {
+		rules.Databases = map[string][]string{}
+	}
+
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+	acl.rules, acl.allow, acl.deny, acl.databases = rules, allow, deny, databases
+	return nil
+}
+
+// Rules returns the rules of the ACL.
+func (acl *ACL) Rules() ACLRules {
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+	return acl.rules
+}
+
+// Allowed determines whether the client with the IP address ip is
+// allowed to access pilad and, unless empty, the Database given by
+// name. Clients whose address can not be parsed are allowed only if
+// there are no rules restricting them.
+func (acl *ACL) Allowed(ip net.IP, database string) bool {
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+
+	if len(acl.deny) > 0 && (ip == nil || containsIP(acl.deny, ip)) {
+		return false
+	}
+	if len(acl.allow) > 0 && (ip == nil || !containsIP(acl.allow, ip)) {
+		return false
+	}
+	if nets, ok := acl.databases[database]; ok && database != "" {
+		return ip != nil && containsIP(nets, ip)
+	}
+	return true
+}
+
+// parseCIDRs parses a list of CIDR blocks or IP addresses, the
+// latter being blocks of a single address.
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address or CIDR block %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address or CIDR block %q", cidr)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// containsIP determines whether any of nets contains ip.
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// aclFlags implements flag.Value to parse a list of CIDR blocks or
+// IP addresses, like -allow=10.0.0.0/8 -allow=192.168.1.10.
+type aclFlags []string
+
+// String returns the list as a comma-separated list.
+func (af *aclFlags) String() string {
+	return strings.Join(*af, ",")
+}
+
+// Set parses a CIDR block or IP address and appends it to the list.
+func (af *aclFlags) Set(value string) error {
+	if _, err := parseCIDRs([]string{value}); err != nil {
+		return err
+	}
+	*af = append(*af, value)
+	return nil
+}
+
+// aclDatabaseFlags implements flag.Value to parse the clients allowed
+// to access Databases, given as "database=cidr[,cidr...]", like
+// -allow-database=db=10.0.0.0/8,192.168.1.10,::1.
+type aclDatabaseFlags map[string][]string
+
+// String returns the names of the Databases as a comma-separated list.
+func (adf aclDatabaseFlags) String() string {
+	names := make([]string, 0, len(adf))
+	for name := range adf {
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
+
+// Set parses the clients allowed to access a Database and adds them
+// to the ones already given for it.
+func (adf aclDatabaseFlags) Set(value string) error {
+	i := strings.LastIndex(value, "=")
+	if i <= 0 {
+		return fmt.Errorf("missing database name in %q", value)
+	}
+	cidrs := strings.Split(value[i+1:], ",")
+	if _, err := parseCIDRs(cidrs); err != nil {
+		return err
+	}
+	adf[value[:i]] = append(adf[value[:i]], cidrs...)
+	return nil
+}
+
+// aclDatabases returns the names or IDs of the Databases accessed by a
+// request, as given by its path, its name parameter on creation, and
+// its to_database parameter on moves, copies and transfers.
+func aclDatabases(r *http.Request) []string {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if segments[0] != "databases" {
+		return nil
+	}
+
+	var databases []string
+	if len(segments) > 1 {
+		databases = append(databases, segments[1])
+	} else if name := r.FormValue("name"); name != "" {
+		databases = append(databases, name)
+	}
+	if to := destinationDatabase(r); to != "" {
+		databases = append(databases, to)
+	}
+	return databases
+}
+
+// allowedDatabase determines whether the client with the IP address
+// ip is allowed by the ACL of the Connection to access the Database
+// given by its ID or name.
+func (c *Conn) allowedDatabase(ip net.IP, database string) bool {
+	if db, ok := ResourceDatabase(c, database); ok {
+		database = db.Name
+	}
+	return c.ACL.Allowed(ip, database)
+}
+
+// allowedRequest determines whether the client of a request is allowed
+// by the ACL of the Connection to access pilad and the Databases of the
+// request.
+func (c *Conn) allowedRequest(r *http.Request) bool {
+	ip := net.ParseIP(remoteHost(r))
+	if !c.ACL.Allowed(ip, "") {
+		return false
+	}
+	for _, database := range aclDatabases(r) {
+		if !c.allowedDatabase(ip, database) {
+			return false
+		}
+	}
+	return true
+}
+
+// ACLMiddleware returns a middleware that answers with 403 Forbidden
+// the requests of clients that are not allowed by the ACL of the
+// Connection, before they are routed.
+func ACLMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !conn.allowedRequest(r) {
+				logResponse(r, http.StatusForbidden, "reason", "client not allowed", "client", remoteHost(r))
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// aclHandler returns the ACLRules of the Connection, and replaces
+// them on PUT with the ones of the request body, without restarting
+// pilad. Returns 400 if the rules are not valid, and 409 if they would
+// deny the client of the request, to prevent locking it out.
+func (c *Conn) aclHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "PUT" {
+		if r.Body == nil {
+			logResponse(r, http.StatusBadRequest, "reason", "no rules provided")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logResponse(r, http.StatusBadRequest, "reason", "error on reading rules", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var rules ACLRules
+		if err := json.Unmarshal(body, &rules); err != nil {
+			logResponse(r, http.StatusBadRequest, "reason", "error on decoding rules", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		acl := NewACL()
+		if err := acl.Set(rules); err != nil {
+			logResponse(r, http.StatusBadRequest, "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !acl.Allowed(net.ParseIP(remoteHost(r)), "") {
+			logResponse(r, http.StatusConflict, "reason", "rules deny client", "client", remoteHost(r))
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		// Do not check error as the rules are already validated.
+		_ = c.ACL.Set(rules)
+		logger.Info("network access rules changed", "allow", len(rules.Allow), "deny", len(rules.Deny), "databases", len(rules.Databases))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(c.ACL.Rules().ToJSON())
+}
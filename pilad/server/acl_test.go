@@ -0,0 +1,258 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestACL(t *testing.T) {
+	acl := NewACL()
+	if rules := acl.Rules(); !reflect.DeepEqual(rules, ACLRules{Allow: []string{}, Deny: []string{}, Databases: map[string][]string{}}) {
+		t.Errorf("rules are %v, expected none", rules)
+	}
+	if !acl.Allowed(net.ParseIP("10.0.0.1"), "db") || !acl.Allowed(nil, "") {
+		t.Error("client is not allowed without rules")
+	}
+
+	rules := ACLRules{
+		Allow:     []string{"10.0.0.0/8", "192.168.1.10", "::1"},
+		Deny:      []string{"10.0.0.128/25"},
+		Databases: map[string][]string{"db": {"10.0.1.0/24", "::1"}},
+	}
+	if err := acl.Set(rules); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(acl.Rules(), rules) {
+		t.Errorf("rules are %v, expected %v", acl.Rules(), rules)
+	}
+
+	inputOutput := []struct {
+		ip, database string
+		output       bool
+	}{
+		{"10.0.0.1", "", true},
+		{"10.0.0.1", "other", true},
+		{"10.0.0.1", "db", false},
+		{"10.0.1.1", "db", true},
+		{"10.0.0.200", "", false},
+		{"192.168.1.10", "", true},
+		{"192.168.1.11", "", false},
+		{"::1", "db", true},
+		{"::ffff:10.0.1.1", "db", true},
+		{"2001:db8::1", "", false},
+		{"", "", false},
+	}
+
+	for _, io := range inputOutput {
+		if allowed := acl.Allowed(net.ParseIP(io.ip), io.database); allowed != io.output {
+			t.Errorf("%s is allowed %v on %q, expected %v", io.ip, allowed, io.database, io.output)
+		}
+	}
+}
+
+func TestACL_Set_Error(t *testing.T) {
+	acl := NewACL()
+	_ = acl.Set(ACLRules{Deny: []string{"10.0.0.1"}})
+
+	inputs := []ACLRules{
+		{Allow: []string{"10.0.0.0/33"}},
+		{Deny: []string{"foo"}},
+		{Databases: map[string][]string{"db": {"10.0.0.1/x"}}},
+		{Databases: map[string][]string{"": {"10.0.0.1"}}},
+	}
+	for _, input := range inputs {
+		if err := acl.Set(input); err == nil {
+			t.Errorf("err is nil for %v", input)
+		}
+	}
+	if rules := acl.Rules(); !reflect.DeepEqual(rules.Deny, []string{"10.0.0.1"}) {
+		t.Errorf("rules are %v, expected the former ones", rules)
+	}
+}
+
+func TestACLFlags(t *testing.T) {
+	var af aclFlags
+	for _, value := range []string{"10.0.0.0/8", "::1"} {
+		if err := af.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := af.String(); s != "10.0.0.0/8,::1" {
+		t.Errorf("flags are %s, expected %s", s, "10.0.0.0/8,::1")
+	}
+	if err := af.Set("10.0.0"); err == nil {
+		t.Error("err is nil, expected error")
+	}
+
+	adf := aclDatabaseFlags{}
+	for _, value := range []string{"db=10.0.0.0/8,::1", "acme:db=192.168.1.10", "db=10.0.0.1"} {
+		if err := adf.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := aclDatabaseFlags{"db": {"10.0.0.0/8", "::1", "10.0.0.1"}, "acme:db": {"192.168.1.10"}}
+	if !reflect.DeepEqual(adf, expected) {
+		t.Errorf("flags are %v, expected %v", adf, expected)
+	}
+	for _, value := range []string{"db", "=10.0.0.1", "db=foo", "db="} {
+		if err := adf.Set(value); err == nil {
+			t.Errorf("err is nil for %s", value)
+		}
+	}
+}
+
+func TestACLMiddleware(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	_ = conn.Pila.AddDatabase(pila.NewDatabase("other"))
+	_ = conn.ACL.Set(ACLRules{
+		Deny:      []string{"192.168.0.0/16"},
+		Databases: map[string][]string{"db": {"10.0.0.1"}, "new": {"10.0.0.1"}},
+	})
+	handler := ACLMiddleware(conn)(Router(conn))
+
+	inputOutput := []struct {
+		method, path, client string
+		code                 int
+	}{
+		{"GET", "/_status", "10.0.0.2:1234", http.StatusOK},
+		{"GET", "/_status", "192.168.1.1:1234", http.StatusForbidden},
+		{"GET", "/databases/db", "10.0.0.1:1234", http.StatusOK},
+		{"GET", "/databases/db", "10.0.0.2:1234", http.StatusForbidden},
+		{"GET", "/databases/" + db.ID.String() + "/stacks", "10.0.0.2:1234", http.StatusForbidden},
+		{"GET", "/databases/other", "10.0.0.2:1234", http.StatusOK},
+		{"PUT", "/databases?name=new", "10.0.0.2:1234", http.StatusForbidden},
+		{"PUT", "/databases?name=new", "10.0.0.1:1234", http.StatusCreated},
+		{"POST", "/databases/other/stacks/stack/_move?to=stack&to_database=db", "10.0.0.2:1234", http.StatusForbidden},
+		{"GET", "/databases", "10.0.0.2:1234", http.StatusOK},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.RemoteAddr = io.client
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s from %s", response.Code, io.code, io.method, io.path, io.client)
+		}
+	}
+}
+
+func TestACLMiddleware_Form(t *testing.T) {
+	conn := NewConn()
+	other := pila.NewDatabase("other")
+	_ = conn.Pila.AddDatabase(pila.NewDatabase("db"))
+	_ = conn.Pila.AddDatabase(other)
+	_ = other.AddStack(pila.NewStack("stack", time.Now().UTC()))
+	_ = conn.ACL.Set(ACLRules{Databases: map[string][]string{"db": {"10.0.0.1"}, "new": {"10.0.0.1"}}})
+	handler := ACLMiddleware(conn)(Router(conn))
+
+	inputOutput := []struct {
+		method, path, body string
+	}{
+		{"POST", "/databases/other/stacks/stack/_move", "to=stack&to_database=db"},
+		{"POST", "/databases/other/stacks/stack/_copy", "to=stack&to_database=db"},
+		{"POST", "/databases/other/stacks/stack/_transfer", "to_database=db"},
+		{"PUT", "/databases", "name=new"},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.RemoteAddr = "10.0.0.2:1234"
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != http.StatusForbidden {
+			t.Errorf("response code is %v, expected %v for %s %s with %s", response.Code, http.StatusForbidden, io.method, io.path, io.body)
+		}
+	}
+}
+
+func TestACLHandler(t *testing.T) {
+	conn := NewConn()
+	router := Router(conn)
+
+	inputOutput := []struct {
+		method, body string
+		code         int
+		response     string
+	}{
+		{"GET", "", http.StatusOK, `{"allow":[],"deny":[],"databases":{}}`},
+		{"PUT", `{"allow":["10.0.0.0/8"],"databases":{"db":["10.0.0.1"]}}`, http.StatusOK, `{"allow":["10.0.0.0/8"],"deny":[],"databases":{"db":["10.0.0.1"]}}`},
+		{"PUT", `{"deny":["foo"]}`, http.StatusBadRequest, ""},
+		{"PUT", `{"deny":`, http.StatusBadRequest, ""},
+		{"PUT", `{"deny":["10.0.0.0/24"]}`, http.StatusConflict, ""},
+		{"GET", "", http.StatusOK, `{"allow":["10.0.0.0/8"],"deny":[],"databases":{"db":["10.0.0.1"]}}`},
+		{"PUT", `{}`, http.StatusOK, `{"allow":[],"deny":[],"databases":{}}`},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, "/_acl", strings.NewReader(io.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.RemoteAddr = "10.0.0.1:1234"
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.body)
+		}
+		if io.response == "" {
+			continue
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != io.response {
+			t.Errorf("body is %s, expected %s for %s %s", body, io.response, io.method, io.body)
+		}
+	}
+}
+
+func TestServeRESP_ACL(t *testing.T) {
+	conn := NewConn()
+	_ = conn.ACL.Set(ACLRules{Databases: map[string][]string{"db": {"10.0.0.1"}}})
+
+	client, closeClient := dialRESP(t, conn)
+	defer closeClient()
+	inputOutput := []struct {
+		input  []string
+		output string
+	}{
+		{[]string{"LPUSH", "other/stack", "foo"}, ":1"},
+		{[]string{"LPUSH", "db/stack", "foo"}, "-NOPERM this client is not allowed to access database db"},
+		{[]string{"EXISTS", "other/stack", "db/stack"}, "-NOPERM this client is not allowed to access database db"},
+	}
+	for _, io := range inputOutput {
+		output, err := client.do(io.input...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != io.output {
+			t.Errorf("output of %v is %s, expected %s", io.input, output, io.output)
+		}
+	}
+
+	_ = conn.ACL.Set(ACLRules{Deny: []string{"127.0.0.1"}})
+	denied, closeDenied := dialRESP(t, conn)
+	defer closeDenied()
+	if output, err := denied.do("PING"); err != nil || output != "-ERR client not allowed" {
+		t.Errorf("output is %s and err %v, expected %s", output, err, "-ERR client not allowed")
+	}
+}
@@ -0,0 +1,361 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// archiveIndexName is the name of the file of
+	// the index of the archived Stacks.
+	archiveIndexName = "index.json"
+	// archiveSuffix is the suffix of the archive files.
+	archiveSuffix = ".json.gz"
+)
+
+var (
+	// ErrArchivesDisabled is returned when archiving a
+	// Stack while archives are disabled.
+	ErrArchivesDisabled = errors.New("archives are disabled, set -archive-dir")
+	// ErrArchiveNotExist is returned when the archived
+	// Stack or its file do not exist.
+	ErrArchiveNotExist = errors.New("archive does not exist")
+	// ErrArchiveNameTaken is returned when archiving a Stack
+	// whose name is taken by another archived Stack, or
+	// unarchiving one whose name is taken by a Stack.
+	ErrArchiveNameTaken = errors.New("stack name is taken")
+)
+
+// ArchiveStore stores the files of the archived Stacks. Archives can
+// be kept somewhere else than a local directory, e.g. S3, plugging an
+// ArchiveStore uploading them there into the Archives.
+type ArchiveStore interface {
+	// Put stores the content of r in the file called name,
+	// replacing it if it exists.
+	Put(name string, r io.Reader) error
+	// Get returns the content of the file called name, or
+	// ErrArchiveNotExist if it does not exist.
+	Get(name string) (io.ReadCloser, error)
+	// Delete removes the file called name, if it exists.
+	Delete(name string) error
+}
+
+// DirArchiveStore is an ArchiveStore keeping the
+// files in a local directory.
+type DirArchiveStore string
+
+// Put writes the content of r into the file called name,
+// which is replaced atomically.
+func (dir DirArchiveStore) Put(name string, r io.Reader) error {
+	f, err := ioutil.TempFile(string(dir), name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(string(dir), name))
+}
+
+// Get opens the file called name.
+func (dir DirArchiveStore) Get(name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(string(dir), name))
+	if os.IsNotExist(err) {
+		return nil, ErrArchiveNotExist
+	}
+	return f, err
+}
+
+// Delete removes the file called name.
+func (dir DirArchiveStore) Delete(name string) error {
+	if err := os.Remove(filepath.Join(string(dir), name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ArchivedStack represents a Stack stored in an archive file,
+// along with its status when it was archived.
+type ArchivedStack struct {
+	Database   string           `json:"database"`
+	File       string           `json:"file"`
+	ArchivedAt time.Time        `json:"archived_at"`
+	Status     pila.StackStatus `json:"status"`
+}
+
+// Archives moves Stacks out of memory into files of an ArchiveStore,
+// and back, keeping an index of the archived Stacks in the same store.
+type Archives struct {
+	store ArchiveStore
+
+	// index maps the ArchivedStacks by the ID of their Stack
+	index map[string]ArchivedStack
+
+	// mu protects the index and serializes its writes
+	mu sync.Mutex
+}
+
+// NewArchives returns disabled Archives.
+func NewArchives() *Archives {
+	return &Archives{index: make(map[string]ArchivedStack)}
+}
+
+// Enable makes the Archives store the archived Stacks in store,
+// loading the index of the Stacks already archived there.
+func (a *Archives) Enable(store ArchiveStore) error {
+	index := make(map[string]ArchivedStack)
+	f, err := store.Get(archiveIndexName)
+	if err == nil {
+		err = json.NewDecoder(f).Decode(&index)
+		f.Close()
+	}
+	if err != nil && err != ErrArchiveNotExist {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.store, a.index = store, index
+	return nil
+}
+
+// Enabled determines whether the Archives are enabled.
+func (a *Archives) Enabled() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.store != nil
+}
+
+// Archive writes stack, of database db, into a compressed file at
+// date t, and records it in the index. The Stack is not removed
+// from db.
+func (a *Archives) Archive(db *pila.Database, stack *pila.Stack, t time.Time) (ArchivedStack, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.store == nil {
+		return ArchivedStack{}, ErrArchivesDisabled
+	}
+	if _, ok := a.find(db, stack.Name); ok {
+		return ArchivedStack{}, ErrArchiveNameTaken
+	}
+
+	archived := ArchivedStack{
+		Database:   db.ID.String(),
+		File:       db.ID.String() + "-" + stack.ID.String() + archiveSuffix,
+		ArchivedAt: t.UTC(),
+		Status:     stack.Status(),
+	}
+	archived.Status.Archived = true
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(stack.WriteArchive(pw))
+	}()
+	err := a.store.Put(archived.File, pr)
+	pr.Close()
+	if err != nil {
+		return ArchivedStack{}, err
+	}
+
+	a.index[archived.Status.ID] = archived
+	if err := a.saveIndex(); err != nil {
+		delete(a.index, archived.Status.ID)
+		_ = a.store.Delete(archived.File)
+		return ArchivedStack{}, err
+	}
+	return archived, nil
+}
+
+// Unarchive reads the Stack of db archived given its ID or name,
+// adds it to db, and forgets its archive. A Stack that spilled to
+// disk spills into spillDir, unless it is empty, and the elements of
+// an encrypted Stack are decrypted with keys.
+func (a *Archives) Unarchive(db *pila.Database, idOrName, spillDir string, keys *pila.Keyring) (*pila.Stack, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.store == nil {
+		return nil, ErrArchivesDisabled
+	}
+	archived, ok := a.find(db, idOrName)
+	if !ok {
+		return nil, ErrArchiveNotExist
+	}
+
+	f, err := a.store.Get(archived.File)
+	if err != nil {
+		return nil, err
+	}
+	stack, err := pila.ReadArchive(f, spillDir, keys)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.AddStack(stack); err != nil {
+		return nil, ErrArchiveNameTaken
+	}
+
+	delete(a.index, archived.Status.ID)
+	if err := a.saveIndex(); err != nil {
+		return stack, err
+	}
+	return stack, a.store.Delete(archived.File)
+}
+
+// Stacks returns the status of the archived Stacks of db.
+func (a *Archives) Stacks(db *pila.Database) []pila.StackStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ss := []pila.StackStatus{}
+	for _, archived := range a.index {
+		if archived.Database == db.ID.String() {
+			ss = append(ss, archived.Status)
+		}
+	}
+	return ss
+}
+
+// find returns the Stack of db archived given its ID or name.
+func (a *Archives) find(db *pila.Database, idOrName string) (ArchivedStack, bool) {
+	if archived, ok := a.index[idOrName]; ok && archived.Database == db.ID.String() {
+		return archived, true
+	}
+	for _, archived := range a.index {
+		if archived.Database == db.ID.String() && archived.Status.Name == idOrName {
+			return archived, true
+		}
+	}
+	return ArchivedStack{}, false
+}
+
+// saveIndex writes the index of the archived Stacks into the store.
+func (a *Archives) saveIndex() error {
+	// Do not check error as ArchivedStacks are
+	// always valid for a JSON encoding.
+	b, _ := json.Marshal(a.index)
+	return a.store.Put(archiveIndexName, bytes.NewReader(b))
+}
+
+// archiveStackHandler archives the Stack into a compressed file,
+// removes it from memory and returns 200 and its status, flagged
+// as archived. Returns 409 if archives are disabled or another
+// archived Stack of the database has the same name.
+func (c *Conn) archiveStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	db := stack.Database
+	if db == nil {
+		c.goneHandler(w, r, fmt.Sprintf("stack %s is Gone", stack.Name))
+		return
+	}
+
+	defer c.stackLocks.lock(stack)()
+	archived, err := c.Archives.Archive(db, stack, time.Now())
+	if err == ErrArchivesDisabled || err == ErrArchiveNameTaken {
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logResponse(r, http.StatusInternalServerError, "reason", "error on archiving stack", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_ = db.RemoveStack(stack.ID)
+	c.Webhooks.RemoveStack(stack)
+	c.persist(r.Context(), persist.Record{Op: persist.OpDeleteStack, Time: requestDate(r), Database: db.Name, Stack: stack.Name})
+
+	logResponse(r, http.StatusOK, "file", archived.File)
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as the status of
+	// the stack was encoded on archiving.
+	b, _ := archived.Status.ToJSON()
+	w.Write(b)
+}
+
+// unarchiveStackHandler restores the archived Stack given by the
+// stack_id variable into its database, and returns 200 and its
+// status. Returns 410 if there is no such archived Stack, and
+// 409 if archives are disabled or the name of the Stack is taken.
+func (c *Conn) unarchiveStackHandler(w http.ResponseWriter, r *http.Request) {
+	r = withDate(r)
+	db := databaseFromContext(r)
+	stackID := mux.Vars(r)["stack_id"]
+
+	// the ID of the archived Stack is not known until it is unarchived
+	defer c.stackLocks.lockAll()()
+	stack, err := c.Archives.Unarchive(db, stackID, c.Pila.SpillDir(), c.Pila.Keyring())
+	switch {
+	case err == ErrArchiveNotExist:
+		c.goneHandler(w, r, fmt.Sprintf("archived stack %s is Gone", stackID))
+		return
+	case err == ErrArchivesDisabled || err == ErrArchiveNameTaken:
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	case err != nil && stack == nil:
+		logResponse(r, http.StatusInternalServerError, "reason", "error on unarchiving stack", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	case err != nil:
+		logger.Warn("error on forgetting archive", "method", r.Method, "url", r.URL.String(), "error", err)
+	}
+
+	status := c.persistRestoredStack(r.Context(), stack, requestDate(r))
+
+	logResponse(r, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as the status of
+	// the stack was encoded on archiving.
+	b, _ := status.ToJSON()
+	w.Write(b)
+}
+
+// persistRestoredStack persists the creation of a Stack restored at
+// date t into its Database, along with its elements, and returns its
+// status.
+func (c *Conn) persistRestoredStack(ctx context.Context, stack *pila.Stack, t time.Time) pila.StackStatus {
+	status := stack.Status()
+	c.persistStack(ctx, stack, persist.Record{Op: persist.OpCreateStack, Time: t, Type: stack.Type, MaxSize: status.MaxSize, Policy: status.Policy, RateLimit: status.RateLimit, TTL: stack.TTL, Spill: status.Spill, Unique: status.Unique, History: status.History, Compress: status.Compress, Encrypted: status.Encrypted, Watermarks: status.Watermarks, ID: status.ID})
+	stack.ForEachElement(func(e pila.Element) bool {
+		c.persistStack(ctx, stack, persist.Record{Op: persist.OpPush, Time: t, Element: e.Value, Priority: e.Priority, ContentType: e.ContentType})
+		return true
+	})
+	return status
+}
+
+// archivedStacksStatus returns the status of the Stacks of db
+// matching opts, including the archived ones, in their order.
+func (c *Conn) archivedStacksStatus(db *pila.Database, opts pila.StacksOptions) pila.StacksStatus {
+	status := db.StacksStatus(opts)
+	for _, archived := range c.Archives.Stacks(db) {
+		if opts.Match(archived.Name) {
+			status.Stacks = append(status.Stacks, archived)
+		}
+	}
+	opts.SortStacks(status.Stacks)
+	return status
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestDirArchiveStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-archives")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := DirArchiveStore(dir)
+	if _, err := store.Get("foo"); err != ErrArchiveNotExist {
+		t.Errorf("err is %v, expected %v", err, ErrArchiveNotExist)
+	}
+	if err := store.Put("foo", strings.NewReader("bar")); err != nil {
+		t.Fatal(err)
+	}
+	f, err := store.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(f)
+	f.Close()
+	if string(b) != "bar" {
+		t.Errorf("content is %s, expected %s", b, "bar")
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.Delete("foo"); err != nil {
+			t.Errorf("err is %v, expected nil", err)
+		}
+	}
+	if _, err := store.Get("foo"); err != ErrArchiveNotExist {
+		t.Errorf("err is %v, expected %v", err, ErrArchiveNotExist)
+	}
+}
+
+func TestArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-archives")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := pila.NewDatabase("db")
+	stack := pila.NewStack("stack", time.Now().UTC())
+	stack.Push("foo")
+	_ = db.AddStack(stack)
+
+	a := NewArchives()
+	if _, err := a.Archive(db, stack, time.Now()); err != ErrArchivesDisabled {
+		t.Errorf("err is %v, expected %v", err, ErrArchivesDisabled)
+	}
+	if err := a.Enable(DirArchiveStore(dir)); err != nil {
+		t.Fatal(err)
+	}
+	archived, err := a.Archive(db, stack, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !archived.Status.Archived || archived.Status.Size != 1 {
+		t.Errorf("archived stack is %+v", archived)
+	}
+	if _, err := a.Archive(db, stack, time.Now()); err != ErrArchiveNameTaken {
+		t.Errorf("err is %v, expected %v", err, ErrArchiveNameTaken)
+	}
+	_ = db.RemoveStack(stack.ID)
+
+	// the index is loaded by other Archives
+	loaded := NewArchives()
+	if err := loaded.Enable(DirArchiveStore(dir)); err != nil {
+		t.Fatal(err)
+	}
+	if ss := loaded.Stacks(db); len(ss) != 1 || ss[0].Name != "stack" {
+		t.Fatalf("archived stacks are %+v", ss)
+	}
+	if ss := loaded.Stacks(pila.NewDatabase("other")); len(ss) != 0 {
+		t.Errorf("archived stacks are %+v, expected none", ss)
+	}
+
+	s, err := loaded.Unarchive(db, stack.ID.String(), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Database != db || s.Peek() != "foo" {
+		t.Errorf("unarchived stack is %v with peek %v", s.Name, s.Peek())
+	}
+	if _, err := loaded.Unarchive(db, "stack", "", nil); err != ErrArchiveNotExist {
+		t.Errorf("err is %v, expected %v", err, ErrArchiveNotExist)
+	}
+	if _, err := os.Stat(dir + "/" + archived.File); !os.IsNotExist(err) {
+		t.Errorf("archive file exists, expected removed: %v", err)
+	}
+}
+
+func TestArchiveStackHandlers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-archives")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	stack.Push("foo")
+	stack.Push("bar")
+	_ = db.AddStack(stack)
+	handler := Router(conn)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	if response := do("POST", "/databases/db/stacks/stack/_archive"); response.Code != http.StatusConflict {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusConflict)
+	}
+	if err := conn.Archives.Enable(DirArchiveStore(dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	inputOutput := []struct {
+		method, path string
+		code         int
+	}{
+		{"POST", "/databases/db/stacks/stack/_archive", http.StatusOK},
+		{"GET", "/databases/db/stacks/stack", http.StatusGone},
+		{"POST", "/databases/db/stacks/stack/_archive", http.StatusGone},
+		{"PUT", "/databases/db/stacks?name=stack", http.StatusCreated},
+		{"POST", "/databases/db/stacks/stack/_archive", http.StatusConflict},
+		{"POST", "/databases/db/stacks/stack/_unarchive", http.StatusConflict},
+		{"DELETE", "/databases/db/stacks/stack?full", http.StatusNoContent},
+		{"POST", "/databases/db/stacks/foo/_unarchive", http.StatusGone},
+		{"POST", "/databases/foo/stacks/stack/_unarchive", http.StatusGone},
+		{"POST", "/databases/db/stacks/stack/_unarchive", http.StatusOK},
+		{"POST", "/databases/db/stacks/stack/_unarchive", http.StatusGone},
+	}
+	for _, io := range inputOutput {
+		if response := do(io.method, io.path); response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if io.path == "/databases/db/stacks/stack/_archive" && io.code == http.StatusOK {
+			response := do("GET", "/databases/db/stacks")
+			var status pila.StacksStatus
+			if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil {
+				t.Fatal(err)
+			}
+			if len(status.Stacks) != 1 || !status.Stacks[0].Archived || status.Stacks[0].Size != 2 {
+				t.Errorf("stacks are %s, expected stack archived", response.Body.String())
+			}
+		}
+	}
+
+	unarchived, ok := db.StackByName("stack")
+	if !ok {
+		t.Fatal("stack was not unarchived")
+	}
+	if unarchived.ID.String() != stack.ID.String() || unarchived.Size() != 2 || unarchived.Peek() != "bar" {
+		t.Errorf("stack has ID %s, size %d and peek %v", unarchived.ID, unarchived.Size(), unarchived.Peek())
+	}
+	if response := do("GET", "/databases/db/stacks"); strings.Contains(response.Body.String(), "archived") {
+		t.Errorf("stacks are %s, expected none archived", response.Body.String())
+	}
+}
@@ -0,0 +1,331 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+const (
+	// auditCapacity is the number of most recent
+	// AuditEntries kept in memory.
+	auditCapacity = 10000
+	// auditMaxSizeDefault is the default size in bytes
+	// of an audit file before it is rotated.
+	auditMaxSizeDefault = 10 << 20
+	// auditKeepDefault is the default number of
+	// rotated audit files kept.
+	auditKeepDefault = 5
+)
+
+// AuditEntry represents a request modifying pilad.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Client is the IP address of the client
+	Client string `json:"client"`
+	// Token identifies the Token of the request, if any,
+	// without revealing it, see tokenFingerprint
+	Token string `json:"token,omitempty"`
+	// Op is the name of the operation, or its
+	// method and route if it has no name
+	Op       string `json:"op"`
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Database string `json:"database,omitempty"`
+	Stack    string `json:"stack,omitempty"`
+	// Status is the status code of the response,
+	// 0 for RESP commands
+	Status int `json:"status,omitempty"`
+}
+
+// AuditEntries represents a list of AuditEntry.
+type AuditEntries struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+// ToJSON converts AuditEntries into JSON.
+func (entries AuditEntries) ToJSON() []byte {
+	// Do not check error as AuditEntries do not
+	// contain types that could cause such case.
+	b, _ := json.Marshal(entries)
+	return b
+}
+
+// Audit records the requests modifying pilad. It keeps the most recent
+// AuditEntries in memory, and appends all of them as JSON lines into a
+// file if opened, rotating it once it reaches a maximum size.
+type Audit struct {
+	capacity int
+	// entries are the most recent AuditEntries,
+	// the oldest first
+	entries []AuditEntry
+
+	path    string
+	maxSize int64
+	keep    int
+	file    *os.File
+	w       *bufio.Writer
+	size    int64
+
+	mu sync.Mutex
+}
+
+// NewAudit returns an Audit keeping up to capacity AuditEntries
+// in memory, without file.
+func NewAudit(capacity int) *Audit {
+	return &Audit{capacity: capacity}
+}
+
+// Open makes the Audit append its entries into the file at path,
+// creating it if it does not exist. Once it would exceed maxSize
+// bytes, it is renamed to path.1, the former path.1 to path.2 and
+// so on, keeping up to keep rotated files.
+func (a *Audit) Open(path string, maxSize int64, keep int) error {
+	if maxSize <= 0 || keep < 1 {
+		return fmt.Errorf("invalid audit max size %d or keep %d", maxSize, keep)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.path, a.maxSize, a.keep = path, maxSize, keep
+	return a.open()
+}
+
+// open opens the file of the Audit for appending.
+func (a *Audit) open() error {
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.file, a.w, a.size = f, bufio.NewWriter(f), fi.Size()
+	return nil
+}
+
+// rotate closes the file of the Audit, shifts the rotated
+// files, and opens a new file.
+func (a *Audit) rotate() error {
+	if err := a.close(); err != nil {
+		return err
+	}
+	for i := a.keep - 1; i > 0; i-- {
+		from := fmt.Sprintf("%s.%d", a.path, i)
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", a.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(a.path, a.path+".1"); err != nil {
+		return err
+	}
+	return a.open()
+}
+
+// Record adds an AuditEntry, forgetting the oldest one kept in memory
+// if the Audit is full. Errors on writing into the file are logged.
+func (a *Audit) Record(entry AuditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.entries = append(a.entries, entry)
+	if len(a.entries) > a.capacity {
+		a.entries = a.entries[len(a.entries)-a.capacity:]
+	}
+
+	if a.file == nil {
+		return
+	}
+	// Do not check error as an AuditEntry does not
+	// contain types that could cause such case.
+	line, _ := json.Marshal(entry)
+	line = append(line, '\n')
+	if a.size > 0 && a.size+int64(len(line)) > a.maxSize {
+		if err := a.rotate(); err != nil {
+			logger.Error("error on rotating audit file", "error", err)
+			return
+		}
+	}
+	if _, err := a.w.Write(line); err != nil {
+		logger.Error("error on writing audit file", "error", err)
+		return
+	}
+	a.size += int64(len(line))
+	if err := a.w.Flush(); err != nil {
+		logger.Error("error on writing audit file", "error", err)
+	}
+}
+
+// Since returns up to the limit most recent AuditEntries kept in
+// memory recorded at or after t, the oldest first.
+func (a *Audit) Since(t time.Time, limit int) AuditEntries {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := len(a.entries)
+	for i > 0 && len(a.entries)-i < limit && !a.entries[i-1].Time.Before(t) {
+		i--
+	}
+	return AuditEntries{Entries: append([]AuditEntry{}, a.entries[i:]...)}
+}
+
+// Close closes the file of the Audit, if any.
+func (a *Audit) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.close()
+}
+
+// close flushes and closes the file of the Audit, if any.
+func (a *Audit) close() error {
+	if a.file == nil {
+		return nil
+	}
+	err := a.w.Flush()
+	if cerr := a.file.Close(); err == nil {
+		err = cerr
+	}
+	a.file, a.w = nil, nil
+	return err
+}
+
+// tokenFingerprint returns the first 12 hexadecimal digits of the
+// SHA-256 hash of token, which identifies it in the AuditEntries
+// without revealing it, or an empty string if there is no token.
+func tokenFingerprint(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// remoteHost returns the IP address of the client of a request.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// auditOp returns the name of the operation of a request given its
+// method and route, or its method and route if it has no name.
+func auditOp(r *http.Request, route string) string {
+	switch r.Method + " " + route {
+	case "PUT /databases":
+		return "create_database"
+	case "DELETE /databases/{database_id}":
+		return "delete_database"
+	case "PATCH /databases/{database_id}":
+		return "rename_database"
+	case "DELETE /databases/{database_id}/_flush":
+		return "flush_database"
+	case "PUT /databases/{database_id}/stacks":
+		return "create_stack"
+	case "POST /databases/{database_id}/stacks/{stack_id}":
+		return "push"
+	case "PATCH /databases/{database_id}/stacks/{stack_id}":
+		return "rename_stack"
+	case "DELETE /databases/{database_id}/stacks/{stack_id}":
+		query := r.URL.Query()
+		if _, ok := query["flush"]; ok {
+			return "flush_stack"
+		}
+		if _, ok := query["full"]; ok {
+			return "delete_stack"
+		}
+		return "pop"
+	}
+	if route == "" {
+		route = r.URL.Path
+	}
+	return r.Method + " " + route
+}
+
+// AuditMiddleware returns a middleware that records into the Audit of
+// the Connection every request modifying pilad, along with its client,
+// the requested Database and Stack IDs or names, and the status code
+// of its response, whether it succeeded or not. It must be chained
+// before AuthMiddleware, so rejected requests are recorded too.
+func AuditMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isMutating(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rl, ok := r.Context().Value(requestLogKey).(*requestLog)
+			if !ok {
+				rl = &requestLog{}
+				r = r.WithContext(context.WithValue(r.Context(), requestLogKey, rl))
+			}
+			mw := &metricsResponseWriter{ResponseWriter: w, code: http.StatusOK}
+			now := time.Now().UTC()
+			next.ServeHTTP(mw, r)
+
+			conn.Audit.Record(AuditEntry{
+				Time:     now,
+				Client:   remoteHost(r),
+				Token:    tokenFingerprint(requestToken(r)),
+				Op:       auditOp(r, rl.route),
+				Method:   r.Method,
+				Path:     r.URL.Path,
+				Database: rl.database,
+				Stack:    rl.stack,
+				Status:   mw.code,
+			})
+		})
+	}
+}
+
+// auditHandler returns the most recent AuditEntries recorded since the
+// date given by the since parameter, either as an RFC 3339 date or as a
+// duration before now, and up to limit. Returns 400 if any of them is
+// invalid.
+func (c *Conn) auditHandler(w http.ResponseWriter, r *http.Request) {
+	limit, err := intParam(r, "limit", elementsLimitDefault, auditCapacity)
+	var since time.Time
+	if err == nil {
+		since, err = sinceParam(r, time.Now())
+	}
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(c.Audit.Since(since, limit).ToJSON())
+}
+
+// sinceParam returns the date given by the since parameter of a
+// request, as an RFC 3339 date or as a positive duration before now.
+// It returns the zero date if the parameter is not present.
+func sinceParam(r *http.Request, now time.Time) (time.Time, error) {
+	value := r.FormValue("since")
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("since must be an RFC 3339 date or a positive duration, got %s", value)
+}
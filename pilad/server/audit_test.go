@@ -0,0 +1,281 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestAudit_Since(t *testing.T) {
+	audit := NewAudit(3)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		audit.Record(AuditEntry{Time: now.Add(time.Duration(i) * time.Second), Op: strconv.Itoa(i)})
+	}
+
+	inputOutput := []struct {
+		since time.Time
+		limit int
+		ops   []string
+	}{
+		{time.Time{}, 10, []string{"2", "3", "4"}},
+		{time.Time{}, 2, []string{"3", "4"}},
+		{now.Add(3 * time.Second), 10, []string{"3", "4"}},
+		{now.Add(time.Minute), 10, []string{}},
+	}
+
+	for _, io := range inputOutput {
+		ops := []string{}
+		for _, entry := range audit.Since(io.since, io.limit).Entries {
+			ops = append(ops, entry.Op)
+		}
+		if !reflect.DeepEqual(ops, io.ops) {
+			t.Errorf("ops since %v up to %d are %v, expected %v", io.since, io.limit, ops, io.ops)
+		}
+	}
+}
+
+func TestAudit_Open(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	entry := AuditEntry{Time: time.Now().UTC(), Client: "127.0.0.1", Op: "push", Method: "POST", Path: "/databases/db/stacks/stack", Status: 200}
+	line, _ := json.Marshal(entry)
+	audit := NewAudit(10)
+	if err := audit.Open(path, int64(2*len(line)+2), 2); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		audit.Record(entry)
+	}
+	if err := audit.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []struct {
+		name  string
+		lines int
+	}{
+		{"audit.log", 1},
+		{"audit.log.1", 2},
+		{"audit.log.2", 2},
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Count(string(b), "\n"); lines != f.lines {
+			t.Errorf("%s has %d lines, expected %d", f.name, lines, f.lines)
+		}
+		var e AuditEntry
+		if err := json.Unmarshal(bytes.SplitN(b, []byte("\n"), 2)[0], &e); err != nil || e.Op != "push" {
+			t.Errorf("%s entry is %v, expected %v", f.name, e, entry)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "audit.log.3")); !os.IsNotExist(err) {
+		t.Errorf("audit.log.3 exists, expected only %d rotated files", 2)
+	}
+}
+
+func TestAudit_Open_Error(t *testing.T) {
+	audit := NewAudit(10)
+	if err := audit.Open("audit.log", 0, 1); err == nil {
+		t.Error("err is nil, expected invalid max size")
+	}
+	if err := audit.Open("audit.log", 1024, 0); err == nil {
+		t.Error("err is nil, expected invalid keep")
+	}
+	if err := audit.Open("/nonexistent/audit.log", 1024, 1); err == nil {
+		t.Error("err is nil, expected file not found")
+	}
+	if err := audit.Close(); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+}
+
+func TestTokenFingerprint(t *testing.T) {
+	if f := tokenFingerprint(""); f != "" {
+		t.Errorf("fingerprint is %s, expected none", f)
+	}
+	// sha256("secret") = 2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b
+	if f := tokenFingerprint("secret"); f != "2bb80d537b1d" {
+		t.Errorf("fingerprint is %s, expected %s", f, "2bb80d537b1d")
+	}
+}
+
+func TestAuditOp(t *testing.T) {
+	inputOutput := []struct {
+		method, path, route string
+		output              string
+	}{
+		{"PUT", "/databases?name=db", "/databases", "create_database"},
+		{"DELETE", "/databases/db", "/databases/{database_id}", "delete_database"},
+		{"PATCH", "/databases/db", "/databases/{database_id}", "rename_database"},
+		{"DELETE", "/databases/db/_flush", "/databases/{database_id}/_flush", "flush_database"},
+		{"PUT", "/databases/db/stacks?name=s", "/databases/{database_id}/stacks", "create_stack"},
+		{"POST", "/databases/db/stacks/s", "/databases/{database_id}/stacks/{stack_id}", "push"},
+		{"DELETE", "/databases/db/stacks/s", "/databases/{database_id}/stacks/{stack_id}", "pop"},
+		{"DELETE", "/databases/db/stacks/s?flush", "/databases/{database_id}/stacks/{stack_id}", "flush_stack"},
+		{"DELETE", "/databases/db/stacks/s?full", "/databases/{database_id}/stacks/{stack_id}", "delete_stack"},
+		{"PATCH", "/databases/db/stacks/s", "/databases/{database_id}/stacks/{stack_id}", "rename_stack"},
+		{"POST", "/_snapshot", "/_snapshot", "POST /_snapshot"},
+		{"POST", "/unknown", "", "POST /unknown"},
+	}
+
+	for _, io := range inputOutput {
+		r, _ := http.NewRequest(io.method, io.path, nil)
+		if op := auditOp(r, io.route); op != io.output {
+			t.Errorf("op of %s %s is %s, expected %s", io.method, io.path, op, io.output)
+		}
+	}
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	conn := NewConn()
+	_ = conn.Auth.Add(Token{Token: "secret", Role: RoleReadWrite})
+	handler := AuditMiddleware(conn)(AuthMiddleware(conn)(Router(conn)))
+
+	requests := []struct {
+		method, path, token, body string
+	}{
+		{"PUT", "/databases?name=db", "secret", ""},
+		{"PUT", "/databases/db/stacks?name=stack", "secret", ""},
+		{"POST", "/databases/db/stacks/stack", "secret", `{"element":"foo"}`},
+		{"GET", "/databases/db/stacks/stack", "secret", ""},
+		{"DELETE", "/databases/db/stacks/stack", "secret", ""},
+		{"POST", "/databases/db/stacks/stack", "", `{"element":"foo"}`},
+	}
+	for _, req := range requests {
+		request, _ := http.NewRequest(req.method, req.path, bytes.NewBufferString(req.body))
+		request.RemoteAddr = "10.0.0.1:1234"
+		if req.token != "" {
+			request.Header.Set("Authorization", "Bearer "+req.token)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	fingerprint := tokenFingerprint("secret")
+	expected := []AuditEntry{
+		{Client: "10.0.0.1", Token: fingerprint, Op: "create_database", Method: "PUT", Path: "/databases", Status: http.StatusCreated},
+		{Client: "10.0.0.1", Token: fingerprint, Op: "create_stack", Method: "PUT", Path: "/databases/db/stacks", Database: "db", Status: http.StatusCreated},
+		{Client: "10.0.0.1", Token: fingerprint, Op: "push", Method: "POST", Path: "/databases/db/stacks/stack", Database: "db", Stack: "stack", Status: http.StatusOK},
+		{Client: "10.0.0.1", Token: fingerprint, Op: "pop", Method: "DELETE", Path: "/databases/db/stacks/stack", Database: "db", Stack: "stack", Status: http.StatusOK},
+		{Client: "10.0.0.1", Op: "POST /databases/db/stacks/stack", Method: "POST", Path: "/databases/db/stacks/stack", Status: http.StatusUnauthorized},
+	}
+
+	entries := conn.Audit.Since(time.Time{}, auditCapacity).Entries
+	for i := range entries {
+		if entries[i].Time.IsZero() {
+			t.Errorf("entry %d has no time", i)
+		}
+		entries[i].Time = time.Time{}
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("entries are %+v, expected %+v", entries, expected)
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	conn := NewConn()
+	now := time.Now().UTC()
+	conn.Audit.Record(AuditEntry{Time: now.Add(-time.Hour), Op: "create_database"})
+	conn.Audit.Record(AuditEntry{Time: now, Op: "push"})
+
+	inputOutput := []struct {
+		query string
+		code  int
+		ops   []string
+	}{
+		{"", http.StatusOK, []string{"create_database", "push"}},
+		{"?limit=1", http.StatusOK, []string{"push"}},
+		{"?since=10m", http.StatusOK, []string{"push"}},
+		{"?since=" + now.Add(-2*time.Hour).Format(time.RFC3339), http.StatusOK, []string{"create_database", "push"}},
+		{"?since=yesterday", http.StatusBadRequest, nil},
+		{"?since=-1h", http.StatusBadRequest, nil},
+		{"?limit=0", http.StatusBadRequest, nil},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest("GET", "/_audit"+io.query, nil)
+		response := httptest.NewRecorder()
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("%s: response code is %v, expected %v", io.query, response.Code, io.code)
+		}
+		if io.code != http.StatusOK {
+			continue
+		}
+		var entries AuditEntries
+		if err := json.Unmarshal(response.Body.Bytes(), &entries); err != nil {
+			t.Fatal(err)
+		}
+		ops := []string{}
+		for _, entry := range entries.Entries {
+			ops = append(ops, entry.Op)
+		}
+		if !reflect.DeepEqual(ops, io.ops) {
+			t.Errorf("%s: ops are %v, expected %v", io.query, ops, io.ops)
+		}
+	}
+}
+
+func TestAuditHandler_Admin(t *testing.T) {
+	conn := NewConn()
+	_ = conn.Auth.Add(Token{Token: "admin", Role: RoleAdmin})
+	_ = conn.Auth.Add(Token{Token: "writer", Role: RoleReadWrite})
+	handler := AuthMiddleware(conn)(Router(conn))
+
+	for token, code := range map[string]int{"admin": http.StatusOK, "writer": http.StatusForbidden} {
+		request, _ := http.NewRequest("GET", "/_audit", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != code {
+			t.Errorf("response code of %s is %v, expected %v", token, response.Code, code)
+		}
+	}
+}
+
+func TestServeRESP_Audit(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	client, closeRESP := dialRESP(t, conn)
+	defer closeRESP()
+
+	for _, args := range [][]string{{"LPUSH", "db/stack", "foo"}, {"LLEN", "db/stack"}, {"DEL", "db/stack", "db/other"}} {
+		if _, err := client.do(args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []AuditEntry{
+		{Client: "127.0.0.1", Op: "lpush", Method: "RESP", Path: "db/stack", Database: "db", Stack: "stack"},
+		{Client: "127.0.0.1", Op: "del", Method: "RESP", Path: "db/stack", Database: "db", Stack: "stack"},
+		{Client: "127.0.0.1", Op: "del", Method: "RESP", Path: "db/other", Database: "db", Stack: "other"},
+	}
+	entries := conn.Audit.Since(time.Time{}, auditCapacity).Entries
+	for i := range entries {
+		entries[i].Time = time.Time{}
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("entries are %+v, expected %+v", entries, expected)
+	}
+}
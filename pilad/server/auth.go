@@ -0,0 +1,373 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Role represents the operations a Token is allowed to perform.
+type Role string
+
+const (
+	// RoleRead allows reading the scoped Databases.
+	RoleRead Role = "read"
+	// RoleReadWrite allows reading and modifying the scoped Databases.
+	RoleReadWrite Role = "read_write"
+	// RoleAdmin allows every operation, including the
+	// administration of pilad and its Tokens.
+	RoleAdmin Role = "admin"
+)
+
+// Token represents an API token and its permissions.
+type Token struct {
+	Token string `json:"token"`
+	Role  Role   `json:"role"`
+	// Databases are the names of the Databases the Token
+	// has access to, all of them if empty
+	Databases []string `json:"databases,omitempty"`
+	// Tenant is the name of the tenant of the Token, which
+	// confines it to the Databases of the tenant, if any
+	Tenant string `json:"tenant,omitempty"`
+	// KeyID identifies the Token if it is a database key, see
+	// DatabaseKey, which is confined to the Database whose ID
+	// is Database, even with the admin role
+	KeyID     string     `json:"key_id,omitempty"`
+	Database  string     `json:"database,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// Validate returns an error if the Token is not valid.
+func (t Token) Validate() error {
+	if t.Token == "" {
+		return fmt.Errorf("missing token")
+	}
+	if t.KeyID != "" && t.Database == "" {
+		return fmt.Errorf("missing database of key %s", t.KeyID)
+	}
+	if t.Tenant != "" {
+		if err := validateTenantName(t.Tenant); err != nil {
+			return err
+		}
+		if t.Role == RoleAdmin && t.KeyID == "" {
+			return fmt.Errorf("token of tenant %s can not have the %s role", t.Tenant, RoleAdmin)
+		}
+	}
+	switch t.Role {
+	case RoleRead, RoleReadWrite, RoleAdmin:
+		return nil
+	}
+	return fmt.Errorf("invalid role %q, must be %s, %s or %s", t.Role, RoleRead, RoleReadWrite, RoleAdmin)
+}
+
+// canAccess determines whether the Token has access to the Database
+// of p identified by databaseID, either its ID or its name. Databases
+// of a tenant are identified by their name within it.
+func (t Token) canAccess(p *pila.Pila, databaseID string) bool {
+	if t.KeyID != "" {
+		return t.canAccessKey(p, databaseID)
+	}
+	if len(t.Databases) == 0 {
+		return true
+	}
+	if db, ok := p.Database(uuid.UUID(databaseID)); ok {
+		databaseID = db.Name
+	}
+	for _, name := range t.Databases {
+		if t.Tenant != "" && databaseID == namespace(t.Tenant, name) {
+			return true
+		}
+		if databaseID == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Auth contains the API Tokens accepted by pilad. Authentication
+// is disabled as long as Auth contains no Tokens.
+type Auth struct {
+	tokens map[string]Token
+
+	// mu protects the access to tokens
+	mu sync.RWMutex
+}
+
+// NewAuth returns a new Auth without Tokens.
+func NewAuth() *Auth {
+	return &Auth{tokens: make(map[string]Token)}
+}
+
+// Add adds a Token to Auth, replacing the
+// existing one with the same value.
+func (a *Auth) Add(t Token) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tokens[t.Token] = t
+	return nil
+}
+
+// Remove removes a Token from Auth. It returns
+// false if the Token did not exist.
+func (a *Auth) Remove(token string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.tokens[token]; !ok {
+		return false
+	}
+	delete(a.tokens, token)
+	return true
+}
+
+// Token returns the Token with the given value and true,
+// or false if it does not exist.
+func (a *Auth) Token(token string) (Token, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	t, ok := a.tokens[token]
+	return t, ok
+}
+
+// Tokens returns all Tokens, sorted by value.
+func (a *Auth) Tokens() []Token {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	values := make([]string, 0, len(a.tokens))
+	for value := range a.tokens {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	tokens := make([]Token, len(values))
+	for i, value := range values {
+		tokens[i] = a.tokens[value]
+	}
+	return tokens
+}
+
+// Enabled determines whether authentication is enabled.
+func (a *Auth) Enabled() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.tokens) > 0
+}
+
+// authTokens implements flag.Value to parse a list of Tokens given
+// as "token:role[:database,...[:tenant]]", like
+// -token=s3cr3t:admin -token=r34d:read:db1,db2 -token=4cm3:read_write::acme
+type authTokens []Token
+
+// String returns the Tokens as a comma-separated list of
+// "token:role" pairs, omitting their Databases.
+func (at *authTokens) String() string {
+	tokens := make([]string, 0, len(*at))
+	for _, t := range *at {
+		tokens = append(tokens, fmt.Sprintf("%s:%s", t.Token, t.Role))
+	}
+	return strings.Join(tokens, ",")
+}
+
+// Set parses a Token and appends it to the list.
+func (at *authTokens) Set(value string) error {
+	parts := strings.SplitN(value, ":", 4)
+	if len(parts) < 2 {
+		return fmt.Errorf("missing role in %q", value)
+	}
+
+	t := Token{Token: parts[0], Role: Role(parts[1])}
+	if len(parts) >= 3 && parts[2] != "" {
+		t.Databases = strings.Split(parts[2], ",")
+	}
+	if len(parts) == 4 {
+		t.Tenant = parts[3]
+	}
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	*at = append(*at, t)
+	return nil
+}
+
+// requestToken returns the token of a request, given either as
+// "Authorization: Bearer TOKEN" or as the password of basic auth.
+func requestToken(r *http.Request) string {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+
+	const prefix = "Bearer "
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, prefix) {
+		return strings.TrimSpace(header[len(prefix):])
+	}
+	return ""
+}
+
+// requiredAccess returns the Role needed to perform a request, and
+// the ID or name of the Database it accesses, empty if none.
+func requiredAccess(r *http.Request) (Role, string) {
+	write := isMutating(r.Method)
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case segments[0] == "databases" && len(segments) > 2 && segments[2] == "_keys":
+		return RoleAdmin, segments[1]
+	case segments[0] == "databases" && len(segments) == 1 && r.FormValue("remote") != "":
+		return RoleAdmin, ""
+	case segments[0] == "databases" && len(segments) > 1:
+		if write {
+			return RoleReadWrite, segments[1]
+		}
+		return RoleRead, segments[1]
+	case segments[0] == "databases":
+		if write {
+			return RoleReadWrite, r.FormValue("name")
+		}
+		return RoleRead, ""
+	case segments[0] == "_tokens", segments[0] == "_tenants", segments[0] == "_replication", segments[0] == "_audit", segments[0] == "_encryption", segments[0] == "_acl", segments[0] == "_trash", segments[0] == "_remotes", segments[0] == "_debug", segments[0] == "debug", write:
+		return RoleAdmin, ""
+	}
+	return RoleRead, ""
+}
+
+// canAccessDestination determines whether the Token has access to the
+// Database given by the to_database parameter of a request, which is
+// the destination of elements moved or copied between Stacks, or of a
+// transferred Stack.
+func canAccessDestination(t Token, p *pila.Pila, r *http.Request) bool {
+	databaseID := destinationDatabase(r)
+	return databaseID == "" || t.canAccess(p, databaseID)
+}
+
+// allows determines whether role grants the required Role.
+func (role Role) allows(required Role) bool {
+	switch required {
+	case RoleRead:
+		return true
+	case RoleReadWrite:
+		return role == RoleReadWrite || role == RoleAdmin
+	}
+	return role == RoleAdmin
+}
+
+// AuthMiddleware authenticates the requests with the Tokens of the
+// Connection, and authorizes them depending on the Role and the
+// Databases of their Token. It responds 401 Unauthorized to requests
+// without a valid Token, and 403 Forbidden to the ones not allowed
+// by it, including the requests of a database key out of its Database.
+// Every request is served if no Token exists, and so are the web UI,
+// which contains no data and sends the Token typed in it, and the
+// liveness and readiness probes.
+func AuthMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !conn.Auth.Enabled() || (r.Method == "GET" && r.URL.Path == "/_ui") || isProbe(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, ok := conn.Auth.Token(requestToken(r))
+			if !ok {
+				logResponse(r, http.StatusUnauthorized, "reason", "missing or invalid token")
+				w.Header().Set("WWW-Authenticate", `Bearer realm="piladb"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			role, databaseID := requiredAccess(r)
+			if token.KeyID != "" && !accessesDatabase(r) {
+				logResponse(r, http.StatusForbidden, "reason", "key confined to its database")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if !token.Role.allows(role) || (databaseID != "" && !token.canAccess(conn.Pila, databaseID)) ||
+				!canAccessDestination(token, conn.Pila, r) {
+				logResponse(r, http.StatusForbidden, "reason", "token not allowed")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tokensHandler writes the Tokens of the Connection into the
+// response on GET, and adds the Token of the request body on POST.
+func (c *Conn) tokensHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		c.addTokenHandler(w, r)
+		return
+	}
+
+	// Do not check error as a list of Tokens
+	// is always valid for a JSON encoding.
+	b, _ := json.Marshal(map[string][]Token{"tokens": c.Auth.Tokens()})
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(b)
+}
+
+// addTokenHandler adds the Token of the request body.
+func (c *Conn) addTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		logResponse(r, http.StatusBadRequest, "reason", "no token provided")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on reading token", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var t Token
+	if err := json.Unmarshal(body, &t); err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on decoding token", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := c.Auth.Add(t); err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	b, _ := json.Marshal(t)
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusCreated)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(b)
+}
+
+// tokenHandler removes the Token given in the URL.
+func (c *Conn) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+	if !c.Auth.Remove(token) {
+		c.goneHandler(w, r, "token is Gone")
+		return
+	}
+
+	logResponse(r, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestToken_Validate(t *testing.T) {
+	inputOutput := []struct {
+		input  Token
+		output bool
+	}{
+		{Token{Token: "foo", Role: RoleRead}, true},
+		{Token{Token: "foo", Role: RoleReadWrite, Databases: []string{"db"}}, true},
+		{Token{Token: "foo", Role: RoleAdmin}, true},
+		{Token{Token: "", Role: RoleAdmin}, false},
+		{Token{Token: "foo", Role: "root"}, false},
+		{Token{Token: "foo"}, false},
+		{Token{Token: "foo", Role: RoleReadWrite, Tenant: "acme"}, true},
+		{Token{Token: "foo", Role: RoleAdmin, Tenant: "acme"}, false},
+		{Token{Token: "foo", Role: RoleRead, Tenant: "ac:me"}, false},
+		{Token{Token: "foo", Role: RoleAdmin, Tenant: "acme", KeyID: "k", Database: "id"}, true},
+		{Token{Token: "foo", Role: RoleRead, KeyID: "k"}, false},
+	}
+
+	for _, io := range inputOutput {
+		if err := io.input.Validate(); (err == nil) != io.output {
+			t.Errorf("valid is %v, expected %v for %v", err == nil, io.output, io.input)
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	auth := NewAuth()
+	if auth.Enabled() {
+		t.Error("auth is enabled")
+	}
+
+	if err := auth.Add(Token{Token: "foo", Role: "root"}); err == nil {
+		t.Error("err is nil")
+	}
+	if err := auth.Add(Token{Token: "foo", Role: RoleRead}); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.Add(Token{Token: "bar", Role: RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	if !auth.Enabled() {
+		t.Error("auth is not enabled")
+	}
+
+	expected := []Token{{Token: "bar", Role: RoleAdmin}, {Token: "foo", Role: RoleRead}}
+	if tokens := auth.Tokens(); !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("tokens are %v, expected %v", tokens, expected)
+	}
+	if token, ok := auth.Token("foo"); !ok || token.Role != RoleRead {
+		t.Errorf("token is %v, %v, expected %v, %v", token, ok, expected[1], true)
+	}
+
+	if !auth.Remove("foo") {
+		t.Error("token foo was not removed")
+	}
+	if auth.Remove("foo") {
+		t.Error("token foo was removed twice")
+	}
+	if _, ok := auth.Token("foo"); ok {
+		t.Error("token foo exists")
+	}
+}
+
+func TestAuthTokens(t *testing.T) {
+	var at authTokens
+	for _, value := range []string{"foo:admin", "bar:read:db1,db2", "baz:read_write::acme"} {
+		if err := at.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := authTokens{
+		{Token: "foo", Role: RoleAdmin},
+		{Token: "bar", Role: RoleRead, Databases: []string{"db1", "db2"}},
+		{Token: "baz", Role: RoleReadWrite, Tenant: "acme"},
+	}
+	if !reflect.DeepEqual(at, expected) {
+		t.Errorf("tokens are %v, expected %v", at, expected)
+	}
+	if s := at.String(); s != "foo:admin,bar:read,baz:read_write" {
+		t.Errorf("tokens are %s, expected %s", s, "foo:admin,bar:read,baz:read_write")
+	}
+
+	for _, value := range []string{"foo", ":read", "foo:root", "foo:admin::acme", "foo:read::a:b"} {
+		if err := at.Set(value); err == nil {
+			t.Errorf("err is nil for %s", value)
+		}
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	_ = conn.Pila.AddDatabase(pila.NewDatabase("other"))
+	_ = db.AddStack(pila.NewStack("stack", time.Now().UTC()))
+	_ = conn.Auth.Add(Token{Token: "admin", Role: RoleAdmin})
+	_ = conn.Auth.Add(Token{Token: "writer", Role: RoleReadWrite, Databases: []string{"db"}})
+	_ = conn.Auth.Add(Token{Token: "reader", Role: RoleRead})
+	handler := AuthMiddleware(conn)(Router(conn))
+
+	inputOutput := []struct {
+		method, path, token string
+		output              int
+	}{
+		{"GET", "/_status", "", http.StatusUnauthorized},
+		{"GET", "/_status", "foo", http.StatusUnauthorized},
+		{"GET", "/_status", "reader", http.StatusOK},
+		{"GET", "/databases/db/stacks", "reader", http.StatusOK},
+		{"GET", "/databases/other/stacks", "reader", http.StatusOK},
+		{"POST", "/databases/db/stacks/stack", "reader", http.StatusForbidden},
+		{"POST", "/databases/db/stacks/stack", "writer", http.StatusOK},
+		{"GET", "/databases/" + db.ID.String() + "/stacks", "writer", http.StatusOK},
+		{"GET", "/databases/other/stacks", "writer", http.StatusForbidden},
+		{"PUT", "/databases?name=other2", "writer", http.StatusForbidden},
+		{"PUT", "/databases?name=db", "writer", http.StatusConflict},
+		{"POST", "/databases/db/stacks/stack/_copy?to=stack&to_database=db", "writer", http.StatusBadRequest},
+		{"POST", "/databases/db/stacks/stack/_copy?to=stack&to_database=other", "writer", http.StatusForbidden},
+		{"POST", "/_snapshot", "writer", http.StatusForbidden},
+		{"GET", "/_tokens", "reader", http.StatusForbidden},
+		{"GET", "/_tokens", "admin", http.StatusOK},
+		{"GET", "/_replication", "reader", http.StatusForbidden},
+		{"GET", "/_encryption", "writer", http.StatusForbidden},
+		{"GET", "/_encryption", "admin", http.StatusOK},
+		{"PUT", "/_acl", "writer", http.StatusForbidden},
+		{"GET", "/_trash", "reader", http.StatusForbidden},
+		{"GET", "/_trash", "admin", http.StatusOK},
+		{"GET", "/_debug", "writer", http.StatusForbidden},
+		{"GET", "/debug/vars", "writer", http.StatusForbidden},
+		{"GET", "/_debug", "admin", http.StatusOK},
+		{"DELETE", "/databases/other", "admin", http.StatusNoContent},
+		{"GET", "/_ui", "", http.StatusOK},
+		{"GET", "/_health", "", http.StatusOK},
+		{"HEAD", "/_ready", "", http.StatusServiceUnavailable},
+		{"DELETE", "/_health", "", http.StatusUnauthorized},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, strings.NewReader(`{"element":"foo"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if io.token != "" {
+			request.Header.Set("Authorization", "Bearer "+io.token)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.output {
+			t.Errorf("response code is %v, expected %v for %s %s with %s", response.Code, io.output, io.method, io.path, io.token)
+		}
+	}
+
+	request, _ := http.NewRequest("GET", "/_status", nil)
+	request.SetBasicAuth("piladb", "reader")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+}
+
+func TestAuthMiddleware_Form(t *testing.T) {
+	conn := NewConn()
+	mine, secret := pila.NewDatabase("mine"), pila.NewDatabase("secret")
+	_ = conn.Pila.AddDatabase(mine)
+	_ = conn.Pila.AddDatabase(secret)
+	stack := pila.NewStack("a", time.Now().UTC())
+	_ = mine.AddStack(stack)
+	_ = secret.AddStack(pila.NewStack("b", time.Now().UTC()))
+	stack.Push("foo")
+	_ = conn.Auth.Add(Token{Token: "writer", Role: RoleReadWrite, Databases: []string{"mine"}})
+	handler := AuthMiddleware(conn)(Router(conn))
+
+	inputOutput := []struct {
+		method, path, body string
+		output             int
+	}{
+		{"POST", "/databases/mine/stacks/a/_transfer", "to_database=secret", http.StatusForbidden},
+		{"POST", "/databases/mine/stacks/a/_move", "to=b&to_database=secret", http.StatusForbidden},
+		{"POST", "/databases/mine/stacks/a/_copy", "to=b&to_database=secret", http.StatusForbidden},
+		{"PUT", "/databases", "name=notmine", http.StatusForbidden},
+		{"PUT", "/databases", "name=mine&remote=http://127.0.0.1:1/", http.StatusForbidden},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "Bearer writer")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.output {
+			t.Errorf("response code is %v, expected %v for %s %s with %s", response.Code, io.output, io.method, io.path, io.body)
+		}
+	}
+
+	if _, ok := mine.StackByName("a"); !ok || secret.Status().NumberStacks != 1 {
+		t.Error("stack was transferred to secret")
+	}
+	if b, _ := secret.StackByName("b"); stack.Size() != 1 || b.Size() != 0 {
+		t.Error("elements were moved or copied to secret")
+	}
+	if _, ok := conn.Pila.DatabaseByName("notmine"); ok {
+		t.Error("database notmine created")
+	}
+}
+
+func TestAuthMiddleware_Disabled(t *testing.T) {
+	conn := NewConn()
+	handler := AuthMiddleware(conn)(Router(conn))
+
+	request, _ := http.NewRequest("GET", "/_status", nil)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+}
+
+func TestTokensHandler(t *testing.T) {
+	conn := NewConn()
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path, body string
+		code               int
+		response           string
+	}{
+		{"GET", "/_tokens", "", http.StatusOK, `{"tokens":[]}`},
+		{"POST", "/_tokens", `{"token":"foo","role":"read","databases":["db"]}`, http.StatusCreated,
+			`{"token":"foo","role":"read","databases":["db"]}`},
+		{"POST", "/_tokens", `{"token":"bar","role":"root"}`, http.StatusBadRequest, ""},
+		{"POST", "/_tokens", `{"token":`, http.StatusBadRequest, ""},
+		{"GET", "/_tokens", "", http.StatusOK, `{"tokens":[{"token":"foo","role":"read","databases":["db"]}]}`},
+		{"DELETE", "/_tokens/foo", "", http.StatusNoContent, ""},
+		{"DELETE", "/_tokens/foo", "", http.StatusGone, ""},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if body := response.Body.String(); body != io.response {
+			t.Errorf("response is %s, expected %s", body, io.response)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+const (
+	// benchmarkOpsDefault is the default number of elements
+	// pushed and popped by a benchmark.
+	benchmarkOpsDefault = 10000
+	// benchmarkOpsMax is the maximum number of elements
+	// pushed and popped by a benchmark.
+	benchmarkOpsMax = 1000000
+	// benchmarkWorkersDefault is the default number of
+	// goroutines running a benchmark.
+	benchmarkWorkersDefault = 4
+	// benchmarkWorkersMax is the maximum number of
+	// goroutines running a benchmark.
+	benchmarkWorkersMax = 256
+)
+
+// BenchmarkResult represents the throughput of a Stack
+// measured by a benchmark.
+type BenchmarkResult struct {
+	PushOpsPerSec float64 `json:"push_ops_per_sec"`
+	PopOpsPerSec  float64 `json:"pop_ops_per_sec"`
+	LatencyP99    float64 `json:"latency_p99_us"`
+}
+
+// ToJSON converts a BenchmarkResult into JSON.
+func (result BenchmarkResult) ToJSON() []byte {
+	// Do not check error as the BenchmarkResult type does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(result)
+	return b
+}
+
+// Benchmark pushes ops elements into a Stack using a given number of
+// workers, then pops them, and returns the measured throughput.
+func Benchmark(stack *pila.Stack, ops, workers int) BenchmarkResult {
+	latencies := make([]time.Duration, 0, 2*ops)
+	var mu sync.Mutex
+
+	run := func(op func()) time.Duration {
+		start := time.Now()
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			n := ops / workers
+			if w < ops%workers {
+				n++
+			}
+
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				ls := make([]time.Duration, n)
+				for i := 0; i < n; i++ {
+					opStart := time.Now()
+					op()
+					ls[i] = time.Since(opStart)
+				}
+
+				mu.Lock()
+				latencies = append(latencies, ls...)
+				mu.Unlock()
+			}(n)
+		}
+		wg.Wait()
+		return time.Since(start)
+	}
+
+	pushTime := run(func() { stack.Push(1) })
+	popTime := run(func() { _, _ = stack.Pop() })
+
+	return BenchmarkResult{
+		PushOpsPerSec: float64(ops) / pushTime.Seconds(),
+		PopOpsPerSec:  float64(ops) / popTime.Seconds(),
+		LatencyP99:    percentile(latencies, 0.99).Seconds() * 1e6,
+	}
+}
+
+// percentile returns the p percentile, between 0 and 1,
+// of a list of durations.
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+
+	sorted := make(durationSlice, len(durations))
+	copy(sorted, durations)
+	sort.Sort(sorted)
+
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// durationSlice implements sort.Interface to sort
+// a list of durations in increasing order.
+type durationSlice []time.Duration
+
+func (ds durationSlice) Len() int           { return len(ds) }
+func (ds durationSlice) Less(i, j int) bool { return ds[i] < ds[j] }
+func (ds durationSlice) Swap(i, j int)      { ds[i], ds[j] = ds[j], ds[i] }
+
+// benchmarkHandler measures the push and pop throughput of the
+// deployment. The database and stack given as parameters must exist,
+// but the benchmark runs on a temporary Stack so data is not modified.
+func (c *Conn) benchmarkHandler(w http.ResponseWriter, r *http.Request) {
+	ops, err := intParam(r, "ops", benchmarkOpsDefault, benchmarkOpsMax)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	workers, err := intParam(r, "workers", benchmarkWorkersDefault, benchmarkWorkersMax)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	db, ok := ResourceDatabase(c, r.FormValue("db"))
+	if !ok {
+		c.goneHandler(w, r, fmt.Sprintf("database %s is Gone", r.FormValue("db")))
+		return
+	}
+	stack, ok := ResourceStack(db, r.FormValue("stack"))
+	if !ok {
+		c.goneHandler(w, r, fmt.Sprintf("stack %s is Gone", r.FormValue("stack")))
+		return
+	}
+
+	tmp := pila.NewStack(stack.Name+"_benchmark", time.Now().UTC())
+	result := Benchmark(tmp, ops, workers)
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(result.ToJSON())
+}
+
+// intParam returns the value of the integer parameter key of the
+// request, or defaultValue if not present. It returns an error if
+// the value is not an integer between 1 and max.
+func intParam(r *http.Request, key string, defaultValue, max int) (int, error) {
+	value := r.FormValue(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 1 || i > max {
+		return 0, fmt.Errorf("%s must be an integer between 1 and %d", key, max)
+	}
+	return i, nil
+}
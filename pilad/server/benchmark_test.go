@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestBenchmark(t *testing.T) {
+	stack := pila.NewStack("stack", time.Now())
+
+	result := Benchmark(stack, 1001, 4)
+
+	if result.PushOpsPerSec <= 0 {
+		t.Errorf("PushOpsPerSec is %f, expected positive", result.PushOpsPerSec)
+	}
+	if result.PopOpsPerSec <= 0 {
+		t.Errorf("PopOpsPerSec is %f, expected positive", result.PopOpsPerSec)
+	}
+	if result.LatencyP99 <= 0 {
+		t.Errorf("LatencyP99 is %f, expected positive", result.LatencyP99)
+	}
+	if stack.Size() != 0 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 0)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	durations := make([]time.Duration, 100)
+	for i := range durations {
+		durations[i] = time.Duration(100-i) * time.Microsecond
+	}
+
+	inputOutput := []struct {
+		input  float64
+		output time.Duration
+	}{
+		{0.99, 99 * time.Microsecond},
+		{0.5, 50 * time.Microsecond},
+		{1, 100 * time.Microsecond},
+		{0, 1 * time.Microsecond},
+	}
+
+	for _, io := range inputOutput {
+		if p := percentile(durations, io.input); p != io.output {
+			t.Errorf("percentile %f is %v, expected %v", io.input, p, io.output)
+		}
+	}
+
+	if p := percentile(nil, 0.99); p != 0 {
+		t.Errorf("percentile is %v, expected %v", p, 0)
+	}
+}
+
+func TestBenchmarkResultToJSON(t *testing.T) {
+	result := BenchmarkResult{1000, 2000, 1.5}
+
+	expected := `{"push_ops_per_sec":1000,"pop_ops_per_sec":2000,"latency_p99_us":1.5}`
+	if b := result.ToJSON(); string(b) != expected {
+		t.Errorf("result is %s, expected %s", string(b), expected)
+	}
+}
+
+func TestBenchmarkHandler(t *testing.T) {
+	stack := pila.NewStack("stack", time.Now())
+	stack.Push("foo")
+	db := pila.NewDatabase("db")
+	_ = db.AddStack(stack)
+	conn := NewConn()
+	_ = conn.Pila.AddDatabase(db)
+
+	request, err := http.NewRequest("POST", "/_benchmark?db=db&stack=stack&ops=100&workers=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+
+	Router(conn).ServeHTTP(response, request)
+
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
+	}
+
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+
+	var result BenchmarkResult
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.PushOpsPerSec <= 0 {
+		t.Errorf("PushOpsPerSec is %f, expected positive", result.PushOpsPerSec)
+	}
+
+	if stack.Size() != 1 || stack.Peek() != "foo" {
+		t.Errorf("stack was modified by the benchmark")
+	}
+	if n := db.Status().NumberStacks; n != 1 {
+		t.Errorf("number of stacks is %d, expected %d", n, 1)
+	}
+}
+
+func TestBenchmarkHandler_Errors(t *testing.T) {
+	db := pila.NewDatabase("db")
+	db.CreateStack("stack", time.Now())
+	conn := NewConn()
+	_ = conn.Pila.AddDatabase(db)
+
+	inputOutput := []struct {
+		input  string
+		output int
+	}{
+		{"/_benchmark?db=db&stack=stack&ops=0", http.StatusBadRequest},
+		{"/_benchmark?db=db&stack=stack&ops=foo", http.StatusBadRequest},
+		{"/_benchmark?db=db&stack=stack&ops=10000000", http.StatusBadRequest},
+		{"/_benchmark?db=db&stack=stack&workers=-1", http.StatusBadRequest},
+		{"/_benchmark?db=nodb&stack=stack", http.StatusGone},
+		{"/_benchmark?db=db&stack=nostack", http.StatusGone},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("POST", io.input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != io.output {
+			t.Errorf("on %s response code is %v, expected %v", io.input, response.Code, io.output)
+		}
+	}
+}
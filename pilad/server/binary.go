@@ -0,0 +1,69 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// binaryContentType returns the Content-Type of the request, and
+// whether its body is a binary element instead of a JSON one. Form
+// encoded bodies, sent by default by many clients, are JSON too.
+func binaryContentType(r *http.Request) (string, bool) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return "", false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType, true
+	}
+	switch {
+	case mediaType == "application/json",
+		strings.HasSuffix(mediaType, "+json"),
+		mediaType == "application/x-www-form-urlencoded":
+		return "", false
+	}
+	return contentType, true
+}
+
+// writeElement writes a value of a Stack as a 200 response. Binary
+// values are written as they were pushed, with their Content-Type,
+// unless the request asks for the base64 encoding, in which case,
+// like other values, they are written as a JSON Element. Requests
+// accepting protobuf get any value as a protobuf Element message,
+// and requests accepting the media type of a pila.Codec get it
+// encoded with the Codec.
+func (c *Conn) writeElement(w http.ResponseWriter, r *http.Request, value interface{}) {
+	if acceptsProtobuf(r) {
+		writeProtobufMessage(w, r, pila.NewElement(value))
+		return
+	}
+	if codec, ok := acceptedCodec(r); ok {
+		writeCodecElement(w, r, codec, pila.NewElement(value))
+		return
+	}
+
+	if b, ok := value.(pila.Binary); ok && r.FormValue("encoding") != "base64" {
+		logResponse(r, http.StatusOK, "content_type", b.ContentType, "size", len(b.Data))
+		w.Header().Set("Content-Type", b.ContentType)
+		w.Write(b.Data)
+		return
+	}
+
+	c.writeJSONElement(w, r, pila.NewElement(value))
+}
+
+// writeJSONElement writes an Element as a 200 JSON response.
+func (c *Conn) writeJSONElement(w http.ResponseWriter, r *http.Request, element pila.Element) {
+	logResponse(r, http.StatusOK, "element", element.Value)
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as we consider our element
+	// suitable for a JSON encoding.
+	b, _ := element.ToJSON()
+	w.Write(b)
+}
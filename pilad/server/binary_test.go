@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestBinaryContentType(t *testing.T) {
+	inputOutput := []struct {
+		input       string
+		contentType string
+		binary      bool
+	}{
+		{"", "", false},
+		{"application/json", "", false},
+		{"application/json; charset=utf-8", "", false},
+		{"application/vnd.api+json", "", false},
+		{"application/x-www-form-urlencoded", "", false},
+		{"image/png", "image/png", true},
+		{"text/plain; charset=utf-8", "text/plain; charset=utf-8", true},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest("POST", "/", nil)
+		if io.input != "" {
+			request.Header.Set("Content-Type", io.input)
+		}
+		if contentType, binary := binaryContentType(request); contentType != io.contentType || binary != io.binary {
+			t.Errorf("content type is %q and binary %v, expected %q and %v for %s",
+				contentType, binary, io.contentType, io.binary, io.input)
+		}
+	}
+}
+
+func TestBinaryElement(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	handler := Router(conn)
+
+	data := []byte{0x89, 'P', 'N', 'G', 0}
+	request, _ := http.NewRequest("POST", "/databases/db/stacks/stack", bytes.NewReader(data))
+	request.Header.Set("Content-Type", "image/png")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+	if expected := `{"element":"iVBORwA=","content_type":"image/png"}`; response.Body.String() != expected {
+		t.Errorf("body is %s, expected %s", response.Body.String(), expected)
+	}
+
+	inputOutput := []struct {
+		method, path, contentType, body string
+	}{
+		{"GET", "/databases/db/stacks/stack/peek", "image/png", string(data)},
+		{"GET", "/databases/db/stacks/stack/peek?encoding=base64", "application/json",
+			`{"element":"iVBORwA=","content_type":"image/png"}`},
+		{"DELETE", "/databases/db/stacks/stack", "image/png", string(data)},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if contentType := response.Header().Get("Content-Type"); contentType != io.contentType {
+			t.Errorf("content type is %s, expected %s for %s %s", contentType, io.contentType, io.method, io.path)
+		}
+		if response.Body.String() != io.body {
+			t.Errorf("body is %q, expected %q for %s %s", response.Body.String(), io.body, io.method, io.path)
+		}
+	}
+}
+
+func TestBinaryElement_JSON(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		body string
+		code int
+	}{
+		{`{"element":"aGVsbG8=","content_type":"text/plain"}`, http.StatusOK},
+		{`{"element":"not base64!","content_type":"text/plain"}`, http.StatusBadRequest},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest("POST", "/databases/db/stacks/stack", strings.NewReader(io.body))
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, io.body)
+		}
+	}
+
+	peek, ok := stack.Peek().(pila.Binary)
+	if !ok || peek.ContentType != "text/plain" || string(peek.Data) != "hello" {
+		t.Errorf("peek is %v, expected a text/plain binary element", stack.Peek())
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBuffer is the maximum capacity of a buffer
+// kept in the pool, so large elements are not retained.
+const maxPooledBuffer = 64 << 10
+
+// bufferPool keeps the buffers that read and write the
+// elements of requests, so they are reused instead of
+// allocated on every request.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns a buffer to the pool, unless it grew
+// larger than maxPooledBuffer. It must not be used afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	bufferPool.Put(buf)
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGetBuffer(t *testing.T) {
+	buf := getBuffer()
+	buf.WriteString("foo")
+	putBuffer(buf)
+
+	if buf := getBuffer(); buf.Len() != 0 {
+		t.Errorf("buffer length is %d, expected 0", buf.Len())
+	}
+}
+
+func TestPutBuffer_Large(t *testing.T) {
+	buf := bytes.NewBuffer(make([]byte, 0, maxPooledBuffer+1))
+	putBuffer(buf)
+
+	for i := 0; i < 10; i++ {
+		if getBuffer() == buf {
+			t.Fatal("large buffer was kept in the pool")
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+)
+
+// Elements represents the payload of a bulk POP operation,
+// ordered from the top of the Stack.
+type Elements struct {
+	Values []interface{} `json:"elements"`
+}
+
+// bulkStackHandler pushes a list of elements into the Stack on
+// POST, and pops up to a count of elements from it on DELETE.
+func (c *Conn) bulkStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	if r.Method == "DELETE" {
+		c.bulkPopStackHandler(w, r, stack)
+		return
+	}
+	c.idempotent(c.bulkPushStackHandler)(w, r, stack)
+}
+
+// bulkPushStackHandler pushes the JSON array of elements of the request
+// body into the Stack, in order, and returns 200 and the Stack status.
+func (c *Conn) bulkPushStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	now := requestDate(r)
+	if r.Body == nil {
+		logResponse(r, http.StatusBadRequest, "reason", "no elements provided")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := c.readBody(w, r)
+	if err == errBodyTooLarge {
+		c.tooLargeHandler(w, r, err)
+		return
+	}
+
+	var elements []interface{}
+	if err == nil {
+		err = json.Unmarshal(body, &elements)
+	}
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on decoding elements", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if c.IsEnabled(strictSchemaFeature) {
+		if err := validateStrictElements(elements); err != nil {
+			logResponse(r, http.StatusBadRequest, "reason", "error on decoding elements", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	if s := c.Config.MaxStackSize(); s != -1 && stack.Size()+len(elements) > s {
+		logResponse(r, http.StatusNotAcceptable, "reason", "value reached", "config", vars.MaxStackSize)
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	defer c.stackLocks.lock(stack)()
+	if err := stack.PushNCtx(r.Context(), elements); isContextError(err) {
+		c.canceledHandler(w, r, err)
+		return
+	} else if err == pila.ErrElementTooLarge {
+		c.tooLargeHandler(w, r, err)
+		return
+	} else if err == pila.ErrMemoryLimit {
+		c.memoryLimitHandler(w, r, err)
+		return
+	} else if err != nil {
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	stack.Update(now)
+	for _, element := range elements {
+		c.persistStack(r.Context(), stack, persist.Record{Op: persist.OpPush, Time: now, Element: element})
+	}
+
+	logResponse(r, http.StatusOK, "elements", len(elements))
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as we consider that the
+	// stack has no JSON encoding issues.
+	b, _ := stack.Status().ToJSON()
+	w.Write(b)
+}
+
+// bulkPopStackHandler pops up to count elements from the Stack,
+// and returns 200 and the popped elements, from top to bottom.
+func (c *Conn) bulkPopStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	now := requestDate(r)
+	count, err := intParam(r, "count", 1, math.MaxInt32)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	defer c.stackLocks.lock(stack)()
+	elements, err := stack.PopNCtx(r.Context(), count)
+	if err != nil {
+		c.canceledHandler(w, r, err)
+		return
+	}
+	if len(elements) > 0 {
+		stack.Update(now)
+		for range elements {
+			c.persistStack(r.Context(), stack, persist.Record{Op: persist.OpPop, Time: now})
+		}
+	}
+
+	logResponse(r, http.StatusOK, "elements", len(elements))
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as we consider our elements
+	// suitable for a JSON encoding.
+	b, _ := json.Marshal(Elements{Values: elements})
+	w.Write(b)
+}
+
+// validateStrictElements returns an error if any of
+// the elements of a bulk PUSH operation is null.
+func validateStrictElements(elements []interface{}) error {
+	for _, element := range elements {
+		if element == nil {
+			return errors.New("element is null")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestBulkStackHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path, body string
+		code               int
+		elements           []interface{}
+	}{
+		{"POST", "/databases/db/stacks/stack/_bulk", `["foo", 8, {"bar": true}]`, http.StatusOK, nil},
+		{"POST", "/databases/db/stacks/stack/_bulk", `{"element": "foo"}`, http.StatusBadRequest, nil},
+		{"POST", "/databases/db/stacks/stack/_bulk", `[`, http.StatusBadRequest, nil},
+		{"DELETE", "/databases/db/stacks/stack/_bulk?count=2", "", http.StatusOK,
+			[]interface{}{map[string]interface{}{"bar": true}, float64(8)}},
+		{"DELETE", "/databases/db/stacks/stack/_bulk", "", http.StatusOK, []interface{}{"foo"}},
+		{"DELETE", "/databases/db/stacks/stack/_bulk?count=2", "", http.StatusOK, []interface{}{}},
+		{"DELETE", "/databases/db/stacks/stack/_bulk?count=0", "", http.StatusBadRequest, nil},
+		{"POST", "/databases/db/stacks/foo/_bulk", `["foo"]`, http.StatusGone, nil},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if io.method != "DELETE" || io.code != http.StatusOK {
+			continue
+		}
+
+		var elements Elements
+		if err := json.Unmarshal(response.Body.Bytes(), &elements); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(elements.Values, io.elements) {
+			t.Errorf("elements are %v, expected %v", elements.Values, io.elements)
+		}
+	}
+}
+
+func TestBulkStackHandler_Push(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	handler := Router(conn)
+
+	request, _ := http.NewRequest("POST", "/databases/db/stacks/stack/_bulk", strings.NewReader(`["foo", "bar"]`))
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+	if stack.Size() != 2 || stack.Peek() != "bar" {
+		t.Errorf("stack has size %d and peek %v, expected %d and %v", stack.Size(), stack.Peek(), 2, "bar")
+	}
+	var status pila.StackStatus
+	if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Size != 2 {
+		t.Errorf("status size is %d, expected %d", status.Size, 2)
+	}
+}
+
+func TestBulkStackHandler_Limits(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set(vars.MaxStackSize, 3)
+	conn.Config.FeatureFlags = map[string]bool{strictSchemaFeature: true}
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	_ = db.AddStack(pila.NewStack("stack", time.Now().UTC()))
+	_ = db.AddStack(pila.NewStackWithLimit("limited", time.Now().UTC(), 1, pila.OverflowReject))
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		path, body string
+		code       int
+	}{
+		{"/databases/db/stacks/stack/_bulk", `["foo", null]`, http.StatusBadRequest},
+		{"/databases/db/stacks/stack/_bulk", `[1, 2, 3, 4]`, http.StatusNotAcceptable},
+		{"/databases/db/stacks/stack/_bulk", `[1, 2, 3]`, http.StatusOK},
+		{"/databases/db/stacks/limited/_bulk", `[1, 2]`, http.StatusConflict},
+		{"/databases/db/stacks/limited/_bulk", `[1]`, http.StatusOK},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("POST", io.path, strings.NewReader(io.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, io.body)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package server
+
+//go:generate go run gen_changelog.go
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unreleased is the version name of the changes that are not
+// part of any release yet.
+const unreleased = "Unreleased"
+
+// ChangelogEntry represents a change of piladb.
+type ChangelogEntry struct {
+	Version     string    `json:"version"`
+	Date        time.Time `json:"date"`
+	Breaking    bool      `json:"breaking"`
+	Description string    `json:"description"`
+}
+
+// Changelog represents the list of changes of piladb, from the
+// most recent to the oldest one.
+type Changelog []ChangelogEntry
+
+// changelog contains the changes of the running piladb version.
+var changelog = mustParseChangelog(changelogMarkdown)
+
+// ParseChangelog parses a Markdown document following the
+// http://keepachangelog.com format. Each list item of a release is
+// a ChangelogEntry. Items under a "Removed" section, or starting
+// with "BREAKING:", are considered breaking changes.
+func ParseChangelog(markdown string) (Changelog, error) {
+	changelog := Changelog{}
+
+	var version, section string
+	var date time.Time
+	scanner := bufio.NewScanner(strings.NewReader(markdown))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case strings.HasPrefix(line, "## "):
+			var err error
+			version, date, err = parseRelease(strings.TrimPrefix(line, "## "))
+			if err != nil {
+				return nil, err
+			}
+			section = ""
+
+		case strings.HasPrefix(line, "### "):
+			section = strings.TrimPrefix(line, "### ")
+
+		case strings.HasPrefix(line, "- ") && version != "":
+			description := strings.TrimPrefix(line, "- ")
+			breaking := section == "Removed" || strings.HasPrefix(description, "BREAKING:")
+
+			changelog = append(changelog, ChangelogEntry{
+				Version:     version,
+				Date:        date,
+				Breaking:    breaking,
+				Description: strings.TrimSpace(strings.TrimPrefix(description, "BREAKING:")),
+			})
+		}
+	}
+
+	return changelog, scanner.Err()
+}
+
+// parseRelease parses a release heading like "[0.1.0] - 2016-12-20"
+// and returns its version and date.
+func parseRelease(heading string) (string, time.Time, error) {
+	parts := strings.SplitN(heading, " - ", 2)
+	version := strings.Trim(parts[0], "[]")
+	if len(parts) == 1 {
+		return version, time.Time{}, nil
+	}
+
+	date, err := time.Parse("2006-01-02", strings.TrimSpace(parts[1]))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("release %s: %v", version, err)
+	}
+	return version, date, nil
+}
+
+// mustParseChangelog is like ParseChangelog but panics if the
+// changelog cannot be parsed.
+func mustParseChangelog(markdown string) Changelog {
+	changelog, err := ParseChangelog(markdown)
+	if err != nil {
+		panic(err)
+	}
+	return changelog
+}
+
+// Since returns the entries of the Changelog newer than a given
+// version. It returns an error if the version is not valid.
+func (changelog Changelog) Since(version string) (Changelog, error) {
+	from, err := parseVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := Changelog{}
+	for _, entry := range changelog {
+		if entry.Version == unreleased {
+			entries = append(entries, entry)
+			continue
+		}
+
+		v, err := parseVersion(entry.Version)
+		if err != nil {
+			return nil, err
+		}
+		if compareVersions(v, from) > 0 {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// ToJSON converts a Changelog into JSON.
+func (changelog Changelog) ToJSON() []byte {
+	// Do not check error as the Changelog type does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(changelog)
+	return b
+}
+
+// parseVersion parses a semantic version like "v1.2.0" or
+// "1.2.0" into its numeric components.
+func parseVersion(version string) ([]int, error) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %s", version)
+		}
+		numbers[i] = n
+	}
+	return numbers, nil
+}
+
+// compareVersions returns a negative number if a is older than
+// b, a positive number if a is newer than b, and 0 otherwise.
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+// changelogHandler writes the changes of piladb into the response.
+// If the from parameter is given, only changes newer than such
+// version are returned.
+func (c *Conn) changelogHandler(w http.ResponseWriter, r *http.Request) {
+	entries := changelog
+	if from := r.FormValue("from"); from != "" {
+		var err error
+		entries, err = changelog.Since(from)
+		if err != nil {
+			logResponse(r, http.StatusBadRequest, "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(entries.ToJSON())
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testChangelog = `Changelog
+=========
+
+## [Unreleased]
+
+### Added
+- New feature.
+
+## [0.2.0] - 2017-01-10
+
+### Added
+- Something.
+- BREAKING: Something else.
+
+### Removed
+- Old thing.
+
+## [0.1.0] - 2016-12-20
+
+### Added
+- First release!
+
+[Unreleased]: https://github.com/fern4lvarez/piladb/compare/v0.1.0...HEAD
+`
+
+func TestChangelogUpToDate(t *testing.T) {
+	b, err := ioutil.ReadFile("../../CHANGELOG.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != changelogMarkdown {
+		t.Error("changelog_md.go is outdated, please run go generate")
+	}
+}
+
+func TestParseChangelog(t *testing.T) {
+	changelog, err := ParseChangelog(testChangelog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date2 := time.Date(2017, 1, 10, 0, 0, 0, 0, time.UTC)
+	date1 := time.Date(2016, 12, 20, 0, 0, 0, 0, time.UTC)
+	expected := Changelog{
+		{"Unreleased", time.Time{}, false, "New feature."},
+		{"0.2.0", date2, false, "Something."},
+		{"0.2.0", date2, true, "Something else."},
+		{"0.2.0", date2, true, "Old thing."},
+		{"0.1.0", date1, false, "First release!"},
+	}
+
+	if !reflect.DeepEqual(changelog, expected) {
+		t.Errorf("changelog is %v, expected %v", changelog, expected)
+	}
+}
+
+func TestParseChangelog_Error(t *testing.T) {
+	if _, err := ParseChangelog("## [0.1.0] - yesterday"); err == nil {
+		t.Error("err is nil")
+	}
+}
+
+func TestMustParseChangelog(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("mustParseChangelog did not panic")
+		}
+	}()
+
+	mustParseChangelog("## [0.1.0] - yesterday")
+}
+
+func TestChangelogSince(t *testing.T) {
+	changelog := mustParseChangelog(testChangelog)
+
+	inputOutput := []struct {
+		input  string
+		output int
+	}{
+		{"v0.0.1", 5},
+		{"0.1.0", 4},
+		{"v0.1.5", 4},
+		{"v0.2", 1},
+		{"v1.0.0", 1},
+	}
+
+	for _, io := range inputOutput {
+		entries, err := changelog.Since(io.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != io.output {
+			t.Errorf("entries since %s are %d, expected %d", io.input, len(entries), io.output)
+		}
+	}
+}
+
+func TestChangelogSince_Error(t *testing.T) {
+	changelog := mustParseChangelog(testChangelog)
+
+	for _, input := range []string{"foo", "v1.x.0", "1.-1"} {
+		if _, err := changelog.Since(input); err == nil {
+			t.Errorf("err is nil for %s", input)
+		}
+	}
+
+	changelog = Changelog{{Version: "foo"}}
+	if _, err := changelog.Since("v1.0.0"); err == nil {
+		t.Error("err is nil")
+	}
+}
+
+func TestChangelogToJSON(t *testing.T) {
+	changelog := Changelog{
+		{"0.1.0", time.Date(2016, 12, 20, 0, 0, 0, 0, time.UTC), false, "First release!"},
+	}
+
+	expected := `[{"version":"0.1.0","date":"2016-12-20T00:00:00Z","breaking":false,"description":"First release!"}]`
+	if b := changelog.ToJSON(); string(b) != expected {
+		t.Errorf("changelog is %s, expected %s", string(b), expected)
+	}
+}
+
+func TestChangelogHandler(t *testing.T) {
+	conn := NewConn()
+
+	inputOutput := []struct {
+		input  string
+		output int
+	}{
+		{"/_changelog", http.StatusOK},
+		{"/_changelog?from=v0.1.0", http.StatusOK},
+		{"/_changelog?from=foo", http.StatusBadRequest},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("GET", io.input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != io.output {
+			t.Errorf("response code is %v, expected %v", response.Code, io.output)
+		}
+	}
+}
+
+func TestChangelogHandler_From(t *testing.T) {
+	conn := NewConn()
+
+	request, err := http.NewRequest("GET", "/_changelog?from=v0.1.0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+
+	conn.changelogHandler(response, request)
+
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
+	}
+
+	entries, _ := changelog.Since("v0.1.0")
+	if body := response.Body.String(); body != string(entries.ToJSON()) {
+		t.Errorf("changelog is %s, expected %s", body, string(entries.ToJSON()))
+	}
+}
@@ -0,0 +1,689 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/hashring"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+const (
+	// clusterReplicas is the number of virtual nodes
+	// of every node in the hash ring of the Cluster.
+	clusterReplicas = 64
+	// clusterForwardedHeader marks the requests forwarded by another
+	// node of the Cluster, which are served without forwarding them.
+	clusterForwardedHeader = "X-Pila-Forwarded"
+	// clusterJoinRetryInterval is the time a node waits before
+	// trying to join the Cluster again.
+	clusterJoinRetryInterval = time.Second
+)
+
+// Cluster keeps the nodes of the cluster pilad belongs to, if any. Every
+// Stack is owned by a single node, given by consistent hashing of the
+// names of its Database and itself, and the other nodes forward to the
+// owner the requests on the Stack. Databases exist on every node.
+type Cluster struct {
+	client *http.Client
+	ring   *hashring.Ring
+	// token authenticates the requests to other nodes, if any
+	token string
+
+	// self is the URL of this node, empty if pilad
+	// does not belong to a cluster
+	self  string
+	nodes []string
+	// moved is the number of Stacks moved to other
+	// nodes, the last time at rebalancedAt
+	moved        int64
+	rebalancing  int
+	rebalancedAt time.Time
+	// joining is set until the node joins the Cluster
+	joining bool
+
+	// mu protects the access to self, nodes, joining
+	// and the rebalancing stats
+	mu sync.Mutex
+	// rebalanceMu serializes rebalances
+	rebalanceMu sync.Mutex
+}
+
+// ClusterStatus represents the status of the Cluster seen by a node.
+type ClusterStatus struct {
+	Enabled bool     `json:"enabled"`
+	Self    string   `json:"self,omitempty"`
+	Nodes   []string `json:"nodes"`
+	// Stacks is the number of Stacks kept by the node
+	Stacks       int        `json:"stacks"`
+	Rebalancing  bool       `json:"rebalancing"`
+	MovedStacks  int64      `json:"moved_stacks"`
+	RebalancedAt *time.Time `json:"rebalanced_at,omitempty"`
+	// Owner is the node owning the requested Stack, if any
+	Owner string `json:"owner,omitempty"`
+}
+
+// ToJSON returns the ClusterStatus in JSON format.
+func (s ClusterStatus) ToJSON() []byte {
+	// Do not check error as the ClusterStatus type does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// NewCluster returns a Cluster that pilad does not belong to,
+// until Start is called.
+func NewCluster() *Cluster {
+	return &Cluster{
+		client: &http.Client{Timeout: 30 * time.Second},
+		ring:   hashring.New(clusterReplicas),
+	}
+}
+
+// Start makes pilad a node of a cluster with itself as only node,
+// given the URL other nodes reach it at, and the token authenticating
+// its requests to other nodes, if any.
+func (cl *Cluster) Start(self, token string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.self = strings.TrimRight(self, "/")
+	cl.token = token
+	cl.nodes = []string{cl.self}
+	cl.ring.Set(cl.nodes)
+}
+
+// Enabled returns whether pilad belongs to a cluster.
+func (cl *Cluster) Enabled() bool {
+	return cl.Self() != ""
+}
+
+// Self returns the URL of this node, empty if
+// pilad does not belong to a cluster.
+func (cl *Cluster) Self() string {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.self
+}
+
+// Nodes returns the URLs of the nodes of the Cluster, sorted.
+func (cl *Cluster) Nodes() []string {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return append([]string{}, cl.nodes...)
+}
+
+// SetNodes replaces the nodes of the Cluster, and returns whether they
+// changed. If this node is not one of them, it owns no Stack, so all
+// of them are moved to the others on rebalance.
+func (cl *Cluster) SetNodes(nodes []string) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	nodes = clusterNodes(nodes)
+	if len(nodes) == 0 {
+		nodes = []string{cl.self}
+	}
+	if strings.Join(nodes, ",") == strings.Join(cl.nodes, ",") {
+		return false
+	}
+	cl.nodes = nodes
+	cl.ring.Set(nodes)
+	return true
+}
+
+// Owner returns the node owning the Stack of a Database, given
+// by their names, which is this node outside of a cluster.
+func (cl *Cluster) Owner(database, stack string) string {
+	if owner := cl.ring.Get(database + "/" + stack); owner != "" {
+		return owner
+	}
+	return cl.Self()
+}
+
+// Status returns the ClusterStatus, given the number
+// of Stacks kept by the node.
+func (cl *Cluster) Status(stacks int) ClusterStatus {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	status := ClusterStatus{
+		Enabled:     cl.self != "",
+		Self:        cl.self,
+		Nodes:       append([]string{}, cl.nodes...),
+		Stacks:      stacks,
+		Rebalancing: cl.rebalancing > 0,
+		MovedStacks: cl.moved,
+	}
+	if !cl.rebalancedAt.IsZero() {
+		rebalancedAt := cl.rebalancedAt
+		status.RebalancedAt = &rebalancedAt
+	}
+	return status
+}
+
+// request sends a request to the node of the Cluster given by its URL,
+// marked as forwarded and authenticated with the token of the Cluster,
+// and returns an error unless its response status is one of codes.
+func (cl *Cluster) request(method, node, path string, query url.Values, body io.Reader, codes ...int) error {
+	u := node + (&url.URL{Path: path}).String()
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	cl.authorize(req.Header)
+
+	res, err := cl.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	for _, code := range codes {
+		if res.StatusCode == code {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %s: unexpected status %s", method, u, res.Status)
+}
+
+// authorize marks the headers of a request to another node
+// as forwarded, authenticated with the token of the Cluster.
+func (cl *Cluster) authorize(header http.Header) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	header.Set(clusterForwardedHeader, cl.self)
+	if cl.token != "" {
+		header.Set("Authorization", "Bearer "+cl.token)
+	}
+}
+
+// proxy forwards the request r to the node owning its Stack.
+func (cl *Cluster) proxy(node string, w http.ResponseWriter, r *http.Request) {
+	target, err := url.Parse(node)
+	if err != nil {
+		logResponse(r, http.StatusBadGateway, "error", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		cl.authorize(req.Header)
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// broadcast replays a request modifying a Database, already served,
+// on the other nodes of the Cluster, so Databases exist on every node.
+// Failures are logged but not returned.
+func (cl *Cluster) broadcast(method, path string, query url.Values, body []byte) {
+	self := cl.Self()
+	for _, node := range cl.Nodes() {
+		if node == self {
+			continue
+		}
+		err := cl.request(method, node, path, query, bytes.NewReader(body),
+			http.StatusOK, http.StatusCreated, http.StatusNoContent, http.StatusConflict, http.StatusGone)
+		if err != nil {
+			logger.Warn("error on broadcasting to node", "node", node, "error", err)
+		}
+	}
+}
+
+// ClusterMiddleware returns a middleware that forwards the requests on
+// a Stack to the node of the Cluster owning it, and replays the ones
+// modifying a Database on every node. Requests forwarded by another
+// node are served by this one. Renaming a Database or a Stack, or
+// transferring a Stack to another Database, may change the owner of
+// Stacks, so the Cluster is rebalanced after it.
+// It must be chained after AuthMiddleware and TenantMiddleware, so
+// forwarded requests are authorized already.
+func ClusterMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !conn.Cluster.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			forwarded := r.Header.Get(clusterForwardedHeader) != ""
+
+			segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+			if database, stack, ok := stackSegments(r, segments); ok && !forwarded {
+				database, stack = conn.stackNames(database, stack)
+				if owner := conn.Cluster.Owner(database, stack); owner != conn.Cluster.Self() {
+					conn.Cluster.proxy(owner, w, r)
+					return
+				}
+			}
+
+			// Databases are replayed by name, as their
+			// IDs are different on every node
+			broadcast := !forwarded && isMutating(r.Method) && isDatabaseRequest(segments)
+			var path string
+			var body []byte
+			if broadcast {
+				path = r.URL.Path
+				if len(segments) >= 2 {
+					if db, ok := ResourceDatabase(conn, segments[1]); ok {
+						path = strings.Join(append([]string{"", "databases", db.Name}, segments[2:]...), "/")
+					}
+				}
+				if r.Body != nil {
+					var err error
+					if body, err = ioutil.ReadAll(r.Body); err != nil {
+						logResponse(r, http.StatusBadRequest, "reason", "error on reading body", "error", err)
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					r.Body = ioutil.NopCloser(bytes.NewReader(body))
+				}
+			}
+
+			mw := &metricsResponseWriter{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(mw, r)
+			if mw.code >= http.StatusMultipleChoices {
+				return
+			}
+			if broadcast {
+				conn.Cluster.broadcast(r.Method, path, r.URL.Query(), body)
+			}
+			if r.Method == "PATCH" || len(segments) == 5 && segments[4] == "_transfer" {
+				conn.Rebalance()
+			}
+		})
+	}
+}
+
+// isDatabaseRequest determines whether a request with the given path
+// segments is on the databases, or on a single Database as a whole,
+// like flushing all its Stacks, so it is replayed on every node.
+func isDatabaseRequest(segments []string) bool {
+	if segments[0] != "databases" {
+		return false
+	}
+	return len(segments) <= 2 || len(segments) == 3 && segments[2] == "_flush"
+}
+
+// stackSegments returns the Database and Stack given by the path
+// segments of a request on a single Stack, including its creation. A
+// POP-PUSH request is on its source Stack, whose owner must serve it,
+// and a POP-ANY request on its first Stack.
+func stackSegments(r *http.Request, segments []string) (database, stack string, ok bool) {
+	if len(segments) == 3 && segments[0] == "databases" && segments[2] == "_popush" {
+		if from := r.URL.Query().Get("from"); from != "" {
+			return segments[1], from, true
+		}
+		return "", "", false
+	}
+	if len(segments) == 3 && segments[0] == "databases" && segments[2] == "_popany" {
+		if stacks := r.URL.Query().Get("stacks"); stacks != "" {
+			return segments[1], strings.Split(stacks, ",")[0], true
+		}
+		return "", "", false
+	}
+	if len(segments) < 3 || segments[0] != "databases" || segments[2] != "stacks" {
+		return "", "", false
+	}
+	if len(segments) > 3 {
+		return segments[1], segments[3], true
+	}
+	if name := r.URL.Query().Get("name"); r.Method == "PUT" && name != "" {
+		return segments[1], name, true
+	}
+	return "", "", false
+}
+
+// stackNames returns the names of a Database and a Stack given by
+// their ID or name, if this node keeps them, or as given otherwise.
+func (c *Conn) stackNames(databaseID, stackID string) (string, string) {
+	db, ok := ResourceDatabase(c, databaseID)
+	if !ok {
+		return databaseID, stackID
+	}
+	if stack, ok := ResourceStack(db, stackID); ok {
+		return db.Name, stack.Name
+	}
+	return db.Name, stackID
+}
+
+// clusterNodes returns the URLs of nodes without trailing slashes
+// and duplicates, sorted. Empty URLs are ignored.
+func clusterNodes(nodes []string) []string {
+	seen := make(map[string]bool, len(nodes))
+	cleaned := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		node = strings.TrimRight(strings.TrimSpace(node), "/")
+		if node != "" && !seen[node] {
+			seen[node] = true
+			cleaned = append(cleaned, node)
+		}
+	}
+	sort.Strings(cleaned)
+	return cleaned
+}
+
+// setClusterNodes replaces the nodes of the Cluster, and moves the
+// Stacks this node does not own anymore to their owners.
+func (c *Conn) setClusterNodes(nodes []string) {
+	if c.Cluster.SetNodes(nodes) {
+		logger.Info("cluster nodes changed", "nodes", strings.Join(c.Cluster.Nodes(), ","))
+		c.Rebalance()
+	}
+}
+
+// Rebalance moves the Stacks this node does not own to the nodes of
+// the Cluster owning them, after creating every Database of this node
+// on the others. Stacks are moved by a goroutine, and the Cluster is
+// rebalancing until it is done. Rebalances are run one at a time, and
+// a node that is not one of the nodes of the Cluster is left alone
+// once it is done.
+func (c *Conn) Rebalance() {
+	c.Cluster.mu.Lock()
+	c.Cluster.rebalancing++
+	c.Cluster.mu.Unlock()
+
+	go c.rebalance()
+}
+
+// rebalance moves the Stacks, as described in Rebalance.
+func (c *Conn) rebalance() {
+	cl := c.Cluster
+	cl.rebalanceMu.Lock()
+	defer cl.rebalanceMu.Unlock()
+
+	self := cl.Self()
+	var moved int64
+	c.Pila.ForEachDatabase(func(db *pila.Database) bool {
+		for _, node := range cl.Nodes() {
+			if node == self {
+				continue
+			}
+			query := url.Values{"name": {db.Name}}
+			if err := cl.request("PUT", node, "/databases", query, nil, http.StatusCreated, http.StatusConflict); err != nil {
+				logger.Warn("error on creating database on node", "database", db.Name, "node", node, "error", err)
+			}
+		}
+
+		db.ForEachStack(func(stack *pila.Stack) bool {
+			owner := cl.Owner(db.Name, stack.Name)
+			if owner == self {
+				return true
+			}
+			if err := c.moveStackTo(owner, db, stack); err != nil {
+				logger.Warn("error on moving stack to node", "database", db.Name, "stack", stack.Name, "node", owner, "error", err)
+				return true
+			}
+			moved++
+			return true
+		})
+		return true
+	})
+
+	cl.mu.Lock()
+	cl.rebalancing--
+	cl.moved += moved
+	cl.rebalancedAt = time.Now().UTC()
+	member := false
+	for _, node := range cl.nodes {
+		member = member || node == self
+	}
+	if !member {
+		cl.nodes = []string{self}
+		cl.ring.Set(cl.nodes)
+	}
+	cl.mu.Unlock()
+
+	logger.Info("cluster rebalanced", "moved_stacks", moved)
+}
+
+// moveStackTo creates the Stack on node with the same options, pushes
+// its elements there, and removes it from this node. Webhooks of the
+// Stack and expiration dates of its elements are not kept.
+func (c *Conn) moveStackTo(node string, db *pila.Database, stack *pila.Stack) error {
+	cl := c.Cluster
+	status := stack.Status()
+	query := url.Values{"name": {stack.Name}, "type": {string(stack.Type)}}
+	if status.MaxSize > 0 {
+		query.Set("max_size", strconv.Itoa(status.MaxSize))
+		query.Set("policy", string(status.Policy))
+	}
+	if status.RateLimit > 0 {
+		query.Set("rate_limit", strconv.Itoa(status.RateLimit))
+	}
+	if status.TTL != "" {
+		query.Set("ttl", status.TTL)
+	}
+	if status.Unique != "" {
+		query.Set("unique", string(status.Unique))
+	}
+	if status.Compress > 0 {
+		query.Set("compress", strconv.Itoa(status.Compress))
+	}
+	if status.Encrypted {
+		query.Set("encrypt", "true")
+	}
+	if w := status.Watermarks; w != nil {
+		if w.High != pila.NoWatermark {
+			query.Set("high_watermark", strconv.Itoa(w.High))
+		}
+		if w.Low != pila.NoWatermark {
+			query.Set("low_watermark", strconv.Itoa(w.Low))
+		}
+	}
+	stacksPath := "/databases/" + db.Name + "/stacks"
+	if err := cl.request("PUT", node, stacksPath, query, nil, http.StatusCreated, http.StatusConflict); err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		bw := bufio.NewWriter(pw)
+		enc := json.NewEncoder(bw)
+		var err error
+		stack.ForEachElement(func(e pila.Element) bool {
+			err = enc.Encode(e)
+			return err == nil
+		})
+		if err == nil {
+			err = bw.Flush()
+		}
+		pw.CloseWithError(err)
+	}()
+	err := cl.request("PUT", node, stacksPath+"/"+stack.Name+"/_import", nil, pr, http.StatusOK)
+	pr.Close()
+	if err != nil {
+		return err
+	}
+
+	defer c.stackLocks.lock(stack)()
+	stack.Flush()
+	_ = db.RemoveStack(stack.ID)
+	c.Webhooks.RemoveStack(stack)
+	c.persist(context.Background(), persist.Record{Op: persist.OpDeleteStack, Time: time.Now().UTC(), Database: db.Name, Stack: stack.Name})
+	return nil
+}
+
+// Joining determines whether the node is still joining the Cluster.
+func (cl *Cluster) Joining() bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.joining
+}
+
+// setJoining sets whether the node is joining the Cluster.
+func (cl *Cluster) setJoining(joining bool) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.joining = joining
+}
+
+// JoinCluster asks the node at URL to add this node to its Cluster,
+// retrying after retry until it succeeds. The nodes of the Cluster
+// are received afterwards. It is meant to be run as a goroutine,
+// and the node is Joining until it succeeds.
+func (c *Conn) JoinCluster(node string, retry time.Duration) {
+	c.Cluster.setJoining(true)
+	query := url.Values{"url": {c.Cluster.Self()}}
+	for {
+		err := c.Cluster.request("POST", strings.TrimRight(node, "/"), "/_cluster/join", query, nil, http.StatusOK)
+		if err == nil {
+			c.Cluster.setJoining(false)
+			logger.Info("joined cluster", "node", node)
+			return
+		}
+		logger.Warn("error on joining cluster", "node", node, "error", err)
+		time.Sleep(retry)
+	}
+}
+
+// announce sends the nodes of the Cluster to the given nodes,
+// besides this one, and applies them to this node.
+func (c *Conn) announce(to, nodes []string) {
+	b, _ := json.Marshal(map[string][]string{"nodes": nodes})
+	self := c.Cluster.Self()
+	for _, node := range to {
+		if node == self {
+			continue
+		}
+		if err := c.Cluster.request("PUT", node, "/_cluster/nodes", nil, bytes.NewReader(b), http.StatusNoContent); err != nil {
+			logger.Warn("error on announcing cluster nodes", "node", node, "error", err)
+		}
+	}
+	c.setClusterNodes(nodes)
+}
+
+// clusterHandler writes the ClusterStatus into the response, including
+// the owner of the Stack given by the database and stack parameters.
+func (c *Conn) clusterHandler(w http.ResponseWriter, r *http.Request) {
+	status := c.clusterStatus()
+	if database, stack := r.FormValue("database"), r.FormValue("stack"); status.Enabled && database != "" && stack != "" {
+		status.Owner = c.Cluster.Owner(c.stackNames(database, stack))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(status.ToJSON())
+}
+
+// clusterStatus returns the ClusterStatus of this node.
+func (c *Conn) clusterStatus() ClusterStatus {
+	var stacks int
+	c.Pila.ForEachDatabase(func(db *pila.Database) bool {
+		db.ForEachStack(func(*pila.Stack) bool {
+			stacks++
+			return true
+		})
+		return true
+	})
+	return c.Cluster.Status(stacks)
+}
+
+// joinClusterHandler adds the node given by the url parameter to the
+// Cluster, announcing the new nodes to every node, and returns 200 and
+// the ClusterStatus. Returns 409 if pilad does not belong to a cluster.
+func (c *Conn) joinClusterHandler(w http.ResponseWriter, r *http.Request) {
+	if !c.Cluster.Enabled() {
+		logResponse(r, http.StatusConflict, "reason", "not in a cluster")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	node, err := url.Parse(r.FormValue("url"))
+	if err != nil || (node.Scheme != "http" && node.Scheme != "https") || node.Host == "" {
+		logResponse(r, http.StatusBadRequest, "reason", "invalid url")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	nodes := clusterNodes(append(c.Cluster.Nodes(), node.String()))
+	c.announce(nodes, nodes)
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(c.clusterStatus().ToJSON())
+}
+
+// leaveClusterHandler removes the node given by the url parameter from
+// the Cluster, or this node if not given, announcing the remaining nodes
+// to every node, and returns 202, as the Stacks of the leaving node are
+// moved to the remaining ones afterwards. Stacks of an unreachable node
+// are lost. Returns 409 if pilad does not belong to a cluster, and 410
+// if the node is not in the Cluster.
+func (c *Conn) leaveClusterHandler(w http.ResponseWriter, r *http.Request) {
+	if !c.Cluster.Enabled() {
+		logResponse(r, http.StatusConflict, "reason", "not in a cluster")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	leaving := strings.TrimRight(r.FormValue("url"), "/")
+	if leaving == "" {
+		leaving = c.Cluster.Self()
+	}
+
+	current := c.Cluster.Nodes()
+	nodes := make([]string, 0, len(current))
+	for _, node := range current {
+		if node != leaving {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == len(current) {
+		c.goneHandler(w, r, fmt.Sprintf("node %s is Gone", leaving))
+		return
+	}
+
+	c.announce(current, nodes)
+
+	logResponse(r, http.StatusAccepted)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// clusterNodesHandler replaces the nodes of the Cluster with the ones
+// of the request body, as announced by another node, and returns 204.
+func (c *Conn) clusterNodesHandler(w http.ResponseWriter, r *http.Request) {
+	if !c.Cluster.Enabled() {
+		logResponse(r, http.StatusConflict, "reason", "not in a cluster")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if r.Body == nil {
+		logResponse(r, http.StatusBadRequest, "reason", "no nodes provided")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Nodes []string `json:"nodes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on decoding nodes", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.setClusterNodes(body.Nodes)
+	logResponse(r, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// clusterNode is a node of a Cluster served by an httptest.Server.
+type clusterNode struct {
+	conn   *Conn
+	server *httptest.Server
+}
+
+// newClusterNodes starts n nodes, each of them a Cluster of itself.
+func newClusterNodes(n int) []clusterNode {
+	nodes := make([]clusterNode, n)
+	for i := range nodes {
+		conn := NewConn()
+		handler := ClusterMiddleware(conn)(Router(conn))
+		nodes[i] = clusterNode{conn: conn, server: httptest.NewServer(handler)}
+		conn.Cluster.Start(nodes[i].server.URL, "")
+	}
+	return nodes
+}
+
+// do sends a request to the node, and returns the response code and body.
+func (node clusterNode) do(t *testing.T, method, path, body string) (int, string) {
+	request, err := http.NewRequest(method, node.server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	b, _ := ioutil.ReadAll(response.Body)
+	return response.StatusCode, string(b)
+}
+
+// waitRebalanced waits until no node is rebalancing, or fails after
+// two seconds.
+func waitRebalanced(t *testing.T, nodes []clusterNode) {
+	for i := 0; i < 200; i++ {
+		rebalancing := false
+		for _, node := range nodes {
+			rebalancing = rebalancing || node.conn.clusterStatus().Rebalancing
+		}
+		if !rebalancing {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("cluster was not rebalanced")
+}
+
+func TestCluster(t *testing.T) {
+	nodes := newClusterNodes(3)
+	for _, node := range nodes {
+		defer node.server.Close()
+	}
+
+	for _, node := range nodes[1:] {
+		if code, _ := nodes[0].do(t, "POST", "/_cluster/join?url="+url.QueryEscape(node.server.URL), ""); code != http.StatusOK {
+			t.Fatalf("join response code is %v, expected %v", code, http.StatusOK)
+		}
+	}
+	waitRebalanced(t, nodes)
+
+	urls := clusterNodes([]string{nodes[0].server.URL, nodes[1].server.URL, nodes[2].server.URL})
+	for _, node := range nodes {
+		if n := node.conn.Cluster.Nodes(); !reflect.DeepEqual(n, urls) {
+			t.Errorf("nodes are %v, expected %v", n, urls)
+		}
+	}
+
+	if code, _ := nodes[0].do(t, "PUT", "/databases?name=db", ""); code != http.StatusCreated {
+		t.Fatalf("response code is %v, expected %v", code, http.StatusCreated)
+	}
+	for _, node := range nodes {
+		if _, ok := node.conn.Pila.DatabaseByName("db"); !ok {
+			t.Fatalf("database was not created on %s", node.server.URL)
+		}
+	}
+
+	stacks := 12
+	for i := 0; i < stacks; i++ {
+		if code, _ := nodes[i%3].do(t, "PUT", fmt.Sprintf("/databases/db/stacks?name=s%d", i), ""); code != http.StatusCreated {
+			t.Errorf("create response code is %v, expected %v", code, http.StatusCreated)
+		}
+		if code, _ := nodes[(i+1)%3].do(t, "POST", fmt.Sprintf("/databases/db/stacks/s%d", i), fmt.Sprintf(`{"element":%d}`, i)); code != http.StatusOK {
+			t.Errorf("push response code is %v, expected %v", code, http.StatusOK)
+		}
+	}
+
+	owned := 0
+	for _, node := range nodes {
+		status := node.conn.clusterStatus()
+		owned += status.Stacks
+		db, _ := node.conn.Pila.DatabaseByName("db")
+		db.ForEachStack(func(stack *pila.Stack) bool {
+			if owner := node.conn.Cluster.Owner("db", stack.Name); owner != node.server.URL {
+				t.Errorf("stack %s is on %s, expected %s", stack.Name, node.server.URL, owner)
+			}
+			return true
+		})
+	}
+	if owned != stacks {
+		t.Errorf("stacks are %d, expected %d", owned, stacks)
+	}
+
+	code, body := nodes[0].do(t, "GET", "/_cluster?database=db&stack=s1", "")
+	var status ClusterStatus
+	if err := json.Unmarshal([]byte(body), &status); err != nil || code != http.StatusOK {
+		t.Fatalf("response is %v %s", code, body)
+	}
+	if !status.Enabled || status.Self != nodes[0].server.URL || status.Owner != nodes[0].conn.Cluster.Owner("db", "s1") {
+		t.Errorf("cluster status is %+v", status)
+	}
+
+	leaving := nodes[2].conn.clusterStatus().Stacks
+	if code, _ := nodes[2].do(t, "POST", "/_cluster/leave", ""); code != http.StatusAccepted {
+		t.Fatalf("leave response code is %v, expected %v", code, http.StatusAccepted)
+	}
+	waitRebalanced(t, nodes)
+
+	if status := nodes[2].conn.clusterStatus(); status.Stacks != 0 || status.MovedStacks != int64(leaving) || !reflect.DeepEqual(status.Nodes, []string{nodes[2].server.URL}) {
+		t.Errorf("left node status is %+v", status)
+	}
+	for _, node := range nodes[:2] {
+		if n := node.conn.Cluster.Nodes(); len(n) != 2 {
+			t.Errorf("nodes are %v, expected %d", n, 2)
+		}
+	}
+	for i := 0; i < stacks; i++ {
+		code, body := nodes[i%2].do(t, "GET", fmt.Sprintf("/databases/db/stacks/s%d/peek", i), "")
+		if expected := fmt.Sprintf(`{"element":%d}`, i); code != http.StatusOK || body != expected {
+			t.Errorf("peek is %v %s, expected %v %s", code, body, http.StatusOK, expected)
+		}
+	}
+
+	if code, _ := nodes[0].do(t, "DELETE", "/databases/db/_flush", ""); code != http.StatusOK {
+		t.Errorf("flush response code is %v, expected %v", code, http.StatusOK)
+	}
+	for _, node := range nodes[:2] {
+		if db, _ := node.conn.Pila.DatabaseByName("db"); !db.Empty() {
+			t.Errorf("database was not flushed on %s", node.server.URL)
+		}
+	}
+
+	if code, _ := nodes[1].do(t, "DELETE", "/databases/db", ""); code != http.StatusNoContent {
+		t.Errorf("response code is %v, expected %v", code, http.StatusNoContent)
+	}
+	for _, node := range nodes[:2] {
+		if _, ok := node.conn.Pila.DatabaseByName("db"); ok {
+			t.Errorf("database was not deleted on %s", node.server.URL)
+		}
+	}
+}
+
+func TestIsDatabaseRequest(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output bool
+	}{
+		{"databases", true},
+		{"databases/db", true},
+		{"databases/db/_flush", true},
+		{"databases/db/stacks", false},
+		{"databases/db/_transaction", false},
+		{"databases/db/_popush", false},
+		{"databases/db/stacks/stack", false},
+		{"_status", false},
+	}
+
+	for _, io := range inputOutput {
+		if output := isDatabaseRequest(strings.Split(io.input, "/")); output != io.output {
+			t.Errorf("isDatabaseRequest(%s) is %v, expected %v", io.input, output, io.output)
+		}
+	}
+}
+
+func TestStackSegments(t *testing.T) {
+	inputOutput := []struct {
+		method, path    string
+		database, stack string
+		ok              bool
+	}{
+		{"GET", "/databases/db/stacks/stack", "db", "stack", true},
+		{"POST", "/databases/db/stacks/stack/_move?to=other", "db", "stack", true},
+		{"PUT", "/databases/db/stacks?name=stack", "db", "stack", true},
+		{"GET", "/databases/db/stacks", "", "", false},
+		{"POST", "/databases/db/_popush?from=stack&to=other", "db", "stack", true},
+		{"POST", "/databases/db/_popush?to=other", "", "", false},
+		{"DELETE", "/databases/db/_popany?stacks=stack,other", "db", "stack", true},
+		{"DELETE", "/databases/db/_popany", "", "", false},
+		{"POST", "/databases/db/_transaction", "", "", false},
+		{"GET", "/_status", "", "", false},
+	}
+
+	for _, io := range inputOutput {
+		r, _ := http.NewRequest(io.method, io.path, nil)
+		segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if database, stack, ok := stackSegments(r, segments); database != io.database || stack != io.stack || ok != io.ok {
+			t.Errorf("stackSegments(%s %s) is %s, %s, %v, expected %s, %s, %v",
+				io.method, io.path, database, stack, ok, io.database, io.stack, io.ok)
+		}
+	}
+}
+
+func TestClusterHandlers_Errors(t *testing.T) {
+	nodes := newClusterNodes(1)
+	defer nodes[0].server.Close()
+	disabled := clusterNode{conn: NewConn()}
+	disabled.server = httptest.NewServer(Router(disabled.conn))
+	defer disabled.server.Close()
+
+	inputOutput := []struct {
+		node         clusterNode
+		method, path string
+		body         string
+		code         int
+	}{
+		{disabled, "GET", "/_cluster", "", http.StatusOK},
+		{disabled, "POST", "/_cluster/join?url=http://localhost:1205", "", http.StatusConflict},
+		{disabled, "POST", "/_cluster/leave", "", http.StatusConflict},
+		{disabled, "PUT", "/_cluster/nodes", `{"nodes":[]}`, http.StatusConflict},
+		{nodes[0], "POST", "/_cluster/join", "", http.StatusBadRequest},
+		{nodes[0], "POST", "/_cluster/join?url=ftp://localhost", "", http.StatusBadRequest},
+		{nodes[0], "POST", "/_cluster/leave?url=http://localhost:1205", "", http.StatusGone},
+		{nodes[0], "PUT", "/_cluster/nodes", `{"nodes":`, http.StatusBadRequest},
+		{nodes[0], "PUT", "/_cluster/nodes", `{"nodes":[]}`, http.StatusNoContent},
+	}
+
+	for _, io := range inputOutput {
+		if code, _ := io.node.do(t, io.method, io.path, io.body); code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", code, io.code, io.method, io.path)
+		}
+	}
+
+	if status := disabled.conn.clusterStatus(); status.Enabled || len(status.Nodes) != 0 {
+		t.Errorf("cluster status is %+v", status)
+	}
+}
+
+func TestClusterNodes(t *testing.T) {
+	nodes := clusterNodes([]string{"http://b/", " http://a", "", "http://b"})
+	if expected := []string{"http://a", "http://b"}; !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("nodes are %v, expected %v", nodes, expected)
+	}
+}
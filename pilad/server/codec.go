@@ -0,0 +1,49 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// acceptedCodec returns the pila.Codec of the first media type
+// accepted by the request that has one registered, if any.
+func acceptedCodec(r *http.Request) (pila.Codec, bool) {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		if codec, ok := pila.LookupCodec(mediaType); ok {
+			return codec, true
+		}
+	}
+	return nil, false
+}
+
+// requestCodec returns the pila.Codec registered for the
+// Content-Type of the request, and whether there is any.
+func requestCodec(r *http.Request) (pila.Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, false
+	}
+	return pila.LookupCodec(mediaType)
+}
+
+// writeCodecElement writes an Element encoded with a pila.Codec as
+// a 200 response, or returns 400 if it could not be encoded.
+func writeCodecElement(w http.ResponseWriter, r *http.Request, codec pila.Codec, element pila.Element) {
+	b, err := codec.Marshal(element)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on response serialization", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	logResponse(r, http.StatusOK, "content_type", codec.ContentType(), "size", len(b))
+	w.Header().Set("Content-Type", codec.ContentType())
+	w.Write(b)
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/cbor"
+	"github.com/fern4lvarez/piladb/pkg/msgpack"
+)
+
+func TestAcceptedCodec(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output string
+	}{
+		{"", ""},
+		{"application/json", ""},
+		{"application/msgpack", "application/msgpack"},
+		{"application/x-msgpack", "application/msgpack"},
+		{"application/json, application/cbor;q=0.9", "application/cbor"},
+		{"application/cbor, application/msgpack", "application/cbor"},
+		{"*/*", ""},
+	}
+
+	for _, io := range inputOutput {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", io.input)
+		var output string
+		if codec, ok := acceptedCodec(r); ok {
+			output = codec.ContentType()
+		}
+		if output != io.output {
+			t.Errorf("acceptedCodec(%q) is %q, expected %q", io.input, output, io.output)
+		}
+	}
+}
+
+func TestRequestCodec(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output string
+	}{
+		{"", ""},
+		{"application/json", ""},
+		{"application/cbor", "application/cbor"},
+		{"application/msgpack; charset=binary", "application/msgpack"},
+		{"text/plain", ""},
+	}
+
+	for _, io := range inputOutput {
+		r, _ := http.NewRequest("POST", "/", nil)
+		r.Header.Set("Content-Type", io.input)
+		var output string
+		if codec, ok := requestCodec(r); ok {
+			output = codec.ContentType()
+		}
+		if output != io.output {
+			t.Errorf("requestCodec(%q) is %q, expected %q", io.input, output, io.output)
+		}
+	}
+}
+
+func TestCodecHandlers(t *testing.T) {
+	encodings := []struct {
+		contentType string
+		marshal     func(interface{}) ([]byte, error)
+		unmarshal   func([]byte) (interface{}, error)
+	}{
+		{"application/msgpack", msgpack.Marshal, msgpack.Unmarshal},
+		{"application/cbor", cbor.Marshal, cbor.Unmarshal},
+	}
+
+	for _, e := range encodings {
+		conn := NewConn()
+		db := pila.NewDatabase("db")
+		_ = conn.Pila.AddDatabase(db)
+		stack := db.Stacks[db.CreateStack("stack", time.Now())]
+		handler := Router(conn)
+
+		do := func(method, path string, body interface{}, contentType string) interface{} {
+			var b []byte
+			if body != nil {
+				b, _ = e.marshal(body)
+			}
+			request, _ := http.NewRequest(method, path, bytes.NewReader(b))
+			request.Header.Set("Accept", e.contentType)
+			if contentType != "" {
+				request.Header.Set("Content-Type", contentType)
+			}
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+
+			if response.Code != http.StatusOK {
+				t.Fatalf("%s %s: response code is %v, expected %v", method, path, response.Code, http.StatusOK)
+			}
+			if ct := response.Header().Get("Content-Type"); ct != e.contentType {
+				t.Fatalf("%s %s: content type is %s, expected %s", method, path, ct, e.contentType)
+			}
+			value, err := e.unmarshal(response.Body.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return value
+		}
+
+		element := map[string]interface{}{"element": map[string]interface{}{"foo": "bar", "n": int64(1)}}
+		if value := do("POST", "/databases/db/stacks/stack", element, e.contentType); !reflect.DeepEqual(value, element) {
+			t.Errorf("%s: pushed element is %v, expected %v", e.contentType, value, element)
+		}
+		if peek, ok := stack.Peek().(map[string]interface{}); !ok || peek["foo"] != "bar" || peek["n"] != 1.0 {
+			t.Errorf("%s: peek is %v, expected %v", e.contentType, stack.Peek(), element["element"])
+		}
+
+		binary := map[string]interface{}{"element": []byte{0, 1, 2}, "content_type": "application/octet-stream"}
+		do("POST", "/databases/db/stacks/stack", binary, e.contentType)
+		if peek, ok := stack.Peek().(pila.Binary); !ok || !bytes.Equal(peek.Data, []byte{0, 1, 2}) {
+			t.Errorf("%s: peek is %v, expected binary", e.contentType, stack.Peek())
+		}
+		if value := do("GET", "/databases/db/stacks/stack?peek", nil, ""); !reflect.DeepEqual(value, binary) {
+			t.Errorf("%s: peek element is %v, expected %v", e.contentType, value, binary)
+		}
+		if value := do("DELETE", "/databases/db/stacks/stack", nil, ""); !reflect.DeepEqual(value, binary) {
+			t.Errorf("%s: popped element is %v, expected %v", e.contentType, value, binary)
+		}
+		if value := do("DELETE", "/databases/db/stacks/stack", nil, ""); !reflect.DeepEqual(value, element) {
+			t.Errorf("%s: popped element is %v, expected %v", e.contentType, value, element)
+		}
+	}
+}
+
+func TestPushStackHandler_CodecBadRequest(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	db.CreateStack("stack", time.Now())
+
+	element, _ := msgpack.Marshal("foo")
+	for _, body := range [][]byte{nil, {0xc1}, element} {
+		request, _ := http.NewRequest("POST", "/databases/db/stacks/stack", bytes.NewReader(body))
+		request.Header.Set("Content-Type", "application/msgpack")
+		response := httptest.NewRecorder()
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("%x: response code is %v, expected %v", body, response.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestWriteCodecElement_Error(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/", nil)
+	response := httptest.NewRecorder()
+	codec, _ := pila.LookupCodec("application/cbor")
+	writeCodecElement(response, request, codec, pila.Element{Value: make(chan int)})
+
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusBadRequest)
+	}
+}
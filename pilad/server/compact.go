@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// compactionInterval is the period of time between the checks
+// of the triggers compacting the persistence Log.
+const compactionInterval = 5 * time.Second
+
+// compact compacts the persistence Log into a snapshot,
+// logging the Compaction or the error.
+func (c *Conn) compact() (persist.Compaction, error) {
+	compaction, err := c.Log.Compact(c.Pila.Keyring())
+	if err != nil {
+		logger.Error("error on compacting persistence log", "error", err)
+		return compaction, err
+	}
+	logger.Info("compacted persistence log", "records", compaction.Records, "size", compaction.Size,
+		"snapshot_size", compaction.SnapshotSize, "duration", compaction.Duration)
+	return compaction, nil
+}
+
+// CompactionScheduler compacts the persistence Log every interval in
+// which it grew to size bytes or ops Records since it was last compacted,
+// being the triggers disabled if 0, until stop is closed. It is meant
+// to be run as a goroutine.
+func (c *Conn) CompactionScheduler(interval time.Duration, size int64, ops int, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if (size > 0 && c.Log.Size() >= size) || (ops > 0 && c.Log.Records() >= ops) {
+				c.compact()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// compactHandler compacts the persistence Log into a snapshot, without
+// blocking the requests modifying the Pila, and returns 200 and the
+// Compaction. Returns 409 if the persistence Log is disabled.
+func (c *Conn) compactHandler(w http.ResponseWriter, r *http.Request) {
+	if c.Log == nil {
+		logResponse(r, http.StatusConflict, "reason", "persistence is disabled")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	compaction, err := c.compact()
+	if err != nil {
+		logResponse(r, http.StatusInternalServerError, "reason", "error on compacting", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Do not check error as a Compaction is
+	// always valid for a JSON encoding.
+	b, _ := json.Marshal(compaction)
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(b)
+}
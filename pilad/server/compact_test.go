@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila/persist"
+)
+
+func TestCompactHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-compact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conn := NewConn()
+	handler := Router(conn)
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	if response := serve("POST", "/_compact"); response.Code != http.StatusConflict {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusConflict)
+	}
+
+	if err := conn.openLog(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/databases?name=db", "/databases/db/stacks?name=stack"} {
+		if response := serve("PUT", path); response.Code != http.StatusCreated {
+			t.Fatalf("response code is %v, expected %v for %s", response.Code, http.StatusCreated, path)
+		}
+	}
+
+	response := serve("POST", "/_compact")
+	if response.Code != http.StatusOK {
+		t.Fatalf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+	var compaction persist.Compaction
+	if err := json.Unmarshal(response.Body.Bytes(), &compaction); err != nil {
+		t.Fatal(err)
+	}
+	if compaction.Records != 2 || compaction.SnapshotSize == 0 {
+		t.Errorf("compaction is %+v, expected 2 records", compaction)
+	}
+
+	// the compacted log is replayed on start-up
+	conn.Log.Close()
+	restarted := NewConn()
+	if err := restarted.openLog(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Log.Close()
+	if db, ok := restarted.Pila.DatabaseByName("db"); !ok || db.Status().NumberStacks != 1 {
+		t.Errorf("database db is %v, expected it with 1 stack", db)
+	}
+}
+
+func TestCompactionScheduler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-compact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conn := NewConn()
+	if err := conn.openLog(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Log.Close()
+	handler := Router(conn)
+	for _, path := range []string{"/databases?name=db", "/databases?name=other"} {
+		request, _ := http.NewRequest("PUT", path, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	stop := make(chan struct{})
+	go conn.CompactionScheduler(10*time.Millisecond, 0, 3, stop)
+	time.Sleep(50 * time.Millisecond)
+	if n := conn.Log.Records(); n != 2 {
+		t.Errorf("log has %d records, expected %d before reaching the trigger", n, 2)
+	}
+
+	request, _ := http.NewRequest("PUT", "/databases?name=another", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	if n := conn.Log.Records(); n != 0 {
+		t.Errorf("log has %d records, expected %d after compaction", n, 0)
+	}
+}
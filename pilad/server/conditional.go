@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// stackETag returns the ETag of a Stack given its Version.
+func stackETag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// etagMatch determines whether the list of ETags of an If-Match
+// or If-None-Match header matches the ETag of a Stack version.
+// A weak ETag matches if weak is true.
+func etagMatch(header string, version uint64, weak bool) bool {
+	etag := stackETag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatch returns the condition on the Version of a Stack given by
+// the If-Match header of a request modifying it, nil if none is given.
+func ifMatch(r *http.Request) func(version uint64) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+	return func(version uint64) bool {
+		return etagMatch(header, version, false)
+	}
+}
+
+// checkIfMatch returns true if the If-Match header of the request, if
+// any, matches the Version of stack, and otherwise responds 412
+// Precondition Failed. Unlike pushes and pops, the Version is not
+// checked atomically with the operation.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, stack *pila.Stack) bool {
+	if match := ifMatch(r); match != nil && !match(stack.Version()) {
+		logResponse(r, http.StatusPreconditionFailed, "reason", "If-Match not met")
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// notModified sets the ETag header of the response to the version of a
+// Stack, and returns true after responding 304 Not Modified if it
+// matches the If-None-Match header of the request.
+func notModified(w http.ResponseWriter, r *http.Request, version uint64) bool {
+	w.Header().Set("ETag", stackETag(version))
+	if header := r.Header.Get("If-None-Match"); header == "" || !etagMatch(header, version, true) {
+		return false
+	}
+
+	logResponse(r, http.StatusNotModified)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// popCondition returns the condition on the top of a Stack given by
+// the if_version and if_peek_equals parameters and the If-Match header
+// of a request popping it, nil if none is given. if_peek_equals is an
+// element encoded as JSON, which is compared to the peek of the Stack
+// as such.
+func popCondition(r *http.Request) (func(value interface{}, version uint64) bool, error) {
+	_ = r.ParseForm()
+
+	var version *uint64
+	if values, ok := r.Form["if_version"]; ok {
+		n, err := strconv.ParseUint(values[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid if_version %q", values[0])
+		}
+		version = &n
+	}
+
+	var peek []byte
+	if values, ok := r.Form["if_peek_equals"]; ok {
+		var element interface{}
+		if err := json.Unmarshal([]byte(values[0]), &element); err != nil {
+			return nil, fmt.Errorf("invalid if_peek_equals: %v", err)
+		}
+		// Do not check error as the element was decoded from JSON.
+		peek, _ = json.Marshal(element)
+	}
+
+	match := ifMatch(r)
+	if version == nil && peek == nil && match == nil {
+		return nil, nil
+	}
+	return func(value interface{}, v uint64) bool {
+		if version != nil && v != *version {
+			return false
+		}
+		if match != nil && !match(v) {
+			return false
+		}
+		if peek != nil {
+			b, err := json.Marshal(value)
+			return err == nil && bytes.Equal(b, peek)
+		}
+		return true
+	}, nil
+}
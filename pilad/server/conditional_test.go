@@ -0,0 +1,129 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestPopStackHandler_Conditional(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	_ = stack.Push(map[string]interface{}{"a": 1.0, "b": "c"})
+	_ = stack.Push(8.0)
+	_ = stack.Push("foo")
+
+	inputOutput := []struct {
+		query string
+		code  int
+		size  int
+	}{
+		{"if_version=x", http.StatusBadRequest, 3},
+		{"if_peek_equals=foo", http.StatusBadRequest, 3},
+		{"if_version=2", http.StatusPreconditionFailed, 3},
+		{`if_peek_equals="bar"`, http.StatusPreconditionFailed, 3},
+		{`if_version=3&if_peek_equals="bar"`, http.StatusPreconditionFailed, 3},
+		{`if_version=3&if_peek_equals="foo"`, http.StatusOK, 2},
+		{"if_version=4", http.StatusOK, 1},
+		{`if_peek_equals={"b":"c","a":1}`, http.StatusOK, 0},
+		{"if_version=6", http.StatusNoContent, 0},
+	}
+
+	for _, io := range inputOutput {
+		paths := []string{"/databases/db/stacks/stack", "/databases/db/stacks/stack/pop"}
+		if io.code == http.StatusOK {
+			// pop only once
+			paths = paths[:1]
+		}
+		for _, path := range paths {
+			request, err := http.NewRequest("DELETE", path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request.URL.RawQuery = io.query
+			response := httptest.NewRecorder()
+			Router(conn).ServeHTTP(response, request)
+
+			if response.Code != io.code {
+				t.Errorf("response code is %v, expected %v for %s?%s", response.Code, io.code, path, io.query)
+			}
+			if size := stack.Size(); size != io.size {
+				t.Errorf("stack size is %v, expected %v for %s?%s", size, io.size, path, io.query)
+			}
+		}
+	}
+}
+
+func TestEtagMatch(t *testing.T) {
+	inputOutput := []struct {
+		header string
+		weak   bool
+		output bool
+	}{
+		{`"3"`, false, true},
+		{`"2", "3"`, false, true},
+		{`*`, false, true},
+		{`"2"`, false, false},
+		{`W/"3"`, false, false},
+		{`W/"3"`, true, true},
+		{`3`, false, false},
+	}
+
+	for _, io := range inputOutput {
+		if output := etagMatch(io.header, 3, io.weak); output != io.output {
+			t.Errorf("match of %s is %v, expected %v", io.header, output, io.output)
+		}
+	}
+}
+
+func TestStackHandlers_ETag(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	_ = stack.Push("foo")
+	handler := Router(conn)
+	etag := stackETag(stack.Version())
+
+	inputOutput := []struct {
+		method, path, header, value string
+		code                        int
+		etag                        string
+	}{
+		{"GET", "/databases/db/stacks/stack", "", "", http.StatusOK, etag},
+		{"GET", "/databases/db/stacks/stack?peek", "", "", http.StatusOK, etag},
+		{"GET", "/databases/db/stacks/stack/peek", "If-None-Match", etag, http.StatusNotModified, etag},
+		{"GET", "/databases/db/stacks/stack", "If-None-Match", `"0"`, http.StatusOK, etag},
+		{"POST", "/databases/db/stacks/stack", "If-Match", `"0"`, http.StatusPreconditionFailed, ""},
+		{"POST", "/databases/db/stacks/stack", "If-Match", etag, http.StatusOK, ""},
+		{"DELETE", "/databases/db/stacks/stack", "If-Match", etag, http.StatusPreconditionFailed, ""},
+		{"DELETE", "/databases/db/stacks/stack?flush", "If-Match", etag, http.StatusPreconditionFailed, ""},
+		{"DELETE", "/databases/db/stacks/stack?full", "If-Match", etag, http.StatusPreconditionFailed, ""},
+		{"DELETE", "/databases/db/stacks/stack", "If-Match", stackETag(stack.Version() + 1), http.StatusOK, ""},
+		{"DELETE", "/databases/db/stacks/stack?full", "If-Match", "*", http.StatusNoContent, ""},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, strings.NewReader(`{"element":"bar"}`))
+		if io.header != "" {
+			request.Header.Set(io.header, io.value)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s with %s %s", response.Code, io.code, io.method, io.path, io.header, io.value)
+		}
+		if etag := response.Header().Get("ETag"); etag != io.etag {
+			t.Errorf("ETag is %s, expected %s for %s %s", etag, io.etag, io.method, io.path)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/fern4lvarez/piladb/config"
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/gorilla/mux"
+)
+
+type flagKey struct {
+	value interface{}
+	def   interface{}
+	key   string
+	name  string
+}
+
+// buildConfig sets non-default config values to the Connection reading,
+// in increasing order of precedence, from the config file, the Options
+// and environment variables. Options that are neither explicitly set nor
+// different from their default do not override the values of the config
+// file.
+func (c *Conn) buildConfig(opts Options) error {
+	fileValues := make(map[string]interface{})
+	if opts.ConfigFile != "" {
+		var err error
+		if fileValues, err = config.ReadFile(opts.ConfigFile); err != nil {
+			return err
+		}
+	}
+
+	d := DefaultOptions()
+	flagKeys := []flagKey{
+		{opts.MaxStackSize, d.MaxStackSize, vars.MaxStackSize, "max-stack-size"},
+		{opts.MaxElementSize, d.MaxElementSize, vars.MaxElementSize, "max-element-size"},
+		{opts.ReadTimeout, d.ReadTimeout, vars.ReadTimeout, "read-timeout"},
+		{opts.WriteTimeout, d.WriteTimeout, vars.WriteTimeout, "write-timeout"},
+		{opts.Port, d.Port, vars.Port, "port"},
+		{opts.PersistDir, d.PersistDir, vars.PersistDir, "persist-dir"},
+		{opts.LogLevel, d.LogLevel, vars.LogLevel, "log-level"},
+		{opts.RateLimitClient, d.RateLimitClient, vars.RateLimitClient, "rate-limit-client"},
+		{opts.RateLimitStack, d.RateLimitStack, vars.RateLimitStack, "rate-limit-stack"},
+		{opts.SpillDir, d.SpillDir, vars.SpillDir, "spill-dir"},
+		{opts.CORSOrigins, d.CORSOrigins, vars.CORSOrigins, "cors-origins"},
+		{opts.CORSMethods, d.CORSMethods, vars.CORSMethods, "cors-methods"},
+		{opts.CORSHeaders, d.CORSHeaders, vars.CORSHeaders, "cors-headers"},
+		{opts.StackTemplates, d.StackTemplates, vars.StackTemplates, "stack-templates"},
+		{opts.EncryptionKeys, d.EncryptionKeys, vars.EncryptionKeys, "encryption-keys"},
+		{opts.MaxDatabases, d.MaxDatabases, vars.MaxDatabases, "max-databases"},
+		{opts.MaxStacksPerDatabase, d.MaxStacksPerDatabase, vars.MaxStacksPerDatabase, "max-stacks-per-database"},
+		{opts.MaxMemory, d.MaxMemory, vars.MaxMemory, "max-memory"},
+	}
+
+	for _, fk := range flagKeys {
+		if e := os.Getenv(vars.Env(fk.key)); e != "" {
+			if _, ok := fk.value.(string); ok {
+				c.Config.Set(fk.key, e)
+			} else if i, err := strconv.Atoi(e); err != nil {
+				c.Config.Set(fk.key, vars.DefaultInt(fk.key))
+			} else {
+				c.Config.Set(fk.key, i)
+
+			}
+			continue
+		}
+		explicit := opts.Explicit[fk.name] || fk.value != fk.def
+		if value, ok := fileValues[fk.key]; ok && !explicit {
+			c.Config.Set(fk.key, value)
+			continue
+		}
+		c.Config.Set(fk.key, fk.value)
+	}
+
+	for name, enabled := range opts.Features {
+		c.Config.FeatureFlags[name] = enabled
+	}
+	return nil
+}
+
+// InvalidConfigError is returned when the Config
+// is not valid, with all the errors found.
+type InvalidConfigError []config.ConfigError
+
+// Error returns the errors as a JSON document.
+func (e InvalidConfigError) Error() string {
+	// Do not check error as ConfigError does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(map[string]interface{}{"errors": []config.ConfigError(e)})
+	return string(b)
+}
+
+// validateConfig validates the Config of the Connection along with
+// opts, and returns an InvalidConfigError if any error is found.
+func (c *Conn) validateConfig(opts Options) error {
+	if errs := append(c.Config.Validate(), opts.Validate()...); len(errs) > 0 {
+		return InvalidConfigError(errs)
+	}
+	return nil
+}
+
+// stackHandlerFunc represents a Handler of a Stack.
+type stackHandlerFunc func(w http.ResponseWriter, r *http.Request, stack *pila.Stack)
+
+// secretConfigKeys are the config keys whose values are redacted
+// in the responses, and can not be modified once pilad is running.
+var secretConfigKeys = map[string]bool{vars.EncryptionKeys: true}
+
+// redactedConfigValue replaces the values of the secret config keys.
+const redactedConfigValue = "REDACTED"
+
+// configHandler handles a request to the Conn configuration.
+func (c *Conn) configHandler(w http.ResponseWriter, r *http.Request) {
+	kv := c.Config.Values.StacksKV()
+	for key := range secretConfigKeys {
+		if value, ok := kv.Stacks[key]; ok && value != "" {
+			kv.Stacks[key] = redactedConfigValue
+		}
+	}
+	res, err := kv.ToJSON()
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on response serialization", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+	logResponse(r, http.StatusOK)
+}
+
+// configKeyHandler handles a config value.
+func (c *Conn) configKeyHandler(configKey string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		// we override the mux vars to be able to test
+		// an arbitrary configKey
+		if configKey != "" {
+			vars = map[string]string{
+				"key": configKey,
+			}
+		}
+		value := c.Config.Get(vars["key"])
+		if value == nil {
+			c.goneHandler(w, r, fmt.Sprintf("%s is not set", vars["key"]))
+			return
+		}
+
+		var element pila.Element
+		if r.Method == "GET" {
+			value := c.Config.Get(vars["key"])
+			if secretConfigKeys[vars["key"]] && value != "" {
+				value = redactedConfigValue
+			}
+			element.Value = value
+		}
+		if (r.Method == "POST" || r.Method == "PUT") && secretConfigKeys[vars["key"]] {
+			logResponse(r, http.StatusBadRequest, "reason", "config can not be modified", "key", vars["key"])
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Method == "POST" || r.Method == "PUT" {
+			if r.Body == nil {
+				logResponse(r, http.StatusBadRequest, "reason", "no element provided")
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			err := element.Decode(r.Body)
+			if err != nil {
+				logResponse(r, http.StatusBadRequest, "reason", "error on decoding element", "error", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			c.Config.Set(vars["key"], element.Value)
+			c.setLogLevel()
+		}
+
+		logResponse(r, http.StatusOK, "element", element.Value)
+		w.Header().Set("Content-Type", "application/json")
+
+		b, err := element.ToJSON()
+		if err != nil {
+			logResponse(r, http.StatusBadRequest, "reason", "error on decoding element", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write(b)
+	})
+}
+
+// checkMaxStackSize checks config value for MaxStackSize and execute the
+// wrapped handler if check is validated.
+func (c *Conn) checkMaxStackSize(handler stackHandlerFunc) stackHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+		if s := c.Config.MaxStackSize(); stack.Size() >= s && s != -1 {
+			logResponse(r, http.StatusNotAcceptable, "reason", "value reached", "config", vars.MaxStackSize)
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+
+		handler(w, r, stack)
+	}
+}
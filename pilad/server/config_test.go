@@ -1,4 +1,4 @@
-package main
+package server
 
 import (
 	"bytes"
@@ -23,8 +23,9 @@ func TestBuildConfig(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	maxStackSizeFlag = 32
-	conn.buildConfig()
+	opts := DefaultOptions()
+	opts.MaxStackSize = 32
+	conn.buildConfig(opts)
 
 	if s := conn.Config.Get(vars.MaxStackSize); s != 32 {
 		t.Errorf("MaxStackSize is %v, expected %d", s, 32)
@@ -33,7 +34,7 @@ func TestBuildConfig(t *testing.T) {
 	if err := os.Setenv(vars.Env(vars.MaxStackSize), "42"); err != nil {
 		t.Fatal(err)
 	}
-	conn.buildConfig()
+	conn.buildConfig(opts)
 
 	if s := conn.Config.Get(vars.MaxStackSize); s != 42 {
 		t.Errorf("MaxStackSize is %v, expected %d", s, 42)
@@ -42,13 +43,97 @@ func TestBuildConfig(t *testing.T) {
 	if err := os.Setenv(vars.Env(vars.MaxStackSize), "foo"); err != nil {
 		t.Fatal(err)
 	}
-	conn.buildConfig()
+	conn.buildConfig(opts)
 
 	if s := conn.Config.Get(vars.MaxStackSize); s != -1 {
 		t.Errorf("MaxStackSize is %v, expected %v", s, -1)
 	}
 }
 
+func TestBuildConfig_File(t *testing.T) {
+	f, err := ioutil.TempFile("", "piladb-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString("port: 8080\npersist_dir: /tmp/piladb\nlog_level: off\nmax_stack_size: 5\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if err := os.Setenv(vars.Env(vars.MaxStackSize), "42"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv(vars.Env(vars.MaxStackSize))
+	opts := DefaultOptions()
+	opts.ConfigFile = f.Name()
+
+	conn := NewConn()
+	if err := conn.buildConfig(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	inputOutput := []struct {
+		input  interface{}
+		output interface{}
+	}{
+		{conn.Config.Port(), 8080},
+		{conn.Config.PersistDir(), "/tmp/piladb"},
+		{conn.Config.LogLevel(), config.LogLevelOff},
+		// environment variables override the config file
+		{conn.Config.MaxStackSize(), 42},
+		// flags not explicitly set do not override the config file,
+		// so defaults are used for the missing keys
+		{conn.Config.ReadTimeout(), time.Duration(opts.ReadTimeout)},
+	}
+
+	for _, io := range inputOutput {
+		if io.input != io.output {
+			t.Errorf("value is %v, expected %v", io.input, io.output)
+		}
+	}
+
+	// options explicitly set or different from their
+	// default override the config file
+	opts.Explicit["port"] = true
+	opts.MaxElementSize = 64
+	opts.LogLevel = "debug"
+	if err := conn.buildConfig(opts); err != nil {
+		t.Fatal(err)
+	}
+	if port := conn.Config.Port(); port != vars.PortDefault {
+		t.Errorf("port is %v, expected %v", port, vars.PortDefault)
+	}
+	if size := conn.Config.MaxElementSize(); size != 64 {
+		t.Errorf("max element size is %v, expected %v", size, 64)
+	}
+	if level := conn.Config.LogLevel(); level != "debug" {
+		t.Errorf("log level is %v, expected %v", level, "debug")
+	}
+
+	opts.ConfigFile = f.Name() + "foo"
+	if err := conn.buildConfig(opts); err == nil {
+		t.Error("err is nil")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	conn := NewConn()
+
+	if err := conn.validateConfig(DefaultOptions()); err != nil {
+		t.Errorf("config is not valid: %v", err)
+	}
+
+	conn.Config.Set(vars.Port, 80)
+	err := conn.validateConfig(DefaultOptions())
+	if _, ok := err.(InvalidConfigError); !ok {
+		t.Fatalf("err is %v, expected InvalidConfigError", err)
+	}
+	if expected := `{"errors":[{"field":"PORT","message":"80 is out of range 1025-65535"}]}`; err.Error() != expected {
+		t.Errorf("error is %s, expected %s", err, expected)
+	}
+}
+
 func TestConfigHandler_GET(t *testing.T) {
 	conn := NewConn()
 	conn.Config = config.NewConfig()
@@ -149,6 +234,15 @@ func TestConfigKeyHandler(t *testing.T) {
 				response []byte
 			}{10, expectedNewElementJSON},
 		},
+		{struct {
+			method, key string
+			payload     io.Reader
+		}{"PUT", vars.MaxStackSize, bytes.NewBuffer(expectedElementJSON)},
+			struct {
+				value    interface{}
+				response []byte
+			}{2, expectedElementJSON},
+		},
 	}
 
 	for _, io := range inputOutput {
@@ -241,6 +335,75 @@ func TestConfigKeyHandler_BadRequest(t *testing.T) {
 	}
 }
 
+func TestConfigHandlers_Secret(t *testing.T) {
+	conn := NewConn()
+	conn.Config = config.NewConfig()
+	conn.Config.Set(vars.EncryptionKeys, "2024:q83vEjRWeJCrze8SNFZ4kA==")
+
+	inputOutput := []struct {
+		input struct {
+			method, url string
+			handler     http.Handler
+		}
+		output struct {
+			code     int
+			response string
+		}
+	}{
+		{
+			struct {
+				method, url string
+				handler     http.Handler
+			}{"GET", "/_config", http.HandlerFunc(conn.configHandler)},
+			struct {
+				code     int
+				response string
+			}{http.StatusOK, `{"stacks":{"ENCRYPTION_KEYS":"REDACTED"}}`},
+		},
+		{
+			struct {
+				method, url string
+				handler     http.Handler
+			}{"GET", "/_config/" + vars.EncryptionKeys, conn.configKeyHandler(vars.EncryptionKeys)},
+			struct {
+				code     int
+				response string
+			}{http.StatusOK, `{"element":"REDACTED"}`},
+		},
+		{
+			struct {
+				method, url string
+				handler     http.Handler
+			}{"PUT", "/_config/" + vars.EncryptionKeys, conn.configKeyHandler(vars.EncryptionKeys)},
+			struct {
+				code     int
+				response string
+			}{http.StatusBadRequest, ""},
+		},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.input.method, io.input.url, bytes.NewBufferString(`{"element":"2025:ASNFZ4mrze8BI0VniavN7w=="}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+
+		io.input.handler.ServeHTTP(response, request)
+
+		if response.Code != io.output.code {
+			t.Errorf("response code of %s %s is %v, expected %v", io.input.method, io.input.url, response.Code, io.output.code)
+		}
+		if body := response.Body.String(); body != io.output.response {
+			t.Errorf("response of %s %s is %s, expected %s", io.input.method, io.input.url, body, io.output.response)
+		}
+	}
+
+	if keys := conn.Config.EncryptionKeys(); keys == nil || keys.Current() != "2024" {
+		t.Errorf("encryption keys are %v, expected %v", keys, "2024")
+	}
+}
+
 func TestCheckMaxStackSize(t *testing.T) {
 	s := pila.NewStack("stack", time.Now())
 	s.Push("foo")
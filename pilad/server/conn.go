@@ -0,0 +1,1044 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config"
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+	"github.com/fern4lvarez/piladb/pkg/version"
+)
+
+// Conn represents the current piladb connection, containing
+// the Pila instance and its status.
+type Conn struct {
+	Pila    *pila.Pila
+	Config  *config.Config
+	Status  *Status
+	Metrics *Metrics
+	// Latencies of the HTTP requests, by route
+	Latencies *Latencies
+	// OpLatencies of the push, pop and peek operations
+	OpLatencies *pila.OpLatencies
+	Peers       *PeerList
+	// Auth contains the API Tokens, authentication
+	// is disabled if it has none
+	Auth *Auth
+	// Log records the operations modifying the Pila,
+	// nil if disk persistence is disabled
+	Log *persist.Log
+	// Shutdown coordinates the graceful shutdown of pilad
+	Shutdown *Shutdown
+	// Replication streams the operations modifying the Pila
+	// to followers, or follows a primary
+	Replication *Replication
+	// RateLimiter limits the rate of requests
+	// of clients and on stacks
+	RateLimiter *RateLimiter
+	// Webhooks are called with the events of stacks
+	Webhooks *Webhooks
+	// Operations are the long-running operations in flight
+	Operations *Operations
+	// Tenants contains the quotas of the tenants
+	Tenants *Tenants
+	// Cluster keeps the nodes of the cluster pilad
+	// belongs to, and the Stacks each of them owns
+	Cluster *Cluster
+	// Raft replicates the operations modifying the Pila
+	// across the nodes of a Raft group
+	Raft *Raft
+	// Snapshots takes snapshots of the Pila into a
+	// directory, disabled unless enabled
+	Snapshots *Snapshots
+	// Archives moves Stacks out of memory into archive
+	// files, disabled unless enabled
+	Archives *Archives
+	// IdempotencyKeys remembers the responses to PUSH
+	// operations given an Idempotency-Key header
+	IdempotencyKeys *IdempotencyKeys
+	// Audit records the requests modifying pilad
+	Audit *Audit
+	// ACL contains the network access rules of
+	// pilad, allowing any client if it has none
+	ACL *ACL
+	// Trash keeps the deleted Databases and Stacks
+	// for a while, disabled unless enabled
+	Trash *Trash
+	// Remotes contains the Databases of other
+	// pilad instances mounted by this one
+	Remotes *Remotes
+	// LogFormat is the format of the log entries
+	LogFormat logger.Format
+
+	// readOnly is 1 if pilad rejects the requests modifying it
+	readOnly int32
+	// debug is 1 if the debug endpoints are enabled
+	debug int32
+	// started is 1 once pilad finished starting up
+	started int32
+
+	// stackLocks order the Records of the operations on
+	// the same Stacks as they are applied
+	stackLocks stackLocks
+
+	startTime time.Time
+}
+
+// NewConn creates and returns a new piladb connection.
+func NewConn() *Conn {
+	conn := &Conn{}
+	conn.Pila = pila.NewPila()
+	conn.Pila.OnWatermark(watermarkAlert)
+	conn.Config = config.NewConfig().Default()
+	conn.Status = NewStatus(version.Version(version.VERSION), time.Now().UTC(), MemStats())
+	conn.Metrics = NewMetrics()
+	conn.Latencies = NewLatencies()
+	conn.OpLatencies = pila.NewOpLatencies()
+	conn.Peers = NewPeerList(nil)
+	conn.Auth = NewAuth()
+	conn.Shutdown = NewShutdown()
+	conn.RateLimiter = NewRateLimiter()
+	conn.Webhooks = NewWebhooks()
+	conn.Operations = NewOperations()
+	conn.Tenants = NewTenants()
+	conn.Replication = NewReplication()
+	conn.Cluster = NewCluster()
+	conn.Raft = NewRaft()
+	conn.Snapshots = NewSnapshots()
+	conn.Archives = NewArchives()
+	conn.IdempotencyKeys = NewIdempotencyKeys(idempotencyCapacity, idempotencyTTL)
+	conn.Audit = NewAudit(auditCapacity)
+	conn.ACL = NewACL()
+	conn.Trash = NewTrash()
+	conn.Remotes = NewRemotes()
+	conn.LogFormat = logger.FormatText
+	conn.startTime = time.Now()
+	return conn
+}
+
+// withDate returns the request with the current date attached to its
+// context, so every operation it performs is dated the same.
+func withDate(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), dateKey, time.Now().UTC()))
+}
+
+// requestDate returns the date attached to the request context by
+// withDate, or the current date if the request has none.
+func requestDate(r *http.Request) time.Time {
+	if t, ok := r.Context().Value(dateKey).(time.Time); ok {
+		return t
+	}
+	return time.Now().UTC()
+}
+
+// Connection Handlers
+
+// rootHandler redirects to the pilad documentation site hosted on Github.
+func (c *Conn) rootHandler(w http.ResponseWriter, r *http.Request) {
+	redirAddress := fmt.Sprintf("https://raw.githubusercontent.com/fern4lvarez/piladb/%s/pilad/README.md", version.CommitHash())
+	logResponse(r, http.StatusMovedPermanently, "location", redirAddress)
+	http.Redirect(w, r, redirAddress, http.StatusMovedPermanently)
+}
+
+// statusHandler writes the piladb status into the response.
+func (c *Conn) statusHandler(w http.ResponseWriter, r *http.Request) {
+	if acceptsProtobuf(r) {
+		writeProtobuf(w, r, http.StatusOK, c.currentStatus(r).ToProto())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(c.currentStatus(r).ToJSON())
+}
+
+// databasesHandler returns the information of the running databases.
+func (c *Conn) databasesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "PUT" && r.FormValue("remote") != "" {
+		c.mountDatabaseHandler(w, r)
+		return
+	}
+	if r.Method == "PUT" {
+		c.createDatabaseHandler(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(c.Pila.FilteredStatus(tenantFilter(r)).ToJSON())
+}
+
+// createDatabaseHandler creates a Database and returns 201 and the ID and name
+// of the Database.
+func (c *Conn) createDatabaseHandler(w http.ResponseWriter, r *http.Request) {
+	// the name of a tenant is already namespaced
+	name := r.FormValue("name")
+	unqualified := name
+	if tenant := requestTenant(r); tenant != "" {
+		unqualified = strings.TrimPrefix(name, namespace(tenant, ""))
+	}
+	if err := validateName("name", unqualified); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var maxMemory int64
+	if v := r.FormValue("max_memory"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			logResponse(r, http.StatusBadRequest, "reason", "invalid max_memory", "value", v)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		maxMemory = n
+	}
+
+	spill, err := intParam(r, "spill", 0, math.MaxInt32)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if spill > 0 && c.Pila.SpillDir() == "" {
+		logResponse(r, http.StatusBadRequest, "reason", "spill requires SPILL_DIR")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var template config.StackTemplate
+	if v := r.FormValue("template"); v != "" {
+		var ok bool
+		if template, ok = c.Config.StackTemplates()[v]; !ok {
+			logResponse(r, http.StatusBadRequest, "reason", "unknown template", "template", v)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	db := pila.NewDatabase(name)
+	db.SetMaxMemory(maxMemory)
+	db.SetSpill(spill)
+	defer c.stackLocks.lockAll()()
+	if _, ok := c.Remotes.Remote(name); ok {
+		err = fmt.Errorf("remote database %s is mounted", name)
+	} else {
+		err = c.Pila.AddDatabase(db)
+	}
+	if err != nil {
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	now := requestDate(r)
+	c.persist(r.Context(), persist.Record{Op: persist.OpCreateDatabase, Time: now, Database: db.Name, MaxMemory: maxMemory, Spill: spill, ID: db.ID.String()})
+	if err := c.createTemplateStacks(r.Context(), db, template, now); err != nil {
+		logResponse(r, http.StatusInternalServerError, "reason", "error on creating stacks of template", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusCreated)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(db.Status().ToJSON())
+}
+
+// databaseHandler returns the information of a single database given its ID
+// or name, deletes it or renames it.
+func (c *Conn) databaseHandler(w http.ResponseWriter, r *http.Request) {
+	db := databaseFromContext(r)
+
+	if r.Method == "PATCH" {
+		c.renameDatabaseHandler(w, r, db)
+		return
+	}
+
+	if r.Method == "DELETE" {
+		c.deleteDatabaseHandler(w, r, db)
+		return
+	}
+
+	if acceptsProtobuf(r) {
+		writeProtobuf(w, r, http.StatusOK, db.Status().ToProto())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(db.Status().ToJSON())
+}
+
+// deleteDatabaseHandler deletes the Database along with its Stacks,
+// and returns 204. If cascade is false, the Database is only deleted
+// if all its Stacks are empty, and 409 is returned otherwise. If the
+// dry_run parameter is true, it returns 200 and what would be deleted.
+func (c *Conn) deleteDatabaseHandler(w http.ResponseWriter, r *http.Request, db *pila.Database) {
+	cascade := true
+	if value := r.FormValue("cascade"); value != "" {
+		var err error
+		if cascade, err = strconv.ParseBool(value); err != nil {
+			logResponse(r, http.StatusBadRequest, "reason", "cascade must be a boolean", "value", value)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if !cascade && !db.Empty() {
+		logResponse(r, http.StatusConflict, "reason", "database has non-empty stacks", "database", db.Name)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	dryRun, ok := dryRunParam(w, r)
+	if !ok {
+		return
+	}
+	if dryRun {
+		writePreview(w, r, db.PreviewDelete())
+		return
+	}
+
+	unlock := c.stackLocks.lockAll()
+	c.deleteDatabase(r.Context(), db, requestDate(r))
+	unlock()
+	logResponse(r, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// flushDatabaseHandler flushes every Stack of the Database, without
+// deleting them, and returns 200 and the status of the Database.
+// Returns 423 if any of its Stacks is locked by another owner, in
+// which case none of them is flushed. If the dry_run parameter is
+// true, it returns 200 and what would be flushed.
+func (c *Conn) flushDatabaseHandler(w http.ResponseWriter, r *http.Request) {
+	r = withDate(r)
+	db := databaseFromContext(r)
+
+	locked := false
+	db.ForEachStack(func(s *pila.Stack) bool {
+		locked = !c.checkLock(w, r, s)
+		return !locked
+	})
+	if locked {
+		return
+	}
+	dryRun, ok := dryRunParam(w, r)
+	if !ok {
+		return
+	}
+	if dryRun {
+		writePreview(w, r, db.PreviewFlush())
+		return
+	}
+
+	now := requestDate(r)
+	unlock := c.stackLocks.lockAll()
+	for _, s := range db.Flush() {
+		s.Update(now)
+		c.persistStack(r.Context(), s, persist.Record{Op: persist.OpFlush, Time: now})
+	}
+	unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(db.Status().ToJSON())
+}
+
+// stacksHandler handles the stacks of a database, being able to get the status
+// of them, or create a new one.
+func (c *Conn) stacksHandler(w http.ResponseWriter, r *http.Request) {
+	r = withDate(r)
+	db := databaseFromContext(r)
+
+	if r.Method == "PUT" {
+		c.createStackHandler(w, r, db)
+		return
+	}
+
+	var status pila.StackStatuser
+	_ = r.ParseForm()
+	_, kv := r.Form["kv"]
+	opts, err := stacksOptionsParams(r)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !kv && acceptsProtobuf(r) {
+		writeProtobufMessage(w, r, c.archivedStacksStatus(db, opts))
+		return
+	}
+	if kv {
+		status = db.StacksKV()
+	} else {
+		status = c.archivedStacksStatus(db, opts)
+	}
+
+	res, err := status.ToJSON()
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on response serialization", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+	logResponse(r, http.StatusOK)
+}
+
+// createStackHandler handles the creation of a stack, given a database
+// and the time of creation. Returns the status of the new stack.
+func (c *Conn) createStackHandler(w http.ResponseWriter, r *http.Request, db *pila.Database) {
+	now := requestDate(r)
+	name := r.FormValue("name")
+	if err := validateName("name", name); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	maxSize, policy, err := limitParams(r)
+	var rateLimit, spill, history, compress int
+	if err == nil {
+		rateLimit, err = intParam(r, "rate_limit", 0, math.MaxInt32)
+	}
+	if err == nil {
+		spill, err = intParam(r, "spill", 0, math.MaxInt32)
+	}
+	if err == nil {
+		history, err = intParam(r, "history", 0, math.MaxInt32)
+	}
+	if err == nil {
+		compress, err = intParam(r, "compress", 0, math.MaxInt32)
+	}
+	var unique pila.UniquePolicy
+	if err == nil {
+		unique, err = uniqueParam(r)
+	}
+	var ttl time.Duration
+	if err == nil {
+		ttl, err = ttlParam(r)
+	}
+	var encrypt bool
+	if value := r.FormValue("encrypt"); err == nil && value != "" {
+		if encrypt, err = strconv.ParseBool(value); err != nil {
+			err = fmt.Errorf("encrypt must be a boolean, got %s", value)
+		}
+	}
+	var watermarks pila.Watermarks
+	if err == nil {
+		watermarks, err = watermarksParams(r)
+	}
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	structure := pila.Structure(r.FormValue("type"))
+	switch structure {
+	case "":
+		structure = pila.StructureStack
+	case pila.StructureStack, pila.StructureQueue, pila.StructurePriority:
+	default:
+		logResponse(r, http.StatusBadRequest, "reason", "unknown type", "type", structure)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	store := r.FormValue("store")
+	if store == "" && spill > 0 {
+		store = pila.StoreSpill
+	}
+	if _, ok := pila.LookupStore(store); store != "" && !ok {
+		logResponse(r, http.StatusBadRequest, "reason", "unknown store", "store", store)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if store == pila.StoreMemory {
+		store = ""
+	}
+
+	if store != "" && compress > 0 {
+		logResponse(r, http.StatusBadRequest, "reason", "compress can not be combined with spill nor store")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if encrypt && c.Pila.Keyring() == nil {
+		logResponse(r, http.StatusBadRequest, "reason", "encrypt requires ENCRYPTION_KEYS")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if encrypt && (store != "" || unique != "") {
+		logResponse(r, http.StatusBadRequest, "reason", "encrypt can not be combined with spill, store nor unique")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// stacks spill like their database, unless given their own
+	// store, or compressing or encrypting their elements
+	if store == "" && r.FormValue("store") == "" && compress == 0 && !encrypt && structure == pila.StructureStack && c.Pila.SpillDir() != "" {
+		if spill = db.Spill(); spill > 0 {
+			store = pila.StoreSpill
+		}
+	}
+	if store == pila.StoreSpill && spill == 0 {
+		spill = db.Spill()
+	}
+
+	stack := pila.NewStructureWithLimit(structure, name, now, maxSize, policy)
+	if store != "" {
+		spillDir := c.Pila.SpillDir()
+		if store == pila.StoreSpill && (spillDir == "" || structure != pila.StructureStack) {
+			logResponse(r, http.StatusBadRequest, "reason", "spill requires SPILL_DIR and type stack")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if stack, err = pila.NewStackWithStore(structure, name, now, store, pila.StoreOptions{Dir: spillDir, Spill: spill}); err != nil {
+			logResponse(r, http.StatusInternalServerError, "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		stack.MaxSize, stack.Policy = maxSize, policy
+	}
+	stack.RateLimit = rateLimit
+	stack.TTL = ttl
+	stack.SetUnique(unique)
+	stack.SetHistoryDepth(history)
+	stack.SetCompress(compress)
+	// Do not check error as the watermarks are already validated.
+	_ = stack.SetWatermarks(watermarks)
+	if encrypt {
+		if err := stack.SetEncryption(c.Pila.Keyring()); err != nil {
+			logResponse(r, http.StatusBadRequest, "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	unlock := c.stackLocks.lock(stack)
+	err = db.AddStack(stack)
+	if err != nil {
+		unlock()
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	stack.Update(now)
+	c.persistStack(r.Context(), stack, persist.Record{Op: persist.OpCreateStack, Time: now, Type: structure, MaxSize: maxSize, Policy: policy, RateLimit: rateLimit, TTL: ttl, Spill: stack.Spill(), Store: store, Unique: unique, History: history, Compress: compress, Encrypted: encrypt, Watermarks: watermarksRecord(stack), ID: stack.ID.String()})
+	unlock()
+
+	status := stack.Status()
+	if acceptsProtobuf(r) {
+		// Do not check error as the peek of a new stack is nil.
+		b, _ := status.ToProto()
+		writeProtobuf(w, r, http.StatusCreated, b)
+		return
+	}
+
+	// Do not check error as the Status of a new stack does
+	// not contain types that could cause such case.
+	// See http://golang.org/src/encoding/json/encode.go?s=5438:5481#L125
+	res, _ := status.ToJSON()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(res)
+	logResponse(r, http.StatusCreated)
+}
+
+// stackHandler handles operations on a single stack of a database. It holds
+// the PUSH, POP, PEEK and SIZE methods, and the stack deletion and renaming.
+func (c *Conn) stackHandler(w http.ResponseWriter, r *http.Request) {
+	r = withDate(r)
+	db := databaseFromContext(r)
+	stack := stackFromContext(r)
+
+	switch {
+	case r.Method == "GET":
+		_ = r.ParseForm()
+		if _, ok := r.Form["peek"]; ok {
+			defer c.observeOp(pila.OpPeek, time.Now())
+			c.peekStackHandler(w, r, stack)
+			return
+		}
+		if _, ok := r.Form["size"]; ok {
+			c.sizeStackHandler(w, r, stack)
+			return
+		}
+		c.statusStackHandler(w, r, stack)
+		return
+
+	case r.Method == "POST":
+		defer c.observeOp(pila.OpPush, time.Now())
+		c.idempotent(c.checkMaxStackSize(c.pushStackHandler))(w, r, stack)
+		return
+
+	case r.Method == "DELETE":
+		_ = r.ParseForm()
+		if _, ok := r.Form["flush"]; ok {
+			c.flushStackHandler(w, r, stack)
+			return
+		}
+		if _, ok := r.Form["full"]; ok {
+			c.deleteStackHandler(w, r, db, stack)
+			return
+		}
+		// pops waiting for an element would skew the latency
+		if r.FormValue("wait") == "" {
+			defer c.observeOp(pila.OpPop, time.Now())
+		}
+		c.popStackHandler(w, r, stack)
+		return
+
+	case r.Method == "PATCH":
+		c.renameStackHandler(w, r, db, stack)
+		return
+	}
+}
+
+// limitParams returns the max_size and policy parameters of a
+// request creating a Stack. max_size is 0 if not present, and policy
+// defaults to reject. It returns an error if max_size is not a positive
+// integer, or if policy is unknown or given without max_size.
+func limitParams(r *http.Request) (int, pila.OverflowPolicy, error) {
+	maxSize, err := intParam(r, "max_size", 0, math.MaxInt32)
+	if err != nil {
+		return 0, "", err
+	}
+
+	policy := pila.OverflowPolicy(r.FormValue("policy"))
+	switch {
+	case policy == "" && maxSize == 0:
+		return 0, "", nil
+	case policy == "":
+		return maxSize, pila.OverflowReject, nil
+	case maxSize == 0:
+		return 0, "", fmt.Errorf("policy %s requires max_size", policy)
+	case policy != pila.OverflowReject && policy != pila.OverflowDropOldest:
+		return 0, "", fmt.Errorf("unknown policy %s", policy)
+	}
+	return maxSize, policy, nil
+}
+
+// stacksOptionsParams returns the StacksOptions given by the filter,
+// sort and order parameters of a request listing Stacks, where order
+// is either asc or desc. It returns an error if any of them is invalid.
+func stacksOptionsParams(r *http.Request) (pila.StacksOptions, error) {
+	opts := pila.StacksOptions{
+		Filter: r.FormValue("filter"),
+		Sort:   pila.StacksSort(r.FormValue("sort")),
+	}
+	switch order := r.FormValue("order"); order {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, fmt.Errorf("unknown order %s", order)
+	}
+	return opts, opts.Validate()
+}
+
+// uniqueParam returns the UniquePolicy given by the unique parameter
+// of r, where true means rejecting duplicated elements.
+func uniqueParam(r *http.Request) (pila.UniquePolicy, error) {
+	switch unique := r.FormValue("unique"); unique {
+	case "", "false":
+		return "", nil
+	case "true", string(pila.UniqueReject):
+		return pila.UniqueReject, nil
+	case string(pila.UniqueMoveToTop):
+		return pila.UniqueMoveToTop, nil
+	default:
+		return "", fmt.Errorf("unknown unique %s", unique)
+	}
+}
+
+// stackOperationHandler adapts the handler of an operation on a single
+// stack, so it can be routed on its own sub-resource.
+func (c *Conn) stackOperationHandler(handler func(http.ResponseWriter, *http.Request, *pila.Stack)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(w, withDate(r), stackFromContext(r))
+	}
+}
+
+// statusStackHandler returns the status of the Stack, and its
+// version as ETag. Returns 304 if it matches If-None-Match.
+func (c *Conn) statusStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	stack.Read(requestDate(r))
+	status := stack.Status()
+	if notModified(w, r, status.Version) {
+		return
+	}
+	if acceptsProtobuf(r) {
+		writeProtobufMessage(w, r, status)
+		return
+	}
+	logResponse(r, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as we consider that a flushed
+	// stack has no JSON encoding issues.
+	b, _ := status.ToJSON()
+	w.Write(b)
+}
+
+// peekStackHandler returns the peek of the Stack without modifying it, and
+// its version as ETag. Returns 304 if it matches If-None-Match. If a tag
+// is given, the element closest to the top with such tag is returned. The
+// Metadata of the element is returned as headers, see writeElementMetadata.
+func (c *Conn) peekStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	value, m, version, _ := stack.PeekWithMetadata(r.FormValue("tag"))
+	stack.Read(requestDate(r))
+	if notModified(w, r, version) {
+		return
+	}
+
+	c.writeElementMetadata(w, r, value, m)
+}
+
+// sizeStackHandler returns the size of the Stack.
+func (c *Conn) sizeStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	stack.Read(requestDate(r))
+	logResponse(r, http.StatusOK, "size", stack.Size())
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as we consider the size
+	// of a stack valid for a JSON encoding.
+	w.Write(stack.SizeToJSON())
+}
+
+// pushStackHandler adds an element into a Stack and returns 200 and the element.
+// If a ttl is given, or the Stack has a TTL, the element expires after such
+// duration. If the If-Match header is given, the element is only pushed if
+// it matches the ETag of the Stack, and 412 is returned otherwise. The
+// element may be sent and returned as a protobuf Element message. A tag
+// may be given by the tag key of the element or the tag parameter, and
+// 400 is returned if it is not valid.
+func (c *Conn) pushStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	now := requestDate(r)
+	if r.Body == nil {
+		logResponse(r, http.StatusBadRequest, "reason", "no element provided")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ttl, err := ttlParam(r)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	err = c.readBodyInto(buf, w, r)
+	if err == errBodyTooLarge {
+		c.tooLargeHandler(w, r, err)
+		return
+	}
+
+	var element pila.Element
+	if isProtobuf(r) {
+		if err == nil {
+			err = element.DecodeProto(buf.Bytes())
+		}
+	} else if codec, ok := requestCodec(r); ok {
+		if err == nil {
+			err = codec.Unmarshal(buf.Bytes(), &element)
+		}
+	} else if contentType, ok := binaryContentType(r); ok {
+		element.ContentType = contentType
+		element.Value = append([]byte(nil), buf.Bytes()...)
+	} else if err == nil && c.IsEnabled(strictSchemaFeature) {
+		err = element.DecodeStrict(buf)
+	} else if err == nil {
+		err = element.Decode(buf)
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, jsonError("element", err))
+		return
+	}
+	value, err := element.StackValue()
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on decoding element", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if element.Priority != nil && stack.Type != pila.StructurePriority {
+		logResponse(r, http.StatusBadRequest, "reason", "priority given to a stack of another type", "type", stack.Type)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	tag := tagParam(r, element)
+	record := persist.Record{Op: persist.OpPush, Time: now, Element: element.Value, Priority: element.Priority, ContentType: element.ContentType, Tag: tag}
+	var expiresAt time.Time
+	if ttl == 0 {
+		ttl = stack.TTL
+	}
+	if ttl > 0 {
+		expiresAt = now.Add(ttl)
+		record.ExpiresAt = &expiresAt
+	}
+	defer c.stackLocks.lock(stack)()
+	err = stack.PushWithOptionsCtx(r.Context(), value, pila.PushOptions{Priority: element.Priority, ExpiresAt: expiresAt, If: ifMatch(r), Size: element.Size(), Tag: tag})
+	if isContextError(err) {
+		c.canceledHandler(w, r, err)
+		return
+	}
+	if err == pila.ErrConditionFailed {
+		logResponse(r, http.StatusPreconditionFailed, "error", err)
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	if err == pila.ErrInvalidTag {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err == pila.ErrElementTooLarge {
+		c.tooLargeHandler(w, r, err)
+		return
+	}
+	if err == pila.ErrMemoryLimit {
+		c.memoryLimitHandler(w, r, err)
+		return
+	}
+	if err != nil {
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	stack.Update(now)
+	c.persistStack(r.Context(), stack, record)
+
+	if acceptsProtobuf(r) {
+		writeProtobufMessage(w, r, element)
+		return
+	}
+	if codec, ok := acceptedCodec(r); ok {
+		writeCodecElement(w, r, codec, element)
+		return
+	}
+
+	logResponse(r, http.StatusOK, "element", element.Value)
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as we consider our element
+	// suitable for a JSON encoding.
+	buf.Reset()
+	_ = element.WriteJSON(buf)
+	w.Write(buf.Bytes())
+}
+
+// popStackHandler extracts the peek element of a Stack, returns 200 and returns it.
+// If if_version, if_peek_equals or the If-Match header are given, the element is
+// only popped if the Stack has such version, peek or ETag, and 412 is returned
+// otherwise. If wait is
+// given, an empty Stack is waited on for such duration before returning 204.
+// The Metadata of an element popped unconditionally without waiting is
+// returned as headers, see writeElementMetadata.
+func (c *Conn) popStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	now := requestDate(r)
+	cond, err := popCondition(r)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	wait, err := popWait(r, c.Config.WriteTimeout()*time.Second)
+	if err == nil && wait > 0 && cond != nil {
+		err = errors.New("wait can not be combined with a condition")
+	}
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if wait > 0 {
+		c.popWaitStackHandler(w, r, stack, wait)
+		return
+	}
+
+	defer c.stackLocks.lock(stack)()
+	var value interface{}
+	var m pila.Metadata
+	var ok bool
+	if cond == nil {
+		if err = r.Context().Err(); err != nil {
+			c.canceledHandler(w, r, err)
+			return
+		}
+		value, m, ok = stack.PopWithMetadata()
+	} else if value, ok, err = stack.PopIf(cond); err == pila.ErrConditionFailed {
+		logResponse(r, http.StatusPreconditionFailed, "error", err)
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	if !ok {
+		logResponse(r, http.StatusNoContent)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	stack.Update(now)
+	c.persistStack(r.Context(), stack, persist.Record{Op: persist.OpPop, Time: now})
+
+	c.writeElementMetadata(w, r, value, m)
+}
+
+// flushStackHandler flushes the Stack, setting the size to 0 and emptying all
+// the content. Returns 412 if the If-Match header does not match its ETag.
+// If the dry_run parameter is true, it returns 200 and what would be flushed.
+func (c *Conn) flushStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	now := requestDate(r)
+	if !checkIfMatch(w, r, stack) {
+		return
+	}
+	dryRun, ok := dryRunParam(w, r)
+	if !ok {
+		return
+	}
+	if dryRun {
+		writePreview(w, r, stack.PreviewFlush())
+		return
+	}
+	unlock := c.stackLocks.lock(stack)
+	stack.Flush()
+	stack.Update(now)
+	c.persistStack(r.Context(), stack, persist.Record{Op: persist.OpFlush, Time: now})
+	unlock()
+
+	logResponse(r, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as we consider that a flushed
+	// stack has no JSON encoding issues.
+	b, _ := stack.Status().ToJSON()
+	w.Write(b)
+}
+
+// deleteStackHandler deletes the Stack from a database. Returns 412
+// if the If-Match header does not match its ETag. If the dry_run
+// parameter is true, it returns 200 and what would be deleted.
+func (c *Conn) deleteStackHandler(w http.ResponseWriter, r *http.Request, database *pila.Database, stack *pila.Stack) {
+	if !checkIfMatch(w, r, stack) {
+		return
+	}
+	dryRun, ok := dryRunParam(w, r)
+	if !ok {
+		return
+	}
+	if dryRun {
+		writePreview(w, r, stack.PreviewDelete())
+		return
+	}
+	unlock := c.stackLocks.lock(stack)
+	c.deleteStack(r.Context(), database, stack, requestDate(r))
+	unlock()
+
+	logResponse(r, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+	return
+}
+
+// openLog opens the persistence Log stored in dir and
+// replays it into the Pila of the connection.
+func (c *Conn) openLog(dir string) error {
+	l, err := persist.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := l.Replay(c.Pila); err != nil {
+		l.Close()
+		return err
+	}
+	c.Log = l
+	return nil
+}
+
+// persist publishes a Record to the followers, proposes it to the
+// Raft group on behalf of the request of ctx, if any, and appends it
+// into the persistence Log, if enabled. Errors are logged but not
+// returned. It is called within the stackLocks of the operation, so
+// followers and the Log receive the Records in the order they are
+// applied.
+func (c *Conn) persist(ctx context.Context, record persist.Record) {
+	c.Replication.publish(record)
+	c.Raft.propose(ctx, record)
+	if c.Log == nil {
+		return
+	}
+	if err := c.Log.Append(record); err != nil {
+		logger.Error("error on persisting", "op", record.Op, "error", err)
+	}
+}
+
+// persistStack persists a Record of an operation on a Stack, dated
+// by the caller. The Stack and its Database are set by it, and the
+// pushed element is sealed if the Stack is encrypted, so it is not
+// persisted nor replicated in plain. It must be called holding the
+// stackLocks of the Stack since before the operation was applied.
+func (c *Conn) persistStack(ctx context.Context, stack *pila.Stack, record persist.Record) {
+	if stack.Database == nil {
+		return
+	}
+	record.Database = stack.Database.Name
+	record.Stack = stack.Name
+	if keys := stack.Encryption(); keys != nil && record.Op == persist.OpPush {
+		value, err := pila.Element{Value: record.Element, ContentType: record.ContentType}.StackValue()
+		if err == nil {
+			var sealed pila.Sealed
+			if sealed, err = keys.Seal(value); err == nil {
+				record.Element, record.ContentType, record.Sealed = nil, "", &sealed
+			}
+		}
+		if err != nil {
+			logger.Error("error on persisting", "op", record.Op, "error", err)
+			return
+		}
+	}
+	c.persist(ctx, record)
+}
+
+// notFoundHandler logs and returns a 404 NotFound response.
+func (c *Conn) notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	logResponse(r, http.StatusNotFound)
+	http.NotFound(w, r)
+}
+
+// goneHandler logs and returns a 410 Gone response with information
+// about the missing resource.
+func (c *Conn) goneHandler(w http.ResponseWriter, r *http.Request, message string) {
+	logResponse(r, http.StatusGone, "reason", message)
+	w.WriteHeader(http.StatusGone)
+}
+
+// statusClientClosedRequest is the non-standard status code of
+// the requests whose client disconnected before being served.
+const statusClientClosedRequest = 499
+
+// isContextError determines whether err is returned
+// by an operation whose context is done.
+func isContextError(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
+
+// canceledHandler logs and returns 499 for a request whose client
+// disconnected, or 503 if its deadline was exceeded, so its work is
+// aborted.
+func (c *Conn) canceledHandler(w http.ResponseWriter, r *http.Request, err error) {
+	code := statusClientClosedRequest
+	if err == context.DeadlineExceeded {
+		code = http.StatusServiceUnavailable
+	}
+	logResponse(r, code, "error", err)
+	w.WriteHeader(code)
+}
@@ -1,17 +1,25 @@
-package main
+package server
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/fern4lvarez/piladb/pila"
 	"github.com/fern4lvarez/piladb/pkg/date"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+	"github.com/fern4lvarez/piladb/pkg/stack"
 	"github.com/fern4lvarez/piladb/pkg/uuid"
 	"github.com/fern4lvarez/piladb/pkg/version"
 )
@@ -36,6 +44,31 @@ func TestNewConn(t *testing.T) {
 	}
 }
 
+func TestRequestDate(t *testing.T) {
+	request, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now().UTC()
+	if date := requestDate(request); date.Before(before) {
+		t.Errorf("date is %v, expected not before %v", date, before)
+	}
+
+	dated := withDate(request)
+	date := requestDate(dated)
+	if date.Before(before) {
+		t.Errorf("date is %v, expected not before %v", date, before)
+	}
+	time.Sleep(time.Millisecond)
+	if again := requestDate(dated); !again.Equal(date) {
+		t.Errorf("date is %v, expected %v", again, date)
+	}
+	if other := requestDate(withDate(request)); other.Equal(date) {
+		t.Errorf("date is %v, expected to differ from %v", other, date)
+	}
+}
+
 func TestRootHandler(t *testing.T) {
 	conn := NewConn()
 	request, err := http.NewRequest("GET", "/", nil)
@@ -94,6 +127,81 @@ func TestStatusHandler(t *testing.T) {
 	}
 }
 
+func TestStatusHandler_Stats(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = conn.Pila.AddDatabase(db)
+	_ = db.AddStack(stack)
+	_ = stack.PushN([]interface{}{"foo", "bar"})
+	stack.Pop()
+
+	request, err := http.NewRequest("GET", "/_status", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+
+	conn.statusHandler(response, request)
+
+	var status struct {
+		Stats pila.Stats `json:"stats"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := status.Stats
+	if stats.NumberDatabases != 1 || stats.NumberStacks != 1 || stats.Size != 1 || stats.PeakSize != 2 {
+		t.Errorf("stats are %+v, expected 1 database, 1 stack, size 1 and peak size 2", stats)
+	}
+	if stats.Pushes != 2 || stats.Pops != 1 {
+		t.Errorf("stats have %d pushes and %d pops, expected %d and %d", stats.Pushes, stats.Pops, 2, 1)
+	}
+	if stats.PushedAt == nil || stats.PoppedAt == nil {
+		t.Errorf("stats have pushed_at %v and popped_at %v, expected both", stats.PushedAt, stats.PoppedAt)
+	}
+}
+
+func TestStatusHandler_Latencies(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	db.CreateStack("stack", time.Now())
+	handler := Router(conn)
+
+	for _, r := range []struct{ method, path, body string }{
+		{"POST", "/databases/db/stacks/stack", `{"element":"foo"}`},
+		{"GET", "/databases/db/stacks/stack?peek", ""},
+		{"DELETE", "/databases/db/stacks/stack", ""},
+		{"GET", "/databases/db/stacks/stack?size", ""},
+	} {
+		request, _ := http.NewRequest(r.method, r.path, strings.NewReader(r.body))
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	request, _ := http.NewRequest("GET", "/_status", nil)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	var status struct {
+		Latencies map[string]pila.Percentiles `json:"latencies"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, op := range []string{pila.OpPush, pila.OpPop, pila.OpPeek} {
+		p, ok := status.Latencies[op]
+		if !ok || p.Count != 1 {
+			t.Errorf("latencies of %s are %+v, expected 1 observed", op, p)
+		}
+		if p.P50 <= 0 || p.P50 > p.P95 || p.P95 > p.P99 {
+			t.Errorf("latencies of %s are %+v, expected increasing percentiles", op, p)
+		}
+	}
+}
+
 func TestDatabasesHandler_GET(t *testing.T) {
 	db := pila.NewDatabase("db")
 
@@ -124,7 +232,7 @@ func TestDatabasesHandler_GET(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if expected := `{"number_of_databases":1,"databases":[{"id":"8cfa8cb55c92fa403369a13fd12a8e01","name":"db","number_of_stacks":0}]}`; string(databases) != expected {
+	if expected := fmt.Sprintf(`{"number_of_databases":1,"databases":[{"id":"%v","name":"db","number_of_stacks":0,"memory":0}]}`, db.ID); string(databases) != expected {
 		t.Errorf("databases are %s, expected %s", string(databases), expected)
 	}
 }
@@ -197,8 +305,9 @@ func TestCreateDatabaseHandler(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if string(databases) != `{"id":"8cfa8cb55c92fa403369a13fd12a8e01","name":"db","number_of_stacks":0}` {
-		t.Errorf("databases are %s, expected %s", string(databases), `{"id":"8cfa8cb55c92fa403369a13fd12a8e01","name":"db","number_of_stacks":0}`)
+	db, _ := conn.Pila.DatabaseByName("db")
+	if expected := fmt.Sprintf(`{"id":"%v","name":"db","number_of_stacks":0,"memory":0}`, db.ID); string(databases) != expected {
+		t.Errorf("databases are %s, expected %s", string(databases), expected)
 	}
 }
 
@@ -268,8 +377,7 @@ func TestDatabaseHandler_GET(t *testing.T) {
 
 	response := httptest.NewRecorder()
 
-	databaseHandle := conn.databaseHandler(db.ID.String())
-	databaseHandle.ServeHTTP(response, request)
+	Router(conn).ServeHTTP(response, request)
 
 	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
 		t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
@@ -284,7 +392,7 @@ func TestDatabaseHandler_GET(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if expected := `{"id":"c13cec0e70876381c78c616ee2d809eb","name":"mydb","number_of_stacks":1,"stacks":["b92f53fa3884305ef798fd8c5d7609ad"]}`; string(database) != expected {
+	if expected := fmt.Sprintf(`{"id":"%v","name":"mydb","number_of_stacks":1,"stacks":["%v"],"memory":35}`, db.ID, s.ID); string(database) != expected {
 		t.Errorf("database is %v, expected %v", string(database), expected)
 	}
 }
@@ -312,8 +420,7 @@ func TestDatabaseHandler_GET_Name(t *testing.T) {
 
 	response := httptest.NewRecorder()
 
-	databaseHandle := conn.databaseHandler(db.Name)
-	databaseHandle.ServeHTTP(response, request)
+	Router(conn).ServeHTTP(response, request)
 
 	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
 		t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
@@ -328,7 +435,7 @@ func TestDatabaseHandler_GET_Name(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if expected := `{"id":"c13cec0e70876381c78c616ee2d809eb","name":"mydb","number_of_stacks":1,"stacks":["b92f53fa3884305ef798fd8c5d7609ad"]}`; string(database) != expected {
+	if expected := fmt.Sprintf(`{"id":"%v","name":"mydb","number_of_stacks":1,"stacks":["%v"],"memory":35}`, db.ID, s.ID); string(database) != expected {
 		t.Errorf("database is %v, expected %v", string(database), expected)
 	}
 }
@@ -354,8 +461,7 @@ func TestDatabaseHandler_DELETE(t *testing.T) {
 
 	response := httptest.NewRecorder()
 
-	databaseHandle := conn.databaseHandler(db1.ID.String())
-	databaseHandle.ServeHTTP(response, request)
+	Router(conn).ServeHTTP(response, request)
 
 	if response.Code != http.StatusNoContent {
 		t.Errorf("response code is %v, expected %v", response.Code, http.StatusNoContent)
@@ -387,8 +493,7 @@ func TestDatabaseHandler_DELETE_Name(t *testing.T) {
 
 	response := httptest.NewRecorder()
 
-	databaseHandle := conn.databaseHandler(db1.Name)
-	databaseHandle.ServeHTTP(response, request)
+	Router(conn).ServeHTTP(response, request)
 
 	if response.Code != http.StatusNoContent {
 		t.Errorf("response code is %v, expected %v", response.Code, http.StatusNoContent)
@@ -399,6 +504,91 @@ func TestDatabaseHandler_DELETE_Name(t *testing.T) {
 	}
 }
 
+func TestDatabaseHandler_DELETE_Cascade(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := db.Stacks[db.CreateStack("stack", time.Now())]
+	_ = stack.Push("foo")
+
+	inputOutput := []struct {
+		input  string
+		output int
+	}{
+		{"/databases/db?cascade=foo", http.StatusBadRequest},
+		{"/databases/db?cascade=false", http.StatusConflict},
+		{"/databases/db?cascade=true", http.StatusNoContent},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest("DELETE", io.input, nil)
+		response := httptest.NewRecorder()
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != io.output {
+			t.Errorf("%s: response code is %v, expected %v", io.input, response.Code, io.output)
+		}
+		if _, ok := conn.Pila.DatabaseByName("db"); ok != (io.output != http.StatusNoContent) {
+			t.Errorf("%s: database exists is %v", io.input, ok)
+		}
+	}
+
+	db = pila.NewDatabase("empty")
+	_ = conn.Pila.AddDatabase(db)
+	db.CreateStack("stack", time.Now())
+
+	request, _ := http.NewRequest("DELETE", "/databases/empty?cascade=false", nil)
+	response := httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+	if response.Code != http.StatusNoContent {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusNoContent)
+	}
+}
+
+func TestFlushDatabaseHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	foo := db.Stacks[db.CreateStack("foo", time.Now())]
+	bar := db.Stacks[db.CreateStack("bar", time.Now())]
+	_ = foo.Push("foo")
+	_ = bar.Push("bar")
+
+	if _, err := bar.Lock("owner", time.Minute, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	request, _ := http.NewRequest("DELETE", "/databases/db/_flush", nil)
+	response := httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+	if response.Code != http.StatusLocked {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusLocked)
+	}
+	if foo.Size() != 1 || bar.Size() != 1 {
+		t.Errorf("stacks were flushed while locked")
+	}
+
+	request, _ = http.NewRequest("DELETE", "/databases/db/_flush", nil)
+	request.Header.Set(lockOwnerHeader, "owner")
+	response = httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+	if expected := db.Status().ToJSON(); !bytes.Equal(response.Body.Bytes(), expected) {
+		t.Errorf("response is %s, expected %s", response.Body.Bytes(), expected)
+	}
+	if !db.Empty() || len(db.Stacks) != 2 {
+		t.Errorf("database has %d stacks, empty is %v", len(db.Stacks), db.Empty())
+	}
+
+	request, _ = http.NewRequest("DELETE", "/databases/foo/_flush", nil)
+	response = httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+	if response.Code != http.StatusGone {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusGone)
+	}
+}
+
 func TestDatabaseHandler_Gone(t *testing.T) {
 	conn := NewConn()
 
@@ -412,8 +602,7 @@ func TestDatabaseHandler_Gone(t *testing.T) {
 
 	response := httptest.NewRecorder()
 
-	databaseHandle := conn.databaseHandler(uuid.UUID("nodb").String())
-	databaseHandle.ServeHTTP(response, request)
+	Router(conn).ServeHTTP(response, request)
 
 	if response.Code != http.StatusGone {
 		t.Errorf("response code is %v, expected %v", response.Code, http.StatusGone)
@@ -434,6 +623,8 @@ func TestStacksHandler_GET(t *testing.T) {
 	s2.Push(1)
 	s2.Push(8)
 	s2.Update(after2)
+	pushedAt1, _ := s1.PushedAt()
+	pushedAt2, _ := s2.PushedAt()
 
 	db := pila.NewDatabase("db")
 	_ = db.AddStack(s1)
@@ -448,9 +639,9 @@ func TestStacksHandler_GET(t *testing.T) {
 	inputOutput := []struct {
 		input, output string
 	}{
-		{"/databases/db/stacks", fmt.Sprintf(`{"stacks":[{"id":"f0306fec639bd57fc2929c8b897b9b37","name":"stack1","peek":"foo","size":1,"created_at":"%v","updated_at":"%v","read_at":"%v"},{"id":"dde8f895aea2ffa5546336146b9384e7","name":"stack2","peek":8,"size":2,"created_at":"%v","updated_at":"%v","read_at":"%v"}]}`,
-			date.Format(now1.Local()), date.Format(after1.Local()), date.Format(after1.Local()),
-			date.Format(now2.Local()), date.Format(after2.Local()), date.Format(after2.Local()))},
+		{"/databases/db/stacks", fmt.Sprintf(`{"stacks":[{"id":"%v","name":"stack1","peek":"foo","size":1,"size_approx":1,"version":1,"peak_size":1,"pushes":1,"pops":0,"memory":35,"created_at":"%v","updated_at":"%v","read_at":"%v","pushed_at":"%v"},{"id":"%v","name":"stack2","peek":8,"size":2,"size_approx":2,"version":2,"peak_size":2,"pushes":2,"pops":0,"memory":80,"created_at":"%v","updated_at":"%v","read_at":"%v","pushed_at":"%v"}]}`,
+			s1.ID, date.Format(now1.Local()), date.Format(after1.Local()), date.Format(after1.Local()), date.Format(pushedAt1.Local()),
+			s2.ID, date.Format(now2.Local()), date.Format(after2.Local()), date.Format(after2.Local()), date.Format(pushedAt2.Local()))},
 		{"/databases/db/stacks?kv", `{"stacks":{"stack1":"foo","stack2":8}}`},
 	}
 
@@ -461,8 +652,7 @@ func TestStacksHandler_GET(t *testing.T) {
 		}
 		response := httptest.NewRecorder()
 
-		stacksHandle := conn.stacksHandler(db.ID.String())
-		stacksHandle.ServeHTTP(response, request)
+		Router(conn).ServeHTTP(response, request)
 
 		if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
 			t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
@@ -496,6 +686,8 @@ func TestStacksHandler_GET_Name(t *testing.T) {
 	s2 := pila.NewStack("stack2", now2)
 	s2.Push(`{"a":"b"}`)
 	s2.Update(after2)
+	pushedAt1, _ := s1.PushedAt()
+	pushedAt2, _ := s2.PushedAt()
 
 	db := pila.NewDatabase("db")
 	_ = db.AddStack(s1)
@@ -513,8 +705,7 @@ func TestStacksHandler_GET_Name(t *testing.T) {
 	}
 	response := httptest.NewRecorder()
 
-	stacksHandle := conn.stacksHandler("db")
-	stacksHandle.ServeHTTP(response, request)
+	Router(conn).ServeHTTP(response, request)
 
 	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
 		t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
@@ -529,9 +720,9 @@ func TestStacksHandler_GET_Name(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if expected := fmt.Sprintf(`{"stacks":[{"id":"f0306fec639bd57fc2929c8b897b9b37","name":"stack1","peek":"bar","size":1,"created_at":"%v","updated_at":"%v","read_at":"%v"},{"id":"dde8f895aea2ffa5546336146b9384e7","name":"stack2","peek":"{\"a\":\"b\"}","size":1,"created_at":"%v","updated_at":"%v","read_at":"%v"}]}`,
-		date.Format(now1.Local()), date.Format(after1.Local()), date.Format(after1.Local()),
-		date.Format(now2.Local()), date.Format(after2.Local()), date.Format(after2.Local())); string(stacks) != expected {
+	if expected := fmt.Sprintf(`{"stacks":[{"id":"%v","name":"stack1","peek":"bar","size":1,"size_approx":1,"version":1,"peak_size":1,"pushes":1,"pops":0,"memory":35,"created_at":"%v","updated_at":"%v","read_at":"%v","pushed_at":"%v"},{"id":"%v","name":"stack2","peek":"{\"a\":\"b\"}","size":1,"size_approx":1,"version":1,"peak_size":1,"pushes":1,"pops":0,"memory":41,"created_at":"%v","updated_at":"%v","read_at":"%v","pushed_at":"%v"}]}`,
+		s1.ID, date.Format(now1.Local()), date.Format(after1.Local()), date.Format(after1.Local()), date.Format(pushedAt1.Local()),
+		s2.ID, date.Format(now2.Local()), date.Format(after2.Local()), date.Format(after2.Local()), date.Format(pushedAt2.Local())); string(stacks) != expected {
 		t.Errorf("stacks are %s, expected %s", string(stacks), expected)
 	}
 }
@@ -551,8 +742,7 @@ func TestStacksHandler_GET_Gone(t *testing.T) {
 	}
 	response := httptest.NewRecorder()
 
-	stacksHandle := conn.stacksHandler("nodb")
-	stacksHandle.ServeHTTP(response, request)
+	Router(conn).ServeHTTP(response, request)
 
 	if response.Code != http.StatusGone {
 		t.Errorf("response code is %v, expected %v", response.Code, http.StatusGone)
@@ -580,14 +770,67 @@ func TestStacksHandler_GET_BadRequest(t *testing.T) {
 	}
 	response := httptest.NewRecorder()
 
-	stacksHandle := conn.stacksHandler("db")
-	stacksHandle.ServeHTTP(response, request)
+	Router(conn).ServeHTTP(response, request)
 
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("response code is %v, expected %v", response.Code, http.StatusGone)
 	}
 }
 
+func TestStacksHandler_GET_Options(t *testing.T) {
+	db := pila.NewDatabase("db")
+	for i, name := range []string{"jobs-a", "jobs-b", "tasks"} {
+		stack := pila.NewStack(name, time.Now().UTC())
+		for j := 0; j < 3-i; j++ {
+			stack.Push(j)
+		}
+		_ = db.AddStack(stack)
+	}
+
+	conn := NewConn()
+	_ = conn.Pila.AddDatabase(db)
+
+	inputOutput := []struct {
+		query string
+		code  int
+		names []string
+	}{
+		{"", http.StatusOK, []string{"jobs-a", "jobs-b", "tasks"}},
+		{"?order=desc", http.StatusOK, []string{"tasks", "jobs-b", "jobs-a"}},
+		{"?sort=size", http.StatusOK, []string{"tasks", "jobs-b", "jobs-a"}},
+		{"?sort=size&order=desc&filter=jobs-*", http.StatusOK, []string{"jobs-a", "jobs-b"}},
+		{"?filter=tasks", http.StatusOK, []string{"tasks"}},
+		{"?filter=nothing*", http.StatusOK, []string{}},
+		{"?sort=memory", http.StatusBadRequest, nil},
+		{"?order=random", http.StatusBadRequest, nil},
+		{"?filter=jobs-[", http.StatusBadRequest, nil},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest("GET", "/databases/db/stacks"+io.query, nil)
+		response := httptest.NewRecorder()
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("%s: response code is %v, expected %v", io.query, response.Code, io.code)
+		}
+		if io.code != http.StatusOK {
+			continue
+		}
+		var status pila.StacksStatus
+		if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, s := range status.Stacks {
+			names = append(names, s.Name)
+		}
+		if !reflect.DeepEqual(names, io.names) {
+			t.Errorf("%s: stacks are %v, expected %v", io.query, names, io.names)
+		}
+	}
+}
+
 func TestStacksHandler_PUT(t *testing.T) {
 	db := pila.NewDatabase("db")
 
@@ -596,17 +839,15 @@ func TestStacksHandler_PUT(t *testing.T) {
 
 	conn := NewConn()
 	conn.Pila = p
-	conn.opDate = time.Now().UTC()
 
-	path := fmt.Sprintf("/databases/%s/stacks/?name=test-stack", db.ID.String())
+	path := fmt.Sprintf("/databases/%s/stacks?name=test-stack", db.ID.String())
 	request, err := http.NewRequest("PUT", path, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	response := httptest.NewRecorder()
 
-	stacksHandle := conn.stacksHandler(db.ID.String())
-	stacksHandle.ServeHTTP(response, request)
+	Router(conn).ServeHTTP(response, request)
 
 	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
 		t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
@@ -621,8 +862,9 @@ func TestStacksHandler_PUT(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	expectedStack := fmt.Sprintf(`{"id":"bb4dabeeaa6e90108583ddbf49649427","name":"test-stack","peek":null,"size":0,"created_at":"%v","updated_at":"%v","read_at":"%v"}`,
-		date.Format(conn.opDate.Local()), date.Format(conn.opDate.Local()), date.Format(conn.opDate.Local()))
+	created, _ := db.StackByName("test-stack")
+	expectedStack := fmt.Sprintf(`{"id":"%v","name":"test-stack","peek":null,"size":0,"size_approx":0,"version":0,"peak_size":0,"pushes":0,"pops":0,"memory":0,"created_at":"%v","updated_at":"%v","read_at":"%v"}`,
+		created.ID, date.Format(created.CreatedAt.Local()), date.Format(created.CreatedAt.Local()), date.Format(created.CreatedAt.Local()))
 
 	if string(stack) != expectedStack {
 		t.Errorf("stack is %s, expected %s", string(stack), expectedStack)
@@ -637,17 +879,15 @@ func TestStacksHandler_PUT_Name(t *testing.T) {
 
 	conn := NewConn()
 	conn.Pila = p
-	conn.opDate = time.Now().UTC()
 
-	path := fmt.Sprintf("/databases/%s/stacks/?name=test-stack", db.Name)
+	path := fmt.Sprintf("/databases/%s/stacks?name=test-stack", db.Name)
 	request, err := http.NewRequest("PUT", path, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	response := httptest.NewRecorder()
 
-	stacksHandle := conn.stacksHandler(db.ID.String())
-	stacksHandle.ServeHTTP(response, request)
+	Router(conn).ServeHTTP(response, request)
 
 	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
 		t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
@@ -662,8 +902,9 @@ func TestStacksHandler_PUT_Name(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	expectedStack := fmt.Sprintf(`{"id":"bb4dabeeaa6e90108583ddbf49649427","name":"test-stack","peek":null,"size":0,"created_at":"%v","updated_at":"%v","read_at":"%v"}`,
-		date.Format(conn.opDate.Local()), date.Format(conn.opDate.Local()), date.Format(conn.opDate.Local()))
+	created, _ := db.StackByName("test-stack")
+	expectedStack := fmt.Sprintf(`{"id":"%v","name":"test-stack","peek":null,"size":0,"size_approx":0,"version":0,"peak_size":0,"pushes":0,"pops":0,"memory":0,"created_at":"%v","updated_at":"%v","read_at":"%v"}`,
+		created.ID, date.Format(created.CreatedAt.Local()), date.Format(created.CreatedAt.Local()), date.Format(created.CreatedAt.Local()))
 
 	if string(stack) != expectedStack {
 		t.Errorf("stack is %s, expected %s", string(stack), expectedStack)
@@ -678,16 +919,15 @@ func TestCreateStackHandler(t *testing.T) {
 
 	conn := NewConn()
 	conn.Pila = p
-	conn.opDate = time.Now().UTC()
 
-	path := fmt.Sprintf("/databases/%s/stacks/?name=test-stack", db.ID.String())
+	path := fmt.Sprintf("/databases/%s/stacks?name=test-stack", db.ID.String())
 	request, err := http.NewRequest("PUT", path, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	response := httptest.NewRecorder()
 
-	conn.createStackHandler(response, request, db.ID.String())
+	conn.createStackHandler(response, request, db)
 
 	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
 		t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
@@ -702,8 +942,9 @@ func TestCreateStackHandler(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	expectedStack := fmt.Sprintf(`{"id":"bb4dabeeaa6e90108583ddbf49649427","name":"test-stack","peek":null,"size":0,"created_at":"%v","updated_at":"%v","read_at":"%v"}`,
-		date.Format(conn.opDate.Local()), date.Format(conn.opDate.Local()), date.Format(conn.opDate.Local()))
+	created, _ := db.StackByName("test-stack")
+	expectedStack := fmt.Sprintf(`{"id":"%v","name":"test-stack","peek":null,"size":0,"size_approx":0,"version":0,"peak_size":0,"pushes":0,"pops":0,"memory":0,"created_at":"%v","updated_at":"%v","read_at":"%v"}`,
+		created.ID, date.Format(created.CreatedAt.Local()), date.Format(created.CreatedAt.Local()), date.Format(created.CreatedAt.Local()))
 	if string(stack) != expectedStack {
 		t.Errorf("stack is %s, expected %s", string(stack), expectedStack)
 	}
@@ -718,14 +959,14 @@ func TestCreateStackHandler_NoName(t *testing.T) {
 	conn := NewConn()
 	conn.Pila = p
 
-	path := fmt.Sprintf("/databases/%s/stacks/?name=", db.ID.String())
+	path := fmt.Sprintf("/databases/%s/stacks?name=", db.ID.String())
 	request, err := http.NewRequest("PUT", path, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	response := httptest.NewRecorder()
 
-	conn.createStackHandler(response, request, db.ID.String())
+	conn.createStackHandler(response, request, db)
 
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("response code is %v, expected %v", response.Code, http.StatusBadRequest)
@@ -738,14 +979,14 @@ func TestCreateStackHandler_Gone(t *testing.T) {
 	conn := NewConn()
 	conn.Pila = p
 
-	path := fmt.Sprintf("/databases/%s/stacks/?name=test-stack", "12345")
+	path := fmt.Sprintf("/databases/%s/stacks?name=test-stack", "12345")
 	request, err := http.NewRequest("PUT", path, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	response := httptest.NewRecorder()
 
-	conn.createStackHandler(response, request, "12345")
+	Router(conn).ServeHTTP(response, request)
 
 	if response.Code != http.StatusGone {
 		t.Errorf("response code is %v, expected %v", response.Code, http.StatusGone)
@@ -764,14 +1005,14 @@ func TestCreateStackHandler_Conflict(t *testing.T) {
 	conn := NewConn()
 	conn.Pila = p
 
-	path := fmt.Sprintf("/databases/%s/stacks/?name=test-stack", db.ID.String())
+	path := fmt.Sprintf("/databases/%s/stacks?name=test-stack", db.ID.String())
 	request, err := http.NewRequest("PUT", path, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	response := httptest.NewRecorder()
 
-	conn.createStackHandler(response, request, db.ID.String())
+	conn.createStackHandler(response, request, db)
 
 	if response.Code != http.StatusConflict {
 		t.Errorf("response code is %v, expected %v", response.Code, http.StatusConflict)
@@ -794,7 +1035,6 @@ func TestStackHandler_GET(t *testing.T) {
 
 	conn := NewConn()
 	conn.Pila = p
-	conn.opDate = time.Now().UTC()
 
 	s.Push(element.Value)
 
@@ -853,13 +1093,7 @@ func TestStackHandler_GET(t *testing.T) {
 
 		response := httptest.NewRecorder()
 
-		params := map[string]string{
-			"database_id": io.input.database,
-			"stack_id":    io.input.stack,
-		}
-
-		stackHandle := conn.stackHandler(&params)
-		stackHandle.ServeHTTP(response, request)
+		Router(conn).ServeHTTP(response, request)
 
 		if peek := db.Stacks[s.ID].Peek(); peek != element.Value {
 			t.Errorf("peek is %v, expected %v", peek, element.Value)
@@ -903,7 +1137,6 @@ func TestStackHandler_POST(t *testing.T) {
 
 	conn := NewConn()
 	conn.Pila = p
-	conn.opDate = time.Now().UTC()
 
 	element := pila.Element{Value: "test-element"}
 	expectedElementJSON, _ := element.ToJSON()
@@ -932,8 +1165,7 @@ func TestStackHandler_POST(t *testing.T) {
 
 		response := httptest.NewRecorder()
 
-		stackHandle := conn.stackHandler(&params)
-		stackHandle.ServeHTTP(response, request)
+		Router(conn).ServeHTTP(response, request)
 
 		if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
 			t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
@@ -1027,13 +1259,7 @@ func TestStackHandler_DELETE(t *testing.T) {
 
 		response := httptest.NewRecorder()
 
-		params := map[string]string{
-			"database_id": io.input.database,
-			"stack_id":    io.input.stack,
-		}
-
-		stackHandle := conn.stackHandler(&params)
-		stackHandle.ServeHTTP(response, request)
+		Router(conn).ServeHTTP(response, request)
 
 		if response.Code != io.output.code {
 			t.Errorf("on op %s response code is %v, expected %v", io.input.op, response.Code, io.output.code)
@@ -1045,7 +1271,6 @@ func TestStackHandler_DELETE(t *testing.T) {
 		}
 
 		if io.input.op == "flush" {
-			s.Update(conn.opDate)
 			stackStatus := s.Status()
 
 			expectedStackStatusJSON, err := stackStatus.ToJSON()
@@ -1090,7 +1315,6 @@ func TestStackHandler_DatabaseGone(t *testing.T) {
 
 	conn := NewConn()
 	conn.Pila = p
-	conn.opDate = now
 
 	request, err := http.NewRequest("GET",
 		fmt.Sprintf("/databases/%s/stacks/%s",
@@ -1104,13 +1328,7 @@ func TestStackHandler_DatabaseGone(t *testing.T) {
 
 	response := httptest.NewRecorder()
 
-	params := &map[string]string{
-		"database_id": "non-existing-db",
-		"stack_id":    s.ID.String(),
-	}
-
-	stackHandle := conn.stackHandler(params)
-	stackHandle.ServeHTTP(response, request)
+	Router(conn).ServeHTTP(response, request)
 
 	if response.Code != http.StatusGone {
 		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
@@ -1129,7 +1347,6 @@ func TestStackHandler_StackGone(t *testing.T) {
 
 	conn := NewConn()
 	conn.Pila = p
-	conn.opDate = now
 
 	request, err := http.NewRequest("GET",
 		fmt.Sprintf("/databases/%s/stacks/%s",
@@ -1143,13 +1360,7 @@ func TestStackHandler_StackGone(t *testing.T) {
 
 	response := httptest.NewRecorder()
 
-	params := &map[string]string{
-		"database_id": db.ID.String(),
-		"stack_id":    "non-existing-stack",
-	}
-
-	stackHandle := conn.stackHandler(params)
-	stackHandle.ServeHTTP(response, request)
+	Router(conn).ServeHTTP(response, request)
 
 	if response.Code != http.StatusGone {
 		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
@@ -1170,6 +1381,10 @@ func TestStatusStackHandler(t *testing.T) {
 
 	s.Push("one")
 
+	// requests are read at date now
+	now := time.Now().UTC()
+	s.Read(now)
+
 	expectedStackStatusJSON, err := s.Status().ToJSON()
 	if err != nil {
 		t.Fatal(err)
@@ -1196,6 +1411,8 @@ func TestStatusStackHandler(t *testing.T) {
 			t.Fatal(err)
 		}
 
+		request = request.WithContext(context.WithValue(request.Context(), dateKey, now))
+
 		response := httptest.NewRecorder()
 
 		conn.statusStackHandler(response, request, s)
@@ -1594,6 +1811,177 @@ func TestPopStackHandler_EmptyStack(t *testing.T) {
 	}
 }
 
+func TestStackOperationHandler_Pop(t *testing.T) {
+	s := pila.NewStack("stack", time.Now().UTC())
+	s.Push("foo")
+	s.Push("bar")
+
+	db := pila.NewDatabase("db")
+	_ = db.AddStack(s)
+
+	conn := NewConn()
+	_ = conn.Pila.AddDatabase(db)
+
+	inputOutput := []struct {
+		input  string
+		output struct {
+			response string
+			code     int
+		}
+	}{
+		{"/databases/db/stacks/stack/pop", struct {
+			response string
+			code     int
+		}{`{"element":"bar"}`, http.StatusOK}},
+		{fmt.Sprintf("/databases/%s/stacks/%s/pop", db.ID, s.ID), struct {
+			response string
+			code     int
+		}{`{"element":"foo"}`, http.StatusOK}},
+		{"/databases/db/stacks/stack/pop", struct {
+			response string
+			code     int
+		}{"", http.StatusNoContent}},
+		{"/databases/db/stacks/nostack/pop", struct {
+			response string
+			code     int
+		}{"", http.StatusGone}},
+		{"/databases/nodb/stacks/stack/pop", struct {
+			response string
+			code     int
+		}{`{"code":"database_not_found","message":"database nodb is Gone","field":"database_id"}`, http.StatusGone}},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("DELETE", io.input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response := httptest.NewRecorder()
+
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != io.output.code {
+			t.Errorf("on %s response code is %v, expected %v", io.input, response.Code, io.output.code)
+		}
+		if body := response.Body.String(); body != io.output.response {
+			t.Errorf("on %s response is %s, expected %s", io.input, body, io.output.response)
+		}
+	}
+}
+
+func TestStackOperationHandler(t *testing.T) {
+	s := pila.NewStack("stack", time.Now().UTC())
+	s.Push("foo")
+	s.Push("bar")
+
+	db := pila.NewDatabase("db")
+	_ = db.AddStack(s)
+
+	conn := NewConn()
+	_ = conn.Pila.AddDatabase(db)
+
+	inputOutput := []struct {
+		input struct {
+			method, url string
+		}
+		output struct {
+			response string
+			code     int
+		}
+	}{
+		{struct {
+			method, url string
+		}{"GET", "/databases/db/stacks/stack/peek"},
+			struct {
+				response string
+				code     int
+			}{`{"element":"bar"}`, http.StatusOK},
+		},
+		{struct {
+			method, url string
+		}{"GET", "/databases/db/stacks/stack/size"},
+			struct {
+				response string
+				code     int
+			}{"2", http.StatusOK},
+		},
+		{struct {
+			method, url string
+		}{"DELETE", "/databases/db/stacks/stack/flush"},
+			struct {
+				response string
+				code     int
+			}{"", http.StatusOK},
+		},
+		{struct {
+			method, url string
+		}{"GET", "/databases/db/stacks/stack/size"},
+			struct {
+				response string
+				code     int
+			}{"0", http.StatusOK},
+		},
+		{struct {
+			method, url string
+		}{"GET", "/databases/db/stacks/stack/peek"},
+			struct {
+				response string
+				code     int
+			}{`{"element":null}`, http.StatusOK},
+		},
+		{struct {
+			method, url string
+		}{"GET", "/databases/db/stacks/nostack/peek"},
+			struct {
+				response string
+				code     int
+			}{"", http.StatusGone},
+		},
+		{struct {
+			method, url string
+		}{"DELETE", "/databases/nodb/stacks/stack/flush"},
+			struct {
+				response string
+				code     int
+			}{"", http.StatusGone},
+		},
+		{struct {
+			method, url string
+		}{"POST", "/databases/db/stacks/stack/size"},
+			struct {
+				response string
+				code     int
+			}{"", http.StatusNotFound},
+		},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.input.method, io.input.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response := httptest.NewRecorder()
+
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != io.output.code {
+			t.Errorf("on %s %s response code is %v, expected %v", io.input.method, io.input.url, response.Code, io.output.code)
+		}
+		if body := response.Body.String(); io.output.response != "" && body != io.output.response {
+			t.Errorf("on %s %s response is %s, expected %s", io.input.method, io.input.url, body, io.output.response)
+		}
+	}
+
+	if s.Size() != 0 {
+		t.Errorf("stack size is %d, expected %d", s.Size(), 0)
+	}
+	if _, ok := ResourceStack(db, "stack"); !ok {
+		t.Error("flushed stack is not registered")
+	}
+}
+
 func TestFlushStackHandler(t *testing.T) {
 	s := pila.NewStack("stack", time.Now().UTC())
 
@@ -1606,11 +1994,6 @@ func TestFlushStackHandler(t *testing.T) {
 	conn := NewConn()
 	conn.Pila = p
 
-	expectedStackStatusJSON, err := s.Status().ToJSON()
-	if err != nil {
-		t.Fatal(err)
-	}
-
 	s.Push("one")
 	s.Push("two")
 	s.Push("three")
@@ -1661,6 +2044,11 @@ func TestFlushStackHandler(t *testing.T) {
 			t.Fatal(err)
 		}
 
+		// the flushed stack keeps its dates and statistics
+		expectedStackStatusJSON, err := s.Status().ToJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
 		if string(stackStatusJSON) != string(expectedStackStatusJSON) {
 			t.Errorf("stack status is %s, expected %s", string(stackStatusJSON), string(expectedStackStatusJSON))
 		}
@@ -1770,3 +2158,617 @@ func TestGoneHandler(t *testing.T) {
 		t.Errorf("response code is %v, expected %v", response.Code, http.StatusNotFound)
 	}
 }
+
+func TestCanceledHandler(t *testing.T) {
+	conn := NewConn()
+	inputOutput := []struct {
+		err  error
+		code int
+	}{
+		{context.Canceled, statusClientClosedRequest},
+		{context.DeadlineExceeded, http.StatusServiceUnavailable},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest("DELETE", "/databases/db/stacks/stack", nil)
+		response := httptest.NewRecorder()
+		conn.canceledHandler(response, request, io.err)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %v", response.Code, io.code, io.err)
+		}
+	}
+}
+
+func TestHandlers_Canceled(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	_ = stack.PushN([]interface{}{"foo", "bar"})
+	snapshot := new(bytes.Buffer)
+	_ = conn.Pila.Snapshot(snapshot)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	inputOutput := []struct {
+		method, path, body string
+	}{
+		{"POST", "/databases/db/stacks/stack", `{"element":"baz"}`},
+		{"DELETE", "/databases/db/stacks/stack", ""},
+		{"DELETE", "/databases/db/stacks/stack/pop", ""},
+		{"POST", "/databases/db/stacks/stack/_bulk", `["baz"]`},
+		{"DELETE", "/databases/db/stacks/stack/_bulk?count=2", ""},
+		{"POST", "/_snapshot", ""},
+		{"POST", "/_restore", snapshot.String()},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		request = request.WithContext(ctx)
+		response := httptest.NewRecorder()
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != statusClientClosedRequest {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, statusClientClosedRequest, io.method, io.path)
+		}
+		if d, ok := conn.Pila.DatabaseByName("db"); !ok || d != db || stack.Size() != 2 {
+			t.Errorf("stack was modified by %s %s", io.method, io.path)
+		}
+	}
+}
+
+func TestConnOpenLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-persist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conn := NewConn()
+	if err := conn.openLog(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := []struct {
+		method string
+		url    string
+		body   string
+	}{
+		{"PUT", "/databases?name=db", ""},
+		{"PUT", "/databases?name=tmp", ""},
+		{"PUT", "/databases/db/stacks?name=stack", ""},
+		{"PUT", "/databases/db/stacks?name=flushed", ""},
+		{"PUT", "/databases/db/stacks?name=deleted", ""},
+		{"POST", "/databases/db/stacks/stack", `{"element":"foo"}`},
+		{"POST", "/databases/db/stacks/stack", `{"element":"bar"}`},
+		{"POST", "/databases/db/stacks/stack", `{"element":"baz"}`},
+		{"DELETE", "/databases/db/stacks/stack", ""},
+		{"POST", "/databases/db/stacks/flushed", `{"element":"foo"}`},
+		{"DELETE", "/databases/db/stacks/flushed?flush", ""},
+		{"DELETE", "/databases/db/stacks/deleted?full", ""},
+		{"DELETE", "/databases/tmp", ""},
+	}
+	for _, req := range requests {
+		request, err := http.NewRequest(req.method, req.url, bytes.NewBufferString(req.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		Router(conn).ServeHTTP(httptest.NewRecorder(), request)
+	}
+	if err := conn.Log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewConn()
+	if err := restored.openLog(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Log.Close()
+
+	if expected, got := conn.Pila.Status().ToJSON(), restored.Pila.Status().ToJSON(); !bytes.Equal(expected, got) {
+		t.Errorf("pila is %s, expected %s", got, expected)
+	}
+
+	db, _ := ResourceDatabase(restored, "db")
+	stack, _ := ResourceStack(db, "stack")
+	if peek := stack.Peek(); peek != "bar" {
+		t.Errorf("peek is %v, expected %v", peek, "bar")
+	}
+	if size := stack.Size(); size != 2 {
+		t.Errorf("size is %d, expected %d", size, 2)
+	}
+}
+
+func TestConnOpenLog_Error(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-persist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "pila.log"), []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := NewConn()
+	if err := conn.openLog(dir); err == nil {
+		t.Error("err is nil")
+	}
+	if conn.Log != nil {
+		t.Error("Log is not nil")
+	}
+}
+
+func TestStackHandler_Concurrent(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	db.CreateStack("stack", time.Now().UTC())
+	router := Router(conn)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				for _, req := range []struct {
+					method, url, body string
+				}{
+					{"POST", "/databases/db/stacks/stack", `{"element":"foo"}`},
+					{"GET", "/databases/db/stacks/stack?peek", ""},
+					{"GET", "/databases/db/stacks/stack", ""},
+					{"GET", "/databases/db/stacks", ""},
+					{"DELETE", "/databases/db/stacks/stack", ""},
+				} {
+					request, err := http.NewRequest(req.method, req.url, strings.NewReader(req.body))
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					response := httptest.NewRecorder()
+
+					router.ServeHTTP(response, request)
+
+					if response.Code != http.StatusOK {
+						t.Errorf("on %s %s response code is %v, expected %v", req.method, req.url, response.Code, http.StatusOK)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stack, _ := ResourceStack(db, "stack"); stack.Size() != 0 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 0)
+	}
+}
+
+func TestLimitParams(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output struct {
+			maxSize int
+			policy  pila.OverflowPolicy
+		}
+	}{
+		{"/", struct {
+			maxSize int
+			policy  pila.OverflowPolicy
+		}{0, ""}},
+		{"/?max_size=10", struct {
+			maxSize int
+			policy  pila.OverflowPolicy
+		}{10, pila.OverflowReject}},
+		{"/?max_size=10&policy=reject", struct {
+			maxSize int
+			policy  pila.OverflowPolicy
+		}{10, pila.OverflowReject}},
+		{"/?max_size=10&policy=drop_oldest", struct {
+			maxSize int
+			policy  pila.OverflowPolicy
+		}{10, pila.OverflowDropOldest}},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("PUT", io.input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		maxSize, policy, err := limitParams(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if maxSize != io.output.maxSize || policy != io.output.policy {
+			t.Errorf("limit is %d %s, expected %d %s", maxSize, policy, io.output.maxSize, io.output.policy)
+		}
+	}
+}
+
+func TestLimitParams_Error(t *testing.T) {
+	for _, input := range []string{"/?max_size=0", "/?max_size=foo", "/?policy=reject", "/?max_size=10&policy=foo"} {
+		request, err := http.NewRequest("PUT", input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := limitParams(request); err == nil {
+			t.Errorf("err is nil for %s", input)
+		}
+	}
+}
+
+func TestUniqueParam(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output pila.UniquePolicy
+		ok     bool
+	}{
+		{"/", "", true},
+		{"/?unique=false", "", true},
+		{"/?unique=true", pila.UniqueReject, true},
+		{"/?unique=reject", pila.UniqueReject, true},
+		{"/?unique=move_to_top", pila.UniqueMoveToTop, true},
+		{"/?unique=foo", "", false},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("PUT", io.input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		unique, err := uniqueParam(request)
+		if unique != io.output || (err == nil) != io.ok {
+			t.Errorf("unique is %s, %v, expected %s for %s", unique, err, io.output, io.input)
+		}
+	}
+}
+
+func TestStackHandler_Unique(t *testing.T) {
+	conn := NewConn()
+	conn.Pila.CreateDatabase("db")
+
+	requests := []struct {
+		method, url, body string
+		code              int
+	}{
+		{"PUT", "/databases/db/stacks?name=rejecting&unique=true", "", http.StatusCreated},
+		{"PUT", "/databases/db/stacks?name=moving&unique=move_to_top", "", http.StatusCreated},
+		{"PUT", "/databases/db/stacks?name=invalid&unique=foo", "", http.StatusBadRequest},
+		{"POST", "/databases/db/stacks/rejecting", `{"element":"foo"}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/rejecting", `{"element":"bar"}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/rejecting", `{"element":"foo"}`, http.StatusConflict},
+		{"POST", "/databases/db/stacks/moving", `{"element":"foo"}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/moving", `{"element":"bar"}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/moving", `{"element":"foo"}`, http.StatusOK},
+	}
+
+	for _, req := range requests {
+		request, err := http.NewRequest(req.method, req.url, strings.NewReader(req.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != req.code {
+			t.Errorf("on %s %s response code is %v, expected %v", req.method, req.url, response.Code, req.code)
+		}
+	}
+
+	db, _ := ResourceDatabase(conn, "db")
+	if stack, _ := ResourceStack(db, "rejecting"); stack.Size() != 2 || stack.Peek() != "bar" || stack.Status().Unique != pila.UniqueReject {
+		t.Errorf("stack %s is not unique", stack.Name)
+	}
+	if stack, _ := ResourceStack(db, "moving"); stack.Size() != 2 || stack.Peek() != "foo" || stack.Status().Unique != pila.UniqueMoveToTop {
+		t.Errorf("stack %s is not unique", stack.Name)
+	}
+	if _, ok := ResourceStack(db, "invalid"); ok {
+		t.Error("stack invalid was created")
+	}
+}
+
+func TestStackHandler_Limit(t *testing.T) {
+	conn := NewConn()
+	conn.Pila.CreateDatabase("db")
+
+	requests := []struct {
+		method, url, body string
+		code              int
+	}{
+		{"PUT", "/databases/db/stacks?name=rejecting&max_size=1", "", http.StatusCreated},
+		{"PUT", "/databases/db/stacks?name=dropping&max_size=1&policy=drop_oldest", "", http.StatusCreated},
+		{"PUT", "/databases/db/stacks?name=invalid&max_size=1&policy=foo", "", http.StatusBadRequest},
+		{"PUT", "/databases/db/stacks?name=queue&type=queue&max_size=2", "", http.StatusCreated},
+		{"PUT", "/databases/db/stacks?name=invalid&type=foo", "", http.StatusBadRequest},
+		{"PUT", "/databases/db/stacks?name=priority&type=priority", "", http.StatusCreated},
+		{"POST", "/databases/db/stacks/rejecting", `{"element":"foo"}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/rejecting", `{"element":"bar"}`, http.StatusConflict},
+		{"POST", "/databases/db/stacks/dropping", `{"element":"foo"}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/dropping", `{"element":"bar"}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/queue", `{"element":"foo"}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/queue", `{"element":"bar"}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/queue", `{"element":"baz","priority":1}`, http.StatusBadRequest},
+		{"POST", "/databases/db/stacks/priority", `{"element":"foo","priority":5}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/priority?ttl=1h", `{"element":"bar","priority":1}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/priority", `{"element":"baz"}`, http.StatusOK},
+	}
+
+	for _, req := range requests {
+		request, err := http.NewRequest(req.method, req.url, strings.NewReader(req.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != req.code {
+			t.Errorf("on %s %s response code is %v, expected %v", req.method, req.url, response.Code, req.code)
+		}
+	}
+
+	db, _ := ResourceDatabase(conn, "db")
+	if stack, _ := ResourceStack(db, "rejecting"); stack.Size() != 1 || stack.Peek() != "foo" {
+		t.Errorf("stack %s is not limited", stack.Name)
+	}
+	if stack, _ := ResourceStack(db, "dropping"); stack.Size() != 1 || stack.Peek() != "bar" {
+		t.Errorf("stack %s is not limited", stack.Name)
+	}
+	if stack, _ := ResourceStack(db, "queue"); stack.Type != pila.StructureQueue || stack.Peek() != "foo" {
+		t.Errorf("stack %s is not a queue", stack.Name)
+	}
+	if stack, _ := ResourceStack(db, "priority"); stack.Size() != 3 || stack.Peek() != "foo" {
+		t.Errorf("stack %s is not ordered by priority", stack.Name)
+	}
+	if _, ok := ResourceStack(db, "invalid"); ok {
+		t.Error("stack invalid was created")
+	}
+}
+
+func TestCreateDatabaseHandler_Spill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conn := NewConn()
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		path     string
+		spillDir string
+		code     int
+	}{
+		{"/databases?name=nodir&spill=2", "", http.StatusBadRequest},
+		{"/databases?name=invalid&spill=0", dir, http.StatusBadRequest},
+		{"/databases?name=db&spill=3", dir, http.StatusCreated},
+		{"/databases/db/stacks?name=stack", dir, http.StatusCreated},
+		{"/databases/db/stacks?name=own&spill=5", dir, http.StatusCreated},
+		{"/databases/db/stacks?name=queue&type=queue", dir, http.StatusCreated},
+		{"/databases/db/stacks?name=compressed&compress=64", dir, http.StatusCreated},
+		{"/databases/db/stacks?name=both&compress=64&spill=5", dir, http.StatusBadRequest},
+		{"/databases/db/stacks?name=invalid&compress=0", dir, http.StatusBadRequest},
+		{"/databases/db/stacks?name=memory", "", http.StatusCreated},
+	}
+
+	for _, io := range inputOutput {
+		conn.Pila.SetSpillDir(io.spillDir)
+		request, err := http.NewRequest("PUT", io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, io.path)
+		}
+	}
+
+	db, ok := ResourceDatabase(conn, "db")
+	if !ok {
+		t.Fatal("database not created")
+	}
+	if status := db.Status(); status.Spill != 3 {
+		t.Errorf("database spill is %d, expected %d", status.Spill, 3)
+	}
+	for name, spill := range map[string]int{"stack": 3, "own": 5, "queue": 0, "compressed": 0, "memory": 0} {
+		if stack, _ := ResourceStack(db, name); stack.Spill() != spill {
+			t.Errorf("stack %s spill is %d, expected %d", name, stack.Spill(), spill)
+		}
+	}
+	if stack, _ := ResourceStack(db, "compressed"); stack.Compress() != 64 {
+		t.Errorf("stack compress is %d, expected %d", stack.Compress(), 64)
+	}
+}
+
+func TestCreateStackHandler_Spill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conn := NewConn()
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		path     string
+		spillDir string
+		code     int
+	}{
+		{"/databases?name=db", "", http.StatusCreated},
+		{"/databases/db/stacks?name=nodir&spill=2", "", http.StatusBadRequest},
+		{"/databases/db/stacks?name=queue&spill=2&type=queue", dir, http.StatusBadRequest},
+		{"/databases/db/stacks?name=invalid&spill=0", dir, http.StatusBadRequest},
+		{"/databases/db/stacks?name=stack&spill=2", dir, http.StatusCreated},
+	}
+
+	for _, io := range inputOutput {
+		conn.Pila.SetSpillDir(io.spillDir)
+		request, err := http.NewRequest("PUT", io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, io.path)
+		}
+	}
+
+	db, _ := ResourceDatabase(conn, "db")
+	stack, ok := ResourceStack(db, "stack")
+	if !ok {
+		t.Fatal("stack not created")
+	}
+	for i := 0; i < 10; i++ {
+		stack.Push(fmt.Sprint(i))
+	}
+	if s := stack.Status(); s.Spill != 2 || s.Size != 10 {
+		t.Errorf("stack spill and size are %d and %d, expected %d and %d", s.Spill, s.Size, 2, 10)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 || files[0].Size() == 0 {
+		t.Errorf("spill files are %v, expected a non-empty one", files)
+	}
+	for i := 9; i >= 0; i-- {
+		if element, ok := stack.Pop(); !ok || element != fmt.Sprint(i) {
+			t.Errorf("popped element is %v, expected %v", element, i)
+		}
+	}
+}
+
+func TestCreateStackHandler_Store(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var options []pila.StoreOptions
+	pila.RegisterStore("pilad-test", func(opts pila.StoreOptions) (pila.Store, error) {
+		options = append(options, opts)
+		return stack.NewQueue(), nil
+	})
+
+	conn := NewConn()
+	conn.Pila.SetSpillDir(dir)
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		path  string
+		code  int
+		store string
+		spill int
+	}{
+		{"/databases?name=db&spill=4", http.StatusCreated, "", 0},
+		{"/databases/db/stacks?name=unknown&store=bolt", http.StatusBadRequest, "", 0},
+		{"/databases/db/stacks?name=compress&store=pilad-test&compress=1", http.StatusBadRequest, "", 0},
+		{"/databases/db/stacks?name=queue&store=spill&type=queue", http.StatusBadRequest, "", 0},
+		{"/databases/db/stacks?name=default", http.StatusCreated, pila.StoreSpill, 4},
+		{"/databases/db/stacks?name=memory&store=memory", http.StatusCreated, "", 0},
+		{"/databases/db/stacks?name=spill&store=spill", http.StatusCreated, pila.StoreSpill, 4},
+		{"/databases/db/stacks?name=test&store=pilad-test&type=queue", http.StatusCreated, "pilad-test", 0},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("PUT", io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, io.path)
+		}
+		if response.Code != http.StatusCreated || strings.HasPrefix(io.path, "/databases?") {
+			continue
+		}
+		var status pila.StackStatus
+		if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+		if status.Store != io.store || status.Spill != io.spill {
+			t.Errorf("stack store and spill are %q and %d, expected %q and %d for %s", status.Store, status.Spill, io.store, io.spill, io.path)
+		}
+	}
+
+	if expected := []pila.StoreOptions{{Structure: pila.StructureQueue, Dir: dir}}; len(options) != 1 || options[0].Structure != expected[0].Structure || options[0].Dir != dir {
+		t.Errorf("store options are %v, expected %v", options, expected)
+	}
+}
+
+// benchmarkStackHandler benchmarks serve on a Stack, discarding the
+// logs while it runs. Requests are served by the handlers directly,
+// so routing and middlewares are left out.
+func benchmarkStackHandler(b *testing.B, serve func(conn *Conn, w http.ResponseWriter, stack *pila.Stack)) {
+	logger.Default().SetOutput(ioutil.Discard)
+	defer logger.Default().SetOutput(os.Stderr)
+
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := db.Stacks[db.CreateStack("stack", time.Now())]
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		response := httptest.NewRecorder()
+		serve(conn, response, stack)
+		if response.Code != http.StatusOK {
+			b.Fatalf("response code is %v, expected %v", response.Code, http.StatusOK)
+		}
+	}
+}
+
+var benchmarkElement = []byte(`{"element":{"id":1,"name":"element","tags":["a","b"]}}`)
+
+func BenchmarkPushStackHandler(b *testing.B) {
+	benchmarkStackHandler(b, func(conn *Conn, w http.ResponseWriter, stack *pila.Stack) {
+		request, _ := http.NewRequest("POST", "/databases/db/stacks/stack", bytes.NewReader(benchmarkElement))
+		conn.pushStackHandler(w, request, stack)
+	})
+}
+
+func BenchmarkPopStackHandler(b *testing.B) {
+	benchmarkStackHandler(b, func(conn *Conn, w http.ResponseWriter, stack *pila.Stack) {
+		var element pila.Element
+		_ = element.Decode(bytes.NewReader(benchmarkElement))
+		_ = stack.Push(element.Value)
+
+		request, _ := http.NewRequest("DELETE", "/databases/db/stacks/stack", nil)
+		conn.popStackHandler(w, request, stack)
+	})
+}
+
+func BenchmarkRouter_PushStack(b *testing.B) {
+	logger.Default().SetOutput(ioutil.Discard)
+	defer logger.Default().SetOutput(os.Stderr)
+
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	db.CreateStack("stack", time.Now())
+	router := Router(conn)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		request, _ := http.NewRequest("POST", "/databases/db/stacks/stack", bytes.NewReader(benchmarkElement))
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if response.Code != http.StatusOK {
+			b.Fatalf("response code is %v, expected %v", response.Code, http.StatusOK)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// corsMaxAge is the number of seconds browsers
+// may cache the answer to a preflight request.
+const corsMaxAge = 600
+
+// CORSMiddleware returns a middleware that lets browsers call pilad
+// from the origins in CORS_ORIGINS, using the methods in CORS_METHODS
+// and the headers in CORS_HEADERS. Preflight requests are answered
+// with 204 No Content if allowed, and with 403 Forbidden otherwise,
+// without reaching the next handler. Requests without an Origin
+// header, or from an origin not allowed, are served as usual, and
+// browsers reject their responses. Nothing is allowed if CORS_ORIGINS
+// is empty, which is the default.
+func CORSMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Origin")
+
+			allowed := corsAllowedOrigin(conn.Config.CORSOrigins(), origin)
+			if !preflight {
+				if allowed != "" {
+					w.Header().Set("Access-Control-Allow-Origin", allowed)
+					// let browsers read the versions of stacks
+					w.Header().Set("Access-Control-Expose-Headers", "ETag, Element-Pushed-At, Element-Tag")
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			methods := conn.Config.CORSMethods()
+			method := r.Header.Get("Access-Control-Request-Method")
+			if allowed == "" || !containsFold(methods, method) {
+				logResponse(r, http.StatusForbidden, "reason", "CORS request not allowed", "origin", origin, "request_method", method)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if headers := conn.Config.CORSHeaders(); len(headers) > 0 {
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+			}
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+			logResponse(r, http.StatusNoContent)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// corsAllowedOrigin returns the value of the Access-Control-Allow-Origin
+// header answering a request from origin, given the allowed origins, or
+// an empty string if it is not allowed.
+func corsAllowedOrigin(origins []string, origin string) string {
+	for _, o := range origins {
+		if o == "*" {
+			return "*"
+		}
+		if strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// containsFold returns whether values contains
+// value, regardless of their case.
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set(vars.CORSOrigins, "https://dashboard.example.com, https://admin.example.com")
+	conn.Pila.CreateDatabase("db")
+	handler := CORSMiddleware(conn)(Router(conn))
+
+	inputOutput := []struct {
+		method, origin, requestMethod string
+		code                          int
+		allowOrigin, allowMethods     string
+	}{
+		{"OPTIONS", "https://dashboard.example.com", "PUT", http.StatusNoContent,
+			"https://dashboard.example.com", "GET, POST, PUT, DELETE, PATCH"},
+		{"OPTIONS", "https://ADMIN.example.com", "delete", http.StatusNoContent,
+			"https://ADMIN.example.com", "GET, POST, PUT, DELETE, PATCH"},
+		{"OPTIONS", "https://evil.example.com", "PUT", http.StatusForbidden, "", ""},
+		{"OPTIONS", "https://dashboard.example.com", "TRACE", http.StatusForbidden, "", ""},
+		{"PUT", "https://dashboard.example.com", "", http.StatusCreated, "https://dashboard.example.com", ""},
+		{"PUT", "https://evil.example.com", "", http.StatusCreated, "", ""},
+		{"PUT", "", "", http.StatusCreated, "", ""},
+	}
+
+	for i, io := range inputOutput {
+		request, err := http.NewRequest(io.method, "/databases/db/stacks?name=stack"+strconv.Itoa(i), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if io.origin != "" {
+			request.Header.Set("Origin", io.origin)
+		}
+		if io.requestMethod != "" {
+			request.Header.Set("Access-Control-Request-Method", io.requestMethod)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("%d: response code is %v, expected %v", i, response.Code, io.code)
+		}
+		if origin := response.Header().Get("Access-Control-Allow-Origin"); origin != io.allowOrigin {
+			t.Errorf("%d: allowed origin is %q, expected %q", i, origin, io.allowOrigin)
+		}
+		if methods := response.Header().Get("Access-Control-Allow-Methods"); methods != io.allowMethods {
+			t.Errorf("%d: allowed methods are %q, expected %q", i, methods, io.allowMethods)
+		}
+	}
+}
+
+func TestCORSMiddleware_Preflight(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set(vars.CORSOrigins, "*")
+	conn.Config.Set(vars.CORSHeaders, "Authorization, Content-Type, X-Request-Id")
+	handler := CORSMiddleware(conn)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("preflight request reached the next handler")
+	}))
+
+	request, _ := http.NewRequest("OPTIONS", "/databases/db/stacks/stack", nil)
+	request.Header.Set("Origin", "https://dashboard.example.com")
+	request.Header.Set("Access-Control-Request-Method", "DELETE")
+	request.Header.Set("Access-Control-Request-Headers", "authorization")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	expectedHeaders := map[string]string{
+		"Access-Control-Allow-Origin":  "*",
+		"Access-Control-Allow-Headers": "Authorization, Content-Type, X-Request-Id",
+		"Access-Control-Max-Age":       "600",
+		"Vary":                         "Origin",
+	}
+	if response.Code != http.StatusNoContent {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusNoContent)
+	}
+	for header, expected := range expectedHeaders {
+		if value := response.Header().Get(header); value != expected {
+			t.Errorf("%s is %q, expected %q", header, value, expected)
+		}
+	}
+}
+
+func TestCORSMiddleware_Disabled(t *testing.T) {
+	conn := NewConn()
+	handler := CORSMiddleware(conn)(Router(conn))
+
+	request, _ := http.NewRequest("OPTIONS", "/databases", nil)
+	request.Header.Set("Origin", "https://dashboard.example.com")
+	request.Header.Set("Access-Control-Request-Method", "PUT")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusForbidden {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusForbidden)
+	}
+	if origin := response.Header().Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Errorf("allowed origin is %q, expected none", origin)
+	}
+}
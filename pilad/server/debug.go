@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// Debug returns true if the debug endpoints of pilad, profiling
+// it with pprof and exposing its expvar variables, are enabled.
+func (c *Conn) Debug() bool {
+	return atomic.LoadInt32(&c.debug) == 1
+}
+
+// SetDebug enables or disables the debug endpoints of pilad.
+func (c *Conn) SetDebug(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&c.debug, v)
+}
+
+// debugHandler returns whether the debug endpoints are enabled, and
+// enables or disables them on PUT, given the enabled parameter.
+func (c *Conn) debugHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "PUT" {
+		enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+		if err != nil {
+			logResponse(r, http.StatusBadRequest, "reason", "invalid enabled value", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if enabled != c.Debug() {
+			c.SetDebug(enabled)
+			logger.Info("debug endpoints changed", "enabled", enabled)
+		}
+	}
+
+	// Do not check error as a map of booleans
+	// is always valid for a JSON encoding.
+	b, _ := json.Marshal(map[string]bool{"debug": c.Debug()})
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(b)
+}
+
+// debugEndpoint returns a handler calling h if the debug
+// endpoints are enabled, and returning 404 otherwise, so
+// they are not known to exist.
+func (c *Conn) debugEndpoint(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.Debug() {
+			c.notFoundHandler(w, r)
+			return
+		}
+		logResponse(r, http.StatusOK)
+		h(w, r)
+	}
+}
+
+// expvarHandler writes the variables published with expvar as
+// a JSON object, like the /debug/vars handler of expvar.
+func expvarHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprint(w, "{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if !first {
+			fmt.Fprint(w, ",\n")
+		}
+		first = false
+		fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+	})
+	fmt.Fprint(w, "\n}\n")
+}
+
+// debugRoutes are the handlers of the debug endpoints,
+// by path, served by pprof and expvar.
+var debugRoutes = []struct {
+	path    string
+	handler http.HandlerFunc
+}{
+	{"/debug/pprof/", pprof.Index},
+	{"/debug/pprof/cmdline", pprof.Cmdline},
+	{"/debug/pprof/profile", pprof.Profile},
+	{"/debug/pprof/symbol", pprof.Symbol},
+	{"/debug/pprof/trace", pprof.Trace},
+	// heap, goroutine, block, threadcreate and the
+	// other named profiles are served by pprof.Index
+	{"/debug/pprof/{profile}", pprof.Index},
+	{"/debug/vars", expvarHandler},
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	conn := NewConn()
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"GET", "/_debug", http.StatusOK, `{"debug":false}`},
+		{"GET", "/debug/pprof/", http.StatusNotFound, ""},
+		{"GET", "/debug/pprof/heap", http.StatusNotFound, ""},
+		{"GET", "/debug/vars", http.StatusNotFound, ""},
+		{"PUT", "/_debug?enabled=maybe", http.StatusBadRequest, ""},
+		{"PUT", "/_debug?enabled=true", http.StatusOK, `{"debug":true}`},
+		{"GET", "/_debug", http.StatusOK, `{"debug":true}`},
+		{"GET", "/debug/pprof/", http.StatusOK, "goroutine"},
+		{"GET", "/debug/pprof/goroutine?debug=1", http.StatusOK, "goroutine profile"},
+		{"GET", "/debug/pprof/cmdline", http.StatusOK, ""},
+		{"GET", "/debug/vars", http.StatusOK, `"memstats"`},
+		{"PUT", "/_debug?enabled=false", http.StatusOK, `{"debug":false}`},
+		{"GET", "/debug/vars", http.StatusNotFound, ""},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if body := response.Body.String(); !strings.Contains(body, io.body) {
+			t.Errorf("body is %.100s, expected to contain %s for %s %s", body, io.body, io.method, io.path)
+		}
+	}
+}
+
+func TestExpvarHandler(t *testing.T) {
+	response := httptest.NewRecorder()
+	expvarHandler(response, nil)
+
+	var vars map[string]interface{}
+	if err := json.Unmarshal(response.Body.Bytes(), &vars); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := vars["cmdline"]; !ok {
+		t.Errorf("vars are %v, expected cmdline", vars)
+	}
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// dryRunParam returns whether the dry_run parameter of a request is
+// true, so a destructive operation is only previewed. If it is not a
+// boolean, it writes 400 and returns false as second value.
+func dryRunParam(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	dryRun, err := boolParam(r, "dry_run")
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return false, false
+	}
+	return dryRun, true
+}
+
+// writePreview writes 200 and the Preview of a destructive
+// operation requested as a dry run.
+func writePreview(w http.ResponseWriter, r *http.Request, preview pila.Preview) {
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK, "reason", "dry run")
+	w.Write(preview.ToJSON())
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestDryRun(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	_ = db.AddStack(pila.NewStack("empty", time.Now().UTC()))
+	stack.Push("foo")
+	stack.Push("bar")
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path string
+		body         string
+		code         int
+		output       pila.Preview
+	}{
+		{"DELETE", "/databases/db?dry_run=foo", "", http.StatusBadRequest, pila.Preview{}},
+		{"DELETE", "/databases/db?cascade=false&dry_run=true", "", http.StatusConflict, pila.Preview{}},
+		{"DELETE", "/databases/db?dry_run=true", "", http.StatusOK, pila.Preview{Databases: 1, Stacks: 2, Elements: 2}},
+		{"DELETE", "/databases/db/_flush?dry_run=true", "", http.StatusOK, pila.Preview{Elements: 2}},
+		{"DELETE", "/databases/db/stacks/stack?full&dry_run=true", "", http.StatusOK, pila.Preview{Stacks: 1, Elements: 2}},
+		{"DELETE", "/databases/db/stacks/stack?flush&dry_run=true", "", http.StatusOK, pila.Preview{Elements: 2}},
+		{"DELETE", "/databases/db/stacks/stack/flush?dry_run=1", "", http.StatusOK, pila.Preview{Elements: 2}},
+		{"DELETE", "/databases/db/stacks/stack/flush?dry_run=foo", "", http.StatusBadRequest, pila.Preview{}},
+		{"POST", "/_restore?dry_run=true", "foo", http.StatusBadRequest, pila.Preview{}},
+		{"POST", "/_restore?dry_run=true", `{"version":1,"databases":[]}`, http.StatusOK, pila.Preview{Databases: 1, Stacks: 2, Elements: 2}},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, bytes.NewBufferString(io.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if io.code != http.StatusOK {
+			continue
+		}
+		var preview pila.Preview
+		if err := json.Unmarshal(response.Body.Bytes(), &preview); err != nil {
+			t.Fatal(err)
+		}
+		if preview.Databases != io.output.Databases || preview.Stacks != io.output.Stacks || preview.Elements != io.output.Elements {
+			t.Errorf("preview is %v, expected %v for %s %s", preview, io.output, io.method, io.path)
+		}
+	}
+
+	if n := conn.Pila.Status().NumberDatabases; n != 1 || stack.Size() != 2 || db.Status().NumberStacks != 2 {
+		t.Errorf("pila changed on dry run: %d databases, %d elements", n, stack.Size())
+	}
+}
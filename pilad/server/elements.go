@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+const (
+	// elementsLimitDefault is the default number of
+	// elements of a page of the content of a Stack.
+	elementsLimitDefault = 100
+	// elementsLimitMax is the maximum number of
+	// elements of a page of the content of a Stack.
+	elementsLimitMax = 1000
+)
+
+// ElementsPage represents a page of the content of a Stack,
+// ordered from the top.
+type ElementsPage struct {
+	Values []interface{} `json:"elements"`
+	Offset int           `json:"offset"`
+	Limit  int           `json:"limit"`
+	// Total is the size of the Stack
+	Total int `json:"total"`
+}
+
+// ToJSON converts an ElementsPage into JSON.
+func (page ElementsPage) ToJSON() ([]byte, error) {
+	return json.Marshal(page)
+}
+
+// elementsStackHandler returns 200 and a page of the elements of the
+// Stack, from the top, without modifying it. The page is given by the
+// offset and limit parameters.
+func (c *Conn) elementsStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	offset, err := offsetParam(r)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(r, "limit", elementsLimitDefault, elementsLimitMax)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	page := ElementsPage{
+		Values: stack.Elements(offset, limit),
+		Offset: offset,
+		Limit:  limit,
+		Total:  stack.Size(),
+	}
+	stack.Read(requestDate(r))
+
+	logResponse(r, http.StatusOK, "elements", len(page.Values))
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as we consider our elements
+	// suitable for a JSON encoding.
+	b, _ := page.ToJSON()
+	w.Write(b)
+}
+
+// offsetParam returns the value of the offset parameter of the
+// request, 0 if not given, or an error if it is not a
+// non-negative integer.
+func offsetParam(r *http.Request) (int, error) {
+	value := r.FormValue("offset")
+	if value == "" {
+		return 0, nil
+	}
+
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 || offset > math.MaxInt32 {
+		return 0, errors.New("offset must be a non-negative integer")
+	}
+	return offset, nil
+}
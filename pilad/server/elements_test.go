@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestElementsStackHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = stack.PushN([]interface{}{"foo", 8, "bar", true})
+	_ = db.AddStack(stack)
+	queue := pila.NewQueue("queue", time.Now().UTC())
+	_ = queue.PushN([]interface{}{"foo", 8, "bar", true})
+	_ = db.AddStack(queue)
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/databases/db/stacks/stack/elements", http.StatusOK,
+			`{"elements":[true,"bar",8,"foo"],"offset":0,"limit":100,"total":4}`},
+		{"/databases/db/stacks/stack/elements?offset=1&limit=2", http.StatusOK,
+			`{"elements":["bar",8],"offset":1,"limit":2,"total":4}`},
+		{"/databases/db/stacks/stack/elements?offset=10", http.StatusOK,
+			`{"elements":[],"offset":10,"limit":100,"total":4}`},
+		{"/databases/db/stacks/queue/elements?limit=2", http.StatusOK,
+			`{"elements":["foo",8],"offset":0,"limit":2,"total":4}`},
+		{"/databases/db/stacks/stack/elements?offset=-1", http.StatusBadRequest, ""},
+		{"/databases/db/stacks/stack/elements?limit=0", http.StatusBadRequest, ""},
+		{"/databases/db/stacks/stack/elements?limit=1001", http.StatusBadRequest, ""},
+		{"/databases/db/stacks/foo/elements", http.StatusGone, ""},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("GET", io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, io.path)
+		}
+		if body := response.Body.String(); body != io.body {
+			t.Errorf("body is %s, expected %s for %s", body, io.body, io.path)
+		}
+	}
+
+	if stack.Size() != 4 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 4)
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// EncryptionStatus represents the encryption keys of pilad,
+// identified by their IDs, without revealing them.
+type EncryptionStatus struct {
+	// Keys are the IDs of the keys, in the order they were added
+	Keys []string `json:"keys"`
+	// Current is the ID of the key encrypting new elements
+	Current string `json:"current,omitempty"`
+}
+
+// ToJSON converts an EncryptionStatus into JSON.
+func (status EncryptionStatus) ToJSON() []byte {
+	// Do not check error as the EncryptionStatus does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(status)
+	return b
+}
+
+// encryptionStatus returns the EncryptionStatus of the Connection.
+func (c *Conn) encryptionStatus() EncryptionStatus {
+	status := EncryptionStatus{Keys: []string{}}
+	if keys := c.Pila.Keyring(); keys != nil {
+		status.Keys = keys.IDs()
+		status.Current = keys.Current()
+	}
+	return status
+}
+
+// encryptionHandler returns the EncryptionStatus of the Connection.
+func (c *Conn) encryptionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(c.encryptionStatus().ToJSON())
+}
+
+// rotateKeyHandler adds the encryption key of the request body, given
+// its ID and its value encoded in base64, as the current one, so new
+// elements of encrypted stacks are encrypted with it, and returns the
+// EncryptionStatus. Former keys are kept to decrypt the elements
+// encrypted with them. Returns 400 if the key is not valid or its ID
+// already exists.
+func (c *Conn) rotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		logResponse(r, http.StatusBadRequest, "reason", "no key provided")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on reading key", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var key struct {
+		ID  string `json:"id"`
+		Key []byte `json:"key"`
+	}
+	if err := json.Unmarshal(body, &key); err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on decoding key", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := c.Pila.AddKey(key.ID, key.Key); err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	logger.Info("encryption key rotated", "key", key.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(c.encryptionStatus().ToJSON())
+}
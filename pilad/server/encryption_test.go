@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+)
+
+func TestEncryptionHandlers(t *testing.T) {
+	conn := NewConn()
+	router := Router(conn)
+
+	inputOutput := []struct {
+		method, path, body string
+		code               int
+		response           string
+	}{
+		{"GET", "/_encryption", "", http.StatusOK, `{"keys":[]}`},
+		{"POST", "/_encryption/rotate", `{"id":"a","key":"AAAAAAAAAAAAAAAAAAAAAA=="}`, http.StatusOK, `{"keys":["a"],"current":"a"}`},
+		{"POST", "/_encryption/rotate", `{"id":"b","key":"AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="}`, http.StatusOK, `{"keys":["a","b"],"current":"b"}`},
+		{"POST", "/_encryption/rotate", `{"id":"a","key":"AAAAAAAAAAAAAAAAAAAAAA=="}`, http.StatusBadRequest, ""},
+		{"POST", "/_encryption/rotate", `{"id":"c","key":"Zm9v"}`, http.StatusBadRequest, ""},
+		{"POST", "/_encryption/rotate", `{"id":"c","key":"foo!"}`, http.StatusBadRequest, ""},
+		{"POST", "/_encryption/rotate", `{"key":"AAAAAAAAAAAAAAAAAAAAAA=="}`, http.StatusBadRequest, ""},
+		{"POST", "/_encryption/rotate", `{`, http.StatusBadRequest, ""},
+		{"GET", "/_encryption", "", http.StatusOK, `{"keys":["a","b"],"current":"b"}`},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.body)
+		}
+		if io.response == "" {
+			continue
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != io.response {
+			t.Errorf("body is %s, expected %s for %s %s", body, io.response, io.method, io.body)
+		}
+	}
+}
+
+func TestRotateKeyHandler_NoBody(t *testing.T) {
+	conn := NewConn()
+	request, err := http.NewRequest("POST", "/_encryption/rotate", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	conn.rotateKeyHandler(response, request)
+
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCreateStackHandler_Encrypt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conn := NewConn()
+	conn.Pila.SetSpillDir(dir)
+	db := pila.NewDatabase("db")
+	db.SetSpill(3)
+	_ = conn.Pila.AddDatabase(db)
+	router := Router(conn)
+
+	inputOutput := []struct {
+		path string
+		keys bool
+		code int
+	}{
+		{"/databases/db/stacks?name=nokeys&encrypt=true", false, http.StatusBadRequest},
+		{"/databases/db/stacks?name=encrypted&encrypt=true", true, http.StatusCreated},
+		{"/databases/db/stacks?name=plain&encrypt=false", true, http.StatusCreated},
+		{"/databases/db/stacks?name=invalid&encrypt=maybe", true, http.StatusBadRequest},
+		{"/databases/db/stacks?name=unique&encrypt=true&unique=true", true, http.StatusBadRequest},
+		{"/databases/db/stacks?name=spill&encrypt=true&spill=5", true, http.StatusBadRequest},
+	}
+
+	for _, io := range inputOutput {
+		conn.Pila.SetKeyring(nil)
+		if io.keys {
+			_ = conn.Pila.AddKey("a", make([]byte, 16))
+		}
+		request, err := http.NewRequest("PUT", io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, io.path)
+		}
+	}
+
+	// encrypted stacks do not spill like their database
+	if stack, _ := ResourceStack(db, "encrypted"); !stack.Status().Encrypted || stack.Spill() != 0 {
+		t.Errorf("stack is encrypted %v and spills %d, expected %v and %d", stack.Status().Encrypted, stack.Spill(), true, 0)
+	}
+	if stack, _ := ResourceStack(db, "plain"); stack.Status().Encrypted || stack.Spill() != 3 {
+		t.Errorf("stack is encrypted %v and spills %d, expected %v and %d", stack.Status().Encrypted, stack.Spill(), false, 3)
+	}
+}
+
+func TestPersistStack_Encrypted(t *testing.T) {
+	conn := NewConn()
+	_ = conn.Pila.AddKey("a", make([]byte, 16))
+	_ = conn.Pila.AddDatabase(pila.NewDatabase("db"))
+	router := Router(conn)
+	records, unsubscribe := conn.Replication.subscribe()
+	defer unsubscribe()
+
+	requests := []struct {
+		method, path, body string
+	}{
+		{"PUT", "/databases/db/stacks?name=stack&encrypt=true", ""},
+		{"POST", "/databases/db/stacks/stack", `{"element":"foo"}`},
+		{"POST", "/databases/db/stacks/stack", `{"element":"aGVsbG8=","content_type":"text/plain"}`},
+	}
+	for _, req := range requests {
+		request, err := http.NewRequest(req.method, req.path, bytes.NewBufferString(req.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if response.Code >= 300 {
+			t.Fatalf("response code is %v for %s %s", response.Code, req.method, req.path)
+		}
+	}
+
+	if record := <-records; record.Op != persist.OpCreateStack || !record.Encrypted {
+		t.Errorf("record is %+v, expected an encrypted stack", record)
+	}
+	for _, expected := range []interface{}{"foo", pila.Binary{ContentType: "text/plain", Data: []byte("hello")}} {
+		record := <-records
+		if record.Op != persist.OpPush || record.Element != nil || record.ContentType != "" || record.Sealed == nil {
+			t.Fatalf("record is %+v, expected a sealed push", record)
+		}
+		value, err := conn.Pila.Keyring().Open(*record.Sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if binary, ok := expected.(pila.Binary); ok {
+			if b, ok := value.(pila.Binary); !ok || b.ContentType != binary.ContentType || string(b.Data) != string(binary.Data) {
+				t.Errorf("value is %v, expected %v", value, expected)
+			}
+		} else if value != expected {
+			t.Errorf("value is %v, expected %v", value, expected)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// exportStackHandler streams the elements of the Stack as newline
+// delimited JSON, one Element per line, in the order they must be
+// pushed to recreate it, i.e. from the bottom to the top of a stack.
+// Streaming stops if the client disconnects.
+func (c *Conn) exportStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	stack.Read(requestDate(r))
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	var n int
+	var err error
+	stack.ForEachElement(func(e pila.Element) bool {
+		if err = r.Context().Err(); err != nil {
+			return false
+		}
+		if err = enc.Encode(e); err != nil {
+			return false
+		}
+		n++
+		return true
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+
+	logResponse(r, http.StatusOK, "elements", n)
+	if err != nil {
+		logger.Warn("error on exporting stack", "stack", stack.Name, "error", err)
+	}
+}
+
+// importStackHandler pushes into the Stack the elements of the request
+// body, given as newline delimited JSON with one Element per line, as
+// they are read, and returns 200 and the Stack status. Elements are
+// not buffered, so if a line can not be pushed, the previous ones are
+// kept, and the error status is returned.
+func (c *Conn) importStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	now := requestDate(r)
+	if r.Body == nil {
+		logResponse(r, http.StatusBadRequest, "reason", "no elements provided")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	br := bufio.NewReader(r.Body)
+	limit := c.bodyLimit()
+	var n int
+	for number := 1; ; number++ {
+		line, err := readLine(br, limit)
+		if err == io.EOF {
+			break
+		}
+
+		code := http.StatusBadRequest
+		if err == errBodyTooLarge {
+			code = http.StatusRequestEntityTooLarge
+		}
+		if err == nil && len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if err == nil {
+			unlock := c.stackLocks.lock(stack)
+			code, err = c.importElement(r.Context(), stack, line, now)
+			unlock()
+		}
+		if err != nil {
+			logResponse(r, code, "reason", "error on importing line", "line", number, "elements", n, "error", err)
+			w.WriteHeader(code)
+			return
+		}
+		n++
+	}
+	if n > 0 {
+		stack.Update(now)
+	}
+
+	logResponse(r, http.StatusOK, "elements", n)
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as we consider that the
+	// stack has no JSON encoding issues.
+	b, _ := stack.Status().ToJSON()
+	w.Write(b)
+}
+
+// importElement pushes into the Stack the Element encoded in line,
+// and persists it dated t. If it can not be pushed, it returns the
+// status code and the error to respond with.
+func (c *Conn) importElement(ctx context.Context, stack *pila.Stack, line []byte, t time.Time) (int, error) {
+	var element pila.Element
+	var err error
+	if c.IsEnabled(strictSchemaFeature) {
+		err = element.DecodeStrict(bytes.NewReader(line))
+	} else {
+		err = element.Decode(bytes.NewReader(line))
+	}
+	var value interface{}
+	if err == nil {
+		value, err = element.StackValue()
+	}
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("error on decoding element: %v", err)
+	}
+	if element.Priority != nil && stack.Type != pila.StructurePriority {
+		return http.StatusBadRequest, fmt.Errorf("priority given to a stack of type %s", stack.Type)
+	}
+
+	if s := c.Config.MaxStackSize(); s != -1 && stack.Size() >= s {
+		return http.StatusNotAcceptable, fmt.Errorf("%s value reached", vars.MaxStackSize)
+	}
+	if element.Priority != nil {
+		err = stack.PushWithPriority(value, *element.Priority, time.Time{})
+	} else {
+		err = stack.Push(value)
+	}
+	if err == pila.ErrElementTooLarge {
+		return http.StatusRequestEntityTooLarge, err
+	}
+	if err == pila.ErrMemoryLimit {
+		return http.StatusInsufficientStorage, err
+	}
+	if err != nil {
+		return http.StatusConflict, err
+	}
+
+	c.persistStack(ctx, stack, persist.Record{Op: persist.OpPush, Time: t, Element: element.Value, Priority: element.Priority, ContentType: element.ContentType})
+	return http.StatusOK, nil
+}
+
+// readLine reads a line, returning errBodyTooLarge if it is longer than
+// limit bytes, unless limit is -1. Larger lines are not read further.
+func readLine(br *bufio.Reader, limit int64) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := br.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if limit != -1 && int64(len(line)) > limit {
+			return nil, errBodyTooLarge
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestExportImportStackHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	other := pila.NewStack("other", time.Now().UTC())
+	_ = db.AddStack(other)
+	_ = stack.Push("foo")
+	_ = stack.Push(map[string]interface{}{"a": 1.0})
+	_ = stack.Push(pila.Binary{ContentType: "text/plain", Data: []byte("bar")})
+
+	request, _ := http.NewRequest("GET", "/databases/db/stacks/stack/_export", nil)
+	response := httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+
+	expected := `{"element":"foo"}` + "\n" +
+		`{"element":{"a":1}}` + "\n" +
+		`{"element":"YmFy","content_type":"text/plain"}` + "\n"
+	if response.Code != http.StatusOK || response.Body.String() != expected {
+		t.Errorf("response is %v %s, expected %v %s", response.Code, response.Body, http.StatusOK, expected)
+	}
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("Content-Type is %s, expected %s", contentType, "application/x-ndjson")
+	}
+
+	request, _ = http.NewRequest("PUT", "/databases/db/stacks/other/_import", strings.NewReader(expected+"\n"))
+	response = httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+	if elements, expected := other.Elements(0, 10), stack.Elements(0, 10); !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+}
+
+func TestExportStackHandler_Canceled(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	_ = stack.PushN([]interface{}{"foo", "bar"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request, _ := http.NewRequest("GET", "/databases/db/stacks/stack/_export", nil)
+	response := httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request.WithContext(ctx))
+
+	if response.Body.Len() != 0 {
+		t.Errorf("response is %s, expected no elements", response.Body)
+	}
+}
+
+func TestImportStackHandler_Error(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set(vars.MaxStackSize, 2)
+	conn.Config.Set(vars.MaxElementSize, 10)
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+
+	inputOutput := []struct {
+		input string
+		code  int
+		size  int
+	}{
+		{`{"element":"foo"}` + "\n" + `{"element":`, http.StatusBadRequest, 1},
+		{`{"element":"foo","priority":1}`, http.StatusBadRequest, 0},
+		{`{"element":"foo"}` + "\n" + `{"element":"bar"}` + "\n" + `{"element":"baz"}`, http.StatusNotAcceptable, 2},
+	}
+
+	for _, io := range inputOutput {
+		stack.Flush()
+		request, _ := http.NewRequest("PUT", "/databases/db/stacks/stack/_import", strings.NewReader(io.input))
+		response := httptest.NewRecorder()
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %q", response.Code, io.code, io.input)
+		}
+		if size := stack.Size(); size != io.size {
+			t.Errorf("stack size is %v, expected %v for %q", size, io.size, io.input)
+		}
+	}
+
+	stack.Flush()
+	request, _ := http.NewRequest("PUT", "/databases/db/stacks/stack/_import", strings.NewReader(`{"element":"`+strings.Repeat("a", 2000)+`"}`))
+	response := httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+	if response.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	br := bufio.NewReaderSize(strings.NewReader("foo\r\n"+strings.Repeat("a", 100)+"\nbar"), 16)
+
+	inputOutput := []struct {
+		limit  int64
+		output string
+		err    error
+	}{
+		{-1, "foo", nil},
+		{20, "", errBodyTooLarge},
+	}
+	for _, io := range inputOutput {
+		if line, err := readLine(br, io.limit); string(line) != io.output || err != io.err {
+			t.Errorf("line is %q and %v, expected %q and %v", line, err, io.output, io.err)
+		}
+	}
+}
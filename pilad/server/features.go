@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// strictSchemaFeature is the feature flag that enables the strict
+// validation of the elements pushed into a Stack.
+const strictSchemaFeature = "strict_schema"
+
+// IsEnabled determines whether a feature flag is enabled
+// in the Config of the Connection.
+func (c *Conn) IsEnabled(flag string) bool {
+	return c.Config.FeatureFlags[flag]
+}
+
+// featureFlags implements flag.Value to parse a list of
+// feature flags given as "name:bool" pairs, like
+// -feature=new_persistence:true -feature=strict_schema
+type featureFlags map[string]bool
+
+// String returns the feature flags as a comma-separated list,
+// sorted by name.
+func (ff featureFlags) String() string {
+	flags := make([]string, 0, len(ff))
+	for name, enabled := range ff {
+		flags = append(flags, fmt.Sprintf("%s:%t", name, enabled))
+	}
+	sort.Strings(flags)
+	return strings.Join(flags, ",")
+}
+
+// Set parses a "name:bool" pair and sets the feature flag. If the
+// boolean value is omitted, the flag is enabled.
+func (ff featureFlags) Set(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+	name := strings.TrimSpace(parts[0])
+	if name == "" {
+		return fmt.Errorf("missing feature name in %q", value)
+	}
+
+	enabled := true
+	if len(parts) == 2 {
+		var err error
+		enabled, err = strconv.ParseBool(parts[1])
+		if err != nil {
+			return fmt.Errorf("invalid value of feature %s: %v", name, err)
+		}
+	}
+
+	ff[name] = enabled
+	return nil
+}
+
+// featuresHandler writes the feature flags of the
+// Connection into the response.
+func (c *Conn) featuresHandler(w http.ResponseWriter, r *http.Request) {
+	// Do not check error as a map of booleans
+	// is always valid for a JSON encoding.
+	b, _ := json.Marshal(map[string]map[string]bool{"features": c.Config.FeatureFlags})
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(b)
+}
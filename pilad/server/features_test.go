@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestConnIsEnabled(t *testing.T) {
+	conn := NewConn()
+	conn.Config.FeatureFlags["foo"] = true
+	conn.Config.FeatureFlags["bar"] = false
+
+	inputOutput := []struct {
+		input  string
+		output bool
+	}{
+		{"foo", true},
+		{"bar", false},
+		{"baz", false},
+	}
+
+	for _, io := range inputOutput {
+		if enabled := conn.IsEnabled(io.input); enabled != io.output {
+			t.Errorf("IsEnabled(%s) is %v, expected %v", io.input, enabled, io.output)
+		}
+	}
+}
+
+func TestFeatureFlagsSet(t *testing.T) {
+	ff := featureFlags{}
+
+	for _, value := range []string{"new_persistence:true", "strict_schema", "foo:false", "foo:0"} {
+		if err := ff.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := featureFlags{"new_persistence": true, "strict_schema": true, "foo": false}
+	if !reflect.DeepEqual(ff, expected) {
+		t.Errorf("feature flags are %v, expected %v", ff, expected)
+	}
+
+	if s := ff.String(); s != "foo:false,new_persistence:true,strict_schema:true" {
+		t.Errorf("feature flags are %s", s)
+	}
+}
+
+func TestFeatureFlagsSet_Error(t *testing.T) {
+	ff := featureFlags{}
+
+	for _, value := range []string{"", ":true", "foo:bar"} {
+		if err := ff.Set(value); err == nil {
+			t.Errorf("err is nil for %s", value)
+		}
+	}
+}
+
+func TestBuildConfig_FeatureFlags(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Features["strict_schema"] = true
+
+	conn := NewConn()
+	conn.buildConfig(opts)
+
+	if !conn.IsEnabled("strict_schema") {
+		t.Error("strict_schema is not enabled")
+	}
+}
+
+func TestFeaturesHandler(t *testing.T) {
+	conn := NewConn()
+	conn.Config.FeatureFlags["strict_schema"] = true
+
+	request, err := http.NewRequest("GET", "/_features", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+
+	Router(conn).ServeHTTP(response, request)
+
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
+	}
+
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+
+	if expected := `{"features":{"strict_schema":true}}`; response.Body.String() != expected {
+		t.Errorf("features are %s, expected %s", response.Body.String(), expected)
+	}
+}
+
+func TestPushStackHandler_StrictSchema(t *testing.T) {
+	s := pila.NewStack("stack", time.Now().UTC())
+	conn := NewConn()
+
+	inputOutput := []struct {
+		strict bool
+		input  string
+		output int
+	}{
+		{false, `{"element":"foo","bar":1}`, http.StatusOK},
+		{true, `{"element":"foo","bar":1}`, http.StatusBadRequest},
+		{true, `{"element":null}`, http.StatusBadRequest},
+		{true, `{"element":"foo"}`, http.StatusOK},
+	}
+
+	for _, io := range inputOutput {
+		conn.Config.FeatureFlags[strictSchemaFeature] = io.strict
+
+		request, err := http.NewRequest("POST", "/databases/db/stacks/stack", bytes.NewBufferString(io.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+
+		conn.pushStackHandler(response, request, s)
+
+		if response.Code != io.output {
+			t.Errorf("on %s with strict %v response code is %v, expected %v", io.input, io.strict, response.Code, io.output)
+		}
+	}
+}
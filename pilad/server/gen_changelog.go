@@ -0,0 +1,30 @@
+// +build ignore
+
+// This program generates changelog_md.go from the CHANGELOG.md
+// file at the root of the repository. It is invoked by go generate.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+)
+
+func main() {
+	b, err := ioutil.ReadFile("../../CHANGELOG.md")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	src := fmt.Sprintf(`// Code generated by gen_changelog.go; DO NOT EDIT.
+
+package server
+
+// changelogMarkdown contains the CHANGELOG.md file of piladb.
+const changelogMarkdown = %q
+`, b)
+
+	if err := ioutil.WriteFile("changelog_md.go", []byte(src), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
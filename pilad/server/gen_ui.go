@@ -0,0 +1,30 @@
+// +build ignore
+
+// This program generates ui_html.go from the ui/index.html
+// file of the web UI. It is invoked by go generate.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+)
+
+func main() {
+	b, err := ioutil.ReadFile("ui/index.html")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	src := fmt.Sprintf(`// Code generated by gen_ui.go; DO NOT EDIT.
+
+package server
+
+// uiHTML contains the ui/index.html file of the web UI.
+const uiHTML = %q
+`, b)
+
+	if err := ioutil.WriteFile("ui_html.go", []byte(src), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
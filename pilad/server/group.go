@@ -0,0 +1,263 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultAckTimeout is the time given to the consumers of a
+	// group to acknowledge an element, unless set on the group.
+	defaultAckTimeout = 30 * time.Second
+	// defaultMaxDeliveries is the number of times an element is
+	// delivered before being dead-lettered, unless set on the
+	// dead-letter stack.
+	defaultMaxDeliveries = 5
+)
+
+// groupsStackHandler returns the status of the groups of consumers of
+// the Stack on GET, and adds the one given by the name and timeout
+// parameters on PUT.
+func (c *Conn) groupsStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	if r.Method == "PUT" {
+		c.addGroupHandler(w, r, stack)
+		return
+	}
+
+	// Do not check error as a list of GroupStatus
+	// is always valid for a JSON encoding.
+	b, _ := json.Marshal(map[string][]pila.GroupStatus{"groups": stack.Groups()})
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(b)
+}
+
+// addGroupHandler adds to the Stack the group of consumers given by
+// the name parameter, whose elements must be acknowledged within the
+// timeout parameter, and returns 201 and its status. Returns 400 if
+// the name or timeout are invalid, and 409 if the group exists.
+func (c *Conn) addGroupHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	name := r.FormValue("name")
+	if err := validateName("name", name); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	timeout := defaultAckTimeout
+	if value := r.FormValue("timeout"); value != "" {
+		var err error
+		if timeout, err = time.ParseDuration(value); err != nil || timeout <= 0 {
+			logResponse(r, http.StatusBadRequest, "reason", "timeout must be a positive duration", "value", value)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := stack.AddGroup(name, timeout); err != nil {
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	// Do not check error as a GroupStatus is
+	// always valid for a JSON encoding.
+	b, _ := json.Marshal(pila.GroupStatus{Name: name, AckTimeout: timeout.String()})
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusCreated)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(b)
+}
+
+// groupStackHandler removes the group of consumers given in the URL
+// from the Stack, pushing back its pending elements, and returns 204.
+// Returns 410 if the Stack has no such group.
+func (c *Conn) groupStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	unlock := c.stackLocks.lock(stack)
+	values, err := stack.RemoveGroup(mux.Vars(r)["group"])
+	if err != nil {
+		unlock()
+		c.goneHandler(w, r, fmt.Sprintf("group %s is Gone", mux.Vars(r)["group"]))
+		return
+	}
+	c.pushBack(r.Context(), stack, values, requestDate(r))
+	unlock()
+
+	logResponse(r, http.StatusNoContent, "reason", "pending elements pushed back", "elements", len(values))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// popGroupStackHandler pops the element on top of the Stack for the
+// consumer parameter of the group given in the URL, and returns 200
+// and the pending element, which must be acknowledged before its
+// deadline. Returns 204 if the Stack is empty, and 410 if the Stack
+// has no such group.
+func (c *Conn) popGroupStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	now := requestDate(r)
+	c.redeliver(r.Context(), stack, now)
+
+	name := mux.Vars(r)["group"]
+	defer c.stackLocks.lock(stack)()
+	pending, ok, err := stack.PopGroup(name, r.FormValue("consumer"), now)
+	if err != nil {
+		c.goneHandler(w, r, fmt.Sprintf("group %s is Gone", name))
+		return
+	}
+	if !ok {
+		logResponse(r, http.StatusNoContent)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	stack.Update(now)
+	c.persistStack(r.Context(), stack, persist.Record{Op: persist.OpPop, Time: now})
+
+	// Do not check error as we consider our element
+	// suitable for a JSON encoding.
+	b, _ := json.Marshal(pending)
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK, "pending", pending.ID)
+	w.Write(b)
+}
+
+// ackGroupStackHandler acknowledges the element given by the id
+// parameter pending in the group given in the URL, and returns 204.
+// Returns 410 if the Stack has no such group, or the element is
+// not pending, e.g. because it was redelivered.
+func (c *Conn) ackGroupStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	c.redeliver(r.Context(), stack, requestDate(r))
+
+	name, id := mux.Vars(r)["group"], r.FormValue("id")
+	switch err := stack.Ack(name, id); err {
+	case pila.ErrGroupNotExist:
+		c.goneHandler(w, r, fmt.Sprintf("group %s is Gone", name))
+		return
+	case pila.ErrPendingNotExist:
+		c.goneHandler(w, r, fmt.Sprintf("pending element %s is Gone", id))
+		return
+	}
+
+	logResponse(r, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pendingGroupStackHandler returns 200 and the elements pending
+// in the group given in the URL, the first delivered first.
+// Returns 410 if the Stack has no such group.
+func (c *Conn) pendingGroupStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	c.redeliver(r.Context(), stack, requestDate(r))
+
+	name := mux.Vars(r)["group"]
+	pending, err := stack.Pending(name)
+	if err != nil {
+		c.goneHandler(w, r, fmt.Sprintf("group %s is Gone", name))
+		return
+	}
+
+	// Do not check error as we consider our elements
+	// suitable for a JSON encoding.
+	b, _ := json.Marshal(map[string][]pila.PendingElement{"pending": pending})
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK, "pending", len(pending))
+	w.Write(b)
+}
+
+// deadLetterStackHandler returns the dead-letter stack of the Stack,
+// and replaces it on PUT with the one given by the stack parameter,
+// which must exist in the Database, and the max_deliveries parameter,
+// removing it if no stack is given. Returns 400 if they are not valid.
+func (c *Conn) deadLetterStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	if r.Method == "PUT" {
+		deadLetter, err := deadLetterParams(r, stack)
+		if err != nil {
+			logResponse(r, http.StatusBadRequest, "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// Do not check error as the dead letter is already validated.
+		_ = stack.SetDeadLetter(deadLetter)
+	}
+
+	deadLetter, _ := stack.DeadLetter()
+	// Do not check error as a DeadLetter is
+	// always valid for a JSON encoding.
+	b, _ := json.Marshal(deadLetter)
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(b)
+}
+
+// deadLetterParams returns the DeadLetter of stack given by the stack
+// and max_deliveries parameters of a request, being defaultMaxDeliveries
+// the latter if not present.
+func deadLetterParams(r *http.Request, stack *pila.Stack) (pila.DeadLetter, error) {
+	name := r.FormValue("stack")
+	if name == "" {
+		return pila.DeadLetter{}, nil
+	}
+	if name == stack.Name {
+		return pila.DeadLetter{}, fmt.Errorf("stack %s can not be its own dead-letter stack", name)
+	}
+	if _, ok := stack.Database.StackByName(name); !ok {
+		return pila.DeadLetter{}, fmt.Errorf("dead-letter stack %s does not exist", name)
+	}
+
+	deadLetter := pila.DeadLetter{Stack: name, MaxDeliveries: defaultMaxDeliveries}
+	if value := r.FormValue("max_deliveries"); value != "" {
+		max, err := strconv.Atoi(value)
+		if err != nil || max < 1 {
+			return deadLetter, fmt.Errorf("max_deliveries must be a positive integer, got %s", value)
+		}
+		deadLetter.MaxDeliveries = max
+	}
+	return deadLetter, nil
+}
+
+// redeliver pushes back into stack the elements of its groups whose
+// acknowledgement timed out at date t, and returns how many. The ones
+// delivered too many times are pushed into its dead-letter stack.
+func (c *Conn) redeliver(ctx context.Context, stack *pila.Stack, t time.Time) int {
+	deadLetter, _ := stack.DeadLetterStack()
+	defer c.stackLocks.lock(stack, deadLetter)()
+
+	values, dead := stack.Redeliver(t)
+	c.pushBack(ctx, stack, values, t)
+	if len(dead.Values) > 0 {
+		c.pushBack(ctx, dead.Stack, dead.Values, t)
+		logger.Warn("dead-lettered unacknowledged elements", "database", dead.Stack.Database.Name, "stack", stack.Name, "dead_letter", dead.Stack.Name, "count", len(dead.Values))
+	}
+	return len(values)
+}
+
+// pushBack persists the values pushed back into stack at date t.
+func (c *Conn) pushBack(ctx context.Context, stack *pila.Stack, values []interface{}, t time.Time) {
+	if len(values) == 0 {
+		return
+	}
+	stack.Update(t)
+	for _, value := range values {
+		element := pila.NewElement(value)
+		c.persistStack(ctx, stack, persist.Record{Op: persist.OpPush, Time: t, Element: element.Value, ContentType: element.ContentType})
+	}
+}
+
+// Redeliver pushes back into every Stack the elements of its groups
+// whose acknowledgement timed out at date t, and returns how many.
+func (c *Conn) Redeliver(t time.Time) int {
+	redelivered := 0
+	for _, s := range c.stacks() {
+		redelivered += c.redeliver(context.Background(), s, t)
+	}
+	return redelivered
+}
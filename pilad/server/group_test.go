@@ -0,0 +1,184 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestGroupStackHandlers(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = stack.PushN([]interface{}{"foo", "bar"})
+	_ = db.AddStack(stack)
+	handler := Router(conn)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	inputOutput := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"PUT", "/databases/db/stacks/stack/_groups", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks/stack/_groups?name=workers&timeout=-1s", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks/stack/_groups?name=workers&timeout=1m", http.StatusCreated,
+			`{"name":"workers","ack_timeout":"1m0s","pending":0,"delivered":0,"acked":0,"redelivered":0,"dead_lettered":0}`},
+		{"PUT", "/databases/db/stacks/stack/_groups?name=workers", http.StatusConflict, ""},
+		{"PUT", "/databases/db/stacks/stack/_groups?name=auditors", http.StatusCreated,
+			`{"name":"auditors","ack_timeout":"30s","pending":0,"delivered":0,"acked":0,"redelivered":0,"dead_lettered":0}`},
+		{"GET", "/databases/db/stacks/stack/_groups", http.StatusOK,
+			`{"groups":[{"name":"auditors","ack_timeout":"30s","pending":0,"delivered":0,"acked":0,"redelivered":0,"dead_lettered":0},` +
+				`{"name":"workers","ack_timeout":"1m0s","pending":0,"delivered":0,"acked":0,"redelivered":0,"dead_lettered":0}]}`},
+		{"DELETE", "/databases/db/stacks/stack/_groups/auditors", http.StatusNoContent, ""},
+		{"DELETE", "/databases/db/stacks/stack/_groups/auditors", http.StatusGone, ""},
+		{"DELETE", "/databases/db/stacks/stack/_groups/auditors/pop", http.StatusGone, ""},
+		{"GET", "/databases/db/stacks/stack/_groups/auditors/pending", http.StatusGone, ""},
+		{"POST", "/databases/db/stacks/stack/_groups/auditors/_ack?id=foo", http.StatusGone, ""},
+		{"POST", "/databases/db/stacks/stack/_groups/workers/_ack?id=foo", http.StatusGone, ""},
+		{"GET", "/databases/db/stacks/stack/_groups/workers/pending", http.StatusOK, `{"pending":[]}`},
+	}
+
+	for _, io := range inputOutput {
+		response := serve(io.method, io.path)
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if io.body != "" && response.Body.String() != io.body {
+			t.Errorf("body is %s, expected %s", response.Body.String(), io.body)
+		}
+	}
+
+	response := serve("DELETE", "/databases/db/stacks/stack/_groups/workers/pop?consumer=alice")
+	if response.Code != http.StatusOK {
+		t.Fatalf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+	var pending pila.PendingElement
+	if err := json.Unmarshal(response.Body.Bytes(), &pending); err != nil {
+		t.Fatal(err)
+	}
+	if pending.Value != "bar" || pending.Consumer != "alice" || pending.ID == "" {
+		t.Errorf("pending element is %v, expected bar of alice", pending)
+	}
+
+	response = serve("GET", "/databases/db/stacks/stack/_groups/workers/pending")
+	var list map[string][]pila.PendingElement
+	if err := json.Unmarshal(response.Body.Bytes(), &list); err != nil || len(list["pending"]) != 1 || list["pending"][0].ID != pending.ID {
+		t.Errorf("pending elements are %s, expected %s", response.Body.String(), pending.ID)
+	}
+
+	if response := serve("POST", "/databases/db/stacks/stack/_groups/workers/_ack?id="+pending.ID); response.Code != http.StatusNoContent {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusNoContent)
+	}
+	if response := serve("POST", "/databases/db/stacks/stack/_groups/workers/_ack?id="+pending.ID); response.Code != http.StatusGone {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusGone)
+	}
+
+	serve("DELETE", "/databases/db/stacks/stack/_groups/workers/pop?consumer=alice")
+	if response := serve("DELETE", "/databases/db/stacks/stack/_groups/workers/pop?consumer=alice"); response.Code != http.StatusNoContent {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusNoContent)
+	}
+	if stack.Size() != 0 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 0)
+	}
+}
+
+func TestConnRedeliver(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = stack.Push("foo")
+	_ = db.AddStack(stack)
+	_ = stack.AddGroup("workers", time.Minute)
+
+	now := time.Now()
+	if _, ok, _ := stack.PopGroup("workers", "alice", now); !ok {
+		t.Fatal("pop is false, expected true")
+	}
+
+	if n := conn.Redeliver(now); n != 0 {
+		t.Errorf("redelivered %d elements, expected %d", n, 0)
+	}
+	if n := conn.Redeliver(now.Add(time.Minute)); n != 1 {
+		t.Errorf("redelivered %d elements, expected %d", n, 1)
+	}
+	if stack.Peek() != "foo" {
+		t.Errorf("peek is %v, expected %v", stack.Peek(), "foo")
+	}
+}
+
+func TestDeadLetterStackHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("jobs", time.Now().UTC())
+	_ = db.AddStack(stack)
+	_ = db.AddStack(pila.NewStack("dead", time.Now().UTC()))
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"GET", "/databases/db/stacks/jobs/_dead_letter", http.StatusOK, `{"stack":"","max_deliveries":0}`},
+		{"PUT", "/databases/db/stacks/jobs/_dead_letter?stack=foo", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks/jobs/_dead_letter?stack=jobs", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks/jobs/_dead_letter?stack=dead&max_deliveries=0", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks/jobs/_dead_letter?stack=dead&max_deliveries=x", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks/jobs/_dead_letter?stack=dead", http.StatusOK, `{"stack":"dead","max_deliveries":5}`},
+		{"PUT", "/databases/db/stacks/jobs/_dead_letter?stack=dead&max_deliveries=3", http.StatusOK, `{"stack":"dead","max_deliveries":3}`},
+		{"GET", "/databases/db/stacks/jobs/_dead_letter", http.StatusOK, `{"stack":"dead","max_deliveries":3}`},
+		{"PUT", "/databases/db/stacks/jobs/_dead_letter", http.StatusOK, `{"stack":"","max_deliveries":0}`},
+		{"GET", "/databases/db/stacks/foo/_dead_letter", http.StatusGone, ""},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if io.body != "" && response.Body.String() != io.body {
+			t.Errorf("body is %s, expected %s for %s %s", response.Body.String(), io.body, io.method, io.path)
+		}
+	}
+}
+
+func TestConnRedeliver_DeadLetter(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("jobs", time.Now().UTC())
+	dead := pila.NewStack("dead", time.Now().UTC())
+	_ = db.AddStack(stack)
+	_ = db.AddStack(dead)
+	_ = stack.Push("foo")
+	_ = stack.AddGroup("workers", time.Minute)
+	_ = stack.SetDeadLetter(pila.DeadLetter{Stack: "dead", MaxDeliveries: 1})
+
+	now := time.Now()
+	if _, ok, _ := stack.PopGroup("workers", "alice", now); !ok {
+		t.Fatal("pop is false, expected true")
+	}
+	if n := conn.Redeliver(now.Add(time.Minute)); n != 0 {
+		t.Errorf("redelivered %d elements, expected %d", n, 0)
+	}
+	if stack.Size() != 0 || dead.Peek() != "foo" {
+		t.Errorf("stack size is %d and dead-letter peek %v, expected %d and %v", stack.Size(), dead.Peek(), 0, "foo")
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// gzipWriters reuses the writers compressing the
+// responses, which are expensive to allocate.
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(ioutil.Discard)
+	},
+}
+
+// GzipMiddleware returns a middleware that decompresses the body of
+// the requests with the gzip Content-Encoding, and compresses with
+// gzip the body of the responses to requests accepting it in their
+// Accept-Encoding header. Requests with any other Content-Encoding
+// are answered with 415 Unsupported Media Type.
+func GzipMiddleware() MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+			case "", "identity":
+			case "gzip":
+				zr, err := gzip.NewReader(r.Body)
+				if err != nil {
+					logResponse(r, http.StatusBadRequest, "reason", "error on decompressing body", "error", err)
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				r.Body = gzipBody{Reader: zr, body: r.Body}
+				r.Header.Del("Content-Encoding")
+				r.Header.Del("Content-Length")
+				r.ContentLength = -1
+			default:
+				logResponse(r, http.StatusUnsupportedMediaType, "reason", "unsupported Content-Encoding", "encoding", encoding)
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			gw := &gzipResponseWriter{ResponseWriter: w}
+			defer gw.close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// acceptsGzip determines whether the Accept-Encoding
+// header of a request accepts the gzip encoding.
+func acceptsGzip(r *http.Request) bool {
+	for _, field := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(field, ";")
+		if coding := strings.ToLower(strings.TrimSpace(params[0])); coding != "gzip" && coding != "*" {
+			continue
+		}
+		accepted := true
+		for _, param := range params[1:] {
+			if q := strings.Replace(param, " ", "", -1); strings.HasPrefix(q, "q=0") && strings.Trim(q[3:], ".0") == "" {
+				accepted = false
+			}
+		}
+		return accepted
+	}
+	return false
+}
+
+// gzipBody is the body of a request decompressed with gzip.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+// Close closes the gzip reader and the original body.
+func (b gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// gzipResponseWriter wraps an http.ResponseWriter compressing the body
+// of the response with gzip. Compression starts on the first write,
+// so responses without body, or already encoded, are not compressed.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	code int
+	zw   *gzip.Writer
+
+	// started is set once the header is written
+	started bool
+}
+
+// WriteHeader records the status code, which
+// is written along with the first bytes.
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.started || w.code != 0 {
+		return
+	}
+	w.code = code
+}
+
+// Write compresses b and writes it.
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.start(b)
+	}
+	if w.zw == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.zw.Write(b)
+}
+
+// start writes the header, which sets gzip as the Content-Encoding,
+// unless the response is already encoded. The Content-Type is
+// detected from b if it is not set, as it can not be detected from
+// the compressed bytes.
+func (w *gzipResponseWriter) start(b []byte) {
+	w.started = true
+	header := w.Header()
+	if header.Get("Content-Encoding") == "" {
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", http.DetectContentType(b))
+		}
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.zw = gzipWriters.Get().(*gzip.Writer)
+		w.zw.Reset(w.ResponseWriter)
+	}
+	if w.code != 0 {
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+}
+
+// close flushes the compressed body, or writes
+// the header if nothing was written.
+func (w *gzipResponseWriter) close() {
+	if !w.started {
+		w.started = true
+		if w.code != 0 {
+			w.ResponseWriter.WriteHeader(w.code)
+		}
+		return
+	}
+	if w.zw != nil {
+		w.zw.Close()
+		gzipWriters.Put(w.zw)
+		w.zw = nil
+	}
+}
+
+// Hijack lets the handler take over the connection, e.g. to
+// upgrade it to a WebSocket connection, which is not compressed.
+func (w *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	w.started = true
+	return hj.Hijack()
+}
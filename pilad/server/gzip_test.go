@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func gzipped(s string) *bytes.Buffer {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(s))
+	zw.Close()
+	return &buf
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	db.CreateStack("stack", time.Now().UTC())
+	handler := GzipMiddleware()(Router(conn))
+
+	request, _ := http.NewRequest("POST", "/databases/db/stacks/stack", gzipped(`{"element":"foo"}`))
+	request.Header.Set("Content-Encoding", "gzip")
+	request.Header.Set("Accept-Encoding", "deflate, gzip;q=0.5")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+	expectedHeaders := map[string]string{
+		"Content-Encoding": "gzip",
+		"Content-Type":     "application/json",
+		"Vary":             "Accept-Encoding",
+	}
+	for header, expected := range expectedHeaders {
+		if value := response.Header().Get(header); value != expected {
+			t.Errorf("%s is %q, expected %q", header, value, expected)
+		}
+	}
+	zr, err := gzip.NewReader(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(zr)
+	if string(body) != `{"element":"foo"}` {
+		t.Errorf("body is %s, expected %s", body, `{"element":"foo"}`)
+	}
+}
+
+func TestGzipMiddleware_Identity(t *testing.T) {
+	handler := GzipMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write(b)
+	}))
+
+	inputOutput := []struct {
+		contentEncoding, acceptEncoding string
+		code                            int
+		contentEncodingOutput           string
+	}{
+		{"", "", http.StatusOK, ""},
+		{"identity", "gzip;q=0", http.StatusOK, ""},
+		{"", "br, *", http.StatusOK, "gzip"},
+		{"", "GZIP; q=0.001", http.StatusOK, "gzip"},
+		{"gzip", "", http.StatusOK, ""},
+		{"br", "gzip", http.StatusUnsupportedMediaType, ""},
+	}
+	for _, io := range inputOutput {
+		body := bytes.NewBufferString("foo")
+		if io.contentEncoding == "gzip" {
+			body = gzipped("foo")
+		}
+		request, _ := http.NewRequest("POST", "/", body)
+		request.Header.Set("Content-Encoding", io.contentEncoding)
+		request.Header.Set("Accept-Encoding", io.acceptEncoding)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %+v", response.Code, io.code, io)
+		}
+		if encoding := response.Header().Get("Content-Encoding"); encoding != io.contentEncodingOutput {
+			t.Errorf("Content-Encoding is %q, expected %q for %+v", encoding, io.contentEncodingOutput, io)
+		}
+		if io.code == http.StatusOK && io.contentEncodingOutput == "" && response.Body.String() != "foo" {
+			t.Errorf("body is %q, expected %q for %+v", response.Body.String(), "foo", io)
+		}
+	}
+}
+
+func TestGzipMiddleware_NoBody(t *testing.T) {
+	handler := GzipMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	request, _ := http.NewRequest("DELETE", "/", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusNoContent || response.Body.Len() != 0 {
+		t.Errorf("response is %v %q, expected %v without body", response.Code, response.Body.String(), http.StatusNoContent)
+	}
+	if encoding := response.Header().Get("Content-Encoding"); encoding != "" {
+		t.Errorf("Content-Encoding is %q, expected none", encoding)
+	}
+}
+
+func TestGzipMiddleware_InvalidBody(t *testing.T) {
+	handler := GzipMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request with an invalid body reached the next handler")
+	}))
+
+	request, _ := http.NewRequest("POST", "/", strings.NewReader("foo"))
+	request.Header.Set("Content-Encoding", "gzip")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// Started returns true once pilad finished starting up, i.e. the
+// persisted operations and snapshots were loaded.
+func (c *Conn) Started() bool {
+	return atomic.LoadInt32(&c.started) == 1
+}
+
+// SetStarted marks pilad as started, so it is ready
+// to serve requests as soon as it joins its Cluster.
+func (c *Conn) SetStarted() {
+	atomic.StoreInt32(&c.started, 1)
+}
+
+// Readiness represents whether pilad is ready to serve requests,
+// along with the result of each one of its checks.
+type Readiness struct {
+	Ready  bool            `json:"ready"`
+	Checks map[string]bool `json:"checks"`
+}
+
+// ToJSON converts the Readiness into JSON.
+func (rd Readiness) ToJSON() ([]byte, error) {
+	return json.Marshal(rd)
+}
+
+// Readiness returns whether pilad is ready to serve requests: it
+// started up, it is not joining a Cluster and it is not shutting down.
+func (c *Conn) Readiness() Readiness {
+	checks := map[string]bool{
+		"started": c.Started(),
+		"cluster": !c.Cluster.Joining(),
+		"running": !c.Shutdown.IsRequested(),
+	}
+
+	ready := true
+	for _, ok := range checks {
+		ready = ready && ok
+	}
+	return Readiness{Ready: ready, Checks: checks}
+}
+
+// healthHandler returns 200 as long as pilad is up, to be used
+// as a liveness probe.
+func (c *Conn) healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// readyHandler returns 200 and the Readiness of pilad if it is
+// ready to serve requests, and 503 otherwise, to be used as a
+// readiness probe.
+func (c *Conn) readyHandler(w http.ResponseWriter, r *http.Request) {
+	readiness := c.Readiness()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if !readiness.Ready {
+		logResponse(r, http.StatusServiceUnavailable, "reason", "not ready")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	// Do not check error as the Readiness
+	// is always valid for a JSON encoding.
+	b, _ := readiness.ToJSON()
+	w.Write(b)
+}
+
+// isProbe determines whether r is a liveness or readiness probe,
+// which are served regardless of authentication and draining.
+func isProbe(r *http.Request) bool {
+	return (r.Method == "GET" || r.Method == "HEAD") &&
+		(r.URL.Path == "/_health" || r.URL.Path == "/_ready")
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConnStarted(t *testing.T) {
+	conn := NewConn()
+	if conn.Started() {
+		t.Error("conn.Started() is true, expected false")
+	}
+
+	conn.SetStarted()
+	if !conn.Started() {
+		t.Error("conn.Started() is false, expected true")
+	}
+}
+
+func TestConnReadiness(t *testing.T) {
+	conn := NewConn()
+	if r := conn.Readiness(); r.Ready || r.Checks["started"] || !r.Checks["cluster"] || !r.Checks["running"] {
+		t.Errorf("readiness is %v, expected only started to fail", r)
+	}
+
+	conn.SetStarted()
+	if r := conn.Readiness(); !r.Ready {
+		t.Errorf("readiness is %v, expected ready", r)
+	}
+
+	conn.Cluster.setJoining(true)
+	if r := conn.Readiness(); r.Ready || r.Checks["cluster"] {
+		t.Errorf("readiness is %v, expected cluster to fail", r)
+	}
+	conn.Cluster.setJoining(false)
+
+	conn.Shutdown.Request()
+	if r := conn.Readiness(); r.Ready || r.Checks["running"] {
+		t.Errorf("readiness is %v, expected running to fail", r)
+	}
+}
+
+func TestReadinessToJSON(t *testing.T) {
+	r := Readiness{Ready: true, Checks: map[string]bool{"started": true}}
+	expected := `{"ready":true,"checks":{"started":true}}`
+
+	if b, err := r.ToJSON(); err != nil || string(b) != expected {
+		t.Errorf("json is %s, %v, expected %s, nil", b, err, expected)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	conn := NewConn()
+	conn.Shutdown.Request()
+
+	request, _ := http.NewRequest("GET", "/_health", nil)
+	response := httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+	if body := response.Body.String(); body != `{"status":"ok"}` {
+		t.Errorf("body is %s, expected %s", body, `{"status":"ok"}`)
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	conn := NewConn()
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		setup func()
+		code  int
+		body  string
+	}{
+		{func() {}, http.StatusServiceUnavailable, `{"ready":false,"checks":{"cluster":true,"running":true,"started":false}}`},
+		{conn.SetStarted, http.StatusOK, `{"ready":true,"checks":{"cluster":true,"running":true,"started":true}}`},
+		{conn.Shutdown.Request, http.StatusServiceUnavailable, `{"ready":false,"checks":{"cluster":true,"running":false,"started":true}}`},
+	}
+
+	for _, io := range inputOutput {
+		io.setup()
+		request, _ := http.NewRequest("GET", "/_ready", nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v", response.Code, io.code)
+		}
+		if body := response.Body.String(); body != io.body {
+			t.Errorf("body is %s, expected %s", body, io.body)
+		}
+	}
+}
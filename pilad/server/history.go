@@ -0,0 +1,53 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+)
+
+// undoStackHandler puts back on top of the Stack the last element
+// popped from it, returns 200 and the element. Returns 409 if the
+// Stack keeps no popped element, or can not take it back.
+func (c *Conn) undoStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	now := requestDate(r)
+	defer c.stackLocks.lock(stack)()
+	value, err := stack.Undo()
+	if err == pila.ErrMemoryLimit {
+		c.memoryLimitHandler(w, r, err)
+		return
+	}
+	if err != nil {
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	stack.Update(now)
+	c.persistStack(r.Context(), stack, persist.Record{Op: persist.OpUndo, Time: now})
+
+	c.writeElement(w, r, value)
+}
+
+// historyStackHandler returns 200 and up to limit of the elements
+// popped from the Stack that it keeps, the last popped first.
+func (c *Conn) historyStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	limit, err := intParam(r, "limit", elementsLimitDefault, elementsLimitMax)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	history := Elements{Values: stack.History(limit)}
+	stack.Read(requestDate(r))
+
+	logResponse(r, http.StatusOK, "elements", len(history.Values))
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as we consider our elements
+	// suitable for a JSON encoding.
+	b, _ := json.Marshal(history)
+	w.Write(b)
+}
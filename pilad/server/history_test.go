@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestHistoryStackHandlers(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path string
+		input        string
+		code         int
+		body         string
+	}{
+		{"PUT", "/databases/db/stacks?name=stack&history=0", "", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks?name=stack&history=2", "", http.StatusCreated, ""},
+		{"POST", "/databases/db/stacks/stack/_undo", "", http.StatusConflict, ""},
+		{"GET", "/databases/db/stacks/stack/_history", "", http.StatusOK, `{"elements":[]}`},
+		{"POST", "/databases/db/stacks/stack/_bulk", `["foo","bar","baz"]`, http.StatusOK, ""},
+		{"DELETE", "/databases/db/stacks/stack/_bulk?count=3", "", http.StatusOK, ""},
+		{"GET", "/databases/db/stacks/stack/_history", "", http.StatusOK, `{"elements":["foo","bar"]}`},
+		{"GET", "/databases/db/stacks/stack/_history?limit=1", "", http.StatusOK, `{"elements":["foo"]}`},
+		{"GET", "/databases/db/stacks/stack/_history?limit=0", "", http.StatusBadRequest, ""},
+		{"POST", "/databases/db/stacks/stack/_undo", "", http.StatusOK, `{"element":"foo"}`},
+		{"POST", "/databases/db/stacks/stack/_undo", "", http.StatusOK, `{"element":"bar"}`},
+		{"POST", "/databases/db/stacks/stack/_undo", "", http.StatusConflict, ""},
+		{"GET", "/databases/db/stacks/stack/peek", "", http.StatusOK, `{"element":"bar"}`},
+		{"POST", "/databases/db/stacks/foo/_undo", "", http.StatusGone, ""},
+		{"GET", "/databases/db/stacks/foo/_history", "", http.StatusGone, ""},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, strings.NewReader(io.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if body := response.Body.String(); io.body != "" && body != io.body {
+			t.Errorf("body is %s, expected %s for %s %s", body, io.body, io.method, io.path)
+		}
+	}
+
+	stack, _ := db.StackByName("stack")
+	if stack.Status().History != 2 {
+		t.Errorf("stack history is %d, expected %d", stack.Status().History, 2)
+	}
+}
+
+func TestUndoStackHandler_MemoryLimit(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	stack.SetHistoryDepth(1)
+	_ = db.AddStack(stack)
+	stack.Push("foo")
+	stack.Pop()
+	db.SetMaxMemory(1)
+
+	request, _ := http.NewRequest("POST", "/databases/db/stacks/stack/_undo", nil)
+	response := httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+
+	if response.Code != http.StatusInsufficientStorage {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusInsufficientStorage)
+	}
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+const (
+	// idempotencyCapacity is the maximum number of
+	// Idempotency-Key headers remembered.
+	idempotencyCapacity = 10000
+	// idempotencyTTL is the duration an
+	// Idempotency-Key header is remembered.
+	idempotencyTTL = 24 * time.Hour
+	// idempotencyKeyMaxLength is the maximum length
+	// of an Idempotency-Key header.
+	idempotencyKeyMaxLength = 255
+)
+
+// IdempotencyKeys remembers the responses to the PUSH operations given
+// an Idempotency-Key header, so retried requests get the original
+// response instead of pushing twice. Keys are scoped to their Stack,
+// and the least recently used ones are forgotten once it is full, as
+// well as the ones remembered for longer than their TTL.
+type IdempotencyKeys struct {
+	capacity int
+	ttl      time.Duration
+
+	// entries are the elements of lru, by Stack ID and key,
+	// and lru keeps the idempotentResponses, the least
+	// recently used at the back
+	entries map[string]*list.Element
+	lru     *list.List
+	mu      sync.Mutex
+}
+
+// idempotentResponse represents the response to a request given an
+// Idempotency-Key header. It is pending until the request is served.
+type idempotentResponse struct {
+	key      string
+	pending  bool
+	storedAt time.Time
+
+	header http.Header
+	code   int
+	body   []byte
+}
+
+// NewIdempotencyKeys returns empty IdempotencyKeys remembering up to
+// capacity keys, for up to ttl.
+func NewIdempotencyKeys(capacity int, ttl time.Duration) *IdempotencyKeys {
+	return &IdempotencyKeys{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Len returns the number of keys remembered, including the pending ones.
+func (ik *IdempotencyKeys) Len() int {
+	ik.mu.Lock()
+	defer ik.mu.Unlock()
+	return ik.lru.Len()
+}
+
+// begin returns the response remembered for key at date now, if any,
+// and whether it is pending. Otherwise, it remembers key as pending,
+// forgetting the least recently used keys if full.
+func (ik *IdempotencyKeys) begin(key string, now time.Time) (*idempotentResponse, bool) {
+	ik.mu.Lock()
+	defer ik.mu.Unlock()
+
+	if e, ok := ik.entries[key]; ok {
+		response := e.Value.(*idempotentResponse)
+		if response.pending || now.Sub(response.storedAt) < ik.ttl {
+			ik.lru.MoveToFront(e)
+			return response, true
+		}
+		ik.remove(e)
+	}
+
+	for ik.lru.Len() >= ik.capacity {
+		ik.remove(ik.lru.Back())
+	}
+	ik.entries[key] = ik.lru.PushFront(&idempotentResponse{key: key, pending: true})
+	return nil, false
+}
+
+// end remembers the response to the pending key at date now,
+// or forgets key if response is nil.
+func (ik *IdempotencyKeys) end(key string, response *idempotentResponse, now time.Time) {
+	ik.mu.Lock()
+	defer ik.mu.Unlock()
+
+	e, ok := ik.entries[key]
+	if !ok {
+		return
+	}
+	if response == nil {
+		ik.remove(e)
+		return
+	}
+	response.key, response.storedAt = key, now
+	e.Value = response
+}
+
+// remove forgets the key of an element of the lru.
+func (ik *IdempotencyKeys) remove(e *list.Element) {
+	ik.lru.Remove(e)
+	delete(ik.entries, e.Value.(*idempotentResponse).key)
+}
+
+// idempotencyResponseWriter is an http.ResponseWriter
+// keeping a copy of the response it writes.
+type idempotencyResponseWriter struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (rw *idempotencyResponseWriter) WriteHeader(code int) {
+	rw.code = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *idempotencyResponseWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// idempotent makes a PUSH handler remember its successful responses
+// to requests with an Idempotency-Key header, and answer the requests
+// retried with the same key with the original response and the
+// Idempotent-Replayed header, without pushing again. It returns 409 if
+// a request with the same key is in flight, and 400 if the key is
+// longer than 255 characters. Failed requests can be retried.
+func (c *Conn) idempotent(handler stackHandlerFunc) stackHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			handler(w, r, stack)
+			return
+		}
+		if len(key) > idempotencyKeyMaxLength {
+			logResponse(r, http.StatusBadRequest, "reason", "Idempotency-Key is too long")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		key = stack.ID.String() + "/" + key
+		response, ok := c.IdempotencyKeys.begin(key, time.Now())
+		if ok && response.pending {
+			logResponse(r, http.StatusConflict, "reason", "request with the same Idempotency-Key in flight")
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if ok {
+			for k, values := range response.header {
+				w.Header()[k] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			logResponse(r, response.code, "reason", "replayed")
+			w.WriteHeader(response.code)
+			w.Write(response.body)
+			return
+		}
+
+		// the key is forgotten unless the request succeeds
+		var stored *idempotentResponse
+		defer func() { c.IdempotencyKeys.end(key, stored, time.Now()) }()
+
+		rw := &idempotencyResponseWriter{ResponseWriter: w, code: http.StatusOK}
+		handler(rw, r, stack)
+		if rw.code < 200 || rw.code > 299 {
+			return
+		}
+		stored = &idempotentResponse{
+			header: make(http.Header),
+			code:   rw.code,
+			body:   rw.body.Bytes(),
+		}
+		for k, values := range w.Header() {
+			stored.header[k] = values
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	ik := NewIdempotencyKeys(2, time.Hour)
+	now := time.Now()
+
+	if _, ok := ik.begin("a", now); ok {
+		t.Error("key a is remembered, expected not")
+	}
+	if response, ok := ik.begin("a", now); !ok || !response.pending {
+		t.Errorf("key a is %v, %v, expected pending", response, ok)
+	}
+	ik.end("a", &idempotentResponse{code: http.StatusOK}, now)
+	if response, ok := ik.begin("a", now); !ok || response.pending || response.code != http.StatusOK {
+		t.Errorf("key a is %v, %v, expected stored", response, ok)
+	}
+
+	// b is forgotten on failure
+	ik.begin("b", now)
+	ik.end("b", nil, now)
+	if ik.Len() != 1 {
+		t.Errorf("keys are %d, expected %d", ik.Len(), 1)
+	}
+
+	// a is the least recently used once c and d are remembered
+	ik.begin("c", now)
+	ik.end("c", &idempotentResponse{code: http.StatusOK}, now)
+	ik.begin("d", now)
+	if ik.Len() != 2 {
+		t.Errorf("keys are %d, expected %d", ik.Len(), 2)
+	}
+	if _, ok := ik.begin("a", now); ok {
+		t.Error("key a is remembered, expected evicted")
+	}
+
+	// c expires
+	if _, ok := ik.begin("c", now.Add(time.Hour)); ok {
+		t.Error("key c is remembered, expected expired")
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	other := pila.NewStack("other", time.Now().UTC())
+	_ = db.AddStack(other)
+	handler := Router(conn)
+
+	// a request with key "pending" is in flight
+	conn.IdempotencyKeys.begin(stack.ID.String()+"/pending", time.Now())
+
+	inputOutput := []struct {
+		path, key, input string
+		code             int
+		replayed         string
+		size             int
+	}{
+		{"/databases/db/stacks/stack", "", `{"element":"foo"}`, http.StatusOK, "", 1},
+		{"/databases/db/stacks/stack", "", `{"element":"foo"}`, http.StatusOK, "", 2},
+		{"/databases/db/stacks/stack", "k1", `{"element":"bar"}`, http.StatusOK, "", 3},
+		{"/databases/db/stacks/stack", "k1", `{"element":"bar"}`, http.StatusOK, "true", 3},
+		{"/databases/db/stacks/stack/_bulk", "k1", `["baz"]`, http.StatusOK, "true", 3},
+		{"/databases/db/stacks/stack", "k2", `{"element":`, http.StatusBadRequest, "", 3},
+		{"/databases/db/stacks/stack", "k2", `{"element":"baz"}`, http.StatusOK, "", 4},
+		{"/databases/db/stacks/stack/_bulk", "k3", `["a","b"]`, http.StatusOK, "", 6},
+		{"/databases/db/stacks/stack/_bulk", "k3", `["a","b"]`, http.StatusOK, "true", 6},
+		{"/databases/db/stacks/stack", "pending", `{"element":"foo"}`, http.StatusConflict, "", 6},
+		{"/databases/db/stacks/stack", strings.Repeat("k", 256), `{"element":"foo"}`, http.StatusBadRequest, "", 6},
+		{"/databases/db/stacks/other", "k1", `{"element":"bar"}`, http.StatusOK, "", 6},
+	}
+
+	var first string
+	for i, io := range inputOutput {
+		request, err := http.NewRequest("POST", io.path, strings.NewReader(io.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if io.key != "" {
+			request.Header.Set("Idempotency-Key", io.key)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("%d: response code is %v, expected %v", i, response.Code, io.code)
+		}
+		if replayed := response.Header().Get("Idempotent-Replayed"); replayed != io.replayed {
+			t.Errorf("%d: Idempotent-Replayed is %q, expected %q", i, replayed, io.replayed)
+		}
+		if stack.Size() != io.size {
+			t.Errorf("%d: stack size is %d, expected %d", i, stack.Size(), io.size)
+		}
+		switch i {
+		case 2:
+			first = response.Body.String()
+		case 3, 4:
+			if body := response.Body.String(); body != first {
+				t.Errorf("%d: body is %s, expected %s", i, body, first)
+			}
+		}
+	}
+
+	if other.Size() != 1 {
+		t.Errorf("other stack size is %d, expected %d", other.Size(), 1)
+	}
+}
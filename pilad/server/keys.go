@@ -0,0 +1,211 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/uuid"
+	"github.com/gorilla/mux"
+)
+
+// keySize is the size in bytes of the random value of a database key.
+const keySize = 24
+
+// Scope represents the operations a DatabaseKey is allowed to
+// perform on its Database, being the Role of its Token.
+type Scope string
+
+const (
+	// ScopeRead allows reading the Database.
+	ScopeRead Scope = "read"
+	// ScopeWrite allows reading and modifying the Database.
+	ScopeWrite Scope = "write"
+	// ScopeAdmin allows, besides, administrating
+	// the keys of the Database.
+	ScopeAdmin Scope = "admin"
+)
+
+// scopeRoles are the Roles of the Tokens of every Scope.
+var scopeRoles = map[Scope]Role{
+	ScopeRead:  RoleRead,
+	ScopeWrite: RoleReadWrite,
+	ScopeAdmin: RoleAdmin,
+}
+
+// DatabaseKey represents an API key confined to a single Database,
+// so teams sharing pilad do not access each other's Databases. It is
+// kept by Auth as a Token whose KeyID is its ID. Its Key is only
+// returned once, when it is minted.
+type DatabaseKey struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key,omitempty"`
+	Scope     Scope     `json:"scope"`
+	Database  string    `json:"database"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// keyOf returns the DatabaseKey of a Token with a KeyID,
+// without its Key.
+func keyOf(t Token) DatabaseKey {
+	k := DatabaseKey{ID: t.KeyID, Database: t.Database}
+	for scope, role := range scopeRoles {
+		if role == t.Role {
+			k.Scope = scope
+		}
+	}
+	if t.CreatedAt != nil {
+		k.CreatedAt = *t.CreatedAt
+	}
+	return k
+}
+
+// canAccessKey determines whether the Token of a DatabaseKey has
+// access to the Database of p identified by databaseID, either its
+// ID or its name, within its tenant if it has any.
+func (t Token) canAccessKey(p *pila.Pila, databaseID string) bool {
+	db, ok := p.Database(uuid.UUID(databaseID))
+	if !ok && t.Tenant != "" {
+		databaseID = namespace(t.Tenant, databaseID)
+	}
+	if !ok {
+		db, ok = p.DatabaseByName(databaseID)
+	}
+	return ok && db.ID.String() == t.Database
+}
+
+// accessesDatabase determines whether a request
+// accesses a single existing Database.
+func accessesDatabase(r *http.Request) bool {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	return segments[0] == "databases" && len(segments) > 1
+}
+
+// isKeysRequest determines whether a request administrates
+// the DatabaseKeys of a Database, which are kept by Auth
+// instead of the Pila.
+func isKeysRequest(r *http.Request) bool {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	return segments[0] == "databases" && len(segments) > 2 && segments[2] == "_keys"
+}
+
+// Keys returns the Tokens of the DatabaseKeys of
+// the Database with the given ID, sorted by value.
+func (a *Auth) Keys(database string) []Token {
+	var keys []Token
+	for _, t := range a.Tokens() {
+		if t.KeyID != "" && t.Database == database {
+			keys = append(keys, t)
+		}
+	}
+	return keys
+}
+
+// RemoveKey removes the Token of the DatabaseKey of the Database
+// with the given ID. It returns false if it did not exist.
+func (a *Auth) RemoveKey(database, id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for value, t := range a.tokens {
+		if t.KeyID == id && t.Database == database {
+			delete(a.tokens, value)
+			return true
+		}
+	}
+	return false
+}
+
+// newKey returns a new random value of a DatabaseKey.
+func newKey() string {
+	b := make([]byte, keySize)
+	// we ignore errors, since crypto/rand does
+	// not fail on the supported platforms
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// keysHandler writes the DatabaseKeys of the Database into the
+// response on GET, without their Keys, and mints a DatabaseKey of the
+// scope given by the scope parameter on POST, returning 201 and the
+// DatabaseKey with its Key. Keys of a tenant are confined to its
+// namespace too. Returns 400 if the scope is not valid, and 409 if
+// authentication is disabled, as keys would enable it.
+func (c *Conn) keysHandler(w http.ResponseWriter, r *http.Request) {
+	db := databaseFromContext(r)
+	if r.Method == "GET" {
+		keys := make([]DatabaseKey, 0)
+		for _, t := range c.Auth.Keys(db.ID.String()) {
+			keys = append(keys, keyOf(t))
+		}
+
+		// Do not check error as a list of DatabaseKeys
+		// is always valid for a JSON encoding.
+		b, _ := json.Marshal(map[string][]DatabaseKey{"keys": keys})
+
+		w.Header().Set("Content-Type", "application/json")
+		logResponse(r, http.StatusOK)
+		w.Write(b)
+		return
+	}
+
+	scope := Scope(r.FormValue("scope"))
+	role, ok := scopeRoles[scope]
+	if !ok {
+		logResponse(r, http.StatusBadRequest, "reason", fmt.Sprintf("invalid scope %q, must be %s, %s or %s", scope, ScopeRead, ScopeWrite, ScopeAdmin))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !c.Auth.Enabled() {
+		logResponse(r, http.StatusConflict, "reason", "authentication is disabled")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	// the key belongs to the tenant of the Token minting
+	// it, as the Database is named within the tenant
+	var tenant string
+	if t, ok := c.Auth.Token(requestToken(r)); ok {
+		tenant = t.Tenant
+	}
+	createdAt := time.Now()
+	t := Token{
+		Token:     newKey(),
+		Role:      role,
+		Tenant:    tenant,
+		KeyID:     uuid.NewRandom().String(),
+		Database:  db.ID.String(),
+		CreatedAt: &createdAt,
+	}
+	if err := c.Auth.Add(t); err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	k := keyOf(t)
+	k.Key = t.Token
+	b, _ := json.Marshal(k)
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusCreated, "key", k.ID)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(b)
+}
+
+// keyHandler revokes the DatabaseKey given in the URL. Returns
+// 410 if the Database has no such DatabaseKey.
+func (c *Conn) keyHandler(w http.ResponseWriter, r *http.Request) {
+	db := databaseFromContext(r)
+	if !c.Auth.RemoveKey(db.ID.String(), mux.Vars(r)["key_id"]) {
+		c.goneHandler(w, r, "key is Gone")
+		return
+	}
+
+	logResponse(r, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
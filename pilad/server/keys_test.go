@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// mintKey mints a key of scope for database with token,
+// failing the test unless it is minted.
+func mintKey(t *testing.T, handler http.Handler, database string, scope Scope, token string) DatabaseKey {
+	request, _ := http.NewRequest("POST", "/databases/"+database+"/_keys?scope="+string(scope), nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("response code is %v, expected %v", response.Code, http.StatusCreated)
+	}
+
+	var k DatabaseKey
+	if err := json.Unmarshal(response.Body.Bytes(), &k); err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestKeysHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	_ = conn.Pila.AddDatabase(pila.NewDatabase("other"))
+	_ = db.AddStack(pila.NewStack("stack", time.Now().UTC()))
+	handler := AuthMiddleware(conn)(Router(conn))
+
+	// keys would enable authentication
+	request, _ := http.NewRequest("POST", "/databases/db/_keys?scope=read", nil)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusConflict {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusConflict)
+	}
+
+	_ = conn.Auth.Add(Token{Token: "admin", Role: RoleAdmin})
+	admin := mintKey(t, handler, "db", ScopeAdmin, "admin")
+	if admin.Scope != ScopeAdmin || admin.Database != db.ID.String() || admin.Key == "" || admin.CreatedAt.IsZero() {
+		t.Errorf("key is %v, expected an admin key of database %s", admin, db.ID)
+	}
+	writer := mintKey(t, handler, db.ID.String(), ScopeWrite, admin.Key)
+	reader := mintKey(t, handler, "db", ScopeRead, "admin")
+
+	inputOutput := []struct {
+		method, path, token string
+		output              int
+	}{
+		{"POST", "/databases/db/_keys?scope=root", "admin", http.StatusBadRequest},
+		{"POST", "/databases/nodb/_keys?scope=read", "admin", http.StatusGone},
+		{"GET", "/databases/db/_keys", writer.Key, http.StatusForbidden},
+		{"POST", "/databases/db/_keys?scope=admin", writer.Key, http.StatusForbidden},
+		{"GET", "/databases/db/_keys", admin.Key, http.StatusOK},
+		{"GET", "/databases/other/_keys", admin.Key, http.StatusForbidden},
+		{"POST", "/databases/db/stacks/stack", writer.Key, http.StatusOK},
+		{"POST", "/databases/db/stacks/stack", reader.Key, http.StatusForbidden},
+		{"GET", "/databases/db/stacks/stack", reader.Key, http.StatusOK},
+		{"GET", "/databases/other/stacks", reader.Key, http.StatusForbidden},
+		{"POST", "/databases/db/stacks/stack/_copy?to=stack&to_database=other", writer.Key, http.StatusForbidden},
+		{"GET", "/databases", reader.Key, http.StatusForbidden},
+		{"PUT", "/databases?name=db2", admin.Key, http.StatusForbidden},
+		{"GET", "/_status", reader.Key, http.StatusForbidden},
+		{"GET", "/_tokens", admin.Key, http.StatusForbidden},
+		{"DELETE", "/databases/db/_keys/" + reader.ID, admin.Key, http.StatusNoContent},
+		{"DELETE", "/databases/db/_keys/" + reader.ID, admin.Key, http.StatusGone},
+		{"GET", "/databases/db/stacks/stack", reader.Key, http.StatusUnauthorized},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, strings.NewReader(`{"element":"foo"}`))
+		request.Header.Set("Authorization", "Bearer "+io.token)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.output {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.output, io.method, io.path)
+		}
+	}
+
+	// the keys are listed without their values
+	request, _ = http.NewRequest("GET", "/databases/db/_keys", nil)
+	request.Header.Set("Authorization", "Bearer admin")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	var listed map[string][]DatabaseKey
+	if err := json.Unmarshal(response.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed["keys"]) != 2 {
+		t.Fatalf("keys are %v, expected %d", listed["keys"], 2)
+	}
+	for _, k := range listed["keys"] {
+		if k.Key != "" || (k.ID != admin.ID && k.ID != writer.ID) {
+			t.Errorf("key is %v, expected %s or %s without value", k, admin.ID, writer.ID)
+		}
+	}
+}
+
+func TestKeysHandler_Rename(t *testing.T) {
+	conn := NewConn()
+	_ = conn.Pila.AddDatabase(pila.NewDatabase("db"))
+	_ = conn.Auth.Add(Token{Token: "admin", Role: RoleAdmin})
+	handler := AuthMiddleware(conn)(Router(conn))
+	k := mintKey(t, handler, "db", ScopeRead, "admin")
+
+	// keys follow their Database when it is renamed, and do
+	// not give access to a new Database with the same name
+	inputOutput := []struct {
+		method, path, body, token string
+		output                    int
+	}{
+		{"PATCH", "/databases/db", `{"name":"renamed"}`, "admin", http.StatusOK},
+		{"GET", "/databases/renamed", "", k.Key, http.StatusOK},
+		{"PUT", "/databases?name=db", "", "admin", http.StatusCreated},
+		{"GET", "/databases/db", "", k.Key, http.StatusForbidden},
+		{"DELETE", "/databases/renamed", "", "admin", http.StatusNoContent},
+		{"GET", "/databases/renamed", "", k.Key, http.StatusForbidden},
+	}
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		request.Header.Set("Authorization", "Bearer "+io.token)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.output {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.output, io.method, io.path)
+		}
+	}
+}
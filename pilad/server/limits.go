@@ -0,0 +1,251 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// errBodyTooLarge is returned when the body of a
+// request exceeds the limit given by MaxElementSize.
+var errBodyTooLarge = errors.New("request body is too large")
+
+// bodyLimit returns the maximum size in bytes of the body of a
+// request containing elements, or -1 if unlimited. It leaves
+// room for the base64 encoding of binary elements and the JSON
+// syntax around them.
+func (c *Conn) bodyLimit() int64 {
+	max := c.Config.MaxElementSize()
+	if max == -1 {
+		return -1
+	}
+	return int64(max)*4/3 + 1024
+}
+
+// readBody reads the body of the request, returning errBodyTooLarge
+// if it exceeds bodyLimit. Larger bodies are not read further.
+func (c *Conn) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	var buf bytes.Buffer
+	err := c.readBodyInto(&buf, w, r)
+	if err == errBodyTooLarge {
+		return nil, err
+	}
+	return buf.Bytes(), err
+}
+
+// readBodyInto reads the body of the request into buf, like readBody,
+// so the hot path can read it into a buffer of the pool.
+func (c *Conn) readBodyInto(buf *bytes.Buffer, w http.ResponseWriter, r *http.Request) error {
+	limit := c.bodyLimit()
+	if limit == -1 {
+		_, err := buf.ReadFrom(r.Body)
+		return err
+	}
+
+	_, err := buf.ReadFrom(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil && int64(buf.Len()) >= limit {
+		return errBodyTooLarge
+	}
+	return err
+}
+
+// tooLargeHandler logs and returns 413 for a request
+// whose element exceeds MaxElementSize.
+func (c *Conn) tooLargeHandler(w http.ResponseWriter, r *http.Request, err error) {
+	logResponse(r, http.StatusRequestEntityTooLarge, "reason", "value reached", "config", vars.MaxElementSize, "error", err)
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+}
+
+// memoryLimitHandler logs and returns 507 for a request whose
+// elements exceed the memory limit of the Database.
+func (c *Conn) memoryLimitHandler(w http.ResponseWriter, r *http.Request, err error) {
+	logResponse(r, http.StatusInsufficientStorage, "error", err)
+	w.WriteHeader(http.StatusInsufficientStorage)
+}
+
+// Limits are the global limits of pilad, which are backed by the
+// config values of the same name and can be tuned without restarting
+// through PUT /_limits. Limits equal to 0 are unlimited, except
+// MaxElementSize, which is unlimited if -1.
+type Limits struct {
+	MaxDatabases         int   `json:"max_databases"`
+	MaxStacksPerDatabase int   `json:"max_stacks_per_database"`
+	MaxElementSize       int   `json:"max_element_size"`
+	MaxMemory            int64 `json:"max_memory"`
+}
+
+// limitsUpdate are the Limits given by PUT /_limits,
+// which are nil if they are not changed.
+type limitsUpdate struct {
+	MaxDatabases         *int   `json:"max_databases"`
+	MaxStacksPerDatabase *int   `json:"max_stacks_per_database"`
+	MaxElementSize       *int   `json:"max_element_size"`
+	MaxMemory            *int64 `json:"max_memory"`
+}
+
+// Validate returns an error if any of the Limits is not valid.
+func (u limitsUpdate) Validate() error {
+	if (u.MaxDatabases != nil && *u.MaxDatabases < 0) ||
+		(u.MaxStacksPerDatabase != nil && *u.MaxStacksPerDatabase < 0) ||
+		(u.MaxMemory != nil && *u.MaxMemory < 0) {
+		return errors.New("max_databases, max_stacks_per_database and max_memory must be 0 or greater")
+	}
+	if u.MaxElementSize != nil && (*u.MaxElementSize < -1 || *u.MaxElementSize == 0) {
+		return errors.New("max_element_size must be -1 or greater than 0")
+	}
+	return nil
+}
+
+// Limits returns the current global Limits of the Connection.
+func (c *Conn) Limits() Limits {
+	return Limits{
+		MaxDatabases:         c.Config.MaxDatabases(),
+		MaxStacksPerDatabase: c.Config.MaxStacksPerDatabase(),
+		MaxElementSize:       c.Config.MaxElementSize(),
+		MaxMemory:            c.Config.MaxMemory(),
+	}
+}
+
+// limitsHandler writes the global Limits into the response, after
+// changing the ones given in the request body on PUT. Lowering a
+// limit below the current usage only rejects further requests.
+func (c *Conn) limitsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "PUT" {
+		if r.Body == nil {
+			logResponse(r, http.StatusBadRequest, "reason", "no limits provided")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logResponse(r, http.StatusBadRequest, "reason", "error on reading limits", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var update limitsUpdate
+		if err := json.Unmarshal(body, &update); err != nil {
+			logResponse(r, http.StatusBadRequest, "reason", "error on decoding limits", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := update.Validate(); err != nil {
+			logResponse(r, http.StatusBadRequest, "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if update.MaxDatabases != nil {
+			c.Config.Set(vars.MaxDatabases, *update.MaxDatabases)
+		}
+		if update.MaxStacksPerDatabase != nil {
+			c.Config.Set(vars.MaxStacksPerDatabase, *update.MaxStacksPerDatabase)
+		}
+		if update.MaxElementSize != nil {
+			c.Config.Set(vars.MaxElementSize, *update.MaxElementSize)
+		}
+		if update.MaxMemory != nil {
+			c.Config.Set(vars.MaxMemory, int(*update.MaxMemory))
+		}
+		limits := c.Limits()
+		logger.Info("limits changed", "max_databases", limits.MaxDatabases, "max_stacks_per_database", limits.MaxStacksPerDatabase,
+			"max_element_size", limits.MaxElementSize, "max_memory", limits.MaxMemory)
+	}
+
+	// Do not check error as Limits are
+	// always valid for a JSON encoding.
+	b, _ := json.Marshal(c.Limits())
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(b)
+}
+
+// LimitsMiddleware returns a middleware that enforces the global Limits
+// of MAX_DATABASES and MAX_STACKS_PER_DATABASE on the requests creating
+// Databases and Stacks, responding 403 Forbidden to the ones exceeding
+// them, and of MAX_MEMORY on the requests pushing elements, responding
+// 507 Insufficient Storage. It must be chained after TenantMiddleware,
+// so the Databases of tenants are resolved.
+func LimitsMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+			if segments[0] != "databases" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if code, err := conn.exceedsLimits(r, segments); err != nil {
+				if code == http.StatusInsufficientStorage {
+					conn.memoryLimitHandler(w, r, err)
+					return
+				}
+				logResponse(r, code, "error", err)
+				w.WriteHeader(code)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// exceedsLimits returns an error and the status code of the response if
+// a request exceeds any of the global Limits. Like the quotas of tenants,
+// they are checked before the request is served, so the limit of memory
+// can be exceeded by its last push. Stacks of the template of a created
+// Database count towards the limit of stacks.
+func (c *Conn) exceedsLimits(r *http.Request, segments []string) (int, error) {
+	method := r.Method
+	switch {
+	case method == "PUT" && len(segments) == 1:
+		if max := c.Config.MaxDatabases(); max > 0 && c.numberDatabases() >= max {
+			return http.StatusForbidden, fmt.Errorf("%s value of %d databases reached", vars.MaxDatabases, max)
+		}
+		template := c.Config.StackTemplates()[r.FormValue("template")]
+		if max := c.Config.MaxStacksPerDatabase(); max > 0 && len(template.Stacks) > max {
+			return http.StatusForbidden, fmt.Errorf("%s value of %d stacks would be exceeded", vars.MaxStacksPerDatabase, max)
+		}
+	case method == "PUT" && len(segments) == 3 && segments[2] == "stacks":
+		max := c.Config.MaxStacksPerDatabase()
+		if max == 0 {
+			break
+		}
+		if db, ok := c.Pila.ResolveDatabase(segments[1]); ok && db.Status().NumberStacks >= max {
+			return http.StatusForbidden, fmt.Errorf("%s value of %d stacks reached", vars.MaxStacksPerDatabase, max)
+		}
+	case isPush(method, segments):
+		if max := c.Config.MaxMemory(); max > 0 && c.memory() >= max {
+			return http.StatusInsufficientStorage, fmt.Errorf("%s value of %d bytes reached", vars.MaxMemory, max)
+		}
+	}
+	return 0, nil
+}
+
+// numberDatabases returns the number of Databases of the Pila.
+func (c *Conn) numberDatabases() int {
+	n := 0
+	c.Pila.ForEachDatabase(func(*pila.Database) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// memory returns the approximate memory in bytes used
+// by the elements of every Database of the Pila.
+func (c *Conn) memory() int64 {
+	var memory int64
+	c.Pila.ForEachDatabase(func(db *pila.Database) bool {
+		memory += db.Memory()
+		return true
+	})
+	return memory
+}
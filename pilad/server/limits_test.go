@@ -0,0 +1,221 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestConnBodyLimit(t *testing.T) {
+	conn := NewConn()
+
+	inputOutput := []struct {
+		input  interface{}
+		output int64
+	}{
+		{nil, vars.MaxElementSizeDefault*4/3 + 1024},
+		{30, 1064},
+		{-1, -1},
+	}
+
+	for _, io := range inputOutput {
+		if io.input != nil {
+			conn.Config.Set(vars.MaxElementSize, io.input)
+		}
+		if limit := conn.bodyLimit(); limit != io.output {
+			t.Errorf("limit is %d, expected %d", limit, io.output)
+		}
+	}
+}
+
+func TestMaxElementSize(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set(vars.MaxElementSize, 10)
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	handler := Router(conn)
+
+	large := strings.Repeat("x", 2048)
+	inputOutput := []struct {
+		method, path, contentType, body string
+		code                            int
+	}{
+		{"POST", "/databases/db/stacks/stack", "", `{"element":"foo"}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/stack", "", `{"element":"foobarbazqux"}`, http.StatusRequestEntityTooLarge},
+		{"POST", "/databases/db/stacks/stack", "", `{"element":"` + large + `"}`, http.StatusRequestEntityTooLarge},
+		{"POST", "/databases/db/stacks/stack", "text/plain", "hello", http.StatusOK},
+		{"POST", "/databases/db/stacks/stack", "text/plain", "hello world", http.StatusRequestEntityTooLarge},
+		{"POST", "/databases/db/stacks/stack/_bulk", "", `["foo", "foobarbazqux"]`, http.StatusRequestEntityTooLarge},
+		{"POST", "/databases/db/stacks/stack/_bulk", "", `["` + large + `"]`, http.StatusRequestEntityTooLarge},
+		{"POST", "/databases/db/_transaction", "", `[{"op":"push","stack":"stack","element":"foobarbazqux"}]`, http.StatusRequestEntityTooLarge},
+		{"POST", "/databases/db/_transaction", "", `[{"op":"push","stack":"stack","element":"bar"}]`, http.StatusOK},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if io.contentType != "" {
+			request.Header.Set("Content-Type", io.contentType)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.body)
+		}
+	}
+
+	if stack.Size() != 3 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 3)
+	}
+}
+
+func TestMaxElementSize_Unlimited(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set(vars.MaxElementSize, -1)
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	_ = db.AddStack(pila.NewStack("stack", time.Now().UTC()))
+	handler := Router(conn)
+
+	body := `{"element":"` + strings.Repeat("x", 2*vars.MaxElementSizeDefault) + `"}`
+	request, _ := http.NewRequest("POST", "/databases/db/stacks/stack", strings.NewReader(body))
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+}
+
+func TestMaxMemory(t *testing.T) {
+	conn := NewConn()
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path, body string
+		code               int
+	}{
+		{"PUT", "/databases?name=db&max_memory=x", "", http.StatusBadRequest},
+		{"PUT", "/databases?name=db&max_memory=0", "", http.StatusBadRequest},
+		{"PUT", "/databases?name=db&max_memory=100", "", http.StatusCreated},
+		{"PUT", "/databases/db/stacks?name=stack", "", http.StatusCreated},
+		{"PUT", "/databases/db/stacks?name=other", "", http.StatusCreated},
+		{"POST", "/databases/db/stacks/stack", `{"element":"foo"}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/stack/_bulk", `["bar", "baz"]`, http.StatusInsufficientStorage},
+		{"PUT", "/databases/db/stacks/stack/_import", `{"element":"bar"}` + "\n" + `{"element":"baz"}`, http.StatusInsufficientStorage},
+		{"POST", "/databases/db/stacks/stack/_move?to=other", "", http.StatusOK},
+		{"POST", "/databases/db/stacks/stack", `{"element":"baz"}`, http.StatusInsufficientStorage},
+		{"POST", "/databases/db/stacks/other/_copy?to=stack&count=2", "", http.StatusInsufficientStorage},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+	}
+
+	db, _ := ResourceDatabase(conn, "db")
+	if memory, max := db.Memory(), db.MaxMemory(); memory != 70 || max != 100 {
+		t.Errorf("database memory is %d of %d, expected %d of %d", memory, max, 70, 100)
+	}
+}
+
+func TestLimitsHandler(t *testing.T) {
+	conn := NewConn()
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, body string
+		code         int
+		output       string
+	}{
+		{"GET", "", http.StatusOK, `{"max_databases":0,"max_stacks_per_database":0,"max_element_size":1048576,"max_memory":0}`},
+		{"PUT", `{"max_databases":2,"max_memory":1024}`, http.StatusOK, `{"max_databases":2,"max_stacks_per_database":0,"max_element_size":1048576,"max_memory":1024}`},
+		{"PUT", `{"max_stacks_per_database":3,"max_element_size":-1}`, http.StatusOK, `{"max_databases":2,"max_stacks_per_database":3,"max_element_size":-1,"max_memory":1024}`},
+		{"PUT", `{"max_databases":-1}`, http.StatusBadRequest, ""},
+		{"PUT", `{"max_element_size":0}`, http.StatusBadRequest, ""},
+		{"PUT", `{"max_memory":"foo"}`, http.StatusBadRequest, ""},
+		{"PUT", `{}`, http.StatusOK, `{"max_databases":2,"max_stacks_per_database":3,"max_element_size":-1,"max_memory":1024}`},
+		{"GET", "", http.StatusOK, `{"max_databases":2,"max_stacks_per_database":3,"max_element_size":-1,"max_memory":1024}`},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, "/_limits", strings.NewReader(io.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.body)
+		}
+		if body := response.Body.String(); body != io.output {
+			t.Errorf("body is %s, expected %s for %s %s", body, io.output, io.method, io.body)
+		}
+	}
+
+	if size := conn.Config.MaxElementSize(); size != -1 {
+		t.Errorf("MaxElementSize is %d, expected %d", size, -1)
+	}
+}
+
+func TestLimitsMiddleware(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set(vars.StackTemplates, "queues:jobs,mails")
+	conn.Config.Set(vars.MaxDatabases, 2)
+	conn.Config.Set(vars.MaxStacksPerDatabase, 1)
+	conn.Config.Set(vars.MaxMemory, 10)
+	handler := LimitsMiddleware(conn)(Router(conn))
+
+	inputOutput := []struct {
+		method, path, body string
+		code               int
+	}{
+		{"PUT", "/databases?name=db", "", http.StatusCreated},
+		{"PUT", "/databases?name=queues&template=queues", "", http.StatusForbidden},
+		{"PUT", "/databases", "name=queues&template=queues", http.StatusForbidden},
+		{"PUT", "/databases?name=other", "", http.StatusCreated},
+		{"PUT", "/databases?name=another", "", http.StatusForbidden},
+		{"PUT", "/databases/db/stacks?name=stack", "", http.StatusCreated},
+		{"PUT", "/databases/db/stacks?name=other", "", http.StatusForbidden},
+		{"PUT", "/databases/other/stacks?name=stack", "", http.StatusCreated},
+		{"POST", "/databases/db/stacks/stack", `{"element":"foobarbaz"}`, http.StatusOK},
+		{"POST", "/databases/other/stacks/stack", `{"element":"bar"}`, http.StatusInsufficientStorage},
+		{"POST", "/databases/db/stacks/stack/_bulk", `["bar"]`, http.StatusInsufficientStorage},
+		{"DELETE", "/databases/db/stacks/stack", "", http.StatusOK},
+		{"POST", "/databases/other/stacks/stack", `{"element":"bar"}`, http.StatusOK},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// elements are sent form-encoded by clients like curl -d
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// lockOwnerHeader is the header of the requests
+// giving the owner of the lock of a Stack.
+const lockOwnerHeader = "Lock-Owner"
+
+// lockOwner returns the owner of the lock of a Stack given
+// by a request, in the Lock-Owner header or the owner parameter.
+func lockOwner(r *http.Request) string {
+	if owner := r.Header.Get(lockOwnerHeader); owner != "" {
+		return owner
+	}
+	return r.URL.Query().Get("owner")
+}
+
+// checkLock returns true if the request can modify stack, and
+// otherwise responds 423 Locked, as stack is locked by another owner.
+func (c *Conn) checkLock(w http.ResponseWriter, r *http.Request, stack *pila.Stack) bool {
+	if stack.Locked(lockOwner(r), time.Now()) {
+		logResponse(r, http.StatusLocked, "reason", "stack is locked", "stack", stack.Name)
+		w.WriteHeader(http.StatusLocked)
+		return false
+	}
+	return true
+}
+
+// lockStackHandler locks the Stack for the owner of the request
+// for the duration given by the ttl parameter, and returns 200 and
+// the status of the Stack. Returns 400 if the owner or the ttl are
+// missing or invalid, and 423 if the Stack is locked by another owner.
+func (c *Conn) lockStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	ttl, err := ttlParam(r)
+	if err == nil && ttl == 0 {
+		err = fmt.Errorf("ttl must be given")
+	}
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	until, err := stack.Lock(lockOwner(r), ttl, time.Now())
+	switch err {
+	case pila.ErrNoLockOwner:
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	case pila.ErrStackLocked:
+		logResponse(r, http.StatusLocked, "error", err)
+		w.WriteHeader(http.StatusLocked)
+		return
+	}
+
+	logResponse(r, http.StatusOK, "locked_until", until)
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as we consider that a
+	// stack has no JSON encoding issues.
+	b, _ := stack.Status().ToJSON()
+	w.Write(b)
+}
+
+// unlockStackHandler releases the lock of the owner of the request on
+// the Stack, and returns 200 and the status of the Stack. Returns 423
+// if the Stack is locked by another owner.
+func (c *Conn) unlockStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	if err := stack.Unlock(lockOwner(r), time.Now()); err != nil {
+		logResponse(r, http.StatusLocked, "error", err)
+		w.WriteHeader(http.StatusLocked)
+		return
+	}
+
+	logResponse(r, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as we consider that a
+	// stack has no JSON encoding issues.
+	b, _ := stack.Status().ToJSON()
+	w.Write(b)
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestLockOwner(t *testing.T) {
+	request, _ := http.NewRequest("POST", "/?owner=alice", nil)
+	if owner := lockOwner(request); owner != "alice" {
+		t.Errorf("owner is %s, expected %s", owner, "alice")
+	}
+
+	request.Header.Set(lockOwnerHeader, "bob")
+	if owner := lockOwner(request); owner != "bob" {
+		t.Errorf("owner is %s, expected %s", owner, "bob")
+	}
+}
+
+func TestLockStackHandlers(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	_ = db.AddStack(pila.NewStack("stack", time.Now().UTC()))
+	_ = db.AddStack(pila.NewStack("other", time.Now().UTC()))
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path, owner, body string
+		code                      int
+	}{
+		{"POST", "/databases/db/stacks/stack/_lock?ttl=1m", "", "", http.StatusBadRequest},
+		{"POST", "/databases/db/stacks/stack/_lock", "alice", "", http.StatusBadRequest},
+		{"POST", "/databases/db/stacks/stack/_lock?ttl=foo", "alice", "", http.StatusBadRequest},
+		{"POST", "/databases/db/stacks/stack/_lock?ttl=1m", "alice", "", http.StatusOK},
+		{"POST", "/databases/db/stacks/stack/_lock?ttl=1m", "bob", "", http.StatusLocked},
+		{"POST", "/databases/db/stacks/stack", "bob", `{"element":"foo"}`, http.StatusLocked},
+		{"POST", "/databases/db/stacks/stack", "", `{"element":"foo"}`, http.StatusLocked},
+		{"DELETE", "/databases/db/stacks/stack", "bob", "", http.StatusLocked},
+		{"POST", "/databases/db/_transaction", "bob", `[{"op":"push","stack":"stack","element":"foo"}]`, http.StatusLocked},
+		{"POST", "/databases/db/stacks/other/_move?to=stack", "bob", "", http.StatusLocked},
+		{"POST", "/databases/db/_popush?from=other&to=stack", "bob", "", http.StatusLocked},
+		{"GET", "/databases/db/stacks/stack/peek", "bob", "", http.StatusOK},
+		{"POST", "/databases/db/stacks/stack", "alice", `{"element":"foo"}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/stack/_unlock", "bob", "", http.StatusLocked},
+		{"POST", "/databases/db/stacks/stack/_unlock", "alice", "", http.StatusOK},
+		{"DELETE", "/databases/db/stacks/stack", "bob", "", http.StatusOK},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		if io.owner != "" {
+			request.Header.Set(lockOwnerHeader, io.owner)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s by %s", response.Code, io.code, io.method, io.path, io.owner)
+		}
+	}
+}
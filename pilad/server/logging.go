@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/logger"
+	"github.com/gorilla/mux"
+)
+
+// logOutput is the destination of the log entries of pilad,
+// set from the LogFile Option at start-up.
+var logOutput io.Writer = os.Stderr
+
+// openLogFile opens the file at path to append log entries to it,
+// creating it if it does not exist.
+func openLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
+
+// setLogLevel sets the default logger according to the LOG_LEVEL config
+// value and the LogFormat of the Conn, and sends the output of the
+// standard logger to it as debug entries.
+func (c *Conn) setLogLevel() {
+	// Do not check error as the value is already validated.
+	level, _ := logger.ParseLevel(c.Config.LogLevel())
+
+	l := logger.Default()
+	l.SetOutput(logOutput)
+	l.SetLevel(level)
+	l.SetFormat(c.LogFormat)
+
+	log.SetFlags(0)
+	log.SetOutput(l.Writer(logger.LevelDebug))
+}
+
+// logResponse writes an entry into the default logger for the response
+// to a request, with its method, URL and status code, followed by the
+// given fields, as alternate keys and values. It is a warning if code
+// is an error status code, and an info entry otherwise.
+func logResponse(r *http.Request, code int, keyvals ...interface{}) {
+	keyvals = append([]interface{}{"method", r.Method, "url", r.URL.String(), "status", code}, keyvals...)
+	if code >= http.StatusBadRequest {
+		logger.Warn("response", keyvals...)
+		return
+	}
+	logger.Info("response", keyvals...)
+}
+
+// requestLog holds the values of a request that are only known
+// once it is routed, to be logged by RequestLoggingMiddleware
+// and audited by AuditMiddleware.
+type requestLog struct {
+	database, stack string
+	route           string
+}
+
+// RequestLoggingMiddleware returns a middleware that writes an info entry
+// into l for every request, with its method, path, status code, latency
+// in milliseconds, and the requested database and stack IDs, if any.
+func RequestLoggingMiddleware(l *logger.Logger) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !l.Enabled(logger.LevelInfo) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			rl := &requestLog{}
+			mw := &metricsResponseWriter{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(mw, r.WithContext(context.WithValue(r.Context(), requestLogKey, rl)))
+
+			l.Info("request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", mw.code,
+				"latency_ms", float64(time.Since(start))/float64(time.Millisecond),
+				"database", rl.database,
+				"stack", rl.stack)
+		})
+	}
+}
+
+// setRequestLog records the database and stack IDs, and the path template
+// of the route, of the routed request into the requestLog attached to its
+// context, if any.
+func setRequestLog(r *http.Request, route string) {
+	rl, ok := r.Context().Value(requestLogKey).(*requestLog)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	rl.database, rl.stack = vars["database_id"], vars["stack_id"]
+	rl.route = route
+}
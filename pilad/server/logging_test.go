@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config"
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+func TestSetLogLevel(t *testing.T) {
+	conn := NewConn()
+	defer func() {
+		logOutput = os.Stderr
+		conn.setLogLevel()
+	}()
+
+	var buf bytes.Buffer
+	logOutput = &buf
+
+	conn.Config.Set(vars.LogLevel, config.LogLevelDebug)
+	conn.setLogLevel()
+	log.Println("foo")
+	if !strings.HasSuffix(buf.String(), " DEBUG foo\n") {
+		t.Errorf("output is %q, expected a debug entry", buf.String())
+	}
+
+	buf.Reset()
+	conn.Config.Set(vars.LogLevel, config.LogLevelOff)
+	conn.setLogLevel()
+	log.Println("foo")
+	logger.Error("bar")
+	if buf.Len() != 0 {
+		t.Errorf("output is %s, expected empty", buf.String())
+	}
+	conn.Config.Set(vars.LogLevel, config.LogLevelInfo)
+}
+
+func TestOpenLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pilad-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pilad.log")
+
+	for _, line := range []string{"foo\n", "bar\n"} {
+		f, err := openLogFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.WriteString(line)
+		f.Close()
+	}
+
+	if b, _ := ioutil.ReadFile(path); string(b) != "foo\nbar\n" {
+		t.Errorf("log file is %q, expected %q", b, "foo\nbar\n")
+	}
+	if _, err := openLogFile(filepath.Join(dir, "foo", "pilad.log")); err == nil {
+		t.Error("err is nil, expected error")
+	}
+}
+
+func TestRequestLoggingMiddleware(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	_ = db.AddStack(pila.NewStack("stack", time.Now().UTC()))
+
+	var buf bytes.Buffer
+	l := logger.New(&buf, logger.LevelInfo, logger.FormatJSON)
+	handler := RequestLoggingMiddleware(l)(MetricsMiddleware(conn)(Router(conn)))
+
+	inputOutput := []struct {
+		method, path      string
+		status            int
+		database, stackID string
+	}{
+		{"GET", "/_status", http.StatusOK, "", ""},
+		{"GET", "/databases/db/stacks/stack/size", http.StatusOK, "db", "stack"},
+		{"GET", "/databases/db/stacks/foo/size", http.StatusGone, "db", "foo"},
+		{"GET", "/foo", http.StatusNotFound, "", ""},
+	}
+
+	for _, io := range inputOutput {
+		buf.Reset()
+		request, err := http.NewRequest(io.method, io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["level"] != "info" || entry["msg"] != "request" {
+			t.Errorf("entry is %v, expected an info request entry", entry)
+		}
+		if entry["method"] != io.method || entry["path"] != io.path {
+			t.Errorf("method and path are %v %v, expected %v %v", entry["method"], entry["path"], io.method, io.path)
+		}
+		if entry["status"] != float64(io.status) {
+			t.Errorf("status is %v, expected %v for %s", entry["status"], io.status, io.path)
+		}
+		if _, ok := entry["latency_ms"].(float64); !ok {
+			t.Errorf("latency_ms is %v, expected a number", entry["latency_ms"])
+		}
+		if entry["database"] != io.database || entry["stack"] != io.stackID {
+			t.Errorf("database and stack are %v %v, expected %v %v for %s",
+				entry["database"], entry["stack"], io.database, io.stackID, io.path)
+		}
+	}
+
+	buf.Reset()
+	l.SetLevel(logger.LevelWarn)
+	request, _ := http.NewRequest("GET", "/_status", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	if buf.Len() != 0 {
+		t.Errorf("output is %s, expected empty", buf.String())
+	}
+}
+
+func TestLogResponse(t *testing.T) {
+	var buf bytes.Buffer
+	l := logger.Default()
+	l.SetOutput(&buf)
+	l.SetFormat(logger.FormatJSON)
+	defer func() {
+		l.SetOutput(os.Stderr)
+		l.SetFormat(logger.FormatText)
+	}()
+
+	request, _ := http.NewRequest("PUT", "/databases?name=db", nil)
+	inputOutput := []struct {
+		code    int
+		keyvals []interface{}
+		level   string
+		reason  interface{}
+	}{
+		{http.StatusCreated, nil, "info", nil},
+		{http.StatusBadRequest, []interface{}{"reason", "invalid name"}, "warn", "invalid name"},
+	}
+
+	for _, io := range inputOutput {
+		buf.Reset()
+		logResponse(request, io.code, io.keyvals...)
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["level"] != io.level || entry["msg"] != "response" {
+			t.Errorf("entry is %v, expected a %s response entry", entry, io.level)
+		}
+		if entry["method"] != "PUT" || entry["url"] != "/databases?name=db" || entry["status"] != float64(io.code) {
+			t.Errorf("method, url and status are %v %v %v, expected %v %v %v",
+				entry["method"], entry["url"], entry["status"], "PUT", "/databases?name=db", io.code)
+		}
+		if entry["reason"] != io.reason {
+			t.Errorf("reason is %v, expected %v", entry["reason"], io.reason)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+const logoArt = `
+         d8b 888               888 888
+         Y8P 888               888 888
+             888               888 888
+88888b.  888 888  8888b.   .d88888 88888b.
+888 "88b 888 888    "88b  d88" 888 888 "88b
+888  888 888 888 .d888888 888  888 888  888
+888 d88P 888 888 888  888 Y88b 888 888 d88P
+88888P"  888 888 "Y888888  "Y88888 88888P"
+888
+888
+888
+
+`
+
+// logo writes the piladb logo, only if log entries are written
+// as text, and an entry with the details of the started pilad.
+func logo(conn *Conn) {
+	l := logger.Default()
+	if conn.LogFormat == logger.FormatText && l.Enabled(logger.LevelInfo) {
+		fmt.Fprint(logOutput, logoArt)
+	}
+	l.Info("pilad started",
+		"version", conn.Status.Version,
+		"host", conn.Status.Host,
+		"port", conn.Config.Port(),
+		"pid", conn.Status.PID)
+}
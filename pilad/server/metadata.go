@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+const (
+	// pushedAtHeader is the header returning the date
+	// when a popped or peeked element was pushed.
+	pushedAtHeader = "Element-Pushed-At"
+	// tagHeader is the header returning the tag
+	// of a popped or peeked element, if any.
+	tagHeader = "Element-Tag"
+)
+
+// tagParam returns the tag of an element pushed by r, given either by
+// the tag key of its Element or, e.g. for binary elements, by the tag
+// parameter of r.
+func tagParam(r *http.Request, element pila.Element) string {
+	if element.Tag != "" {
+		return element.Tag
+	}
+	return r.FormValue("tag")
+}
+
+// writeElementMetadata writes a value of a Stack like writeElement,
+// along with its Metadata as the Element-Pushed-At and Element-Tag
+// headers. If the metadata parameter of r is true, the Metadata is
+// written into the JSON Element too, as its pushed_at and tag keys,
+// unless r accepts protobuf or the media type of a pila.Codec.
+func (c *Conn) writeElementMetadata(w http.ResponseWriter, r *http.Request, value interface{}, m pila.Metadata) {
+	m.PushedAt = m.PushedAt.UTC()
+	if !m.PushedAt.IsZero() {
+		w.Header().Set(pushedAtHeader, m.PushedAt.Format(time.RFC3339Nano))
+	}
+	if m.Tag != "" {
+		w.Header().Set(tagHeader, m.Tag)
+	}
+
+	_, isCodec := acceptedCodec(r)
+	if envelope, _ := boolParam(r, "metadata"); !envelope || isCodec || acceptsProtobuf(r) {
+		c.writeElement(w, r, value)
+		return
+	}
+	c.writeJSONElement(w, r, pila.NewElement(value).WithMetadata(m))
+}
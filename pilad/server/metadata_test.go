@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestElementMetadata(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	handler := Router(conn)
+
+	pushedAt := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	_ = stack.PushWithOptions("old", pila.PushOptions{Tag: "a", PushedAt: pushedAt})
+
+	inputOutput := []struct {
+		method, path, body string
+		code               int
+		output, tag        string
+	}{
+		{"POST", "/databases/db/stacks/stack", `{"element":"foo","tag":"a"}`, http.StatusOK, `{"element":"foo","tag":"a"}`, ""},
+		{"POST", "/databases/db/stacks/stack?tag=b", `{"element":"bar"}`, http.StatusOK, `{"element":"bar"}`, ""},
+		{"POST", "/databases/db/stacks/stack?tag=new%0Aline", `{"element":"baz"}`, http.StatusBadRequest, "", ""},
+		{"GET", "/databases/db/stacks/stack/peek", "", http.StatusOK, `{"element":"bar"}`, "b"},
+		{"GET", "/databases/db/stacks/stack/peek?tag=a", "", http.StatusOK, `{"element":"foo"}`, "a"},
+		{"GET", "/databases/db/stacks/stack/peek?tag=c", "", http.StatusOK, `{"element":null}`, ""},
+		{"DELETE", "/databases/db/stacks/stack", "", http.StatusOK, `{"element":"bar"}`, "b"},
+		{"DELETE", "/databases/db/stacks/stack", "", http.StatusOK, `{"element":"foo"}`, "a"},
+		{"DELETE", "/databases/db/stacks/stack?metadata=true", "", http.StatusOK, `{"element":"old","pushed_at":"2016-01-02T03:04:05Z","tag":"a"}`, "a"},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if response.Body.String() != io.output {
+			t.Errorf("body is %s, expected %s for %s %s", response.Body.String(), io.output, io.method, io.path)
+		}
+		if tag := response.Header().Get(tagHeader); tag != io.tag {
+			t.Errorf("%s is %q, expected %q for %s %s", tagHeader, tag, io.tag, io.method, io.path)
+		}
+		if io.method != "POST" && io.tag != "" {
+			if _, err := time.Parse(time.RFC3339Nano, response.Header().Get(pushedAtHeader)); err != nil {
+				t.Errorf("%s is not valid: %v", pushedAtHeader, err)
+			}
+		}
+	}
+}
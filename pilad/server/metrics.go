@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics contains counters of the HTTP traffic served by pilad.
+// Fields must be accessed atomically.
+type Metrics struct {
+	TotalRequests     int64   `json:"total_requests"`
+	TotalErrors       int64   `json:"total_errors"`
+	TotalBytesWritten int64   `json:"total_bytes_written"`
+	ActiveConnections int64   `json:"active_connections"`
+	UptimeSeconds     float64 `json:"uptime_seconds"`
+}
+
+// NewMetrics returns a new Metrics with all counters set to zero.
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// Snapshot returns a copy of the Metrics, computing UptimeSeconds
+// from the given start time.
+func (m *Metrics) Snapshot(startTime, now time.Time) Metrics {
+	return Metrics{
+		TotalRequests:     atomic.LoadInt64(&m.TotalRequests),
+		TotalErrors:       atomic.LoadInt64(&m.TotalErrors),
+		TotalBytesWritten: atomic.LoadInt64(&m.TotalBytesWritten),
+		ActiveConnections: atomic.LoadInt64(&m.ActiveConnections),
+		UptimeSeconds:     now.Sub(startTime).Seconds(),
+	}
+}
+
+// ToJSON returns the Metrics in JSON format.
+func (m Metrics) ToJSON() []byte {
+	// Do not check error as the Metrics type does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(m)
+	return b
+}
+
+// MetricsMiddleware returns a middleware that updates the Metrics
+// and the Latencies of the Conn on every request. Responses with a
+// status code of 400 or greater are counted as errors.
+func MetricsMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m := conn.Metrics
+			atomic.AddInt64(&m.TotalRequests, 1)
+			atomic.AddInt64(&m.ActiveConnections, 1)
+			defer atomic.AddInt64(&m.ActiveConnections, -1)
+
+			start := time.Now()
+			mw := &metricsResponseWriter{ResponseWriter: w, code: http.StatusOK, route: notFoundRoute}
+			next.ServeHTTP(mw, r)
+			conn.Latencies.Observe(mw.route, time.Since(start))
+
+			if mw.code >= http.StatusBadRequest {
+				atomic.AddInt64(&m.TotalErrors, 1)
+			}
+			atomic.AddInt64(&m.TotalBytesWritten, mw.written)
+		})
+	}
+}
+
+// observeOp records in the OpLatencies of the Conn the
+// latency of an operation started at start.
+func (c *Conn) observeOp(op string, start time.Time) {
+	c.OpLatencies.Observe(op, time.Since(start))
+}
+
+// metricsResponseWriter wraps an http.ResponseWriter recording
+// the status code, the number of bytes written and the route
+// serving the request.
+type metricsResponseWriter struct {
+	http.ResponseWriter
+	code    int
+	written int64
+	route   string
+}
+
+// WriteHeader records the status code and writes it.
+func (w *metricsResponseWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the number of bytes written and writes them.
+func (w *metricsResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Hijack lets the handler take over the connection, e.g. to
+// upgrade it to a WebSocket connection.
+func (w *metricsResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	w.code = http.StatusSwitchingProtocols
+	return hj.Hijack()
+}
+
+// opsHandler writes the Metrics of the Conn and the
+// operations in flight into the response.
+func (c *Conn) opsHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	status := OpsStatus{
+		Metrics:    c.Metrics.Snapshot(c.startTime, now),
+		Operations: c.Operations.Operations(now),
+	}
+	if tenant := requestTenant(r); tenant != "" {
+		status.Operations = tenantOperations(tenant, status.Operations)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(status.ToJSON())
+}
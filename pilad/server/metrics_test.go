@@ -0,0 +1,117 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewMetrics(t *testing.T) {
+	m := NewMetrics()
+	if m == nil {
+		t.Fatal("metrics is nil")
+	}
+	if *m != (Metrics{}) {
+		t.Errorf("metrics is %v, expected zero value", *m)
+	}
+}
+
+func TestMetricsSnapshot(t *testing.T) {
+	m := &Metrics{
+		TotalRequests:     10,
+		TotalErrors:       2,
+		TotalBytesWritten: 300,
+		ActiveConnections: 1,
+	}
+	now := time.Now()
+
+	expected := Metrics{10, 2, 300, 1, 5}
+	if snapshot := m.Snapshot(now.Add(-5*time.Second), now); snapshot != expected {
+		t.Errorf("snapshot is %v, expected %v", snapshot, expected)
+	}
+}
+
+func TestMetricsToJSON(t *testing.T) {
+	m := Metrics{10, 2, 300, 1, 5.5}
+
+	expected := `{"total_requests":10,"total_errors":2,"total_bytes_written":300,"active_connections":1,"uptime_seconds":5.5}`
+	if b := m.ToJSON(); string(b) != expected {
+		t.Errorf("metrics are %s, expected %s", string(b), expected)
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	conn := NewConn()
+	handler := MetricsMiddleware(conn)(Router(conn))
+
+	inputOutput := []struct {
+		method, path string
+		code         int
+	}{
+		{"PUT", "/databases?name=db", http.StatusCreated},
+		{"GET", "/databases/db", http.StatusOK},
+		{"GET", "/databases/nodb", http.StatusGone},
+		{"GET", "/foo", http.StatusNotFound},
+	}
+
+	var written int64
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v", response.Code, io.code)
+		}
+		written += int64(response.Body.Len())
+	}
+
+	m := conn.Metrics.Snapshot(conn.startTime, time.Now())
+	if m.TotalRequests != 4 {
+		t.Errorf("TotalRequests is %d, expected %d", m.TotalRequests, 4)
+	}
+	if m.TotalErrors != 2 {
+		t.Errorf("TotalErrors is %d, expected %d", m.TotalErrors, 2)
+	}
+	if m.TotalBytesWritten != written {
+		t.Errorf("TotalBytesWritten is %d, expected %d", m.TotalBytesWritten, written)
+	}
+	if m.ActiveConnections != 0 {
+		t.Errorf("ActiveConnections is %d, expected %d", m.ActiveConnections, 0)
+	}
+}
+
+func TestOpsHandler(t *testing.T) {
+	conn := NewConn()
+	conn.Metrics.TotalRequests = 3
+
+	request, err := http.NewRequest("GET", "/_ops", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+
+	Router(conn).ServeHTTP(response, request)
+
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
+	}
+
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+
+	ops, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := `{"total_requests":3,"total_errors":0,"total_bytes_written":0,"active_connections":0,"uptime_seconds":`; string(ops[:len(expected)]) != expected {
+		t.Errorf("ops are %s, expected prefix %s", string(ops), expected)
+	}
+}
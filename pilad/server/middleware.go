@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+	"github.com/gorilla/mux"
+)
+
+// MiddlewareFunc represents a function that wraps an http.Handler
+// to add behavior before or after it serves a request.
+type MiddlewareFunc func(http.Handler) http.Handler
+
+// contextKey represents the type of the keys of the values
+// that middlewares attach to the context of a request.
+type contextKey int
+
+const (
+	// databaseKey is the context key of the requested Database.
+	databaseKey contextKey = iota
+	// stackKey is the context key of the requested Stack.
+	stackKey
+	// requestLogKey is the context key of the requestLog
+	// filled once the request is routed.
+	requestLogKey
+	// tenantKey is the context key of the tenant of the request.
+	tenantKey
+	// dateKey is the context key of the date of the request.
+	dateKey
+	// raftKey is the context key of the raftRequest
+	// of a request served by the Raft leader.
+	raftKey
+)
+
+// DatabaseMiddleware returns a middleware that resolves the Database
+// given by the database_id variable of the request path, either by ID
+// or name, and attaches it to the request context. If the Database
+// does not exist, the request is answered with a database_not_found
+// APIError and 410 Gone, rather than 404 Not Found, as missing
+// Databases always were, so clients relying on it, like pila/client
+// returning ErrGone, keep working.
+func DatabaseMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			databaseID := mux.Vars(r)["database_id"]
+			db, ok := ResourceDatabase(conn, databaseID)
+			if !ok {
+				writeError(w, r, http.StatusGone, APIError{
+					Code:    codeDatabaseNotFound,
+					Message: fmt.Sprintf("database %s is Gone", databaseID),
+					Field:   "database_id",
+				})
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), databaseKey, db)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// databaseFromContext returns the Database attached to the
+// request context by DatabaseMiddleware.
+func databaseFromContext(r *http.Request) *pila.Database {
+	db, _ := r.Context().Value(databaseKey).(*pila.Database)
+	return db
+}
+
+// StackMiddleware returns a middleware that resolves the Stack given
+// by the stack_id variable of the request path, either by ID or name,
+// and attaches it to the request context. It must be chained after
+// DatabaseMiddleware, as the Stack is looked up in the Database of the
+// request context. If the Stack does not exist, the request is answered
+// with 410 Gone. Otherwise, MAX_ELEMENT_SIZE is applied to the Stack.
+func StackMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			stackID := mux.Vars(r)["stack_id"]
+			stack, ok := ResourceStack(databaseFromContext(r), stackID)
+			if !ok {
+				conn.goneHandler(w, r, fmt.Sprintf("stack %s is Gone", stackID))
+				return
+			}
+
+			if !conn.allowStack(w, r, stack) {
+				return
+			}
+			if isMutating(r.Method) && !conn.checkLock(w, r, stack) {
+				return
+			}
+
+			stack.SetMaxElementSize(conn.Config.MaxElementSize())
+			ctx := context.WithValue(r.Context(), stackKey, stack)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// stackFromContext returns the Stack attached to the
+// request context by StackMiddleware.
+func stackFromContext(r *http.Request) *pila.Stack {
+	stack, _ := r.Context().Value(stackKey).(*pila.Stack)
+	return stack
+}
+
+// persistenceDebounce is the period of time in which consecutive
+// saves of the Pila are coalesced into a single one.
+const persistenceDebounce = 100 * time.Millisecond
+
+// PersistenceMiddleware returns a middleware that saves the Pila into
+// the file given by path after every request that mutates its state,
+// i.e. POST, PUT and DELETE requests. Saves happen asynchronously and
+// are coalesced, and errors are logged without failing the request.
+func PersistenceMiddleware(p *pila.Pila, path string) MiddlewareFunc {
+	d := newDebouncer(persistenceDebounce, func() {
+		if err := p.Save(path); err != nil {
+			logger.Error("error on saving pila", "path", path, "error", err)
+		}
+	})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			if isMutating(r.Method) {
+				d.trigger()
+			}
+		})
+	}
+}
+
+// isMutating determines whether an HTTP method may change the
+// state of the Pila.
+func isMutating(method string) bool {
+	switch method {
+	case "POST", "PUT", "DELETE", "PATCH":
+		return true
+	}
+	return false
+}
+
+// debouncer calls a function once after a delay, no matter how
+// many times it was triggered during such delay.
+type debouncer struct {
+	delay time.Duration
+	fn    func()
+
+	mu      sync.Mutex
+	pending bool
+	// running serializes the calls to fn
+	running sync.Mutex
+}
+
+// newDebouncer returns a debouncer that calls fn after delay.
+func newDebouncer(delay time.Duration, fn func()) *debouncer {
+	return &debouncer{delay: delay, fn: fn}
+}
+
+// trigger schedules a call to fn, unless there is one
+// already pending.
+func (d *debouncer) trigger() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.pending {
+		return
+	}
+	d.pending = true
+
+	time.AfterFunc(d.delay, func() {
+		d.mu.Lock()
+		d.pending = false
+		d.mu.Unlock()
+
+		d.running.Lock()
+		defer d.running.Unlock()
+		d.fn()
+	})
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/gorilla/mux"
+)
+
+func TestDatabaseMiddleware(t *testing.T) {
+	db := pila.NewDatabase("db")
+	conn := NewConn()
+	_ = conn.Pila.AddDatabase(db)
+
+	var resolved *pila.Database
+	r := mux.NewRouter()
+	r.Handle("/databases/{database_id}", DatabaseMiddleware(conn)(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			resolved = databaseFromContext(r)
+		})))
+
+	for _, input := range []string{db.ID.String(), db.Name} {
+		resolved = nil
+
+		request, err := http.NewRequest("GET", "/databases/"+input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		r.ServeHTTP(response, request)
+
+		if response.Code != http.StatusOK {
+			t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+		}
+		if resolved != db {
+			t.Errorf("database is %v, expected %v", resolved, db)
+		}
+	}
+}
+
+func TestDatabaseMiddleware_Gone(t *testing.T) {
+	conn := NewConn()
+
+	var called bool
+	r := mux.NewRouter()
+	r.Handle("/databases/{database_id}", DatabaseMiddleware(conn)(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		})))
+
+	request, err := http.NewRequest("GET", "/databases/nodb", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	r.ServeHTTP(response, request)
+
+	if response.Code != http.StatusGone {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusGone)
+	}
+	if expected := `{"code":"database_not_found","message":"database nodb is Gone","field":"database_id"}`; response.Body.String() != expected {
+		t.Errorf("response is %s, expected %s", response.Body, expected)
+	}
+	if called {
+		t.Error("next handler was called")
+	}
+}
+
+func TestStackMiddleware(t *testing.T) {
+	stack := pila.NewStack("stack", time.Now())
+	db := pila.NewDatabase("db")
+	_ = db.AddStack(stack)
+	conn := NewConn()
+	_ = conn.Pila.AddDatabase(db)
+
+	var resolved *pila.Stack
+	r := mux.NewRouter()
+	r.Handle("/databases/{database_id}/stacks/{stack_id}", stackMiddlewares(conn,
+		func(w http.ResponseWriter, r *http.Request) {
+			resolved = stackFromContext(r)
+		}))
+
+	for _, input := range []string{stack.ID.String(), stack.Name} {
+		resolved = nil
+
+		request, err := http.NewRequest("GET", "/databases/db/stacks/"+input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		r.ServeHTTP(response, request)
+
+		if response.Code != http.StatusOK {
+			t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+		}
+		if resolved != stack {
+			t.Errorf("stack is %v, expected %v", resolved, stack)
+		}
+	}
+}
+
+func TestStackMiddleware_Gone(t *testing.T) {
+	db := pila.NewDatabase("db")
+	conn := NewConn()
+	_ = conn.Pila.AddDatabase(db)
+
+	var called bool
+	r := mux.NewRouter()
+	r.Handle("/databases/{database_id}/stacks/{stack_id}", stackMiddlewares(conn,
+		func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+
+	for _, path := range []string{"/databases/db/stacks/nostack", "/databases/nodb/stacks/nostack"} {
+		request, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		r.ServeHTTP(response, request)
+
+		if response.Code != http.StatusGone {
+			t.Errorf("response code is %v, expected %v", response.Code, http.StatusGone)
+		}
+		if called {
+			t.Error("next handler was called")
+		}
+	}
+}
+
+func TestPersistenceMiddleware(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pilad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "piladb.json")
+
+	conn := NewConn()
+	handler := PersistenceMiddleware(conn.Pila, path)(Router(conn))
+
+	request, err := http.NewRequest("GET", "/databases", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	time.Sleep(2 * persistenceDebounce)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("pila was saved after a GET request")
+	}
+
+	for _, name := range []string{"db0", "db1"} {
+		request, err := http.NewRequest("PUT", "/databases?name="+name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != http.StatusCreated {
+			t.Errorf("response code is %v, expected %v", response.Code, http.StatusCreated)
+		}
+	}
+
+	time.Sleep(2 * persistenceDebounce)
+
+	p := pila.NewPila()
+	if err := p.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.Status().NumberDatabases; n != 2 {
+		t.Errorf("number of saved databases is %d, expected %d", n, 2)
+	}
+}
+
+func TestPersistenceMiddleware_Error(t *testing.T) {
+	conn := NewConn()
+	handler := PersistenceMiddleware(conn.Pila, "/non/existing/dir/piladb.json")(Router(conn))
+
+	request, err := http.NewRequest("PUT", "/databases?name=db", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusCreated {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusCreated)
+	}
+	time.Sleep(2 * persistenceDebounce)
+}
+
+func TestIsMutating(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output bool
+	}{
+		{"GET", false},
+		{"HEAD", false},
+		{"POST", true},
+		{"PUT", true},
+		{"DELETE", true},
+	}
+
+	for _, io := range inputOutput {
+		if mutating := isMutating(io.input); mutating != io.output {
+			t.Errorf("isMutating(%s) is %v, expected %v", io.input, mutating, io.output)
+		}
+	}
+}
+
+func TestDebouncer(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	d := newDebouncer(20*time.Millisecond, func() {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+	})
+
+	for i := 0; i < 10; i++ {
+		d.trigger()
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	d.trigger()
+	time.Sleep(60 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 2 {
+		t.Errorf("fn was called %d times, expected %d", calls, 2)
+	}
+}
@@ -0,0 +1,394 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+	"github.com/fern4lvarez/piladb/pkg/resp"
+	"github.com/fern4lvarez/piladb/pkg/uuid"
+)
+
+const (
+	// migrateBatch is the number of elements of a Redis
+	// list read and pushed at once by a migration.
+	migrateBatch = 1000
+	// migrateTimeout is the maximum duration of dialing
+	// Redis, and of every command sent to it.
+	migrateTimeout = 10 * time.Second
+	// redisPortDefault is the port of Redis if not given.
+	redisPortDefault = "6379"
+)
+
+// MigrateResult represents the elements of a Redis list
+// migrated into a Stack.
+type MigrateResult struct {
+	From     string `json:"from"`
+	List     string `json:"list"`
+	Database string `json:"database"`
+	Stack    string `json:"stack"`
+	Migrated int    `json:"migrated"`
+	Drained  bool   `json:"drained"`
+}
+
+// ToJSON converts a MigrateResult into JSON.
+func (result MigrateResult) ToJSON() []byte {
+	// Do not check error as the MigrateResult type does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(result)
+	return b
+}
+
+// pushError is an error on pushing migrated elements into a Stack,
+// as opposed to the errors of Redis.
+type pushError struct {
+	err error
+}
+
+func (e pushError) Error() string {
+	return e.err.Error()
+}
+
+// redisClient is a minimal client of a Redis server.
+type redisClient struct {
+	conn net.Conn
+	r    *resp.Reader
+	w    *resp.Writer
+}
+
+// parseRedisURL returns the address, the username and password, if
+// any, and the database number of a Redis URL, like
+// redis://:secret@host:6379/0, and whether it uses TLS, being its
+// scheme rediss.
+func parseRedisURL(s string) (addr, username, password string, db int, useTLS bool, err error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", "", "", 0, false, err
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" || u.Host == "" {
+		return "", "", "", 0, false, fmt.Errorf("from %q must be a Redis URL, like redis://host:6379", s)
+	}
+
+	addr = u.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), redisPortDefault)
+	}
+	if u.User != nil {
+		username = u.User.Username()
+		password, _ = u.User.Password()
+		if password == "" {
+			// redis://secret@host is the password only
+			username, password = "", username
+		}
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if db, err = strconv.Atoi(path); err != nil || db < 0 {
+			return "", "", "", 0, false, fmt.Errorf("database of %q must be a number", s)
+		}
+	}
+	return addr, username, password, db, u.Scheme == "rediss", nil
+}
+
+// dialRedis connects to the Redis server of a URL, authenticating
+// with its password and selecting its database, if given.
+func dialRedis(rawurl string) (*redisClient, error) {
+	addr, username, password, db, useTLS, err := parseRedisURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: migrateTimeout}
+	var conn net.Conn
+	if useTLS {
+		host, _, _ := net.SplitHostPort(addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &redisClient{conn: conn, r: resp.NewReader(conn), w: resp.NewWriter(conn)}
+	switch {
+	case username != "":
+		_, err = rc.do("AUTH", username, password)
+	case password != "":
+		_, err = rc.do("AUTH", password)
+	}
+	if err == nil && db != 0 {
+		_, err = rc.do("SELECT", strconv.Itoa(db))
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return rc, nil
+}
+
+// do sends a command to Redis and returns its reply,
+// or an error if the reply is an error.
+func (rc *redisClient) do(args ...string) (interface{}, error) {
+	if err := rc.conn.SetDeadline(time.Now().Add(migrateTimeout)); err != nil {
+		return nil, err
+	}
+	rc.w.WriteCommand(args...)
+	if err := rc.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	reply, err := rc.r.ReadReply()
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := reply.(resp.Error); ok {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Close closes the connection to Redis.
+func (rc *redisClient) Close() error {
+	return rc.conn.Close()
+}
+
+// migrateRange returns the elements of the Redis list key
+// between the indexes start and stop, both included.
+func (rc *redisClient) migrateRange(key string, start, stop int) ([]string, error) {
+	reply, err := rc.do("LRANGE", key, strconv.Itoa(start), strconv.Itoa(stop))
+	if err != nil {
+		return nil, err
+	}
+	replies, _ := reply.([]interface{})
+	values := make([]string, 0, len(replies))
+	for _, r := range replies {
+		value, ok := r.(string)
+		if !ok {
+			return nil, resp.ErrProtocol
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// MigrateRedis pushes the elements of the list of the Redis server at
+// from into stack, so the head of the list is the top of the Stack, or
+// the first one popped from a queue. Elements are pushed as strings,
+// unless decodeJSON is true and they are valid JSON. If drain is true,
+// the list is renamed before being read, so new elements are kept in
+// a new list, and the migrated elements are removed from it, so it only
+// keeps the ones left if the migration fails. It returns the number of
+// migrated elements, and a pushError if they could not be pushed.
+func (c *Conn) MigrateRedis(ctx context.Context, from, list string, stack *pila.Stack, drain, decodeJSON bool) (migrated int, err error) {
+	rc, err := dialRedis(from)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	reply, err := rc.do("TYPE", list)
+	if err != nil {
+		return 0, err
+	}
+	switch reply {
+	case "none":
+		return 0, nil
+	case "list":
+	default:
+		return 0, fmt.Errorf("key %s is a %v, not a list", list, reply)
+	}
+
+	key := list
+	if drain {
+		key = list + ":piladb-migrate-" + uuid.NewRandom().String()
+		if _, err := rc.do("RENAME", list, key); err != nil {
+			return 0, err
+		}
+		defer func() {
+			if err != nil {
+				logger.Warn("elements left to migrate kept in redis", "list", key, "error", err)
+			}
+		}()
+	}
+
+	if reply, err = rc.do("LLEN", key); err != nil {
+		return 0, err
+	}
+	n, _ := reply.(int64)
+
+	// Stacks pop the last pushed element, so the list is
+	// pushed from its tail, and queues from its head.
+	fromHead := stack.Type == pila.StructureQueue
+	for migrated < int(n) {
+		count := migrateBatch
+		if left := int(n) - migrated; left < count {
+			count = left
+		}
+		start := migrated
+		switch {
+		case !fromHead:
+			start = int(n) - migrated - count
+		case drain:
+			// the migrated head was trimmed
+			start = 0
+		}
+
+		values, err := rc.migrateRange(key, start, start+count-1)
+		if err == nil && len(values) != count {
+			err = fmt.Errorf("list %s changed while migrating it", list)
+		}
+		if err != nil {
+			return migrated, err
+		}
+
+		elements := make([]interface{}, count)
+		for i, value := range values {
+			if !fromHead {
+				i = count - 1 - i
+			}
+			elements[i] = redisElement(value, decodeJSON)
+		}
+		if err := c.migratePush(ctx, stack, elements, time.Now().UTC()); err != nil {
+			return migrated, err
+		}
+		migrated += count
+
+		if drain {
+			switch {
+			case fromHead:
+				_, err = rc.do("LTRIM", key, strconv.Itoa(count), "-1")
+			case start > 0:
+				_, err = rc.do("LTRIM", key, "0", strconv.Itoa(start-1))
+			default:
+				_, err = rc.do("DEL", key)
+			}
+			if err != nil {
+				return migrated, err
+			}
+		}
+	}
+	return migrated, nil
+}
+
+// redisElement returns the element of a value of a Redis list, being
+// it decoded from JSON if decodeJSON is true and it is valid JSON.
+func redisElement(value string, decodeJSON bool) interface{} {
+	if decodeJSON {
+		var element interface{}
+		if err := json.Unmarshal([]byte(value), &element); err == nil {
+			return element
+		}
+	}
+	return value
+}
+
+// migratePush pushes the migrated elements into stack at date t and
+// persists them, returning a pushError if they could not be pushed.
+func (c *Conn) migratePush(ctx context.Context, stack *pila.Stack, elements []interface{}, t time.Time) error {
+	defer c.stackLocks.lock(stack)()
+	if s := c.Config.MaxStackSize(); s != -1 && stack.Size()+len(elements) > s {
+		return pushError{pila.ErrStackFull}
+	}
+	if err := stack.PushN(elements); err != nil {
+		return pushError{err}
+	}
+	stack.Update(t)
+	for _, element := range elements {
+		c.persistStack(ctx, stack, persist.Record{Op: persist.OpPush, Time: t, Element: element})
+	}
+	return nil
+}
+
+// migrateHandler migrates the list given by the list parameter of the
+// Redis server given by the from parameter into the Stack given by the
+// to parameter, as DATABASE/STACK, which is created along with its
+// Database if it does not exist. The drain parameter deletes the list
+// once migrated, and the json parameter decodes the elements that are
+// valid JSON. Returns 200 and the MigrateResult, 400 if the parameters
+// are not valid, 403 for tenants, 409 if the elements could not be
+// pushed, and 502 if Redis failed, along with the migrated elements.
+func (c *Conn) migrateHandler(w http.ResponseWriter, r *http.Request) {
+	if tenant := requestTenant(r); tenant != "" {
+		logResponse(r, http.StatusForbidden, "reason", "tenant can not migrate from Redis", "tenant", tenant)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	from := r.FormValue("from")
+	if _, _, _, _, _, err := parseRedisURL(from); err != nil {
+		writeError(w, r, http.StatusBadRequest, APIError{Code: "invalid_from", Message: err.Error(), Field: "from"})
+		return
+	}
+	list := r.FormValue("list")
+	if list == "" {
+		writeError(w, r, http.StatusBadRequest, APIError{Code: codeInvalidName, Message: "list must not be empty", Field: "list"})
+		return
+	}
+	database, name, err := respKey(r.FormValue("to"))
+	if err == nil {
+		if err = validateName("to", database); err == nil {
+			err = validateName("to", name)
+		}
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, APIError{Code: codeInvalidName, Message: err.Error(), Field: "to"})
+		return
+	}
+	var drain, decodeJSON bool
+	if drain, err = boolParam(r, "drain"); err == nil {
+		decodeJSON, err = boolParam(r, "json")
+	}
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	stack, err := c.respStack(database+"/"+name, true, requestDate(r))
+	if err != nil {
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if !c.checkLock(w, r, stack) {
+		return
+	}
+
+	result := MigrateResult{
+		From:     redactURL(from),
+		List:     list,
+		Database: database,
+		Stack:    stack.Name,
+		Drained:  drain,
+	}
+	result.Migrated, err = c.MigrateRedis(r.Context(), from, list, stack, drain, decodeJSON)
+	code := http.StatusOK
+	switch err.(type) {
+	case nil:
+		logger.Info("migrated redis list", "from", result.From, "list", list, "database", database, "stack", stack.Name, "count", result.Migrated)
+	case pushError:
+		code = http.StatusConflict
+	default:
+		code = http.StatusBadGateway
+	}
+	if err != nil {
+		result.Drained = false
+		logResponse(r, code, "error", err)
+	} else {
+		logResponse(r, code)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(result.ToJSON())
+}
@@ -0,0 +1,283 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/resp"
+)
+
+// fakeRedis is a Redis server for testing, serving
+// the commands on lists needed by a migration.
+type fakeRedis struct {
+	password string
+	mu       sync.Mutex
+	lists    map[string][]string
+	ln       net.Listener
+}
+
+// newFakeRedis starts a fakeRedis with the given lists,
+// requiring password if not empty.
+func newFakeRedis(t *testing.T, password string, lists map[string][]string) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{password: password, lists: lists, ln: ln}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(nc)
+		}
+	}()
+	return f
+}
+
+// url returns the URL of the fakeRedis with the given credentials.
+func (f *fakeRedis) url(userinfo string) string {
+	if userinfo != "" {
+		userinfo += "@"
+	}
+	return "redis://" + userinfo + f.ln.Addr().String()
+}
+
+// index returns the index of a list of length n given
+// by a Redis index i, which is negative from the tail.
+func index(i string, n int) int {
+	idx, _ := strconv.Atoi(i)
+	if idx < 0 {
+		idx += n
+	}
+	return idx
+}
+
+func (f *fakeRedis) serve(nc net.Conn) {
+	defer nc.Close()
+	r, w := resp.NewReader(nc), resp.NewWriter(nc)
+	authenticated := f.password == ""
+	for {
+		args, err := r.ReadCommand()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		var list []string
+		var exists bool
+		if len(args) > 1 {
+			list, exists = f.lists[args[1]]
+		}
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			authenticated = args[len(args)-1] == f.password
+			if authenticated {
+				w.WriteSimple("OK")
+			} else {
+				w.WriteError("WRONGPASS invalid password")
+			}
+		case !authenticated:
+			w.WriteError("NOAUTH Authentication required.")
+		case cmd == "SELECT":
+			w.WriteSimple("OK")
+		case cmd == "TYPE" && args[1] == "string":
+			w.WriteSimple("string")
+		case cmd == "TYPE" && exists:
+			w.WriteSimple("list")
+		case cmd == "TYPE":
+			w.WriteSimple("none")
+		case cmd == "RENAME":
+			f.lists[args[2]] = list
+			delete(f.lists, args[1])
+			w.WriteSimple("OK")
+		case cmd == "LLEN":
+			w.WriteInt(int64(len(list)))
+		case cmd == "LRANGE":
+			start, stop := index(args[2], len(list)), index(args[3], len(list))
+			w.WriteArray(stop - start + 1)
+			for _, value := range list[start : stop+1] {
+				w.WriteBulk([]byte(value))
+			}
+		case cmd == "LTRIM":
+			start, stop := index(args[2], len(list)), index(args[3], len(list))
+			if start > stop {
+				delete(f.lists, args[1])
+			} else {
+				f.lists[args[1]] = list[start : stop+1]
+			}
+			w.WriteSimple("OK")
+		case cmd == "DEL":
+			delete(f.lists, args[1])
+			w.WriteInt(1)
+		default:
+			w.WriteError("ERR unknown command")
+		}
+		f.mu.Unlock()
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func TestParseRedisURL(t *testing.T) {
+	inputOutput := []struct {
+		input                    string
+		addr, username, password string
+		db                       int
+		useTLS                   bool
+		valid                    bool
+	}{
+		{"redis://localhost", "localhost:6379", "", "", 0, false, true},
+		{"redis://:secret@localhost:6380/2", "localhost:6380", "", "secret", 2, false, true},
+		{"redis://secret@localhost", "localhost:6379", "", "secret", 0, false, true},
+		{"rediss://user:secret@[::1]", "[::1]:6379", "user", "secret", 0, true, true},
+		{"", "", "", "", 0, false, false},
+		{"http://localhost", "", "", "", 0, false, false},
+		{"redis:///0", "", "", "", 0, false, false},
+		{"redis://localhost/foo", "", "", "", 0, false, false},
+	}
+
+	for _, io := range inputOutput {
+		addr, username, password, db, useTLS, err := parseRedisURL(io.input)
+		if (err == nil) != io.valid {
+			t.Errorf("err is %v for %q, expected valid %v", err, io.input, io.valid)
+			continue
+		}
+		if addr != io.addr || username != io.username || password != io.password || db != io.db || useTLS != io.useTLS {
+			t.Errorf("%q is parsed as %s %s %s %d %v", io.input, addr, username, password, db, useTLS)
+		}
+	}
+}
+
+func TestMigrateHandler(t *testing.T) {
+	values := make([]string, migrateBatch+2)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+	}
+	redis := newFakeRedis(t, "secret", map[string][]string{
+		"jobs":   values,
+		"events": {`{"id":1}`, "foo"},
+	})
+	defer redis.ln.Close()
+
+	conn := NewConn()
+	queue := pila.NewQueue("queue", time.Now().UTC())
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	_ = db.AddStack(queue)
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		params string
+		code   int
+		output MigrateResult
+	}{
+		{"from=foo&list=jobs&to=db/jobs", http.StatusBadRequest, MigrateResult{}},
+		{"from=" + redis.url(":secret") + "&to=db/jobs", http.StatusBadRequest, MigrateResult{}},
+		{"from=" + redis.url(":secret") + "&list=jobs&to=jobs", http.StatusBadRequest, MigrateResult{}},
+		{"from=" + redis.url(":secret") + "&list=jobs&to=db/:jobs", http.StatusBadRequest, MigrateResult{}},
+		{"from=" + redis.url(":secret") + "&list=jobs&to=db/jobs&drain=foo", http.StatusBadRequest, MigrateResult{}},
+		{"from=" + redis.url(":wrong") + "&list=jobs&to=db/jobs", http.StatusBadGateway, MigrateResult{}},
+		{"from=" + redis.url(":secret") + "&list=string&to=db/jobs", http.StatusBadGateway, MigrateResult{}},
+		{"from=" + redis.url(":secret") + "&list=missing&to=db/missing", http.StatusOK, MigrateResult{List: "missing", Database: "db", Stack: "missing"}},
+		{"from=" + redis.url(":secret") + "&list=jobs&to=db/jobs", http.StatusOK, MigrateResult{List: "jobs", Database: "db", Stack: "jobs", Migrated: len(values)}},
+		{"from=" + redis.url(":secret") + "&list=jobs&to=db/queue&drain=true", http.StatusOK, MigrateResult{List: "jobs", Database: "db", Stack: "queue", Migrated: len(values), Drained: true}},
+		{"from=" + redis.url(":secret") + "&list=events&to=other/events&json=true&drain=true", http.StatusOK, MigrateResult{List: "events", Database: "other", Stack: "events", Migrated: 2, Drained: true}},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("POST", "/_migrate?"+io.params, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, io.params)
+		}
+		if io.code != http.StatusOK {
+			continue
+		}
+		var result MigrateResult
+		if err := json.Unmarshal(response.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		result.From = ""
+		if result != io.output {
+			t.Errorf("result is %v, expected %v for %s", result, io.output, io.params)
+		}
+	}
+
+	// the head of the list is the first element popped
+	jobs, _ := ResourceStack(db, "jobs")
+	for _, s := range []*pila.Stack{jobs, queue} {
+		if value, ok := s.Pop(); !ok || value != "0" {
+			t.Errorf("%s pops %v, expected %v", s.Name, value, "0")
+		}
+		if value, ok := s.Pop(); !ok || value != "1" {
+			t.Errorf("%s pops %v, expected %v", s.Name, value, "1")
+		}
+		if s.Size() != len(values)-2 {
+			t.Errorf("%s size is %d, expected %d", s.Name, s.Size(), len(values)-2)
+		}
+	}
+
+	other, _ := ResourceDatabase(conn, "other")
+	events, _ := ResourceStack(other, "events")
+	if value, _ := events.Pop(); !reflect.DeepEqual(value, map[string]interface{}{"id": 1.0}) {
+		t.Errorf("events pops %v, expected %v", value, map[string]interface{}{"id": 1.0})
+	}
+	if value, _ := events.Pop(); value != "foo" {
+		t.Errorf("events pops %v, expected %v", value, "foo")
+	}
+
+	redis.mu.Lock()
+	defer redis.mu.Unlock()
+	if len(redis.lists) != 0 {
+		t.Errorf("redis lists are %v, expected drained", redis.lists)
+	}
+}
+
+func TestMigrateHandler_Full(t *testing.T) {
+	redis := newFakeRedis(t, "", map[string][]string{"jobs": {"foo", "bar"}})
+	defer redis.ln.Close()
+
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	_ = db.AddStack(pila.NewStackWithLimit("jobs", time.Now().UTC(), 1, pila.OverflowReject))
+
+	request, err := http.NewRequest("POST", "/_migrate?list=jobs&to=db/jobs&drain=true&from="+redis.url(""), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+
+	if response.Code != http.StatusConflict {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusConflict)
+	}
+
+	// elements left to migrate are kept in redis
+	redis.mu.Lock()
+	defer redis.mu.Unlock()
+	if len(redis.lists) != 1 {
+		t.Errorf("redis lists are %v, expected %d", redis.lists, 1)
+	}
+	for key, list := range redis.lists {
+		if !strings.HasPrefix(key, "jobs:piladb-migrate-") || !reflect.DeepEqual(list, []string{"foo", "bar"}) {
+			t.Errorf("redis list %s is %v, expected %v", key, list, []string{"foo", "bar"})
+		}
+	}
+}
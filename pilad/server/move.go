@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+)
+
+// destinationDatabase returns the to_database parameter of a request
+// moving, copying or transferring elements of a Stack, given either in
+// its query or in its form-encoded body, as its handler reads it. It is
+// empty for any other request, whose body is left unread.
+func destinationDatabase(r *http.Request) string {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segments) != 5 || segments[0] != "databases" || segments[2] != "stacks" {
+		return ""
+	}
+	switch segments[4] {
+	case "_move", "_copy", "_transfer":
+		return r.FormValue("to_database")
+	}
+	return ""
+}
+
+// moveStackHandler moves up to count elements from the top of the
+// Stack into the destination Stack, see transferStackHandler.
+func (c *Conn) moveStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	c.transferStackHandler(w, r, stack, persist.OpMove)
+}
+
+// copyStackHandler copies up to count elements from the top of the
+// Stack into the destination Stack, see transferStackHandler.
+func (c *Conn) copyStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	c.transferStackHandler(w, r, stack, persist.OpCopy)
+}
+
+// transferStackHandler moves or copies, depending on op, up to count
+// elements from the top of the Stack into the Stack given by the to
+// parameter, which belongs to the Database given by to_database, or
+// to the same Database if omitted. The elements keep the order they
+// are popped in. It returns 200 and the transferred elements, from
+// top to bottom, or 409 if none could be pushed into the destination.
+func (c *Conn) transferStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack, op persist.Op) {
+	now := requestDate(r)
+	count, err := intParam(r, "count", 1, math.MaxInt32)
+	if err == nil && r.FormValue("to") == "" {
+		err = fmt.Errorf("missing destination stack")
+	}
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	db := databaseFromContext(r)
+	if name := destinationDatabase(r); name != "" {
+		var ok bool
+		if db, ok = ResourceDatabase(c, name); !ok {
+			c.goneHandler(w, r, fmt.Sprintf("database %s is Gone", name))
+			return
+		}
+	}
+	dst, ok := ResourceStack(db, r.FormValue("to"))
+	if !ok {
+		c.goneHandler(w, r, fmt.Sprintf("stack %s is Gone", r.FormValue("to")))
+		return
+	}
+	if !c.checkLock(w, r, dst) {
+		return
+	}
+
+	n := count
+	if size := stack.Size(); size < n {
+		n = size
+	}
+	if s := c.Config.MaxStackSize(); s != -1 && dst.Size()+n > s {
+		logResponse(r, http.StatusNotAcceptable, "reason", "value reached", "config", vars.MaxStackSize)
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	transfer := stack.MoveTo
+	if op == persist.OpCopy {
+		transfer = stack.CopyTo
+	}
+	defer c.stackLocks.lock(stack, dst)()
+	elements, err := transfer(dst, count)
+	switch {
+	case err == pila.ErrSameStack:
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	case err == pila.ErrElementTooLarge:
+		c.tooLargeHandler(w, r, err)
+		return
+	case err == pila.ErrMemoryLimit:
+		c.memoryLimitHandler(w, r, err)
+		return
+	case err != nil:
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	if len(elements) > 0 {
+		if op == persist.OpMove {
+			stack.Update(now)
+		}
+		dst.Update(now)
+		c.persistStack(r.Context(), stack, persist.Record{Op: op, Time: now, ToDatabase: db.Name, ToStack: dst.Name, Count: len(elements)})
+	}
+
+	logResponse(r, http.StatusOK, "elements", len(elements))
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as we consider our elements
+	// suitable for a JSON encoding.
+	b, _ := json.Marshal(Elements{Values: elements})
+	w.Write(b)
+}
+
+// popushHandler pops the element on top of the Stack given by the from
+// parameter and pushes it into the Stack given by the to parameter, both
+// of the Database, as a single operation, see pila.Stack.PopPush. It
+// returns 200 and the element, 204 if the source Stack is empty, or 409
+// if the element could not be pushed, in which case it is put back.
+func (c *Conn) popushHandler(w http.ResponseWriter, r *http.Request) {
+	r = withDate(r)
+	now := requestDate(r)
+	db := databaseFromContext(r)
+
+	from, to := r.FormValue("from"), r.FormValue("to")
+	if from == "" || to == "" {
+		logResponse(r, http.StatusBadRequest, "reason", "missing source or destination stack")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var stacks [2]*pila.Stack
+	for i, id := range []string{from, to} {
+		stack, ok := ResourceStack(db, id)
+		if !ok {
+			c.goneHandler(w, r, fmt.Sprintf("stack %s is Gone", id))
+			return
+		}
+		if !c.checkLock(w, r, stack) {
+			return
+		}
+		stacks[i] = stack
+	}
+	src, dst := stacks[0], stacks[1]
+
+	if s := c.Config.MaxStackSize(); s != -1 && dst.Size() >= s {
+		logResponse(r, http.StatusNotAcceptable, "reason", "value reached", "config", vars.MaxStackSize)
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	defer c.stackLocks.lock(src, dst)()
+	element, err := src.PopPush(dst)
+	switch {
+	case err == pila.ErrEmptyStack:
+		logResponse(r, http.StatusNoContent)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case err == pila.ErrSameStack:
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	case err == pila.ErrElementTooLarge:
+		c.tooLargeHandler(w, r, err)
+		return
+	case err == pila.ErrMemoryLimit:
+		c.memoryLimitHandler(w, r, err)
+		return
+	case err != nil:
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	src.Update(now)
+	dst.Update(now)
+	c.persistStack(r.Context(), src, persist.Record{Op: persist.OpMove, Time: now, ToDatabase: db.Name, ToStack: dst.Name, Count: 1})
+
+	c.writeElement(w, r, element)
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestTransferStackHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	other := pila.NewDatabase("other")
+	_ = conn.Pila.AddDatabase(other)
+	src := pila.NewStack("src", time.Now().UTC())
+	_ = db.AddStack(src)
+	dst := pila.NewStack("dst", time.Now().UTC())
+	_ = db.AddStack(dst)
+	queue := pila.NewQueue("queue", time.Now().UTC())
+	_ = other.AddStack(queue)
+	_ = src.PushN([]interface{}{"foo", "bar", "baz"})
+
+	inputOutput := []struct {
+		path     string
+		code     int
+		response string
+		sizes    [3]int
+	}{
+		{"_move", http.StatusBadRequest, "", [3]int{3, 0, 0}},
+		{"_move?to=dst&count=0", http.StatusBadRequest, "", [3]int{3, 0, 0}},
+		{"_move?to=src", http.StatusBadRequest, "", [3]int{3, 0, 0}},
+		{"_move?to=foo", http.StatusGone, "", [3]int{3, 0, 0}},
+		{"_move?to=queue&to_database=foo", http.StatusGone, "", [3]int{3, 0, 0}},
+		{"_move?to=dst&count=2", http.StatusOK, `{"elements":["baz","bar"]}`, [3]int{1, 2, 0}},
+		{"_copy?to=queue&to_database=other&count=5", http.StatusOK, `{"elements":["foo"]}`, [3]int{1, 2, 1}},
+		{"_move?to=dst", http.StatusOK, `{"elements":["foo"]}`, [3]int{0, 3, 1}},
+		{"_move?to=dst", http.StatusOK, `{"elements":[]}`, [3]int{0, 3, 1}},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("POST", "/databases/db/stacks/src/"+io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, io.path)
+		}
+		if io.response != "" && response.Body.String() != io.response {
+			t.Errorf("response is %s, expected %s for %s", response.Body, io.response, io.path)
+		}
+		if sizes := [3]int{src.Size(), dst.Size(), queue.Size()}; sizes != io.sizes {
+			t.Errorf("stack sizes are %v, expected %v for %s", sizes, io.sizes, io.path)
+		}
+	}
+
+	if elements := dst.Elements(0, 10); !reflect.DeepEqual(elements, []interface{}{"foo", "baz", "bar"}) {
+		t.Errorf("elements are %v, expected %v", elements, []interface{}{"foo", "baz", "bar"})
+	}
+}
+
+func TestTransferStackHandler_MaxStackSize(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set(vars.MaxStackSize, 2)
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	src := pila.NewStack("src", time.Now().UTC())
+	_ = db.AddStack(src)
+	dst := pila.NewStack("dst", time.Now().UTC())
+	_ = db.AddStack(dst)
+	_ = src.PushN([]interface{}{"foo", "bar"})
+	_ = dst.Push("baz")
+
+	request, _ := http.NewRequest("POST", "/databases/db/stacks/src/_copy?to=dst&count=2", nil)
+	response := httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+
+	if response.Code != http.StatusNotAcceptable {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusNotAcceptable)
+	}
+	if src.Size() != 2 || dst.Size() != 1 {
+		t.Errorf("stack sizes are %d and %d, expected %d and %d", src.Size(), dst.Size(), 2, 1)
+	}
+}
+
+func TestPopushHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	src := pila.NewQueue("src", time.Now().UTC())
+	_ = db.AddStack(src)
+	dst := pila.NewStack("dst", time.Now().UTC())
+	_ = db.AddStack(dst)
+	full := pila.NewStackWithLimit("full", time.Now().UTC(), 1, pila.OverflowReject)
+	_ = db.AddStack(full)
+	_ = src.PushN([]interface{}{"foo", "bar"})
+	_ = full.Push("baz")
+
+	inputOutput := []struct {
+		path     string
+		code     int
+		response string
+		sizes    [3]int
+	}{
+		{"/databases/db/_popush", http.StatusBadRequest, "", [3]int{2, 0, 1}},
+		{"/databases/db/_popush?from=src", http.StatusBadRequest, "", [3]int{2, 0, 1}},
+		{"/databases/db/_popush?from=src&to=src", http.StatusBadRequest, "", [3]int{2, 0, 1}},
+		{"/databases/db/_popush?from=src&to=foo", http.StatusGone, "", [3]int{2, 0, 1}},
+		{"/databases/nodb/_popush?from=src&to=dst", http.StatusGone, "", [3]int{2, 0, 1}},
+		{"/databases/db/_popush?from=src&to=full", http.StatusConflict, "", [3]int{2, 0, 1}},
+		{"/databases/db/_popush?from=src&to=dst", http.StatusOK, `{"element":"foo"}`, [3]int{1, 1, 1}},
+		{"/databases/db/_popush?from=src&to=dst", http.StatusOK, `{"element":"bar"}`, [3]int{0, 2, 1}},
+		{"/databases/db/_popush?from=src&to=dst", http.StatusNoContent, "", [3]int{0, 2, 1}},
+		{"/databases/db/_popush?from=dst&to=src", http.StatusOK, `{"element":"bar"}`, [3]int{1, 1, 1}},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("POST", io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, io.path)
+		}
+		if io.response != "" && response.Body.String() != io.response {
+			t.Errorf("response is %s, expected %s for %s", response.Body, io.response, io.path)
+		}
+		if sizes := [3]int{src.Size(), dst.Size(), full.Size()}; sizes != io.sizes {
+			t.Errorf("stack sizes are %v, expected %v for %s", sizes, io.sizes, io.path)
+		}
+	}
+
+	if elements := src.Elements(0, 10); !reflect.DeepEqual(elements, []interface{}{"bar"}) {
+		t.Errorf("elements are %v, expected %v", elements, []interface{}{"bar"})
+	}
+}
+
+func TestPopushHandler_MaxStackSize(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set(vars.MaxStackSize, 1)
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	src := pila.NewStack("src", time.Now().UTC())
+	_ = db.AddStack(src)
+	dst := pila.NewStack("dst", time.Now().UTC())
+	_ = db.AddStack(dst)
+	_ = src.Push("foo")
+	_ = dst.Push("bar")
+
+	request, _ := http.NewRequest("POST", "/databases/db/_popush?from=src&to=dst", nil)
+	response := httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+
+	if response.Code != http.StatusNotAcceptable {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusNotAcceptable)
+	}
+	if src.Size() != 1 || dst.Size() != 1 {
+		t.Errorf("stack sizes are %d and %d, expected %d and %d", src.Size(), dst.Size(), 1, 1)
+	}
+}
@@ -0,0 +1,298 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// openAPIVersion is the version of the OpenAPI
+// specification the document of pilad follows.
+const openAPIVersion = "3.0.0"
+
+// openAPIMethods are the methods looked up on every route
+// when generating the OpenAPI document.
+var openAPIMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+// openAPIPathParam matches the variables of a route path template.
+var openAPIPathParam = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+// openAPIOperation describes an operation of a route, keyed
+// by method and path template in openAPIOperations.
+type openAPIOperation struct {
+	summary string
+	// body is the content type of the request body, if any
+	body string
+}
+
+// openAPIOperations contains the description of every operation
+// served by the Router. Operations missing here are still part of the
+// document, as it is derived from the routes, but without summary.
+var openAPIOperations = map[string]openAPIOperation{
+	"GET /":                      {summary: "Redirect to the pilad documentation"},
+	"GET /_status":               {summary: "Get the status of pilad"},
+	"GET /_status/stream":        {summary: "Stream the status of pilad as Server-Sent Events"},
+	"GET /_health":               {summary: "Get whether pilad is alive"},
+	"GET /_ready":                {summary: "Get whether pilad is ready to serve requests"},
+	"GET /_ops":                  {summary: "Get the number of operations served and the operations in flight"},
+	"DELETE /_ops/{op_id}":       {summary: "Cancel an operation in flight"},
+	"GET /metrics":               {summary: "Get the metrics of pilad in the Prometheus format"},
+	"GET /_peers":                {summary: "Get the peers of pilad"},
+	"POST /_benchmark":           {summary: "Run a benchmark of pushes and pops on a stack"},
+	"GET /_changelog":            {summary: "Get the changelog of piladb"},
+	"GET /_ui":                   {summary: "Get the web UI of pilad"},
+	"GET /_features":             {summary: "Get the feature flags"},
+	"GET /_templates":            {summary: "List the stack templates"},
+	"GET /_acl":                  {summary: "Get the network access rules"},
+	"PUT /_acl":                  {summary: "Replace the network access rules", body: "application/json"},
+	"GET /_encryption":           {summary: "List the IDs of the encryption keys"},
+	"POST /_encryption/rotate":   {summary: "Add an encryption key as the current one", body: "application/json"},
+	"GET /_audit":                {summary: "List the most recent requests modifying pilad"},
+	"POST /_shutdown":            {summary: "Shut pilad down gracefully"},
+	"GET /_limits":               {summary: "Get the global limits"},
+	"PUT /_limits":               {summary: "Change the global limits", body: "application/json"},
+	"GET /_read_only":            {summary: "Get whether pilad is in read-only mode"},
+	"PUT /_read_only":            {summary: "Enable or disable the read-only mode"},
+	"GET /_debug":                {summary: "Get whether the debug endpoints are enabled"},
+	"PUT /_debug":                {summary: "Enable or disable the debug endpoints"},
+	"GET /debug/pprof/":          {summary: "List the pprof profiles of pilad"},
+	"GET /debug/pprof/cmdline":   {summary: "Get the command line of pilad"},
+	"GET /debug/pprof/profile":   {summary: "Profile the CPU of pilad"},
+	"GET /debug/pprof/symbol":    {summary: "Look up program counters of pilad"},
+	"GET /debug/pprof/trace":     {summary: "Trace the execution of pilad"},
+	"GET /debug/pprof/{profile}": {summary: "Get a named pprof profile of pilad, e.g. heap"},
+	"GET /debug/vars":            {summary: "Get the expvar variables of pilad"},
+	"GET /_replication":          {summary: "Stream a snapshot and the operations modifying the Pila"},
+	"POST /_promote":             {summary: "Promote a follower to primary"},
+	"GET /_cluster":              {summary: "Get the status of the cluster"},
+	"POST /_cluster/join":        {summary: "Add a node to the cluster"},
+	"POST /_cluster/leave":       {summary: "Remove a node from the cluster"},
+	"PUT /_cluster/nodes":        {summary: "Replace the nodes of the cluster", body: "application/json"},
+	"GET /_raft":                 {summary: "Get the status of the Raft node"},
+	"POST /_raft/vote":           {summary: "Request the vote of a Raft node", body: "application/json"},
+	"POST /_raft/append":         {summary: "Append entries to the log of a Raft node", body: "application/json"},
+	"POST /_snapshot":            {summary: "Take a snapshot of the Pila"},
+	"GET /_snapshots":            {summary: "List the snapshots kept in the snapshot directory"},
+	"POST /_snapshots":           {summary: "Take a snapshot into the snapshot directory"},
+	"POST /_compact":             {summary: "Compact the persistence log into a snapshot"},
+	"POST /_restore":             {summary: "Restore the Pila from a snapshot", body: "application/json"},
+	"POST /_provision":           {summary: "Create and optionally prune databases and stacks to match a manifest", body: "application/json"},
+	"POST /_migrate":             {summary: "Migrate a Redis list into a stack"},
+	"GET /_trash":                {summary: "List the deleted databases and stacks kept in the trash"},
+	"POST /_trash/{id}/restore":  {summary: "Restore a database or stack from the trash"},
+	"DELETE /_trash/{id}":        {summary: "Purge a database or stack from the trash"},
+	"GET /_config":               {summary: "Get the config values"},
+	"GET /_config/{key}":         {summary: "Get a config value"},
+	"POST /_config/{key}":        {summary: "Set a config value", body: "application/json"},
+	"PUT /_config/{key}":         {summary: "Set a config value", body: "application/json"},
+	"GET /_tokens":               {summary: "Get the API tokens"},
+	"POST /_tokens":              {summary: "Add an API token", body: "application/json"},
+	"DELETE /_tokens/{token}":    {summary: "Delete an API token"},
+	"GET /_tenants":              {summary: "Get the tenants and their quotas"},
+	"POST /_tenants":             {summary: "Add a tenant with its quotas", body: "application/json"},
+	"DELETE /_tenants/{tenant}":  {summary: "Delete a tenant"},
+	"GET /_remotes":              {summary: "Get the mounted remote databases"},
+	"GET /_openapi.json":         {summary: "Get this OpenAPI document"},
+
+	"GET /databases":                                 {summary: "Get the status of the databases"},
+	"PUT /databases":                                 {summary: "Create a database, or mount a remote one"},
+	"GET /databases/{database_id}":                   {summary: "Get the status of a database"},
+	"DELETE /databases/{database_id}":                {summary: "Delete a database"},
+	"DELETE /databases/{database_id}/_flush":         {summary: "Flush every stack of a database"},
+	"PATCH /databases/{database_id}":                 {summary: "Rename a database", body: "application/json"},
+	"GET /databases/{database_id}/stacks":            {summary: "Get the status of the stacks of a database"},
+	"PUT /databases/{database_id}/stacks":            {summary: "Create a stack"},
+	"GET /databases/{database_id}/_stats":            {summary: "Get the statistics of a database and its stacks"},
+	"POST /databases/{database_id}/_transaction":     {summary: "Apply a transaction on the stacks of a database", body: "application/json"},
+	"POST /databases/{database_id}/_popush":          {summary: "Pop the top of a stack and push it into another one"},
+	"DELETE /databases/{database_id}/_popany":        {summary: "Pop the top of the first non-empty stack of several ones"},
+	"GET /databases/{database_id}/_keys":             {summary: "Get the API keys of a database"},
+	"POST /databases/{database_id}/_keys":            {summary: "Mint an API key confined to a database"},
+	"DELETE /databases/{database_id}/_keys/{key_id}": {summary: "Revoke an API key of a database"},
+
+	"GET /databases/{database_id}/stacks/{stack_id}":                         {summary: "Get the status of a stack"},
+	"POST /databases/{database_id}/stacks/{stack_id}":                        {summary: "Push an element into a stack", body: "application/json"},
+	"DELETE /databases/{database_id}/stacks/{stack_id}":                      {summary: "Pop, flush or delete a stack"},
+	"PATCH /databases/{database_id}/stacks/{stack_id}":                       {summary: "Rename a stack", body: "application/json"},
+	"GET /databases/{database_id}/stacks/{stack_id}/peek":                    {summary: "Peek the element on top of a stack"},
+	"GET /databases/{database_id}/stacks/{stack_id}/size":                    {summary: "Get the size of a stack"},
+	"DELETE /databases/{database_id}/stacks/{stack_id}/pop":                  {summary: "Pop the element on top of a stack"},
+	"DELETE /databases/{database_id}/stacks/{stack_id}/flush":                {summary: "Flush a stack"},
+	"GET /databases/{database_id}/stacks/{stack_id}/elements":                {summary: "Get a page of the elements of a stack"},
+	"GET /databases/{database_id}/stacks/{stack_id}/_search":                 {summary: "Search the elements of a stack"},
+	"POST /databases/{database_id}/stacks/{stack_id}/_undo":                  {summary: "Undo the last pop of a stack"},
+	"GET /databases/{database_id}/stacks/{stack_id}/_history":                {summary: "Get the elements popped from a stack"},
+	"POST /databases/{database_id}/stacks/{stack_id}/_archive":               {summary: "Archive a stack into cold storage"},
+	"POST /databases/{database_id}/stacks/{stack_id}/_unarchive":             {summary: "Restore an archived stack"},
+	"POST /databases/{database_id}/stacks/{stack_id}/_lock":                  {summary: "Lock a stack for an owner"},
+	"POST /databases/{database_id}/stacks/{stack_id}/_unlock":                {summary: "Unlock a stack"},
+	"GET /databases/{database_id}/stacks/{stack_id}/_groups":                 {summary: "Get the consumer groups of a stack"},
+	"PUT /databases/{database_id}/stacks/{stack_id}/_groups":                 {summary: "Add a consumer group to a stack"},
+	"DELETE /databases/{database_id}/stacks/{stack_id}/_groups/{group}":      {summary: "Remove a consumer group, pushing back its pending elements"},
+	"DELETE /databases/{database_id}/stacks/{stack_id}/_groups/{group}/pop":  {summary: "Pop an element for a consumer of a group"},
+	"POST /databases/{database_id}/stacks/{stack_id}/_groups/{group}/_ack":   {summary: "Acknowledge an element pending in a group"},
+	"GET /databases/{database_id}/stacks/{stack_id}/_groups/{group}/pending": {summary: "Get the elements pending in a group"},
+	"GET /databases/{database_id}/stacks/{stack_id}/_dead_letter":            {summary: "Get the dead-letter stack of a stack"},
+	"PUT /databases/{database_id}/stacks/{stack_id}/_dead_letter":            {summary: "Set the dead-letter stack of a stack"},
+	"POST /databases/{database_id}/stacks/{stack_id}/rotate":                 {summary: "Rotate the elements of a stack"},
+	"GET /databases/{database_id}/stacks/{stack_id}/base":                    {summary: "Get the element at the bottom of a stack"},
+	"DELETE /databases/{database_id}/stacks/{stack_id}/sweep":                {summary: "Remove the expired elements of a stack"},
+	"POST /databases/{database_id}/stacks/{stack_id}/_reverse":               {summary: "Reverse the order of the elements of a stack"},
+	"POST /databases/{database_id}/stacks/{stack_id}/_sort":                  {summary: "Sort the elements of a stack"},
+	"POST /databases/{database_id}/stacks/{stack_id}/_bulk":                  {summary: "Push several elements into a stack", body: "application/json"},
+	"DELETE /databases/{database_id}/stacks/{stack_id}/_bulk":                {summary: "Pop several elements from a stack"},
+	"POST /databases/{database_id}/stacks/{stack_id}/_move":                  {summary: "Move elements into another stack"},
+	"POST /databases/{database_id}/stacks/{stack_id}/_copy":                  {summary: "Copy elements into another stack"},
+	"POST /databases/{database_id}/stacks/{stack_id}/_transfer":              {summary: "Transfer a stack to another database"},
+	"GET /databases/{database_id}/stacks/{stack_id}/_export":                 {summary: "Export the elements of a stack as NDJSON"},
+	"PUT /databases/{database_id}/stacks/{stack_id}/_import":                 {summary: "Import NDJSON elements into a stack", body: "application/x-ndjson"},
+	"GET /databases/{database_id}/stacks/{stack_id}/_subscribe":              {summary: "Stream the events of a stack"},
+	"GET /databases/{database_id}/stacks/{stack_id}/_window":                 {summary: "Get the time window of a stack"},
+	"PUT /databases/{database_id}/stacks/{stack_id}/_window":                 {summary: "Set the time window flushing a stack on a schedule"},
+	"GET /databases/{database_id}/stacks/{stack_id}/_watermarks":             {summary: "Get the size watermarks of a stack"},
+	"PUT /databases/{database_id}/stacks/{stack_id}/_watermarks":             {summary: "Set the size watermarks alerted on a stack"},
+	"GET /databases/{database_id}/stacks/{stack_id}/_hooks":                  {summary: "List the webhooks of a stack"},
+	"PUT /databases/{database_id}/stacks/{stack_id}/_hooks":                  {summary: "Register a webhook called with the events of a stack"},
+	"GET /databases/{database_id}/stacks/{stack_id}/_hooks/{hook_id}":        {summary: "Get the delivery status of a webhook"},
+	"DELETE /databases/{database_id}/stacks/{stack_id}/_hooks/{hook_id}":     {summary: "Remove a webhook"},
+}
+
+// OpenAPI represents an OpenAPI 3 document describing the routes of pilad.
+type OpenAPI struct {
+	OpenAPI string                                 `json:"openapi"`
+	Info    OpenAPIInfo                            `json:"info"`
+	Paths   map[string]map[string]OpenAPIOperation `json:"paths"`
+}
+
+// OpenAPIInfo contains the metadata of an OpenAPI document.
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenAPIOperation describes a method of a path of an OpenAPI document.
+type OpenAPIOperation struct {
+	Summary     string                     `json:"summary,omitempty"`
+	OperationID string                     `json:"operationId"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter describes a path parameter of an operation.
+type OpenAPIParameter struct {
+	Name     string            `json:"name"`
+	In       string            `json:"in"`
+	Required bool              `json:"required"`
+	Schema   map[string]string `json:"schema"`
+}
+
+// OpenAPIRequestBody describes the body of the request of an operation,
+// whose schema is left open as elements can be any JSON value.
+type OpenAPIRequestBody struct {
+	Content map[string]map[string]interface{} `json:"content"`
+}
+
+// OpenAPIResponse describes a response of an operation.
+type OpenAPIResponse struct {
+	Description string `json:"description"`
+}
+
+// NewOpenAPI returns the OpenAPI document of the routes of router,
+// which are looked up for every method in openAPIMethods.
+func NewOpenAPI(router *mux.Router, version string) *OpenAPI {
+	doc := &OpenAPI{
+		OpenAPI: openAPIVersion,
+		Info:    OpenAPIInfo{Title: "piladb", Version: version},
+		Paths:   make(map[string]map[string]OpenAPIOperation),
+	}
+
+	_ = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		path := openAPIPathParam.ReplaceAllString(template, "{$1}")
+		for _, method := range openAPIMethods {
+			if !routeMatches(route, method, template) {
+				continue
+			}
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = make(map[string]OpenAPIOperation)
+			}
+			doc.Paths[path][strings.ToLower(method)] = newOpenAPIOperation(method, path)
+		}
+		return nil
+	})
+	return doc
+}
+
+// routeMatches determines whether route serves requests with
+// method to a path following template.
+func routeMatches(route *mux.Route, method, template string) bool {
+	url := openAPIPathParam.ReplaceAllString(template, "$1")
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return false
+	}
+	return route.Match(request, &mux.RouteMatch{})
+}
+
+// newOpenAPIOperation returns the description
+// of the method of a path.
+func newOpenAPIOperation(method, path string) OpenAPIOperation {
+	operation := openAPIOperations[method+" "+path]
+	op := OpenAPIOperation{
+		Summary:     operation.summary,
+		OperationID: openAPIOperationID(method, path),
+		Responses: map[string]OpenAPIResponse{
+			"default": {Description: "See the pilad README for the status codes"},
+		},
+	}
+	for _, match := range openAPIPathParam.FindAllStringSubmatch(path, -1) {
+		op.Parameters = append(op.Parameters, OpenAPIParameter{
+			Name:     match[1],
+			In:       "path",
+			Required: true,
+			Schema:   map[string]string{"type": "string"},
+		})
+	}
+	if operation.body != "" {
+		op.RequestBody = &OpenAPIRequestBody{
+			Content: map[string]map[string]interface{}{
+				operation.body: {"schema": map[string]interface{}{}},
+			},
+		}
+	}
+	return op
+}
+
+// openAPIOperationID returns a unique identifier of the method of a
+// path, like getDatabasesDatabaseIdStacks for GET /databases/{database_id}/stacks.
+func openAPIOperationID(method, path string) string {
+	id := strings.ToLower(method)
+	words := strings.FieldsFunc(path, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	for _, word := range words {
+		id += strings.ToUpper(word[:1]) + word[1:]
+	}
+	return id
+}
+
+// openAPIHandler returns a handler writing the OpenAPI document of
+// the routes of router, derived from them on every request.
+func (c *Conn) openAPIHandler(router *mux.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Do not check error as the document is made
+		// of strings, suitable for a JSON encoding.
+		b, _ := json.Marshal(NewOpenAPI(router, c.Status.Version))
+
+		w.Header().Set("Content-Type", "application/json")
+		logResponse(r, http.StatusOK)
+		w.Write(b)
+	}
+}
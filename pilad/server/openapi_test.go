@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewOpenAPI(t *testing.T) {
+	conn := NewConn()
+	doc := NewOpenAPI(Router(conn), "1.0")
+
+	if doc.OpenAPI != openAPIVersion || doc.Info.Version != "1.0" {
+		t.Errorf("document is %s %s, expected %s %s", doc.OpenAPI, doc.Info.Version, openAPIVersion, "1.0")
+	}
+
+	found := make(map[string]bool)
+	for path, methods := range doc.Paths {
+		for method, op := range methods {
+			key := strings.ToUpper(method) + " " + path
+			found[key] = true
+			if op.Summary == "" {
+				t.Errorf("%s has no summary", key)
+			}
+		}
+	}
+	for key := range openAPIOperations {
+		if !found[key] {
+			t.Errorf("%s is described but not routed", key)
+		}
+	}
+
+	op := doc.Paths["/databases/{database_id}/stacks/{stack_id}"]["post"]
+	expected := OpenAPIOperation{
+		Summary:     "Push an element into a stack",
+		OperationID: "postDatabasesDatabaseIdStacksStackId",
+		Parameters: []OpenAPIParameter{
+			{Name: "database_id", In: "path", Required: true, Schema: map[string]string{"type": "string"}},
+			{Name: "stack_id", In: "path", Required: true, Schema: map[string]string{"type": "string"}},
+		},
+		RequestBody: &OpenAPIRequestBody{
+			Content: map[string]map[string]interface{}{
+				"application/json": {"schema": map[string]interface{}{}},
+			},
+		},
+		Responses: map[string]OpenAPIResponse{
+			"default": {Description: "See the pilad README for the status codes"},
+		},
+	}
+	if !reflect.DeepEqual(op, expected) {
+		t.Errorf("operation is %+v, expected %+v", op, expected)
+	}
+
+	if _, ok := doc.Paths["/databases"]["delete"]; ok {
+		t.Error("DELETE /databases is described, expected not to")
+	}
+}
+
+func TestOpenAPIOperationID(t *testing.T) {
+	inputOutput := []struct {
+		method, path, output string
+	}{
+		{"GET", "/", "get"},
+		{"GET", "/_status", "getStatus"},
+		{"PUT", "/_read_only", "putReadOnly"},
+		{"DELETE", "/databases/{database_id}/stacks/{stack_id}/_bulk", "deleteDatabasesDatabaseIdStacksStackIdBulk"},
+		{"GET", "/_openapi.json", "getOpenapiJson"},
+	}
+
+	for _, io := range inputOutput {
+		if id := openAPIOperationID(io.method, io.path); id != io.output {
+			t.Errorf("operation ID is %s, expected %s", id, io.output)
+		}
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	conn := NewConn()
+	request, err := http.NewRequest("GET", "/_openapi.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
+	}
+
+	var doc OpenAPI
+	if err := json.NewDecoder(response.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc.Paths["/_openapi.json"]["get"]; !ok {
+		t.Error("GET /_openapi.json is not described")
+	}
+	if doc.Info.Version != conn.Status.Version {
+		t.Errorf("version is %s, expected %s", doc.Info.Version, conn.Status.Version)
+	}
+}
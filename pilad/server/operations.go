@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/gorilla/mux"
+)
+
+// Operation represents a long-running operation in flight,
+// such as a blocking POP or a subscription to a stack.
+type Operation struct {
+	ID       string `json:"id"`
+	Op       string `json:"op"`
+	Database string `json:"database"`
+	Stack    string `json:"stack"`
+	// Client is the IP address of the client
+	Client    string    `json:"client"`
+	StartedAt time.Time `json:"started_at"`
+	// WaitingSeconds is the time elapsed since the
+	// operation started, in seconds
+	WaitingSeconds float64 `json:"waiting_seconds"`
+}
+
+// operation is an Operation in flight, which can be cancelled.
+type operation struct {
+	Operation
+	cancel context.CancelFunc
+}
+
+// Operations is the registry of the long-running operations
+// in flight, which allows to list and cancel them.
+type Operations struct {
+	next uint64
+
+	// mu protects the access to next and ops
+	mu  sync.Mutex
+	ops map[string]*operation
+}
+
+// NewOperations returns a new Operations with no operations.
+func NewOperations() *Operations {
+	return &Operations{ops: make(map[string]*operation)}
+}
+
+// Start registers an operation op of request r on stacks, whose names
+// are joined by commas. It returns the context of the operation, which
+// is done when the request is done or the operation is cancelled, and
+// a function that must be called once the operation finishes to
+// unregister it.
+func (o *Operations) Start(r *http.Request, op string, db *pila.Database, stacks ...*pila.Stack) (ctx context.Context, done func()) {
+	ctx, cancel := context.WithCancel(r.Context())
+
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	names := make([]string, len(stacks))
+	for i, stack := range stacks {
+		names[i] = stack.Name
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.next++
+	id := strconv.FormatUint(o.next, 10)
+	o.ops[id] = &operation{
+		Operation: Operation{
+			ID:        id,
+			Op:        op,
+			Database:  db.Name,
+			Stack:     strings.Join(names, ","),
+			Client:    client,
+			StartedAt: time.Now().UTC(),
+		},
+		cancel: cancel,
+	}
+
+	return ctx, func() {
+		o.mu.Lock()
+		delete(o.ops, id)
+		o.mu.Unlock()
+		cancel()
+	}
+}
+
+// Cancel cancels the operation given by its id. It returns
+// false if the operation is not in flight.
+func (o *Operations) Cancel(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	op, ok := o.ops[id]
+	if !ok {
+		return false
+	}
+	op.cancel()
+	return true
+}
+
+// Operations returns the operations in flight at
+// time now, sorted from the longest running.
+func (o *Operations) Operations(now time.Time) []Operation {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	ops := make(operationsByStart, 0, len(o.ops))
+	for _, op := range o.ops {
+		operation := op.Operation
+		operation.WaitingSeconds = now.Sub(operation.StartedAt).Seconds()
+		ops = append(ops, operation)
+	}
+	sort.Sort(ops)
+	return ops
+}
+
+// tenantOperations returns the operations of ops
+// on the Databases of tenant.
+func tenantOperations(tenant string, ops []Operation) []Operation {
+	kept := make([]Operation, 0, len(ops))
+	for _, op := range ops {
+		if strings.HasPrefix(op.Database, tenant+tenantSeparator) {
+			kept = append(kept, op)
+		}
+	}
+	return kept
+}
+
+// operationsByStart implements sort.Interface to sort
+// Operations by start time, and then by ID.
+type operationsByStart []Operation
+
+func (o operationsByStart) Len() int      { return len(o) }
+func (o operationsByStart) Swap(i, j int) { o[i], o[j] = o[j], o[i] }
+func (o operationsByStart) Less(i, j int) bool {
+	if !o[i].StartedAt.Equal(o[j].StartedAt) {
+		return o[i].StartedAt.Before(o[j].StartedAt)
+	}
+	return len(o[i].ID) < len(o[j].ID) || (len(o[i].ID) == len(o[j].ID) && o[i].ID < o[j].ID)
+}
+
+// OpsStatus contains the Metrics of the HTTP traffic
+// and the long-running operations in flight.
+type OpsStatus struct {
+	Metrics
+	Operations []Operation `json:"operations"`
+}
+
+// ToJSON returns the OpsStatus in JSON format.
+func (s OpsStatus) ToJSON() []byte {
+	// Do not check error as the OpsStatus type does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// cancelOpHandler cancels the operation in flight given in the URL.
+func (c *Conn) cancelOpHandler(w http.ResponseWriter, r *http.Request) {
+	if !c.Operations.Cancel(mux.Vars(r)["op_id"]) {
+		c.goneHandler(w, r, "operation is Gone")
+		return
+	}
+
+	logResponse(r, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestOperations(t *testing.T) {
+	db := pila.NewDatabase("db")
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	ops := NewOperations()
+
+	r, _ := http.NewRequest("DELETE", "/databases/db/stacks/stack?wait=1s", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	ctx0, done0 := ops.Start(r, "pop", db, stack)
+	ctx1, done1 := ops.Start(r, "subscribe", db, stack)
+	defer done1()
+
+	now := time.Now().Add(time.Second)
+	operations := ops.Operations(now)
+	if len(operations) != 2 {
+		t.Fatalf("operations are %v, expected %d", operations, 2)
+	}
+	if op := operations[0]; op.ID != "1" || op.Op != "pop" || op.Database != "db" || op.Stack != "stack" || op.Client != "10.0.0.1" || op.WaitingSeconds < 1 {
+		t.Errorf("operation is %+v", op)
+	}
+
+	if !ops.Cancel("1") {
+		t.Error("operation 1 was not cancelled")
+	}
+	select {
+	case <-ctx0.Done():
+	default:
+		t.Error("operation 1 is not done")
+	}
+	if ctx1.Err() != nil {
+		t.Errorf("operation 2 error is %v, expected nil", ctx1.Err())
+	}
+
+	done0()
+	if operations := ops.Operations(now); len(operations) != 1 || operations[0].ID != "2" {
+		t.Errorf("operations are %v, expected operation 2", operations)
+	}
+	if ops.Cancel("1") {
+		t.Error("operation 1 was cancelled twice")
+	}
+}
+
+func TestCancelOpHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	handler := Router(conn)
+
+	popped := make(chan int)
+	go func() {
+		request, _ := http.NewRequest("DELETE", "/databases/db/stacks/stack?wait=10s", nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		popped <- response.Code
+	}()
+
+	var status OpsStatus
+	for i := 0; i < 100 && len(status.Operations) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		request, _ := http.NewRequest("GET", "/_ops", nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(status.Operations) != 1 || status.Operations[0].Op != "pop" {
+		t.Fatalf("operations are %v, expected a pop", status.Operations)
+	}
+
+	cancel := func() int {
+		request, _ := http.NewRequest("DELETE", "/_ops/"+status.Operations[0].ID, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response.Code
+	}
+
+	if code := cancel(); code != http.StatusNoContent {
+		t.Errorf("response code is %v, expected %v", code, http.StatusNoContent)
+	}
+	select {
+	case code := <-popped:
+		if code != http.StatusNoContent {
+			t.Errorf("pop response code is %v, expected %v", code, http.StatusNoContent)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocking pop was not cancelled")
+	}
+	if code := cancel(); code != http.StatusGone {
+		t.Errorf("response code is %v, expected %v", code, http.StatusGone)
+	}
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"flag"
+	"net"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config"
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// Options configure a Server. The config values among them are
+// overridden by their environment variables, if set, and by the
+// config file, unless they are explicitly set.
+type Options struct {
+	// Config values, see the config/vars package
+	MaxStackSize              int
+	MaxElementSize            int
+	ReadTimeout, WriteTimeout int
+	Port                      int
+	PersistDir                string
+	SpillDir                  string
+	LogLevel                  string
+	RateLimitClient           int
+	RateLimitStack            int
+	CORSOrigins, CORSMethods  string
+	CORSHeaders               string
+	StackTemplates            string
+	EncryptionKeys            string
+	MaxDatabases              int
+	MaxStacksPerDatabase      int
+	MaxMemory                 int
+	// ConfigFile is a YAML or TOML file with config values
+	ConfigFile string
+	// Explicit are the names of the flags of the config values
+	// explicitly set, which override the config file even if they
+	// are set to their default. Values other than the default
+	// override it anyway.
+	Explicit map[string]bool
+
+	AutoPersistPath  string
+	SnapshotDir      string
+	SnapshotInterval time.Duration
+	SnapshotKeep     int
+	CompactSize      int64
+	CompactOps       int
+	ArchiveDir       string
+	TrashRetention   time.Duration
+	AuditFile        string
+	AuditMaxSize     int64
+	AuditKeep        int
+	LogFormat        string
+	LogFile          string
+	Peers            string
+	ReplicaOf        string
+	ClusterSelf      string
+	ClusterJoin      string
+	ClusterToken     string
+	RaftSelf         string
+	RaftPeers        string
+	RaftToken        string
+	ReadOnly         bool
+	Debug            bool
+	TLSCert, TLSKey  string
+	TLSClientCA      string
+	RedirectPort     int
+	RESPPort         int
+	RPCPort          int
+	// ShutdownTimeout is in seconds
+	ShutdownTimeout int
+	Features        map[string]bool
+	Tokens          []Token
+	Tenants         []Tenant
+	Allow, Deny     []string
+	AllowDatabase   map[string][]string
+
+	// Listener, if not nil, is used by Start instead
+	// of listening on Port, e.g. to listen on a
+	// random port of the loopback interface.
+	Listener net.Listener
+}
+
+// DefaultOptions returns the Options used
+// by pilad if no flag is given.
+func DefaultOptions() Options {
+	return Options{
+		MaxStackSize:         vars.MaxStackSizeDefault,
+		MaxElementSize:       vars.MaxElementSizeDefault,
+		ReadTimeout:          vars.ReadTimeoutDefault,
+		WriteTimeout:         vars.WriteTimeoutDefault,
+		Port:                 vars.PortDefault,
+		PersistDir:           vars.PersistDirDefault,
+		SpillDir:             vars.SpillDirDefault,
+		LogLevel:             vars.LogLevelDefault,
+		RateLimitClient:      vars.RateLimitClientDefault,
+		RateLimitStack:       vars.RateLimitStackDefault,
+		CORSOrigins:          vars.CORSOriginsDefault,
+		CORSMethods:          vars.CORSMethodsDefault,
+		CORSHeaders:          vars.CORSHeadersDefault,
+		StackTemplates:       vars.StackTemplatesDefault,
+		EncryptionKeys:       vars.EncryptionKeysDefault,
+		MaxDatabases:         vars.MaxDatabasesDefault,
+		MaxStacksPerDatabase: vars.MaxStacksPerDatabaseDefault,
+		MaxMemory:            vars.MaxMemoryDefault,
+		Explicit:             make(map[string]bool),
+		SnapshotKeep:         snapshotKeepDefault,
+		AuditMaxSize:         auditMaxSizeDefault,
+		AuditKeep:            auditKeepDefault,
+		LogFormat:            string(logger.FormatText),
+		ShutdownTimeout:      shutdownTimeoutDefault,
+		Features:             make(map[string]bool),
+		AllowDatabase:        make(map[string][]string),
+	}
+}
+
+// Validate checks the Options that are not config values, and
+// returns the list of errors found, empty if they are valid.
+func (o Options) Validate() []config.ConfigError {
+	errs := []config.ConfigError{}
+
+	if (o.TLSCert == "") != (o.TLSKey == "") {
+		errs = append(errs, config.ConfigError{Field: "tls-cert", Message: "tls-cert and tls-key must be given together"})
+	}
+
+	return errs
+}
+
+// RegisterFlags defines in fs the command line flags of pilad,
+// setting the Options, whose current values are the defaults.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	if o.Features == nil {
+		o.Features = make(map[string]bool)
+	}
+	if o.AllowDatabase == nil {
+		o.AllowDatabase = make(map[string][]string)
+	}
+
+	fs.IntVar(&o.MaxStackSize, "max-stack-size", o.MaxStackSize, "Max size of Stacks")
+	fs.IntVar(&o.MaxElementSize, "max-element-size", o.MaxElementSize, "Max size in bytes of elements, -1 if unlimited")
+	fs.IntVar(&o.MaxDatabases, "max-databases", o.MaxDatabases, "Max number of databases, 0 if unlimited")
+	fs.IntVar(&o.MaxStacksPerDatabase, "max-stacks-per-database", o.MaxStacksPerDatabase, "Max number of stacks of a database, 0 if unlimited")
+	fs.IntVar(&o.MaxMemory, "max-memory", o.MaxMemory, "Max memory in bytes used by the elements of every database, 0 if unlimited")
+	fs.IntVar(&o.ReadTimeout, "read-timeout", o.ReadTimeout, "Read request timeout")
+	fs.IntVar(&o.WriteTimeout, "write-timeout", o.WriteTimeout, "Write response timeout")
+	fs.IntVar(&o.Port, "port", o.Port, "Port number")
+	fs.IntVar(&o.RateLimitClient, "rate-limit-client", o.RateLimitClient, "Max requests per second of a client, 0 if unlimited")
+	fs.IntVar(&o.RateLimitStack, "rate-limit-stack", o.RateLimitStack, "Max requests per second on a stack, 0 if unlimited")
+	fs.StringVar(&o.Peers, "peers", o.Peers, "Comma-separated list of peer URLs")
+	fs.StringVar(&o.ReplicaOf, "replica-of", o.ReplicaOf, "URL of the primary pilad to follow as a read-only replica")
+	fs.StringVar(&o.ClusterSelf, "cluster-self", o.ClusterSelf, "URL other nodes reach this pilad at, enables the cluster mode")
+	fs.StringVar(&o.ClusterJoin, "cluster-join", o.ClusterJoin, "URL of a node of the cluster to join, requires -cluster-self")
+	fs.StringVar(&o.ClusterToken, "cluster-token", o.ClusterToken, "Admin token authenticating the requests between nodes of the cluster")
+	fs.StringVar(&o.RaftSelf, "raft-self", o.RaftSelf, "URL other Raft nodes reach this pilad at, enables the Raft mode")
+	fs.StringVar(&o.RaftPeers, "raft-peers", o.RaftPeers, "Comma-separated list of URLs of the other Raft nodes, requires -raft-self")
+	fs.StringVar(&o.RaftToken, "raft-token", o.RaftToken, "Admin token authenticating the requests between Raft nodes")
+	fs.BoolVar(&o.ReadOnly, "read-only", o.ReadOnly, "Reject every request modifying pilad, until disabled with PUT /_read_only")
+	fs.BoolVar(&o.Debug, "debug", o.Debug, "Enable the /debug/pprof and /debug/vars endpoints, which can be toggled with PUT /_debug")
+	fs.Var(featureFlags(o.Features), "feature", "Feature flag as name:bool, can be repeated")
+	fs.Var((*authTokens)(&o.Tokens), "token", "API token as token:role[:database,...[:tenant]], can be repeated")
+	fs.Var((*tenantFlags)(&o.Tenants), "tenant", "Tenant quotas as name[:max_databases[:max_stacks[:max_memory]]], can be repeated")
+	fs.Var((*aclFlags)(&o.Allow), "allow", "CIDR block or IP address of the only clients allowed, can be repeated")
+	fs.Var((*aclFlags)(&o.Deny), "deny", "CIDR block or IP address of clients denied, can be repeated")
+	fs.Var(aclDatabaseFlags(o.AllowDatabase), "allow-database", "Clients allowed to access a database as database=cidr[,cidr...], can be repeated")
+	fs.StringVar(&o.TLSCert, "tls-cert", o.TLSCert, "TLS certificate file, enables HTTPS along with -tls-key")
+	fs.StringVar(&o.TLSKey, "tls-key", o.TLSKey, "TLS private key file")
+	fs.StringVar(&o.TLSClientCA, "tls-client-ca", o.TLSClientCA, "CA certificates file to verify client certificates")
+	fs.IntVar(&o.RedirectPort, "redirect-port", o.RedirectPort, "Port number redirecting HTTP requests to HTTPS, disabled if 0")
+	fs.IntVar(&o.RESPPort, "resp-port", o.RESPPort, "Port number serving the Redis protocol (RESP), disabled if 0")
+	fs.IntVar(&o.RPCPort, "rpc-port", o.RPCPort, "Port number serving the RPC service of proto/piladb.proto, disabled if 0")
+	fs.IntVar(&o.ShutdownTimeout, "shutdown-timeout", o.ShutdownTimeout, "Seconds to drain in-flight requests on shutdown")
+	fs.StringVar(&o.AutoPersistPath, "auto-persist-path", o.AutoPersistPath, "File where the Pila is saved after every change")
+	fs.StringVar(&o.SnapshotDir, "snapshot-dir", o.SnapshotDir, "Directory where snapshots of the Pila are taken, and the latest is loaded from on start-up")
+	fs.DurationVar(&o.SnapshotInterval, "snapshot-interval", o.SnapshotInterval, "Interval between scheduled snapshots, e.g. 5m, disabled if 0")
+	fs.IntVar(&o.SnapshotKeep, "snapshot-keep", o.SnapshotKeep, "Number of most recent snapshots kept")
+	fs.Int64Var(&o.CompactSize, "compact-size", o.CompactSize, "Size in bytes of the PERSIST_DIR log that triggers its compaction, disabled if 0")
+	fs.IntVar(&o.CompactOps, "compact-ops", o.CompactOps, "Number of operations in the PERSIST_DIR log that triggers its compaction, disabled if 0")
+	fs.StringVar(&o.ArchiveDir, "archive-dir", o.ArchiveDir, "Directory where archived stacks are stored, enables archiving")
+	fs.DurationVar(&o.TrashRetention, "trash-retention", o.TrashRetention, "Time deleted databases and stacks are kept in the trash, e.g. 24h, deleted immediately if 0")
+	fs.StringVar(&o.AuditFile, "audit-file", o.AuditFile, "File where the requests modifying pilad are appended as JSON lines")
+	fs.Int64Var(&o.AuditMaxSize, "audit-max-size", o.AuditMaxSize, "Size in bytes of the audit file before it is rotated")
+	fs.IntVar(&o.AuditKeep, "audit-keep", o.AuditKeep, "Number of rotated audit files kept")
+	fs.StringVar(&o.PersistDir, "persist-dir", o.PersistDir, "Directory where the append-only log of operations is stored")
+	fs.StringVar(&o.SpillDir, "spill-dir", o.SpillDir, "Directory where stacks created with spill store their deeper elements")
+	fs.StringVar(&o.CORSOrigins, "cors-origins", o.CORSOrigins, "Comma-separated list of origins allowed to call pilad from a browser, * for any")
+	fs.StringVar(&o.CORSMethods, "cors-methods", o.CORSMethods, "Comma-separated list of methods allowed in CORS requests")
+	fs.StringVar(&o.CORSHeaders, "cors-headers", o.CORSHeaders, "Comma-separated list of headers allowed in CORS requests")
+	fs.StringVar(&o.StackTemplates, "stack-templates", o.StackTemplates, "Semicolon-separated stack templates as name:stack?type=TYPE&max_size=MAX_SIZE&policy=POLICY&ttl=TTL,...")
+	fs.StringVar(&o.EncryptionKeys, "encryption-keys", o.EncryptionKeys, "Comma-separated AES keys encrypting stacks created with encrypt as id:base64,..., the last one being current")
+	fs.StringVar(&o.LogLevel, "log-level", o.LogLevel, "Logging level, one of debug, info, warn, error or off")
+	fs.StringVar(&o.LogFormat, "log-format", o.LogFormat, "Format of the log entries, either text or json")
+	fs.StringVar(&o.LogFile, "log-file", o.LogFile, "File where log entries are appended, standard error if empty")
+	fs.StringVar(&o.ConfigFile, "config", o.ConfigFile, "YAML or TOML file with config values")
+}
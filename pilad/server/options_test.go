@@ -0,0 +1,93 @@
+package server
+
+import (
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config"
+	"github.com/fern4lvarez/piladb/config/vars"
+)
+
+func TestDefaultOptions(t *testing.T) {
+	opts := DefaultOptions()
+
+	if opts.Port != vars.PortDefault {
+		t.Errorf("port is %v, expected %v", opts.Port, vars.PortDefault)
+	}
+	if opts.ShutdownTimeout != shutdownTimeoutDefault {
+		t.Errorf("shutdown timeout is %v, expected %v", opts.ShutdownTimeout, shutdownTimeoutDefault)
+	}
+	if opts.Explicit == nil || opts.Features == nil || opts.AllowDatabase == nil {
+		t.Errorf("options %+v have nil maps", opts)
+	}
+}
+
+func TestOptionsRegisterFlags(t *testing.T) {
+	opts := DefaultOptions()
+	fs := flag.NewFlagSet("pilad", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	opts.RegisterFlags(fs)
+
+	err := fs.Parse([]string{
+		"-port", "9090",
+		"-trash-retention", "1h",
+		"-feature", "strict_schema",
+		"-token", "foo:admin",
+		"-tenant", "acme:2",
+		"-allow", "10.0.0.0/8",
+		"-allow-database", "db=10.0.0.1",
+		"-read-only",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputOutput := []struct {
+		input  interface{}
+		output interface{}
+	}{
+		{opts.Port, 9090},
+		{opts.TrashRetention, time.Hour},
+		{opts.Features, map[string]bool{"strict_schema": true}},
+		{opts.Tokens, []Token{{Token: "foo", Role: RoleAdmin}}},
+		{len(opts.Tenants), 1},
+		{opts.Allow, []string{"10.0.0.0/8"}},
+		{opts.AllowDatabase, map[string][]string{"db": {"10.0.0.1"}}},
+		{opts.ReadOnly, true},
+		// flags not given keep their defaults
+		{opts.MaxStackSize, vars.MaxStackSizeDefault},
+	}
+
+	for _, io := range inputOutput {
+		if !reflect.DeepEqual(io.input, io.output) {
+			t.Errorf("option is %v, expected %v", io.input, io.output)
+		}
+	}
+
+	if err := fs.Parse([]string{"-token", "foo"}); err == nil {
+		t.Error("err is nil")
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	inputOutput := []struct {
+		cert, key string
+		errs      []config.ConfigError
+	}{
+		{"", "", []config.ConfigError{}},
+		{"server.crt", "server.key", []config.ConfigError{}},
+		{"server.crt", "", []config.ConfigError{{Field: "tls-cert", Message: "tls-cert and tls-key must be given together"}}},
+		{"", "server.key", []config.ConfigError{{Field: "tls-cert", Message: "tls-cert and tls-key must be given together"}}},
+	}
+
+	for _, io := range inputOutput {
+		opts := DefaultOptions()
+		opts.TLSCert, opts.TLSKey = io.cert, io.key
+		if errs := opts.Validate(); !reflect.DeepEqual(errs, io.errs) {
+			t.Errorf("errors are %v, expected %v for %q and %q", errs, io.errs, io.cert, io.key)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+const (
+	// heartbeatInterval is the period of time between
+	// two pings to the peers.
+	heartbeatInterval = 30 * time.Second
+	// maxPeerFailures is the number of consecutive failed pings
+	// after which a peer is removed from the PeerList.
+	maxPeerFailures = 3
+)
+
+// Peer represents another pilad instance known by this one.
+type Peer struct {
+	URL       string    `json:"url"`
+	Reachable bool      `json:"reachable"`
+	LastSeen  time.Time `json:"last_seen"`
+
+	// failures is the number of consecutive failed pings
+	failures int
+}
+
+// PeerList contains the list of known peers of pilad, i.e. the
+// other pilad instances that form a loosely-coupled cluster.
+type PeerList struct {
+	client *http.Client
+
+	mu    sync.RWMutex
+	peers map[string]*Peer
+}
+
+// NewPeerList returns a PeerList given a list of peer URLs.
+// Empty URLs are ignored.
+func NewPeerList(urls []string) *PeerList {
+	pl := &PeerList{
+		client: &http.Client{Timeout: 5 * time.Second},
+		peers:  make(map[string]*Peer),
+	}
+	for _, url := range urls {
+		url = strings.TrimRight(strings.TrimSpace(url), "/")
+		if url != "" {
+			pl.peers[url] = &Peer{URL: url}
+		}
+	}
+	return pl
+}
+
+// Peers returns a copy of the peers of the PeerList,
+// sorted by URL.
+func (pl *PeerList) Peers() []Peer {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	peers := make(peersByURL, 0, len(pl.peers))
+	for _, peer := range pl.peers {
+		peers = append(peers, *peer)
+	}
+	sort.Sort(peers)
+	return peers
+}
+
+// Ping checks whether every peer is reachable by requesting its
+// status. Peers that failed maxPeerFailures consecutive times are
+// removed from the PeerList.
+func (pl *PeerList) Ping() {
+	for _, peer := range pl.Peers() {
+		reachable := pl.ping(peer.URL)
+
+		pl.mu.Lock()
+		p, ok := pl.peers[peer.URL]
+		if !ok {
+			pl.mu.Unlock()
+			continue
+		}
+		p.Reachable = reachable
+		if reachable {
+			p.LastSeen = time.Now().UTC()
+			p.failures = 0
+		} else {
+			p.failures++
+		}
+		if p.failures >= maxPeerFailures {
+			logger.Warn("removing unreachable peer", "peer", p.URL)
+			delete(pl.peers, p.URL)
+		}
+		pl.mu.Unlock()
+	}
+}
+
+// ping returns true if the peer given by url answers
+// its status successfully.
+func (pl *PeerList) ping(url string) bool {
+	res, err := pl.client.Get(url + "/_status")
+	if err != nil {
+		return false
+	}
+	res.Body.Close()
+	return res.StatusCode == http.StatusOK
+}
+
+// GossipHeartbeat pings the peers every interval until
+// stop is closed. It is meant to be run as a goroutine.
+func (pl *PeerList) GossipHeartbeat(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			pl.Ping()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// ToJSON converts the PeerList into JSON.
+func (pl *PeerList) ToJSON() []byte {
+	// Do not check error as the Peer type does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(map[string][]Peer{"peers": pl.Peers()})
+	return b
+}
+
+// peersByURL implements sort.Interface to sort
+// a list of Peers by URL.
+type peersByURL []Peer
+
+func (peers peersByURL) Len() int           { return len(peers) }
+func (peers peersByURL) Less(i, j int) bool { return peers[i].URL < peers[j].URL }
+func (peers peersByURL) Swap(i, j int)      { peers[i], peers[j] = peers[j], peers[i] }
+
+// peersHandler writes the list of known peers into the response.
+func (c *Conn) peersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(c.Peers.ToJSON())
+}
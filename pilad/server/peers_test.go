@@ -0,0 +1,123 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewPeerList(t *testing.T) {
+	pl := NewPeerList([]string{"http://b:1205/", " http://a:1205", ""})
+
+	peers := pl.Peers()
+	if len(peers) != 2 {
+		t.Fatalf("number of peers is %d, expected %d", len(peers), 2)
+	}
+	if peers[0].URL != "http://a:1205" {
+		t.Errorf("peer URL is %s, expected %s", peers[0].URL, "http://a:1205")
+	}
+	if peers[1].URL != "http://b:1205" {
+		t.Errorf("peer URL is %s, expected %s", peers[1].URL, "http://b:1205")
+	}
+}
+
+func TestPeerListPing(t *testing.T) {
+	peer := httptest.NewServer(Router(NewConn()))
+	defer peer.Close()
+	unreachable := "http://127.0.0.1:1"
+
+	pl := NewPeerList([]string{peer.URL, unreachable})
+
+	for i := 0; i < maxPeerFailures-1; i++ {
+		pl.Ping()
+	}
+
+	peers := pl.Peers()
+	if len(peers) != 2 {
+		t.Fatalf("number of peers is %d, expected %d", len(peers), 2)
+	}
+	for _, p := range peers {
+		if p.URL == peer.URL && (!p.Reachable || p.LastSeen.IsZero()) {
+			t.Errorf("peer %s is not reachable", p.URL)
+		}
+		if p.URL == unreachable && (p.Reachable || !p.LastSeen.IsZero()) {
+			t.Errorf("peer %s is reachable", p.URL)
+		}
+	}
+
+	pl.Ping()
+
+	peers = pl.Peers()
+	if len(peers) != 1 {
+		t.Fatalf("number of peers is %d, expected %d", len(peers), 1)
+	}
+	if peers[0].URL != peer.URL {
+		t.Errorf("peer URL is %s, expected %s", peers[0].URL, peer.URL)
+	}
+}
+
+func TestPeerListPing_NotOK(t *testing.T) {
+	peer := httptest.NewServer(http.NotFoundHandler())
+	defer peer.Close()
+
+	pl := NewPeerList([]string{peer.URL})
+	pl.Ping()
+
+	if peers := pl.Peers(); peers[0].Reachable {
+		t.Errorf("peer %s is reachable", peers[0].URL)
+	}
+}
+
+func TestPeerListGossipHeartbeat(t *testing.T) {
+	pl := NewPeerList([]string{"http://127.0.0.1:1"})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		pl.GossipHeartbeat(time.Millisecond, stop)
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+	<-done
+
+	if peers := pl.Peers(); len(peers) != 0 {
+		t.Errorf("number of peers is %d, expected %d", len(peers), 0)
+	}
+}
+
+func TestPeerListToJSON(t *testing.T) {
+	pl := NewPeerList([]string{"http://a:1205"})
+
+	expected := `{"peers":[{"url":"http://a:1205","reachable":false,"last_seen":"0001-01-01T00:00:00Z"}]}`
+	if b := pl.ToJSON(); string(b) != expected {
+		t.Errorf("peers are %s, expected %s", string(b), expected)
+	}
+}
+
+func TestPeersHandler(t *testing.T) {
+	conn := NewConn()
+	conn.Peers = NewPeerList([]string{"http://a:1205"})
+
+	request, err := http.NewRequest("GET", "/_peers", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+
+	Router(conn).ServeHTTP(response, request)
+
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
+	}
+
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+
+	if body := response.Body.String(); body != string(conn.Peers.ToJSON()) {
+		t.Errorf("peers are %s, expected %s", body, string(conn.Peers.ToJSON()))
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+)
+
+// PoppedElement is an element popped from any of several
+// Stacks, along with the name of the Stack it came from.
+type PoppedElement struct {
+	Stack string `json:"stack"`
+	pila.Element
+}
+
+// popAnyHandler pops the element on top of the first Stack that is not
+// empty among the ones of the Database given by the stacks parameter,
+// a comma-separated list in priority order, waiting up to the wait
+// parameter for an element to be pushed into any of them if all are
+// empty. It returns 200 and the element along with the name of its
+// Stack, or 204 if all of them are empty. Returns 400 if no Stack is
+// given or the wait is not valid, 410 if a Stack does not exist, and
+// 423 if a Stack is locked by another owner.
+func (c *Conn) popAnyHandler(w http.ResponseWriter, r *http.Request) {
+	r = withDate(r)
+	db := databaseFromContext(r)
+
+	ids := r.FormValue("stacks")
+	if ids == "" {
+		logResponse(r, http.StatusBadRequest, "reason", "missing stacks")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	wait, err := popWait(r, c.Config.WriteTimeout()*time.Second)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var stacks []*pila.Stack
+	for _, id := range strings.Split(ids, ",") {
+		stack, ok := ResourceStack(db, id)
+		if !ok {
+			c.goneHandler(w, r, fmt.Sprintf("stack %s is Gone", id))
+			return
+		}
+		if !c.checkLock(w, r, stack) {
+			return
+		}
+		stacks = append(stacks, stack)
+	}
+
+	if wait > 0 {
+		c.popAnyWait(w, r, db, stacks, wait)
+		return
+	}
+	if stack, value, ok := c.popAny(r.Context(), stacks, requestDate(r)); ok {
+		writePoppedElement(w, r, stack, value)
+		return
+	}
+	logResponse(r, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// popAnyWait pops any of the stacks as popAnyHandler does, waiting up
+// to wait for an element to be pushed into any of them if all are
+// empty. Like popWaitStackHandler, it holds the Replication writes
+// and the writes of the Raft leader only while popping, and waiting
+// can be cancelled as an operation in flight.
+func (c *Conn) popAnyWait(w http.ResponseWriter, r *http.Request, db *pila.Database, stacks []*pila.Stack, wait time.Duration) {
+	ctx, done := c.Operations.Start(r, "popany", db, stacks...)
+	defer done()
+
+	pushed, stop := pila.PushedAny(stacks...)
+	defer stop()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	rr := raftRequestFromContext(r)
+	for {
+		rr.hold()
+		c.Replication.writes.RLock()
+		stack, value, ok := c.popAny(r.Context(), stacks, requestDate(r))
+		c.Replication.writes.RUnlock()
+		rr.release()
+
+		if ok {
+			writePoppedElement(w, r, stack, value)
+			return
+		}
+
+		select {
+		case <-pushed:
+			continue
+		case <-timer.C:
+		case <-ctx.Done():
+		case <-c.Shutdown.Requested():
+		}
+		logResponse(r, http.StatusNoContent)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+}
+
+// popAny pops at date t the element on top of the first of the
+// stacks that is not empty, and returns it and its Stack, or false
+// if all of them are empty.
+func (c *Conn) popAny(ctx context.Context, stacks []*pila.Stack, t time.Time) (*pila.Stack, interface{}, bool) {
+	for _, stack := range stacks {
+		unlock := c.stackLocks.lock(stack)
+		value, ok := stack.Pop()
+		if ok {
+			stack.Update(t)
+			c.persistStack(ctx, stack, persist.Record{Op: persist.OpPop, Time: t})
+		}
+		unlock()
+
+		if ok {
+			return stack, value, true
+		}
+	}
+	return nil, nil, false
+}
+
+// writePoppedElement writes into the response the
+// value popped from stack as a PoppedElement.
+func writePoppedElement(w http.ResponseWriter, r *http.Request, stack *pila.Stack, value interface{}) {
+	// Do not check error as we consider our element
+	// suitable for a JSON encoding.
+	b, _ := json.Marshal(PoppedElement{Stack: stack.Name, Element: pila.NewElement(value)})
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK, "stack", stack.Name)
+	w.Write(b)
+}
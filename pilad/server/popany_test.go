@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestPopAnyHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	high := pila.NewStack("high", time.Now().UTC())
+	low := pila.NewStack("low", time.Now().UTC())
+	_ = low.PushN([]interface{}{"foo", "bar"})
+	_ = high.Push("baz")
+	_ = db.AddStack(high)
+	_ = db.AddStack(low)
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/databases/db/_popany", http.StatusBadRequest, ""},
+		{"/databases/db/_popany?stacks=high,low&wait=x", http.StatusBadRequest, ""},
+		{"/databases/db/_popany?stacks=high,foo", http.StatusGone, ""},
+		{"/databases/nodb/_popany?stacks=high,low", http.StatusGone, `{"code":"database_not_found","message":"database nodb is Gone","field":"database_id"}`},
+		{"/databases/db/_popany?stacks=high,low", http.StatusOK, `{"stack":"high","element":"baz"}`},
+		{"/databases/db/_popany?stacks=high,low", http.StatusOK, `{"stack":"low","element":"bar"}`},
+		{"/databases/db/_popany?stacks=" + low.ID.String(), http.StatusOK, `{"stack":"low","element":"foo"}`},
+		{"/databases/db/_popany?stacks=high,low", http.StatusNoContent, ""},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest("DELETE", io.path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, io.path)
+		}
+		if response.Body.String() != io.body {
+			t.Errorf("body is %s, expected %s for %s", response.Body.String(), io.body, io.path)
+		}
+	}
+	if high.Pops() != 1 || low.Pops() != 2 {
+		t.Errorf("stacks have %d and %d pops, expected %d and %d", high.Pops(), low.Pops(), 1, 2)
+	}
+}
+
+func TestPopAnyHandler_Wait(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	high := pila.NewStack("high", time.Now().UTC())
+	low := pila.NewStack("low", time.Now().UTC())
+	_ = db.AddStack(high)
+	_ = db.AddStack(low)
+	handler := ReplicationMiddleware(conn)(Router(conn))
+
+	pop := func(query string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("DELETE", "/databases/db/_popany?stacks=high,low&"+query, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	start := time.Now()
+	if response := pop("wait=20ms"); response.Code != http.StatusNoContent {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusNoContent)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("elapsed time is %v, expected at least %v", elapsed, 20*time.Millisecond)
+	}
+
+	responses := make(chan *httptest.ResponseRecorder)
+	go func() {
+		responses <- pop("wait=5s")
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// the writes are not held while waiting
+	conn.Replication.writes.Lock()
+	conn.Replication.writes.Unlock()
+
+	if ops := conn.Operations.Operations(time.Now()); len(ops) != 1 || ops[0].Op != "popany" || ops[0].Stack != "high,low" {
+		t.Errorf("operations are %v, expected a popany on high,low", ops)
+	}
+
+	_ = low.Push("foo")
+	response := <-responses
+	if expected := `{"stack":"low","element":"foo"}`; response.Code != http.StatusOK || response.Body.String() != expected {
+		t.Errorf("response is %v %s, expected %v %s", response.Code, response.Body, http.StatusOK, expected)
+	}
+	if low.Size() != 0 {
+		t.Errorf("stack size is %d, expected %d", low.Size(), 0)
+	}
+}
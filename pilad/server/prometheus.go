@@ -0,0 +1,137 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// notFoundRoute labels the latencies of requests
+// that do not match any route.
+const notFoundRoute = "not_found"
+
+// latencyBuckets are the upper bounds, in seconds, of the
+// buckets of the HTTP request latency histograms.
+var latencyBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram counts observations in latencyBuckets.
+type histogram struct {
+	// counts holds the number of observations of each bucket,
+	// not cumulative, plus the ones greater than every bucket
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Latencies contains the histograms of the latency of
+// the HTTP requests served by pilad, by route.
+type Latencies struct {
+	histograms map[string]*histogram
+
+	// mu protects the access to histograms
+	mu sync.Mutex
+}
+
+// NewLatencies returns new empty Latencies.
+func NewLatencies() *Latencies {
+	return &Latencies{histograms: make(map[string]*histogram)}
+}
+
+// Observe records the latency of a request served by a route.
+func (l *Latencies) Observe(route string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h, ok := l.histograms[route]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets)+1)}
+		l.histograms[route] = h
+	}
+
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets, seconds)
+	h.counts[i]++
+	h.count++
+	h.sum += seconds
+}
+
+// WriteMetrics writes the histograms into w, in the
+// Prometheus text exposition format.
+func (l *Latencies) WriteMetrics(w io.Writer) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	routes := make([]string, 0, len(l.histograms))
+	for route := range l.histograms {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	bw := bufio.NewWriter(w)
+	name := "piladb_http_request_duration_seconds"
+	fmt.Fprintf(bw, "# HELP %s Latency of the HTTP requests by route.\n", name)
+	fmt.Fprintf(bw, "# TYPE %s histogram\n", name)
+	for _, route := range routes {
+		h := l.histograms[route]
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(bw, "%s_bucket{route=%q,le=\"%s\"} %d\n",
+				name, route, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(bw, "%s_bucket{route=%q,le=\"+Inf\"} %d\n", name, route, h.count)
+		fmt.Fprintf(bw, "%s_sum{route=%q} %g\n", name, route, h.sum)
+		fmt.Fprintf(bw, "%s_count{route=%q} %d\n", name, route, h.count)
+	}
+	return bw.Flush()
+}
+
+// routeLabel returns a handler that labels the latency of the requests
+// served by a route with its path template, records their IDs to be
+// logged, and serves them with handler.
+func routeLabel(template string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if mw, ok := w.(*metricsResponseWriter); ok {
+			mw.route = template
+		}
+		setRequestLog(r, template)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// metricsHandler writes the metrics of pilad, its Pila and the
+// latency of the HTTP requests in the Prometheus text exposition format.
+func (c *Conn) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	m := c.Metrics.Snapshot(c.startTime, time.Now())
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	bw := bufio.NewWriter(w)
+	metrics := []struct {
+		name, help, kind string
+		value            interface{}
+	}{
+		{"piladb_http_requests_total", "Number of HTTP requests.", "counter", m.TotalRequests},
+		{"piladb_http_errors_total", "Number of HTTP responses with a status code of 400 or greater.", "counter", m.TotalErrors},
+		{"piladb_http_written_bytes_total", "Number of bytes written in HTTP responses.", "counter", m.TotalBytesWritten},
+		{"piladb_http_active_connections", "Number of HTTP requests being served.", "gauge", m.ActiveConnections},
+		{"piladb_uptime_seconds", "Number of seconds since pilad started.", "gauge", m.UptimeSeconds},
+	}
+	for _, metric := range metrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", metric.name, metric.kind)
+		fmt.Fprintln(bw, metric.name, metric.value)
+	}
+
+	// Do not check errors as they can only be
+	// caused by writing the response.
+	_ = c.Pila.WriteMetrics(bw)
+	_ = c.Latencies.WriteMetrics(bw)
+	_ = bw.Flush()
+
+	logResponse(r, http.StatusOK)
+}
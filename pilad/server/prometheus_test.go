@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestLatencies(t *testing.T) {
+	l := NewLatencies()
+	l.Observe("/foo", 2*time.Millisecond)
+	l.Observe("/foo", 300*time.Millisecond)
+	l.Observe("/foo", time.Minute)
+	l.Observe("/bar", time.Millisecond)
+
+	var b bytes.Buffer
+	if err := l.WriteMetrics(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"# TYPE piladb_http_request_duration_seconds histogram",
+		`piladb_http_request_duration_seconds_bucket{route="/bar",le="0.001"} 1`,
+		`piladb_http_request_duration_seconds_count{route="/bar"} 1`,
+		`piladb_http_request_duration_seconds_bucket{route="/foo",le="0.001"} 0`,
+		`piladb_http_request_duration_seconds_bucket{route="/foo",le="0.005"} 1`,
+		`piladb_http_request_duration_seconds_bucket{route="/foo",le="0.25"} 1`,
+		`piladb_http_request_duration_seconds_bucket{route="/foo",le="0.5"} 2`,
+		`piladb_http_request_duration_seconds_bucket{route="/foo",le="10"} 2`,
+		`piladb_http_request_duration_seconds_bucket{route="/foo",le="+Inf"} 3`,
+		`piladb_http_request_duration_seconds_sum{route="/foo"} 60.302`,
+		`piladb_http_request_duration_seconds_count{route="/foo"} 3`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("metrics do not contain %s:\n%s", line, b.String())
+		}
+	}
+	if strings.Index(b.String(), `route="/bar"`) > strings.Index(b.String(), `route="/foo"`) {
+		t.Error("routes are not sorted")
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	handler := MetricsMiddleware(conn)(Router(conn))
+
+	requests := []struct {
+		method, path, body string
+	}{
+		{"POST", "/databases/db/stacks/stack", `{"element":"foo"}`},
+		{"POST", "/databases/db/stacks/stack", `{"element":"bar"}`},
+		{"DELETE", "/databases/db/stacks/stack/pop", ""},
+		{"GET", "/foo", ""},
+	}
+	for _, r := range requests {
+		request, err := http.NewRequest(r.method, r.path, strings.NewReader(r.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	request, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+	if contentType := response.Header().Get("Content-Type"); contentType != "text/plain; version=0.0.4" {
+		t.Errorf("Content-Type is %v, expected %v", contentType, "text/plain; version=0.0.4")
+	}
+
+	expected := []string{
+		"piladb_http_requests_total 5",
+		"piladb_http_errors_total 1",
+		"piladb_http_active_connections 1",
+		"piladb_databases 1",
+		`piladb_stack_size{database="db",stack="stack"} 1`,
+		`piladb_stack_pushes_total{database="db",stack="stack"} 2`,
+		`piladb_stack_pops_total{database="db",stack="stack"} 1`,
+		`piladb_http_request_duration_seconds_count{route="/databases/{database_id}/stacks/{stack_id}"} 2`,
+		`piladb_http_request_duration_seconds_count{route="/databases/{database_id}/stacks/{stack_id}/pop"} 1`,
+		`piladb_http_request_duration_seconds_count{route="not_found"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(response.Body.String(), line+"\n") {
+			t.Errorf("metrics do not contain %s:\n%s", line, response.Body.String())
+		}
+	}
+}
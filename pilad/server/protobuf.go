@@ -0,0 +1,87 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/fern4lvarez/piladb/pkg/protobuf"
+)
+
+// protobufContentType is the media type of the Protocol Buffers
+// messages of proto/piladb.proto.
+const protobufContentType = "application/x-protobuf"
+
+// acceptsProtobuf determines whether the request
+// accepts a Protocol Buffers message as response.
+func acceptsProtobuf(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == protobufContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// isProtobuf determines whether the body of the
+// request is a Protocol Buffers message.
+func isProtobuf(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == protobufContentType
+}
+
+// writeProtobuf writes a Protocol Buffers message
+// as a response with the given status code.
+func writeProtobuf(w http.ResponseWriter, r *http.Request, code int, b []byte) {
+	logResponse(r, code, "content_type", protobufContentType)
+	w.Header().Set("Content-Type", protobufContentType)
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+// protoMessage is a value encoded as a Protocol Buffers message.
+type protoMessage interface {
+	ToProto() ([]byte, error)
+}
+
+// writeProtobufMessage writes a Protocol Buffers message as a 200
+// response, or returns 400 if the message could not be encoded.
+func writeProtobufMessage(w http.ResponseWriter, r *http.Request, m protoMessage) {
+	b, err := m.ToProto()
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on response serialization", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	writeProtobuf(w, r, http.StatusOK, b)
+}
+
+// ToProto converts the Status into a protobuf Status message.
+func (s *Status) ToProto() []byte {
+	var b []byte
+	b = protobuf.AppendString(b, 1, s.Code)
+	b = protobuf.AppendString(b, 2, s.Version)
+	b = protobuf.AppendString(b, 3, s.Host)
+	b = protobuf.AppendInt(b, 4, int64(s.PID))
+	b = protobuf.AppendInt(b, 5, s.StartedAt.UnixNano())
+	b = protobuf.AppendDouble(b, 6, s.RunningFor)
+	b = protobuf.AppendInt(b, 7, int64(s.NumberGoroutines))
+	b = protobuf.AppendString(b, 8, s.MemoryAlloc)
+	if s.Stats != nil {
+		b = protobuf.AppendBytes(b, 9, s.Stats.ToProto())
+	}
+	ops := make([]string, 0, len(s.Latencies))
+	for op := range s.Latencies {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		// map entries are messages of a key and a value
+		entry := protobuf.AppendString(nil, 1, op)
+		entry = protobuf.AppendBytes(entry, 2, s.Latencies[op].ToProto())
+		b = protobuf.AppendBytes(b, 10, entry)
+	}
+	return b
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/protobuf"
+)
+
+// protoField returns the last value of a field of a message, decoding
+// varints as uint64, fixed64 as float64, and bytes as string.
+func protoField(t *testing.T, b []byte, field int) interface{} {
+	var v interface{}
+	r := protobuf.NewReader(b)
+	for {
+		f, wire, ok := r.Next()
+		if !ok {
+			break
+		}
+		if f != field {
+			r.Skip()
+			continue
+		}
+		switch wire {
+		case protobuf.WireVarint:
+			v = r.Uint()
+		case protobuf.WireFixed64:
+			v = r.Double()
+		case protobuf.WireBytes:
+			v = r.String()
+		}
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestAcceptsProtobuf(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"application/x-protobuf", true},
+		{"application/json, application/x-protobuf;q=0.9", true},
+		{"*/*", false},
+	}
+
+	for _, io := range inputOutput {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", io.input)
+		if output := acceptsProtobuf(r); output != io.output {
+			t.Errorf("acceptsProtobuf(%q) is %v, expected %v", io.input, output, io.output)
+		}
+	}
+}
+
+func TestIsProtobuf(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"application/x-protobuf", true},
+		{"application/x-protobuf; messageType=piladb.Element", true},
+	}
+
+	for _, io := range inputOutput {
+		r, _ := http.NewRequest("POST", "/", nil)
+		r.Header.Set("Content-Type", io.input)
+		if output := isProtobuf(r); output != io.output {
+			t.Errorf("isProtobuf(%q) is %v, expected %v", io.input, output, io.output)
+		}
+	}
+}
+
+func TestStatusToProto(t *testing.T) {
+	now := time.Now()
+	status := NewStatus("v1", now, nil)
+	status.Stats = &pila.Stats{NumberDatabases: 2}
+	status.Latencies = map[string]pila.Percentiles{"push": {Count: 3}}
+
+	b := status.ToProto()
+	if v := protoField(t, b, 1); v != "OK" {
+		t.Errorf("status is %v, expected %v", v, "OK")
+	}
+	if v := protoField(t, b, 2); v != "v1" {
+		t.Errorf("version is %v, expected %v", v, "v1")
+	}
+	if v := protoField(t, b, 5); v != uint64(now.UnixNano()) {
+		t.Errorf("started_at is %v, expected %v", v, now.UnixNano())
+	}
+	stats, _ := protoField(t, b, 9).(string)
+	if v := protoField(t, []byte(stats), 1); v != uint64(2) {
+		t.Errorf("stats number_of_databases is %v, expected %v", v, 2)
+	}
+	latency, _ := protoField(t, b, 10).(string)
+	if v := protoField(t, []byte(latency), 1); v != "push" {
+		t.Errorf("latencies key is %v, expected %v", v, "push")
+	}
+	percentiles, _ := protoField(t, []byte(latency), 2).(string)
+	if v := protoField(t, []byte(percentiles), 1); v != uint64(3) {
+		t.Errorf("latencies push count is %v, expected %v", v, 3)
+	}
+}
+
+func TestProtobufHandlers(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := db.Stacks[db.CreateStack("stack", time.Now())]
+	handler := Router(conn)
+
+	do := func(method, path string, body []byte, contentType string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, bytes.NewReader(body))
+		request.Header.Set("Accept", protobufContentType)
+		if contentType != "" {
+			request.Header.Set("Content-Type", contentType)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("%s %s: response code is %v, expected %v", method, path, response.Code, http.StatusOK)
+		}
+		if ct := response.Header().Get("Content-Type"); ct != protobufContentType {
+			t.Fatalf("%s %s: content type is %s, expected %s", method, path, ct, protobufContentType)
+		}
+		return response
+	}
+
+	element, _ := pila.Element{Value: map[string]interface{}{"foo": "bar"}}.ToProto()
+	response := do("POST", "/databases/db/stacks/stack", element, protobufContentType)
+	if !bytes.Equal(response.Body.Bytes(), element) {
+		t.Errorf("pushed element is %x, expected %x", response.Body.Bytes(), element)
+	}
+	if peek, ok := stack.Peek().(map[string]interface{}); !ok || peek["foo"] != "bar" {
+		t.Errorf("peek is %v, expected %v", stack.Peek(), map[string]string{"foo": "bar"})
+	}
+
+	response = do("POST", "/databases/db/stacks/stack", []byte(`{"element":"baz"}`), "application/json")
+	if v := protoField(t, response.Body.Bytes(), 1); v != `"baz"` {
+		t.Errorf("pushed element value is %v, expected %v", v, `"baz"`)
+	}
+
+	response = do("GET", "/databases/db/stacks/stack?peek", nil, "")
+	if v := protoField(t, response.Body.Bytes(), 1); v != `"baz"` {
+		t.Errorf("peek value is %v, expected %v", v, `"baz"`)
+	}
+
+	response = do("GET", "/databases/db/stacks/stack", nil, "")
+	if v := protoField(t, response.Body.Bytes(), 2); v != "stack" {
+		t.Errorf("stack name is %v, expected %v", v, "stack")
+	}
+	if v := protoField(t, response.Body.Bytes(), 4); v != uint64(2) {
+		t.Errorf("stack size is %v, expected %v", v, 2)
+	}
+
+	response = do("GET", "/databases/db/stacks", nil, "")
+	stacks, _ := protoField(t, response.Body.Bytes(), 1).(string)
+	if v := protoField(t, []byte(stacks), 2); v != "stack" {
+		t.Errorf("stacks name is %v, expected %v", v, "stack")
+	}
+
+	response = do("GET", "/databases/db", nil, "")
+	if v := protoField(t, response.Body.Bytes(), 2); v != "db" {
+		t.Errorf("database name is %v, expected %v", v, "db")
+	}
+
+	response = do("GET", "/_status", nil, "")
+	if v := protoField(t, response.Body.Bytes(), 1); v != "OK" {
+		t.Errorf("status is %v, expected %v", v, "OK")
+	}
+
+	response = do("DELETE", "/databases/db/stacks/stack", nil, "")
+	if v := protoField(t, response.Body.Bytes(), 1); v != `"baz"` {
+		t.Errorf("popped element value is %v, expected %v", v, `"baz"`)
+	}
+
+	binary, _ := pila.Element{Value: []byte("hello"), ContentType: "text/plain"}.ToProto()
+	do("POST", "/databases/db/stacks/stack", binary, protobufContentType)
+	response = do("DELETE", "/databases/db/stacks/stack", nil, "")
+	if !bytes.Equal(response.Body.Bytes(), binary) {
+		t.Errorf("popped element is %x, expected %x", response.Body.Bytes(), binary)
+	}
+}
+
+func TestPushStackHandler_ProtobufBadRequest(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	db.CreateStack("stack", time.Now())
+
+	for _, body := range [][]byte{{0x0a, 0x05}, nil, protobuf.AppendString(nil, 1, "{")} {
+		request, _ := http.NewRequest("POST", "/databases/db/stacks/stack", bytes.NewReader(body))
+		request.Header.Set("Content-Type", protobufContentType)
+		response := httptest.NewRecorder()
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("%x: response code is %v, expected %v", body, response.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestWriteProtobufMessage_Error(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/", nil)
+	response := httptest.NewRecorder()
+	writeProtobufMessage(response, request, pila.Element{Value: make(chan int)})
+
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusBadRequest)
+	}
+}
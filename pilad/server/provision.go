@@ -0,0 +1,369 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+	"github.com/fern4lvarez/piladb/pkg/yaml"
+)
+
+// Manifest describes the Databases and Stacks that pilad must have,
+// see provisionHandler.
+type Manifest struct {
+	Databases []ManifestDatabase `json:"databases"`
+}
+
+// ManifestDatabase describes a Database of a Manifest.
+type ManifestDatabase struct {
+	Name      string          `json:"name"`
+	MaxMemory int64           `json:"max_memory,omitempty"`
+	Spill     int             `json:"spill,omitempty"`
+	Stacks    []ManifestStack `json:"stacks,omitempty"`
+}
+
+// ManifestStack describes a Stack of a ManifestDatabase, with the
+// same options as its creation, named like in its status.
+type ManifestStack struct {
+	Name      string              `json:"name"`
+	Type      pila.Structure      `json:"type,omitempty"`
+	MaxSize   int                 `json:"max_size,omitempty"`
+	Policy    pila.OverflowPolicy `json:"overflow_policy,omitempty"`
+	RateLimit int                 `json:"rate_limit,omitempty"`
+	TTL       string              `json:"ttl,omitempty"`
+	History   int                 `json:"history,omitempty"`
+	Compress  int                 `json:"compress,omitempty"`
+
+	ttl time.Duration
+}
+
+// Validate returns an error if any Database or Stack of the Manifest
+// has no name or a repeated one, or any of their options is invalid.
+// The default options of the Stacks are filled in.
+func (m *Manifest) Validate() error {
+	dbNames := make(map[string]bool)
+	for i := range m.Databases {
+		db := &m.Databases[i]
+		if err := validateName("name", db.Name); err != nil {
+			return fmt.Errorf("database %d: %v", i, err)
+		}
+		if dbNames[db.Name] {
+			return fmt.Errorf("database %s: repeated name", db.Name)
+		}
+		dbNames[db.Name] = true
+		if db.MaxMemory < 0 || db.Spill < 0 {
+			return fmt.Errorf("database %s: max_memory and spill must not be negative", db.Name)
+		}
+
+		stackNames := make(map[string]bool)
+		for j := range db.Stacks {
+			s := &db.Stacks[j]
+			if err := validateName("name", s.Name); err != nil {
+				return fmt.Errorf("database %s: stack %d: %v", db.Name, j, err)
+			}
+			if stackNames[s.Name] {
+				return fmt.Errorf("database %s: stack %s: repeated name", db.Name, s.Name)
+			}
+			stackNames[s.Name] = true
+			if err := s.validate(); err != nil {
+				return fmt.Errorf("database %s: stack %s: %v", db.Name, s.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validate returns an error if any option of the
+// ManifestStack is invalid, and fills in the defaults.
+func (s *ManifestStack) validate() error {
+	switch s.Type {
+	case "":
+		s.Type = pila.StructureStack
+	case pila.StructureStack, pila.StructureQueue, pila.StructurePriority:
+	default:
+		return fmt.Errorf("unknown type %s", s.Type)
+	}
+
+	if s.MaxSize < 0 || s.RateLimit < 0 || s.History < 0 || s.Compress < 0 {
+		return fmt.Errorf("max_size, rate_limit, history and compress must not be negative")
+	}
+	switch {
+	case s.Policy == "" && s.MaxSize > 0:
+		s.Policy = pila.OverflowReject
+	case s.Policy == "":
+	case s.MaxSize == 0:
+		return fmt.Errorf("overflow_policy %s requires max_size", s.Policy)
+	case s.Policy != pila.OverflowReject && s.Policy != pila.OverflowDropOldest:
+		return fmt.Errorf("unknown overflow_policy %s", s.Policy)
+	}
+
+	if s.TTL != "" {
+		ttl, err := time.ParseDuration(s.TTL)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("ttl must be a positive duration, got %s", s.TTL)
+		}
+		s.ttl = ttl
+	}
+	return nil
+}
+
+// ProvisionResult lists the Databases and Stacks, the latter
+// as database/stack, changed or kept by a Manifest.
+type ProvisionResult struct {
+	DryRun   bool     `json:"dry_run,omitempty"`
+	Created  []string `json:"created"`
+	Deleted  []string `json:"deleted"`
+	Existing []string `json:"existing"`
+}
+
+// ToJSON converts a ProvisionResult into JSON.
+func (result ProvisionResult) ToJSON() []byte {
+	// Do not check error as a ProvisionResult does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(result)
+	return b
+}
+
+// readManifest decodes the Manifest of a request body, as YAML
+// if its content type says so, or as JSON otherwise.
+func readManifest(r *http.Request) (Manifest, error) {
+	var manifest Manifest
+	if r.Body == nil {
+		return manifest, fmt.Errorf("no manifest provided")
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return manifest, err
+	}
+
+	if strings.Contains(r.Header.Get("Content-Type"), "yaml") {
+		value, err := yaml.Unmarshal(body)
+		if err != nil {
+			return manifest, err
+		}
+		// Do not check error as YAML values
+		// can always be encoded to JSON.
+		body, _ = json.Marshal(value)
+	}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return manifest, err
+	}
+	return manifest, manifest.Validate()
+}
+
+// boolParam returns the boolean value of the parameter key
+// of a request, false if it is not present.
+func boolParam(r *http.Request, key string) (bool, error) {
+	value := r.FormValue(key)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean, got %s", key, value)
+	}
+	return b, nil
+}
+
+// provisionHandler reconciles the Pila with the Manifest of the request
+// body: it creates the Databases and Stacks of the Manifest that do not
+// exist, keeping the existing ones as they are, and, if the prune
+// parameter is true, deletes the ones not in the Manifest. If the
+// dry_run parameter is true, nothing is changed. Returns 200 and the
+// ProvisionResult. Returns 400 if the Manifest or the parameters are
+// not valid, 409 if an existing Stack has another type, or on cluster
+// mode, where Databases and Stacks are spread over the nodes.
+func (c *Conn) provisionHandler(w http.ResponseWriter, r *http.Request) {
+	manifest, err := readManifest(r)
+	var prune, dryRun bool
+	if err == nil {
+		prune, err = boolParam(r, "prune")
+	}
+	if err == nil {
+		dryRun, err = boolParam(r, "dry_run")
+	}
+	if err == nil {
+		for _, db := range manifest.Databases {
+			if db.Spill > 0 && c.Pila.SpillDir() == "" {
+				err = fmt.Errorf("database %s: spill requires SPILL_DIR", db.Name)
+				break
+			}
+		}
+	}
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if c.Cluster.Enabled() {
+		logResponse(r, http.StatusConflict, "reason", "provisioning is not supported in cluster mode")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	for _, mdb := range manifest.Databases {
+		db, ok := c.Pila.DatabaseByName(mdb.Name)
+		if !ok {
+			continue
+		}
+		for _, ms := range mdb.Stacks {
+			if stack, ok := db.StackByName(ms.Name); ok && stack.Type != ms.Type {
+				logResponse(r, http.StatusConflict, "reason", "stack has another type", "stack", mdb.Name+"/"+ms.Name, "type", stack.Type)
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+	}
+
+	unlock := c.stackLocks.lockAll()
+	result, err := c.provision(r.Context(), manifest, prune, dryRun, requestDate(r))
+	unlock()
+	if err != nil {
+		logResponse(r, http.StatusInternalServerError, "reason", "error on provisioning", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !dryRun {
+		logger.Info("provisioned pila", "created", len(result.Created), "deleted", len(result.Deleted))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(result.ToJSON())
+}
+
+// provision creates the Databases and Stacks of a validated Manifest
+// that do not exist and, if prune is true, deletes the ones not in the
+// Manifest, unless dryRun is true, dating them now. It returns what
+// was, or would be, changed, and stops on the first error.
+func (c *Conn) provision(ctx context.Context, manifest Manifest, prune, dryRun bool, now time.Time) (ProvisionResult, error) {
+	result := ProvisionResult{DryRun: dryRun, Created: []string{}, Deleted: []string{}, Existing: []string{}}
+
+	names := make(map[string]ManifestDatabase)
+	for _, mdb := range manifest.Databases {
+		names[mdb.Name] = mdb
+
+		db, ok := c.Pila.DatabaseByName(mdb.Name)
+		if ok {
+			result.Existing = append(result.Existing, mdb.Name)
+		} else {
+			result.Created = append(result.Created, mdb.Name)
+			if !dryRun {
+				db = pila.NewDatabase(mdb.Name)
+				db.SetMaxMemory(mdb.MaxMemory)
+				db.SetSpill(mdb.Spill)
+				if err := c.Pila.AddDatabase(db); err != nil {
+					return result, err
+				}
+				c.persist(ctx, persist.Record{Op: persist.OpCreateDatabase, Time: now, Database: db.Name, MaxMemory: mdb.MaxMemory, Spill: mdb.Spill, ID: db.ID.String()})
+			}
+		}
+
+		for _, ms := range mdb.Stacks {
+			name := mdb.Name + "/" + ms.Name
+			if db != nil {
+				if _, ok := db.StackByName(ms.Name); ok {
+					result.Existing = append(result.Existing, name)
+					continue
+				}
+			}
+			result.Created = append(result.Created, name)
+			if !dryRun {
+				if err := c.provisionStack(ctx, db, ms, now); err != nil {
+					return result, fmt.Errorf("stack %s: %v", name, err)
+				}
+			}
+		}
+	}
+
+	if !prune {
+		return result, nil
+	}
+	c.Pila.ForEachDatabase(func(db *pila.Database) bool {
+		mdb, ok := names[db.Name]
+		if !ok {
+			result.Deleted = append(result.Deleted, db.Name)
+			if !dryRun {
+				c.deleteDatabase(ctx, db, now)
+			}
+			return true
+		}
+
+		keep := make(map[string]bool)
+		for _, ms := range mdb.Stacks {
+			keep[ms.Name] = true
+		}
+		var stacks []*pila.Stack
+		db.ForEachStack(func(s *pila.Stack) bool {
+			if !keep[s.Name] {
+				stacks = append(stacks, s)
+			}
+			return true
+		})
+		for _, s := range stacks {
+			result.Deleted = append(result.Deleted, db.Name+"/"+s.Name)
+			if !dryRun {
+				c.deleteStack(ctx, db, s, now)
+			}
+		}
+		return true
+	})
+	return result, nil
+}
+
+// provisionStack creates at date t the Stack of a ManifestStack into
+// db. Like on its creation, a Stack of type stack spills like its
+// Database, unless it compresses its elements.
+func (c *Conn) provisionStack(ctx context.Context, db *pila.Database, ms ManifestStack, t time.Time) error {
+	stack := pila.NewStructureWithLimit(ms.Type, ms.Name, t, ms.MaxSize, ms.Policy)
+	var spill int
+	if spillDir := c.Pila.SpillDir(); spillDir != "" && db.Spill() > 0 && ms.Compress == 0 && ms.Type == pila.StructureStack {
+		spill = db.Spill()
+		var err error
+		if stack, err = pila.NewSpillStack(ms.Name, t, spillDir, spill); err != nil {
+			return err
+		}
+		stack.MaxSize, stack.Policy = ms.MaxSize, ms.Policy
+	}
+	stack.RateLimit = ms.RateLimit
+	stack.TTL = ms.ttl
+	stack.SetHistoryDepth(ms.History)
+	stack.SetCompress(ms.Compress)
+	if err := db.AddStack(stack); err != nil {
+		return err
+	}
+	stack.Update(t)
+	c.persistStack(ctx, stack, persist.Record{Op: persist.OpCreateStack, Time: t, Type: ms.Type, MaxSize: ms.MaxSize, Policy: ms.Policy, RateLimit: ms.RateLimit, TTL: ms.ttl, Spill: spill, History: ms.History, Compress: ms.Compress, ID: stack.ID.String()})
+	return nil
+}
+
+// deleteDatabase deletes a Database along with its Stacks at date t.
+func (c *Conn) deleteDatabase(ctx context.Context, db *pila.Database, t time.Time) {
+	c.trashDatabase(db, t)
+	db.ForEachStack(func(s *pila.Stack) bool {
+		c.Webhooks.RemoveStack(s)
+		return true
+	})
+	_ = c.Pila.RemoveDatabase(db.ID)
+	c.persist(ctx, persist.Record{Op: persist.OpDeleteDatabase, Time: t, Database: db.Name})
+}
+
+// deleteStack flushes and deletes a Stack of a Database at date t.
+func (c *Conn) deleteStack(ctx context.Context, db *pila.Database, stack *pila.Stack, t time.Time) {
+	c.trashStack(db, stack, t)
+	stack.Flush()
+	// Do not check output as the stack
+	// is a Stack of the Database.
+	_ = db.RemoveStack(stack.ID)
+	c.Webhooks.RemoveStack(stack)
+	c.persist(ctx, persist.Record{Op: persist.OpDeleteStack, Time: t, Database: db.Name, Stack: stack.Name})
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestManifestValidate(t *testing.T) {
+	inputOutput := []struct {
+		input string
+		ok    bool
+	}{
+		{`{"databases":[]}`, true},
+		{`{"databases":[{"name":"db","stacks":[{"name":"s","type":"queue","max_size":10,"ttl":"1h"}]}]}`, true},
+		{`{"databases":[{"name":""}]}`, false},
+		{`{"databases":[{"name":"db"},{"name":"db"}]}`, false},
+		{`{"databases":[{"name":"db","max_memory":-1}]}`, false},
+		{`{"databases":[{"name":"db","stacks":[{"name":""}]}]}`, false},
+		{`{"databases":[{"name":"db","stacks":[{"name":"s"},{"name":"s"}]}]}`, false},
+		{`{"databases":[{"name":"db","stacks":[{"name":"s","type":"tree"}]}]}`, false},
+		{`{"databases":[{"name":"db","stacks":[{"name":"s","history":-1}]}]}`, false},
+		{`{"databases":[{"name":"db","stacks":[{"name":"s","overflow_policy":"reject"}]}]}`, false},
+		{`{"databases":[{"name":"db","stacks":[{"name":"s","max_size":1,"overflow_policy":"ignore"}]}]}`, false},
+		{`{"databases":[{"name":"db","stacks":[{"name":"s","ttl":"-1s"}]}]}`, false},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest("POST", "/_provision", strings.NewReader(io.input))
+		if _, err := readManifest(request); (err == nil) != io.ok {
+			t.Errorf("err is %v, expected ok %v for %s", err, io.ok, io.input)
+		}
+	}
+}
+
+func TestProvisionHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	kept := pila.NewStack("kept", time.Now())
+	kept.Push("foo")
+	_ = db.AddStack(kept)
+	_ = db.AddStack(pila.NewStack("extra", time.Now()))
+	_ = conn.Pila.AddDatabase(pila.NewDatabase("old"))
+	handler := Router(conn)
+
+	manifest := `
+databases:
+  - name: db
+    stacks:
+      - name: kept
+      - name: jobs
+        type: queue
+        max_size: 10
+        overflow_policy: drop_oldest
+        ttl: 1h
+        history: 2
+  - name: new
+    max_memory: 1024
+    stacks:
+      - name: events
+        rate_limit: 5
+`
+
+	inputOutput := []struct {
+		path, contentType, input string
+		code                     int
+		body                     string
+	}{
+		{"/_provision", "application/json", `{"databases":[{"name":""}]}`, http.StatusBadRequest, ""},
+		{"/_provision", "application/x-yaml", "databases: [db]", http.StatusBadRequest, ""},
+		{"/_provision?prune=maybe", "application/json", `{}`, http.StatusBadRequest, ""},
+		{"/_provision", "application/json", `{"databases":[{"name":"db","spill":10}]}`, http.StatusBadRequest, ""},
+		{"/_provision", "application/json", `{"databases":[{"name":"db","stacks":[{"name":"kept","type":"queue"}]}]}`, http.StatusConflict, ""},
+		{"/_provision?prune=true&dry_run=true", "application/x-yaml", manifest, http.StatusOK,
+			`{"dry_run":true,"created":["db/jobs","new","new/events"],"deleted":["db/extra","old"],"existing":["db","db/kept"]}`},
+		{"/_provision", "application/x-yaml", manifest, http.StatusOK,
+			`{"created":["db/jobs","new","new/events"],"deleted":[],"existing":["db","db/kept"]}`},
+		{"/_provision?prune=true", "application/x-yaml", manifest, http.StatusOK,
+			`{"created":[],"deleted":["db/extra","old"],"existing":["db","db/kept","db/jobs","new","new/events"]}`},
+		{"/_provision?prune=1", "application/json", `{"databases":[{"name":"new"}]}`, http.StatusOK,
+			`{"created":[],"deleted":["db","new/events"],"existing":["new"]}`},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("POST", io.path, strings.NewReader(io.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", io.contentType)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, io.path)
+		}
+		if body := response.Body.String(); io.body != "" && body != io.body {
+			t.Errorf("body is %s, expected %s for %s", body, io.body, io.path)
+		}
+		if io.path == "/_provision" && io.code == http.StatusOK {
+			jobs, ok := db.StackByName("jobs")
+			if !ok {
+				t.Fatal("stack jobs not created")
+			}
+			status := jobs.Status()
+			if status.Type != pila.StructureQueue || status.MaxSize != 10 || status.Policy != pila.OverflowDropOldest || status.TTL != "1h0m0s" || status.History != 2 {
+				t.Errorf("stack jobs status is %+v", status)
+			}
+			newDB, ok := conn.Pila.DatabaseByName("new")
+			if !ok || newDB.MaxMemory() != 1024 {
+				t.Fatal("database new not created with its max memory")
+			}
+			if events, ok := newDB.StackByName("events"); !ok || events.RateLimit != 5 {
+				t.Error("stack events not created with its rate limit")
+			}
+			if kept.Size() != 1 {
+				t.Errorf("stack kept size is %d, expected %d", kept.Size(), 1)
+			}
+		}
+	}
+
+	if _, ok := conn.Pila.DatabaseByName("db"); ok {
+		t.Error("database db not pruned")
+	}
+}
+
+func TestProvisionHandler_Cluster(t *testing.T) {
+	conn := NewConn()
+	conn.Cluster.Start("http://127.0.0.1:1205", "")
+
+	request, _ := http.NewRequest("POST", "/_provision", strings.NewReader(`{"databases":[{"name":"db"}]}`))
+	response := httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+
+	if response.Code != http.StatusConflict {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusConflict)
+	}
+	if _, ok := conn.Pila.DatabaseByName("db"); ok {
+		t.Error("database db is provisioned")
+	}
+}
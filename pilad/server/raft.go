@@ -0,0 +1,579 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+	"github.com/fern4lvarez/piladb/pkg/raft"
+)
+
+const (
+	// raftHeartbeatInterval is the time between two heartbeats
+	// of the Raft leader. Followers start an election after ten
+	// to twenty heartbeats without hearing from it.
+	raftHeartbeatInterval = 100 * time.Millisecond
+	// raftCommitTimeout is the time the leader waits for the
+	// operations of a request to be committed.
+	raftCommitTimeout = 5 * time.Second
+)
+
+// Raft replicates the operations modifying the Pila across the nodes
+// of a Raft group, if pilad belongs to one. Requests modifying the
+// Pila are served by the leader, and answered once their operations
+// are committed by the majority of the nodes, while every node serves
+// the reads. The leader serves them once the operations applied to
+// its Pila are committed.
+type Raft struct {
+	client *http.Client
+	// token authenticates the requests to other nodes, if any
+	token string
+	// node is nil if pilad does not belong to a Raft group
+	node *raft.Node
+	// storage saves the state of node, if pilad persists it
+	storage *raft.FileStorage
+
+	// mu protects the access to token, node and storage
+	mu sync.Mutex
+
+	// gate keeps the reads out of the leader while
+	// the operations it applied are not committed
+	gate raftGate
+}
+
+// RaftStatus represents the status of the Raft node of pilad.
+type RaftStatus struct {
+	Enabled bool `json:"enabled"`
+	*raft.Status
+}
+
+// ToJSON returns the RaftStatus in JSON format.
+func (s RaftStatus) ToJSON() []byte {
+	// Do not check error as the RaftStatus type does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// NewRaft returns a Raft that pilad does not belong to,
+// until StartRaft is called.
+func NewRaft() *Raft {
+	rf := &Raft{client: &http.Client{Timeout: 5 * time.Second}}
+	rf.gate.cond = sync.NewCond(&rf.gate.mu)
+	return rf
+}
+
+// Node returns the Raft node of pilad, nil if it
+// does not belong to a Raft group.
+func (rf *Raft) Node() *raft.Node {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.node
+}
+
+// Enabled returns whether pilad belongs to a Raft group.
+func (rf *Raft) Enabled() bool {
+	return rf.Node() != nil
+}
+
+// Stop stops the Raft node of pilad, if any, and
+// closes the storage of its state.
+func (rf *Raft) Stop() {
+	if node := rf.Node(); node != nil {
+		node.Stop()
+	}
+
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.storage != nil {
+		if err := rf.storage.Close(); err != nil {
+			logger.Error("error on closing raft storage", "error", err)
+		}
+		rf.storage = nil
+	}
+}
+
+// Status returns the RaftStatus of pilad.
+func (rf *Raft) Status() RaftStatus {
+	node := rf.Node()
+	if node == nil {
+		return RaftStatus{}
+	}
+	status := node.Status()
+	return RaftStatus{Enabled: true, Status: &status}
+}
+
+// Vote sends a VoteRequest to the node at the peer URL.
+func (rf *Raft) Vote(peer string, req raft.VoteRequest) (raft.VoteResponse, error) {
+	var res raft.VoteResponse
+	err := rf.request(peer, "/_raft/vote", req, &res)
+	return res, err
+}
+
+// Append sends an AppendRequest to the node at the peer URL.
+func (rf *Raft) Append(peer string, req raft.AppendRequest) (raft.AppendResponse, error) {
+	var res raft.AppendResponse
+	err := rf.request(peer, "/_raft/append", req, &res)
+	return res, err
+}
+
+// request posts req in JSON to the path of the node
+// at the peer URL, and decodes its answer into res.
+func (rf *Raft) request(peer, path string, req, res interface{}) error {
+	// Do not check error as Raft requests
+	// are always encoded.
+	b, _ := json.Marshal(req)
+	request, err := http.NewRequest("POST", peer+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	rf.mu.Lock()
+	if rf.token != "" {
+		request.Header.Set("Authorization", "Bearer "+rf.token)
+	}
+	rf.mu.Unlock()
+
+	response, err := rf.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return json.NewDecoder(response.Body).Decode(res)
+}
+
+// propose proposes a Record to the Raft group, if pilad belongs to
+// one, tracking its entry in the raftRequest of ctx, if any. If it is
+// not proposed, e.g. because pilad is no longer the leader, its Pila
+// is synchronized again with the committed Records, discarding the
+// Record, once the request is answered.
+func (rf *Raft) propose(ctx context.Context, record persist.Record) {
+	node := rf.Node()
+	if node == nil {
+		return
+	}
+
+	// Do not check error as Records
+	// are always encoded.
+	data, _ := json.Marshal(record)
+	index, err := node.Propose(data)
+	if err != nil {
+		logger.Warn("error on proposing to raft", "op", record.Op, "error", err)
+	}
+	if rr, ok := ctx.Value(raftKey).(*raftRequest); ok && rr.proposed(index, err) {
+		return
+	}
+	if err != nil {
+		go node.Resync()
+	}
+}
+
+// raftRequest tracks the entries proposed by a request to the Raft
+// leader, which holds the writes of its raftGate until they are
+// committed, so reads do not see the operations of the request before.
+// Methods of a nil raftRequest do nothing.
+type raftRequest struct {
+	gate *raftGate
+	// held is true while the request holds the writes
+	held bool
+	// indexes are the indexes of the proposed entries, and
+	// err the error of the first proposal that failed
+	indexes []uint64
+	err     error
+	// answered is true once the request is answered,
+	// so later proposals are not tracked
+	answered bool
+
+	mu sync.Mutex
+}
+
+// raftRequestFromContext returns the raftRequest of the
+// request context, nil if it is not served by a Raft leader.
+func raftRequestFromContext(r *http.Request) *raftRequest {
+	rr, _ := r.Context().Value(raftKey).(*raftRequest)
+	return rr
+}
+
+// hold holds the writes of the raftGate, unless already held.
+func (rr *raftRequest) hold() {
+	if rr == nil {
+		return
+	}
+	rr.mu.Lock()
+	held := rr.held
+	rr.held = true
+	rr.mu.Unlock()
+	if !held {
+		rr.gate.enter(raftWrites)
+	}
+}
+
+// release releases the writes of the raftGate, if held,
+// unless entries were proposed and not answered yet.
+func (rr *raftRequest) release() {
+	if rr == nil {
+		return
+	}
+	rr.mu.Lock()
+	held := rr.held && (rr.answered || len(rr.indexes) == 0 && rr.err == nil)
+	if held {
+		rr.held = false
+	}
+	rr.mu.Unlock()
+	if held {
+		rr.gate.leave(raftWrites)
+	}
+}
+
+// proposed tracks the index of an entry proposed by the
+// request, or the error proposing it, and returns false
+// if the request was already answered.
+func (rr *raftRequest) proposed(index uint64, err error) bool {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	if rr.answered {
+		return false
+	}
+	if err != nil {
+		if rr.err == nil {
+			rr.err = err
+		}
+		return true
+	}
+	rr.indexes = append(rr.indexes, index)
+	return true
+}
+
+// commit waits until the entries proposed by the request are
+// committed, up to timeout, and marks the request as answered.
+// If any entry was not proposed or committed, the Pila of node
+// is synchronized again with the committed Records, discarding
+// the operations of the request, and an error is returned.
+func (rr *raftRequest) commit(node *raft.Node, timeout time.Duration) error {
+	rr.mu.Lock()
+	rr.answered = true
+	indexes, err := rr.indexes, rr.err
+	rr.mu.Unlock()
+
+	deadline := time.Now().Add(timeout)
+	for _, index := range indexes {
+		if err != nil {
+			break
+		}
+		err = node.Wait(index, deadline.Sub(time.Now()))
+	}
+	if err != nil {
+		node.Resync()
+	}
+	return err
+}
+
+// StartRaft makes pilad a node of a Raft group, given the URL other
+// nodes reach it at, the URLs of the other nodes and the token
+// authenticating its requests to them, if any. The leader sends a
+// heartbeat to the others every heartbeat interval. If dir is not
+// empty, the term, the vote and the log of the node are saved into
+// it, and restored from it, so the committed Records are applied
+// again to the Pila after restarting.
+func (c *Conn) StartRaft(self string, peers []string, token, dir string, heartbeat time.Duration) error {
+	self = strings.TrimRight(self, "/")
+	var others []string
+	for _, peer := range clusterNodes(peers) {
+		if peer != self {
+			others = append(others, peer)
+		}
+	}
+
+	config := raft.Config{
+		ID:                self,
+		Peers:             others,
+		Transport:         c.Raft,
+		Apply:             c.applyRaft,
+		Reset:             c.resetRaft,
+		HeartbeatInterval: heartbeat,
+	}
+	var storage *raft.FileStorage
+	if dir != "" {
+		var err error
+		if storage, err = raft.OpenFileStorage(dir); err != nil {
+			return err
+		}
+		config.Storage = storage
+	}
+	node, err := raft.Open(config)
+	if err != nil {
+		if storage != nil {
+			storage.Close()
+		}
+		return err
+	}
+
+	c.Raft.mu.Lock()
+	defer c.Raft.mu.Unlock()
+	c.Raft.token = token
+	c.Raft.node = node
+	c.Raft.storage = storage
+	c.Raft.node.Start()
+	return nil
+}
+
+// applyRaft applies to the Pila a Record committed by the Raft group.
+func (c *Conn) applyRaft(data json.RawMessage) {
+	var record persist.Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		logger.Error("error on decoding raft entry", "error", err)
+		return
+	}
+
+	c.Replication.writes.RLock()
+	err := persist.Apply(c.Pila, record)
+	if err == nil {
+		c.Replication.publish(record)
+	}
+	c.Replication.writes.RUnlock()
+	if err != nil {
+		logger.Error("error on applying raft entry", "op", record.Op, "error", err)
+	}
+}
+
+// resetRaft empties the Pila, before the Records
+// committed by the Raft group are applied again.
+func (c *Conn) resetRaft() {
+	var empty bytes.Buffer
+	// Do not check error as an empty
+	// Pila is always serialized.
+	_ = pila.NewPila().Snapshot(&empty)
+
+	c.Replication.writes.RLock()
+	defer c.Replication.writes.RUnlock()
+	if err := c.Pila.Restore(&empty); err != nil {
+		logger.Error("error on resetting pila", "error", err)
+	}
+	c.Replication.reset()
+}
+
+// RaftMiddleware returns a middleware that, while pilad belongs to a
+// Raft group, redirects the requests modifying the Pila to the leader
+// with 307 Temporary Redirect, or answers them with 503 Service
+// Unavailable if there is none. The leader answers them once their
+// operations are committed, or with 503 if they are not proposed or
+// committed in time, and serves the reads of the Pila once there are
+// no operations applied to it waiting to be committed.
+// Restoring a snapshot is not replicated, so it is answered with 409.
+func RaftMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			node := conn.Raft.Node()
+			if node == nil || !modifiesPila(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !isMutating(r.Method) {
+				// streams are served as operations are applied
+				if node.IsLeader() && !isStream(r) {
+					conn.Raft.gate.enter(raftReads)
+					defer conn.Raft.gate.leave(raftReads)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.URL.Path == "/_restore" {
+				logResponse(r, http.StatusConflict, "reason", "snapshots are not restored in raft mode")
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+
+			if !node.IsLeader() {
+				leader := node.Leader()
+				if leader == "" {
+					logResponse(r, http.StatusServiceUnavailable, "reason", "no raft leader")
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				logResponse(r, http.StatusTemporaryRedirect, "reason", "not the raft leader", "leader", leader)
+				http.Redirect(w, r, leader+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+				return
+			}
+
+			// blocking pops hold the writes only once they pop
+			rr := &raftRequest{gate: &conn.Raft.gate}
+			if !isBlockingPop(r) {
+				rr.hold()
+			}
+			defer rr.release()
+
+			rw := newRaftResponseWriter()
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), raftKey, rr)))
+			if err := rr.commit(node, raftCommitTimeout); err != nil {
+				logResponse(r, http.StatusServiceUnavailable, "reason", "error on committing", "error", err)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			rw.writeTo(w)
+		})
+	}
+}
+
+// isStream returns true if the request streams the
+// elements or the events of a Stack as they change.
+func isStream(r *http.Request) bool {
+	return strings.HasSuffix(r.URL.Path, "/_export") || strings.HasSuffix(r.URL.Path, "/_subscribe")
+}
+
+const (
+	// raftWrites are the requests modifying the Pila
+	raftWrites = iota
+	// raftReads are the requests reading it
+	raftReads
+)
+
+// raftGate lets in either the requests modifying the Pila or the ones
+// reading it, any number of them of the same kind at once. While the
+// requests of one kind are in, new ones of that kind wait if the other
+// kind is waiting, so they take turns and none of them starves.
+type raftGate struct {
+	// in and waiting are the number of requests
+	// of each kind in and waiting to enter
+	in      [2]int
+	waiting [2]int
+	// turn is the kind entering first once both wait
+	turn int
+
+	mu   sync.Mutex
+	cond *sync.Cond
+}
+
+// enter waits until a request of kind can enter, and enters.
+func (g *raftGate) enter(kind int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	other := 1 - kind
+	if g.in[other] > 0 {
+		g.turn = kind
+	}
+	g.waiting[kind]++
+	for g.in[other] > 0 || g.waiting[other] > 0 && g.turn == other {
+		g.cond.Wait()
+	}
+	g.waiting[kind]--
+	g.in[kind]++
+}
+
+// leave leaves the gate, letting in the waiting requests
+// of the other kind once the ones of kind are out.
+func (g *raftGate) leave(kind int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.in[kind]--
+	if g.in[kind] == 0 {
+		g.turn = 1 - kind
+		g.cond.Broadcast()
+	}
+}
+
+// raftResponseWriter is an http.ResponseWriter keeping the
+// response until the operations of the request are committed.
+type raftResponseWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func newRaftResponseWriter() *raftResponseWriter {
+	return &raftResponseWriter{header: make(http.Header), code: http.StatusOK}
+}
+
+func (rw *raftResponseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *raftResponseWriter) WriteHeader(code int) {
+	rw.code = code
+}
+
+func (rw *raftResponseWriter) Write(b []byte) (int, error) {
+	return rw.body.Write(b)
+}
+
+// writeTo writes the kept response into w.
+func (rw *raftResponseWriter) writeTo(w http.ResponseWriter) {
+	for key, values := range rw.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(rw.code)
+	w.Write(rw.body.Bytes())
+}
+
+// raftHandler returns the RaftStatus of pilad.
+func (c *Conn) raftHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(c.Raft.Status().ToJSON())
+}
+
+// raftVoteHandler answers the VoteRequest of a Raft candidate with
+// 200 and its VoteResponse. Returns 409 if pilad does not belong to
+// a Raft group, and 400 if the request is malformed.
+func (c *Conn) raftVoteHandler(w http.ResponseWriter, r *http.Request) {
+	node := c.Raft.Node()
+	if node == nil {
+		logResponse(r, http.StatusConflict, "reason", "raft is disabled")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	var req raft.VoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on decoding vote request", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Do not check error as the VoteResponse type does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(node.HandleVote(req))
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// raftAppendHandler answers the AppendRequest of a Raft leader with
+// 200 and its AppendResponse. Returns 409 if pilad does not belong
+// to a Raft group, and 400 if the request is malformed. Answers are
+// not logged, as the leader sends a request every heartbeat.
+func (c *Conn) raftAppendHandler(w http.ResponseWriter, r *http.Request) {
+	node := c.Raft.Node()
+	if node == nil {
+		logResponse(r, http.StatusConflict, "reason", "raft is disabled")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	var req raft.AppendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on decoding append request", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Do not check error as the AppendResponse type does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(node.HandleAppend(req))
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/raft"
+)
+
+// newRaftNodes starts a Raft group of n nodes,
+// saving their state into dir if not empty.
+func newRaftNodes(t *testing.T, n int, dir string) []clusterNode {
+	nodes := make([]clusterNode, n)
+	urls := make([]string, n)
+	for i := range nodes {
+		conn := NewConn()
+		handler := RaftMiddleware(conn)(ReplicationMiddleware(conn)(Router(conn)))
+		nodes[i] = clusterNode{conn: conn, server: httptest.NewServer(handler)}
+		urls[i] = nodes[i].server.URL
+	}
+	for _, node := range nodes {
+		if err := node.conn.StartRaft(node.server.URL, urls, "", dir, 10*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return nodes
+}
+
+// waitRaftLeader waits until a node of the group is
+// the leader, and returns it, or fails after two seconds.
+func waitRaftLeader(t *testing.T, nodes []clusterNode) clusterNode {
+	for i := 0; i < 200; i++ {
+		for _, node := range nodes {
+			if node.conn.Raft.Node().IsLeader() {
+				return node
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("no raft leader was elected")
+	return clusterNode{}
+}
+
+func TestRaft(t *testing.T) {
+	nodes := newRaftNodes(t, 3, "")
+	for _, node := range nodes {
+		defer node.server.Close()
+		defer node.conn.Raft.Stop()
+	}
+	leader := waitRaftLeader(t, nodes)
+
+	inputOutput := []struct {
+		method, path string
+		body         string
+		code         int
+	}{
+		{"PUT", "/databases?name=db", "", http.StatusCreated},
+		{"PUT", "/databases/db/stacks?name=stack", "", http.StatusCreated},
+		{"POST", "/databases/db/stacks/stack", `{"element":"foo"}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/stack", `{"element":"bar"}`, http.StatusOK},
+		{"DELETE", "/databases/db/stacks/stack", "", http.StatusOK},
+		{"POST", "/_restore", "{}", http.StatusConflict},
+	}
+	for _, io := range inputOutput {
+		if code, _ := leader.do(t, io.method, io.path, io.body); code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", code, io.code, io.method, io.path)
+		}
+	}
+
+	// followers serve reads once they apply the committed operations
+	for _, node := range nodes {
+		var code int
+		var body string
+		for i := 0; i < 100; i++ {
+			if code, body = node.do(t, "GET", "/databases/db/stacks/stack/peek", ""); body == `{"element":"foo"}` {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if code != http.StatusOK || body != `{"element":"foo"}` {
+			t.Errorf("peek on %s is %v %s", node.server.URL, code, body)
+		}
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	for _, node := range nodes {
+		if node == leader {
+			continue
+		}
+		response, err := client.Post(node.server.URL+"/databases/db/stacks/stack", "application/json", strings.NewReader(`{"element":"baz"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if location := response.Header.Get("Location"); response.StatusCode != http.StatusTemporaryRedirect || location != leader.server.URL+"/databases/db/stacks/stack" {
+			t.Errorf("response is %v %s, expected %v %s", response.StatusCode, location, http.StatusTemporaryRedirect, leader.server.URL)
+		}
+	}
+
+	code, body := leader.do(t, "GET", "/_raft", "")
+	var status RaftStatus
+	if err := json.Unmarshal([]byte(body), &status); err != nil || code != http.StatusOK {
+		t.Fatalf("response is %v %s", code, body)
+	}
+	if !status.Enabled || status.State != raft.Leader || status.Leader != leader.server.URL || len(status.Peers) != 2 {
+		t.Errorf("raft status is %s", body)
+	}
+}
+
+func TestRaft_Resync(t *testing.T) {
+	nodes := newRaftNodes(t, 1, "")
+	defer nodes[0].server.Close()
+	defer nodes[0].conn.Raft.Stop()
+	conn := waitRaftLeader(t, nodes).conn
+
+	if code, _ := nodes[0].do(t, "PUT", "/databases?name=db", ""); code != http.StatusCreated {
+		t.Fatalf("response code is %v, expected %v", code, http.StatusCreated)
+	}
+
+	// a database created without being committed is discarded
+	conn.Pila.CreateDatabase("lost")
+	conn.Raft.Node().Resync()
+	if _, ok := conn.Pila.DatabaseByName("lost"); ok {
+		t.Error("database was not discarded")
+	}
+	if _, ok := conn.Pila.DatabaseByName("db"); !ok {
+		t.Error("database was not applied again")
+	}
+}
+
+func TestRaftHandlers_Errors(t *testing.T) {
+	nodes := newRaftNodes(t, 1, "")
+	defer nodes[0].server.Close()
+	defer nodes[0].conn.Raft.Stop()
+	disabled := clusterNode{conn: NewConn()}
+	disabled.server = httptest.NewServer(Router(disabled.conn))
+	defer disabled.server.Close()
+
+	inputOutput := []struct {
+		node         clusterNode
+		method, path string
+		body         string
+		code         int
+	}{
+		{disabled, "GET", "/_raft", "", http.StatusOK},
+		{disabled, "POST", "/_raft/vote", "{}", http.StatusConflict},
+		{disabled, "POST", "/_raft/append", "{}", http.StatusConflict},
+		{nodes[0], "POST", "/_raft/vote", "{", http.StatusBadRequest},
+		{nodes[0], "POST", "/_raft/append", "{", http.StatusBadRequest},
+		{nodes[0], "POST", "/_raft/vote", "{}", http.StatusOK},
+	}
+
+	for _, io := range inputOutput {
+		if code, _ := io.node.do(t, io.method, io.path, io.body); code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", code, io.code, io.method, io.path)
+		}
+	}
+
+	if status := disabled.conn.Raft.Status(); status.Enabled || status.Status != nil {
+		t.Errorf("raft status is %+v", status)
+	}
+}
+
+func TestConnPersist_Raft(t *testing.T) {
+	conn := NewConn()
+	if err := conn.StartRaft("http://localhost:1205", []string{"http://localhost:1206", "http://localhost:1207"}, "", "", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Raft.Stop()
+
+	// a follower discards the Records it could not propose
+	conn.Pila.CreateDatabase("db")
+	conn.persist(context.Background(), persist.Record{Op: persist.OpCreateDatabase, Database: "db"})
+	for i := 0; i < 100; i++ {
+		if _, ok := conn.Pila.DatabaseByName("db"); !ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("database was not discarded")
+}
+
+func TestRaft_ProposalFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-raft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	nodes := newRaftNodes(t, 1, dir)
+	defer nodes[0].server.Close()
+	defer nodes[0].conn.Raft.Stop()
+	conn := waitRaftLeader(t, nodes).conn
+
+	// the Raft log can not be saved anymore
+	conn.Raft.storage.Close()
+	if code, _ := nodes[0].do(t, "PUT", "/databases?name=db", ""); code != http.StatusServiceUnavailable {
+		t.Errorf("response code is %v, expected %v", code, http.StatusServiceUnavailable)
+	}
+	if _, ok := conn.Pila.DatabaseByName("db"); ok {
+		t.Error("database was not discarded")
+	}
+}
+
+func TestRaft_Restart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-raft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	nodes := newRaftNodes(t, 1, dir)
+	waitRaftLeader(t, nodes)
+	for _, path := range []string{"/databases?name=db", "/databases/db/stacks?name=stack"} {
+		if code, _ := nodes[0].do(t, "PUT", path, ""); code != http.StatusCreated {
+			t.Fatalf("response code is %v, expected %v for %s", code, http.StatusCreated, path)
+		}
+	}
+	if code, _ := nodes[0].do(t, "POST", "/databases/db/stacks/stack", `{"element":"foo"}`); code != http.StatusOK {
+		t.Fatalf("response code is %v, expected %v", code, http.StatusOK)
+	}
+	nodes[0].conn.Raft.Stop()
+	nodes[0].server.Close()
+
+	// the committed operations are applied again once
+	// the restarted node commits an entry of its term
+	nodes = newRaftNodes(t, 1, dir)
+	defer nodes[0].server.Close()
+	defer nodes[0].conn.Raft.Stop()
+	waitRaftLeader(t, nodes)
+	if code, body := nodes[0].do(t, "GET", "/databases/db/stacks/stack/peek", ""); code != http.StatusOK || body != `{"element":"foo"}` {
+		t.Errorf("peek is %v %s", code, body)
+	}
+	if status := nodes[0].conn.Raft.Status(); status.Term < 2 {
+		t.Errorf("raft term is %d, expected greater than %d", status.Term, 1)
+	}
+}
+
+func TestRaftGate(t *testing.T) {
+	gate := &NewRaft().gate
+
+	entered := make(chan int, 3)
+	enter := func(kind int) {
+		gate.enter(kind)
+		entered <- kind
+	}
+
+	gate.enter(raftWrites)
+	go enter(raftReads)
+	// a write waits for the waiting read
+	time.Sleep(10 * time.Millisecond)
+	go enter(raftWrites)
+	select {
+	case kind := <-entered:
+		t.Fatalf("request of kind %d entered with a write in", kind)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	gate.leave(raftWrites)
+	if kind := <-entered; kind != raftReads {
+		t.Fatalf("request of kind %d entered, expected %d", kind, raftReads)
+	}
+	select {
+	case <-entered:
+		t.Fatal("write entered with a read in")
+	case <-time.After(10 * time.Millisecond):
+	}
+	gate.leave(raftReads)
+	if kind := <-entered; kind != raftWrites {
+		t.Fatalf("request of kind %d entered, expected %d", kind, raftWrites)
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// rateLimiterSweepSize is the number of buckets of a RateLimiter
+// above which the full ones are removed, as they are equivalent to
+// a bucket that does not exist yet.
+const rateLimiterSweepSize = 1024
+
+// tokenBucket holds the tokens that requests take to be served,
+// refilled at rate tokens per second up to burst tokens.
+type tokenBucket struct {
+	rate, burst float64
+	tokens      float64
+	last        time.Time
+}
+
+// refill adds the tokens accumulated since the last refill.
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+	}
+	b.last = now
+}
+
+// take takes a token from the bucket. If there is none, it returns
+// false and the time to wait until the next one is available.
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / b.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// RateLimiter limits the rate of requests by key, like a
+// client or a Stack, with a token bucket per key.
+type RateLimiter struct {
+	buckets map[string]*tokenBucket
+
+	// mu protects the access to buckets
+	mu sync.Mutex
+}
+
+// NewRateLimiter returns a RateLimiter without buckets.
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// Allow determines whether a request on key can be served at now,
+// given a limit of rate requests per second, which can be exceeded
+// by bursts of up to rate requests. Otherwise, it returns the time
+// to wait before retrying. Requests are always allowed if rate is 0.
+func (l *RateLimiter) Allow(key string, rate int, now time.Time) (bool, time.Duration) {
+	if rate <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= rateLimiterSweepSize {
+			l.sweep(now)
+		}
+		b = &tokenBucket{tokens: float64(rate), last: now}
+		l.buckets[key] = b
+	}
+	// the rate may change at runtime
+	b.rate, b.burst = float64(rate), float64(rate)
+	return b.take(now)
+}
+
+// sweep removes the buckets that are full at now.
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.refill(now); b.tokens >= b.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimitMiddleware returns a middleware that answers with 429 Too
+// Many Requests the requests of a client exceeding RATE_LIMIT_CLIENT.
+// Clients are identified by their API Token if given, or their IP
+// address otherwise.
+func RateLimitMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, retry := conn.RateLimiter.Allow(clientKey(r), conn.Config.RateLimitClient(), time.Now())
+			if !ok {
+				conn.tooManyRequestsHandler(w, r, retry, "client rate limit reached")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowStack determines whether a request on the Stack can be served,
+// given its RateLimit, or RATE_LIMIT_STACK if it is not overridden.
+// Otherwise, it answers the request with 429 Too Many Requests.
+func (c *Conn) allowStack(w http.ResponseWriter, r *http.Request, stack *pila.Stack) bool {
+	rate := stack.RateLimit
+	if rate == 0 {
+		rate = c.Config.RateLimitStack()
+	}
+	ok, retry := c.RateLimiter.Allow("stack "+stack.ID.String(), rate, time.Now())
+	if !ok {
+		c.tooManyRequestsHandler(w, r, retry, "stack rate limit reached")
+	}
+	return ok
+}
+
+// clientKey returns the key identifying the client
+// of a request in the RateLimiter.
+func clientKey(r *http.Request) string {
+	if token := requestToken(r); token != "" {
+		return "token " + token
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip " + host
+}
+
+// tooManyRequestsHandler logs and returns 429 for a rate limited
+// request, with the seconds to wait before retrying in Retry-After.
+func (c *Conn) tooManyRequestsHandler(w http.ResponseWriter, r *http.Request, retry time.Duration, reason string) {
+	seconds := int(math.Ceil(retry.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	logResponse(r, http.StatusTooManyRequests, "reason", reason)
+	w.WriteHeader(http.StatusTooManyRequests)
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	l := NewRateLimiter()
+	now := time.Now()
+
+	inputOutput := []struct {
+		key     string
+		rate    int
+		elapsed time.Duration
+		ok      bool
+		retry   time.Duration
+	}{
+		{"foo", 2, 0, true, 0},
+		{"foo", 2, 0, true, 0},
+		{"foo", 2, 0, false, 500 * time.Millisecond},
+		{"bar", 2, 0, true, 0},
+		{"foo", 2, 250 * time.Millisecond, false, 250 * time.Millisecond},
+		{"foo", 2, 500 * time.Millisecond, true, 0},
+		{"foo", 0, 500 * time.Millisecond, true, 0},
+		{"foo", 1, 500 * time.Millisecond, false, time.Second},
+		{"foo", 1, 2 * time.Second, true, 0},
+	}
+
+	for _, io := range inputOutput {
+		ok, retry := l.Allow(io.key, io.rate, now.Add(io.elapsed))
+		if ok != io.ok || retry != io.retry {
+			t.Errorf("Allow(%s, %d, +%v) is %t %v, expected %t %v", io.key, io.rate, io.elapsed, ok, retry, io.ok, io.retry)
+		}
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	l := NewRateLimiter()
+	now := time.Now()
+
+	for i := 0; i < rateLimiterSweepSize; i++ {
+		l.Allow(fmt.Sprintf("client %d", i), 1, now)
+	}
+	l.Allow("busy", 1, now.Add(time.Second))
+	l.Allow("new", 1, now.Add(time.Second))
+
+	if n := len(l.buckets); n != 2 {
+		t.Errorf("number of buckets is %d, expected %d", n, 2)
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/_status", nil)
+	request.RemoteAddr = "10.0.0.1:34567"
+	if key := clientKey(request); key != "ip 10.0.0.1" {
+		t.Errorf("key is %s, expected %s", key, "ip 10.0.0.1")
+	}
+
+	request.Header.Set("Authorization", "Bearer s3cr3t")
+	if key := clientKey(request); key != "token s3cr3t" {
+		t.Errorf("key is %s, expected %s", key, "token s3cr3t")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set(vars.RateLimitClient, 2)
+	handler := RateLimitMiddleware(conn)(Router(conn))
+
+	inputOutput := []struct {
+		remoteAddr string
+		code       int
+	}{
+		{"10.0.0.1:1", http.StatusOK},
+		{"10.0.0.1:2", http.StatusOK},
+		{"10.0.0.1:3", http.StatusTooManyRequests},
+		{"10.0.0.2:1", http.StatusOK},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest("GET", "/_status", nil)
+		request.RemoteAddr = io.remoteAddr
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, io.remoteAddr)
+		}
+		if io.code == http.StatusTooManyRequests {
+			if retry := response.Header().Get("Retry-After"); retry != "1" {
+				t.Errorf("Retry-After is %s, expected %s", retry, "1")
+			}
+		}
+	}
+}
+
+func TestStackRateLimit(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set(vars.RateLimitStack, 2)
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path string
+		code         int
+	}{
+		{"PUT", "/databases?name=db", http.StatusCreated},
+		{"PUT", "/databases/db/stacks?name=global", http.StatusCreated},
+		{"PUT", "/databases/db/stacks?name=override&rate_limit=3", http.StatusCreated},
+		{"PUT", "/databases/db/stacks?name=invalid&rate_limit=0", http.StatusBadRequest},
+		{"POST", "/databases/db/stacks/global/pop", http.StatusNotFound},
+		{"GET", "/databases/db/stacks/global/size", http.StatusOK},
+		{"GET", "/databases/db/stacks/global/peek", http.StatusOK},
+		{"GET", "/databases/db/stacks/global", http.StatusTooManyRequests},
+		{"GET", "/databases/db/stacks/override", http.StatusOK},
+		{"GET", "/databases/db/stacks/override", http.StatusOK},
+		{"GET", "/databases/db/stacks/override", http.StatusOK},
+		{"GET", "/databases/db/stacks/override/size", http.StatusTooManyRequests},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+	}
+
+	db, _ := ResourceDatabase(conn, "db")
+	stack, _ := ResourceStack(db, "override")
+	if stack.Status().RateLimit != 3 {
+		t.Errorf("stack rate limit is %d, expected %d", stack.Status().RateLimit, 3)
+	}
+}
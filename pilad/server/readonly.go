@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// ReadOnly returns true if pilad is in read-only mode, rejecting
+// every request that modifies it.
+func (c *Conn) ReadOnly() bool {
+	return atomic.LoadInt32(&c.readOnly) == 1
+}
+
+// SetReadOnly enables or disables the read-only mode of pilad.
+func (c *Conn) SetReadOnly(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&c.readOnly, v)
+}
+
+// ReadOnlyMiddleware returns a middleware that answers requests with a
+// mutating method with 403 Forbidden while pilad is in read-only mode.
+// Toggling the mode or the debug endpoints, cancelling operations in
+// flight, shutting pilad down, taking snapshots, compacting the
+// persistence log and the requests between Raft nodes are still allowed.
+func ReadOnlyMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if conn.ReadOnly() && isMutating(r.Method) &&
+				r.URL.Path != "/_read_only" && r.URL.Path != "/_debug" && r.URL.Path != "/_shutdown" &&
+				r.URL.Path != "/_snapshots" && r.URL.Path != "/_compact" &&
+				!strings.HasPrefix(r.URL.Path, "/_ops/") &&
+				!strings.HasPrefix(r.URL.Path, "/_raft/") {
+				logResponse(r, http.StatusForbidden, "reason", "read-only mode")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// readOnlyHandler returns whether pilad is in read-only mode, and
+// enables or disables it on PUT, given the enabled parameter.
+func (c *Conn) readOnlyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "PUT" {
+		enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+		if err != nil {
+			logResponse(r, http.StatusBadRequest, "reason", "invalid enabled value", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if enabled != c.ReadOnly() {
+			c.SetReadOnly(enabled)
+			logger.Info("read-only mode changed", "enabled", enabled)
+		}
+	}
+
+	// Do not check error as a map of booleans
+	// is always valid for a JSON encoding.
+	b, _ := json.Marshal(map[string]bool{"read_only": c.ReadOnly()})
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(b)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadOnlyMiddleware(t *testing.T) {
+	conn := NewConn()
+	handler := ReadOnlyMiddleware(conn)(Router(conn))
+
+	inputOutput := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"GET", "/_read_only", http.StatusOK, `{"read_only":false}`},
+		{"PUT", "/databases?name=db", http.StatusCreated, ""},
+		{"PUT", "/databases/db/stacks?name=stack", http.StatusCreated, ""},
+		{"PUT", "/_read_only?enabled=maybe", http.StatusBadRequest, ""},
+		{"PUT", "/_read_only?enabled=true", http.StatusOK, `{"read_only":true}`},
+		{"GET", "/_read_only", http.StatusOK, `{"read_only":true}`},
+		{"POST", "/databases/db/stacks/stack", http.StatusForbidden, ""},
+		{"DELETE", "/databases/db/stacks/stack", http.StatusForbidden, ""},
+		{"PUT", "/databases?name=other", http.StatusForbidden, ""},
+		{"GET", "/databases/db/stacks/stack/peek", http.StatusOK, `{"element":null}`},
+		{"GET", "/databases/db/stacks/stack/size", http.StatusOK, "0"},
+		// snapshots are disabled, but not forbidden
+		{"POST", "/_snapshots", http.StatusConflict, ""},
+		{"POST", "/_compact", http.StatusConflict, ""},
+		{"PUT", "/_debug?enabled=false", http.StatusOK, `{"debug":false}`},
+		{"PUT", "/_read_only?enabled=false", http.StatusOK, `{"read_only":false}`},
+		{"PUT", "/databases?name=other", http.StatusCreated, ""},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if io.body == "" {
+			continue
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != io.body {
+			t.Errorf("body is %s, expected %s for %s %s", body, io.body, io.method, io.path)
+		}
+	}
+}
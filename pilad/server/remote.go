@@ -0,0 +1,339 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// remoteTokenHeader is the header of the requests mounting a remote
+// Database with the token authenticating the requests to it, if any.
+const remoteTokenHeader = "Remote-Token"
+
+// Remote represents a Database of another pilad mounted by this one
+// with a Name, so the requests on the Database and its Stacks are
+// forwarded to it, given by its URL.
+type Remote struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+
+	// token authenticates the requests to the remote pilad
+	token string
+}
+
+// Remotes contains the remote Databases mounted by pilad.
+type Remotes struct {
+	client  *http.Client
+	remotes map[string]Remote
+
+	// mu protects the access to remotes
+	mu sync.RWMutex
+}
+
+// NewRemotes returns Remotes without Databases mounted.
+func NewRemotes() *Remotes {
+	return &Remotes{
+		client:  &http.Client{Timeout: 30 * time.Second},
+		remotes: make(map[string]Remote),
+	}
+}
+
+// Mount mounts the Remote, returning an error
+// if another Remote has the same name.
+func (rs *Remotes) Mount(remote Remote) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if _, ok := rs.remotes[remote.Name]; ok {
+		return fmt.Errorf("remote %s is already mounted", remote.Name)
+	}
+	rs.remotes[remote.Name] = remote
+	return nil
+}
+
+// Remote returns the Remote given by its name.
+func (rs *Remotes) Remote(name string) (Remote, bool) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	remote, ok := rs.remotes[name]
+	return remote, ok
+}
+
+// Unmount unmounts the Remote given by its name.
+// It returns false if it was not mounted.
+func (rs *Remotes) Unmount(name string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	_, ok := rs.remotes[name]
+	delete(rs.remotes, name)
+	return ok
+}
+
+// Rename renames the Remote given by its name, returning
+// an error if another Remote has the new name.
+func (rs *Remotes) Rename(name, newName string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	remote, ok := rs.remotes[name]
+	if !ok {
+		return fmt.Errorf("remote %s is not mounted", name)
+	}
+	if _, ok := rs.remotes[newName]; ok && newName != name {
+		return fmt.Errorf("remote %s is already mounted", newName)
+	}
+	delete(rs.remotes, name)
+	remote.Name = newName
+	rs.remotes[newName] = remote
+	return nil
+}
+
+// List returns the mounted Remotes, sorted by name.
+func (rs *Remotes) List() []Remote {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	remotes := make([]Remote, 0, len(rs.remotes))
+	for _, remote := range rs.remotes {
+		remotes = append(remotes, remote)
+	}
+	sort.Sort(remotesByName(remotes))
+	return remotes
+}
+
+// remotesByName sorts Remotes by name.
+type remotesByName []Remote
+
+func (rs remotesByName) Len() int           { return len(rs) }
+func (rs remotesByName) Swap(i, j int)      { rs[i], rs[j] = rs[j], rs[i] }
+func (rs remotesByName) Less(i, j int) bool { return rs[i].Name < rs[j].Name }
+
+// parseRemoteURL returns the URL of a remote Database, which must
+// be an HTTP or HTTPS URL with the /databases/$DATABASE_ID path,
+// without trailing slash, query nor fragment.
+func parseRemoteURL(s string) (string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("remote %q must be an HTTP or HTTPS URL", s)
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) != 2 || segments[0] != "databases" || segments[1] == "" {
+		return "", fmt.Errorf("remote %q must be the URL of a database, like http://host:1205/databases/$DATABASE_ID", s)
+	}
+	u.Path = "/" + strings.Join(segments, "/")
+	u.RawPath, u.RawQuery, u.Fragment = "", "", ""
+	return u.String(), nil
+}
+
+// request sends a request to the Remote, authenticated with its
+// token, given the path relative to its URL.
+func (rs *Remotes) request(remote Remote, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, remote.URL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if remote.token != "" {
+		req.Header.Set("Authorization", "Bearer "+remote.token)
+	}
+	return rs.client.Do(req)
+}
+
+// status returns the status of the Database of the Remote,
+// returning an error unless the remote pilad keeps it.
+func (rs *Remotes) status(remote Remote) (pila.DatabaseStatus, error) {
+	var status pila.DatabaseStatus
+	res, err := rs.request(remote, "GET", "", nil)
+	if err != nil {
+		return status, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		return status, fmt.Errorf("GET %s: unexpected status %s", remote.URL, res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		return status, fmt.Errorf("GET %s: %v", remote.URL, err)
+	}
+	return status, nil
+}
+
+// proxy forwards the request r to the Remote, given the path
+// segments following the Database. The credentials of r are
+// replaced by the token of the Remote, if any.
+func (rs *Remotes) proxy(remote Remote, segments []string, w http.ResponseWriter, r *http.Request) {
+	target, err := url.Parse(remote.URL)
+	if err != nil {
+		logResponse(r, http.StatusBadGateway, "error", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	if len(segments) > 0 {
+		target.Path += "/" + strings.Join(segments, "/")
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = target.Path
+			req.URL.RawPath = ""
+			req.Host = target.Host
+			req.Header.Del("Authorization")
+			if remote.token != "" {
+				req.Header.Set("Authorization", "Bearer "+remote.token)
+			}
+		},
+		Transport: rs.client.Transport,
+	}
+	logger.Info("forwarded", "method", r.Method, "url", r.URL.String(), "target", target)
+	proxy.ServeHTTP(w, r)
+}
+
+// RemoteMiddleware returns a middleware that forwards the requests on
+// the remote Databases mounted by pilad, and their Stacks, to the pilad
+// keeping them. Renaming or deleting a remote Database renames or
+// unmounts it instead. Databases of pilad are served by it, even if
+// their ID is the name of a Remote. It must be chained after
+// AuthMiddleware and TenantMiddleware, so forwarded requests are
+// authorized already.
+func RemoteMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+			if segments[0] != "databases" || len(segments) < 2 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			remote, ok := conn.Remotes.Remote(segments[1])
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if _, ok := ResourceDatabase(conn, segments[1]); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(segments) == 2 && r.Method == "PATCH" {
+				conn.renameRemoteHandler(w, r, remote)
+				return
+			}
+			if len(segments) == 2 && r.Method == "DELETE" {
+				conn.Remotes.Unmount(remote.Name)
+				logResponse(r, http.StatusNoContent, "remote", remote.URL)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			conn.Remotes.proxy(remote, segments[2:], w, r)
+		})
+	}
+}
+
+// mountDatabaseHandler mounts the Database of another pilad given by
+// the remote parameter, with the name given by the name parameter, or
+// its remote name, and returns 201 and the Remote. The token given by
+// the Remote-Token header authenticates the requests to it. Returns 400
+// if the URL or the name are not valid, 403 for the tokens of a tenant,
+// 409 if a Database or Remote has the name, and 502 if the remote pilad
+// does not serve the Database.
+func (c *Conn) mountDatabaseHandler(w http.ResponseWriter, r *http.Request) {
+	if tenant := requestTenant(r); tenant != "" {
+		logResponse(r, http.StatusForbidden, "reason", "tenant can not mount remote databases", "tenant", tenant)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	u, err := parseRemoteURL(r.FormValue("remote"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, APIError{Code: "invalid_remote", Message: err.Error(), Field: "remote"})
+		return
+	}
+	remote := Remote{URL: u, token: r.Header.Get(remoteTokenHeader)}
+
+	status, err := c.Remotes.status(remote)
+	if err != nil {
+		logResponse(r, http.StatusBadGateway, "error", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	remote.Name = r.FormValue("name")
+	if remote.Name == "" {
+		remote.Name = status.Name
+	}
+	if err := validateName("name", remote.Name); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, ok := ResourceDatabase(c, remote.Name); ok {
+		logResponse(r, http.StatusConflict, "reason", "database already exists", "database", remote.Name)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if err := c.Remotes.Mount(remote); err != nil {
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	// Do not check error as a Remote
+	// is always valid for a JSON encoding.
+	b, _ := json.Marshal(remote)
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusCreated, "remote", remote.URL)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(b)
+}
+
+// renameRemoteHandler renames the Remote, leaving its remote Database
+// untouched, and returns 200 and the Remote. Returns 400 if the name
+// is not valid, and 409 if a Database or another Remote has it.
+func (c *Conn) renameRemoteHandler(w http.ResponseWriter, r *http.Request, remote Remote) {
+	name, err := nameParam(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if _, ok := ResourceDatabase(c, name); ok {
+		err = errors.New("database " + name + " already exists")
+	} else {
+		err = c.Remotes.Rename(remote.Name, name)
+	}
+	if err != nil {
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	remote.Name = name
+	b, _ := json.Marshal(remote)
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(b)
+}
+
+// remotesHandler writes the Remotes mounted by pilad into the response.
+func (c *Conn) remotesHandler(w http.ResponseWriter, r *http.Request) {
+	b, _ := json.Marshal(map[string][]Remote{"remotes": c.Remotes.List()})
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(b)
+}
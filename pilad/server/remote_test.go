@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestParseRemoteURL(t *testing.T) {
+	inputOutput := []struct {
+		input, output string
+		valid         bool
+	}{
+		{"http://other:1205/databases/abc", "http://other:1205/databases/abc", true},
+		{"https://other/databases/abc/?foo=bar#baz", "https://other/databases/abc", true},
+		{"ftp://other/databases/abc", "", false},
+		{"http:///databases/abc", "", false},
+		{"http://other:1205/databases", "", false},
+		{"http://other:1205/databases/abc/stacks", "", false},
+		{"http://other:1205/_status", "", false},
+		{"%", "", false},
+	}
+
+	for _, io := range inputOutput {
+		u, err := parseRemoteURL(io.input)
+		if (err == nil) != io.valid || u != io.output {
+			t.Errorf("remote URL of %q is %q, %v, expected %q, valid %v", io.input, u, err, io.output, io.valid)
+		}
+	}
+}
+
+func TestRemotes(t *testing.T) {
+	remotes := NewRemotes()
+	if err := remotes.Mount(Remote{Name: "a", URL: "http://a/databases/db"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := remotes.Mount(Remote{Name: "b", URL: "http://b/databases/db"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := remotes.Mount(Remote{Name: "a", URL: "http://c/databases/db"}); err == nil {
+		t.Error("err is nil, expected remote a to be mounted")
+	}
+
+	if remote, ok := remotes.Remote("b"); !ok || remote.URL != "http://b/databases/db" {
+		t.Errorf("remote is %v, %v, expected %s", remote, ok, "b")
+	}
+	if err := remotes.Rename("a", "b"); err == nil {
+		t.Error("err is nil, expected remote b to be mounted")
+	}
+	if err := remotes.Rename("a", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if !remotes.Unmount("b") || remotes.Unmount("b") {
+		t.Error("remote b is not unmounted once")
+	}
+	if remotes := remotes.List(); len(remotes) != 1 || remotes[0].Name != "c" || remotes[0].URL != "http://a/databases/db" {
+		t.Errorf("remotes are %v, expected c", remotes)
+	}
+}
+
+func TestRemoteMiddleware(t *testing.T) {
+	// the remote pilad requires a token
+	remoteConn := NewConn()
+	remoteDB := pila.NewDatabase("shared")
+	_ = remoteConn.Pila.AddDatabase(remoteDB)
+	remoteStack := pila.NewStack("stack", time.Now().UTC())
+	_ = remoteDB.AddStack(remoteStack)
+	_ = remoteConn.Auth.Add(Token{Token: "remote", Role: RoleReadWrite})
+	remoteServer := httptest.NewServer(AuthMiddleware(remoteConn)(Router(remoteConn)))
+	defer remoteServer.Close()
+
+	conn := NewConn()
+	_ = conn.Pila.AddDatabase(pila.NewDatabase("local"))
+	_ = conn.Auth.Add(Token{Token: "admin", Role: RoleAdmin})
+	_ = conn.Auth.Add(Token{Token: "writer", Role: RoleReadWrite})
+	handler := AuthMiddleware(conn)(TenantMiddleware(conn)(RemoteMiddleware(conn)(Router(conn))))
+
+	remoteURL := remoteServer.URL + "/databases/" + remoteDB.ID.String()
+	inputOutput := []struct {
+		method, path, remoteToken, token, body string
+		code                                   int
+		output                                 string
+	}{
+		{"PUT", "/databases?remote=" + remoteURL, "", "admin", "", http.StatusBadGateway, ""},
+		{"PUT", "/databases?remote=" + remoteURL, "remote", "writer", "", http.StatusForbidden, ""},
+		{"PUT", "/databases?remote=" + remoteServer.URL + "/_status", "remote", "admin", "", http.StatusBadRequest, ""},
+		{"PUT", "/databases?remote=" + remoteURL + "&name=local", "remote", "admin", "", http.StatusConflict, ""},
+		{"PUT", "/databases?remote=" + remoteURL, "remote", "admin", "", http.StatusCreated, `{"name":"shared","url":"` + remoteURL + `"}`},
+		{"PUT", "/databases?remote=" + remoteURL, "remote", "admin", "", http.StatusConflict, ""},
+		{"PUT", "/databases?name=shared", "", "admin", "", http.StatusConflict, ""},
+		{"PATCH", "/databases/local", "", "admin", `{"name":"shared"}`, http.StatusConflict, ""},
+		{"POST", "/databases/shared/stacks/stack", "", "writer", `{"element":"foo"}`, http.StatusOK, `{"element":"foo"}`},
+		{"GET", "/databases/shared/stacks/stack/size", "", "writer", "", http.StatusOK, "1"},
+		{"GET", "/databases/shared/stacks/nostack", "", "writer", "", http.StatusGone, ""},
+		{"PATCH", "/databases/shared", "", "admin", `{"name":"local"}`, http.StatusConflict, ""},
+		{"PATCH", "/databases/shared", "", "admin", `{"name":"mounted"}`, http.StatusOK, `{"name":"mounted","url":"` + remoteURL + `"}`},
+		{"GET", "/_remotes", "", "writer", "", http.StatusForbidden, ""},
+		{"GET", "/_remotes", "", "admin", "", http.StatusOK, `{"remotes":[{"name":"mounted","url":"` + remoteURL + `"}]}`},
+		{"DELETE", "/databases/mounted/stacks/stack", "", "writer", "", http.StatusOK, `{"element":"foo"}`},
+		{"DELETE", "/databases/mounted", "", "admin", "", http.StatusNoContent, ""},
+		{"GET", "/databases/mounted/stacks/stack", "", "writer", "", http.StatusGone, ""},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		request.Header.Set("Authorization", "Bearer "+io.token)
+		if io.remoteToken != "" {
+			request.Header.Set(remoteTokenHeader, io.remoteToken)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if io.output != "" && strings.TrimSpace(response.Body.String()) != io.output {
+			t.Errorf("body is %s, expected %s for %s %s", response.Body.String(), io.output, io.method, io.path)
+		}
+	}
+
+	// unmounting leaves the remote Database untouched
+	if _, ok := remoteConn.Pila.Database(remoteDB.ID); !ok || remoteStack.Size() != 0 {
+		t.Errorf("remote database is %v, expected %s with an empty stack", ok, remoteDB.Name)
+	}
+	var remotes map[string][]Remote
+	request, _ := http.NewRequest("GET", "/_remotes", nil)
+	request.Header.Set("Authorization", "Bearer admin")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if err := json.Unmarshal(response.Body.Bytes(), &remotes); err != nil || len(remotes["remotes"]) != 0 {
+		t.Errorf("remotes are %v, %v, expected none", remotes, err)
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+)
+
+// nameParam returns the name given in the request body as
+// {"name": NAME}, returning an APIError if the body is
+// malformed or the name is not valid.
+func nameParam(r *http.Request) (string, error) {
+	if r.Body == nil {
+		return "", validateName("name", "")
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return "", jsonError("name", err)
+	}
+	return body.Name, validateName("name", body.Name)
+}
+
+// renameDatabaseHandler renames the Database, along with the IDs of
+// the Database and its Stacks, and returns 200 and its status. Returns
+// 400 if the name is missing, and 409 if another Database has the name.
+func (c *Conn) renameDatabaseHandler(w http.ResponseWriter, r *http.Request, db *pila.Database) {
+	name, err := nameParam(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if tenant := requestTenant(r); tenant != "" {
+		name = namespace(tenant, name)
+	}
+
+	if _, ok := c.Remotes.Remote(name); ok {
+		logResponse(r, http.StatusConflict, "reason", "remote database is mounted", "database", name)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	unlock := c.stackLocks.lockAll()
+	oldName := db.Name
+	if err := c.Pila.RenameDatabase(db.ID, name); err != nil {
+		unlock()
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	c.persist(r.Context(), persist.Record{Op: persist.OpRenameDatabase, Time: requestDate(r), Database: oldName, Name: name})
+	unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(db.Status().ToJSON())
+}
+
+// renameStackHandler renames the Stack, along with its ID, and returns
+// 200 and its status. Returns 400 if the name is missing, and 409 if
+// another Stack of the Database has the name.
+func (c *Conn) renameStackHandler(w http.ResponseWriter, r *http.Request, db *pila.Database, stack *pila.Stack) {
+	name, err := nameParam(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	unlock := c.stackLocks.lock(stack)
+	oldName := stack.Name
+	if err := db.RenameStack(stack.ID, name); err != nil {
+		unlock()
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	c.persist(r.Context(), persist.Record{Op: persist.OpRenameStack, Time: requestDate(r), Database: db.Name, Stack: oldName, Name: name})
+	unlock()
+
+	// Do not check error as the Status of a stack does
+	// not contain types that could cause such case.
+	res, _ := stack.Status().ToJSON()
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(res)
+}
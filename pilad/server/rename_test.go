@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestRenameHandlers(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	_ = conn.Pila.AddDatabase(pila.NewDatabase("other"))
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = stack.Push("foo")
+	dbID, stackID := db.ID, stack.ID
+	_ = db.AddStack(stack)
+	_ = db.AddStack(pila.NewStack("other", time.Now().UTC()))
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path, body string
+		code               int
+	}{
+		{"PATCH", "/databases/db/stacks/stack", `{"name":"renamed"}`, http.StatusOK},
+		{"GET", "/databases/db/stacks/stack", "", http.StatusGone},
+		{"GET", "/databases/db/stacks/renamed?peek", "", http.StatusOK},
+		{"PATCH", "/databases/db/stacks/renamed", `{"name":"other"}`, http.StatusConflict},
+		{"PATCH", "/databases/db/stacks/renamed", `{"name":""}`, http.StatusBadRequest},
+		{"PATCH", "/databases/db/stacks/renamed", `{"name":`, http.StatusBadRequest},
+		{"PATCH", "/databases/db/stacks/foo", `{"name":"bar"}`, http.StatusGone},
+		{"PATCH", "/databases/db", `{"name":"db2"}`, http.StatusOK},
+		{"GET", "/databases/db", "", http.StatusGone},
+		{"GET", "/databases/db2/stacks/renamed?peek", "", http.StatusOK},
+		{"PATCH", "/databases/db2", `{"name":"other"}`, http.StatusConflict},
+		{"PATCH", "/databases/db2", `{}`, http.StatusBadRequest},
+		{"PATCH", "/databases/foo", `{"name":"bar"}`, http.StatusGone},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+	}
+
+	if db.ID != dbID || stack.ID != stackID {
+		t.Errorf("IDs are %v and %v, expected %v and %v", db.ID, stack.ID, dbID, stackID)
+	}
+	if stack.Size() != 1 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 1)
+	}
+}
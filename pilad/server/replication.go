@@ -0,0 +1,360 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+const (
+	// replicationBuffer is the number of Records buffered for a
+	// follower. A follower whose buffer is full is disconnected,
+	// so it reconnects and starts again from a new snapshot.
+	replicationBuffer = 1024
+	// replicationRetryInterval is the time a follower waits
+	// before reconnecting to its primary.
+	replicationRetryInterval = time.Second
+)
+
+// Replication streams the operations modifying the Pila of a pilad to
+// its followers, and keeps the primary followed by pilad, if any.
+type Replication struct {
+	// writes is held for reading while the Pila is modified, and for
+	// writing while a follower subscribes and the snapshot it starts
+	// from is taken, so no operation is missed or applied twice. It
+	// does not order the operations, which the stackLocks of the Conn do
+	writes sync.RWMutex
+
+	followers map[chan persist.Record]struct{}
+	// primary is the URL of the followed primary, empty
+	// if pilad is a primary itself
+	primary string
+	// stop is closed when a follower is promoted
+	stop chan struct{}
+
+	// mu protects the access to followers, primary and stop
+	mu sync.Mutex
+}
+
+// NewReplication returns a Replication of a primary without followers.
+func NewReplication() *Replication {
+	return &Replication{followers: make(map[chan persist.Record]struct{})}
+}
+
+// Follow makes pilad a read-only follower of the primary at the
+// given URL. Replicate must be called to receive its operations.
+func (rp *Replication) Follow(primary string) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	rp.primary = primary
+	rp.stop = make(chan struct{})
+}
+
+// Primary returns the URL of the followed primary,
+// empty if pilad is a primary itself.
+func (rp *Replication) Primary() string {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return rp.primary
+}
+
+// Promote makes a follower a primary, stopping the replication
+// of its former primary. It returns false if pilad is already
+// a primary.
+func (rp *Replication) Promote() bool {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if rp.primary == "" {
+		return false
+	}
+	rp.primary = ""
+	close(rp.stop)
+	return true
+}
+
+// following returns the followed primary and
+// the channel closed when it stops being followed.
+func (rp *Replication) following() (string, <-chan struct{}) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return rp.primary, rp.stop
+}
+
+// subscribe registers a new follower, and returns the channel
+// where Records are published and a function to unregister it.
+func (rp *Replication) subscribe() (<-chan persist.Record, func()) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	records := make(chan persist.Record, replicationBuffer)
+	rp.followers[records] = struct{}{}
+	return records, func() {
+		rp.mu.Lock()
+		defer rp.mu.Unlock()
+		if _, ok := rp.followers[records]; ok {
+			delete(rp.followers, records)
+			close(records)
+		}
+	}
+}
+
+// publish sends a Record to every follower. Followers that
+// can not keep up are disconnected instead of blocking.
+func (rp *Replication) publish(record persist.Record) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	for records := range rp.followers {
+		select {
+		case records <- record:
+		default:
+			delete(rp.followers, records)
+			close(records)
+		}
+	}
+}
+
+// reset disconnects every follower, so they start again from a
+// new snapshot. It is needed when the Pila is replaced at once.
+func (rp *Replication) reset() {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	for records := range rp.followers {
+		delete(rp.followers, records)
+		close(records)
+	}
+}
+
+// ReplicationMiddleware returns a middleware that answers requests
+// modifying the Pila with 403 Forbidden while pilad is a follower,
+// and serves them holding the Replication writes otherwise, which
+// restores hold exclusively, as they replace the whole Pila.
+func ReplicationMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isMutating(r.Method) || !modifiesPila(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if primary := conn.Replication.Primary(); primary != "" {
+				logResponse(r, http.StatusForbidden, "reason", "read-only follower", "primary", redactURL(primary))
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			// blocking pops hold the writes only while popping
+			if isBlockingPop(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.URL.Path == "/_restore" {
+				conn.Replication.writes.Lock()
+				defer conn.Replication.writes.Unlock()
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			conn.Replication.writes.RLock()
+			defer conn.Replication.writes.RUnlock()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// modifiesPila returns true if the request is served by
+// an endpoint that may modify the content of the Pila.
+func modifiesPila(r *http.Request) bool {
+	return r.URL.Path == "/databases" ||
+		strings.HasPrefix(r.URL.Path, "/databases/") && !isKeysRequest(r) ||
+		r.URL.Path == "/_restore" ||
+		r.URL.Path == "/_provision" ||
+		strings.HasPrefix(r.URL.Path, "/_trash/")
+}
+
+// replicationHandler streams to a follower a snapshot of the Pila,
+// followed by every Record modifying it, as concatenated JSON values.
+// The connection is taken over from the server, so the stream is not
+// interrupted by its write timeout, and it is closed on shutdown.
+func (c *Conn) replicationHandler(w http.ResponseWriter, r *http.Request) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		logResponse(r, http.StatusInternalServerError, "reason", "response does not support hijacking")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var snapshot bytes.Buffer
+	c.Replication.writes.Lock()
+	records, unsubscribe := c.Replication.subscribe()
+	err := c.Pila.Snapshot(&snapshot)
+	c.Replication.writes.Unlock()
+	defer unsubscribe()
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on snapshot serialization", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	netConn, bw, err := hj.Hijack()
+	if err != nil {
+		logResponse(r, http.StatusInternalServerError, "reason", "error on hijacking", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer netConn.Close()
+	_ = netConn.SetDeadline(time.Time{})
+
+	logResponse(r, http.StatusOK)
+	logger.Info("follower connected", "follower", r.RemoteAddr)
+	defer logger.Info("follower disconnected", "follower", r.RemoteAddr)
+
+	fmt.Fprint(bw, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nConnection: close\r\n\r\n")
+	bw.Write(snapshot.Bytes())
+	if err := bw.Flush(); err != nil {
+		return
+	}
+
+	enc := json.NewEncoder(bw)
+	for {
+		select {
+		case record, ok := <-records:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(record); err != nil {
+				return
+			}
+			if err := bw.Flush(); err != nil {
+				return
+			}
+		case <-c.Shutdown.Requested():
+			return
+		}
+	}
+}
+
+// promoteHandler makes a follower a primary, which accepts requests
+// modifying its Pila, and returns 204. Returns 409 if pilad is not
+// a follower.
+func (c *Conn) promoteHandler(w http.ResponseWriter, r *http.Request) {
+	primary := c.Replication.Primary()
+	if !c.Replication.Promote() {
+		logResponse(r, http.StatusConflict, "reason", "not a follower")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	logger.Info("promoted to primary", "former_primary", redactURL(primary))
+	logResponse(r, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Replicate keeps the Pila of a follower as a copy of the one of its
+// primary, reconnecting after retry every time the stream from the
+// primary is interrupted, until the follower is promoted. It is
+// meant to be run as a goroutine.
+func (c *Conn) Replicate(retry time.Duration) {
+	for {
+		primary, stop := c.Replication.following()
+		if primary == "" {
+			return
+		}
+
+		err := c.replicateFrom(primary, stop)
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		logger.Warn("replication interrupted", "primary", redactURL(primary), "error", err)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// replicateFrom replaces the Pila with the snapshot streamed by the
+// primary, and applies every Record that follows it, until the stream
+// ends, a Record can not be applied or stop is closed. It always
+// returns a non-nil error.
+func (c *Conn) replicateFrom(primary string, stop <-chan struct{}) error {
+	req, err := http.NewRequest("GET", strings.TrimRight(primary, "/")+"/_replication", nil)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	dec := json.NewDecoder(res.Body)
+	var snapshot json.RawMessage
+	if err := dec.Decode(&snapshot); err != nil {
+		return err
+	}
+	c.Replication.writes.RLock()
+	err = c.Pila.Restore(bytes.NewReader(snapshot))
+	c.Replication.reset()
+	c.Replication.writes.RUnlock()
+	if err != nil {
+		return err
+	}
+	logger.Info("replicating", "primary", redactURL(primary))
+
+	for {
+		var record persist.Record
+		if err := dec.Decode(&record); err != nil {
+			return err
+		}
+
+		c.Replication.writes.RLock()
+		err := persist.Apply(c.Pila, record)
+		if err == nil {
+			c.Replication.publish(record)
+		}
+		c.Replication.writes.RUnlock()
+		if err != nil {
+			return fmt.Errorf("error on applying %s: %v", record.Op, err)
+		}
+	}
+}
+
+// redactURL returns rawurl without its user info, which
+// may contain the token used to access the primary.
+func redactURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.User == nil {
+		return rawurl
+	}
+	u.User = nil
+	return u.String()
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+)
+
+// waitFor polls cond until it returns true or a second passes.
+func waitFor(cond func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
+
+// stackSize returns the size of a Stack of a Pila, -1 if it does not exist.
+func stackSize(p *pila.Pila, database, stack string) int {
+	db, ok := p.DatabaseByName(database)
+	if !ok {
+		return -1
+	}
+	s, ok := db.StackByName(stack)
+	if !ok {
+		return -1
+	}
+	return s.Size()
+}
+
+func TestReplication_PublishReset(t *testing.T) {
+	rp := NewReplication()
+	records, unsubscribe := rp.subscribe()
+	slow, _ := rp.subscribe()
+
+	for i := 0; i < replicationBuffer; i++ {
+		rp.publish(persist.Record{Op: persist.OpPop})
+	}
+	<-records
+	rp.publish(persist.Record{Op: persist.OpFlush})
+
+	if len(rp.followers) != 1 {
+		t.Errorf("followers are %d, expected %d", len(rp.followers), 1)
+	}
+	if len(slow) != replicationBuffer {
+		t.Errorf("slow follower has %d records, expected %d", len(slow), replicationBuffer)
+	}
+
+	rp.reset()
+	if len(rp.followers) != 0 {
+		t.Errorf("followers are %d, expected %d", len(rp.followers), 0)
+	}
+	// does not close the channel twice
+	unsubscribe()
+}
+
+func TestReplication_PublishOrder(t *testing.T) {
+	conn := NewConn()
+	records, unsubscribe := conn.Replication.subscribe()
+	stack := pushPopConcurrently(t, conn)
+	unsubscribe()
+
+	// a follower applying the Records as they are published
+	// has the same Stack if they are published in the order
+	// the operations are applied
+	follower := pila.NewPila()
+	for record := range records {
+		if err := persist.Apply(follower, record); err != nil {
+			t.Fatalf("error on applying %s: %v", record.Op, err)
+		}
+	}
+	db, _ := follower.DatabaseByName("db")
+	replicated, ok := db.StackByName("stack")
+	if !ok {
+		t.Fatal("stack is not replicated")
+	}
+	compareStacks(t, replicated, stack)
+}
+
+func TestReplication_FollowPromote(t *testing.T) {
+	rp := NewReplication()
+	if rp.Promote() {
+		t.Error("primary is promoted")
+	}
+
+	rp.Follow("http://127.0.0.1:1205")
+	if primary := rp.Primary(); primary != "http://127.0.0.1:1205" {
+		t.Errorf("primary is %s, expected %s", primary, "http://127.0.0.1:1205")
+	}
+	_, stop := rp.following()
+	if !rp.Promote() {
+		t.Error("follower is not promoted")
+	}
+	if primary := rp.Primary(); primary != "" {
+		t.Errorf("primary is %s, expected empty", primary)
+	}
+	select {
+	case <-stop:
+	default:
+		t.Error("stop is not closed")
+	}
+}
+
+func TestReplicate(t *testing.T) {
+	primary := NewConn()
+	db := pila.NewDatabase("db")
+	_ = primary.Pila.AddDatabase(db)
+	_ = db.AddStack(pila.NewStack("stack", time.Now().UTC()))
+	primaryServer := httptest.NewServer(ReplicationMiddleware(primary)(Router(primary)))
+	defer primaryServer.Close()
+	defer primary.Shutdown.Request()
+
+	follower := NewConn()
+	follower.Replication.Follow(primaryServer.URL)
+	go follower.Replicate(10 * time.Millisecond)
+	followerHandler := ReplicationMiddleware(follower)(Router(follower))
+
+	if !waitFor(func() bool { return stackSize(follower.Pila, "db", "stack") == 0 }) {
+		t.Fatal("snapshot is not replicated")
+	}
+
+	requests := []struct {
+		method, path, body string
+	}{
+		{"POST", "/databases/db/stacks/stack", `{"element":"foo"}`},
+		{"POST", "/databases/db/stacks/stack", `{"element":"bar"}`},
+		{"PUT", "/databases/db/stacks?name=other", ""},
+		{"POST", "/databases/db/stacks/other", `{"element":1}`},
+		{"DELETE", "/databases/db/stacks/stack?pop", ""},
+	}
+	for _, req := range requests {
+		request, err := http.NewRequest(req.method, primaryServer.URL+req.path, strings.NewReader(req.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+	}
+
+	if !waitFor(func() bool {
+		return stackSize(follower.Pila, "db", "stack") == 1 && stackSize(follower.Pila, "db", "other") == 1
+	}) {
+		t.Fatalf("stacks have sizes %d and %d, expected %d and %d",
+			stackSize(follower.Pila, "db", "stack"), stackSize(follower.Pila, "db", "other"), 1, 1)
+	}
+
+	inputOutput := []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/databases/db/stacks/stack/peek", http.StatusOK},
+		{"POST", "/databases/db/stacks/stack", http.StatusForbidden},
+		{"POST", "/_restore", http.StatusForbidden},
+		{"POST", "/_promote", http.StatusNoContent},
+		{"POST", "/_promote", http.StatusConflict},
+		{"DELETE", "/databases/db/stacks/stack/flush", http.StatusOK},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		followerHandler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+	}
+
+	if follower.Replication.Primary() != "" {
+		t.Errorf("primary is %s, expected empty", follower.Replication.Primary())
+	}
+	if size := stackSize(primary.Pila, "db", "stack"); size != 1 {
+		t.Errorf("primary stack size is %d, expected %d", size, 1)
+	}
+}
+
+func TestReplicate_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	follower := NewConn()
+	follower.Replication.Follow(server.URL)
+
+	done := make(chan struct{})
+	go func() {
+		follower.Replicate(10 * time.Millisecond)
+		close(done)
+	}()
+
+	err := follower.replicateFrom(server.URL, make(chan struct{}))
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("err is %v, expected unexpected status error", err)
+	}
+
+	server.Close()
+	follower.Replication.Promote()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Replicate did not return after promotion")
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	inputOutput := []struct {
+		input, output string
+	}{
+		{"http://127.0.0.1:1205", "http://127.0.0.1:1205"},
+		{"https://:s3cr3t@primary:1205/", "https://primary:1205/"},
+		{"%", "%"},
+	}
+
+	for _, io := range inputOutput {
+		if output := redactURL(io.input); output != io.output {
+			t.Errorf("URL is %s, expected %s", output, io.output)
+		}
+	}
+}
@@ -0,0 +1,650 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+	"github.com/fern4lvarez/piladb/pkg/resp"
+)
+
+// respCommand is a Redis command supported by the RESP listener.
+type respCommand struct {
+	// arity is the number of arguments, including the command
+	// name, or its negative if it is the minimum number
+	arity int
+	// role is the Role needed to run the command, empty
+	// if it can be run without authentication
+	role Role
+	// keys determines whether the arguments after the
+	// command name are keys, the first one otherwise
+	keys bool
+	run  func(c *Conn, w *resp.Writer, args []string)
+}
+
+// respCommands are the supported Redis commands. Keys are given as
+// DATABASE/STACK, either by ID or name, and the head of a list is
+// the top of a Stack.
+var respCommands = map[string]respCommand{
+	"PING":    {-1, "", false, (*Conn).respPing},
+	"ECHO":    {2, "", false, (*Conn).respEcho},
+	"COMMAND": {-1, "", false, (*Conn).respCommandCommand},
+	"LPUSH":   {-3, RoleReadWrite, false, (*Conn).respLPush},
+	"LPOP":    {-2, RoleReadWrite, false, (*Conn).respLPop},
+	"LLEN":    {2, RoleRead, false, (*Conn).respLLen},
+	"LINDEX":  {3, RoleRead, false, (*Conn).respLIndex},
+	"LRANGE":  {4, RoleRead, false, (*Conn).respLRange},
+	"DEL":     {-2, RoleReadWrite, true, (*Conn).respDel},
+	"EXISTS":  {-2, RoleRead, true, (*Conn).respExists},
+}
+
+// respSession is the state of a RESP connection.
+type respSession struct {
+	// token is the Token given by AUTH, nil if not authenticated
+	token *Token
+	// client is the IP address of the client
+	client string
+}
+
+// ServeRESP accepts connections from Redis clients on ln, and serves
+// their commands until ln is closed. It always returns a non-nil error.
+func (c *Conn) ServeRESP(ln net.Listener) error {
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go c.serveRESPConn(nc)
+	}
+}
+
+// serveRESP serves Redis clients on ln in the background until
+// it is closed on shutdown. Errors on serving are logged.
+func (c *Conn) serveRESP(ln net.Listener) {
+	go func() {
+		<-c.Shutdown.Requested()
+		ln.Close()
+	}()
+
+	logger.Info("serving RESP", "addr", ln.Addr())
+	go func() {
+		if err := c.ServeRESP(ln); !c.Shutdown.IsRequested() {
+			logger.Error("error on serving RESP", "error", err)
+		}
+	}()
+}
+
+// serveRESPConn serves the commands of a RESP connection
+// until it is closed, QUIT is sent or pilad shuts down.
+func (c *Conn) serveRESPConn(nc net.Conn) {
+	defer nc.Close()
+
+	r := resp.NewReader(nc)
+	w := resp.NewWriter(nc)
+	session := &respSession{client: nc.RemoteAddr().String()}
+	if host, _, err := net.SplitHostPort(session.client); err == nil {
+		session.client = host
+	}
+	if !c.ACL.Allowed(net.ParseIP(session.client), "") {
+		w.WriteError("ERR client not allowed")
+		w.Flush()
+		return
+	}
+	for {
+		args, err := r.ReadCommand()
+		if err != nil {
+			if err != io.EOF {
+				w.WriteError("ERR " + err.Error())
+				w.Flush()
+			}
+			return
+		}
+
+		if !c.Shutdown.begin() {
+			w.WriteError("ERR shutting down")
+			w.Flush()
+			return
+		}
+		quit := c.respDo(w, session, args)
+		c.Shutdown.end()
+
+		if err := w.Flush(); err != nil || quit {
+			return
+		}
+	}
+}
+
+// respDo runs a command, writing its reply. It returns
+// true if the connection must be closed after it.
+func (c *Conn) respDo(w *resp.Writer, session *respSession, args []string) bool {
+	name := strings.ToUpper(args[0])
+	switch name {
+	case "QUIT":
+		w.WriteSimple("OK")
+		return true
+	case "AUTH":
+		c.respAuth(w, session, args)
+		return false
+	}
+
+	cmd, ok := respCommands[name]
+	if !ok {
+		logRESP(true, name, "reason", "unknown command")
+		w.WriteError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return false
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || len(args) < -cmd.arity {
+		logRESP(true, name, "reason", "wrong number of arguments")
+		w.WriteError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+		return false
+	}
+
+	var keys []string
+	if cmd.role != "" {
+		keys = args[1:2]
+		if cmd.keys {
+			keys = args[1:]
+		}
+		if !c.respAllowed(w, session, name, cmd.role, keys) {
+			return false
+		}
+	}
+
+	if cmd.role == RoleReadWrite {
+		if c.ReadOnly() {
+			logRESP(true, name, "reason", "read-only mode")
+			w.WriteError("READONLY You can't write while pilad is in read-only mode.")
+			return false
+		}
+		if primary := c.Replication.Primary(); primary != "" {
+			logRESP(true, name, "reason", "read-only follower", "primary", redactURL(primary))
+			w.WriteError("READONLY You can't write against a read only replica.")
+			return false
+		}
+		if node := c.Raft.Node(); node != nil && !node.IsLeader() {
+			logRESP(true, name, "reason", "raft follower", "leader", node.Leader())
+			w.WriteError("READONLY You can't write against a Raft follower.")
+			return false
+		}
+		c.Replication.writes.RLock()
+		defer c.Replication.writes.RUnlock()
+	}
+
+	cmd.run(c, w, args)
+	if cmd.role == RoleReadWrite {
+		for _, key := range keys {
+			c.respAudit(session, name, key)
+		}
+	}
+	return false
+}
+
+// logRESP writes an entry into the default logger for a command,
+// with its name followed by the given fields, as alternate keys and
+// values. It is a warning if the command failed, and an info entry
+// otherwise.
+func logRESP(failed bool, command string, keyvals ...interface{}) {
+	keyvals = append([]interface{}{"command", command}, keyvals...)
+	if failed {
+		logger.Warn("RESP", keyvals...)
+		return
+	}
+	logger.Info("RESP", keyvals...)
+}
+
+// respAudit records a command modifying pilad into the Audit,
+// given one of its keys.
+func (c *Conn) respAudit(session *respSession, name, key string) {
+	entry := AuditEntry{
+		Time:   time.Now().UTC(),
+		Client: session.client,
+		Op:     strings.ToLower(name),
+		Method: "RESP",
+		Path:   key,
+	}
+	if session.token != nil {
+		entry.Token = tokenFingerprint(session.token.Token)
+	}
+	if database, stack, err := respKey(key); err == nil {
+		entry.Database, entry.Stack = database, stack
+	}
+	c.Audit.Record(entry)
+}
+
+// respAuth authenticates the connection with the Token given as
+// the password of AUTH, ignoring the username if given.
+func (c *Conn) respAuth(w *resp.Writer, session *respSession, args []string) {
+	if len(args) < 2 || len(args) > 3 {
+		w.WriteError("ERR wrong number of arguments for 'auth' command")
+		return
+	}
+	if !c.Auth.Enabled() {
+		w.WriteError("ERR AUTH called without any token configured")
+		return
+	}
+
+	token, ok := c.Auth.Token(args[len(args)-1])
+	if !ok {
+		logRESP(true, "AUTH", "reason", "invalid token")
+		w.WriteError("WRONGPASS invalid token")
+		return
+	}
+	if token.Tenant != "" {
+		logRESP(true, "AUTH", "reason", "token of tenant", "tenant", token.Tenant)
+		w.WriteError("WRONGPASS tokens of a tenant are not allowed")
+		return
+	}
+	session.token = &token
+	w.WriteSimple("OK")
+}
+
+// respAllowed determines whether the session is allowed to run a
+// command needing role on the Databases of keys. Otherwise, it
+// writes the error reply.
+func (c *Conn) respAllowed(w *resp.Writer, session *respSession, name string, role Role, keys []string) bool {
+	for _, key := range keys {
+		if database, _, err := respKey(key); err == nil && !c.allowedDatabase(net.ParseIP(session.client), database) {
+			logRESP(true, name, "reason", "client not allowed", "client", session.client)
+			w.WriteError("NOPERM this client is not allowed to access database " + database)
+			return false
+		}
+	}
+	if !c.Auth.Enabled() {
+		return true
+	}
+	if session.token == nil {
+		logRESP(true, name, "reason", "missing token")
+		w.WriteError("NOAUTH Authentication required.")
+		return false
+	}
+	// The token could have been removed since AUTH.
+	token, ok := c.Auth.Token(session.token.Token)
+	if !ok {
+		logRESP(true, name, "reason", "invalid token")
+		session.token = nil
+		w.WriteError("NOAUTH Authentication required.")
+		return false
+	}
+
+	allowed := token.Role.allows(role)
+	for _, key := range keys {
+		if database, _, err := respKey(key); err == nil && !token.canAccess(c.Pila, database) {
+			allowed = false
+		}
+	}
+	if !allowed {
+		logRESP(true, name, "reason", "token not allowed")
+		w.WriteError("NOPERM this token has no permissions to run the '" + strings.ToLower(name) + "' command")
+	}
+	return allowed
+}
+
+// respKey splits a key into its Database and Stack, given as
+// DATABASE/STACK.
+func respKey(key string) (database, stack string, err error) {
+	i := strings.Index(key, "/")
+	if i <= 0 || i == len(key)-1 {
+		return "", "", fmt.Errorf("invalid key %q, expected DATABASE/STACK", key)
+	}
+	return key[:i], key[i+1:], nil
+}
+
+// respStack returns the Stack of a key. The Stack is created, along
+// with its Database, at date t if it does not exist and create is true.
+// Otherwise, nil is returned.
+func (c *Conn) respStack(key string, create bool, t time.Time) (*pila.Stack, error) {
+	database, name, err := respKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	db, ok := ResourceDatabase(c, database)
+	if !ok && !create {
+		return nil, nil
+	}
+	if !ok {
+		db = pila.NewDatabase(database)
+		unlock := c.stackLocks.lockAll()
+		err := c.Pila.AddDatabase(db)
+		if err == nil {
+			c.persist(context.Background(), persist.Record{Op: persist.OpCreateDatabase, Time: t, Database: db.Name, ID: db.ID.String()})
+		}
+		unlock()
+		if err != nil {
+			if db, ok = ResourceDatabase(c, database); !ok {
+				return nil, err
+			}
+		}
+	}
+
+	stack, ok := ResourceStack(db, name)
+	if !ok && !create {
+		return nil, nil
+	}
+	if !ok {
+		stack = pila.NewStack(name, t)
+		unlock := c.stackLocks.lock(stack)
+		err := db.AddStack(stack)
+		if err == nil {
+			stack.Update(t)
+			c.persistStack(context.Background(), stack, persist.Record{Op: persist.OpCreateStack, Time: t, Type: pila.StructureStack, ID: stack.ID.String()})
+		}
+		unlock()
+		if err != nil {
+			if stack, ok = ResourceStack(db, name); !ok {
+				return nil, err
+			}
+		}
+	}
+
+	stack.SetMaxElementSize(c.Config.MaxElementSize())
+	return stack, nil
+}
+
+// respValue returns a value of a Stack as a bulk string. Strings
+// and binary values are returned as they are, and other values
+// encoded as JSON.
+func respValue(value interface{}) []byte {
+	switch v := value.(type) {
+	case string:
+		return []byte(v)
+	case pila.Binary:
+		return v.Data
+	}
+	// Do not check error as we consider our elements
+	// suitable for a JSON encoding.
+	b, _ := json.Marshal(value)
+	return b
+}
+
+// respWriteValues writes values as an array of bulk strings.
+func respWriteValues(w *resp.Writer, values []interface{}) {
+	w.WriteArray(len(values))
+	for _, value := range values {
+		w.WriteBulk(respValue(value))
+	}
+}
+
+// respPing replies PONG, or the given message.
+func (c *Conn) respPing(w *resp.Writer, args []string) {
+	if len(args) > 2 {
+		w.WriteError("ERR wrong number of arguments for 'ping' command")
+		return
+	}
+	if len(args) == 2 {
+		w.WriteBulk([]byte(args[1]))
+		return
+	}
+	w.WriteSimple("PONG")
+}
+
+// respEcho replies the given message.
+func (c *Conn) respEcho(w *resp.Writer, args []string) {
+	w.WriteBulk([]byte(args[1]))
+}
+
+// respCommandCommand replies an empty array, as the details of
+// the commands are not provided. Clients send it on connection.
+func (c *Conn) respCommandCommand(w *resp.Writer, args []string) {
+	w.WriteArray(0)
+}
+
+// respLPush pushes the elements as strings on top of the Stack of
+// the key, creating it if it does not exist, and replies its size.
+func (c *Conn) respLPush(w *resp.Writer, args []string) {
+	now := time.Now().UTC()
+	stack, err := c.respStack(args[1], true, now)
+	if err != nil {
+		logRESP(true, "LPUSH", "key", args[1], "error", err)
+		w.WriteError("ERR " + err.Error())
+		return
+	}
+	if stack.Locked("", time.Now()) {
+		logRESP(true, "LPUSH", "key", args[1], "error", pila.ErrStackLocked)
+		w.WriteError("ERR " + pila.ErrStackLocked.Error())
+		return
+	}
+
+	elements := make([]interface{}, len(args)-2)
+	for i, arg := range args[2:] {
+		elements[i] = arg
+	}
+	if s := c.Config.MaxStackSize(); s != -1 && stack.Size()+len(elements) > s {
+		logRESP(true, "LPUSH", "key", args[1], "reason", "value reached", "config", vars.MaxStackSize)
+		w.WriteError("ERR " + vars.MaxStackSize + " value reached")
+		return
+	}
+	defer c.stackLocks.lock(stack)()
+	if err := stack.PushN(elements); err != nil {
+		logRESP(true, "LPUSH", "key", args[1], "error", err)
+		w.WriteError("ERR " + err.Error())
+		return
+	}
+	stack.Update(now)
+	for _, element := range elements {
+		c.persistStack(context.Background(), stack, persist.Record{Op: persist.OpPush, Time: now, Element: element})
+	}
+
+	logRESP(false, "LPUSH", "key", args[1], "elements", len(elements))
+	w.WriteInt(int64(stack.Size()))
+}
+
+// respLPop pops the top element of the Stack of the key, or up to
+// count elements if given, and replies them. It replies null if
+// the Stack is empty or does not exist.
+func (c *Conn) respLPop(w *resp.Writer, args []string) {
+	now := time.Now().UTC()
+	if len(args) > 3 {
+		w.WriteError("ERR wrong number of arguments for 'lpop' command")
+		return
+	}
+	count := -1
+	if len(args) == 3 {
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 0 {
+			w.WriteError("ERR value is out of range, must be positive")
+			return
+		}
+		count = n
+	}
+
+	stack, err := c.respStack(args[1], false, now)
+	if err != nil {
+		logRESP(true, "LPOP", "key", args[1], "error", err)
+		w.WriteError("ERR " + err.Error())
+		return
+	}
+	if stack == nil {
+		logRESP(true, "LPOP", "key", args[1], "reason", "stack is Gone")
+		w.WriteNull()
+		return
+	}
+	if stack.Locked("", time.Now()) {
+		logRESP(true, "LPOP", "key", args[1], "error", pila.ErrStackLocked)
+		w.WriteError("ERR " + pila.ErrStackLocked.Error())
+		return
+	}
+
+	defer c.stackLocks.lock(stack)()
+	if count == -1 {
+		value, ok := stack.Pop()
+		if !ok {
+			logRESP(false, "LPOP", "key", args[1], "reason", "empty stack")
+			w.WriteNull()
+			return
+		}
+		stack.Update(now)
+		c.persistStack(context.Background(), stack, persist.Record{Op: persist.OpPop, Time: now})
+		logRESP(false, "LPOP", "key", args[1], "element", value)
+		w.WriteBulk(respValue(value))
+		return
+	}
+
+	elements := stack.PopN(count)
+	if len(elements) > 0 {
+		stack.Update(now)
+		for range elements {
+			c.persistStack(context.Background(), stack, persist.Record{Op: persist.OpPop, Time: now})
+		}
+	}
+	logRESP(false, "LPOP", "key", args[1], "elements", len(elements))
+	respWriteValues(w, elements)
+}
+
+// respLLen replies the size of the Stack of the key,
+// 0 if it does not exist.
+func (c *Conn) respLLen(w *resp.Writer, args []string) {
+	now := time.Now().UTC()
+	stack, err := c.respStack(args[1], false, now)
+	if err != nil {
+		logRESP(true, "LLEN", "key", args[1], "error", err)
+		w.WriteError("ERR " + err.Error())
+		return
+	}
+	if stack == nil {
+		logRESP(false, "LLEN", "key", args[1], "size", 0)
+		w.WriteInt(0)
+		return
+	}
+
+	stack.Read(now)
+	logRESP(false, "LLEN", "key", args[1], "size", stack.Size())
+	w.WriteInt(int64(stack.Size()))
+}
+
+// respIndex returns the position of index in a Stack of the given
+// size. Negative indexes count from the bottom of the Stack.
+func respIndex(index, size int) int {
+	if index < 0 {
+		index += size
+	}
+	return index
+}
+
+// respLIndex replies the element of the Stack of the key at index,
+// 0 being the top one. It replies null if it does not exist.
+func (c *Conn) respLIndex(w *resp.Writer, args []string) {
+	now := time.Now().UTC()
+	index, err := strconv.Atoi(args[2])
+	if err != nil {
+		w.WriteError("ERR value is not an integer or out of range")
+		return
+	}
+
+	stack, err := c.respStack(args[1], false, now)
+	if err != nil {
+		logRESP(true, "LINDEX", "key", args[1], "error", err)
+		w.WriteError("ERR " + err.Error())
+		return
+	}
+	if stack == nil {
+		logRESP(true, "LINDEX", "key", args[1], "reason", "stack is Gone")
+		w.WriteNull()
+		return
+	}
+
+	index = respIndex(index, stack.Size())
+	var elements []interface{}
+	if index >= 0 {
+		elements = stack.Elements(index, 1)
+	}
+	stack.Read(now)
+	if len(elements) == 0 {
+		logRESP(false, "LINDEX", "key", args[1], "reason", "index out of range")
+		w.WriteNull()
+		return
+	}
+	logRESP(false, "LINDEX", "key", args[1], "element", elements[0])
+	w.WriteBulk(respValue(elements[0]))
+}
+
+// respLRange replies the elements of the Stack of the key between
+// the start and stop indexes, both included, 0 being the top one.
+func (c *Conn) respLRange(w *resp.Writer, args []string) {
+	now := time.Now().UTC()
+	start, err := strconv.Atoi(args[2])
+	if err != nil {
+		w.WriteError("ERR value is not an integer or out of range")
+		return
+	}
+	stop, err := strconv.Atoi(args[3])
+	if err != nil {
+		w.WriteError("ERR value is not an integer or out of range")
+		return
+	}
+
+	stack, err := c.respStack(args[1], false, now)
+	if err != nil {
+		logRESP(true, "LRANGE", "key", args[1], "error", err)
+		w.WriteError("ERR " + err.Error())
+		return
+	}
+	if stack == nil {
+		logRESP(true, "LRANGE", "key", args[1], "reason", "stack is Gone")
+		w.WriteArray(0)
+		return
+	}
+
+	size := stack.Size()
+	start, stop = respIndex(start, size), respIndex(stop, size)
+	if start < 0 {
+		start = 0
+	}
+	var elements []interface{}
+	if start <= stop {
+		elements = stack.Elements(start, stop-start+1)
+	}
+	stack.Read(now)
+
+	logRESP(false, "LRANGE", "key", args[1], "elements", len(elements))
+	respWriteValues(w, elements)
+}
+
+// respDel deletes the Stacks of the keys, and replies
+// the number of deleted ones.
+func (c *Conn) respDel(w *resp.Writer, args []string) {
+	now := time.Now().UTC()
+	var deleted int64
+	for _, key := range args[1:] {
+		stack, err := c.respStack(key, false, now)
+		if err != nil || stack == nil || stack.Database == nil || stack.Locked("", time.Now()) {
+			continue
+		}
+
+		db := stack.Database
+		unlock := c.stackLocks.lock(stack)
+		c.trashStack(db, stack, now)
+		stack.Flush()
+		if db.RemoveStack(stack.ID) {
+			c.persist(context.Background(), persist.Record{Op: persist.OpDeleteStack, Time: now, Database: db.Name, Stack: stack.Name})
+			deleted++
+		}
+		unlock()
+	}
+
+	logRESP(false, "DEL", "stacks", deleted)
+	w.WriteInt(deleted)
+}
+
+// respExists replies the number of keys whose Stack exists.
+func (c *Conn) respExists(w *resp.Writer, args []string) {
+	now := time.Now().UTC()
+	var existing int64
+	for _, key := range args[1:] {
+		if stack, err := c.respStack(key, false, now); err == nil && stack != nil {
+			existing++
+		}
+	}
+
+	logRESP(false, "EXISTS", "stacks", existing)
+	w.WriteInt(existing)
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// respClient is a minimal Redis client for testing.
+type respClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialRESP serves RESP connections of conn, and returns a
+// client connected to it, and a function closing both.
+func dialRESP(t *testing.T, conn *Conn) (*respClient, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go conn.ServeRESP(ln)
+
+	nc, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		ln.Close()
+		t.Fatal(err)
+	}
+	return &respClient{conn: nc, r: bufio.NewReader(nc)}, func() {
+		nc.Close()
+		ln.Close()
+	}
+}
+
+// do sends a command and returns its reply, formatted as a
+// string: bulk strings are quoted, null is nil, and arrays
+// are written between brackets.
+func (c *respClient) do(args ...string) (string, error) {
+	cmd := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		cmd += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, cmd); err != nil {
+		return "", err
+	}
+	return c.reply()
+}
+
+// reply reads and formats a reply.
+func (c *respClient) reply() (string, error) {
+	_ = c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+
+	switch line[0] {
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "nil", nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return "", err
+		}
+		return strconv.Quote(string(b[:n])), nil
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		elements := make([]string, n)
+		for i := range elements {
+			if elements[i], err = c.reply(); err != nil {
+				return "", err
+			}
+		}
+		return "[" + strings.Join(elements, " ") + "]", nil
+	}
+	return line, nil
+}
+
+func TestServeRESP(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	_ = stack.Push(map[string]interface{}{"a": 1.0})
+
+	client, closeClient := dialRESP(t, conn)
+	defer closeClient()
+
+	inputOutput := []struct {
+		input  []string
+		output string
+	}{
+		{[]string{"PING"}, "+PONG"},
+		{[]string{"ping", "foo"}, `"foo"`},
+		{[]string{"ECHO", "bar"}, `"bar"`},
+		{[]string{"COMMAND", "DOCS"}, "[]"},
+		{[]string{"AUTH", "foo"}, "-ERR AUTH called without any token configured"},
+		{[]string{"FOO"}, "-ERR unknown command 'FOO'"},
+		{[]string{"LLEN"}, "-ERR wrong number of arguments for 'llen' command"},
+		{[]string{"LLEN", "db"}, `-ERR invalid key "db", expected DATABASE/STACK`},
+		{[]string{"LLEN", "db/stack"}, ":1"},
+		{[]string{"LPUSH", "db/stack", "foo", "bar"}, ":3"},
+		{[]string{"LRANGE", "db/stack", "0", "-1"}, `["bar" "foo" "{\"a\":1}"]`},
+		{[]string{"LRANGE", "db/stack", "1", "10"}, `["foo" "{\"a\":1}"]`},
+		{[]string{"LRANGE", "db/stack", "2", "1"}, "[]"},
+		{[]string{"LRANGE", "db/foo", "0", "-1"}, "[]"},
+		{[]string{"LINDEX", "db/stack", "0"}, `"bar"`},
+		{[]string{"LINDEX", "db/stack", "-1"}, `"{\"a\":1}"`},
+		{[]string{"LINDEX", "db/stack", "3"}, "nil"},
+		{[]string{"LINDEX", "db/stack", "x"}, "-ERR value is not an integer or out of range"},
+		{[]string{"LPOP", "db/stack"}, `"bar"`},
+		{[]string{"LPOP", "db/stack", "5"}, `["foo" "{\"a\":1}"]`},
+		{[]string{"LPOP", "db/stack"}, "nil"},
+		{[]string{"LPOP", "db/foo"}, "nil"},
+		{[]string{"LLEN", "db/foo"}, ":0"},
+		{[]string{"LPUSH", "other/foo", "baz"}, ":1"},
+		{[]string{"EXISTS", "db/stack", "other/foo", "other/bar"}, ":2"},
+		{[]string{"DEL", "db/stack", "other/bar"}, ":1"},
+		{[]string{"EXISTS", "db/stack"}, ":0"},
+		{[]string{"QUIT"}, "+OK"},
+	}
+
+	for _, io := range inputOutput {
+		output, err := client.do(io.input...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != io.output {
+			t.Errorf("reply is %s, expected %s for %q", output, io.output, io.input)
+		}
+	}
+
+	if _, err := client.do("PING"); err == nil {
+		t.Error("err is nil, expected closed connection")
+	}
+
+	other, ok := ResourceDatabase(conn, "other")
+	if !ok {
+		t.Fatal("database other does not exist")
+	}
+	if foo, ok := ResourceStack(other, "foo"); !ok || foo.Peek() != "baz" {
+		t.Errorf("stack other/foo is %v, expected with peek %s", foo, "baz")
+	}
+}
+
+func TestServeRESP_Limits(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set(vars.MaxStackSize, 2)
+	conn.Config.Set(vars.MaxElementSize, 5)
+
+	client, closeClient := dialRESP(t, conn)
+	defer closeClient()
+
+	inputOutput := []struct {
+		input  []string
+		output string
+	}{
+		{[]string{"LPUSH", "db/stack", "foo", "bar", "baz"}, "-ERR " + vars.MaxStackSize + " value reached"},
+		{[]string{"LPUSH", "db/stack", "foobarbaz"}, "-ERR " + pila.ErrElementTooLarge.Error()},
+		{[]string{"LPUSH", "db/stack", "foo", "bar"}, ":2"},
+		{[]string{"LPOP", "db/stack", "-1"}, "-ERR value is out of range, must be positive"},
+	}
+
+	for _, io := range inputOutput {
+		output, err := client.do(io.input...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != io.output {
+			t.Errorf("reply is %s, expected %s for %q", output, io.output, io.input)
+		}
+	}
+}
+
+func TestServeRESP_Auth(t *testing.T) {
+	conn := NewConn()
+	_ = conn.Auth.Add(Token{Token: "r34d", Role: RoleRead, Databases: []string{"db"}})
+	_ = conn.Auth.Add(Token{Token: "wr1t3", Role: RoleReadWrite})
+	_ = conn.Auth.Add(Token{Token: "4cm3", Role: RoleReadWrite, Tenant: "acme"})
+
+	client, closeClient := dialRESP(t, conn)
+	defer closeClient()
+
+	inputOutput := []struct {
+		input  []string
+		output string
+	}{
+		{[]string{"PING"}, "+PONG"},
+		{[]string{"LLEN", "db/stack"}, "-NOAUTH Authentication required."},
+		{[]string{"AUTH", "foo"}, "-WRONGPASS invalid token"},
+		{[]string{"AUTH", "4cm3"}, "-WRONGPASS tokens of a tenant are not allowed"},
+		{[]string{"AUTH", "default", "r34d"}, "+OK"},
+		{[]string{"LLEN", "db/stack"}, ":0"},
+		{[]string{"LLEN", "other/stack"}, "-NOPERM this token has no permissions to run the 'llen' command"},
+		{[]string{"EXISTS", "db/stack", "other/stack"}, "-NOPERM this token has no permissions to run the 'exists' command"},
+		{[]string{"LPUSH", "db/stack", "foo"}, "-NOPERM this token has no permissions to run the 'lpush' command"},
+		{[]string{"AUTH", "wr1t3"}, "+OK"},
+		{[]string{"LPUSH", "other/stack", "foo"}, ":1"},
+	}
+
+	for _, io := range inputOutput {
+		output, err := client.do(io.input...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != io.output {
+			t.Errorf("reply is %s, expected %s for %q", output, io.output, io.input)
+		}
+	}
+
+	conn.Auth.Remove("wr1t3")
+	if output, _ := client.do("LLEN", "other/stack"); output != "-NOAUTH Authentication required." {
+		t.Errorf("reply is %s, expected %s", output, "-NOAUTH Authentication required.")
+	}
+}
+
+func TestServeRESP_Follower(t *testing.T) {
+	conn := NewConn()
+	conn.Replication.Follow("http://127.0.0.1:1205")
+
+	client, closeClient := dialRESP(t, conn)
+	defer closeClient()
+
+	if output, _ := client.do("LPUSH", "db/stack", "foo"); output != "-READONLY You can't write against a read only replica." {
+		t.Errorf("reply is %s, expected READONLY error", output)
+	}
+	if output, _ := client.do("LLEN", "db/stack"); output != ":0" {
+		t.Errorf("reply is %s, expected %s", output, ":0")
+	}
+}
+
+func TestServeRESP_ReadOnly(t *testing.T) {
+	conn := NewConn()
+	conn.SetReadOnly(true)
+
+	client, closeClient := dialRESP(t, conn)
+	defer closeClient()
+
+	if output, _ := client.do("LPUSH", "db/stack", "foo"); output != "-READONLY You can't write while pilad is in read-only mode." {
+		t.Errorf("reply is %s, expected READONLY error", output)
+	}
+	if output, _ := client.do("LLEN", "db/stack"); output != ":0" {
+		t.Errorf("reply is %s, expected %s", output, ":0")
+	}
+}
+
+func TestServeRESP_Shutdown(t *testing.T) {
+	conn := NewConn()
+	client, closeClient := dialRESP(t, conn)
+	defer closeClient()
+
+	conn.Shutdown.Request()
+	conn.Shutdown.Drain(time.Second)
+	if output, _ := client.do("PING"); output != "-ERR shutting down" {
+		t.Errorf("reply is %s, expected %s", output, "-ERR shutting down")
+	}
+}
+
+func TestServeRESP_ProtocolError(t *testing.T) {
+	conn := NewConn()
+	client, closeClient := dialRESP(t, conn)
+	defer closeClient()
+
+	if _, err := io.WriteString(client.conn, "*1\r\n+PING\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	if output, _ := client.reply(); output != "-ERR resp: protocol error" {
+		t.Errorf("reply is %s, expected %s", output, "-ERR resp: protocol error")
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+)
+
+// rotateStackHandler moves the element on top of the Stack to its
+// bottom, returns 200 and the element. Returns 204 if the Stack is
+// empty, and 400 if its type does not support the operation.
+func (c *Conn) rotateStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	now := requestDate(r)
+	defer c.stackLocks.lock(stack)()
+	value, ok, err := stack.Rotate()
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		logResponse(r, http.StatusNoContent)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	stack.Update(now)
+	c.persistStack(r.Context(), stack, persist.Record{Op: persist.OpRotate, Time: now})
+
+	c.writeElement(w, r, value)
+}
+
+// baseStackHandler returns the element at the bottom of the Stack
+// without modifying it. Returns 400 if the type of the Stack does
+// not support the operation.
+func (c *Conn) baseStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	value, err := stack.Base()
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	stack.Read(requestDate(r))
+
+	c.writeElement(w, r, value)
+}
+
+// sweepStackHandler extracts the element at the bottom of the Stack,
+// returns 200 and the element. Returns 204 if the Stack is empty, and
+// 400 if its type does not support the operation.
+func (c *Conn) sweepStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	now := requestDate(r)
+	defer c.stackLocks.lock(stack)()
+	value, ok, err := stack.Sweep()
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		logResponse(r, http.StatusNoContent)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	stack.Update(now)
+	c.persistStack(r.Context(), stack, persist.Record{Op: persist.OpSweep, Time: now})
+
+	c.writeElement(w, r, value)
+}
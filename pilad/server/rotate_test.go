@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestRotateStackHandlers(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = stack.PushN([]interface{}{"foo", "bar", "baz"})
+	_ = db.AddStack(stack)
+	_ = db.AddStack(pila.NewStack("empty", time.Now().UTC()))
+	_ = db.AddStack(pila.NewPriority("priority", time.Now().UTC()))
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"GET", "/databases/db/stacks/stack/base", http.StatusOK, `{"element":"foo"}`},
+		{"POST", "/databases/db/stacks/stack/rotate", http.StatusOK, `{"element":"baz"}`},
+		{"GET", "/databases/db/stacks/stack/base", http.StatusOK, `{"element":"baz"}`},
+		{"GET", "/databases/db/stacks/stack/peek", http.StatusOK, `{"element":"bar"}`},
+		{"DELETE", "/databases/db/stacks/stack/sweep", http.StatusOK, `{"element":"baz"}`},
+		{"GET", "/databases/db/stacks/stack/base", http.StatusOK, `{"element":"foo"}`},
+		{"GET", "/databases/db/stacks/empty/base", http.StatusOK, `{"element":null}`},
+		{"POST", "/databases/db/stacks/empty/rotate", http.StatusNoContent, ""},
+		{"DELETE", "/databases/db/stacks/empty/sweep", http.StatusNoContent, ""},
+		{"POST", "/databases/db/stacks/priority/rotate", http.StatusBadRequest, ""},
+		{"GET", "/databases/db/stacks/priority/base", http.StatusBadRequest, ""},
+		{"DELETE", "/databases/db/stacks/priority/sweep", http.StatusBadRequest, ""},
+		{"POST", "/databases/db/stacks/foo/rotate", http.StatusGone, ""},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if body := response.Body.String(); body != io.body {
+			t.Errorf("body is %s, expected %s for %s %s", body, io.body, io.method, io.path)
+		}
+	}
+
+	if stack.Size() != 2 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 2)
+	}
+}
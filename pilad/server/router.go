@@ -0,0 +1,410 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Router returns a gorila/mux Router with all specified endpoints and
+// handlers.
+func Router(conn *Conn) *mux.Router {
+	r := mux.NewRouter()
+
+	// GET /
+	r.HandleFunc("/", conn.rootHandler).
+		Methods("GET")
+
+	// GET /_status
+	r.HandleFunc("/_status", conn.statusHandler).
+		Methods("GET")
+
+	// GET /_status/stream
+	// GET /_status/stream?interval=$INTERVAL
+	r.HandleFunc("/_status/stream", conn.statusStreamHandler).
+		Methods("GET")
+
+	// GET, HEAD /_health
+	r.HandleFunc("/_health", conn.healthHandler).
+		Methods("GET", "HEAD")
+
+	// GET, HEAD /_ready
+	r.HandleFunc("/_ready", conn.readyHandler).
+		Methods("GET", "HEAD")
+
+	// GET /_ops
+	r.HandleFunc("/_ops", conn.opsHandler).
+		Methods("GET")
+	// DELETE /_ops/$OP_ID
+	r.HandleFunc("/_ops/{op_id}", conn.cancelOpHandler).
+		Methods("DELETE")
+
+	// GET /metrics
+	r.HandleFunc("/metrics", conn.metricsHandler).
+		Methods("GET")
+
+	// GET /_peers
+	r.HandleFunc("/_peers", conn.peersHandler).
+		Methods("GET")
+
+	// POST /_benchmark?db=DATABASE_ID&stack=STACK_ID&ops=OPS&workers=WORKERS
+	r.HandleFunc("/_benchmark", conn.benchmarkHandler).
+		Methods("POST")
+
+	// GET /_changelog
+	// GET /_changelog?from=VERSION
+	r.HandleFunc("/_changelog", conn.changelogHandler).
+		Methods("GET")
+
+	// GET /_features
+	r.HandleFunc("/_features", conn.featuresHandler).
+		Methods("GET")
+
+	// GET /_audit
+	// GET /_audit?since=$SINCE&limit=$LIMIT
+	r.HandleFunc("/_audit", conn.auditHandler).
+		Methods("GET")
+
+	// GET, PUT /_acl
+	r.HandleFunc("/_acl", conn.aclHandler).
+		Methods("GET", "PUT")
+
+	// GET /_encryption
+	r.HandleFunc("/_encryption", conn.encryptionHandler).
+		Methods("GET")
+	// POST /_encryption/rotate
+	r.HandleFunc("/_encryption/rotate", conn.rotateKeyHandler).
+		Methods("POST")
+
+	// GET /_templates
+	r.HandleFunc("/_templates", conn.templatesHandler).
+		Methods("GET")
+
+	// POST /_shutdown
+	r.HandleFunc("/_shutdown", conn.shutdownHandler).
+		Methods("POST")
+
+	// GET, PUT /_limits
+	r.HandleFunc("/_limits", conn.limitsHandler).
+		Methods("GET", "PUT")
+	// GET, PUT /_read_only
+	r.HandleFunc("/_read_only", conn.readOnlyHandler).
+		Methods("GET", "PUT")
+
+	// GET, PUT /_debug?enabled=$ENABLED
+	r.HandleFunc("/_debug", conn.debugHandler).
+		Methods("GET", "PUT")
+	// GET /debug/pprof/
+	// GET /debug/pprof/$PROFILE
+	// GET /debug/vars
+	for _, route := range debugRoutes {
+		r.HandleFunc(route.path, conn.debugEndpoint(route.handler)).
+			Methods("GET")
+	}
+
+	// GET /_ui
+	r.HandleFunc("/_ui", conn.uiHandler).
+		Methods("GET")
+
+	// GET /_openapi.json
+	r.HandleFunc("/_openapi.json", conn.openAPIHandler(r)).
+		Methods("GET")
+
+	// GET /_replication
+	r.HandleFunc("/_replication", conn.replicationHandler).
+		Methods("GET")
+
+	// GET /_cluster
+	// GET /_cluster?database=DATABASE_ID&stack=STACK_ID
+	r.HandleFunc("/_cluster", conn.clusterHandler).
+		Methods("GET")
+	// POST /_cluster/join?url=URL
+	r.HandleFunc("/_cluster/join", conn.joinClusterHandler).
+		Methods("POST")
+	// POST /_cluster/leave
+	// POST /_cluster/leave?url=URL
+	r.HandleFunc("/_cluster/leave", conn.leaveClusterHandler).
+		Methods("POST")
+	// PUT /_cluster/nodes + {nodes: [URL]}
+	r.HandleFunc("/_cluster/nodes", conn.clusterNodesHandler).
+		Methods("PUT")
+
+	// GET /_raft
+	r.HandleFunc("/_raft", conn.raftHandler).
+		Methods("GET")
+	// POST /_raft/vote + VOTE_REQUEST
+	r.HandleFunc("/_raft/vote", conn.raftVoteHandler).
+		Methods("POST")
+	// POST /_raft/append + APPEND_REQUEST
+	r.HandleFunc("/_raft/append", conn.raftAppendHandler).
+		Methods("POST")
+
+	// POST /_promote
+	r.HandleFunc("/_promote", conn.promoteHandler).
+		Methods("POST")
+
+	// POST /_snapshot
+	r.HandleFunc("/_snapshot", conn.snapshotHandler).
+		Methods("POST")
+
+	// GET, POST /_snapshots
+	r.HandleFunc("/_snapshots", conn.snapshotsHandler).
+		Methods("GET", "POST")
+
+	// POST /_compact
+	r.HandleFunc("/_compact", conn.compactHandler).
+		Methods("POST")
+
+	// POST /_provision?prune=$PRUNE&dry_run=$DRY_RUN + MANIFEST
+	r.HandleFunc("/_provision", conn.provisionHandler).
+		Methods("POST")
+
+	// POST /_migrate?from=$REDIS_URL&list=$LIST&to=$DATABASE_ID/$STACK_ID&drain=$DRAIN&json=$JSON
+	r.HandleFunc("/_migrate", conn.migrateHandler).
+		Methods("POST")
+
+	// POST /_restore + SNAPSHOT
+	// POST /_restore?dry_run=$DRY_RUN + SNAPSHOT
+	r.HandleFunc("/_restore", conn.restoreHandler).
+		Methods("POST")
+
+	// GET /_trash
+	r.HandleFunc("/_trash", conn.trashHandler).
+		Methods("GET")
+	// POST /_trash/$ID/restore
+	r.HandleFunc("/_trash/{id}/restore", conn.restoreTrashHandler).
+		Methods("POST")
+	// DELETE /_trash/$ID
+	r.HandleFunc("/_trash/{id}", conn.purgeTrashHandler).
+		Methods("DELETE")
+
+	// GET /_config
+	r.HandleFunc("/_config", conn.configHandler).
+		Methods("GET")
+	// GET /_config/$CONFIG_KEY
+	// POST /_config/$CONFIG_KEY + {element: value}
+	// PUT /_config/$CONFIG_KEY + {element: value}
+	r.Handle("/_config/{key}", conn.configKeyHandler("")).
+		Methods("GET", "POST", "PUT")
+
+	// GET /_tokens
+	// POST /_tokens + {token: TOKEN, role: ROLE, databases: [DATABASE_NAME]}
+	r.HandleFunc("/_tokens", conn.tokensHandler).
+		Methods("GET", "POST")
+	// GET /_tenants
+	// POST /_tenants + {name: TENANT, max_databases: N, max_stacks: N, max_memory: N}
+	r.HandleFunc("/_tenants", conn.tenantsHandler).
+		Methods("GET", "POST")
+	// DELETE /_tenants/$TENANT
+	r.HandleFunc("/_tenants/{tenant}", conn.tenantHandler).
+		Methods("DELETE")
+
+	// DELETE /_tokens/$TOKEN
+	r.HandleFunc("/_tokens/{token}", conn.tokenHandler).
+		Methods("DELETE")
+
+	// GET /_remotes
+	r.HandleFunc("/_remotes", conn.remotesHandler).
+		Methods("GET")
+
+	// GET /databases
+	// PUT /databases?name=DATABASE_NAME
+	// PUT /databases?name=DATABASE_NAME&template=TEMPLATE
+	// PUT /databases?remote=REMOTE_URL&name=DATABASE_NAME
+	r.HandleFunc("/databases", conn.databasesHandler).
+		Methods("GET", "PUT")
+	// GET /databases/$DATABASE_ID
+	// DELETE /databases/$DATABASE_ID
+	// DELETE /databases/$DATABASE_ID?cascade=false
+	// DELETE /databases/$DATABASE_ID?dry_run=$DRY_RUN
+	// PATCH /databases/$DATABASE_ID + {name: NAME}
+	r.Handle("/databases/{database_id}", DatabaseMiddleware(conn)(http.HandlerFunc(conn.databaseHandler))).
+		Methods("GET", "DELETE", "PATCH")
+
+	// GET /databases/$DATABASE_ID/stacks
+	// GET /databases/$DATABASE_ID/stacks?kv
+	// PUT /databases/$DATABASE_ID/stacks?name=STACK_NAME
+	r.Handle("/databases/{database_id}/stacks", DatabaseMiddleware(conn)(http.HandlerFunc(conn.stacksHandler))).
+		Methods("GET", "PUT")
+
+	// DELETE /databases/$DATABASE_ID/_flush
+	// DELETE /databases/$DATABASE_ID/_flush?dry_run=$DRY_RUN
+	r.Handle("/databases/{database_id}/_flush", DatabaseMiddleware(conn)(http.HandlerFunc(conn.flushDatabaseHandler))).
+		Methods("DELETE")
+
+	// GET /databases/$DATABASE_ID/_stats
+	r.Handle("/databases/{database_id}/_stats", DatabaseMiddleware(conn)(http.HandlerFunc(conn.databaseStatsHandler))).
+		Methods("GET")
+
+	// POST /databases/$DATABASE_ID/_transaction + [{op: OP, stack: STACK_ID, element: value}]
+	r.Handle("/databases/{database_id}/_transaction", DatabaseMiddleware(conn)(http.HandlerFunc(conn.transactionHandler))).
+		Methods("POST")
+
+	// POST /databases/$DATABASE_ID/_popush?from=STACK_ID&to=STACK_ID
+	r.Handle("/databases/{database_id}/_popush", DatabaseMiddleware(conn)(http.HandlerFunc(conn.popushHandler))).
+		Methods("POST")
+
+	// GET /databases/$DATABASE_ID/_keys
+	// POST /databases/$DATABASE_ID/_keys?scope=SCOPE
+	r.Handle("/databases/{database_id}/_keys", DatabaseMiddleware(conn)(http.HandlerFunc(conn.keysHandler))).
+		Methods("GET", "POST")
+
+	// DELETE /databases/$DATABASE_ID/_keys/$KEY_ID
+	r.Handle("/databases/{database_id}/_keys/{key_id}", DatabaseMiddleware(conn)(http.HandlerFunc(conn.keyHandler))).
+		Methods("DELETE")
+
+	// DELETE /databases/$DATABASE_ID/_popany?stacks=STACK_ID,STACK_ID
+	// DELETE /databases/$DATABASE_ID/_popany?stacks=STACK_ID,STACK_ID&wait=WAIT
+	r.Handle("/databases/{database_id}/_popany", DatabaseMiddleware(conn)(http.HandlerFunc(conn.popAnyHandler))).
+		Methods("DELETE")
+
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID?peek
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID?size
+	// POST /databases/$DATABASE_ID/stacks/$STACK_ID + {element: value}
+	// DELETE /databases/$DATABASE_ID/stacks/$STACK_ID
+	// DELETE /databases/$DATABASE_ID/stacks/$STACK_ID?flush
+	// DELETE /databases/$DATABASE_ID/stacks/$STACK_ID?full
+	// DELETE /databases/$DATABASE_ID/stacks/$STACK_ID?full&dry_run=$DRY_RUN
+	// DELETE /databases/$DATABASE_ID/stacks/$STACK_ID?flush&dry_run=$DRY_RUN
+	// PATCH /databases/$DATABASE_ID/stacks/$STACK_ID + {name: NAME}
+	r.Handle("/databases/{database_id}/stacks/{stack_id}", stackMiddlewares(conn, conn.stackHandler)).
+		Methods("GET", "POST", "DELETE", "PATCH")
+
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID/peek
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/peek", stackMiddlewares(conn, conn.stackOperationHandler(conn.peekStackHandler))).
+		Methods("GET")
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID/size
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/size", stackMiddlewares(conn, conn.stackOperationHandler(conn.sizeStackHandler))).
+		Methods("GET")
+	// DELETE /databases/$DATABASE_ID/stacks/$STACK_ID/pop
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/pop", stackMiddlewares(conn, conn.stackOperationHandler(conn.popStackHandler))).
+		Methods("DELETE")
+	// DELETE /databases/$DATABASE_ID/stacks/$STACK_ID/flush
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/flush", stackMiddlewares(conn, conn.stackOperationHandler(conn.flushStackHandler))).
+		Methods("DELETE")
+
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID/elements?offset=$OFFSET&limit=$LIMIT
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/elements", stackMiddlewares(conn, conn.stackOperationHandler(conn.elementsStackHandler))).
+		Methods("GET")
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID/_search?q=$QUERY&limit=$LIMIT
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_search", stackMiddlewares(conn, conn.stackOperationHandler(conn.searchStackHandler))).
+		Methods("GET")
+	// POST /databases/$DATABASE_ID/stacks/$STACK_ID/_undo
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_undo", stackMiddlewares(conn, conn.stackOperationHandler(conn.undoStackHandler))).
+		Methods("POST")
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID/_history?limit=$LIMIT
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_history", stackMiddlewares(conn, conn.stackOperationHandler(conn.historyStackHandler))).
+		Methods("GET")
+	// POST /databases/$DATABASE_ID/stacks/$STACK_ID/_archive
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_archive", stackMiddlewares(conn, conn.stackOperationHandler(conn.archiveStackHandler))).
+		Methods("POST")
+	// POST /databases/$DATABASE_ID/stacks/$STACK_ID/_unarchive
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_unarchive", DatabaseMiddleware(conn)(http.HandlerFunc(conn.unarchiveStackHandler))).
+		Methods("POST")
+	// POST /databases/$DATABASE_ID/stacks/$STACK_ID/_lock?ttl=$TTL&owner=$OWNER
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_lock", stackMiddlewares(conn, conn.stackOperationHandler(conn.lockStackHandler))).
+		Methods("POST")
+	// POST /databases/$DATABASE_ID/stacks/$STACK_ID/_unlock?owner=$OWNER
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_unlock", stackMiddlewares(conn, conn.stackOperationHandler(conn.unlockStackHandler))).
+		Methods("POST")
+	// POST /databases/$DATABASE_ID/stacks/$STACK_ID/rotate
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/rotate", stackMiddlewares(conn, conn.stackOperationHandler(conn.rotateStackHandler))).
+		Methods("POST")
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID/base
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/base", stackMiddlewares(conn, conn.stackOperationHandler(conn.baseStackHandler))).
+		Methods("GET")
+	// DELETE /databases/$DATABASE_ID/stacks/$STACK_ID/sweep
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/sweep", stackMiddlewares(conn, conn.stackOperationHandler(conn.sweepStackHandler))).
+		Methods("DELETE")
+	// POST /databases/$DATABASE_ID/stacks/$STACK_ID/_reverse
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_reverse", stackMiddlewares(conn, conn.stackOperationHandler(conn.reverseStackHandler))).
+		Methods("POST")
+	// POST /databases/$DATABASE_ID/stacks/$STACK_ID/_sort?by=$FIELD&order=$ORDER
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_sort", stackMiddlewares(conn, conn.stackOperationHandler(conn.sortStackHandler))).
+		Methods("POST")
+
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID/_groups
+	// PUT /databases/$DATABASE_ID/stacks/$STACK_ID/_groups?name=$GROUP&timeout=$TIMEOUT
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_groups", stackMiddlewares(conn, conn.stackOperationHandler(conn.groupsStackHandler))).
+		Methods("GET", "PUT")
+	// DELETE /databases/$DATABASE_ID/stacks/$STACK_ID/_groups/$GROUP
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_groups/{group}", stackMiddlewares(conn, conn.stackOperationHandler(conn.groupStackHandler))).
+		Methods("DELETE")
+	// DELETE /databases/$DATABASE_ID/stacks/$STACK_ID/_groups/$GROUP/pop?consumer=$CONSUMER
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_groups/{group}/pop", stackMiddlewares(conn, conn.stackOperationHandler(conn.popGroupStackHandler))).
+		Methods("DELETE")
+	// POST /databases/$DATABASE_ID/stacks/$STACK_ID/_groups/$GROUP/_ack?id=$ID
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_groups/{group}/_ack", stackMiddlewares(conn, conn.stackOperationHandler(conn.ackGroupStackHandler))).
+		Methods("POST")
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID/_groups/$GROUP/pending
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_groups/{group}/pending", stackMiddlewares(conn, conn.stackOperationHandler(conn.pendingGroupStackHandler))).
+		Methods("GET")
+
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID/_dead_letter
+	// PUT /databases/$DATABASE_ID/stacks/$STACK_ID/_dead_letter?stack=$DEAD_LETTER_STACK&max_deliveries=$MAX
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_dead_letter", stackMiddlewares(conn, conn.stackOperationHandler(conn.deadLetterStackHandler))).
+		Methods("GET", "PUT")
+
+	// POST /databases/$DATABASE_ID/stacks/$STACK_ID/_bulk + [element]
+	// DELETE /databases/$DATABASE_ID/stacks/$STACK_ID/_bulk?count=COUNT
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_bulk", stackMiddlewares(conn, conn.stackOperationHandler(conn.bulkStackHandler))).
+		Methods("POST", "DELETE")
+
+	// POST /databases/$DATABASE_ID/stacks/$STACK_ID/_move?to=$STACK_ID&to_database=$DATABASE_ID&count=COUNT
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_move", stackMiddlewares(conn, conn.stackOperationHandler(conn.moveStackHandler))).
+		Methods("POST")
+	// POST /databases/$DATABASE_ID/stacks/$STACK_ID/_copy?to=$STACK_ID&to_database=$DATABASE_ID&count=COUNT
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_copy", stackMiddlewares(conn, conn.stackOperationHandler(conn.copyStackHandler))).
+		Methods("POST")
+	// POST /databases/$DATABASE_ID/stacks/$STACK_ID/_transfer?to_database=$DATABASE_ID
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_transfer", stackMiddlewares(conn, conn.stackOperationHandler(conn.transferToDatabaseHandler))).
+		Methods("POST")
+
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID/_export
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_export", stackMiddlewares(conn, conn.stackOperationHandler(conn.exportStackHandler))).
+		Methods("GET")
+	// PUT /databases/$DATABASE_ID/stacks/$STACK_ID/_import + NDJSON elements
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_import", stackMiddlewares(conn, conn.stackOperationHandler(conn.importStackHandler))).
+		Methods("PUT")
+
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID/_subscribe
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_subscribe", stackMiddlewares(conn, conn.stackOperationHandler(conn.subscribeStackHandler))).
+		Methods("GET")
+
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID/_window
+	// PUT /databases/$DATABASE_ID/stacks/$STACK_ID/_window?every=$EVERY&schedule=$SCHEDULE&to=$STACK&archive=$ARCHIVE
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_window", stackMiddlewares(conn, conn.stackOperationHandler(conn.windowStackHandler))).
+		Methods("GET", "PUT")
+
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID/_watermarks
+	// PUT /databases/$DATABASE_ID/stacks/$STACK_ID/_watermarks?high_watermark=$HIGH&low_watermark=$LOW
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_watermarks", stackMiddlewares(conn, conn.stackOperationHandler(conn.watermarksStackHandler))).
+		Methods("GET", "PUT")
+
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID/_hooks
+	// PUT /databases/$DATABASE_ID/stacks/$STACK_ID/_hooks?url=$URL&ops=$OPS
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_hooks", stackMiddlewares(conn, conn.stackOperationHandler(conn.webhooksStackHandler))).
+		Methods("GET", "PUT")
+	// GET /databases/$DATABASE_ID/stacks/$STACK_ID/_hooks/$HOOK_ID
+	// DELETE /databases/$DATABASE_ID/stacks/$STACK_ID/_hooks/$HOOK_ID
+	r.Handle("/databases/{database_id}/stacks/{stack_id}/_hooks/{hook_id}", stackMiddlewares(conn, conn.stackOperationHandler(conn.webhookStackHandler))).
+		Methods("GET", "DELETE")
+
+	// label every route for the latency metrics
+	_ = r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if template, err := route.GetPathTemplate(); err == nil {
+			route.Handler(routeLabel(template, route.GetHandler()))
+		}
+		return nil
+	})
+
+	r.NotFoundHandler = http.HandlerFunc(conn.notFoundHandler)
+	return r
+}
+
+// stackMiddlewares chains DatabaseMiddleware and StackMiddleware
+// on a handler of a stack-level route.
+func stackMiddlewares(conn *Conn, handler http.HandlerFunc) http.Handler {
+	return DatabaseMiddleware(conn)(StackMiddleware(conn)(handler))
+}
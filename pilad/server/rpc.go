@@ -0,0 +1,406 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/logger"
+	"github.com/fern4lvarez/piladb/pkg/protobuf"
+)
+
+// rpcMaxMessageSize is the maximum size of a message of the RPC service.
+const rpcMaxMessageSize = 4 << 20
+
+// rpcMethods are the unary methods of the RPC service, whose messages
+// are described by proto/piladb.proto, returning the REST request
+// equivalent to their request message.
+var rpcMethods = map[string]func(b []byte) (*http.Request, error){
+	"CreateStack": rpcCreateStack,
+	"PushElement": rpcPushElement,
+	"PopElement":  rpcPopElement,
+	"Peek":        rpcPeek,
+}
+
+// rpcCall is a Call message of the RPC service.
+type rpcCall struct {
+	Method  string
+	Request []byte
+	Token   string
+}
+
+// ServeRPC accepts connections from clients of the RPC service on ln,
+// and serves their calls with handler, as if they were REST requests,
+// until ln is closed. It always returns a non-nil error.
+func (c *Conn) ServeRPC(ln net.Listener, handler http.Handler) error {
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go c.serveRPCConn(nc, handler)
+	}
+}
+
+// listenRPC listens for clients of the RPC service
+// on port, over TLS if tlsConf is not nil.
+func listenRPC(port int, tlsConf *tls.Config) (net.Listener, error) {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil || tlsConf == nil {
+		return ln, err
+	}
+	return tls.NewListener(ln, tlsConf), nil
+}
+
+// serveRPC serves the clients of the RPC service on ln with handler in
+// the background until ln is closed on shutdown. Errors on serving are
+// logged.
+func (c *Conn) serveRPC(ln net.Listener, handler http.Handler) {
+	go func() {
+		<-c.Shutdown.Requested()
+		ln.Close()
+	}()
+
+	logger.Info("serving RPC", "addr", ln.Addr())
+	go func() {
+		if err := c.ServeRPC(ln, handler); !c.Shutdown.IsRequested() {
+			logger.Error("error on serving RPC", "error", err)
+		}
+	}()
+}
+
+// serveRPCConn serves the calls of a connection one after the other,
+// until it is closed, a message is malformed or pilad shuts down.
+func (c *Conn) serveRPCConn(nc net.Conn, handler http.Handler) {
+	defer nc.Close()
+
+	r := bufio.NewReader(nc)
+	w := bufio.NewWriter(nc)
+	for !c.Shutdown.IsRequested() {
+		b, err := readRPCMessage(r)
+		if err != nil {
+			if err != io.EOF {
+				logger.Warn("error on reading RPC call", "client", nc.RemoteAddr(), "error", err)
+			}
+			return
+		}
+		call, err := decodeRPCCall(b)
+		if err != nil {
+			logger.Warn("error on reading RPC call", "client", nc.RemoteAddr(), "error", err)
+			return
+		}
+
+		if call.Method == "Status" {
+			err = c.rpcStatus(w, nc, handler, call)
+		} else {
+			err = writeRPCReply(w, rpcDo(nc, handler, call))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// rpcStatus streams the status of pilad, as requested by a call to
+// the Status method, until its count is reached or pilad shuts down.
+func (c *Conn) rpcStatus(w *bufio.Writer, nc net.Conn, handler http.Handler, call rpcCall) error {
+	interval, count := time.Second, int64(0)
+	r := protobuf.NewReader(call.Request)
+	for {
+		field, _, ok := r.Next()
+		if !ok {
+			break
+		}
+		switch field {
+		case 1:
+			if ms := r.Int(); ms > 0 {
+				interval = time.Duration(ms) * time.Millisecond
+			}
+		case 2:
+			count = r.Int()
+		default:
+			r.Skip()
+		}
+	}
+	if err := r.Err(); err != nil {
+		return writeRPCReply(w, rpcError(http.StatusBadRequest, err))
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for i := int64(0); count == 0 || i < count; i++ {
+		if i > 0 {
+			select {
+			case <-ticker.C:
+			case <-c.Shutdown.Requested():
+				return nil
+			}
+		}
+		call.Method, call.Request = "", nil
+		req, _ := http.NewRequest("GET", "/_status", nil)
+		if err := writeRPCReply(w, rpcServe(nc, handler, call, req)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rpcDo runs a call of a unary method, returning its Reply message.
+func rpcDo(nc net.Conn, handler http.Handler, call rpcCall) []byte {
+	method, ok := rpcMethods[call.Method]
+	if !ok {
+		return rpcError(http.StatusNotImplemented, fmt.Errorf("unknown method %s", call.Method))
+	}
+	req, err := method(call.Request)
+	if err != nil {
+		return rpcError(http.StatusBadRequest, err)
+	}
+	return rpcServe(nc, handler, call, req)
+}
+
+// rpcServe serves req with handler on behalf of the client of nc,
+// authenticated with the token of call, returning the Reply
+// message with its response.
+func rpcServe(nc net.Conn, handler http.Handler, call rpcCall, req *http.Request) []byte {
+	req.RemoteAddr = nc.RemoteAddr().String()
+	req.Header.Set("Accept", protobufContentType)
+	if call.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+call.Token)
+	}
+
+	w := &rpcResponseWriter{header: make(http.Header)}
+	handler.ServeHTTP(w, req)
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if w.code >= http.StatusBadRequest {
+		message := strings.TrimSpace(w.body.String())
+		if message == "" {
+			message = http.StatusText(w.code)
+		}
+		return rpcError(w.code, errors.New(message))
+	}
+
+	var b []byte
+	b = protobuf.AppendInt(b, 1, int64(w.code))
+	b = protobuf.AppendBytes(b, 2, w.body.Bytes())
+	return b
+}
+
+// rpcError returns the Reply message of a failed call.
+func rpcError(code int, err error) []byte {
+	var b []byte
+	b = protobuf.AppendInt(b, 1, int64(code))
+	b = protobuf.AppendString(b, 3, err.Error())
+	return b
+}
+
+// rpcCreateStack returns the REST request of a CreateStack call.
+func rpcCreateStack(b []byte) (*http.Request, error) {
+	var database string
+	query := url.Values{}
+	r := protobuf.NewReader(b)
+	for {
+		field, _, ok := r.Next()
+		if !ok {
+			break
+		}
+		switch field {
+		case 1:
+			database = r.String()
+		case 2:
+			query.Set("name", r.String())
+		case 3:
+			query.Set("type", r.String())
+		case 4:
+			query.Set("max_size", strconv.FormatInt(r.Int(), 10))
+		case 5:
+			query.Set("policy", r.String())
+		case 6:
+			query.Set("store", r.String())
+		default:
+			r.Skip()
+		}
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	return http.NewRequest("PUT", "/databases/"+url.PathEscape(database)+"/stacks?"+query.Encode(), nil)
+}
+
+// rpcPushElement returns the REST request of a PushElement call,
+// whose body is the Element message.
+func rpcPushElement(b []byte) (*http.Request, error) {
+	var database, stack string
+	var element []byte
+	r := protobuf.NewReader(b)
+	for {
+		field, _, ok := r.Next()
+		if !ok {
+			break
+		}
+		switch field {
+		case 1:
+			database = r.String()
+		case 2:
+			stack = r.String()
+		case 3:
+			element = r.Bytes()
+		default:
+			r.Skip()
+		}
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", stackPath(database, stack), bytes.NewReader(element))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", protobufContentType)
+	return req, nil
+}
+
+// rpcPopElement returns the REST request of a PopElement call.
+func rpcPopElement(b []byte) (*http.Request, error) {
+	return rpcStackRequest("DELETE", "", b)
+}
+
+// rpcPeek returns the REST request of a Peek call.
+func rpcPeek(b []byte) (*http.Request, error) {
+	return rpcStackRequest("GET", "peek", b)
+}
+
+// rpcStackRequest returns a REST request on the Stack
+// given by a StackRequest message.
+func rpcStackRequest(method, query string, b []byte) (*http.Request, error) {
+	var database, stack string
+	r := protobuf.NewReader(b)
+	for {
+		field, _, ok := r.Next()
+		if !ok {
+			break
+		}
+		switch field {
+		case 1:
+			database = r.String()
+		case 2:
+			stack = r.String()
+		default:
+			r.Skip()
+		}
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	path := stackPath(database, stack)
+	if query != "" {
+		path += "?" + query
+	}
+	return http.NewRequest(method, path, nil)
+}
+
+// stackPath returns the REST path of a Stack given its Database,
+// escaping their IDs or names, which may contain any character.
+func stackPath(database, stack string) string {
+	return "/databases/" + url.PathEscape(database) + "/stacks/" + url.PathEscape(stack)
+}
+
+// decodeRPCCall decodes a Call message.
+func decodeRPCCall(b []byte) (rpcCall, error) {
+	var call rpcCall
+	r := protobuf.NewReader(b)
+	for {
+		field, _, ok := r.Next()
+		if !ok {
+			break
+		}
+		switch field {
+		case 1:
+			call.Method = r.String()
+		case 2:
+			call.Request = r.Bytes()
+		case 3:
+			call.Token = r.String()
+		default:
+			r.Skip()
+		}
+	}
+	return call, r.Err()
+}
+
+// readRPCMessage reads a framed message: a byte equal to 0, as
+// compression is not supported, and the size of the message as
+// a 4 byte big-endian integer, followed by the message.
+func readRPCMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > rpcMaxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds the %d bytes limit", size, rpcMaxMessageSize)
+	}
+
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// writeRPCReply writes a Reply message framed
+// like readRPCMessage reads it, and flushes it.
+func writeRPCReply(w *bufio.Writer, b []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(b)))
+	w.Write(prefix[:])
+	w.Write(b)
+	return w.Flush()
+}
+
+// rpcResponseWriter is an http.ResponseWriter
+// keeping the response of a call in memory.
+type rpcResponseWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+// Header returns the header of the response.
+func (w *rpcResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader sets the status code of the
+// response, unless it is already set.
+func (w *rpcResponseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+// Write appends b to the body of the response.
+func (w *rpcResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
@@ -0,0 +1,293 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/protobuf"
+)
+
+// rpcClient is a minimal client of the RPC service for testing.
+type rpcClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// rpcReply is a decoded Reply message.
+type rpcReply struct {
+	code     int
+	response []byte
+	err      string
+}
+
+// dialRPC serves RPC connections of conn with its Router behind the
+// AuthMiddleware, and returns a client connected to it, and a
+// function closing both.
+func dialRPC(t *testing.T, conn *Conn) (*rpcClient, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go conn.ServeRPC(ln, AuthMiddleware(conn)(Router(conn)))
+
+	nc, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		ln.Close()
+		t.Fatal(err)
+	}
+	return &rpcClient{conn: nc, r: bufio.NewReader(nc)}, func() {
+		nc.Close()
+		ln.Close()
+	}
+}
+
+// send sends a Call of method with a request message and token.
+func (c *rpcClient) send(t *testing.T, method string, request []byte, token string) {
+	var b []byte
+	b = protobuf.AppendString(b, 1, method)
+	b = protobuf.AppendBytes(b, 2, request)
+	b = protobuf.AppendString(b, 3, token)
+
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(b)))
+	if _, err := c.conn.Write(append(prefix[:], b...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// reply reads and decodes a Reply.
+func (c *rpcClient) reply(t *testing.T) rpcReply {
+	_ = c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	b, err := readRPCMessage(c.r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reply rpcReply
+	r := protobuf.NewReader(b)
+	for {
+		field, _, ok := r.Next()
+		if !ok {
+			break
+		}
+		switch field {
+		case 1:
+			reply.code = int(r.Int())
+		case 2:
+			reply.response = r.Bytes()
+		case 3:
+			reply.err = r.String()
+		default:
+			r.Skip()
+		}
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+// call sends a Call and returns its Reply.
+func (c *rpcClient) call(t *testing.T, method string, request []byte, token string) rpcReply {
+	c.send(t, method, request, token)
+	return c.reply(t)
+}
+
+// stackRequest returns a StackRequest message.
+func stackRequest(database, stack string) []byte {
+	var b []byte
+	b = protobuf.AppendString(b, 1, database)
+	return protobuf.AppendString(b, 2, stack)
+}
+
+func TestRPC(t *testing.T) {
+	conn := NewConn()
+	_ = conn.Pila.AddDatabase(pila.NewDatabase("db"))
+	client, closeRPC := dialRPC(t, conn)
+	defer closeRPC()
+
+	var create []byte
+	create = protobuf.AppendString(create, 1, "db")
+	create = protobuf.AppendString(create, 2, "stack")
+	create = protobuf.AppendInt(create, 4, 2)
+	reply := client.call(t, "CreateStack", create, "")
+	if reply.code != http.StatusCreated || reply.err != "" {
+		t.Fatalf("reply code and error are %d and %q, expected %d and none", reply.code, reply.err, http.StatusCreated)
+	}
+	db, _ := conn.Pila.DatabaseByName("db")
+	stack, ok := db.StackByName("stack")
+	if !ok {
+		t.Fatal("stack not created")
+	}
+	expected, _ := stack.Status().ToProto()
+	if !bytes.Equal(reply.response, expected) {
+		t.Errorf("response is %v, expected %v", reply.response, expected)
+	}
+
+	for _, value := range []interface{}{"foo", map[string]interface{}{"bar": 1}} {
+		element, _ := pila.NewElement(value).ToProto()
+		var push []byte
+		push = protobuf.AppendString(push, 1, "db")
+		push = protobuf.AppendString(push, 2, "stack")
+		push = protobuf.AppendBytes(push, 3, element)
+		if reply := client.call(t, "PushElement", push, ""); reply.code != http.StatusOK {
+			t.Errorf("reply code is %d, expected %d: %s", reply.code, http.StatusOK, reply.err)
+		}
+	}
+	if stack.Size() != 2 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 2)
+	}
+
+	for _, io := range []struct {
+		method string
+		value  interface{}
+	}{
+		{"Peek", map[string]interface{}{"bar": float64(1)}},
+		{"PopElement", map[string]interface{}{"bar": float64(1)}},
+		{"PopElement", "foo"},
+	} {
+		reply := client.call(t, io.method, stackRequest("db", "stack"), "")
+		var element pila.Element
+		if err := element.DecodeProto(reply.response); err != nil {
+			t.Fatal(err)
+		}
+		if reply.code != http.StatusOK || !reflect.DeepEqual(element.Value, io.value) {
+			t.Errorf("%s reply code and value are %d and %v, expected %d and %v", io.method, reply.code, element.Value, http.StatusOK, io.value)
+		}
+	}
+
+	if reply := client.call(t, "PopElement", stackRequest("db", "stack"), ""); reply.code != http.StatusNoContent {
+		t.Errorf("reply code is %d, expected %d", reply.code, http.StatusNoContent)
+	}
+	if reply := client.call(t, "Peek", stackRequest("db", "nope"), ""); reply.code != http.StatusGone || reply.err == "" {
+		t.Errorf("reply code and error are %d and %q, expected %d and an error", reply.code, reply.err, http.StatusGone)
+	}
+	if reply := client.call(t, "Rotate", nil, ""); reply.code != http.StatusNotImplemented {
+		t.Errorf("reply code is %d, expected %d", reply.code, http.StatusNotImplemented)
+	}
+}
+
+func TestRPC_Status(t *testing.T) {
+	conn := NewConn()
+	client, closeRPC := dialRPC(t, conn)
+	defer closeRPC()
+
+	var request []byte
+	request = protobuf.AppendInt(request, 1, 10)
+	request = protobuf.AppendInt(request, 2, 3)
+	client.send(t, "Status", request, "")
+	for i := 0; i < 3; i++ {
+		reply := client.reply(t)
+		if reply.code != http.StatusOK || len(reply.response) == 0 {
+			t.Errorf("reply code is %d with %d bytes, expected %d with a status", reply.code, len(reply.response), http.StatusOK)
+		}
+	}
+
+	// the connection serves calls after the stream
+	if reply := client.call(t, "Peek", stackRequest("db", "stack"), ""); reply.code != http.StatusGone {
+		t.Errorf("reply code is %d, expected %d", reply.code, http.StatusGone)
+	}
+}
+
+func TestRPC_Auth(t *testing.T) {
+	conn := NewConn()
+	_ = conn.Pila.AddDatabase(pila.NewDatabase("db"))
+	_ = conn.Auth.Add(Token{Token: "reader", Role: RoleRead})
+	client, closeRPC := dialRPC(t, conn)
+	defer closeRPC()
+
+	var create []byte
+	create = protobuf.AppendString(create, 1, "db")
+	create = protobuf.AppendString(create, 2, "stack")
+	for _, io := range []struct {
+		token string
+		code  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"foo", http.StatusUnauthorized},
+		{"reader", http.StatusForbidden},
+	} {
+		if reply := client.call(t, "CreateStack", create, io.token); reply.code != io.code {
+			t.Errorf("reply code is %d, expected %d for token %q", reply.code, io.code, io.token)
+		}
+	}
+}
+
+func TestRPC_Escape(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	_ = db.AddStack(pila.NewStack("stack", time.Now().UTC()))
+	client, closeRPC := dialRPC(t, conn)
+	defer closeRPC()
+
+	for _, stack := range []string{"stack?size", "stack#peek"} {
+		if reply := client.call(t, "Peek", stackRequest("db", stack), ""); reply.code != http.StatusGone {
+			t.Errorf("reply code is %d, expected %d for stack %q", reply.code, http.StatusGone, stack)
+		}
+	}
+}
+
+func TestServeRPC_TLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cert, _ := testCert(t, dir, "server", nil, nil)
+	tlsConf, err := tlsConfig(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := listenRPC(0, tlsConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := NewConn()
+	defer conn.Shutdown.Request()
+	conn.serveRPC(ln, Router(conn))
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	nc, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", ln.Addr().(*net.TCPAddr).Port), &tls.Config{RootCAs: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	client := &rpcClient{conn: nc, r: bufio.NewReader(nc)}
+	if reply := client.call(t, "Peek", stackRequest("db", "stack"), ""); reply.code != http.StatusGone {
+		t.Errorf("reply code is %d, expected %d", reply.code, http.StatusGone)
+	}
+}
+
+func TestReadRPCMessage(t *testing.T) {
+	for _, input := range [][]byte{
+		{1, 0, 0, 0, 0},
+		{0, 0xff, 0, 0, 0},
+		{0, 0, 0, 0, 2, 1},
+	} {
+		if _, err := readRPCMessage(bytes.NewReader(input)); err == nil {
+			t.Errorf("err is nil, expected an error for %v", input)
+		}
+	}
+
+	b, err := readRPCMessage(bytes.NewReader([]byte{0, 0, 0, 0, 2, 1, 2}))
+	if err != nil || !bytes.Equal(b, []byte{1, 2}) {
+		t.Errorf("message is %v with error %v, expected %v", b, err, []byte{1, 2})
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// SearchResult represents the elements of a Stack matching a query.
+type SearchResult struct {
+	Matches []pila.SearchMatch `json:"matches"`
+	// Total is the number of matching elements,
+	// which may be more than the returned ones
+	Total int `json:"total"`
+}
+
+// ToJSON converts a SearchResult into JSON.
+func (result SearchResult) ToJSON() ([]byte, error) {
+	return json.Marshal(result)
+}
+
+// searchStackHandler returns 200 and the elements of the Stack matching
+// the q parameter, up to limit, with their depth in the Stack. See
+// pila.ParseQuery for the syntax of the query.
+func (c *Conn) searchStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	query, err := pila.ParseQuery(r.FormValue("q"))
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(r, "limit", elementsLimitDefault, elementsLimitMax)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var result SearchResult
+	result.Matches, result.Total = stack.Search(query, limit)
+	if result.Matches == nil {
+		result.Matches = []pila.SearchMatch{}
+	}
+	stack.Read(requestDate(r))
+
+	logResponse(r, http.StatusOK, "matches", len(result.Matches))
+	w.Header().Set("Content-Type", "application/json")
+
+	// Do not check error as we consider our elements
+	// suitable for a JSON encoding.
+	b, _ := result.ToJSON()
+	w.Write(b)
+}
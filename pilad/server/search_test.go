@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestSearchStackHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = stack.PushN([]interface{}{
+		map[string]interface{}{"name": "ada", "age": 36},
+		"adams",
+		map[string]interface{}{"name": "bob"},
+		8,
+	})
+	_ = db.AddStack(stack)
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		query string
+		code  int
+		body  string
+	}{
+		{"?q=ada", http.StatusOK,
+			`{"matches":[{"depth":2,"element":"adams"},{"depth":3,"element":{"age":36,"name":"ada"}}],"total":2}`},
+		{"?q=ada&limit=1", http.StatusOK,
+			`{"matches":[{"depth":2,"element":"adams"}],"total":2}`},
+		{"?q=" + url.QueryEscape(`$.name == "bob"`), http.StatusOK,
+			`{"matches":[{"depth":1,"element":{"name":"bob"}}],"total":1}`},
+		{"?q=" + url.QueryEscape("$.age"), http.StatusOK,
+			`{"matches":[{"depth":3,"element":{"age":36,"name":"ada"}}],"total":1}`},
+		{"?q=zoe", http.StatusOK, `{"matches":[],"total":0}`},
+		{"", http.StatusBadRequest, ""},
+		{"?q=" + url.QueryEscape("$.name..first"), http.StatusBadRequest, ""},
+		{"?q=ada&limit=0", http.StatusBadRequest, ""},
+	}
+
+	for _, io := range inputOutput {
+		path := "/databases/db/stacks/stack/_search" + io.query
+		request, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, path)
+		}
+		if body := response.Body.String(); body != io.body {
+			t.Errorf("body is %s, expected %s for %s", body, io.body, path)
+		}
+	}
+
+	if stack.Size() != 4 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 4)
+	}
+
+	request, _ := http.NewRequest("GET", "/databases/db/stacks/foo/_search?q=ada", nil)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusGone {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusGone)
+	}
+}
@@ -0,0 +1,351 @@
+// Package server implements the piladb server run by pilad, so it can
+// also be embedded in-process by other applications, e.g. in their tests
+// or to ship piladb within a single binary.
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// Server is a piladb server.
+type Server struct {
+	// Conn is the connection served, whose Pila may
+	// be accessed directly by an embedding application
+	Conn *Conn
+
+	opts    Options
+	handler http.Handler
+	srv     *http.Server
+	ln      net.Listener
+	logFile *os.File
+
+	// done is closed once the Server stopped serving
+	done chan struct{}
+	err  error
+
+	// mu protects the listener
+	mu sync.Mutex
+}
+
+// New returns a Server configured by opts, with the Databases and
+// Stacks of its snapshots or persistence files, if any, loaded. It
+// returns an InvalidConfigError if the config values are not valid.
+//
+// The log entries of pilad are written by the default logger of
+// the logger package, and the standard logger, which are configured
+// by New.
+func New(opts Options) (*Server, error) {
+	conn := NewConn()
+	if err := conn.buildConfig(opts); err != nil {
+		return nil, err
+	}
+	if err := conn.validateConfig(opts); err != nil {
+		return nil, err
+	}
+	format, err := logger.ParseFormat(opts.LogFormat)
+	if err != nil {
+		return nil, err
+	}
+	conn.LogFormat = format
+
+	s := &Server{Conn: conn, opts: opts, done: make(chan struct{})}
+	if opts.LogFile != "" {
+		if s.logFile, err = openLogFile(opts.LogFile); err != nil {
+			return nil, err
+		}
+		logOutput = s.logFile
+	}
+	conn.setLogLevel()
+
+	if err := s.setUp(); err != nil {
+		s.closeLogFile()
+		return nil, err
+	}
+	return s, nil
+}
+
+// setUp sets up the Conn of the Server from its Options.
+func (s *Server) setUp() error {
+	conn, opts := s.Conn, s.opts
+	for _, t := range opts.Tokens {
+		if err := conn.Auth.Add(t); err != nil {
+			return err
+		}
+	}
+	for _, t := range opts.Tenants {
+		if err := conn.Tenants.Add(t); err != nil {
+			return err
+		}
+	}
+	if err := conn.ACL.Set(ACLRules{Allow: opts.Allow, Deny: opts.Deny, Databases: opts.AllowDatabase}); err != nil {
+		return err
+	}
+	conn.SetReadOnly(opts.ReadOnly)
+	conn.SetDebug(opts.Debug)
+	conn.Pila.SetSpillDir(conn.Config.SpillDir())
+	conn.Pila.SetKeyring(conn.Config.EncryptionKeys())
+
+	if opts.Peers != "" {
+		conn.Peers = NewPeerList(strings.Split(opts.Peers, ","))
+	}
+
+	if opts.ReplicaOf != "" {
+		if conn.Config.PersistDir() != "" || opts.AutoPersistPath != "" {
+			return errors.New("a follower can not persist its Pila, disable PERSIST_DIR and AutoPersistPath")
+		}
+		conn.Replication.Follow(opts.ReplicaOf)
+	}
+
+	if opts.ClusterSelf != "" {
+		if opts.ReplicaOf != "" {
+			return errors.New("a follower can not be a node of a cluster, disable ReplicaOf")
+		}
+		conn.Cluster.Start(opts.ClusterSelf, opts.ClusterToken)
+	} else if opts.ClusterJoin != "" {
+		return errors.New("ClusterJoin requires ClusterSelf")
+	}
+
+	if opts.RaftSelf != "" {
+		if opts.AutoPersistPath != "" || opts.ReplicaOf != "" || opts.ClusterSelf != "" {
+			return errors.New("a Raft node restores its Pila from the Raft log in PERSIST_DIR, disable AutoPersistPath, ReplicaOf and ClusterSelf")
+		}
+	} else if opts.RaftPeers != "" {
+		return errors.New("RaftPeers requires RaftSelf")
+	}
+
+	if opts.SnapshotDir != "" {
+		if conn.Config.PersistDir() != "" || opts.AutoPersistPath != "" || opts.ReplicaOf != "" || opts.RaftSelf != "" {
+			return errors.New("snapshots are loaded on start-up, disable PERSIST_DIR, AutoPersistPath, ReplicaOf and RaftSelf")
+		}
+		if err := conn.Snapshots.Enable(opts.SnapshotDir, opts.SnapshotKeep); err != nil {
+			return fmt.Errorf("error on opening snapshot directory: %v", err)
+		}
+		f, ok, err := conn.Snapshots.LoadLatest(conn.Pila)
+		if err != nil {
+			return fmt.Errorf("error on loading snapshot %s: %v", f.Name, err)
+		}
+		if ok {
+			logger.Info("loaded snapshot", "name", f.Name)
+		}
+	} else if opts.SnapshotInterval > 0 {
+		return errors.New("SnapshotInterval requires SnapshotDir")
+	}
+
+	if opts.AuditFile != "" {
+		if err := conn.Audit.Open(opts.AuditFile, opts.AuditMaxSize, opts.AuditKeep); err != nil {
+			return fmt.Errorf("error on opening audit file: %v", err)
+		}
+	}
+
+	if opts.ArchiveDir != "" {
+		if err := os.MkdirAll(opts.ArchiveDir, 0755); err != nil {
+			return fmt.Errorf("error on opening archive directory: %v", err)
+		}
+		if err := conn.Archives.Enable(DirArchiveStore(opts.ArchiveDir)); err != nil {
+			return fmt.Errorf("error on loading archive index: %v", err)
+		}
+	}
+
+	conn.Trash.SetRetention(opts.TrashRetention)
+
+	// a Raft node keeps its Raft log in PERSIST_DIR instead
+	if persistDir := conn.Config.PersistDir(); persistDir != "" && opts.RaftSelf == "" {
+		if err := conn.openLog(persistDir); err != nil {
+			return fmt.Errorf("error on opening persistence log: %v", err)
+		}
+	} else if opts.CompactSize > 0 || opts.CompactOps > 0 {
+		return errors.New("CompactSize and CompactOps require PERSIST_DIR, out of Raft mode")
+	}
+
+	handler := AuthMiddleware(conn)(TenantMiddleware(conn)(LimitsMiddleware(conn)(RemoteMiddleware(conn)(ClusterMiddleware(conn)(ReadOnlyMiddleware(conn)(RaftMiddleware(conn)(ReplicationMiddleware(conn)(Router(conn)))))))))
+	if opts.AutoPersistPath != "" {
+		if err := conn.Pila.Load(opts.AutoPersistPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error on loading pila from %s: %v", opts.AutoPersistPath, err)
+		}
+		handler = PersistenceMiddleware(conn.Pila, opts.AutoPersistPath)(handler)
+	}
+	handler = GzipMiddleware()(handler)
+	handler = RateLimitMiddleware(conn)(handler)
+	handler = MetricsMiddleware(conn)(handler)
+	handler = ShutdownMiddleware(conn)(handler)
+	handler = CORSMiddleware(conn)(handler)
+	handler = AuditMiddleware(conn)(handler)
+	handler = ACLMiddleware(conn)(handler)
+	handler = ErrorMiddleware()(handler)
+	s.handler = RequestLoggingMiddleware(logger.Default())(handler)
+	return nil
+}
+
+// Handler returns the HTTP handler of the Server, with
+// all its middlewares, which is served by Start.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Start starts serving the Server in the background, along with the
+// RESP, RPC and HTTPS redirection ports, and joining the cluster or Raft
+// group, if enabled. It returns once the Server listens. Every port is
+// listened on before any is served, so they are all closed on error.
+func (s *Server) Start() error {
+	conn, opts := s.Conn, s.opts
+	logo(conn)
+
+	s.srv = &http.Server{
+		Addr:         fmt.Sprintf(":%d", conn.Config.Port()),
+		Handler:      s.handler,
+		ReadTimeout:  conn.Config.ReadTimeout() * time.Second,
+		WriteTimeout: conn.Config.WriteTimeout() * time.Second,
+	}
+	ln := opts.Listener
+	if ln == nil {
+		var err error
+		if ln, err = net.Listen("tcp", s.srv.Addr); err != nil {
+			return err
+		}
+	}
+	listeners := []net.Listener{ln}
+	fail := func(format string, err error) error {
+		for _, l := range listeners {
+			l.Close()
+		}
+		return fmt.Errorf(format, err)
+	}
+
+	var tlsConf *tls.Config
+	if opts.TLSCert != "" || opts.TLSKey != "" {
+		var err error
+		if tlsConf, err = tlsConfig(opts.TLSCert, opts.TLSKey, opts.TLSClientCA); err != nil {
+			return fail("error on loading TLS config: %v", err)
+		}
+		s.srv.TLSConfig = tlsConf
+		ln = tls.NewListener(ln, tlsConf)
+	}
+	var respLn, rpcLn net.Listener
+	if opts.RESPPort != 0 {
+		var err error
+		if respLn, err = net.Listen("tcp", fmt.Sprintf(":%d", opts.RESPPort)); err != nil {
+			return fail("error on listening RESP: %v", err)
+		}
+		listeners = append(listeners, respLn)
+	}
+	if opts.RPCPort != 0 {
+		var err error
+		if rpcLn, err = listenRPC(opts.RPCPort, tlsConf); err != nil {
+			return fail("error on listening RPC: %v", err)
+		}
+		listeners = append(listeners, rpcLn)
+	}
+	if opts.RaftSelf != "" {
+		if err := conn.StartRaft(opts.RaftSelf, strings.Split(opts.RaftPeers, ","), opts.RaftToken, conn.Config.PersistDir(), raftHeartbeatInterval); err != nil {
+			return fail("error on starting raft: %v", err)
+		}
+	}
+
+	if tlsConf != nil && opts.RedirectPort != 0 {
+		go func() {
+			err := http.ListenAndServe(fmt.Sprintf(":%d", opts.RedirectPort), redirectHandler(conn.Config.Port()))
+			logger.Error("error on serving HTTPS redirection", "error", err)
+		}()
+	}
+	if respLn != nil {
+		conn.serveRESP(respLn)
+	}
+	if rpcLn != nil {
+		conn.serveRPC(rpcLn, s.handler)
+	}
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+
+	stop := conn.Shutdown.Requested()
+	if opts.Peers != "" {
+		go conn.Peers.GossipHeartbeat(heartbeatInterval, stop)
+	}
+	if opts.ReplicaOf != "" {
+		go conn.Replicate(replicationRetryInterval)
+	}
+	if opts.ClusterJoin != "" {
+		// not ready until joined
+		conn.Cluster.setJoining(true)
+		go conn.JoinCluster(opts.ClusterJoin, clusterJoinRetryInterval)
+	}
+	if opts.SnapshotDir != "" && opts.SnapshotInterval > 0 {
+		go conn.SnapshotScheduler(opts.SnapshotInterval, stop)
+	}
+	if conn.Log != nil && (opts.CompactSize > 0 || opts.CompactOps > 0) {
+		go conn.CompactionScheduler(compactionInterval, opts.CompactSize, opts.CompactOps, stop)
+	}
+	go conn.ExpirationSweeper(expirationInterval, stop)
+	go conn.WindowScheduler(windowInterval, stop)
+
+	// Stop accepting connections on Shutdown
+	// or POST /_shutdown, so Serve returns.
+	go func() {
+		<-stop
+		s.srv.SetKeepAlivesEnabled(false)
+		ln.Close()
+	}()
+
+	conn.SetStarted()
+	go s.serve(ln)
+	return nil
+}
+
+// serve serves the Server until its shutdown is requested, and then
+// drains the requests in flight and closes the Conn.
+func (s *Server) serve(ln net.Listener) {
+	defer close(s.done)
+	defer s.closeLogFile()
+
+	if err := s.srv.Serve(ln); !s.Conn.Shutdown.IsRequested() {
+		s.err = err
+		s.Conn.Shutdown.Request()
+	}
+	s.Conn.close(time.Duration(s.opts.ShutdownTimeout)*time.Second, s.opts.AutoPersistPath)
+}
+
+// closeLogFile closes the log file of the Server, if any.
+func (s *Server) closeLogFile() {
+	if s.logFile != nil {
+		logOutput = os.Stderr
+		s.Conn.setLogLevel()
+		s.logFile.Close()
+	}
+}
+
+// Addr returns the address the Server listens on,
+// or nil if it was not started.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Addr()
+}
+
+// Shutdown stops the Server gracefully, as POST /_shutdown does,
+// and waits until it is stopped. See Wait.
+func (s *Server) Shutdown() error {
+	s.Conn.Shutdown.Request()
+	return s.Wait()
+}
+
+// Wait waits until the Server is stopped, either by Shutdown or POST
+// /_shutdown, and the requests in flight are drained, and returns the
+// error that made it stop serving otherwise. It must not be called
+// unless the Server was started.
+func (s *Server) Wait() error {
+	<-s.done
+	return s.err
+}
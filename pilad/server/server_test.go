@@ -0,0 +1,204 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fern4lvarez/piladb/config"
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// testOptions returns the Options of a Server listening on
+// a random port, which does not log.
+func testOptions(t *testing.T) Options {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.LogLevel = config.LogLevelOff
+	opts.Listener = ln
+	return opts
+}
+
+func TestNew(t *testing.T) {
+	defer NewConn().setLogLevel()
+
+	s, err := New(testOptions(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.opts.Listener.Close()
+
+	if addr := s.Addr(); addr != nil {
+		t.Errorf("addr is %v, expected nil", addr)
+	}
+
+	request, _ := http.NewRequest("PUT", "/databases?name=db", nil)
+	response := httptest.NewRecorder()
+	s.Handler().ServeHTTP(response, request)
+
+	if response.Code != http.StatusCreated {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusCreated)
+	}
+	if _, ok := s.Conn.Pila.ResolveDatabase("db"); !ok {
+		t.Error("database db was not created")
+	}
+}
+
+func TestNew_Error(t *testing.T) {
+	defer NewConn().setLogLevel()
+
+	dir, err := ioutil.TempDir("", "pilad-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inputOutput := []struct {
+		name  string
+		input func(*Options)
+	}{
+		{"invalid port", func(o *Options) { o.Port = 80 }},
+		{"invalid log format", func(o *Options) { o.LogFormat = "xml" }},
+		{"invalid token", func(o *Options) { o.Tokens = []Token{{Token: "foo"}} }},
+		{"invalid allow", func(o *Options) { o.Allow = []string{"foo"} }},
+		{"missing config file", func(o *Options) { o.ConfigFile = filepath.Join(dir, "foo.yml") }},
+		{"join without self", func(o *Options) { o.ClusterJoin = "http://127.0.0.1:1205" }},
+		{"raft peers without self", func(o *Options) { o.RaftPeers = "http://127.0.0.1:1205" }},
+		{"snapshot interval without dir", func(o *Options) { o.SnapshotInterval = 1 }},
+		{"compaction without persist dir", func(o *Options) { o.CompactOps = 1 }},
+		{"follower persisting", func(o *Options) {
+			o.ReplicaOf = "http://127.0.0.1:1205"
+			o.AutoPersistPath = filepath.Join(dir, "pila")
+		}},
+	}
+
+	for _, io := range inputOutput {
+		opts := DefaultOptions()
+		opts.LogLevel = config.LogLevelOff
+		io.input(&opts)
+		if _, err := New(opts); err == nil {
+			t.Errorf("%s: err is nil", io.name)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.Port = 80
+	if _, err := New(opts); err == nil || err.Error() != `{"errors":[{"field":"PORT","message":"80 is out of range 1025-65535"}]}` {
+		t.Errorf("err is %v, expected InvalidConfigError", err)
+	}
+
+	opts = DefaultOptions()
+	opts.TLSCert = "server.crt"
+	if _, err := New(opts); err == nil || err.Error() != `{"errors":[{"field":"tls-cert","message":"tls-cert and tls-key must be given together"}]}` {
+		t.Errorf("err is %v, expected InvalidConfigError", err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	defer NewConn().setLogLevel()
+
+	s, err := New(testOptions(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	url := fmt.Sprintf("http://%s", s.Addr())
+	request, _ := http.NewRequest("PUT", url+"/databases?name=db", nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusCreated {
+		t.Errorf("response code is %v, expected %v", response.StatusCode, http.StatusCreated)
+	}
+
+	if _, ok := s.Conn.Pila.ResolveDatabase("db"); !ok {
+		t.Error("database db was not created")
+	}
+
+	if err := s.Shutdown(); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+	if _, err := http.Get(url + "/_status"); err == nil {
+		t.Error("server is still serving")
+	}
+}
+
+func TestServer_ShutdownHandler(t *testing.T) {
+	defer NewConn().setLogLevel()
+
+	opts := testOptions(t)
+	opts.AutoPersistPath = filepath.Join(os.TempDir(), fmt.Sprintf("pilad-server-%d", os.Getpid()))
+	defer os.Remove(opts.AutoPersistPath)
+
+	s, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	s.Conn.Pila.AddDatabase(pila.NewDatabase("db"))
+
+	response, err := http.Post(fmt.Sprintf("http://%s/_shutdown", s.Addr()), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if err := s.Wait(); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+	// the Pila is saved on shutdown
+	if _, err := os.Stat(opts.AutoPersistPath); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServer_StartError(t *testing.T) {
+	defer NewConn().setLogLevel()
+
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	free, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	free.Close()
+
+	opts := testOptions(t)
+	opts.RESPPort = free.Addr().(*net.TCPAddr).Port
+	opts.RPCPort = busy.Addr().(*net.TCPAddr).Port
+	s, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err == nil {
+		t.Fatal("err is nil, expected an error")
+	}
+
+	// the listeners of the Server and the RESP port are closed
+	if _, err := opts.Listener.Accept(); err == nil {
+		t.Error("listener is not closed")
+	}
+	ln, err := net.Listen("tcp", free.Addr().String())
+	if err != nil {
+		t.Fatalf("RESP port is not closed: %v", err)
+	}
+	ln.Close()
+}
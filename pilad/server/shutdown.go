@@ -0,0 +1,168 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// shutdownTimeoutDefault is the default number of seconds
+// that in-flight requests are drained for on shutdown.
+const shutdownTimeoutDefault = 30
+
+// Shutdown coordinates the graceful shutdown of pilad: once it is
+// requested, new requests are rejected and in-flight ones are
+// drained before exiting.
+type Shutdown struct {
+	requested chan struct{}
+	once      sync.Once
+
+	// inflight is the number of requests being served
+	inflight int
+	draining bool
+	// idle is closed once draining and no request is in flight
+	idle chan struct{}
+	// mu protects the access to inflight, draining and idle
+	mu sync.Mutex
+}
+
+// NewShutdown returns a Shutdown that has not been requested.
+func NewShutdown() *Shutdown {
+	return &Shutdown{
+		requested: make(chan struct{}),
+		idle:      make(chan struct{}),
+	}
+}
+
+// Request requests the shutdown of pilad. It is safe to
+// call it several times.
+func (s *Shutdown) Request() {
+	s.once.Do(func() {
+		close(s.requested)
+	})
+}
+
+// Requested returns a channel that is closed
+// once the shutdown is requested.
+func (s *Shutdown) Requested() <-chan struct{} {
+	return s.requested
+}
+
+// IsRequested returns true if the shutdown was requested.
+func (s *Shutdown) IsRequested() bool {
+	select {
+	case <-s.requested:
+		return true
+	default:
+		return false
+	}
+}
+
+// begin registers an in-flight request, and returns
+// false if requests are being drained.
+func (s *Shutdown) begin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.draining {
+		return false
+	}
+	s.inflight++
+	return true
+}
+
+// end unregisters an in-flight request.
+func (s *Shutdown) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inflight--
+	if s.draining && s.inflight == 0 {
+		close(s.idle)
+	}
+}
+
+// Drain stops accepting requests and waits for the in-flight ones
+// to finish for up to timeout. It returns false if they did not
+// finish in time.
+func (s *Shutdown) Drain(timeout time.Duration) bool {
+	s.mu.Lock()
+	if !s.draining {
+		s.draining = true
+		if s.inflight == 0 {
+			close(s.idle)
+		}
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.idle:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// ShutdownMiddleware returns a middleware that keeps track of the
+// in-flight requests, so they can be drained on shutdown. Requests
+// received while draining are answered with 503 Service Unavailable,
+// except the liveness and readiness probes.
+func ShutdownMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isProbe(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !conn.Shutdown.begin() {
+				logResponse(r, http.StatusServiceUnavailable, "reason", "shutting down")
+				w.Header().Set("Connection", "close")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			defer conn.Shutdown.end()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// shutdownHandler requests the graceful shutdown of pilad,
+// and returns 202 Accepted.
+func (c *Conn) shutdownHandler(w http.ResponseWriter, r *http.Request) {
+	c.Shutdown.Request()
+
+	logResponse(r, http.StatusAccepted)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// close drains the in-flight requests for up to timeout, and
+// flushes the Pila to the persistence file given by path, if
+// any, to the persistence Log and to a last snapshot, if enabled.
+func (c *Conn) close(timeout time.Duration, path string) {
+	if !c.Shutdown.Drain(timeout) {
+		logger.Warn("shutdown timeout reached with requests in flight", "timeout", timeout)
+	}
+
+	c.Raft.Stop()
+	if path != "" {
+		if err := c.Pila.Save(path); err != nil {
+			logger.Error("error on saving pila", "path", path, "error", err)
+		}
+	}
+	if c.Log != nil {
+		if err := c.Log.Close(); err != nil {
+			logger.Error("error on closing persistence log", "error", err)
+		}
+	}
+	if err := c.Audit.Close(); err != nil {
+		logger.Error("error on closing audit file", "error", err)
+	}
+	if c.Snapshots.Enabled() {
+		if _, err := c.Snapshots.Take(c.Pila, time.Now()); err != nil {
+			logger.Error("error on taking snapshot", "error", err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestShutdownRequest(t *testing.T) {
+	s := NewShutdown()
+	if s.IsRequested() {
+		t.Error("s.IsRequested() is true, expected false")
+	}
+
+	s.Request()
+	s.Request()
+	if !s.IsRequested() {
+		t.Error("s.IsRequested() is false, expected true")
+	}
+	select {
+	case <-s.Requested():
+	default:
+		t.Error("s.Requested() is not closed")
+	}
+}
+
+func TestShutdownDrain(t *testing.T) {
+	s := NewShutdown()
+	if !s.begin() {
+		t.Fatal("s.begin() is false, expected true")
+	}
+
+	if s.Drain(10 * time.Millisecond) {
+		t.Error("s.Drain() is true, expected false")
+	}
+	if s.begin() {
+		t.Error("s.begin() is true while draining, expected false")
+	}
+
+	go s.end()
+	if !s.Drain(time.Second) {
+		t.Error("s.Drain() is false, expected true")
+	}
+}
+
+func TestShutdownDrain_Idle(t *testing.T) {
+	s := NewShutdown()
+	s.begin()
+	s.end()
+
+	if !s.Drain(time.Second) {
+		t.Error("s.Drain() is false, expected true")
+	}
+}
+
+func TestShutdownMiddleware(t *testing.T) {
+	conn := NewConn()
+	handler := ShutdownMiddleware(conn)(Router(conn))
+
+	request, _ := http.NewRequest("GET", "/_status", nil)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+
+	if !conn.Shutdown.Drain(time.Second) {
+		t.Fatal("conn.Shutdown.Drain() is false, expected true")
+	}
+
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusServiceUnavailable)
+	}
+	if c := response.Header().Get("Connection"); c != "close" {
+		t.Errorf("Connection header is %s, expected %s", c, "close")
+	}
+
+	request, _ = http.NewRequest("GET", "/_health", nil)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+}
+
+func TestShutdownHandler(t *testing.T) {
+	conn := NewConn()
+	_ = conn.Auth.Add(Token{Token: "admin", Role: RoleAdmin})
+	_ = conn.Auth.Add(Token{Token: "writer", Role: RoleReadWrite})
+	handler := AuthMiddleware(conn)(Router(conn))
+
+	inputOutput := []struct {
+		token     string
+		code      int
+		requested bool
+	}{
+		{"", http.StatusUnauthorized, false},
+		{"writer", http.StatusForbidden, false},
+		{"admin", http.StatusAccepted, true},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest("POST", "/_shutdown", nil)
+		if io.token != "" {
+			request.Header.Set("Authorization", "Bearer "+io.token)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for token %s", response.Code, io.code, io.token)
+		}
+		if conn.Shutdown.IsRequested() != io.requested {
+			t.Errorf("shutdown requested is %v, expected %v for token %s", conn.Shutdown.IsRequested(), io.requested, io.token)
+		}
+	}
+}
+
+func TestConnClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-shutdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conn := NewConn()
+	if err := conn.openLog(dir); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Pila.AddDatabase(pila.NewDatabase("db"))
+	path := filepath.Join(dir, "pila.json")
+
+	conn.close(time.Second, path)
+
+	loaded := pila.NewPila()
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.DatabaseByName("db"); !ok {
+		t.Error("database db not found in saved pila")
+	}
+	if err := conn.Log.Close(); err == nil {
+		t.Error("err is nil, expected log to be already closed")
+	}
+}
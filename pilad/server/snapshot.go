@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// snapshotHandler writes a snapshot of the whole Pila, including
+// the elements of every Stack, into the response.
+func (c *Conn) snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := c.Pila.SnapshotCtx(r.Context(), &buf); isContextError(err) {
+		c.canceledHandler(w, r, err)
+		return
+	} else if err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on snapshot serialization", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// restoreHandler replaces the content of the Pila with the snapshot
+// given in the request body, and returns the status of the Pila. The
+// restored Pila is persisted, so the Records appended before are not
+// replayed on its content. If the dry_run parameter is true, the
+// snapshot is only validated, and it returns what would be replaced.
+func (c *Conn) restoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		logResponse(r, http.StatusBadRequest, "reason", "no snapshot provided")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	dryRun, ok := dryRunParam(w, r)
+	if !ok {
+		return
+	}
+	if dryRun {
+		preview, err := c.Pila.PreviewRestore(r.Context(), r.Body)
+		if isContextError(err) {
+			c.canceledHandler(w, r, err)
+			return
+		} else if err != nil {
+			logResponse(r, http.StatusBadRequest, "reason", "error on restoring snapshot", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writePreview(w, r, preview)
+		return
+	}
+
+	if err := c.Pila.RestoreCtx(r.Context(), r.Body); isContextError(err) {
+		c.canceledHandler(w, r, err)
+		return
+	} else if err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on restoring snapshot", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.persistRestore(requestDate(r))
+	// followers start again from the restored Pila
+	c.Replication.reset()
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(c.Pila.Status().ToJSON())
+}
+
+// persistRestore appends a snapshot of the Pila restored at date t into
+// the persistence Log, if enabled, so it replaces the content resulting
+// from the Records appended before. It must be called holding the
+// Replication writes exclusively, so no operation is persisted
+// between the restore and its snapshot. Errors are logged but not
+// returned.
+func (c *Conn) persistRestore(t time.Time) {
+	if c.Log == nil {
+		return
+	}
+	var snapshot bytes.Buffer
+	err := c.Pila.Snapshot(&snapshot)
+	if err == nil {
+		err = c.Log.Append(persist.Record{Op: persist.OpRestore, Time: t, Snapshot: snapshot.Bytes()})
+	}
+	if err != nil {
+		logger.Error("error on persisting", "op", persist.OpRestore, "error", err)
+	}
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestSnapshotRestoreHandlers(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	stack.Push("foo")
+	stack.Push(42.0)
+	_ = db.AddStack(stack)
+
+	request, err := http.NewRequest("POST", "/_snapshot", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+
+	Router(conn).ServeHTTP(response, request)
+
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
+	}
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+
+	restored := NewConn()
+	restored.Pila.CreateDatabase("old")
+
+	request, err = http.NewRequest("POST", "/_restore", response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response = httptest.NewRecorder()
+
+	Router(restored).ServeHTTP(response, request)
+
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
+	}
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+	if expected := conn.Pila.Status().ToJSON(); !bytes.Equal(response.Body.Bytes(), expected) {
+		t.Errorf("status is %s, expected %s", response.Body.String(), expected)
+	}
+
+	rdb, _ := ResourceDatabase(restored, "db")
+	rstack, ok := ResourceStack(rdb, "stack")
+	if !ok {
+		t.Fatal("stack not restored")
+	}
+	if rstack.Size() != 2 || rstack.Peek() != 42.0 {
+		t.Errorf("stack is not restored with its elements")
+	}
+}
+
+func TestRestoreHandler_Persist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	snapshot := pila.NewPila()
+	db := pila.NewDatabase("db")
+	_ = snapshot.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = stack.Push("foo")
+	_ = db.AddStack(stack)
+	var body bytes.Buffer
+	if err := snapshot.Snapshot(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := NewConn()
+	if err := conn.openLog(dir); err != nil {
+		t.Fatal(err)
+	}
+	handler := Router(conn)
+	for _, path := range []string{"/databases?name=old", "/databases/old/stacks?name=stack"} {
+		request, _ := http.NewRequest("PUT", path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		if response.Code != http.StatusCreated {
+			t.Fatalf("response code is %v, expected %v for %s", response.Code, http.StatusCreated, path)
+		}
+	}
+
+	request, _ := http.NewRequest("POST", "/_restore", &body)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+
+	// the records of the database deleted by the
+	// restore are not replayed on the restored Pila
+	request, _ = http.NewRequest("POST", "/databases/db/stacks/stack", bytes.NewBufferString(`{"element":"bar"}`))
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+	conn.Log.Close()
+
+	restarted := NewConn()
+	if err := restarted.openLog(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Log.Close()
+	if _, ok := restarted.Pila.DatabaseByName("old"); ok {
+		t.Error("database old exists")
+	}
+	rdb, _ := ResourceDatabase(restarted, "db")
+	if rstack, ok := ResourceStack(rdb, "stack"); !ok || rstack.Size() != 2 || rstack.Peek() != "bar" {
+		t.Errorf("stack is not restored with its elements")
+	}
+}
+
+func TestSnapshotHandler_Error(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	stack.Push(make(chan int))
+	_ = db.AddStack(stack)
+
+	request, err := http.NewRequest("POST", "/_snapshot", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+
+	Router(conn).ServeHTTP(response, request)
+
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRestoreHandler_Error(t *testing.T) {
+	conn := NewConn()
+	conn.Pila.CreateDatabase("db")
+
+	inputs := []string{
+		"",
+		"foo",
+		`{"version":0,"databases":[]}`,
+	}
+
+	for _, input := range inputs {
+		request, err := http.NewRequest("POST", "/_restore", bytes.NewBufferString(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("on %s response code is %v, expected %v", input, response.Code, http.StatusBadRequest)
+		}
+		if n := conn.Pila.Status().NumberDatabases; n != 1 {
+			t.Errorf("number of databases is %d, expected %d", n, 1)
+		}
+	}
+}
+
+func TestRestoreHandler_NoBody(t *testing.T) {
+	conn := NewConn()
+
+	request, err := http.NewRequest("POST", "/_restore", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+
+	conn.restoreHandler(response, request)
+
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+const (
+	// snapshotKeepDefault is the default number of
+	// snapshots kept by the Snapshots.
+	snapshotKeepDefault = 5
+
+	// snapshotPrefix and snapshotSuffix surround the
+	// date a snapshot was taken at in its file name.
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".json"
+	// snapshotTimeFormat is the format of the date of a
+	// snapshot in its file name, sorted like the dates.
+	snapshotTimeFormat = "20060102T150405.000000000Z"
+)
+
+// ErrSnapshotsDisabled is returned when taking a snapshot
+// while scheduled snapshots are disabled.
+var ErrSnapshotsDisabled = errors.New("snapshots are disabled, set -snapshot-dir")
+
+// Snapshots takes snapshots of the Pila into files of a directory,
+// keeping only the most recent ones.
+type Snapshots struct {
+	dir  string
+	keep int
+
+	// mu serializes the snapshots and their cleanup
+	mu sync.Mutex
+}
+
+// SnapshotFile represents a snapshot of the Pila stored in a file.
+type SnapshotFile struct {
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+}
+
+// SnapshotsStatus represents the configuration of the Snapshots and
+// the snapshots they keep, the most recent first.
+type SnapshotsStatus struct {
+	Enabled   bool           `json:"enabled"`
+	Dir       string         `json:"dir,omitempty"`
+	Keep      int            `json:"keep,omitempty"`
+	Snapshots []SnapshotFile `json:"snapshots"`
+}
+
+// ToJSON converts a SnapshotsStatus into JSON.
+func (status SnapshotsStatus) ToJSON() []byte {
+	// Do not check error as a SnapshotsStatus
+	// is always valid for a JSON encoding.
+	b, _ := json.Marshal(status)
+	return b
+}
+
+// NewSnapshots returns disabled Snapshots.
+func NewSnapshots() *Snapshots {
+	return &Snapshots{}
+}
+
+// Enable makes the Snapshots store the snapshots in dir, creating it
+// if it does not exist, and keep the keep most recent ones, or
+// snapshotKeepDefault if keep is not positive.
+func (s *Snapshots) Enable(dir string, keep int) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if keep <= 0 {
+		keep = snapshotKeepDefault
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir, s.keep = dir, keep
+	return nil
+}
+
+// Enabled determines whether the Snapshots are enabled.
+func (s *Snapshots) Enabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dir != ""
+}
+
+// Take writes a snapshot of p taken at date t into a new file, and
+// removes the oldest snapshots exceeding the ones to keep.
+func (s *Snapshots) Take(p *pila.Pila, t time.Time) (SnapshotFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dir == "" {
+		return SnapshotFile{}, ErrSnapshotsDisabled
+	}
+
+	name := snapshotPrefix + t.UTC().Format(snapshotTimeFormat) + snapshotSuffix
+	if err := p.Save(filepath.Join(s.dir, name)); err != nil {
+		return SnapshotFile{}, err
+	}
+
+	files, err := s.list()
+	if err != nil {
+		return SnapshotFile{}, err
+	}
+	for i := s.keep; i < len(files); i++ {
+		if err := os.Remove(filepath.Join(s.dir, files[i].Name)); err != nil {
+			return SnapshotFile{}, err
+		}
+	}
+	for _, f := range files {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return SnapshotFile{Name: name, Time: t.UTC()}, nil
+}
+
+// Status returns the SnapshotsStatus of the Snapshots.
+func (s *Snapshots) Status() (SnapshotsStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := SnapshotsStatus{Snapshots: []SnapshotFile{}}
+	if s.dir == "" {
+		return status, nil
+	}
+	status.Enabled, status.Dir, status.Keep = true, s.dir, s.keep
+
+	var err error
+	status.Snapshots, err = s.list()
+	return status, err
+}
+
+// LoadLatest replaces the content of p with the most recent snapshot,
+// and returns it. It returns false if there is none.
+func (s *Snapshots) LoadLatest(p *pila.Pila) (SnapshotFile, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dir == "" {
+		return SnapshotFile{}, false, ErrSnapshotsDisabled
+	}
+
+	files, err := s.list()
+	if err != nil || len(files) == 0 {
+		return SnapshotFile{}, false, err
+	}
+	return files[0], true, p.Load(filepath.Join(s.dir, files[0].Name))
+}
+
+// list returns the snapshots in the directory of
+// the Snapshots, the most recent first.
+func (s *Snapshots) list() ([]SnapshotFile, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []SnapshotFile{}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		t, err := time.Parse(snapshotTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix))
+		if err != nil {
+			continue
+		}
+		files = append(files, SnapshotFile{Name: name, Time: t, Size: info.Size()})
+	}
+	sort.Sort(sort.Reverse(snapshotsByTime(files)))
+	return files, nil
+}
+
+// snapshotsByTime sorts SnapshotFiles by date.
+type snapshotsByTime []SnapshotFile
+
+func (s snapshotsByTime) Len() int           { return len(s) }
+func (s snapshotsByTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s snapshotsByTime) Less(i, j int) bool { return s[i].Time.Before(s[j].Time) }
+
+// SnapshotScheduler takes a snapshot of the Pila every interval until
+// stop is closed. It is meant to be run as a goroutine.
+func (c *Conn) SnapshotScheduler(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case t := <-ticker.C:
+			if f, err := c.Snapshots.Take(c.Pila, t); err != nil {
+				logger.Error("error on taking snapshot", "error", err)
+			} else {
+				logger.Info("took snapshot", "name", f.Name, "size", f.Size)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// snapshotsHandler returns 200 and the snapshots kept in the snapshot
+// directory on GET, and takes a new one on POST, returning 201 and
+// the new snapshot. Returns 409 on POST if snapshots are disabled.
+func (c *Conn) snapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		f, err := c.Snapshots.Take(c.Pila, time.Now())
+		if err == ErrSnapshotsDisabled {
+			logResponse(r, http.StatusConflict, "error", err)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if err != nil {
+			logResponse(r, http.StatusInternalServerError, "reason", "error on taking snapshot", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// Do not check error as a SnapshotFile
+		// is always valid for a JSON encoding.
+		b, _ := json.Marshal(f)
+		logResponse(r, http.StatusCreated, "snapshot", f.Name)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(b)
+		return
+	}
+
+	status, err := c.Snapshots.Status()
+	if err != nil {
+		logResponse(r, http.StatusInternalServerError, "reason", "error on listing snapshots", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	logResponse(r, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(status.ToJSON())
+}
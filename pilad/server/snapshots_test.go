@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestSnapshots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := pila.NewPila()
+	s := NewSnapshots()
+	if _, err := s.Take(p, time.Now()); err != ErrSnapshotsDisabled {
+		t.Errorf("err is %v, expected %v", err, ErrSnapshotsDisabled)
+	}
+	if err := s.Enable(filepath.Join(dir, "snapshots"), 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.LoadLatest(p); ok || err != nil {
+		t.Errorf("latest snapshot is %v, %v, expected none", ok, err)
+	}
+	// other files are ignored
+	if err := ioutil.WriteFile(filepath.Join(dir, "snapshots", "notes.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2016, 12, 20, 10, 0, 0, 0, time.UTC)
+	for i, name := range []string{"a", "b", "c"} {
+		p.CreateDatabase(name)
+		f, err := s.Take(p, start.Add(time.Duration(i)*time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !f.Time.Equal(start.Add(time.Duration(i)*time.Minute)) || f.Size == 0 {
+			t.Errorf("snapshot is %+v", f)
+		}
+	}
+
+	status, err := s.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedNames := []string{"snapshot-20161220T100200.000000000Z.json", "snapshot-20161220T100100.000000000Z.json"}
+	if !status.Enabled || status.Keep != 2 || len(status.Snapshots) != len(expectedNames) {
+		t.Fatalf("snapshots status is %+v", status)
+	}
+	for i, name := range expectedNames {
+		if status.Snapshots[i].Name != name {
+			t.Errorf("snapshot is %s, expected %s", status.Snapshots[i].Name, name)
+		}
+	}
+
+	loaded := pila.NewPila()
+	f, ok, err := s.LoadLatest(loaded)
+	if err != nil || !ok || f.Name != expectedNames[0] {
+		t.Fatalf("latest snapshot is %+v, %v, %v", f, ok, err)
+	}
+	if len(loaded.Databases) != 3 {
+		t.Errorf("loaded databases are %d, expected %d", len(loaded.Databases), 3)
+	}
+}
+
+func TestSnapshotScheduler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conn := NewConn()
+	if err := conn.Snapshots.Enable(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	go conn.SnapshotScheduler(10*time.Millisecond, stop)
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+
+	status, _ := conn.Snapshots.Status()
+	if status.Keep != snapshotKeepDefault || len(status.Snapshots) == 0 || len(status.Snapshots) > snapshotKeepDefault {
+		t.Errorf("snapshots status is %+v", status)
+	}
+}
+
+func TestSnapshotsHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conn := NewConn()
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method string
+		code   int
+	}{
+		{"GET", http.StatusOK},
+		{"POST", http.StatusConflict},
+	}
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, "/_snapshots", nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, io.method)
+		}
+	}
+
+	if err := conn.Snapshots.Enable(dir, 3); err != nil {
+		t.Fatal(err)
+	}
+	request, _ := http.NewRequest("POST", "/_snapshots", nil)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	var f SnapshotFile
+	if err := json.Unmarshal(response.Body.Bytes(), &f); err != nil || response.Code != http.StatusCreated {
+		t.Fatalf("response is %v %s", response.Code, response.Body.String())
+	}
+
+	request, _ = http.NewRequest("GET", "/_snapshots", nil)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	var status SnapshotsStatus
+	if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil || response.Code != http.StatusOK {
+		t.Fatalf("response is %v %s", response.Code, response.Body.String())
+	}
+	if !status.Enabled || status.Dir != dir || len(status.Snapshots) != 1 || status.Snapshots[0].Name != f.Name {
+		t.Errorf("snapshots status is %s", response.Body.String())
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+)
+
+// reverseStackHandler reverses the order of the elements of the
+// Stack, returns 200 and its status, along with its new version.
+// Returns 400 if its type does not support the operation, and 412
+// if the If-Match header does not match its ETag.
+func (c *Conn) reverseStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	now := requestDate(r)
+	if !checkIfMatch(w, r, stack) {
+		return
+	}
+	defer c.stackLocks.lock(stack)()
+	if err := stack.Reverse(); err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	stack.Update(now)
+	c.persistStack(r.Context(), stack, persist.Record{Op: persist.OpReverse, Time: now})
+
+	c.writeReorderedStack(w, r, stack)
+}
+
+// sortStackHandler sorts the elements of the Stack by the by field of
+// the JSON objects, or by the elements themselves if not given, in the
+// order given by the order parameter, asc by default, returns 200 and
+// the status of the Stack, along with its new version. Returns 400 and
+// the reason if the elements can not be sorted, e.g. if any of them is
+// not JSON, and 412 if the If-Match header does not match its ETag.
+func (c *Conn) sortStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	now := requestDate(r)
+	if !checkIfMatch(w, r, stack) {
+		return
+	}
+	by, order := r.FormValue("by"), pila.SortOrder(r.FormValue("order"))
+	if order == "" {
+		order = pila.SortAscending
+	}
+	defer c.stackLocks.lock(stack)()
+	if err := stack.Sort(by, order); err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		if err == pila.ErrUnsupported {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stack.Update(now)
+	c.persistStack(r.Context(), stack, persist.Record{Op: persist.OpSort, Time: now, By: by, Order: order})
+
+	c.writeReorderedStack(w, r, stack)
+}
+
+// writeReorderedStack writes the status of a reordered Stack.
+func (c *Conn) writeReorderedStack(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	status := stack.Status()
+	logResponse(r, http.StatusOK, "version", status.Version)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", stackETag(status.Version))
+
+	// Do not check error as we consider our elements
+	// suitable for a JSON encoding.
+	b, _ := status.ToJSON()
+	w.Write(b)
+}
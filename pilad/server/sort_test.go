@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestReorderStackHandlers(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = stack.PushN([]interface{}{
+		map[string]interface{}{"n": 2.0},
+		map[string]interface{}{"n": 3.0},
+		map[string]interface{}{"n": 1.0},
+	})
+	_ = db.AddStack(stack)
+	mixed := pila.NewStack("mixed", time.Now().UTC())
+	_ = mixed.PushN([]interface{}{map[string]interface{}{"n": 2.0}, pila.Binary{ContentType: "text/plain", Data: []byte("foo")}})
+	_ = db.AddStack(mixed)
+	_ = db.AddStack(pila.NewPriority("priority", time.Now().UTC()))
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path string
+		code         int
+		body         string
+		elements     []interface{}
+	}{
+		{"POST", "/databases/db/stacks/stack/_sort?by=n", http.StatusOK, "", []interface{}{1.0, 2.0, 3.0}},
+		{"POST", "/databases/db/stacks/stack/_sort?by=n&order=desc", http.StatusOK, "", []interface{}{3.0, 2.0, 1.0}},
+		{"POST", "/databases/db/stacks/stack/_reverse", http.StatusOK, "", []interface{}{1.0, 2.0, 3.0}},
+		{"POST", "/databases/db/stacks/stack/_sort?by=n&order=up", http.StatusBadRequest, "invalid sort order \"up\", expected asc or desc\n", nil},
+		{"POST", "/databases/db/stacks/stack/_sort?by=m", http.StatusBadRequest, "element 0 has no field m\n", nil},
+		{"POST", "/databases/db/stacks/mixed/_sort?by=n", http.StatusBadRequest, "element 0 is binary, not JSON\n", nil},
+		{"POST", "/databases/db/stacks/mixed/_reverse", http.StatusOK, "", nil},
+		{"POST", "/databases/db/stacks/priority/_reverse", http.StatusBadRequest, "", nil},
+		{"POST", "/databases/db/stacks/priority/_sort", http.StatusBadRequest, "", nil},
+		{"POST", "/databases/db/stacks/foo/_reverse", http.StatusGone, "", nil},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if response.Code != http.StatusOK {
+			if body := response.Body.String(); body != io.body {
+				t.Errorf("body is %q, expected %q for %s %s", body, io.body, io.method, io.path)
+			}
+			continue
+		}
+
+		var status pila.StackStatus
+		if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+		if etag := response.Header().Get("ETag"); etag != stackETag(status.Version) {
+			t.Errorf("ETag is %s, expected %s", etag, stackETag(status.Version))
+		}
+		if io.elements == nil {
+			continue
+		}
+		if status.Version != stack.Version() {
+			t.Errorf("version is %d, expected %d", status.Version, stack.Version())
+		}
+		var elements []interface{}
+		for _, element := range stack.Elements(0, 10) {
+			elements = append(elements, element.(map[string]interface{})["n"])
+		}
+		if !reflect.DeepEqual(elements, io.elements) {
+			t.Errorf("elements are %v, expected %v for %s %s", elements, io.elements, io.method, io.path)
+		}
+	}
+}
+
+func TestReorderStackHandlers_IfMatch(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = stack.PushN([]interface{}{1.0, 2.0})
+	_ = db.AddStack(stack)
+	handler := Router(conn)
+
+	for _, path := range []string{"/databases/db/stacks/stack/_reverse", "/databases/db/stacks/stack/_sort"} {
+		request, err := http.NewRequest("POST", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("If-Match", `"0"`)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != http.StatusPreconditionFailed {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, http.StatusPreconditionFailed, path)
+		}
+	}
+	if stack.Peek() != 2.0 {
+		t.Errorf("stack.Peek() is %v, expected %v", stack.Peek(), 2.0)
+	}
+}
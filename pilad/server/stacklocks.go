@@ -0,0 +1,78 @@
+package server
+
+import (
+	"hash/crc32"
+	"sort"
+	"sync"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// stackLockStripes is the number of mutexes the Stacks are spread over.
+const stackLockStripes = 64
+
+// stackLocks serialize the operations modifying the same Stacks, from
+// the moment they are applied until they are persisted, so the Records
+// are appended into the Log in the same order the operations were
+// applied. Stacks are spread by ID over a fixed number of mutexes, so
+// unrelated Stacks may share one.
+type stackLocks struct {
+	stripes [stackLockStripes]sync.Mutex
+}
+
+// lock locks the operations on the given Stacks, ignoring nil ones,
+// and returns the function unlocking them. Mutexes are always locked
+// in the same order, so operations on several Stacks do not deadlock.
+func (l *stackLocks) lock(stacks ...*pila.Stack) (unlock func()) {
+	indexes := make([]int, 0, len(stacks))
+	seen := make(map[int]bool, len(stacks))
+	for _, s := range stacks {
+		if s == nil {
+			continue
+		}
+		i := int(crc32.ChecksumIEEE([]byte(s.ID.String())) % stackLockStripes)
+		if !seen[i] {
+			seen[i] = true
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+	return l.lockStripes(indexes)
+}
+
+// lockAll locks the operations on every Stack, for the ones modifying
+// whole Databases, and returns the function unlocking them.
+func (l *stackLocks) lockAll() (unlock func()) {
+	indexes := make([]int, stackLockStripes)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return l.lockStripes(indexes)
+}
+
+// lockStripes locks the mutexes given by their sorted indexes, and
+// returns the function unlocking them.
+func (l *stackLocks) lockStripes(indexes []int) func() {
+	for _, i := range indexes {
+		l.stripes[i].Lock()
+	}
+	return func() {
+		for j := len(indexes) - 1; j >= 0; j-- {
+			l.stripes[indexes[j]].Unlock()
+		}
+	}
+}
+
+// stacks returns every Stack of the Pila, so they can be locked
+// without holding the locks of the Databases iterating them.
+func (c *Conn) stacks() []*pila.Stack {
+	var stacks []*pila.Stack
+	c.Pila.ForEachDatabase(func(db *pila.Database) bool {
+		db.ForEachStack(func(s *pila.Stack) bool {
+			stacks = append(stacks, s)
+			return true
+		})
+		return true
+	})
+	return stacks
+}
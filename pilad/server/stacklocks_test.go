@@ -0,0 +1,124 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestStackLocks(t *testing.T) {
+	var l stackLocks
+	stack := pila.NewStack("stack", time.Now().UTC())
+	other := pila.NewStack("other", time.Now().UTC())
+
+	unlock := l.lock(stack, nil, stack)
+	locked := make(chan struct{})
+	go func() {
+		defer l.lock(other, stack)()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("stack is locked twice")
+	case <-time.After(10 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+
+	l.lockAll()()
+}
+
+func TestConnPersist_Order(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conn := NewConn()
+	if err := conn.openLog(dir); err != nil {
+		t.Fatal(err)
+	}
+	stack := pushPopConcurrently(t, conn)
+	conn.Log.Close()
+
+	restarted := NewConn()
+	if err := restarted.openLog(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Log.Close()
+	db, _ := ResourceDatabase(restarted, "db")
+	replayed, ok := ResourceStack(db, "stack")
+	if !ok {
+		t.Fatal("stack is not replayed")
+	}
+	compareStacks(t, replayed, stack)
+}
+
+// pushPopConcurrently creates the "stack" Stack of the "db" Database
+// of conn, pushes and pops elements into it concurrently, and returns
+// it. Pushes are delayed after they are applied, so concurrent pops
+// would be persisted before them if they were not locked.
+func pushPopConcurrently(t *testing.T, conn *Conn) *pila.Stack {
+	handler := Router(conn)
+	for _, path := range []string{"/databases?name=db", "/databases/db/stacks?name=stack"} {
+		request, _ := http.NewRequest("PUT", path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		if response.Code != http.StatusCreated {
+			t.Fatalf("response code is %v, expected %v for %s", response.Code, http.StatusCreated, path)
+		}
+	}
+
+	db, _ := ResourceDatabase(conn, "db")
+	stack, _ := ResourceStack(db, "stack")
+	stack.Subscribe(func(e pila.Event) {
+		if e.Op == pila.EventPush {
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			body := bytes.NewBufferString(fmt.Sprintf(`{"element":%d}`, i))
+			request, _ := http.NewRequest("POST", "/databases/db/stacks/stack", body)
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+		}(i)
+		go func() {
+			defer wg.Done()
+			request, _ := http.NewRequest("DELETE", "/databases/db/stacks/stack", nil)
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+		}()
+	}
+	wg.Wait()
+	return stack
+}
+
+// compareStacks fails if replayed does not have the same
+// elements as stack, in the same order. Both are emptied.
+func compareStacks(t *testing.T, replayed, stack *pila.Stack) {
+	if size, expected := replayed.Size(), stack.Size(); size != expected {
+		t.Fatalf("replayed size is %d, expected %d", size, expected)
+	}
+	for {
+		expected, ok := stack.Pop()
+		if !ok {
+			break
+		}
+		if element, _ := replayed.Pop(); element != expected {
+			t.Fatalf("replayed element is %v, expected %v", element, expected)
+		}
+	}
+}
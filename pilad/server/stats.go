@@ -0,0 +1,16 @@
+package server
+
+import (
+	"net/http"
+)
+
+// databaseStatsHandler returns 200 and the statistics of the Database
+// and of every one of its Stacks, including their rates of operations.
+func (c *Conn) databaseStatsHandler(w http.ResponseWriter, r *http.Request) {
+	db := databaseFromContext(r)
+	stats := db.Stats()
+
+	logResponse(r, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(stats.ToJSON())
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestDatabaseStatsHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	_ = stack.PushN([]interface{}{"foo", "bar"})
+	stack.Pop()
+	handler := Router(conn)
+
+	request, _ := http.NewRequest("GET", "/databases/db/_stats", nil)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+	var stats pila.DatabaseStats
+	if err := json.Unmarshal(response.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.ID != db.ID.String() || stats.NumberStacks != 1 || stats.Size != 1 || stats.Pushes != 2 || stats.Pops != 1 {
+		t.Errorf("stats are %+v", stats)
+	}
+	if len(stats.Stacks) != 1 || stats.Stacks[0].Name != "stack" || stats.Stacks[0].PushRate != 2/pila.RateWindow.Seconds() {
+		t.Errorf("stacks stats are %+v", stats.Stacks)
+	}
+
+	request, _ = http.NewRequest("GET", "/databases/foo/_stats", nil)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusGone {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusGone)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package server
 
 import (
 	"encoding/json"
@@ -6,6 +6,8 @@ import (
 	"os"
 	"runtime"
 	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
 )
 
 // Status represents the status of the running piladb
@@ -19,6 +21,11 @@ type Status struct {
 	RunningFor       float64   `json:"running_for"`
 	NumberGoroutines int       `json:"number_goroutines"`
 	MemoryAlloc      string    `json:"memory_alloc"`
+	// Stats are the aggregated statistics of the Stacks
+	Stats *pila.Stats `json:"stats,omitempty"`
+	// Latencies are the percentiles of the latency
+	// of the push, pop and peek operations
+	Latencies map[string]pila.Percentiles `json:"latencies,omitempty"`
 }
 
 // NewStatus returns a new piladb status.
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// statusStreamThrottle is the minimum time between two Status
+// documents sent by a stream, so busy Stacks do not flood it.
+const statusStreamThrottle = 250 * time.Millisecond
+
+// currentStatus returns the Status of pilad, along with
+// the statistics of the Stacks visible to the request.
+func (c *Conn) currentStatus(r *http.Request) *Status {
+	status := *c.Status
+	status.Update(time.Now().UTC(), MemStats())
+	stats := c.Pila.FilteredStats(tenantFilter(r))
+	status.Stats = &stats
+	status.Latencies = c.OpLatencies.Percentiles()
+	return &status
+}
+
+// statusStreamHandler streams the Status of pilad as Server-Sent Events:
+// it is sent on connection, and again whenever the Pila changes, and every
+// interval if the parameter is given, until the client closes the
+// connection or pilad shuts down. The connection is taken over from the
+// server, so the stream is not interrupted by its write timeout.
+func (c *Conn) statusStreamHandler(w http.ResponseWriter, r *http.Request) {
+	var interval time.Duration
+	if value := r.FormValue("interval"); value != "" {
+		var err error
+		if interval, err = time.ParseDuration(value); err != nil || interval <= 0 {
+			logResponse(r, http.StatusBadRequest, "reason", "interval must be a positive duration", "value", value)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		logResponse(r, http.StatusInternalServerError, "reason", "response does not support hijacking")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// watch before sending the first Status, so no change is missed
+	changed, stop := c.Pila.Changed()
+	defer stop()
+
+	header := w.Header()
+	netConn, bw, err := hj.Hijack()
+	if err != nil {
+		logResponse(r, http.StatusInternalServerError, "reason", "error on hijacking", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer netConn.Close()
+	_ = netConn.SetDeadline(time.Time{})
+	logResponse(r, http.StatusOK)
+
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "close")
+	fmt.Fprint(bw, "HTTP/1.1 200 OK\r\n")
+	header.Write(bw)
+	fmt.Fprint(bw, "\r\n")
+
+	// anything sent by the client is discarded,
+	// reading it only detects the closed connection
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		_, _ = io.Copy(ioutil.Discard, bw)
+	}()
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		fmt.Fprintf(bw, "event: status\ndata: %s\n\n", c.currentStatus(r).ToJSON())
+		if err := bw.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-time.After(statusStreamThrottle):
+		case <-closed:
+			logger.Info("stream closed", "method", r.Method, "url", r.URL.String())
+			return
+		case <-c.Shutdown.Requested():
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-tick:
+		case <-closed:
+			logger.Info("stream closed", "method", r.Method, "url", r.URL.String())
+			return
+		case <-c.Shutdown.Requested():
+			return
+		}
+	}
+}
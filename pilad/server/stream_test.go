@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readStatusEvent reads the next status event from a stream.
+func readStatusEvent(t *testing.T, r *bufio.Reader) Status {
+	var status Status
+	var event string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if event != "status" {
+				t.Fatalf("event is %q, expected status", event)
+			}
+			return status
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &status); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestStatusStreamHandler(t *testing.T) {
+	conn := NewConn()
+	server := httptest.NewServer(Router(conn))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/_status/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status code is %d, expected %d", resp.StatusCode, http.StatusOK)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("content type is %q, expected text/event-stream", ct)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	if status := readStatusEvent(t, r); status.Stats == nil || status.Stats.NumberDatabases != 0 {
+		t.Errorf("stats are %v, expected no databases", status.Stats)
+	}
+
+	conn.Pila.CreateDatabase("db")
+	if status := readStatusEvent(t, r); status.Stats == nil || status.Stats.NumberDatabases != 1 {
+		t.Errorf("stats are %v, expected 1 database", status.Stats)
+	}
+}
+
+func TestStatusStreamHandler_Interval(t *testing.T) {
+	conn := NewConn()
+	server := httptest.NewServer(Router(conn))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/_status/stream?interval=10ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	r := bufio.NewReader(resp.Body)
+	first := readStatusEvent(t, r)
+	second := readStatusEvent(t, r)
+	if second.RunningFor <= first.RunningFor {
+		t.Errorf("second status running for %v, expected more than %v", second.RunningFor, first.RunningFor)
+	}
+}
+
+func TestStatusStreamHandler_Shutdown(t *testing.T) {
+	conn := NewConn()
+	server := httptest.NewServer(Router(conn))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/_status/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	r := bufio.NewReader(resp.Body)
+	readStatusEvent(t, r)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, err := r.ReadString('\n'); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn.Shutdown.Request()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Error("stream not closed on shutdown")
+	}
+}
+
+func TestStatusStreamHandler_BadRequest(t *testing.T) {
+	conn := NewConn()
+	for _, interval := range []string{"foo", "0s", "-1s"} {
+		request, _ := http.NewRequest("GET", "/_status/stream?interval="+interval, nil)
+		response := httptest.NewRecorder()
+
+		Router(conn).ServeHTTP(response, request)
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("interval %s: status code is %d, expected %d", interval, response.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+	"github.com/fern4lvarez/piladb/pkg/websocket"
+)
+
+// subscriptionBuffer is the number of events of a stack buffered
+// for a subscriber. Events are dropped while the buffer of a slow
+// subscriber is full, so producers are never blocked.
+const subscriptionBuffer = 64
+
+// subscribeStackHandler upgrades the request to a WebSocket connection
+// and streams the PUSH, POP and FLUSH events of the Stack as JSON text
+// messages, until the client closes the connection or the subscription
+// is cancelled as an operation in flight.
+func (c *Conn) subscribeStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	ctx, done := c.Operations.Start(r, "subscribe", databaseFromContext(r), stack)
+	defer done()
+
+	// subscribe before the handshake, so no event is missed
+	// once the client receives the upgraded connection
+	events := make(chan pila.Event, subscriptionBuffer)
+	unsubscribe := stack.Subscribe(func(e pila.Event) {
+		select {
+		case events <- e:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	ws, err := websocket.Upgrade(w, r)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on websocket handshake", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer ws.Close()
+	logResponse(r, http.StatusSwitchingProtocols)
+
+	// messages sent by the client are discarded,
+	// reading them only detects the closed connection
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, err := ws.Read(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case e := <-events:
+			b, err := e.ToJSON()
+			if err != nil {
+				logger.Warn("error on event serialization", "method", r.Method, "url", r.URL.String(), "error", err)
+				continue
+			}
+			if err := ws.WriteText(b); err != nil {
+				return
+			}
+		case <-closed:
+			logger.Info("subscription closed", "method", r.Method, "url", r.URL.String())
+			return
+		case <-ctx.Done():
+			logger.Info("subscription cancelled", "method", r.Method, "url", r.URL.String())
+			return
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/websocket"
+)
+
+func TestSubscribeStackHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+
+	server := httptest.NewServer(MetricsMiddleware(conn)(Router(conn)))
+	defer server.Close()
+
+	url := strings.Replace(server.URL, "http", "ws", 1) + "/databases/db/stacks/stack/_subscribe"
+	ws, err := websocket.Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	requests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"POST", "/databases/db/stacks/stack", `{"element":"foo"}`},
+		{"POST", "/databases/db/stacks/stack", `{"element":8}`},
+		{"DELETE", "/databases/db/stacks/stack/pop", ""},
+		{"DELETE", "/databases/db/stacks/stack/flush", ""},
+	}
+	for _, r := range requests {
+		request, err := http.NewRequest(r.method, server.URL+r.path, bytes.NewBufferString(r.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+	}
+
+	expected := []string{
+		`{"op":"push","element":"foo"}`,
+		`{"op":"push","element":8}`,
+		`{"op":"pop","element":8}`,
+		`{"op":"flush"}`,
+	}
+	for _, e := range expected {
+		message, err := ws.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(message) != e {
+			t.Errorf("event is %s, expected %s", message, e)
+		}
+	}
+}
+
+func TestSubscribeStackHandler_BadHandshake(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	_ = db.AddStack(pila.NewStack("stack", time.Now().UTC()))
+
+	inputOutput := []struct {
+		input  string
+		output int
+	}{
+		{"/databases/db/stacks/stack/_subscribe", http.StatusBadRequest},
+		{"/databases/db/stacks/foo/_subscribe", http.StatusGone},
+		{"/databases/foo/stacks/stack/_subscribe", http.StatusGone},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("GET", io.input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != io.output {
+			t.Errorf("response code is %v, expected %v", response.Code, io.output)
+		}
+	}
+}
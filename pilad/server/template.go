@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config"
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+)
+
+// TemplatesStatus represents the stack templates of STACK_TEMPLATES.
+type TemplatesStatus struct {
+	Templates []TemplateStatus `json:"templates"`
+}
+
+// TemplateStatus represents a stack template and its stacks.
+type TemplateStatus struct {
+	Name   string         `json:"name"`
+	Stacks []PresetStatus `json:"stacks"`
+}
+
+// PresetStatus represents the options of a stack of a template.
+type PresetStatus struct {
+	Name    string              `json:"name"`
+	Type    pila.Structure      `json:"type"`
+	MaxSize int                 `json:"max_size,omitempty"`
+	Policy  pila.OverflowPolicy `json:"overflow_policy,omitempty"`
+	TTL     string              `json:"ttl,omitempty"`
+}
+
+// NewTemplatesStatus returns the status of templates, sorted by name.
+func NewTemplatesStatus(templates map[string]config.StackTemplate) TemplatesStatus {
+	status := TemplatesStatus{Templates: []TemplateStatus{}}
+	for _, template := range templates {
+		t := TemplateStatus{Name: template.Name, Stacks: []PresetStatus{}}
+		for _, preset := range template.Stacks {
+			p := PresetStatus{Name: preset.Name, Type: preset.Type, MaxSize: preset.MaxSize, Policy: preset.Policy}
+			if preset.TTL > 0 {
+				p.TTL = preset.TTL.String()
+			}
+			t.Stacks = append(t.Stacks, p)
+		}
+		status.Templates = append(status.Templates, t)
+	}
+	sort.Sort(status)
+	return status
+}
+
+// Len returns the number of templates.
+func (s TemplatesStatus) Len() int {
+	return len(s.Templates)
+}
+
+// Less determines whether a template is sorted before other by name.
+func (s TemplatesStatus) Less(i, j int) bool {
+	return s.Templates[i].Name < s.Templates[j].Name
+}
+
+// Swap swaps the positions of two templates.
+func (s TemplatesStatus) Swap(i, j int) {
+	s.Templates[i], s.Templates[j] = s.Templates[j], s.Templates[i]
+}
+
+// ToJSON converts a TemplatesStatus into JSON.
+func (s TemplatesStatus) ToJSON() []byte {
+	// Do not check error as the TemplatesStatus does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// templatesHandler returns the stack templates of the Config.
+func (c *Conn) templatesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(NewTemplatesStatus(c.Config.StackTemplates()).ToJSON())
+}
+
+// createTemplateStacks creates at date t the Stacks of a template into
+// a new Database. Stacks of type stack spill like the Database. In cluster
+// mode, where Databases are created on every node, every node only
+// creates the Stacks it owns.
+func (c *Conn) createTemplateStacks(ctx context.Context, db *pila.Database, template config.StackTemplate, t time.Time) error {
+	for _, preset := range template.Stacks {
+		if c.Cluster.Owner(db.Name, preset.Name) != c.Cluster.Self() {
+			continue
+		}
+
+		stack := pila.NewStructureWithLimit(preset.Type, preset.Name, t, preset.MaxSize, preset.Policy)
+		var spill int
+		if spillDir := c.Pila.SpillDir(); spillDir != "" && db.Spill() > 0 && preset.Type == pila.StructureStack {
+			spill = db.Spill()
+			var err error
+			if stack, err = pila.NewSpillStack(preset.Name, t, spillDir, spill); err != nil {
+				return err
+			}
+			stack.MaxSize, stack.Policy = preset.MaxSize, preset.Policy
+		}
+		stack.TTL = preset.TTL
+		if err := db.AddStack(stack); err != nil {
+			return err
+		}
+		stack.Update(t)
+		c.persistStack(ctx, stack, persist.Record{Op: persist.OpCreateStack, Time: t, Type: preset.Type, MaxSize: preset.MaxSize, Policy: preset.Policy, Spill: spill, TTL: preset.TTL, ID: stack.ID.String()})
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+const testStackTemplates = "worker-queues:jobs?type=queue&max_size=2&policy=drop_oldest,failed?ttl=1h;cache:hot"
+
+func TestNewTemplatesStatus(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set(vars.StackTemplates, testStackTemplates)
+
+	expected := TemplatesStatus{Templates: []TemplateStatus{
+		{Name: "cache", Stacks: []PresetStatus{
+			{Name: "hot", Type: pila.StructureStack},
+		}},
+		{Name: "worker-queues", Stacks: []PresetStatus{
+			{Name: "jobs", Type: pila.StructureQueue, MaxSize: 2, Policy: pila.OverflowDropOldest},
+			{Name: "failed", Type: pila.StructureStack, TTL: "1h0m0s"},
+		}},
+	}}
+
+	if status := NewTemplatesStatus(conn.Config.StackTemplates()); !reflect.DeepEqual(status, expected) {
+		t.Errorf("status is %v, expected %v", status, expected)
+	}
+}
+
+func TestTemplatesHandler(t *testing.T) {
+	conn := NewConn()
+
+	inputOutput := []struct {
+		templates string
+		output    string
+	}{
+		{"", `{"templates":[]}`},
+		{"cache:hot?ttl=5m", `{"templates":[{"name":"cache","stacks":[{"name":"hot","type":"stack","ttl":"5m0s"}]}]}`},
+	}
+
+	for _, io := range inputOutput {
+		conn.Config.Set(vars.StackTemplates, io.templates)
+		request, _ := http.NewRequest("GET", "/_templates", nil)
+		response := httptest.NewRecorder()
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != http.StatusOK {
+			t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+		}
+		if body := response.Body.String(); body != io.output {
+			t.Errorf("response body is %s, expected %s", body, io.output)
+		}
+	}
+}
+
+func TestCreateDatabaseHandler_Template(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set(vars.StackTemplates, testStackTemplates)
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		path   string
+		output int
+	}{
+		{"/databases?name=workers&template=worker-queues", http.StatusCreated},
+		{"/databases?name=other&template=unknown", http.StatusBadRequest},
+		{"/databases?name=workers&template=cache", http.StatusConflict},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest("PUT", io.path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.output {
+			t.Errorf("%s: response code is %v, expected %v", io.path, response.Code, io.output)
+		}
+	}
+
+	db, ok := conn.Pila.DatabaseByName("workers")
+	if !ok {
+		t.Fatal("database workers not found")
+	}
+	if db.Status().NumberStacks != 2 {
+		t.Errorf("database has %d stacks, expected %d", db.Status().NumberStacks, 2)
+	}
+	if _, ok := conn.Pila.DatabaseByName("other"); ok {
+		t.Error("database other was created with an unknown template")
+	}
+
+	jobs, _ := db.StackByName("jobs")
+	if jobs.Type != pila.StructureQueue || jobs.MaxSize != 2 || jobs.Policy != pila.OverflowDropOldest {
+		t.Errorf("stack jobs is %s %d %s, expected %s %d %s", jobs.Type, jobs.MaxSize, jobs.Policy, pila.StructureQueue, 2, pila.OverflowDropOldest)
+	}
+	failed, _ := db.StackByName("failed")
+	if failed.TTL != time.Hour {
+		t.Errorf("stack failed ttl is %v, expected %v", failed.TTL, time.Hour)
+	}
+}
+
+func TestPushStackHandler_StackTTL(t *testing.T) {
+	conn := NewConn()
+	now := time.Now()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	handler := Router(conn)
+
+	request, _ := http.NewRequest("PUT", "/databases/db/stacks?name=stack&ttl=1m", nil)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("response code is %v, expected %v", response.Code, http.StatusCreated)
+	}
+	var status pila.StackStatus
+	if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.TTL != "1m0s" {
+		t.Errorf("stack ttl is %s, expected %s", status.TTL, "1m0s")
+	}
+
+	for _, path := range []string{"/databases/db/stacks/stack", "/databases/db/stacks/stack?ttl=1h"} {
+		request, _ = http.NewRequest("POST", path, bytes.NewBufferString(`{"element":"foo"}`))
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	stack, _ := db.StackByName("stack")
+	if removed := stack.Expire(now.Add(2 * time.Minute)); removed != 1 {
+		t.Errorf("expired elements are %d, expected %d", removed, 1)
+	}
+	if removed := stack.Expire(now.Add(2 * time.Hour)); removed != 1 {
+		t.Errorf("expired elements are %d, expected %d", removed, 1)
+	}
+
+	request, _ = http.NewRequest("PUT", "/databases/db/stacks?name=other&ttl=0", nil)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusBadRequest)
+	}
+}
+
+func TestTenantMiddleware_Template(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set(vars.StackTemplates, testStackTemplates)
+	_ = conn.Auth.Add(Token{Token: "acme", Role: RoleReadWrite, Tenant: "acme"})
+	_ = conn.Tenants.Add(Tenant{Name: "acme", MaxStacks: 3})
+	handler := AuthMiddleware(conn)(TenantMiddleware(conn)(Router(conn)))
+
+	inputOutput := []struct {
+		path   string
+		output int
+	}{
+		{"/databases?name=workers&template=worker-queues", http.StatusCreated},
+		{"/databases?name=more&template=worker-queues", http.StatusForbidden},
+		{"/databases?name=cache&template=cache", http.StatusCreated},
+		{"/databases?name=empty", http.StatusCreated},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest("PUT", io.path, nil)
+		request.Header.Set("Authorization", "Bearer acme")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.output {
+			t.Errorf("%s: response code is %v, expected %v", io.path, response.Code, io.output)
+		}
+	}
+}
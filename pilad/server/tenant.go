@@ -0,0 +1,446 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/uuid"
+	"github.com/gorilla/mux"
+)
+
+// tenantSeparator separates the name of a tenant from the names of
+// its Databases, which are namespaced in the Pila as TENANT:DATABASE.
+const tenantSeparator = ":"
+
+// Tenant represents a group of API Tokens sharing their Databases,
+// namespaced apart from the ones of other tenants, and the quotas
+// limiting them. Quotas equal to 0 are unlimited.
+type Tenant struct {
+	Name string `json:"name"`
+	// MaxDatabases is the maximum number of Databases
+	MaxDatabases int `json:"max_databases,omitempty"`
+	// MaxStacks is the maximum number of Stacks,
+	// adding up the ones of every Database
+	MaxStacks int `json:"max_stacks,omitempty"`
+	// MaxMemory is the maximum memory in bytes used
+	// by the elements of every Database
+	MaxMemory int64 `json:"max_memory,omitempty"`
+}
+
+// Validate returns an error if the Tenant is not valid.
+func (t Tenant) Validate() error {
+	if err := validateTenantName(t.Name); err != nil {
+		return err
+	}
+	if t.MaxDatabases < 0 || t.MaxStacks < 0 || t.MaxMemory < 0 {
+		return fmt.Errorf("quotas of tenant %s must be 0 or greater", t.Name)
+	}
+	return nil
+}
+
+// validateTenantName returns an error if name
+// is not valid as the name of a tenant.
+func validateTenantName(name string) error {
+	if name == "" {
+		return fmt.Errorf("missing tenant name")
+	}
+	if strings.ContainsAny(name, tenantSeparator+"/") {
+		return fmt.Errorf("invalid tenant name %q, must not contain %q nor %q", name, tenantSeparator, "/")
+	}
+	return nil
+}
+
+// namespace returns the name in the Pila of the Database name of tenant.
+func namespace(tenant, name string) string {
+	return tenant + tenantSeparator + name
+}
+
+// owns determines whether the Database belongs to tenant.
+func owns(tenant string, db *pila.Database) bool {
+	return strings.HasPrefix(db.Name, tenant+tenantSeparator)
+}
+
+// Tenants contains the quotas of the tenants. Tokens of a tenant
+// that is not registered have their Databases namespaced, with
+// no quotas.
+type Tenants struct {
+	tenants map[string]Tenant
+
+	// mu protects the access to tenants
+	mu sync.RWMutex
+}
+
+// NewTenants returns a new Tenants without tenants.
+func NewTenants() *Tenants {
+	return &Tenants{tenants: make(map[string]Tenant)}
+}
+
+// Add adds a Tenant, replacing the existing one with the same name.
+func (ts *Tenants) Add(t Tenant) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.tenants[t.Name] = t
+	return nil
+}
+
+// Remove removes a Tenant, keeping its Databases.
+// It returns false if the Tenant did not exist.
+func (ts *Tenants) Remove(name string) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if _, ok := ts.tenants[name]; !ok {
+		return false
+	}
+	delete(ts.tenants, name)
+	return true
+}
+
+// Tenant returns the Tenant given by name, with no
+// quotas if it is not registered.
+func (ts *Tenants) Tenant(name string) Tenant {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	if t, ok := ts.tenants[name]; ok {
+		return t
+	}
+	return Tenant{Name: name}
+}
+
+// Tenants returns all the registered Tenants, sorted by name.
+func (ts *Tenants) Tenants() []Tenant {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	names := make([]string, 0, len(ts.tenants))
+	for name := range ts.tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tenants := make([]Tenant, len(names))
+	for i, name := range names {
+		tenants[i] = ts.tenants[name]
+	}
+	return tenants
+}
+
+// tenantFlags implements flag.Value to parse a list of Tenants given
+// as "name[:max_databases[:max_stacks[:max_memory]]]", like
+// -tenant=acme:10:100:1048576 -tenant=initech:1
+type tenantFlags []Tenant
+
+// String returns the names of the Tenants as a comma-separated list.
+func (tf *tenantFlags) String() string {
+	names := make([]string, 0, len(*tf))
+	for _, t := range *tf {
+		names = append(names, t.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// Set parses a Tenant and appends it to the list.
+func (tf *tenantFlags) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) > 4 {
+		return fmt.Errorf("too many quotas in %q", value)
+	}
+
+	t := Tenant{Name: parts[0]}
+	quotas := make([]int64, 3)
+	for i, part := range parts[1:] {
+		if part == "" {
+			continue
+		}
+		quota, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid quota %q in %q", part, value)
+		}
+		quotas[i] = quota
+	}
+	t.MaxDatabases, t.MaxStacks, t.MaxMemory = int(quotas[0]), int(quotas[1]), quotas[2]
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	*tf = append(*tf, t)
+	return nil
+}
+
+// requestTenant returns the tenant attached to the request
+// context by TenantMiddleware, empty if none.
+func requestTenant(r *http.Request) string {
+	tenant, _ := r.Context().Value(tenantKey).(string)
+	return tenant
+}
+
+// tenantFilter returns a function keeping the Databases of the
+// tenant of the request, or nil if it has no tenant.
+func tenantFilter(r *http.Request) func(db *pila.Database) bool {
+	tenant := requestTenant(r)
+	if tenant == "" {
+		return nil
+	}
+	return func(db *pila.Database) bool {
+		return owns(tenant, db)
+	}
+}
+
+// tenantDatabase returns the ID or name in the Pila of the Database
+// given by a request of tenant, either by the ID of a Database of
+// the tenant or by its name within the tenant.
+func (c *Conn) tenantDatabase(tenant, database string) string {
+	if db, ok := c.Pila.Database(uuid.UUID(database)); ok && owns(tenant, db) {
+		return database
+	}
+	return namespace(tenant, database)
+}
+
+// tenantRoutes are the first segments of the paths that
+// requests with a tenant Token are allowed to access.
+var tenantRoutes = map[string]bool{
+	"":              true,
+	"databases":     true,
+	"_status":       true,
+	"_health":       true,
+	"_ready":        true,
+	"_ops":          true,
+	"_changelog":    true,
+	"_features":     true,
+	"_templates":    true,
+	"_openapi.json": true,
+}
+
+// TenantMiddleware returns a middleware that confines the requests
+// with a Token of a tenant to the Databases of the tenant. Database
+// names and IDs of the request are resolved into the namespace of
+// the tenant, the tenant is attached to the request context, so the
+// listings only show its resources, and its quotas are enforced.
+// It responds 403 Forbidden to the requests of other resources and
+// the ones exceeding the quotas of databases and stacks, and
+// 507 Insufficient Storage to pushes exceeding the quota of memory.
+// It must be chained after AuthMiddleware.
+func TenantMiddleware(conn *Conn) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := conn.Auth.Token(requestToken(r))
+			if !conn.Auth.Enabled() || !ok || token.Tenant == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			tenant := conn.Tenants.Tenant(token.Tenant)
+			segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+			if !tenantRoutes[segments[0]] || (segments[0] == "_ops" && len(segments) > 1) {
+				logResponse(r, http.StatusForbidden, "reason", "not allowed to tenant", "tenant", tenant.Name)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			if segments[0] == "databases" {
+				r = conn.tenantRequest(r, tenant.Name, segments)
+				if code, err := conn.exceedsQuota(tenant, r, segments); err != nil {
+					if code == http.StatusInsufficientStorage {
+						conn.memoryLimitHandler(w, r, err)
+						return
+					}
+					logResponse(r, code, "error", err)
+					w.WriteHeader(code)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey, tenant.Name)))
+		})
+	}
+}
+
+// tenantRequest returns a copy of the request of tenant, with the
+// Databases given in its path, name and to_database parameters
+// resolved into the namespace of the tenant, wherever the parameters
+// are given, in the query or in the form-encoded body. The new name
+// of a renamed Database is namespaced by renameDatabaseHandler.
+func (c *Conn) tenantRequest(r *http.Request, tenant string, segments []string) *http.Request {
+	u := *r.URL
+	if len(segments) > 1 {
+		segments[1] = c.tenantDatabase(tenant, segments[1])
+		u.Path = "/" + strings.Join(segments, "/")
+		u.RawPath = ""
+	}
+
+	// the name parameter is the name of the new Database
+	// on creation, Databases are renamed with the body
+	var name string
+	if len(segments) == 1 {
+		name = r.FormValue("name")
+	}
+	database := destinationDatabase(r)
+
+	tr := r.WithContext(r.Context())
+	tr.URL = &u
+	if name != "" {
+		setFormValue(tr, "name", namespace(tenant, name))
+	}
+	if database != "" {
+		setFormValue(tr, "to_database", c.tenantDatabase(tenant, database))
+	}
+	return tr
+}
+
+// setFormValue sets the parameter key of a request, whose form is
+// already parsed, to value wherever it is given, in its query or in
+// its form-encoded body, so its handler reads value with r.FormValue.
+// The form of the request is copied before, as it may be shared.
+func setFormValue(r *http.Request, key, value string) {
+	query := r.URL.Query()
+	if _, ok := query[key]; ok {
+		query.Set(key, value)
+		r.URL.RawQuery = query.Encode()
+	}
+	if _, ok := r.PostForm[key]; ok {
+		r.PostForm = withValue(r.PostForm, key, value)
+	}
+	r.Form = withValue(r.Form, key, value)
+}
+
+// withValue returns a copy of values with key set to value.
+func withValue(values url.Values, key, value string) url.Values {
+	copied := make(url.Values, len(values))
+	for k, v := range values {
+		copied[k] = v
+	}
+	copied.Set(key, value)
+	return copied
+}
+
+// exceedsQuota returns an error and the status code of the response
+// if a request of tenant exceeds any of its quotas. Quotas are checked
+// before the request is served, so the quota of memory can be exceeded
+// by its last push. Stacks of the template of a created Database
+// count towards the quota of stacks.
+func (c *Conn) exceedsQuota(tenant Tenant, r *http.Request, segments []string) (int, error) {
+	method := r.Method
+	switch {
+	case method == "PUT" && len(segments) == 1:
+		usage := c.tenantUsage(tenant.Name)
+		if tenant.MaxDatabases > 0 && usage.NumberDatabases >= tenant.MaxDatabases {
+			return http.StatusForbidden, fmt.Errorf("tenant %s reached its quota of %d databases", tenant.Name, tenant.MaxDatabases)
+		}
+		template := c.Config.StackTemplates()[r.FormValue("template")]
+		if tenant.MaxStacks > 0 && usage.NumberStacks+len(template.Stacks) > tenant.MaxStacks {
+			return http.StatusForbidden, fmt.Errorf("tenant %s would exceed its quota of %d stacks", tenant.Name, tenant.MaxStacks)
+		}
+	case method == "PUT" && len(segments) == 3 && segments[2] == "stacks" && tenant.MaxStacks > 0:
+		if c.tenantUsage(tenant.Name).NumberStacks >= tenant.MaxStacks {
+			return http.StatusForbidden, fmt.Errorf("tenant %s reached its quota of %d stacks", tenant.Name, tenant.MaxStacks)
+		}
+	case isPush(method, segments) && tenant.MaxMemory > 0:
+		if c.tenantUsage(tenant.Name).Memory >= tenant.MaxMemory {
+			return http.StatusInsufficientStorage, fmt.Errorf("tenant %s reached its quota of %d bytes", tenant.Name, tenant.MaxMemory)
+		}
+	}
+	return 0, nil
+}
+
+// isPush determines whether a request with the given method
+// and path segments may push elements into a Stack.
+func isPush(method string, segments []string) bool {
+	switch {
+	case method == "POST" && len(segments) == 3:
+		return segments[2] == "_transaction" || segments[2] == "_popush"
+	case method == "POST" && len(segments) == 4:
+		return segments[2] == "stacks"
+	case len(segments) == 5 && segments[2] == "stacks":
+		switch segments[4] {
+		case "_bulk", "_move", "_copy":
+			return method == "POST"
+		case "_import":
+			return method == "PUT"
+		}
+	}
+	return false
+}
+
+// tenantUsage returns the statistics of the Databases of tenant.
+func (c *Conn) tenantUsage(tenant string) pila.Stats {
+	return c.Pila.FilteredStats(func(db *pila.Database) bool {
+		return owns(tenant, db)
+	})
+}
+
+// tenantsHandler writes the Tenants of the Connection into the
+// response on GET, and adds the Tenant of the request body on POST.
+func (c *Conn) tenantsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		c.addTenantHandler(w, r)
+		return
+	}
+
+	// Do not check error as a list of Tenants
+	// is always valid for a JSON encoding.
+	b, _ := json.Marshal(map[string][]Tenant{"tenants": c.Tenants.Tenants()})
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(b)
+}
+
+// addTenantHandler adds the Tenant of the request body.
+func (c *Conn) addTenantHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		logResponse(r, http.StatusBadRequest, "reason", "no tenant provided")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on reading tenant", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var t Tenant
+	if err := json.Unmarshal(body, &t); err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on decoding tenant", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := c.Tenants.Add(t); err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	b, _ := json.Marshal(t)
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusCreated)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(b)
+}
+
+// tenantHandler removes the Tenant given in the URL.
+func (c *Conn) tenantHandler(w http.ResponseWriter, r *http.Request) {
+	if !c.Tenants.Remove(mux.Vars(r)["tenant"]) {
+		c.goneHandler(w, r, "tenant is Gone")
+		return
+	}
+
+	logResponse(r, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
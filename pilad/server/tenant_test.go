@@ -0,0 +1,258 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestTenant_Validate(t *testing.T) {
+	inputOutput := []struct {
+		input  Tenant
+		output bool
+	}{
+		{Tenant{Name: "acme"}, true},
+		{Tenant{Name: "acme", MaxDatabases: 1, MaxStacks: 2, MaxMemory: 3}, true},
+		{Tenant{}, false},
+		{Tenant{Name: "ac:me"}, false},
+		{Tenant{Name: "ac/me"}, false},
+		{Tenant{Name: "acme", MaxStacks: -1}, false},
+	}
+
+	for _, io := range inputOutput {
+		if err := io.input.Validate(); (err == nil) != io.output {
+			t.Errorf("valid is %v, expected %v for %v", err == nil, io.output, io.input)
+		}
+	}
+}
+
+func TestTenants(t *testing.T) {
+	ts := NewTenants()
+	if err := ts.Add(Tenant{Name: "b", MaxDatabases: 1}); err != nil {
+		t.Fatal(err)
+	}
+	_ = ts.Add(Tenant{Name: "a"})
+	if err := ts.Add(Tenant{}); err == nil {
+		t.Error("err is nil, expected an error")
+	}
+
+	if tenant := ts.Tenant("b"); tenant.MaxDatabases != 1 {
+		t.Errorf("tenant is %v, expected %d max databases", tenant, 1)
+	}
+	if tenant := ts.Tenant("c"); !reflect.DeepEqual(tenant, Tenant{Name: "c"}) {
+		t.Errorf("tenant is %v, expected no quotas", tenant)
+	}
+	if tenants := ts.Tenants(); len(tenants) != 2 || tenants[0].Name != "a" {
+		t.Errorf("tenants are %v, expected a and b", tenants)
+	}
+
+	if !ts.Remove("a") || ts.Remove("a") {
+		t.Error("tenant a was not removed once")
+	}
+}
+
+func TestTenantFlags(t *testing.T) {
+	var tf tenantFlags
+	for _, value := range []string{"acme:10:100:1024", "initech", "globex::5"} {
+		if err := tf.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := tenantFlags{
+		{Name: "acme", MaxDatabases: 10, MaxStacks: 100, MaxMemory: 1024},
+		{Name: "initech"},
+		{Name: "globex", MaxStacks: 5},
+	}
+	if !reflect.DeepEqual(tf, expected) {
+		t.Errorf("tenants are %v, expected %v", tf, expected)
+	}
+	if s := tf.String(); s != "acme,initech,globex" {
+		t.Errorf("tenants are %s, expected %s", s, "acme,initech,globex")
+	}
+
+	for _, value := range []string{"", "acme:x", "acme:1:2:3:4", "acme:-1"} {
+		if err := tf.Set(value); err == nil {
+			t.Errorf("err is nil for %s", value)
+		}
+	}
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	acme := pila.NewDatabase(namespace("acme", "db"))
+	_ = conn.Pila.AddDatabase(acme)
+	_ = conn.Auth.Add(Token{Token: "admin", Role: RoleAdmin})
+	_ = conn.Auth.Add(Token{Token: "acme", Role: RoleReadWrite, Tenant: "acme"})
+	_ = conn.Auth.Add(Token{Token: "initech", Role: RoleReadWrite, Tenant: "initech"})
+	_ = conn.Tenants.Add(Tenant{Name: "acme", MaxDatabases: 2, MaxStacks: 1, MaxMemory: 10})
+	handler := AuthMiddleware(conn)(TenantMiddleware(conn)(Router(conn)))
+
+	acmeID := acme.ID.String()
+	inputOutput := []struct {
+		method, path, token, body string
+		output                    int
+	}{
+		{"PUT", "/databases?name=db", "acme", "", http.StatusConflict},
+		{"PUT", "/databases?name=db", "initech", "", http.StatusCreated},
+		{"PUT", "/databases?name=other", "acme", "", http.StatusCreated},
+		{"PUT", "/databases?name=third", "acme", "", http.StatusForbidden},
+		{"PUT", "/databases/db/stacks?name=stack", "acme", "", http.StatusCreated},
+		{"PUT", "/databases/other/stacks?name=stack", "acme", "", http.StatusForbidden},
+		{"PUT", "/databases/db/stacks?name=stack", "initech", "", http.StatusCreated},
+		{"POST", "/databases/db/stacks/stack", "acme", `{"element":"0123456789"}`, http.StatusOK},
+		{"POST", "/databases/" + acmeID + "/stacks/stack", "acme", `{"element":"foo"}`, http.StatusInsufficientStorage},
+		{"POST", "/databases/db/stacks/stack", "initech", `{"element":"0123456789"}`, http.StatusOK},
+		{"POST", "/databases/db/stacks/stack", "initech", `{"element":"foo"}`, http.StatusOK},
+		{"GET", "/databases/" + acmeID + "/stacks/stack?size", "acme", "", http.StatusOK},
+		{"GET", "/databases/" + acmeID + "/stacks/stack?size", "initech", "", http.StatusGone},
+		{"GET", "/databases/" + db.ID.String(), "acme", "", http.StatusGone},
+		{"PATCH", "/databases/other", "acme", `{"name":"renamed"}`, http.StatusOK},
+		{"GET", "/databases/renamed", "acme", "", http.StatusOK},
+		{"GET", "/metrics", "acme", "", http.StatusForbidden},
+		{"GET", "/_tenants", "acme", "", http.StatusForbidden},
+		{"GET", "/_tenants", "admin", "", http.StatusOK},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, bytes.NewBufferString(io.body))
+		request.Header.Set("Authorization", "Bearer "+io.token)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.output {
+			t.Errorf("response code is %v, expected %v for %s %s with %s", response.Code, io.output, io.method, io.path, io.token)
+		}
+	}
+
+	listings := []struct {
+		token string
+		names []string
+	}{
+		{"acme", []string{"acme:db", "acme:renamed"}},
+		{"initech", []string{"initech:db"}},
+		{"admin", []string{"acme:db", "acme:renamed", "db", "initech:db"}},
+	}
+	for _, l := range listings {
+		request, _ := http.NewRequest("GET", "/databases", nil)
+		request.Header.Set("Authorization", "Bearer "+l.token)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		var status pila.Status
+		if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, db := range status.Databases {
+			names = append(names, db.Name)
+		}
+		if !reflect.DeepEqual(names, l.names) {
+			t.Errorf("databases of %s are %v, expected %v", l.token, names, l.names)
+		}
+	}
+
+	request, _ := http.NewRequest("GET", "/_status", nil)
+	request.Header.Set("Authorization", "Bearer acme")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	var status Status
+	if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Stats == nil || status.Stats.NumberDatabases != 2 || status.Stats.Size != 1 {
+		t.Errorf("stats are %+v, expected %d databases and size %d", status.Stats, 2, 1)
+	}
+}
+
+func TestTenantMiddleware_Form(t *testing.T) {
+	conn := NewConn()
+	src, dst, global := pila.NewDatabase(namespace("acme", "src")), pila.NewDatabase(namespace("acme", "dst")), pila.NewDatabase("dst")
+	for _, db := range []*pila.Database{src, dst, global} {
+		_ = conn.Pila.AddDatabase(db)
+	}
+	stack := pila.NewStack("a", time.Now().UTC())
+	_ = src.AddStack(stack)
+	_ = dst.AddStack(pila.NewStack("b", time.Now().UTC()))
+	_ = global.AddStack(pila.NewStack("b", time.Now().UTC()))
+	stack.Push("foo")
+	_ = conn.Auth.Add(Token{Token: "acme", Role: RoleReadWrite, Tenant: "acme"})
+	_ = conn.Tenants.Add(Tenant{Name: "acme", MaxStacks: 3})
+	conn.Config.Set(vars.StackTemplates, "queues:jobs,mails")
+	handler := AuthMiddleware(conn)(TenantMiddleware(conn)(Router(conn)))
+
+	inputOutput := []struct {
+		method, path, body string
+		output             int
+	}{
+		{"POST", "/databases/src/stacks/a/_copy", "to=b&to_database=dst", http.StatusOK},
+		{"PUT", "/databases", "name=global", http.StatusCreated},
+		{"PUT", "/databases", "name=queues&template=queues", http.StatusForbidden},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "Bearer acme")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.output {
+			t.Errorf("response code is %v, expected %v for %s %s with %s", response.Code, io.output, io.method, io.path, io.body)
+		}
+	}
+
+	b, _ := dst.StackByName("b")
+	globalB, _ := global.StackByName("b")
+	if b.Size() != 1 || globalB.Size() != 0 {
+		t.Errorf("sizes are %d and %d, expected the element copied into %s", b.Size(), globalB.Size(), dst.Name)
+	}
+	if _, ok := conn.Pila.DatabaseByName("global"); ok {
+		t.Error("database global created by tenant acme")
+	}
+	if _, ok := conn.Pila.DatabaseByName(namespace("acme", "global")); !ok {
+		t.Errorf("database %s not created", namespace("acme", "global"))
+	}
+}
+
+func TestTenantsHandler(t *testing.T) {
+	conn := NewConn()
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path, body string
+		output             int
+	}{
+		{"POST", "/_tenants", `{"name":"acme","max_stacks":5}`, http.StatusCreated},
+		{"POST", "/_tenants", `{"name":"ac:me"}`, http.StatusBadRequest},
+		{"POST", "/_tenants", `foo`, http.StatusBadRequest},
+		{"GET", "/_tenants", "", http.StatusOK},
+		{"DELETE", "/_tenants/acme", "", http.StatusNoContent},
+		{"DELETE", "/_tenants/acme", "", http.StatusGone},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, bytes.NewBufferString(io.body))
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.output {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.output, io.method, io.path)
+		}
+		if io.method == "GET" {
+			if expected := `{"tenants":[{"name":"acme","max_stacks":5}]}`; response.Body.String() != expected {
+				t.Errorf("tenants are %s, expected %s", response.Body.String(), expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+)
+
+// tlsConfig returns the TLS configuration of pilad, serving the
+// certificate in certFile with the private key in keyFile. If
+// clientCAFile is not empty, clients must present a certificate
+// signed by one of the PEM encoded CAs it contains.
+func tlsConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both TLS certificate and key must be provided")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// redirectHandler returns a handler that redirects every
+// request to the same URL with the https scheme, on port.
+func redirectHandler(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+
+		u := *r.URL
+		u.Scheme = "https"
+		u.Host = host
+		if port != 443 {
+			u.Host = net.JoinHostPort(host, fmt.Sprint(port))
+		}
+
+		logResponse(r, http.StatusMovedPermanently, "location", u.String())
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+	})
+}
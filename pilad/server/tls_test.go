@@ -0,0 +1,179 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert creates a certificate signed by parent, or self-signed if
+// parent is nil, and writes it and its key as PEM files into dir.
+func testCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, caKey := testCert(t, dir, "ca", nil, nil)
+	testCert(t, dir, "server", ca, caKey)
+	testCert(t, dir, "client", ca, caKey)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	config, err := tlsConfig(path("server.crt"), path("server.key"), path("ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("client auth is %v, expected %v", config.ClientAuth, tls.RequireAndVerifyClientCert)
+	}
+
+	conn := NewConn()
+	server := httptest.NewUnstartedServer(Router(conn))
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientCert, err := tls.LoadX509KeyPair(path("client.crt"), path("client.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputOutput := []struct {
+		certificates []tls.Certificate
+		output       bool
+	}{
+		{[]tls.Certificate{clientCert}, true},
+		{nil, false},
+	}
+
+	for _, io := range inputOutput {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: io.certificates,
+		}}}
+		response, err := client.Get(server.URL + "/_status")
+		if (err == nil) != io.output {
+			t.Errorf("ok is %v, expected %v: %v", err == nil, io.output, err)
+		}
+		if err == nil {
+			response.Body.Close()
+			if response.StatusCode != http.StatusOK {
+				t.Errorf("response code is %v, expected %v", response.StatusCode, http.StatusOK)
+			}
+		}
+	}
+}
+
+func TestTLSConfig_Error(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCert(t, dir, "server", nil, nil)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	inputs := []struct {
+		cert, key, clientCA string
+	}{
+		{"", path("server.key"), ""},
+		{path("server.crt"), "", ""},
+		{path("foo.crt"), path("server.key"), ""},
+		{path("server.crt"), path("server.key"), path("foo.crt")},
+		{path("server.crt"), path("server.key"), path("server.key")},
+	}
+
+	for _, input := range inputs {
+		if _, err := tlsConfig(input.cert, input.key, input.clientCA); err == nil {
+			t.Errorf("err is nil for %v", input)
+		}
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	inputOutput := []struct {
+		port          int
+		url, location string
+	}{
+		{1205, "http://localhost:8080/databases?name=db", "https://localhost:1205/databases?name=db"},
+		{443, "http://piladb.example.com/_status", "https://piladb.example.com/_status"},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("GET", io.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		redirectHandler(io.port).ServeHTTP(response, request)
+
+		if response.Code != http.StatusMovedPermanently {
+			t.Errorf("response code is %v, expected %v", response.Code, http.StatusMovedPermanently)
+		}
+		if location := response.Header().Get("Location"); location != io.location {
+			t.Errorf("location is %s, expected %s", location, io.location)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/fern4lvarez/piladb/config/vars"
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+)
+
+// txOperation represents an operation of a transaction
+// request. Stack is either the ID or the name of a Stack.
+type txOperation struct {
+	Op      pila.TxOp   `json:"op"`
+	Stack   string      `json:"stack"`
+	Element interface{} `json:"element"`
+}
+
+// txPersistOps maps the operations of a transaction
+// to the ones recorded in the persistence Log.
+var txPersistOps = map[pila.TxOp]persist.Op{
+	pila.TxPush:  persist.OpPush,
+	pila.TxPop:   persist.OpPop,
+	pila.TxFlush: persist.OpFlush,
+}
+
+// transactionHandler applies a list of PUSH, POP and FLUSH operations
+// on the stacks of a database atomically, and returns the element
+// of every operation.
+func (c *Conn) transactionHandler(w http.ResponseWriter, r *http.Request) {
+	r = withDate(r)
+	now := requestDate(r)
+	db := databaseFromContext(r)
+
+	if r.Body == nil {
+		logResponse(r, http.StatusBadRequest, "reason", "no operations provided")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := c.readBody(w, r)
+	if err == errBodyTooLarge {
+		c.tooLargeHandler(w, r, err)
+		return
+	}
+
+	var txOps []txOperation
+	if err == nil {
+		err = json.Unmarshal(body, &txOps)
+	}
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on decoding operations", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ops := make([]pila.TxOperation, len(txOps))
+	sizes := make(map[*pila.Stack]int)
+	for i, txOp := range txOps {
+		if _, ok := txPersistOps[txOp.Op]; !ok {
+			logResponse(r, http.StatusBadRequest, "reason", "unknown operation", "op", txOp.Op)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		stack, ok := ResourceStack(db, txOp.Stack)
+		if !ok {
+			c.goneHandler(w, r, fmt.Sprintf("stack %s is Gone", txOp.Stack))
+			return
+		}
+		if !c.checkLock(w, r, stack) {
+			return
+		}
+
+		if _, ok := sizes[stack]; !ok {
+			sizes[stack] = stack.Size()
+		}
+		switch txOp.Op {
+		case pila.TxPush:
+			if s := c.Config.MaxStackSize(); sizes[stack] >= s && s != -1 {
+				logResponse(r, http.StatusNotAcceptable, "reason", "value reached", "config", vars.MaxStackSize)
+				w.WriteHeader(http.StatusNotAcceptable)
+				return
+			}
+			if s := c.Config.MaxElementSize(); s != -1 && pila.ElementSize(txOp.Element) > s {
+				c.tooLargeHandler(w, r, pila.ErrElementTooLarge)
+				return
+			}
+			sizes[stack]++
+		case pila.TxPop:
+			sizes[stack]--
+		case pila.TxFlush:
+			sizes[stack] = 0
+		}
+
+		ops[i] = pila.TxOperation{Op: txOp.Op, Stack: stack, Element: txOp.Element}
+	}
+
+	stacks := make([]*pila.Stack, 0, len(sizes))
+	for stack := range sizes {
+		stacks = append(stacks, stack)
+	}
+	unlock := c.stackLocks.lock(stacks...)
+	values, err := db.Transaction(ops, now)
+	if err != nil {
+		unlock()
+		logResponse(r, http.StatusConflict, "reason", "transaction rolled back", "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	elements := make([]pila.Element, len(values))
+	for i, value := range values {
+		elements[i].Value = value
+		c.persistStack(r.Context(), ops[i].Stack, persist.Record{Op: txPersistOps[ops[i].Op], Time: now, Element: ops[i].Element})
+	}
+	unlock()
+
+	b, err := json.Marshal(elements)
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "reason", "error on response serialization", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	logResponse(r, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
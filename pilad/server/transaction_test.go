@@ -0,0 +1,116 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestTransactionHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	s0 := pila.NewStack("s0", time.Now().UTC())
+	s1 := pila.NewStack("s1", time.Now().UTC())
+	_ = db.AddStack(s0)
+	_ = db.AddStack(s1)
+	s1.Push("bar")
+
+	body := `[
+  {"op":"push","stack":"s0","element":"foo"},
+  {"op":"pop","stack":"` + s1.ID.String() + `"},
+  {"op":"push","stack":"s1","element":1},
+  {"op":"flush","stack":"s1"}
+]`
+	request, err := http.NewRequest("POST", "/databases/db/_transaction", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+
+	Router(conn).ServeHTTP(response, request)
+
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type is %v, expected %v", contentType, "application/json")
+	}
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+
+	expected := `[{"element":"foo"},{"element":"bar"},{"element":1},{"element":null}]`
+	if body := response.Body.String(); body != expected {
+		t.Errorf("response is %s, expected %s", body, expected)
+	}
+
+	if s0.Size() != 1 || s0.Peek() != "foo" {
+		t.Errorf("stack %s is not updated", s0.Name)
+	}
+	if s1.Size() != 0 {
+		t.Errorf("stack size is %d, expected %d", s1.Size(), 0)
+	}
+}
+
+func TestTransactionHandler_Error(t *testing.T) {
+	conn := NewConn()
+	conn.Config.Set("MAX_STACK_SIZE", 2)
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	s0 := pila.NewStack("s0", time.Now().UTC())
+	_ = db.AddStack(s0)
+	s0.Push("foo")
+
+	inputOutput := []struct {
+		input  string
+		output int
+	}{
+		{"", http.StatusBadRequest},
+		{`{"op":"push"}`, http.StatusBadRequest},
+		{`[{"op":"foo","stack":"s0"}]`, http.StatusBadRequest},
+		{`[{"op":"push","stack":"s0","element":1},{"op":"push","stack":"nostack","element":2}]`, http.StatusGone},
+		{`[{"op":"push","stack":"s0","element":1},{"op":"push","stack":"s0","element":2}]`, http.StatusNotAcceptable},
+		{`[{"op":"pop","stack":"s0"},{"op":"push","stack":"s0","element":1},{"op":"push","stack":"s0","element":2}]`, http.StatusOK},
+		{`[{"op":"push","stack":"s0","element":1},{"op":"flush","stack":"s0"},{"op":"pop","stack":"s0"}]`, http.StatusConflict},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("POST", "/databases/db/_transaction", bytes.NewBufferString(io.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != io.output {
+			t.Errorf("on %s response code is %v, expected %v", io.input, response.Code, io.output)
+		}
+
+		if io.output != http.StatusOK && (s0.Size() != 1 || s0.Peek() != "foo") {
+			t.Errorf("on %s stack %s is modified", io.input, s0.Name)
+		}
+
+		// restore stack for next table test iteration
+		s0.Flush()
+		s0.Push("foo")
+	}
+}
+
+func TestTransactionHandler_DatabaseGone(t *testing.T) {
+	conn := NewConn()
+
+	request, err := http.NewRequest("POST", "/databases/nodb/_transaction", bytes.NewBufferString("[]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+
+	Router(conn).ServeHTTP(response, request)
+
+	if response.Code != http.StatusGone {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusGone)
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+)
+
+// transferToDatabaseHandler transfers the Stack, along with its elements
+// and settings, to the Database given by the to_database parameter,
+// keeping its ID and name, and returns 200 and its status. Returns 400
+// if to_database is missing or is the Database of the Stack, 409 if it
+// already has a Stack with the same name or ID, and 507 if the elements
+// would exceed its maximum memory.
+func (c *Conn) transferToDatabaseHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	db := databaseFromContext(r)
+
+	name := destinationDatabase(r)
+	if name == "" {
+		logResponse(r, http.StatusBadRequest, "reason", "missing destination database")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	dst, ok := ResourceDatabase(c, name)
+	if !ok {
+		c.goneHandler(w, r, fmt.Sprintf("database %s is Gone", name))
+		return
+	}
+	if dst == db {
+		logResponse(r, http.StatusBadRequest, "reason", "stack already in database", "stack", stack.Name, "database", db.Name)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !checkIfMatch(w, r, stack) || !c.checkLock(w, r, stack) {
+		return
+	}
+
+	unlock := c.stackLocks.lock(stack)
+	switch err := db.TransferStack(stack.ID, dst); {
+	case err == pila.ErrMemoryLimit:
+		unlock()
+		c.memoryLimitHandler(w, r, err)
+		return
+	case err != nil:
+		unlock()
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	c.persist(r.Context(), persist.Record{Op: persist.OpTransferStack, Time: requestDate(r), Database: db.Name, Stack: stack.Name, ToDatabase: dst.Name})
+	unlock()
+
+	// Do not check error as the Status of a stack does
+	// not contain types that could cause such case.
+	res, _ := stack.Status().ToJSON()
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(res)
+}
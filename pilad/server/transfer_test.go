@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestTransferToDatabaseHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	other := pila.NewDatabase("other")
+	_ = conn.Pila.AddDatabase(other)
+	taken := pila.NewDatabase("taken")
+	_ = conn.Pila.AddDatabase(taken)
+	full := pila.NewDatabase("full")
+	full.SetMaxMemory(1)
+	_ = conn.Pila.AddDatabase(full)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	_ = taken.AddStack(pila.NewStack("stack", time.Now().UTC()))
+	_ = stack.PushN([]interface{}{"foo", "bar"})
+	id := stack.ID
+
+	inputOutput := []struct {
+		query string
+		code  int
+		in    *pila.Database
+	}{
+		{"", http.StatusBadRequest, db},
+		{"?to_database=db", http.StatusBadRequest, db},
+		{"?to_database=foo", http.StatusGone, db},
+		{"?to_database=taken", http.StatusConflict, db},
+		{"?to_database=full", http.StatusInsufficientStorage, db},
+		{"?to_database=other", http.StatusOK, other},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("POST", "/databases/db/stacks/stack/_transfer"+io.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %q", response.Code, io.code, io.query)
+		}
+		if stack.Database != io.in {
+			t.Errorf("stack database is %v, expected %v for %q", stack.Database.Name, io.in.Name, io.query)
+		}
+	}
+
+	if s, ok := other.Stack(id); !ok || s != stack || s.Size() != 2 {
+		t.Errorf("database %v has no Stack %v with %d elements", other.Name, id, 2)
+	}
+	if _, ok := db.Stack(id); ok {
+		t.Errorf("database %v has Stack %v", db.Name, id)
+	}
+
+	request, _ := http.NewRequest("GET", "/databases/other/stacks/stack?peek", nil)
+	response := httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+	if response.Code != http.StatusOK || response.Body.String() != `{"element":"bar"}` {
+		t.Errorf("response is %v %s, expected %v %s", response.Code, response.Body, http.StatusOK, `{"element":"bar"}`)
+	}
+}
+
+func TestTransferToDatabaseHandler_Locked(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	_ = conn.Pila.AddDatabase(pila.NewDatabase("other"))
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	_, _ = stack.Lock("owner", time.Minute, time.Now())
+
+	request, _ := http.NewRequest("POST", "/databases/db/stacks/stack/_transfer?to_database=other", nil)
+	response := httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+
+	if response.Code != http.StatusLocked {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusLocked)
+	}
+	if stack.Database != db {
+		t.Errorf("stack database is %v, expected %v", stack.Database.Name, db.Name)
+	}
+}
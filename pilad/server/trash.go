@@ -0,0 +1,352 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+	"github.com/fern4lvarez/piladb/pkg/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Kinds of the items of the Trash.
+const (
+	trashDatabase = "database"
+	trashStack    = "stack"
+)
+
+var (
+	// ErrTrashNameTaken is returned when restoring a Database or
+	// Stack whose name is taken by another one.
+	ErrTrashNameTaken = errors.New("name is taken")
+	// ErrTrashNoDatabase is returned when restoring a Stack
+	// whose Database does not exist anymore.
+	ErrTrashNoDatabase = errors.New("database of the stack does not exist")
+)
+
+// TrashedItem represents a deleted Database or Stack, kept in the
+// Trash until its retention expires.
+type TrashedItem struct {
+	// ID is the ID of the Database or Stack
+	ID string `json:"id"`
+	// Kind is either database or stack
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Database is the name of the Database of a Stack,
+	// and DatabaseID its ID
+	Database   string `json:"database,omitempty"`
+	DatabaseID string `json:"database_id,omitempty"`
+	// Stacks is the number of Stacks of a Database
+	Stacks    int       `json:"stacks"`
+	DeletedAt time.Time `json:"deleted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	maxMemory int64
+	spill     int
+	// archives are the Stacks, as written by WriteArchive
+	archives [][]byte
+}
+
+// Trash keeps in memory the Databases and Stacks deleted during
+// a retention period, so they can be restored, and purges them
+// permanently once it expires. It is disabled if the retention is
+// 0, which is the default, deleting them immediately.
+type Trash struct {
+	retention time.Duration
+
+	// items maps the TrashedItems by ID
+	items map[string]*TrashedItem
+
+	// mu protects the retention and the items
+	mu sync.Mutex
+}
+
+// NewTrash returns a disabled Trash.
+func NewTrash() *Trash {
+	return &Trash{items: make(map[string]*TrashedItem)}
+}
+
+// SetRetention sets the retention of the Trash, disabling it if 0.
+// Items already in the Trash keep their expiration date.
+func (t *Trash) SetRetention(retention time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.retention = retention
+}
+
+// Retention returns the retention of the Trash, 0 if disabled.
+func (t *Trash) Retention() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.retention
+}
+
+// AddDatabase puts db, along with its Stacks, into the Trash at date
+// now, and returns whether it did so, i.e. if the Trash is enabled.
+// The Database is not removed from its Pila.
+func (t *Trash) AddDatabase(db *pila.Database, now time.Time) (bool, error) {
+	if t.Retention() == 0 {
+		return false, nil
+	}
+	item := &TrashedItem{ID: db.ID.String(), Kind: trashDatabase, Name: db.Name, maxMemory: db.MaxMemory(), spill: db.Spill()}
+	var err error
+	db.ForEachStack(func(s *pila.Stack) bool {
+		var b []byte
+		if b, err = archiveBytes(s); err != nil {
+			return false
+		}
+		item.archives = append(item.archives, b)
+		return true
+	})
+	if err != nil {
+		return false, err
+	}
+	item.Stacks = len(item.archives)
+	return t.add(item, now), nil
+}
+
+// AddStack puts stack, of database db, into the Trash at date now,
+// and returns whether it did so, i.e. if the Trash is enabled. The
+// Stack is not removed from db.
+func (t *Trash) AddStack(db *pila.Database, stack *pila.Stack, now time.Time) (bool, error) {
+	if t.Retention() == 0 {
+		return false, nil
+	}
+	b, err := archiveBytes(stack)
+	if err != nil {
+		return false, err
+	}
+	item := &TrashedItem{ID: stack.ID.String(), Kind: trashStack, Name: stack.Name, Database: db.Name, DatabaseID: db.ID.String(), archives: [][]byte{b}}
+	return t.add(item, now), nil
+}
+
+// add adds an item deleted at date now, if the Trash is enabled.
+func (t *Trash) add(item *TrashedItem, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.retention == 0 {
+		return false
+	}
+	item.DeletedAt = now.UTC()
+	item.ExpiresAt = item.DeletedAt.Add(t.retention)
+	t.items[item.ID] = item
+	return true
+}
+
+// archiveBytes returns the archive of a Stack.
+func archiveBytes(stack *pila.Stack) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := stack.WriteArchive(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Items returns the items of the Trash, from the
+// most recently deleted to the least one.
+func (t *Trash) Items() []TrashedItem {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	items := make([]TrashedItem, 0, len(t.items))
+	for _, item := range t.items {
+		items = append(items, *item)
+	}
+	sort.Sort(trashedItemsByDate(items))
+	return items
+}
+
+// Take removes an item from the Trash given its ID, and returns it.
+func (t *Trash) Take(id string) (*TrashedItem, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	item, ok := t.items[id]
+	delete(t.items, id)
+	return item, ok
+}
+
+// put puts back an item taken from the Trash.
+func (t *Trash) put(item *TrashedItem) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.items[item.ID] = item
+}
+
+// Purge removes permanently the items of the Trash whose
+// retention expired at date now, and returns how many.
+func (t *Trash) Purge(now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var purged int
+	for id, item := range t.items {
+		if !now.Before(item.ExpiresAt) {
+			delete(t.items, id)
+			purged++
+		}
+	}
+	return purged
+}
+
+type trashedItemsByDate []TrashedItem
+
+func (items trashedItemsByDate) Len() int { return len(items) }
+func (items trashedItemsByDate) Less(i, j int) bool {
+	if items[i].DeletedAt.Equal(items[j].DeletedAt) {
+		return items[i].ID < items[j].ID
+	}
+	return items[i].DeletedAt.After(items[j].DeletedAt)
+}
+func (items trashedItemsByDate) Swap(i, j int) { items[i], items[j] = items[j], items[i] }
+
+// readArchives reads the Stacks of a TrashedItem. A Stack that
+// spilled to disk spills into spillDir, unless it is empty, and
+// the elements of an encrypted Stack are decrypted with keys.
+func (item *TrashedItem) readArchives(spillDir string, keys *pila.Keyring) ([]*pila.Stack, error) {
+	stacks := make([]*pila.Stack, 0, len(item.archives))
+	for _, b := range item.archives {
+		stack, err := pila.ReadArchive(bytes.NewReader(b), spillDir, keys)
+		if err != nil {
+			return nil, err
+		}
+		stacks = append(stacks, stack)
+	}
+	return stacks, nil
+}
+
+// restoreTrashed restores at date t a Database or Stack taken from the Trash,
+// persists it, and returns the JSON encoding of its status. It returns
+// ErrTrashNameTaken if its name or ID is taken, and ErrTrashNoDatabase
+// if the Database of a Stack does not exist.
+func (c *Conn) restoreTrashed(ctx context.Context, item *TrashedItem, t time.Time) ([]byte, error) {
+	stacks, err := item.readArchives(c.Pila.SpillDir(), c.Pila.Keyring())
+	if err != nil {
+		return nil, err
+	}
+
+	if item.Kind == trashStack {
+		db, ok := c.Pila.ResolveDatabase(item.DatabaseID)
+		if !ok {
+			return nil, ErrTrashNoDatabase
+		}
+		if err := db.AddStack(stacks[0]); err != nil {
+			return nil, ErrTrashNameTaken
+		}
+		c.persistRestoredStack(ctx, stacks[0], t)
+		return stacks[0].Status().ToJSON()
+	}
+
+	db := pila.NewDatabase(item.Name)
+	db.ID = uuid.UUID(item.ID)
+	for _, stack := range stacks {
+		if err := db.AddStack(stack); err != nil {
+			return nil, err
+		}
+	}
+	db.SetMaxMemory(item.maxMemory)
+	db.SetSpill(item.spill)
+	if err := c.Pila.AddDatabase(db); err != nil {
+		return nil, ErrTrashNameTaken
+	}
+	c.persist(ctx, persist.Record{Op: persist.OpCreateDatabase, Time: t, Database: db.Name, MaxMemory: item.maxMemory, Spill: item.spill, ID: db.ID.String()})
+	for _, stack := range stacks {
+		c.persistRestoredStack(ctx, stack, t)
+	}
+	return db.Status().ToJSON(), nil
+}
+
+// trashDatabase puts a Database being deleted at date t into the Trash,
+// if it is enabled. The Database is deleted anyway if that fails.
+func (c *Conn) trashDatabase(db *pila.Database, t time.Time) {
+	if _, err := c.Trash.AddDatabase(db, t); err != nil {
+		logger.Error("error on trashing database", "database", db.Name, "error", err)
+	}
+}
+
+// trashStack puts a Stack being deleted at date t into the Trash,
+// if it is enabled. The Stack is deleted anyway if that fails.
+func (c *Conn) trashStack(db *pila.Database, stack *pila.Stack, t time.Time) {
+	if _, err := c.Trash.AddStack(db, stack, t); err != nil {
+		logger.Error("error on trashing stack", "database", db.Name, "stack", stack.Name, "error", err)
+	}
+}
+
+// trashHandler returns the Databases and Stacks in the
+// Trash, along with its retention in seconds.
+func (c *Conn) trashHandler(w http.ResponseWriter, r *http.Request) {
+	c.Trash.Purge(time.Now())
+	res := struct {
+		Retention float64       `json:"retention"`
+		Items     []TrashedItem `json:"items"`
+	}{c.Trash.Retention().Seconds(), c.Trash.Items()}
+
+	// Do not check error as TrashedItems do not
+	// contain types that could cause such case.
+	b, _ := json.Marshal(res)
+
+	logResponse(r, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// restoreTrashHandler restores the Database or Stack of the Trash
+// given by the id variable, and returns 200 and its status. Returns
+// 410 if there is no such item, and 409 if its name is taken or the
+// Database of a Stack does not exist anymore.
+func (c *Conn) restoreTrashHandler(w http.ResponseWriter, r *http.Request) {
+	r = withDate(r)
+	id := mux.Vars(r)["id"]
+
+	c.Trash.Purge(time.Now())
+	item, ok := c.Trash.Take(id)
+	if !ok {
+		c.goneHandler(w, r, fmt.Sprintf("trashed item %s is Gone", id))
+		return
+	}
+
+	unlock := c.stackLocks.lockAll()
+	res, err := c.restoreTrashed(r.Context(), item, requestDate(r))
+	unlock()
+	if err != nil {
+		c.Trash.put(item)
+	}
+	if err == ErrTrashNameTaken || err == ErrTrashNoDatabase {
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logResponse(r, http.StatusInternalServerError, "reason", "error on restoring trashed item", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("restored from trash", "kind", item.Kind, "name", item.Name)
+	logResponse(r, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
+
+// purgeTrashHandler removes permanently the Database or Stack of the
+// Trash given by the id variable, and returns 204. Returns 410 if
+// there is no such item.
+func (c *Conn) purgeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, ok := c.Trash.Take(id); !ok {
+		c.goneHandler(w, r, fmt.Sprintf("trashed item %s is Gone", id))
+		return
+	}
+
+	logResponse(r, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestTrash(t *testing.T) {
+	db := pila.NewDatabase("db")
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = stack.Push("foo")
+	_ = db.AddStack(stack)
+	now := time.Now()
+
+	trash := NewTrash()
+	if ok, err := trash.AddStack(db, stack, now); ok || err != nil {
+		t.Errorf("stack trashed is %v, %v, expected false", ok, err)
+	}
+
+	trash.SetRetention(time.Hour)
+	if ok, err := trash.AddStack(db, stack, now); !ok || err != nil {
+		t.Errorf("stack trashed is %v, %v, expected true", ok, err)
+	}
+	if ok, err := trash.AddDatabase(db, now.Add(time.Minute)); !ok || err != nil {
+		t.Errorf("database trashed is %v, %v, expected true", ok, err)
+	}
+
+	items := trash.Items()
+	if len(items) != 2 {
+		t.Fatalf("items are %v, expected 2", items)
+	}
+	if items[0].ID != db.ID.String() || items[0].Kind != trashDatabase || items[0].Stacks != 1 {
+		t.Errorf("item is %v, expected database %s", items[0], db.ID)
+	}
+	if items[1].ID != stack.ID.String() || items[1].Kind != trashStack || items[1].Database != "db" || items[1].DatabaseID != db.ID.String() {
+		t.Errorf("item is %v, expected stack %s", items[1], stack.ID)
+	}
+	if expected := now.UTC().Add(time.Hour); !items[1].ExpiresAt.Equal(expected) {
+		t.Errorf("expiration is %v, expected %v", items[1].ExpiresAt, expected)
+	}
+
+	stacks, err := items[1].readArchives("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stacks) != 1 || stacks[0].Name != "stack" || stacks[0].Peek() != "foo" {
+		t.Errorf("stacks are %v, expected stack with foo", stacks)
+	}
+
+	if purged := trash.Purge(now.Add(time.Hour)); purged != 1 {
+		t.Errorf("purged items are %d, expected 1", purged)
+	}
+	if item, ok := trash.Take(db.ID.String()); !ok || item.Name != "db" {
+		t.Errorf("item is %v, %v, expected database", item, ok)
+	}
+	if _, ok := trash.Take(db.ID.String()); ok {
+		t.Error("item taken twice")
+	}
+	if items := trash.Items(); len(items) != 0 {
+		t.Errorf("items are %v, expected none", items)
+	}
+}
+
+func TestTrashHandlers(t *testing.T) {
+	conn := NewConn()
+	conn.Trash.SetRetention(time.Hour)
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now())
+	_ = stack.Push("foo")
+	_ = db.AddStack(stack)
+	handler := Router(conn)
+
+	do := func(method, path string, code int) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		if response.Code != code {
+			t.Fatalf("%s %s: response code is %v, expected %v", method, path, response.Code, code)
+		}
+		return response
+	}
+
+	do("DELETE", "/databases/db/stacks/stack?full", http.StatusNoContent)
+	if _, ok := db.StackByName("stack"); ok {
+		t.Fatal("stack was not deleted")
+	}
+
+	var res struct {
+		Retention float64       `json:"retention"`
+		Items     []TrashedItem `json:"items"`
+	}
+	_ = json.Unmarshal(do("GET", "/_trash", http.StatusOK).Body.Bytes(), &res)
+	if res.Retention != 3600 || len(res.Items) != 1 || res.Items[0].ID != stack.ID.String() {
+		t.Fatalf("trash is %v, expected stack %s", res, stack.ID)
+	}
+
+	// the name of the stack is taken
+	db.CreateStack("stack", time.Now())
+	do("POST", "/_trash/"+stack.ID.String()+"/restore", http.StatusConflict)
+	do("DELETE", "/databases/db/stacks/stack?full", http.StatusNoContent)
+
+	do("POST", "/_trash/"+stack.ID.String()+"/restore", http.StatusOK)
+	restored, ok := db.StackByName("stack")
+	if !ok || restored.ID.String() != stack.ID.String() || restored.Peek() != "foo" {
+		t.Fatalf("restored stack is %v, expected %s with foo", restored, stack.ID)
+	}
+
+	do("DELETE", "/databases/db?cascade=true", http.StatusNoContent)
+	_ = json.Unmarshal(do("GET", "/_trash", http.StatusOK).Body.Bytes(), &res)
+	if len(res.Items) != 2 || res.Items[0].ID != db.ID.String() {
+		t.Fatalf("trash is %v, expected database %s first", res, db.ID)
+	}
+
+	// the stack can not be restored without its database
+	for _, item := range res.Items {
+		if item.Kind == trashStack {
+			do("POST", "/_trash/"+item.ID+"/restore", http.StatusConflict)
+			do("DELETE", "/_trash/"+item.ID, http.StatusNoContent)
+			do("DELETE", "/_trash/"+item.ID, http.StatusGone)
+		}
+	}
+
+	do("POST", "/_trash/"+db.ID.String()+"/restore", http.StatusOK)
+	restoredDB, ok := conn.Pila.DatabaseByName("db")
+	if !ok || restoredDB.ID.String() != db.ID.String() {
+		t.Fatalf("restored database is %v, expected %s", restoredDB, db.ID)
+	}
+	if s, ok := restoredDB.StackByName("stack"); !ok || s.Peek() != "foo" {
+		t.Errorf("restored stack is %v, expected stack with foo", s)
+	}
+
+	do("POST", "/_trash/"+db.ID.String()+"/restore", http.StatusGone)
+	_ = json.Unmarshal(do("GET", "/_trash", http.StatusOK).Body.Bytes(), &res)
+	if len(res.Items) != 0 {
+		t.Errorf("trash is %v, expected empty", res)
+	}
+}
+
+func TestTrashHandlers_Disabled(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	db.CreateStack("stack", time.Now())
+
+	request, _ := http.NewRequest("DELETE", "/databases/db/stacks/stack?full", nil)
+	Router(conn).ServeHTTP(httptest.NewRecorder(), request)
+
+	if items := conn.Trash.Items(); len(items) != 0 {
+		t.Errorf("items are %v, expected none", items)
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// expirationInterval is the period of time between two
+// sweeps of the expired elements of the stacks.
+const expirationInterval = time.Second
+
+// ttlParam returns the duration given by the ttl parameter of the
+// request URL, e.g. 30s, or 0 if not present. It returns an error if
+// the value is not a positive duration.
+func ttlParam(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("ttl")
+	if value == "" {
+		return 0, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("ttl must be a positive duration, got %s", value)
+	}
+	return ttl, nil
+}
+
+// ExpirationSweeper removes the expired elements of all the stacks,
+// redelivers the elements of their groups whose acknowledgement timed
+// out, and purges the Trash, every interval until stop is closed. It
+// is meant to be run as a goroutine.
+func (c *Conn) ExpirationSweeper(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case t := <-ticker.C:
+			if removed := c.Pila.Expire(t); removed > 0 {
+				logger.Info("removed expired elements", "count", removed)
+			}
+			if redelivered := c.Redeliver(t); redelivered > 0 {
+				logger.Info("redelivered unacknowledged elements", "count", redelivered)
+			}
+			if purged := c.Trash.Purge(t); purged > 0 {
+				logger.Info("purged trash", "count", purged)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
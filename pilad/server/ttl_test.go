@@ -0,0 +1,116 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestTTLParam(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output time.Duration
+	}{
+		{"/", 0},
+		{"/?ttl=30s", 30 * time.Second},
+		{"/?ttl=1h30m", 90 * time.Minute},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("POST", io.input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ttl, err := ttlParam(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl != io.output {
+			t.Errorf("ttl is %v, expected %v", ttl, io.output)
+		}
+	}
+}
+
+func TestTTLParam_Error(t *testing.T) {
+	for _, input := range []string{"/?ttl=foo", "/?ttl=30", "/?ttl=0s", "/?ttl=-1s"} {
+		request, err := http.NewRequest("POST", input, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ttlParam(request); err == nil {
+			t.Errorf("err is nil for %s", input)
+		}
+	}
+}
+
+func TestPushStackHandler_TTL(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	stack.Push("foo")
+
+	inputOutput := []struct {
+		input  string
+		output int
+	}{
+		{"/databases/db/stacks/stack?ttl=1ns", http.StatusOK},
+		{"/databases/db/stacks/stack?ttl=1h", http.StatusOK},
+		{"/databases/db/stacks/stack?ttl=foo", http.StatusBadRequest},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest("POST", io.input, bytes.NewBufferString(`{"element":"bar"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+
+		Router(conn).ServeHTTP(response, request)
+
+		if response.Code != io.output {
+			t.Errorf("on %s response code is %v, expected %v", io.input, response.Code, io.output)
+		}
+	}
+
+	if stack.Size() != 2 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 2)
+	}
+	if removed := conn.Pila.Expire(time.Now().Add(2 * time.Hour)); removed != 2 {
+		t.Errorf("removed is %d, expected %d", removed, 2)
+	}
+	if peek := stack.Peek(); peek != "foo" {
+		t.Errorf("peek is %v, expected %v", peek, "foo")
+	}
+}
+
+func TestConnExpirationSweeper(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	stack.PushWithExpiration("foo", time.Now())
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		conn.ExpirationSweeper(time.Millisecond, stop)
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+	<-done
+
+	if stack.SizeApprox() != 0 {
+		t.Errorf("stack.SizeApprox() is %d, expected %d", stack.SizeApprox(), 0)
+	}
+}
@@ -0,0 +1,18 @@
+package server
+
+//go:generate go run gen_ui.go
+
+import (
+	"net/http"
+)
+
+// uiHandler returns 200 and the web UI of pilad, a single page listing
+// the databases and stacks, with their sizes refreshed every two
+// seconds, and pushing, popping and peeking elements of a stack. The
+// page is embedded in the binary, and calls the HTTP API with the
+// token typed in it, if any.
+func (c *Conn) uiHandler(w http.ResponseWriter, r *http.Request) {
+	logResponse(r, http.StatusOK)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(uiHTML))
+}
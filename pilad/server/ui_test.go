@@ -0,0 +1,40 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUIUpToDate(t *testing.T) {
+	b, err := ioutil.ReadFile("ui/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != uiHTML {
+		t.Error("ui_html.go is outdated, please run go generate")
+	}
+}
+
+func TestUIHandler(t *testing.T) {
+	conn := NewConn()
+	request, err := http.NewRequest("GET", "/_ui", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	Router(conn).ServeHTTP(response, request)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusOK)
+	}
+	if contentType := response.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type is %v, expected %v", contentType, "text/html; charset=utf-8")
+	}
+	if body := response.Body.String(); !strings.HasPrefix(body, "<!DOCTYPE html>") {
+		t.Errorf("body is %.40s..., expected the web UI", body)
+	}
+}
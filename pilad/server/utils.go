@@ -1,36 +1,22 @@
-package main
+package server
 
 import (
 	"fmt"
 	"runtime"
 
 	"github.com/fern4lvarez/piladb/pila"
-	"github.com/fern4lvarez/piladb/pkg/uuid"
-	"github.com/fern4lvarez/piladb/pkg/version"
 )
 
 // ResourceDatabase will return the right Database resource
 // given a Conn and a database ID or Name.
 func ResourceDatabase(conn *Conn, databaseInput string) (*pila.Database, bool) {
-	db, ok := conn.Pila.Database(uuid.UUID(databaseInput))
-	if !ok {
-		// Fallback to find by database name
-		db, ok = conn.Pila.Database(uuid.New(databaseInput))
-	}
-
-	return db, ok
+	return conn.Pila.ResolveDatabase(databaseInput)
 }
 
 // ResourceStack will return the right Stack resource
 // given a Database and a Stack ID or Name.
 func ResourceStack(db *pila.Database, stackInput string) (*pila.Stack, bool) {
-	stack, ok := db.Stacks[uuid.UUID(stackInput)]
-	if !ok {
-		// Fallback to find by stack name
-		stack, ok = db.Stacks[uuid.New(db.Name+stackInput)]
-	}
-
-	return stack, ok
+	return db.ResolveStack(stackInput)
 }
 
 // MemStats fetches the memory statistics provided
@@ -61,8 +47,3 @@ func MemOutput(mem uint64) string {
 		return fmt.Sprintf("%.2fGiB", memF64/1073741824)
 	}
 }
-
-// v returns the version using pkg/version
-func v() string {
-	return version.Version(version.VERSION)
-}
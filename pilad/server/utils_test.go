@@ -1,4 +1,4 @@
-package main
+package server
 
 import (
 	"reflect"
@@ -11,11 +11,11 @@ import (
 
 func TestResourceDatabase(t *testing.T) {
 	dbName := "db"
-	inputs := []string{dbName, uuid.New(dbName).String()}
+	expectedDB := pila.NewDatabase(dbName)
+	inputs := []string{dbName, expectedDB.ID.String()}
 
 	for _, input := range inputs {
-		expectedDB := pila.NewDatabase(dbName)
-
+		expectedDB.Pila = nil
 		p := pila.NewPila()
 		_ = p.AddDatabase(expectedDB)
 
@@ -53,11 +53,11 @@ func TestResourceStack(t *testing.T) {
 	dbName := "db"
 
 	stackName := "stack"
-	inputs := []string{stackName, uuid.New(dbName + stackName).String()}
+	expectedStack := pila.NewStack(stackName, time.Now())
+	inputs := []string{stackName, expectedStack.ID.String()}
 
 	for _, input := range inputs {
-		expectedStack := pila.NewStack(stackName, time.Now())
-
+		expectedStack.Database = nil
 		db := pila.NewDatabase(dbName)
 		_ = db.AddStack(expectedStack)
 
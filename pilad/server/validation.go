@@ -0,0 +1,195 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// MaxNameLength is the maximum length of the names
+// of the Databases, Stacks and consumer groups.
+const MaxNameLength = 128
+
+// Codes of the APIErrors. Errors without a specific
+// code are coded after the text of their status.
+const (
+	codeInvalidName      = "invalid_name"
+	codeMalformedJSON    = "malformed_json"
+	codeDatabaseNotFound = "database_not_found"
+)
+
+// APIError is the body of the error responses, written as
+// {"code": CODE, "message": MESSAGE, "field": FIELD}, where
+// field is the parameter or key of the request causing the
+// error, if any.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+}
+
+// Error implements the error interface.
+func (e APIError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("%s: %s", e.Field, e.Message)
+	}
+	return e.Message
+}
+
+// statusError returns the APIError of a response
+// with the status code and no specific error.
+func statusError(code int) APIError {
+	text := http.StatusText(code)
+	if text == "" {
+		text = "Error"
+	}
+	return APIError{
+		Code:    strings.Replace(strings.ToLower(text), " ", "_", -1),
+		Message: text,
+	}
+}
+
+// validateName returns an APIError of the field if the name of a
+// Database, Stack or consumer group is not between 1 and MaxNameLength
+// characters long, starting with a letter or digit and followed by
+// letters, digits, '.', '_' or '-'. Names with other characters could
+// not be used in URLs unescaped, nor as a tenant namespace.
+func validateName(field, name string) error {
+	if name == "" {
+		return APIError{Code: codeInvalidName, Message: "missing name", Field: field}
+	}
+	if len(name) > MaxNameLength {
+		return APIError{Code: codeInvalidName, Field: field,
+			Message: fmt.Sprintf("name must be at most %d characters long", MaxNameLength)}
+	}
+	for i, c := range name {
+		if isAlphanumeric(c) || i > 0 && (c == '.' || c == '_' || c == '-') {
+			continue
+		}
+		return APIError{Code: codeInvalidName, Field: field,
+			Message: fmt.Sprintf("invalid name %q, must start with a letter or digit, followed by letters, digits, '.', '_' or '-'", name)}
+	}
+	return nil
+}
+
+// isAlphanumeric determines whether c is an ASCII letter or digit.
+func isAlphanumeric(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// jsonError returns the APIError of the field of a malformed
+// JSON body, given the error on decoding it.
+func jsonError(field string, err error) APIError {
+	message := err.Error()
+	switch e := err.(type) {
+	case APIError:
+		return e
+	case *json.SyntaxError:
+		message = fmt.Sprintf("%v at offset %d", e, e.Offset)
+	case *json.UnmarshalTypeError:
+		message = fmt.Sprintf("%v at offset %d", e, e.Offset)
+	}
+	return APIError{Code: codeMalformedJSON, Message: message, Field: field}
+}
+
+// writeError writes the APIError err into the response
+// with the status code, logging it along with r.
+func writeError(w http.ResponseWriter, r *http.Request, code int, err error) {
+	e, ok := err.(APIError)
+	if !ok {
+		e = statusError(code)
+		e.Message = err.Error()
+	}
+	logResponse(r, code, "error", e)
+
+	// Do not check error as an APIError
+	// is always valid for a JSON encoding.
+	b, _ := json.Marshal(e)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+// ErrorMiddleware writes the APIError of the status code into the
+// responses of the handler with an error status code and no body,
+// so every error response has a body like the ones of writeError.
+func ErrorMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ew := &errorResponseWriter{ResponseWriter: w}
+			next.ServeHTTP(ew, r)
+			ew.close(r)
+		})
+	}
+}
+
+// errorResponseWriter wraps an http.ResponseWriter holding back
+// error status codes written without a Content-Type until the
+// first write, so the body is written on close if there is none.
+type errorResponseWriter struct {
+	http.ResponseWriter
+	code int
+
+	// started is set once the header is written
+	started bool
+}
+
+// WriteHeader writes the status code, or records it
+// if it is an error status code without Content-Type.
+func (w *errorResponseWriter) WriteHeader(code int) {
+	if w.started || w.code != 0 {
+		return
+	}
+	if code < http.StatusBadRequest || w.Header().Get("Content-Type") != "" {
+		w.started = true
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.code = code
+}
+
+// Write writes the recorded status code, if
+// any, along with the first bytes, and b.
+func (w *errorResponseWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		if w.code != 0 {
+			w.ResponseWriter.WriteHeader(w.code)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// close writes the APIError of the recorded
+// status code if nothing was written.
+func (w *errorResponseWriter) close(r *http.Request) {
+	if w.started || w.code == 0 {
+		return
+	}
+	w.started = true
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.code)
+	if r.Method == "HEAD" {
+		return
+	}
+	// Do not check error as an APIError
+	// is always valid for a JSON encoding.
+	b, _ := json.Marshal(statusError(w.code))
+	w.ResponseWriter.Write(b)
+}
+
+// Hijack lets the handler take over the connection, e.g. to
+// upgrade it to a WebSocket connection.
+func (w *errorResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	w.started = true
+	return hj.Hijack()
+}
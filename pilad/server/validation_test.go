@@ -0,0 +1,213 @@
+package server
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestValidateName(t *testing.T) {
+	inputOutput := []struct {
+		input string
+		valid bool
+	}{
+		{"db", true},
+		{"my-db_1.0", true},
+		{"0db", true},
+		{strings.Repeat("a", MaxNameLength), true},
+		{"", false},
+		{strings.Repeat("a", MaxNameLength+1), false},
+		{"-db", false},
+		{"_db", false},
+		{".", false},
+		{"..", false},
+		{"my db", false},
+		{"my/db", false},
+		{"ac:me", false},
+		{"db%2F", false},
+		{"ñ", false},
+		{"db\n", false},
+	}
+
+	for _, io := range inputOutput {
+		err := validateName("name", io.input)
+		if (err == nil) != io.valid {
+			t.Errorf("err is %v for %q, expected valid %v", err, io.input, io.valid)
+		}
+		if e, ok := err.(APIError); err != nil && (!ok || e.Code != codeInvalidName || e.Field != "name") {
+			t.Errorf("err is %#v, expected an APIError of code %s", err, codeInvalidName)
+		}
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	inputOutput := []struct {
+		input  int
+		output APIError
+	}{
+		{http.StatusBadRequest, APIError{Code: "bad_request", Message: "Bad Request"}},
+		{http.StatusGone, APIError{Code: "gone", Message: "Gone"}},
+		{statusClientClosedRequest, APIError{Code: "error", Message: "Error"}},
+	}
+
+	for _, io := range inputOutput {
+		if e := statusError(io.input); e != io.output {
+			t.Errorf("APIError is %v, expected %v", e, io.output)
+		}
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path, body string
+		code               int
+		output             APIError
+	}{
+		{"PUT", "/databases?name=my%20db", "", http.StatusBadRequest, APIError{Code: codeInvalidName, Field: "name"}},
+		{"PUT", "/databases?name=", "", http.StatusBadRequest, APIError{Code: codeInvalidName, Message: "missing name", Field: "name"}},
+		{"PUT", "/databases/db/stacks?name=..", "", http.StatusBadRequest, APIError{Code: codeInvalidName, Field: "name"}},
+		{"PUT", "/databases/db/stacks/stack/_groups?name=a%2Fb", "", http.StatusBadRequest, APIError{Code: codeInvalidName, Field: "name"}},
+		{"PATCH", "/databases/db", `{"name":"ac:me"}`, http.StatusBadRequest, APIError{Code: codeInvalidName, Field: "name"}},
+		{"PATCH", "/databases/db/stacks/stack", `{"name":`, http.StatusBadRequest, APIError{Code: codeMalformedJSON, Field: "name"}},
+		{"POST", "/databases/db/stacks/stack", `{"element":}`, http.StatusBadRequest, APIError{Code: codeMalformedJSON, Field: "element"}},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, strings.NewReader(io.body))
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if ct := response.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type is %q, expected %q", ct, "application/json")
+		}
+		var e APIError
+		if err := json.Unmarshal(response.Body.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Code != io.output.Code || e.Field != io.output.Field || e.Message == "" ||
+			io.output.Message != "" && e.Message != io.output.Message {
+			t.Errorf("error is %v, expected %v for %s %s", e, io.output, io.method, io.path)
+		}
+	}
+
+	if len(conn.Pila.Databases) != 1 || len(db.Stacks) != 1 || db.Name != "db" || stack.Name != "stack" {
+		t.Errorf("invalid requests modified the pila: %v", conn.Pila.Status())
+	}
+}
+
+func TestValidationErrors_Tenant(t *testing.T) {
+	conn := NewConn()
+	_ = conn.Tenants.Add(Tenant{Name: "acme"})
+	_ = conn.Auth.Add(Token{Token: "acme", Role: RoleAdmin, Tenant: "acme"})
+	handler := AuthMiddleware(conn)(TenantMiddleware(conn)(Router(conn)))
+
+	inputOutput := []struct {
+		path string
+		code int
+	}{
+		{"/databases?name=db", http.StatusCreated},
+		{"/databases?name=-db", http.StatusBadRequest},
+		{"/databases?name=acme:db", http.StatusBadRequest},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest("PUT", io.path, nil)
+		request.Header.Set("Authorization", "Bearer acme")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, io.code, io.path)
+		}
+	}
+}
+
+func TestErrorMiddleware(t *testing.T) {
+	handler := ErrorMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/empty":
+			w.WriteHeader(http.StatusGone)
+		case "/body":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("bad"))
+		case "/typed":
+			http.Error(w, "not found", http.StatusNotFound)
+		case "/api":
+			writeError(w, r, http.StatusConflict, APIError{Code: "conflict", Message: "exists"})
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+
+	inputOutput := []struct {
+		method, path string
+		code         int
+		output       string
+	}{
+		{"GET", "/empty", http.StatusGone, `{"code":"gone","message":"Gone"}`},
+		{"HEAD", "/empty", http.StatusGone, ""},
+		{"GET", "/body", http.StatusBadRequest, "bad"},
+		{"GET", "/typed", http.StatusNotFound, "not found\n"},
+		{"GET", "/api", http.StatusConflict, `{"code":"conflict","message":"exists"}`},
+		{"GET", "/ok", http.StatusOK, "ok"},
+	}
+
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if response.Body.String() != io.output {
+			t.Errorf("body is %q, expected %q for %s %s", response.Body.String(), io.output, io.method, io.path)
+		}
+	}
+}
+
+func TestPushStackHandler_Fuzz(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	_ = db.AddStack(pila.NewStack("stack", time.Now().UTC()))
+	handler := ErrorMiddleware()(Router(conn))
+
+	// arbitrary bodies, mostly made of JSON tokens, are either
+	// pushed or rejected with an APIError, never panicking
+	tokens := []string{`{`, `}`, `[`, `]`, `"element"`, `:`, `,`, `"`, `null`, `1e999`, `-`, `\u00`, "\x00", `true`, `"priority"`, `"tag"`}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		var body []string
+		for j := r.Intn(12); j > 0; j-- {
+			body = append(body, tokens[r.Intn(len(tokens))])
+		}
+		request, _ := http.NewRequest("POST", "/databases/db/stacks/stack", strings.NewReader(strings.Join(body, "")))
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code == http.StatusOK {
+			continue
+		}
+		var e APIError
+		if err := json.Unmarshal(response.Body.Bytes(), &e); err != nil || e.Code == "" {
+			t.Errorf("response to %q is %v %s, expected an APIError", strings.Join(body, ""), response.Code, response.Body.String())
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+)
+
+// popWait returns the duration given by the wait parameter of a request
+// popping a Stack, 0 if none is given. It must be shorter than max, so
+// the response is written before the write timeout.
+func popWait(r *http.Request, max time.Duration) (time.Duration, error) {
+	_ = r.ParseForm()
+
+	values, ok := r.Form["wait"]
+	if !ok {
+		return 0, nil
+	}
+	wait, err := time.ParseDuration(values[0])
+	if err != nil || wait < 0 {
+		return 0, fmt.Errorf("invalid wait %q", values[0])
+	}
+	if wait >= max {
+		return 0, fmt.Errorf("wait %s must be shorter than %s", wait, max)
+	}
+	return wait, nil
+}
+
+// isBlockingPop returns true if the request pops a Stack, or any
+// of several ones, waiting for an element to be pushed into it.
+func isBlockingPop(r *http.Request) bool {
+	query := r.URL.Query()
+	if r.Method != "DELETE" || query.Get("wait") == "" {
+		return false
+	}
+	if _, ok := query["flush"]; ok {
+		return false
+	}
+	if _, ok := query["full"]; ok {
+		return false
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 3 && parts[0] == "databases" && parts[2] == "_popany" {
+		return true
+	}
+	if len(parts) == 5 && parts[4] == "pop" {
+		parts = parts[:4]
+	}
+	return len(parts) == 4 && parts[0] == "databases" && parts[2] == "stacks"
+}
+
+// popWaitStackHandler pops the Stack, waiting up to wait for an element
+// to be pushed if it is empty. The Replication writes, and the writes of
+// the Raft leader, are held only while popping, so waiting blocks neither
+// the writes nor the followers, nor the reads of the Raft leader.
+// Waiting can be cancelled as an operation in flight.
+func (c *Conn) popWaitStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack, wait time.Duration) {
+	now := requestDate(r)
+	ctx, done := c.Operations.Start(r, "pop", databaseFromContext(r), stack)
+	defer done()
+
+	pushed, stop := stack.Pushed()
+	defer stop()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	rr := raftRequestFromContext(r)
+	for {
+		rr.hold()
+		c.Replication.writes.RLock()
+		unlock := c.stackLocks.lock(stack)
+		value, ok := stack.Pop()
+		if ok {
+			stack.Update(now)
+			c.persistStack(r.Context(), stack, persist.Record{Op: persist.OpPop, Time: now})
+		}
+		unlock()
+		c.Replication.writes.RUnlock()
+		rr.release()
+
+		if ok {
+			c.writeElement(w, r, value)
+			return
+		}
+
+		select {
+		case <-pushed:
+			continue
+		case <-timer.C:
+		case <-ctx.Done():
+		case <-c.Shutdown.Requested():
+		}
+		logResponse(r, http.StatusNoContent)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestPopWait(t *testing.T) {
+	inputOutput := []struct {
+		query string
+		wait  time.Duration
+		ok    bool
+	}{
+		{"", 0, true},
+		{"wait=0s", 0, true},
+		{"wait=1500ms", 1500 * time.Millisecond, true},
+		{"wait=30s", 0, false},
+		{"wait=-1s", 0, false},
+		{"wait=30", 0, false},
+		{"wait=", 0, false},
+	}
+
+	for _, io := range inputOutput {
+		r, _ := http.NewRequest("DELETE", "/databases/db/stacks/stack?"+io.query, nil)
+		wait, err := popWait(r, 30*time.Second)
+		if wait != io.wait || (err == nil) != io.ok {
+			t.Errorf("wait is %v and %v, expected %v and ok %v for %q", wait, err, io.wait, io.ok, io.query)
+		}
+	}
+}
+
+func TestIsBlockingPop(t *testing.T) {
+	inputOutput := []struct {
+		method, url string
+		output      bool
+	}{
+		{"DELETE", "/databases/db/stacks/stack?wait=1s", true},
+		{"DELETE", "/databases/db/stacks/stack/pop?wait=1s", true},
+		{"DELETE", "/databases/db/stacks/stack", false},
+		{"DELETE", "/databases/db/stacks/stack?wait=1s&flush", false},
+		{"DELETE", "/databases/db/stacks/stack?wait=1s&full", false},
+		{"DELETE", "/databases/db?wait=1s", false},
+		{"DELETE", "/databases/db/stacks/stack/flush?wait=1s", false},
+		{"POST", "/databases/db/stacks/stack?wait=1s", false},
+		{"DELETE", "/databases/db/_popany?stacks=a,b&wait=1s", true},
+		{"DELETE", "/databases/db/_popany?stacks=a,b", false},
+	}
+
+	for _, io := range inputOutput {
+		r, _ := http.NewRequest(io.method, io.url, nil)
+		if output := isBlockingPop(r); output != io.output {
+			t.Errorf("blocking pop is %v, expected %v for %s %s", output, io.output, io.method, io.url)
+		}
+	}
+}
+
+func TestPopStackHandler_Wait(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	handler := ReplicationMiddleware(conn)(Router(conn))
+
+	pop := func(query string) *httptest.ResponseRecorder {
+		request, err := http.NewRequest("DELETE", "/databases/db/stacks/stack?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	for _, query := range []string{"wait=x", "wait=1h", "wait=1s&if_version=0"} {
+		if response := pop(query); response.Code != http.StatusBadRequest {
+			t.Errorf("response code is %v, expected %v for %s", response.Code, http.StatusBadRequest, query)
+		}
+	}
+
+	start := time.Now()
+	if response := pop("wait=20ms"); response.Code != http.StatusNoContent {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusNoContent)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("elapsed time is %v, expected at least %v", elapsed, 20*time.Millisecond)
+	}
+
+	responses := make(chan *httptest.ResponseRecorder)
+	go func() {
+		responses <- pop("wait=5s")
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// the writes are not held while waiting
+	conn.Replication.writes.Lock()
+	conn.Replication.writes.Unlock()
+
+	_ = stack.Push("foo")
+	response := <-responses
+	if response.Code != http.StatusOK || response.Body.String() != `{"element":"foo"}` {
+		t.Errorf("response is %v %s, expected %v %s", response.Code, response.Body, http.StatusOK, `{"element":"foo"}`)
+	}
+	if stack.Size() != 0 || stack.Pops() != 1 {
+		t.Errorf("stack has size %d and %d pops, expected %d and %d", stack.Size(), stack.Pops(), 0, 1)
+	}
+
+	go func() {
+		responses <- pop("wait=5s")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	conn.Shutdown.Request()
+	if response := <-responses; response.Code != http.StatusNoContent {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusNoContent)
+	}
+}
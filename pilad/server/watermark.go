@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// watermarksParams returns the Watermarks given by the high_watermark
+// and low_watermark parameters of a request, being pila.NoWatermark
+// the ones not present.
+func watermarksParams(r *http.Request) (pila.Watermarks, error) {
+	w := pila.Watermarks{High: pila.NoWatermark, Low: pila.NoWatermark}
+	for _, param := range []struct {
+		key string
+		min int
+		v   *int
+	}{
+		{"high_watermark", 1, &w.High},
+		{"low_watermark", 0, &w.Low},
+	} {
+		value := r.FormValue(param.key)
+		if value == "" {
+			continue
+		}
+		i, err := strconv.Atoi(value)
+		if err != nil || i < param.min {
+			return w, fmt.Errorf("%s must be an integer not lower than %d", param.key, param.min)
+		}
+		*param.v = i
+	}
+	if w.Validate() != nil {
+		return w, fmt.Errorf("high_watermark must be greater than low_watermark")
+	}
+	return w, nil
+}
+
+// watermarksRecord returns the Watermarks of a Stack
+// to persist, nil if it has none.
+func watermarksRecord(stack *pila.Stack) *pila.Watermarks {
+	if w, ok := stack.Watermarks(); ok {
+		return &w
+	}
+	return nil
+}
+
+// watermarksStackHandler returns the Watermarks of the Stack, being -1
+// the disabled ones, and replaces them on PUT with the ones given by the
+// high_watermark and low_watermark parameters, removing them if none is
+// given. Returns 400 if they are not valid.
+func (c *Conn) watermarksStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	if r.Method == "PUT" {
+		watermarks, err := watermarksParams(r)
+		if err != nil {
+			logResponse(r, http.StatusBadRequest, "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		unlock := c.stackLocks.lock(stack)
+		// Do not check error as the watermarks are already validated.
+		_ = stack.SetWatermarks(watermarks)
+		c.persistStack(r.Context(), stack, persist.Record{Op: persist.OpSetWatermarks, Time: requestDate(r), Watermarks: watermarksRecord(stack)})
+		unlock()
+	}
+
+	watermarks, _ := stack.Watermarks()
+	// Do not check error as Watermarks do not
+	// contain types that could cause such case.
+	b, _ := json.Marshal(watermarks)
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(b)
+}
+
+// watermarkAlert logs an alert when the size of a Stack crosses
+// one of its Watermarks. Webhooks registered with the high_watermark
+// and low_watermark operations are called too, on their own.
+func watermarkAlert(db *pila.Database, stack *pila.Stack, e pila.Event) {
+	w, _ := stack.Watermarks()
+	watermark := w.High
+	if e.Op == pila.EventLowWatermark {
+		watermark = w.Low
+	}
+	logger.Warn("stack crossed "+string(e.Op), "database", db.Name, "stack", stack.Name, "size", e.Element, "watermark", watermark)
+}
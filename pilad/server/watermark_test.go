@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+func TestWatermarksStackHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"PUT", "/databases/db/stacks?name=stack&high_watermark=0", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks?name=stack&low_watermark=-1", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks?name=stack&high_watermark=2&low_watermark=2", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks?name=stack&high_watermark=foo", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks?name=stack&high_watermark=10&low_watermark=0", http.StatusCreated, ""},
+		{"GET", "/databases/db/stacks/stack/_watermarks", http.StatusOK, `{"high":10,"low":0}`},
+		{"PUT", "/databases/db/stacks/stack/_watermarks?high_watermark=3", http.StatusOK, `{"high":3,"low":-1}`},
+		{"PUT", "/databases/db/stacks/stack/_watermarks?low_watermark=5&high_watermark=4", http.StatusBadRequest, ""},
+		{"GET", "/databases/db/stacks/stack/_watermarks", http.StatusOK, `{"high":3,"low":-1}`},
+		{"PUT", "/databases/db/stacks/stack/_watermarks", http.StatusOK, `{"high":-1,"low":-1}`},
+		{"PUT", "/databases/db/stacks/stack/_watermarks?low_watermark=1", http.StatusOK, `{"high":-1,"low":1}`},
+		{"GET", "/databases/db/stacks/foo/_watermarks", http.StatusGone, ""},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if body := response.Body.String(); io.body != "" && body != io.body {
+			t.Errorf("body is %s, expected %s for %s %s", body, io.body, io.method, io.path)
+		}
+	}
+
+	stack, _ := db.StackByName("stack")
+	if w := stack.Status().Watermarks; w == nil || *w != (pila.Watermarks{High: pila.NoWatermark, Low: 1}) {
+		t.Errorf("stack watermarks are %v, expected %v", w, pila.Watermarks{High: pila.NoWatermark, Low: 1})
+	}
+}
+
+func TestWatermarkAlert(t *testing.T) {
+	var buf bytes.Buffer
+	logger.Default().SetOutput(&buf)
+	defer logger.Default().SetOutput(os.Stderr)
+
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = stack.SetWatermarks(pila.Watermarks{High: 2, Low: 0})
+	_ = db.AddStack(stack)
+
+	stack.Push("foo")
+	stack.Push("bar")
+	stack.Flush()
+
+	for _, expected := range []string{
+		"stack crossed high_watermark database=db stack=stack size=2 watermark=2",
+		"stack crossed low_watermark database=db stack=stack size=0 watermark=0",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("log is %s, expected to contain %s", buf.String(), expected)
+		}
+	}
+}
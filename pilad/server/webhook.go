@@ -0,0 +1,413 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+	"github.com/fern4lvarez/piladb/pkg/uuid"
+	"github.com/gorilla/mux"
+)
+
+// webhookBuffer is the number of events of a stack waiting to be
+// delivered to a webhook. Events are dropped while the buffer of a
+// slow webhook is full, so producers are never blocked.
+const webhookBuffer = 256
+
+// webhookAttempts is the number of times the delivery of
+// an event to a webhook is attempted before it is failed.
+const webhookAttempts = 5
+
+// webhookBackoff is the waiting time before the first retry of a
+// delivery, which is doubled on every following retry.
+var webhookBackoff = 500 * time.Millisecond
+
+// defaultWebhookOps are the operations delivered to a
+// webhook registered without a list of operations.
+var defaultWebhookOps = []pila.EventOp{pila.EventPush, pila.EventPop, pila.EventFlush}
+
+// errWebhookExists is returned when registering a webhook
+// with a URL that is already registered on the stack.
+var errWebhookExists = errors.New("webhook already exists")
+
+// Webhook represents a URL called with the events of a stack,
+// along with the status of the deliveries.
+type Webhook struct {
+	ID        string         `json:"id"`
+	URL       string         `json:"url"`
+	Ops       []pila.EventOp `json:"ops"`
+	CreatedAt time.Time      `json:"created_at"`
+	// Delivered is the number of events delivered
+	Delivered int64 `json:"delivered"`
+	// Failed is the number of events not delivered
+	// after webhookAttempts attempts
+	Failed int64 `json:"failed"`
+	// Dropped is the number of events discarded
+	// while too many were waiting
+	Dropped int64 `json:"dropped"`
+	// Pending is the number of events waiting to be delivered
+	Pending int `json:"pending"`
+	// LastStatus is the HTTP status code of the
+	// last attempt, 0 if it got no response
+	LastStatus int `json:"last_status,omitempty"`
+	// LastError is the error of the last attempt, if it failed
+	LastError     string     `json:"last_error,omitempty"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+}
+
+// WebhookPayload is the JSON body POSTed to a webhook on every event.
+// Database and Stack are the names of the database and stack at the
+// time the webhook was registered.
+type WebhookPayload struct {
+	Hook     string       `json:"hook"`
+	Database string       `json:"database"`
+	Stack    string       `json:"stack"`
+	Op       pila.EventOp `json:"op"`
+	pila.Element
+	Time time.Time `json:"time"`
+}
+
+// hook is a registered Webhook delivering
+// the events of a stack in order.
+type hook struct {
+	payloads    chan WebhookPayload
+	quit        chan struct{}
+	unsubscribe func()
+
+	// mu protects the access to status
+	mu     sync.Mutex
+	status Webhook
+}
+
+// Webhooks contains the webhooks registered on the stacks.
+// Webhooks are not persisted, and are removed along with
+// their stack.
+type Webhooks struct {
+	client *http.Client
+
+	// mu protects the access to hooks
+	mu    sync.RWMutex
+	hooks map[*pila.Stack]map[string]*hook
+}
+
+// NewWebhooks returns a new Webhooks without webhooks.
+func NewWebhooks() *Webhooks {
+	return &Webhooks{
+		client: &http.Client{Timeout: 5 * time.Second},
+		hooks:  make(map[*pila.Stack]map[string]*hook),
+	}
+}
+
+// Add registers a webhook calling rawURL with the events of stack
+// whose operation is one of ops, and returns its status. It returns
+// errWebhookExists if rawURL is already registered on stack.
+func (wh *Webhooks) Add(db *pila.Database, stack *pila.Stack, rawURL string, ops []pila.EventOp, t time.Time) (Webhook, error) {
+	id := uuid.New(stack.ID.String() + rawURL).String()
+	dbName, stackName := db.Name, stack.Name
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if _, ok := wh.hooks[stack][id]; ok {
+		return Webhook{}, errWebhookExists
+	}
+	if wh.hooks[stack] == nil {
+		wh.hooks[stack] = make(map[string]*hook)
+	}
+
+	h := &hook{
+		payloads: make(chan WebhookPayload, webhookBuffer),
+		quit:     make(chan struct{}),
+		status:   Webhook{ID: id, URL: rawURL, Ops: ops, CreatedAt: t},
+	}
+	h.unsubscribe = stack.Subscribe(func(e pila.Event) {
+		if !containsOp(ops, e.Op) {
+			return
+		}
+		payload := WebhookPayload{
+			Hook:     id,
+			Database: dbName,
+			Stack:    stackName,
+			Op:       e.Op,
+			Element:  pila.NewElement(e.Element),
+			Time:     time.Now().UTC(),
+		}
+		select {
+		case h.payloads <- payload:
+		default:
+			h.mu.Lock()
+			h.status.Dropped++
+			h.mu.Unlock()
+		}
+	})
+	go h.run(wh.client)
+
+	wh.hooks[stack][id] = h
+	return h.Status(), nil
+}
+
+// Remove removes a webhook of stack given its id, discarding the
+// events not delivered yet. It returns false if it did not exist.
+func (wh *Webhooks) Remove(stack *pila.Stack, id string) bool {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	h, ok := wh.hooks[stack][id]
+	if !ok {
+		return false
+	}
+	h.stop()
+	delete(wh.hooks[stack], id)
+	if len(wh.hooks[stack]) == 0 {
+		delete(wh.hooks, stack)
+	}
+	return true
+}
+
+// RemoveStack removes all the webhooks of stack.
+func (wh *Webhooks) RemoveStack(stack *pila.Stack) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	for _, h := range wh.hooks[stack] {
+		h.stop()
+	}
+	delete(wh.hooks, stack)
+}
+
+// Webhook returns the status of a webhook of stack
+// given its id, or false if it does not exist.
+func (wh *Webhooks) Webhook(stack *pila.Stack, id string) (Webhook, bool) {
+	wh.mu.RLock()
+	defer wh.mu.RUnlock()
+
+	h, ok := wh.hooks[stack][id]
+	if !ok {
+		return Webhook{}, false
+	}
+	return h.Status(), true
+}
+
+// Webhooks returns the status of all the
+// webhooks of stack, sorted by URL.
+func (wh *Webhooks) Webhooks(stack *pila.Stack) []Webhook {
+	wh.mu.RLock()
+	defer wh.mu.RUnlock()
+
+	hooks := make(webhooksByURL, 0, len(wh.hooks[stack]))
+	for _, h := range wh.hooks[stack] {
+		hooks = append(hooks, h.Status())
+	}
+	sort.Sort(hooks)
+	return hooks
+}
+
+// Status returns the status of the webhook.
+func (h *hook) Status() Webhook {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := h.status
+	status.Pending = len(h.payloads)
+	return status
+}
+
+// stop unsubscribes the webhook from its stack
+// and stops delivering events.
+func (h *hook) stop() {
+	h.unsubscribe()
+	close(h.quit)
+}
+
+// run delivers the events of the webhook one at a time, so
+// they are received in order, until the webhook is stopped.
+func (h *hook) run(client *http.Client) {
+	for {
+		select {
+		case payload := <-h.payloads:
+			h.deliver(client, payload)
+		case <-h.quit:
+			return
+		}
+	}
+}
+
+// deliver POSTs payload to the webhook, retrying with exponential
+// backoff up to webhookAttempts times until it succeeds.
+func (h *hook) deliver(client *http.Client, payload WebhookPayload) {
+	// Do not check error as a payload built
+	// from a pushed element is always valid.
+	body, _ := json.Marshal(payload)
+
+	backoff := webhookBackoff
+	for attempt := 0; attempt < webhookAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-h.quit:
+				return
+			}
+			backoff *= 2
+		}
+
+		code, err := h.post(client, body)
+		now := time.Now().UTC()
+
+		h.mu.Lock()
+		h.status.LastStatus = code
+		h.status.LastError = ""
+		h.status.LastAttemptAt = &now
+		if err != nil {
+			h.status.LastError = err.Error()
+		} else {
+			h.status.Delivered++
+		}
+		h.mu.Unlock()
+
+		if err == nil {
+			return
+		}
+	}
+
+	logger.Warn("failed to deliver webhook event", "url", h.status.URL, "op", payload.Op)
+	h.mu.Lock()
+	h.status.Failed++
+	h.mu.Unlock()
+}
+
+// post sends body to the URL of the webhook, and returns the status
+// code of the response and an error if it is not successful.
+func (h *hook) post(client *http.Client, body []byte) (int, error) {
+	res, err := client.Post(h.status.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// containsOp determines whether op is one of ops.
+func containsOp(ops []pila.EventOp, op pila.EventOp) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookOps parses a comma-separated list of operations,
+// returning defaultWebhookOps if it is empty.
+func webhookOps(s string) ([]pila.EventOp, error) {
+	if s == "" {
+		return defaultWebhookOps, nil
+	}
+
+	var ops []pila.EventOp
+	for _, op := range strings.Split(s, ",") {
+		switch o := pila.EventOp(strings.TrimSpace(op)); o {
+		case pila.EventPush, pila.EventPop, pila.EventFlush, pila.EventRotate, pila.EventSweep, pila.EventReverse, pila.EventSort, pila.EventHighWatermark, pila.EventLowWatermark:
+			if !containsOp(ops, o) {
+				ops = append(ops, o)
+			}
+		default:
+			return nil, fmt.Errorf("unknown operation %q", op)
+		}
+	}
+	return ops, nil
+}
+
+// webhooksByURL implements sort.Interface to sort Webhooks by URL.
+type webhooksByURL []Webhook
+
+func (w webhooksByURL) Len() int           { return len(w) }
+func (w webhooksByURL) Swap(i, j int)      { w[i], w[j] = w[j], w[i] }
+func (w webhooksByURL) Less(i, j int) bool { return w[i].URL < w[j].URL }
+
+// webhooksStackHandler lists the webhooks of a stack along with the
+// status of their deliveries on GET, and registers a new one on PUT.
+func (c *Conn) webhooksStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	if r.Method == "PUT" {
+		c.addWebhookHandler(w, r, stack)
+		return
+	}
+
+	// Do not check error as a list of Webhooks
+	// is always valid for a JSON encoding.
+	b, _ := json.Marshal(map[string][]Webhook{"hooks": c.Webhooks.Webhooks(stack)})
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(b)
+}
+
+// addWebhookHandler registers the webhook given by the url and
+// ops parameters on the stack, and returns its status.
+func (c *Conn) addWebhookHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	rawURL := r.FormValue("url")
+	if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		logResponse(r, http.StatusBadRequest, "reason", "invalid url", "url", rawURL)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ops, err := webhookOps(r.FormValue("ops"))
+	if err != nil {
+		logResponse(r, http.StatusBadRequest, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	hook, err := c.Webhooks.Add(databaseFromContext(r), stack, rawURL, ops, requestDate(r))
+	if err != nil {
+		logResponse(r, http.StatusConflict, "error", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	b, _ := json.Marshal(hook)
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusCreated)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(b)
+}
+
+// webhookStackHandler returns the status of the webhook given in
+// the URL on GET, and removes it on DELETE.
+func (c *Conn) webhookStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	id := mux.Vars(r)["hook_id"]
+
+	if r.Method == "DELETE" {
+		if !c.Webhooks.Remove(stack, id) {
+			c.goneHandler(w, r, "webhook is Gone")
+			return
+		}
+		logResponse(r, http.StatusNoContent)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	hook, ok := c.Webhooks.Webhook(stack, id)
+	if !ok {
+		c.goneHandler(w, r, "webhook is Gone")
+		return
+	}
+
+	b, _ := json.Marshal(hook)
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(b)
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+// webhookReceiver records the payloads POSTed to a webhook,
+// failing the first failures requests.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	failures int
+	payloads []WebhookPayload
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if wr.failures > 0 {
+		wr.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	var payload WebhookPayload
+	_ = json.Unmarshal(body, &payload)
+	wr.payloads = append(wr.payloads, payload)
+}
+
+func (wr *webhookReceiver) ops() []pila.EventOp {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	ops := make([]pila.EventOp, len(wr.payloads))
+	for i, payload := range wr.payloads {
+		ops[i] = payload.Op
+	}
+	return ops
+}
+
+// waitWebhook waits until the webhook of stack given by id
+// has no pending events, or fails after a second.
+func waitWebhook(t *testing.T, conn *Conn, stack *pila.Stack, id string, delivered int64) Webhook {
+	for i := 0; i < 100; i++ {
+		if hook, _ := conn.Webhooks.Webhook(stack, id); hook.Delivered+hook.Failed >= delivered {
+			return hook
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("webhook %s did not deliver %d events", id, delivered)
+	return Webhook{}
+}
+
+func TestWebhooks(t *testing.T) {
+	defer func(backoff time.Duration) { webhookBackoff = backoff }(webhookBackoff)
+	webhookBackoff = time.Millisecond
+
+	receiver := &webhookReceiver{failures: 2}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	handler := Router(conn)
+
+	hookPath := "/databases/db/stacks/stack/_hooks?url=" + url.QueryEscape(server.URL)
+	inputOutput := []struct {
+		method, path string
+		code         int
+	}{
+		{"PUT", hookPath, http.StatusCreated},
+		{"PUT", hookPath, http.StatusConflict},
+		{"PUT", "/databases/db/stacks/stack/_hooks?url=ftp://example.com", http.StatusBadRequest},
+		{"PUT", "/databases/db/stacks/stack/_hooks?url=" + url.QueryEscape(server.URL+"/other") + "&ops=push,peek", http.StatusBadRequest},
+		{"PUT", "/databases/db/stacks/nostack/_hooks?url=" + url.QueryEscape(server.URL), http.StatusGone},
+		{"GET", "/databases/db/stacks/stack/_hooks/nohook", http.StatusGone},
+		{"DELETE", "/databases/db/stacks/stack/_hooks/nohook", http.StatusGone},
+	}
+
+	var hook Webhook
+	for _, io := range inputOutput {
+		request, _ := http.NewRequest(io.method, io.path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if response.Code == http.StatusCreated {
+			if err := json.Unmarshal(response.Body.Bytes(), &hook); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if hook.URL != server.URL || !reflect.DeepEqual(hook.Ops, defaultWebhookOps) {
+		t.Errorf("webhook is %v, expected url %s and ops %v", hook, server.URL, defaultWebhookOps)
+	}
+
+	stack.Push("foo")
+	stack.Push("bar")
+	stack.Rotate()
+	stack.Pop()
+	stack.Flush()
+	status := waitWebhook(t, conn, stack, hook.ID, 4)
+
+	expectedOps := []pila.EventOp{pila.EventPush, pila.EventPush, pila.EventPop, pila.EventFlush}
+	if ops := receiver.ops(); !reflect.DeepEqual(ops, expectedOps) {
+		t.Errorf("delivered ops are %v, expected %v", ops, expectedOps)
+	}
+	if status.Delivered != 4 || status.Failed != 0 || status.LastStatus != http.StatusOK || status.LastError != "" {
+		t.Errorf("webhook status is %+v", status)
+	}
+	if payload := receiver.payloads[0]; payload.Hook != hook.ID || payload.Database != "db" || payload.Stack != "stack" || payload.Value != "foo" {
+		t.Errorf("payload is %+v", payload)
+	}
+
+	request, _ := http.NewRequest("GET", "/databases/db/stacks/stack/_hooks", nil)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	var hooks map[string][]Webhook
+	if err := json.Unmarshal(response.Body.Bytes(), &hooks); err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks["hooks"]) != 1 || hooks["hooks"][0].ID != hook.ID {
+		t.Errorf("webhooks are %v, expected %s", hooks, hook.ID)
+	}
+
+	request, _ = http.NewRequest("DELETE", "/databases/db/stacks/stack/_hooks/"+hook.ID, nil)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusNoContent {
+		t.Errorf("response code is %v, expected %v", response.Code, http.StatusNoContent)
+	}
+	if hooks := conn.Webhooks.Webhooks(stack); len(hooks) != 0 {
+		t.Errorf("webhooks are %v, expected none", hooks)
+	}
+}
+
+func TestWebhooks_Failed(t *testing.T) {
+	defer func(backoff time.Duration) { webhookBackoff = backoff }(webhookBackoff)
+	webhookBackoff = time.Millisecond
+
+	receiver := &webhookReceiver{failures: webhookAttempts}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+
+	hook, err := conn.Webhooks.Add(db, stack, server.URL, []pila.EventOp{pila.EventPop}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stack.Push("foo")
+	stack.Pop()
+	stack.Push("bar")
+	stack.Pop()
+
+	status := waitWebhook(t, conn, stack, hook.ID, 2)
+	if status.Failed != 1 || status.Delivered != 1 {
+		t.Errorf("webhook failed and delivered %d and %d events, expected %d and %d", status.Failed, status.Delivered, 1, 1)
+	}
+	if ops := receiver.ops(); !reflect.DeepEqual(ops, []pila.EventOp{pila.EventPop}) {
+		t.Errorf("delivered ops are %v, expected %v", ops, []pila.EventOp{pila.EventPop})
+	}
+
+	conn.Webhooks.RemoveStack(stack)
+	if _, ok := conn.Webhooks.Webhook(stack, hook.ID); ok {
+		t.Error("webhook was not removed")
+	}
+}
+
+func TestWebhookOps(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output []pila.EventOp
+		ok     bool
+	}{
+		{"", defaultWebhookOps, true},
+		{"push", []pila.EventOp{pila.EventPush}, true},
+		{"rotate, sweep,rotate", []pila.EventOp{pila.EventRotate, pila.EventSweep}, true},
+		{"high_watermark,low_watermark", []pila.EventOp{pila.EventHighWatermark, pila.EventLowWatermark}, true},
+		{"push,peek", nil, false},
+	}
+
+	for _, io := range inputOutput {
+		ops, err := webhookOps(io.input)
+		if !reflect.DeepEqual(ops, io.output) || (err == nil) != io.ok {
+			t.Errorf("ops are %v, %v, expected %v for %q", ops, err, io.output, io.input)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+	"github.com/fern4lvarez/piladb/pila/persist"
+	"github.com/fern4lvarez/piladb/pkg/logger"
+)
+
+// windowInterval is the period of time between two
+// checks of the ends of the windows of the stacks.
+const windowInterval = time.Second
+
+// windowArchiveLayout is the layout of the end date appended
+// to the name of the Stack archived when a window closes.
+const windowArchiveLayout = "20060102T150405Z"
+
+// windowResponse is the JSON representation of the Window of a Stack.
+type windowResponse struct {
+	Every    string    `json:"every,omitempty"`
+	Schedule string    `json:"schedule,omitempty"`
+	To       string    `json:"to,omitempty"`
+	Archive  bool      `json:"archive,omitempty"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// windowParams returns the Window given by the every, schedule, to
+// and archive parameters of a request, which has neither a duration
+// nor a schedule if none of them is present.
+func windowParams(r *http.Request) (pila.Window, error) {
+	var w pila.Window
+	if value := r.FormValue("every"); value != "" {
+		every, err := time.ParseDuration(value)
+		if err != nil || every <= 0 {
+			return w, fmt.Errorf("every must be a positive duration, got %s", value)
+		}
+		w.Every = every
+	}
+	w.Schedule = r.FormValue("schedule")
+	w.To = r.FormValue("to")
+
+	archive, err := boolParam(r, "archive")
+	if err != nil {
+		return w, err
+	}
+	w.Archive = archive
+	return w, nil
+}
+
+// windowRecord returns the Window of a Stack
+// to persist, nil if it has none.
+func windowRecord(stack *pila.Stack) *pila.Window {
+	if w, _, ok := stack.Window(); ok {
+		return &w
+	}
+	return nil
+}
+
+// windowStackHandler returns the Window of the Stack and the end of
+// its current window, and replaces it on PUT with the one given by the
+// every or schedule, to and archive parameters, removing it if neither
+// every nor schedule is given. Returns 400 if it is not valid, and 409
+// if archive is requested but the Archives are disabled.
+func (c *Conn) windowStackHandler(w http.ResponseWriter, r *http.Request, stack *pila.Stack) {
+	if r.Method == "PUT" {
+		window, err := windowParams(r)
+		if err != nil {
+			logResponse(r, http.StatusBadRequest, "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if window.Archive && !c.Archives.Enabled() {
+			logResponse(r, http.StatusConflict, "error", ErrArchivesDisabled)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		unlock := c.stackLocks.lock(stack)
+		if err := stack.SetWindow(window); err != nil {
+			unlock()
+			logResponse(r, http.StatusBadRequest, "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c.persistStack(r.Context(), stack, persist.Record{Op: persist.OpSetWindow, Time: requestDate(r), Window: windowRecord(stack)})
+		unlock()
+	}
+
+	var res windowResponse
+	if window, end, ok := stack.Window(); ok {
+		res = windowResponse{
+			Schedule: window.Schedule,
+			To:       window.To,
+			Archive:  window.Archive,
+			EndsAt:   end.UTC(),
+		}
+		if window.Every > 0 {
+			res.Every = window.Every.String()
+		}
+	}
+	// Do not check error as a windowResponse is
+	// always valid for a JSON encoding.
+	b, _ := json.Marshal(res)
+
+	w.Header().Set("Content-Type", "application/json")
+	logResponse(r, http.StatusOK)
+	w.Write(b)
+}
+
+// CloseWindows closes the windows of all the stacks that ended at date
+// t, persisting their flushes and the elements pushed into their To
+// stacks, and archiving them if requested. It returns how many windows
+// were closed. Followers do not close windows, as they replicate the
+// ones closed by their primary.
+func (c *Conn) CloseWindows(t time.Time) int {
+	if c.Replication.Primary() != "" {
+		return 0
+	}
+
+	closed := 0
+	for _, s := range c.stacks() {
+		if db := s.Database; db != nil && c.closeWindow(context.Background(), db, s, t) {
+			closed++
+		}
+	}
+	return closed
+}
+
+// closeWindow closes the current window of stack of database
+// db if it ended at date t, and returns whether it did.
+func (c *Conn) closeWindow(ctx context.Context, db *pila.Database, stack *pila.Stack, t time.Time) bool {
+	var to *pila.Stack
+	if window, _, ok := stack.Window(); ok && window.To != "" {
+		to, _ = db.StackByName(window.To)
+	}
+	defer c.stackLocks.lock(stack, to)()
+
+	closed, ok := stack.CloseWindow(t)
+	if !ok {
+		return false
+	}
+	stack.Update(t)
+	c.persistStack(ctx, stack, persist.Record{Op: persist.OpFlush, Time: t})
+
+	if closed.To != nil {
+		if closed.Err != nil {
+			logger.Warn("error on pushing closed window", "database", db.Name, "stack", stack.Name, "to", closed.To.Name, "error", closed.Err)
+		} else {
+			closed.To.Update(t)
+			c.persistStack(ctx, closed.To, persist.Record{Op: persist.OpPush, Time: t, Element: closed.Elements})
+		}
+	}
+
+	if window, _, _ := stack.Window(); window.Archive && len(closed.Elements) > 0 {
+		archived := pila.NewStack(stack.Name+"-"+closed.End.UTC().Format(windowArchiveLayout), closed.End)
+		// Push in reverse so the archived Stack pops
+		// the elements in the same order.
+		for i := len(closed.Elements) - 1; i >= 0; i-- {
+			_ = archived.Push(closed.Elements[i])
+		}
+		if _, err := c.Archives.Archive(db, archived, closed.End); err != nil {
+			logger.Warn("error on archiving closed window", "database", db.Name, "stack", stack.Name, "error", err)
+		}
+	}
+
+	logger.Info("closed window", "database", db.Name, "stack", stack.Name, "count", len(closed.Elements))
+	return true
+}
+
+// WindowScheduler closes the windows of the stacks that
+// ended every interval until stop is closed. It is meant
+// to be run as a goroutine.
+func (c *Conn) WindowScheduler(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case t := <-ticker.C:
+			c.CloseWindows(t)
+		case <-stop:
+			return
+		}
+	}
+}
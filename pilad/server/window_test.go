@@ -0,0 +1,138 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pila"
+)
+
+func TestWindowStackHandler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	_ = db.AddStack(pila.NewStack("stack", time.Now().UTC()))
+	_ = db.AddStack(pila.NewStack("closed", time.Now().UTC()))
+	handler := Router(conn)
+
+	inputOutput := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"GET", "/databases/db/stacks/stack/_window", http.StatusOK, `{"ends_at":"0001-01-01T00:00:00Z"}`},
+		{"PUT", "/databases/db/stacks/stack/_window?every=foo", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks/stack/_window?every=-1h", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks/stack/_window?schedule=foo", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks/stack/_window?every=1h&schedule=@hourly", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks/stack/_window?every=1h&to=stack", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks/stack/_window?every=1h&archive=foo", http.StatusBadRequest, ""},
+		{"PUT", "/databases/db/stacks/stack/_window?every=1h&archive=true", http.StatusConflict, ""},
+		{"PUT", "/databases/db/stacks/stack/_window?every=1h&to=closed", http.StatusOK, `"every":"1h0m0s","to":"closed"`},
+		{"PUT", "/databases/db/stacks/stack/_window?schedule=0+0+*+*+*", http.StatusOK, `"schedule":"0 0 * * *"`},
+		{"GET", "/databases/db/stacks/stack/_window", http.StatusOK, `"schedule":"0 0 * * *"`},
+		{"PUT", "/databases/db/stacks/stack/_window", http.StatusOK, `{"ends_at":"0001-01-01T00:00:00Z"}`},
+		{"GET", "/databases/db/stacks/foo/_window", http.StatusGone, ""},
+	}
+
+	for _, io := range inputOutput {
+		request, err := http.NewRequest(io.method, io.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != io.code {
+			t.Errorf("response code is %v, expected %v for %s %s", response.Code, io.code, io.method, io.path)
+		}
+		if body := response.Body.String(); io.body != "" && !strings.Contains(body, io.body) {
+			t.Errorf("body is %s, expected to contain %s for %s %s", body, io.body, io.method, io.path)
+		}
+	}
+}
+
+func TestConnCloseWindows(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-archives")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conn := NewConn()
+	if err := conn.Archives.Enable(DirArchiveStore(dir)); err != nil {
+		t.Fatal(err)
+	}
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	closed := pila.NewStack("closed", time.Now().UTC())
+	_ = db.AddStack(stack)
+	_ = db.AddStack(closed)
+	_ = stack.SetWindow(pila.Window{Every: time.Hour, To: "closed", Archive: true})
+	_ = stack.Push("foo")
+	_ = stack.Push("bar")
+
+	if n := conn.CloseWindows(time.Now()); n != 0 {
+		t.Errorf("closed windows are %d, expected %d", n, 0)
+	}
+	if n := conn.CloseWindows(time.Now().Add(time.Hour)); n != 1 {
+		t.Errorf("closed windows are %d, expected %d", n, 1)
+	}
+
+	if stack.Size() != 0 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 0)
+	}
+	if value, ok := closed.Pop(); !ok || !reflect.DeepEqual(value, []interface{}{"bar", "foo"}) {
+		t.Errorf("closed window is %v, expected %v", value, []interface{}{"bar", "foo"})
+	}
+	if archived := conn.Archives.Stacks(db); len(archived) != 1 || !strings.HasPrefix(archived[0].Name, "stack-") || archived[0].Size != 2 {
+		t.Errorf("archived stacks are %v, expected one stack-* of size %d", archived, 2)
+	}
+}
+
+func TestConnCloseWindows_Follower(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	_ = stack.SetWindow(pila.Window{Every: time.Minute})
+	_ = stack.Push("foo")
+
+	conn.Replication.Follow("http://127.0.0.1:1")
+	if n := conn.CloseWindows(time.Now().Add(time.Hour)); n != 0 || stack.Size() != 1 {
+		t.Errorf("closed windows are %d and size is %d, expected %d and %d", n, stack.Size(), 0, 1)
+	}
+}
+
+func TestConnWindowScheduler(t *testing.T) {
+	conn := NewConn()
+	db := pila.NewDatabase("db")
+	_ = conn.Pila.AddDatabase(db)
+	stack := pila.NewStack("stack", time.Now().UTC())
+	_ = db.AddStack(stack)
+	_ = stack.SetWindow(pila.Window{Every: time.Millisecond})
+	_ = stack.Push("foo")
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		conn.WindowScheduler(time.Millisecond, stop)
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+	<-done
+
+	if stack.Size() != 0 {
+		t.Errorf("stack size is %d, expected %d", stack.Size(), 0)
+	}
+}
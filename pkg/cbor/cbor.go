@@ -0,0 +1,287 @@
+// Package cbor implements the encoding of CBOR (RFC 7049) values made
+// of null, booleans, integers, floats, text and byte strings, arrays and
+// maps with text keys. Tags are skipped on decoding, and indefinite
+// length items, undefined and other simple values are not supported.
+package cbor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Major types of CBOR data items.
+const (
+	majorUint   = 0
+	majorNegint = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+// maxDepth is the maximum nesting of arrays and maps of a decoded value.
+const maxDepth = 1000
+
+// ErrShortData is returned when the data ends before the value does.
+var ErrShortData = errors.New("cbor: unexpected end of data")
+
+// Marshal returns the CBOR encoding of v, which may be nil, a bool,
+// an integer, a float, a string, a []byte, a []interface{} or a
+// map[string]interface{} of such values.
+func Marshal(v interface{}) ([]byte, error) {
+	return appendValue(nil, v, 0)
+}
+
+func appendValue(b []byte, v interface{}, depth int) ([]byte, error) {
+	if depth > maxDepth {
+		return nil, errors.New("cbor: value is nested too deeply")
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xf6), nil
+	case bool:
+		if v {
+			return append(b, 0xf5), nil
+		}
+		return append(b, 0xf4), nil
+	case int:
+		return appendInt(b, int64(v)), nil
+	case int32:
+		return appendInt(b, int64(v)), nil
+	case int64:
+		return appendInt(b, v), nil
+	case uint:
+		return appendHead(b, majorUint, uint64(v)), nil
+	case uint32:
+		return appendHead(b, majorUint, uint64(v)), nil
+	case uint64:
+		return appendHead(b, majorUint, v), nil
+	case float32:
+		u := math.Float32bits(v)
+		return append(b, 0xfa, byte(u>>24), byte(u>>16), byte(u>>8), byte(u)), nil
+	case float64:
+		b = append(b, 0xfb)
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+		return append(b, buf[:]...), nil
+	case string:
+		b = appendHead(b, majorText, uint64(len(v)))
+		return append(b, v...), nil
+	case []byte:
+		b = appendHead(b, majorBytes, uint64(len(v)))
+		return append(b, v...), nil
+	case []interface{}:
+		b = appendHead(b, majorArray, uint64(len(v)))
+		var err error
+		for _, item := range v {
+			if b, err = appendValue(b, item, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		b = appendHead(b, majorMap, uint64(len(v)))
+		var err error
+		for key, item := range v {
+			b = appendHead(b, majorText, uint64(len(key)))
+			b = append(b, key...)
+			if b, err = appendValue(b, item, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("cbor: unsupported type %T", v)
+}
+
+func appendInt(b []byte, i int64) []byte {
+	if i < 0 {
+		return appendHead(b, majorNegint, uint64(-1-i))
+	}
+	return appendHead(b, majorUint, uint64(i))
+}
+
+// appendHead appends the initial byte of a data item of a major
+// type, followed by its argument in the shortest possible form.
+func appendHead(b []byte, major byte, u uint64) []byte {
+	major <<= 5
+	switch {
+	case u < 24:
+		return append(b, major|byte(u))
+	case u <= math.MaxUint8:
+		return append(b, major|24, byte(u))
+	case u <= math.MaxUint16:
+		return append(b, major|25, byte(u>>8), byte(u))
+	case u <= math.MaxUint32:
+		return append(b, major|26, byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], u)
+	return append(append(b, major|27), buf[:]...)
+}
+
+// Unmarshal decodes a CBOR value, which must take the whole data.
+// Integers are decoded as int64, or uint64 if they do not fit, floats
+// as float64, byte strings as []byte, arrays as []interface{} and maps
+// as map[string]interface{}. Maps whose keys are not text strings are
+// not supported.
+func Unmarshal(data []byte) (interface{}, error) {
+	d := decoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(d.data) {
+		return nil, errors.New("cbor: extra data after value")
+	}
+	return v, nil
+}
+
+// decoder decodes the values of data from its offset.
+type decoder struct {
+	data []byte
+	off  int
+}
+
+// next returns the next n bytes of the data.
+func (d *decoder) next(n uint64) ([]byte, error) {
+	if uint64(len(d.data)-d.off) < n {
+		return nil, ErrShortData
+	}
+	b := d.data[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b, nil
+}
+
+// head returns the major type, additional information
+// and argument of the next data item.
+func (d *decoder) head() (byte, byte, uint64, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		arg, err := d.next(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		var u uint64
+		for _, c := range arg {
+			u = u<<8 | uint64(c)
+		}
+		return major, info, u, nil
+	}
+	return 0, 0, 0, fmt.Errorf("cbor: unsupported additional information %d", info)
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errors.New("cbor: value is nested too deeply")
+	}
+	major, info, u, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUint:
+		if u > math.MaxInt64 {
+			return u, nil
+		}
+		return int64(u), nil
+	case majorNegint:
+		if u > math.MaxInt64 {
+			return nil, errors.New("cbor: negative integer overflows int64")
+		}
+		return -1 - int64(u), nil
+	case majorBytes:
+		b, err := d.next(u)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case majorText:
+		b, err := d.next(u)
+		return string(b), err
+	case majorArray:
+		if u > uint64(len(d.data)-d.off) {
+			return nil, ErrShortData
+		}
+		items := make([]interface{}, u)
+		for i := range items {
+			if items[i], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case majorMap:
+		if u > uint64(len(d.data)-d.off) {
+			return nil, ErrShortData
+		}
+		m := make(map[string]interface{}, u)
+		for i := uint64(0); i < u; i++ {
+			key, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("cbor: unsupported map key of type %T", key)
+			}
+			if m[k], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case majorTag:
+		// the tagged value is decoded as if it had no tag
+		return d.value(depth + 1)
+	}
+
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22:
+		return nil, nil
+	case 25:
+		return halfFloat(uint16(u)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(u))), nil
+	case 27:
+		return math.Float64frombits(u), nil
+	}
+	return nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+}
+
+// halfFloat returns the value of a half-precision float.
+func halfFloat(h uint16) float64 {
+	exp, mant := int(h>>10)&0x1f, float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,130 @@
+package cbor
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	inputs := []struct {
+		input    interface{}
+		expected []byte
+	}{
+		{nil, []byte{0xf6}},
+		{true, []byte{0xf5}},
+		{false, []byte{0xf4}},
+		{10, []byte{0x0a}},
+		{-1, []byte{0x20}},
+		{int64(-1000), []byte{0x39, 0x03, 0xe7}},
+		{100, []byte{0x18, 0x64}},
+		{uint64(1000000), []byte{0x1a, 0x00, 0x0f, 0x42, 0x40}},
+		{uint64(math.MaxUint64), []byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{1.1, []byte{0xfb, 0x3f, 0xf1, 0x99, 0x99, 0x99, 0x99, 0x99, 0x9a}},
+		{float32(1.5), []byte{0xfa, 0x3f, 0xc0, 0, 0}},
+		{"IETF", []byte{0x64, 'I', 'E', 'T', 'F'}},
+		{[]byte{1, 2}, []byte{0x42, 0x01, 0x02}},
+		{[]interface{}{1, "a"}, []byte{0x82, 0x01, 0x61, 'a'}},
+		{map[string]interface{}{"a": nil}, []byte{0xa1, 0x61, 'a', 0xf6}},
+	}
+
+	for _, input := range inputs {
+		b, err := Marshal(input.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, input.expected) {
+			t.Errorf("encoding of %v is %x, expected %x", input.input, b, input.expected)
+		}
+	}
+}
+
+func TestMarshal_Error(t *testing.T) {
+	if _, err := Marshal(struct{}{}); err == nil {
+		t.Error("err is nil, expected error")
+	}
+	if _, err := Marshal([]interface{}{map[string]interface{}{"a": struct{}{}}}); err == nil {
+		t.Error("err is nil, expected error")
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	input := map[string]interface{}{
+		"nil":    nil,
+		"bool":   false,
+		"int":    int64(-100000),
+		"uint":   uint64(math.MaxUint64),
+		"float":  0.25,
+		"string": string(bytes.Repeat([]byte("a"), 70000)),
+		"bytes":  []byte{0, 1, 2},
+		"array":  []interface{}{int64(1), "a", []interface{}{}},
+		"map":    map[string]interface{}{"a": map[string]interface{}{}},
+	}
+
+	b, err := Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(value, input) {
+		t.Errorf("value is %v, expected %v", value, input)
+	}
+}
+
+func TestUnmarshal_Floats(t *testing.T) {
+	inputs := []struct {
+		input    []byte
+		expected float64
+	}{
+		{[]byte{0xf9, 0x3c, 0x00}, 1},
+		{[]byte{0xf9, 0xc4, 0x00}, -4},
+		{[]byte{0xf9, 0x00, 0x01}, 5.960464477539063e-8},
+		{[]byte{0xf9, 0x7c, 0x00}, math.Inf(1)},
+		{[]byte{0xfa, 0x47, 0xc3, 0x50, 0x00}, 100000},
+	}
+
+	for _, input := range inputs {
+		value, err := Unmarshal(input.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != input.expected {
+			t.Errorf("value is %v, expected %v", value, input.expected)
+		}
+	}
+}
+
+func TestUnmarshal_Tag(t *testing.T) {
+	// epoch-based date/time
+	value, err := Unmarshal([]byte{0xc1, 0x1a, 0x51, 0x4b, 0x67, 0xb0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != int64(1363896240) {
+		t.Errorf("value is %v, expected %v", value, 1363896240)
+	}
+}
+
+func TestUnmarshal_Error(t *testing.T) {
+	inputs := [][]byte{
+		{},
+		{0xf7},
+		{0x9f, 0xff},
+		{0x63, 'f'},
+		{0x82, 0x01},
+		{0xa1, 0x01, 0x01},
+		{0xf6, 0xf6},
+		{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+
+	for _, input := range inputs {
+		if value, err := Unmarshal(input); err == nil {
+			t.Errorf("value is %v, expected error for %x", value, input)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Package cron provides schedules given by cron expressions,
+// like "0 * * * *" for every hour on the hour.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxYears is the number of years Next looks ahead
+// for a matching date before giving up.
+const maxYears = 5
+
+// Schedule is a parsed cron expression, matching dates by their
+// minute, hour, day of the month, month and day of the week, in UTC.
+// Every field is a bit set of the values it matches.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// anyDom and anyDow are set if the day of the month or the
+	// day of the week are *, so only the other one restricts
+	// the days, instead of matching either of them
+	anyDom, anyDow bool
+}
+
+// field represents the range of values of a field of a cron expression.
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// macros are the expressions that can be given by name.
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression of five fields separated by spaces:
+// minute, hour, day of the month, month and day of the week, being
+// 0 or 7 Sunday. Every field is a list of values separated by commas,
+// each of them a number, a range like 1-5 or *, optionally followed
+// by a step like */15. The @yearly, @monthly, @weekly, @daily and
+// @hourly macros are accepted too.
+func Parse(expr string) (Schedule, error) {
+	if macro, ok := macros[strings.TrimSpace(expr)]; ok {
+		expr = macro
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return Schedule{}, fmt.Errorf("cron expression %q must have %d fields, got %d", expr, len(fields), len(parts))
+	}
+
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return Schedule{}, err
+		}
+		sets[i] = set
+	}
+
+	// Sunday is both 0 and 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return Schedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		anyDom: parts[2] == "*",
+		anyDow: parts[4] == "*",
+	}, nil
+}
+
+// parseField returns the bit set of the values matched by
+// a field of a cron expression, or an error if not valid.
+func parseField(s string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(s, ",") {
+		expr, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			expr = item[:i]
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step of %s in %q", f.name, item)
+			}
+		}
+
+		from, to := f.min, f.max
+		switch {
+		case expr == "*":
+		case strings.Contains(expr, "-"):
+			bounds := strings.SplitN(expr, "-", 2)
+			var err1, err2 error
+			from, err1 = strconv.Atoi(bounds[0])
+			to, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil || from > to {
+				return 0, fmt.Errorf("invalid range of %s in %q", f.name, item)
+			}
+		default:
+			var err error
+			if from, err = strconv.Atoi(expr); err != nil {
+				return 0, fmt.Errorf("invalid %s in %q", f.name, item)
+			}
+			// a single value with a step starts a range, like 5/15
+			to = from
+			if step > 1 {
+				to = f.max
+			}
+		}
+		if from < f.min || to > f.max {
+			return 0, fmt.Errorf("%s in %q must be between %d and %d", f.name, item, f.min, f.max)
+		}
+
+		for v := from; v <= to; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// matchesDay determines whether the day of t is matched by the
+// Schedule. If both the day of the month and the day of the week are
+// restricted, either of them matches, like in the cron daemon.
+func (s Schedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.anyDom || s.anyDow {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first date matched by the Schedule after t, in
+// UTC and with no seconds. It returns the zero date if none is found
+// within the next years, e.g. for February 30.
+func (s Schedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxYears, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
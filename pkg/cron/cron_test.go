@@ -0,0 +1,73 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	inputOutput := []struct {
+		input string
+		valid bool
+	}{
+		{"* * * * *", true},
+		{"0 * * * *", true},
+		{"*/15 9-17 * * 1-5", true},
+		{"0,30 0 1,15 * 7", true},
+		{"5/20 * * * *", true},
+		{"@hourly", true},
+		{"@daily", true},
+		{"", false},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"5-1 * * * *", false},
+		{"*/0 * * * *", false},
+		{"a * * * *", false},
+		{"@often", false},
+	}
+
+	for _, io := range inputOutput {
+		if _, err := Parse(io.input); (err == nil) != io.valid {
+			t.Errorf("err is %v for %q, expected valid %v", err, io.input, io.valid)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// Wednesday
+	now := time.Date(2016, 1, 6, 10, 17, 30, 0, time.UTC)
+
+	inputOutput := []struct {
+		input  string
+		output time.Time
+	}{
+		{"* * * * *", time.Date(2016, 1, 6, 10, 18, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2016, 1, 6, 11, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2016, 1, 6, 10, 30, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2016, 1, 6, 10, 25, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2016, 1, 7, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2016, 1, 10, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2016, 1, 10, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2016, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2016, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2016, 1, 31, 0, 0, 0, 0, time.UTC)},
+		// either the day of the month or the day of the week
+		{"0 0 15 * 5", time.Date(2016, 1, 8, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, io := range inputOutput {
+		s, err := Parse(io.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next := s.Next(now); !next.Equal(io.output) {
+			t.Errorf("next of %q is %v, expected %v", io.input, next, io.output)
+		}
+	}
+}
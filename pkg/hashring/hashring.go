@@ -0,0 +1,105 @@
+// Package hashring provides a consistent hash ring,
+// which assigns keys to nodes so that adding or removing
+// a node only moves the keys assigned to it.
+package hashring
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Ring is a consistent hash ring. Every node is placed
+// in the ring as replicas virtual nodes, so keys are evenly
+// distributed among nodes. It contains a mutex to lock and
+// unlock the access to the ring.
+type Ring struct {
+	replicas int
+	// hashes are the sorted hashes of the virtual nodes,
+	// and nodes the node of each hash
+	hashes []uint32
+	nodes  map[uint32]string
+
+	mux sync.RWMutex
+}
+
+// New returns an empty Ring placing every node
+// as replicas virtual nodes, at least one.
+func New(replicas int) *Ring {
+	if replicas < 1 {
+		replicas = 1
+	}
+	return &Ring{
+		replicas: replicas,
+		nodes:    make(map[uint32]string),
+	}
+}
+
+// Set replaces the nodes of the Ring.
+func (r *Ring) Set(nodes []string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.hashes = r.hashes[:0]
+	r.nodes = make(map[uint32]string, len(nodes)*r.replicas)
+	for _, node := range nodes {
+		for i := 0; i < r.replicas; i++ {
+			h := hash(strconv.Itoa(i) + node)
+			if _, ok := r.nodes[h]; ok {
+				continue
+			}
+			r.nodes[h] = node
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Sort(uint32s(r.hashes))
+}
+
+// Nodes returns the nodes of the Ring, sorted.
+func (r *Ring) Nodes() []string {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	seen := make(map[string]bool)
+	nodes := make([]string, 0, len(r.hashes)/r.replicas)
+	for _, node := range r.nodes {
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// Get returns the node a key is assigned to, i.e. the first
+// one clockwise from the key in the Ring. It returns an empty
+// string if the Ring has no nodes.
+func (r *Ring) Get(key string) string {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	if len(r.hashes) == 0 {
+		return ""
+	}
+
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[r.hashes[i]]
+}
+
+// hash returns the position of s in the Ring.
+func hash(s string) uint32 {
+	return crc32.ChecksumIEEE([]byte(s))
+}
+
+// uint32s implements sort.Interface to sort uint32 values.
+type uint32s []uint32
+
+func (u uint32s) Len() int           { return len(u) }
+func (u uint32s) Less(i, j int) bool { return u[i] < u[j] }
+func (u uint32s) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
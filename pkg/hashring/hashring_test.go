@@ -0,0 +1,56 @@
+package hashring
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	r := New(0)
+	if node := r.Get("key"); node != "" {
+		t.Errorf("node is %s, expected none", node)
+	}
+
+	r.Set([]string{"b", "a"})
+	if nodes := r.Nodes(); !reflect.DeepEqual(nodes, []string{"a", "b"}) {
+		t.Errorf("nodes are %v, expected %v", nodes, []string{"a", "b"})
+	}
+	if node := r.Get("key"); node != "a" && node != "b" {
+		t.Errorf("node is %s, expected a or b", node)
+	}
+	if r.Get("key") != r.Get("key") {
+		t.Error("key is assigned to different nodes")
+	}
+
+	r.Set(nil)
+	if nodes := r.Nodes(); len(nodes) != 0 {
+		t.Errorf("nodes are %v, expected none", nodes)
+	}
+}
+
+func TestRing_Distribution(t *testing.T) {
+	r := New(100)
+	r.Set([]string{"a", "b", "c"})
+
+	keys := 3000
+	counts := make(map[string]int)
+	before := make(map[string]string, keys)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprint("key", i)
+		before[key] = r.Get(key)
+		counts[before[key]]++
+	}
+	for node, count := range counts {
+		if count < keys/6 {
+			t.Errorf("node %s has %d keys, expected at least %d", node, count, keys/6)
+		}
+	}
+
+	r.Set([]string{"a", "b", "c", "d"})
+	for key, node := range before {
+		if after := r.Get(key); after != node && after != "d" {
+			t.Errorf("key %s moved from %s to %s, expected d", key, node, after)
+		}
+	}
+}
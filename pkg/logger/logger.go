@@ -0,0 +1,271 @@
+// Package logger provides a leveled and structured logger, which
+// writes entries either as text or as JSON.
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fern4lvarez/piladb/pkg/date"
+)
+
+// Level is the severity of a log entry.
+type Level int
+
+const (
+	// LevelDebug logs detailed information for debugging.
+	LevelDebug Level = iota
+	// LevelInfo logs the regular operation.
+	LevelInfo
+	// LevelWarn logs unexpected but recoverable situations.
+	LevelWarn
+	// LevelError logs failures.
+	LevelError
+	// LevelOff disables logging.
+	LevelOff
+)
+
+var levelNames = []string{"debug", "info", "warn", "error", "off"}
+
+// String returns the name of the Level.
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelOff {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the Level given its name.
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(name, n) {
+			return Level(i), nil
+		}
+	}
+	return LevelOff, fmt.Errorf("unknown log level %s", name)
+}
+
+// Format is the encoding of the log entries.
+type Format string
+
+const (
+	// FormatText writes an entry per line as the date, the
+	// level, the message and key=value fields.
+	FormatText Format = "text"
+	// FormatJSON writes an entry per line as a JSON object.
+	FormatJSON Format = "json"
+)
+
+// ParseFormat returns the Format given its name.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case FormatText, FormatJSON:
+		return format, nil
+	}
+	return FormatText, fmt.Errorf("unknown log format %s", name)
+}
+
+// Logger writes log entries with a Level equal or above
+// its own into an io.Writer. It is safe for concurrent use.
+type Logger struct {
+	out    io.Writer
+	level  Level
+	format Format
+	// now returns the date of the entries
+	now func() time.Time
+
+	// mu protects the access to the fields,
+	// and serializes the writes into out
+	mu sync.Mutex
+}
+
+// New returns a Logger writing into out entries with
+// a Level equal or above level, encoded with format.
+func New(out io.Writer, level Level, format Format) *Logger {
+	return &Logger{
+		out:    out,
+		level:  level,
+		format: format,
+		now:    time.Now,
+	}
+}
+
+// SetOutput sets the destination of the Logger.
+func (l *Logger) SetOutput(out io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out = out
+}
+
+// SetLevel sets the minimum Level of the entries of the Logger.
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+}
+
+// SetFormat sets the encoding of the entries of the Logger.
+func (l *Logger) SetFormat(format Format) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.format = format
+}
+
+// Enabled returns true if the Logger writes entries of level.
+func (l *Logger) Enabled(level Level) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return level >= l.level && level != LevelOff
+}
+
+// Log writes an entry of level with a message and a list of
+// fields given as alternate keys and values. A key without
+// value is ignored.
+func (l *Logger) Log(level Level, msg string, keyvals ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if level < l.level || level == LevelOff {
+		return
+	}
+
+	var line []byte
+	if l.format == FormatJSON {
+		line = l.json(level, msg, keyvals)
+	} else {
+		line = l.text(level, msg, keyvals)
+	}
+	l.out.Write(append(line, '\n'))
+}
+
+// json encodes an entry as a JSON object.
+func (l *Logger) json(level Level, msg string, keyvals []interface{}) []byte {
+	entry := map[string]interface{}{
+		"time":  date.Format(l.now()),
+		"level": level.String(),
+		"msg":   msg,
+	}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		value := keyvals[i+1]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		entry[fmt.Sprint(keyvals[i])] = value
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		// fall back to strings, as any value can be formatted
+		for k, v := range entry {
+			entry[k] = fmt.Sprint(v)
+		}
+		b, _ = json.Marshal(entry)
+	}
+	return b
+}
+
+// text encodes an entry as a line of text. Values containing
+// spaces or quotes are quoted.
+func (l *Logger) text(level Level, msg string, keyvals []interface{}) []byte {
+	fields := make([]string, 0, len(keyvals)/2)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		value := fmt.Sprint(keyvals[i+1])
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fields = append(fields, fmt.Sprintf("%v=%s", keyvals[i], value))
+	}
+
+	line := fmt.Sprintf("%s %-5s %s", date.Format(l.now()), strings.ToUpper(level.String()), msg)
+	if len(fields) > 0 {
+		line += " " + strings.Join(fields, " ")
+	}
+	return []byte(line)
+}
+
+// Debug writes an entry of LevelDebug.
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.Log(LevelDebug, msg, keyvals...)
+}
+
+// Info writes an entry of LevelInfo.
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.Log(LevelInfo, msg, keyvals...)
+}
+
+// Warn writes an entry of LevelWarn.
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.Log(LevelWarn, msg, keyvals...)
+}
+
+// Error writes an entry of LevelError.
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.Log(LevelError, msg, keyvals...)
+}
+
+// Fatal writes an entry of LevelError and exits with status 1.
+func (l *Logger) Fatal(msg string, keyvals ...interface{}) {
+	l.Log(LevelError, msg, keyvals...)
+	os.Exit(1)
+}
+
+// Writer returns an io.Writer that writes every line written
+// into it as the message of an entry of level. It allows to
+// use the Logger as the output of the standard logger, which
+// must be set with no flags to not duplicate the date.
+func (l *Logger) Writer(level Level) io.Writer {
+	return levelWriter{l, level}
+}
+
+// levelWriter writes lines as entries of a Logger.
+type levelWriter struct {
+	logger *Logger
+	level  Level
+}
+
+func (w levelWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		w.logger.Log(w.level, line)
+	}
+	return len(p), nil
+}
+
+// std is the default Logger, writing text entries
+// of LevelInfo and above into the standard error.
+var std = New(os.Stderr, LevelInfo, FormatText)
+
+// Default returns the default Logger.
+func Default() *Logger {
+	return std
+}
+
+// Debug writes an entry of LevelDebug with the default Logger.
+func Debug(msg string, keyvals ...interface{}) {
+	std.Log(LevelDebug, msg, keyvals...)
+}
+
+// Info writes an entry of LevelInfo with the default Logger.
+func Info(msg string, keyvals ...interface{}) {
+	std.Log(LevelInfo, msg, keyvals...)
+}
+
+// Warn writes an entry of LevelWarn with the default Logger.
+func Warn(msg string, keyvals ...interface{}) {
+	std.Log(LevelWarn, msg, keyvals...)
+}
+
+// Error writes an entry of LevelError with the default Logger.
+func Error(msg string, keyvals ...interface{}) {
+	std.Log(LevelError, msg, keyvals...)
+}
+
+// Fatal writes an entry of LevelError with the default
+// Logger and exits with status 1.
+func Fatal(msg string, keyvals ...interface{}) {
+	std.Fatal(msg, keyvals...)
+}
@@ -0,0 +1,187 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestLogger returns a Logger writing into buf at a fixed date.
+func newTestLogger(buf *bytes.Buffer, level Level, format Format) *Logger {
+	l := New(buf, level, format)
+	l.now = func() time.Time {
+		return time.Date(2016, time.May, 12, 15, 34, 56, 0, time.UTC)
+	}
+	return l
+}
+
+func TestLevelString(t *testing.T) {
+	inputOutput := []struct {
+		input  Level
+		output string
+	}{
+		{LevelDebug, "debug"},
+		{LevelInfo, "info"},
+		{LevelWarn, "warn"},
+		{LevelError, "error"},
+		{LevelOff, "off"},
+		{Level(8), "level(8)"},
+	}
+
+	for _, io := range inputOutput {
+		if s := io.input.String(); s != io.output {
+			t.Errorf("level is %s, expected %s", s, io.output)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output Level
+	}{
+		{"debug", LevelDebug},
+		{"INFO", LevelInfo},
+		{"warn", LevelWarn},
+		{"error", LevelError},
+		{"off", LevelOff},
+	}
+
+	for _, io := range inputOutput {
+		if level, err := ParseLevel(io.input); err != nil {
+			t.Fatal(err)
+		} else if level != io.output {
+			t.Errorf("level is %v, expected %v", level, io.output)
+		}
+	}
+
+	if _, err := ParseLevel("foo"); err == nil {
+		t.Error("err is nil, expected error")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	inputOutput := []struct {
+		input  string
+		output Format
+	}{
+		{"text", FormatText},
+		{"JSON", FormatJSON},
+	}
+
+	for _, io := range inputOutput {
+		if format, err := ParseFormat(io.input); err != nil {
+			t.Fatal(err)
+		} else if format != io.output {
+			t.Errorf("format is %v, expected %v", format, io.output)
+		}
+	}
+
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("err is nil, expected error")
+	}
+}
+
+func TestLoggerText(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger(&buf, LevelInfo, FormatText)
+
+	l.Debug("hidden")
+	l.Info("request", "method", "GET", "path", "/_status", "status", 200)
+	l.Error("failed", "err", errors.New("no space left"), "odd")
+
+	expected := "2016-05-12T15:34:56Z INFO  request method=GET path=/_status status=200\n" +
+		"2016-05-12T15:34:56Z ERROR failed err=\"no space left\"\n"
+	if buf.String() != expected {
+		t.Errorf("log is %q, expected %q", buf.String(), expected)
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger(&buf, LevelDebug, FormatJSON)
+
+	l.Warn("slow request", "latency_ms", 1.5, "err", errors.New("timeout"))
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"time":       "2016-05-12T15:34:56Z",
+		"level":      "warn",
+		"msg":        "slow request",
+		"latency_ms": 1.5,
+		"err":        "timeout",
+	}
+	if !reflect.DeepEqual(entry, expected) {
+		t.Errorf("entry is %v, expected %v", entry, expected)
+	}
+}
+
+func TestLoggerJSON_Unsupported(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger(&buf, LevelDebug, FormatJSON)
+
+	l.Info("channel", "ch", make(chan int))
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entry["ch"].(string); !ok {
+		t.Errorf("ch is %v, expected a string", entry["ch"])
+	}
+}
+
+func TestLoggerSetters(t *testing.T) {
+	var buf, other bytes.Buffer
+	l := newTestLogger(&buf, LevelInfo, FormatText)
+
+	l.SetLevel(LevelOff)
+	l.Error("hidden")
+	if buf.Len() != 0 || l.Enabled(LevelError) {
+		t.Errorf("log is %q, expected it empty", buf.String())
+	}
+
+	l.SetLevel(LevelDebug)
+	l.SetFormat(FormatJSON)
+	l.SetOutput(&other)
+	l.Debug("shown")
+	if buf.Len() != 0 || other.Len() == 0 || !l.Enabled(LevelDebug) {
+		t.Errorf("log is %q, expected an entry", other.String())
+	}
+}
+
+func TestLoggerWriter(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger(&buf, LevelInfo, FormatText)
+
+	std := log.New(l.Writer(LevelInfo), "", 0)
+	std.Println("GET /_status 200")
+
+	expected := "2016-05-12T15:34:56Z INFO  GET /_status 200\n"
+	if buf.String() != expected {
+		t.Errorf("log is %q, expected %q", buf.String(), expected)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	var buf bytes.Buffer
+	l := Default()
+	defer l.SetOutput(l.out)
+	l.SetOutput(&buf)
+
+	Debug("debug")
+	Info("info")
+	Warn("warn")
+	Error("error")
+
+	if lines := bytes.Count(buf.Bytes(), []byte("\n")); lines != 3 {
+		t.Errorf("log has %d lines, expected %d", lines, 3)
+	}
+}
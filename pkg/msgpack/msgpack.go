@@ -0,0 +1,330 @@
+// Package msgpack implements the encoding of MessagePack values made of
+// nil, booleans, integers, floats, strings, binary data, arrays and maps
+// with string keys. Extension types are not supported.
+package msgpack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxDepth is the maximum nesting of arrays and maps of a decoded value.
+const maxDepth = 1000
+
+// ErrShortData is returned when the data ends before the value does.
+var ErrShortData = errors.New("msgpack: unexpected end of data")
+
+// Marshal returns the MessagePack encoding of v, which may be nil, a
+// bool, an integer, a float, a string, a []byte, a []interface{} or a
+// map[string]interface{} of such values.
+func Marshal(v interface{}) ([]byte, error) {
+	return appendValue(nil, v, 0)
+}
+
+func appendValue(b []byte, v interface{}, depth int) ([]byte, error) {
+	if depth > maxDepth {
+		return nil, errors.New("msgpack: value is nested too deeply")
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case int:
+		return appendInt(b, int64(v)), nil
+	case int32:
+		return appendInt(b, int64(v)), nil
+	case int64:
+		return appendInt(b, v), nil
+	case uint:
+		return appendUint(b, uint64(v)), nil
+	case uint32:
+		return appendUint(b, uint64(v)), nil
+	case uint64:
+		return appendUint(b, v), nil
+	case float32:
+		b = append(b, 0xca)
+		return appendUint32(b, math.Float32bits(v)), nil
+	case float64:
+		b = append(b, 0xcb)
+		return appendUint64(b, math.Float64bits(v)), nil
+	case string:
+		b = appendLength(b, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		return append(b, v...), nil
+	case []byte:
+		b = appendLength(b, len(v), 0, 0, 0xc4, 0xc5, 0xc6)
+		return append(b, v...), nil
+	case []interface{}:
+		b = appendLength(b, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		var err error
+		for _, item := range v {
+			if b, err = appendValue(b, item, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		b = appendLength(b, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		var err error
+		for key, item := range v {
+			b = appendLength(b, len(key), 0xa0, 32, 0xd9, 0xda, 0xdb)
+			b = append(b, key...)
+			if b, err = appendValue(b, item, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type %T", v)
+}
+
+// appendLength appends the header of a string, binary, array or map
+// of length n: fixed, if n is lower than fixMax, or with a length of
+// 8, 16 or 32 bits. A zero code means the length is not available.
+func appendLength(b []byte, n int, fix byte, fixMax int, code8, code16, code32 byte) []byte {
+	switch {
+	case n < fixMax:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint8 && code8 != 0:
+		return append(b, code8, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(b, code16), uint16(n))
+	}
+	return appendUint32(append(b, code32), uint32(n))
+}
+
+func appendInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return appendUint(b, uint64(i))
+	case i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return appendUint16(append(b, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return appendUint32(append(b, 0xd2), uint32(i))
+	}
+	return appendUint64(append(b, 0xd3), uint64(i))
+}
+
+func appendUint(b []byte, u uint64) []byte {
+	switch {
+	case u <= math.MaxInt8:
+		return append(b, byte(u))
+	case u <= math.MaxUint8:
+		return append(b, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return appendUint16(append(b, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		return appendUint32(append(b, 0xce), uint32(u))
+	}
+	return appendUint64(append(b, 0xcf), u)
+}
+
+func appendUint16(b []byte, u uint16) []byte {
+	return append(b, byte(u>>8), byte(u))
+}
+
+func appendUint32(b []byte, u uint32) []byte {
+	return append(b, byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+}
+
+func appendUint64(b []byte, u uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(u>>32)), uint32(u))
+}
+
+// Unmarshal decodes a MessagePack value, which must take the whole
+// data. Integers are decoded as int64, or uint64 if they do not fit,
+// floats as float64, binary data as []byte, arrays as []interface{}
+// and maps as map[string]interface{}. Maps whose keys are not strings
+// are not supported.
+func Unmarshal(data []byte) (interface{}, error) {
+	d := decoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(d.data) {
+		return nil, errors.New("msgpack: extra data after value")
+	}
+	return v, nil
+}
+
+// decoder decodes the values of data from its offset.
+type decoder struct {
+	data []byte
+	off  int
+}
+
+// next returns the next n bytes of the data.
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.off < n {
+		return nil, ErrShortData
+	}
+	b := d.data[d.off : d.off+n]
+	d.off += n
+	return b, nil
+}
+
+// uint returns the next unsigned integer of n bytes.
+func (d *decoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// length returns the next length of n bytes.
+func (d *decoder) length(n int) (int, error) {
+	u, err := d.uint(n)
+	if err != nil {
+		return 0, err
+	}
+	if u > uint64(len(d.data)) {
+		return 0, ErrShortData
+	}
+	return int(u), nil
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errors.New("msgpack: value is nested too deeply")
+	}
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := b[0]; {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c >= 0x80 && c <= 0x8f:
+		return d.mapping(int(c&0x0f), depth)
+	case c >= 0x90 && c <= 0x9f:
+		return d.array(int(c&0x0f), depth)
+	case c >= 0xa0 && c <= 0xbf:
+		return d.str(int(c & 0x1f))
+	}
+
+	switch c := b[0]; c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.length(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		data, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, data...), nil
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil || u > math.MaxInt64 {
+			return u, err
+		}
+		return int64(u), nil
+	case 0xd0:
+		u, err := d.uint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := d.uint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := d.uint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := d.uint(8)
+		return int64(u), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.length(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xdc, 0xdd:
+		n, err := d.length(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.length(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapping(n, depth)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%02x", b[0])
+}
+
+func (d *decoder) str(n int) (string, error) {
+	b, err := d.next(n)
+	return string(b), err
+}
+
+func (d *decoder) array(n int, depth int) (interface{}, error) {
+	if n > len(d.data)-d.off {
+		return nil, ErrShortData
+	}
+	items := make([]interface{}, n)
+	for i := range items {
+		item, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+func (d *decoder) mapping(n int, depth int) (interface{}, error) {
+	if n > len(d.data)-d.off {
+		return nil, ErrShortData
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		key, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		k, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("msgpack: unsupported map key of type %T", key)
+		}
+		if m[k], err = d.value(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,112 @@
+package msgpack
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	inputs := []struct {
+		input    interface{}
+		expected []byte
+	}{
+		{nil, []byte{0xc0}},
+		{true, []byte{0xc3}},
+		{false, []byte{0xc2}},
+		{8, []byte{0x08}},
+		{-1, []byte{0xff}},
+		{int64(-100), []byte{0xd0, 0x9c}},
+		{200, []byte{0xcc, 0xc8}},
+		{int64(-1000), []byte{0xd1, 0xfc, 0x18}},
+		{uint64(70000), []byte{0xce, 0x00, 0x01, 0x11, 0x70}},
+		{int64(math.MinInt64), []byte{0xd3, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+		{1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{float32(1.5), []byte{0xca, 0x3f, 0xc0, 0, 0}},
+		{"foo", []byte{0xa3, 'f', 'o', 'o'}},
+		{[]byte("foo"), []byte{0xc4, 0x03, 'f', 'o', 'o'}},
+		{[]interface{}{1, "a"}, []byte{0x92, 0x01, 0xa1, 'a'}},
+		{map[string]interface{}{"a": nil}, []byte{0x81, 0xa1, 'a', 0xc0}},
+	}
+
+	for _, input := range inputs {
+		b, err := Marshal(input.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, input.expected) {
+			t.Errorf("encoding of %v is %x, expected %x", input.input, b, input.expected)
+		}
+	}
+}
+
+func TestMarshal_Long(t *testing.T) {
+	s := string(bytes.Repeat([]byte("a"), 300))
+	b, err := Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b[:3], []byte{0xda, 0x01, 0x2c}) || len(b) != 303 {
+		t.Errorf("encoding header is %x, expected da012c", b[:3])
+	}
+
+	items := make([]interface{}, 20)
+	if b, _ = Marshal(items); !bytes.Equal(b[:3], []byte{0xdc, 0x00, 0x14}) {
+		t.Errorf("encoding header is %x, expected dc0014", b[:3])
+	}
+}
+
+func TestMarshal_Error(t *testing.T) {
+	if _, err := Marshal(struct{}{}); err == nil {
+		t.Error("err is nil, expected error")
+	}
+	if _, err := Marshal([]interface{}{map[string]interface{}{"a": struct{}{}}}); err == nil {
+		t.Error("err is nil, expected error")
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	input := map[string]interface{}{
+		"nil":    nil,
+		"bool":   true,
+		"int":    int64(-100000),
+		"uint":   uint64(math.MaxUint64),
+		"float":  0.25,
+		"string": string(bytes.Repeat([]byte("a"), 70000)),
+		"bytes":  []byte{0, 1, 2},
+		"array":  []interface{}{int64(1), "a", []interface{}{}},
+		"map":    map[string]interface{}{"a": map[string]interface{}{}},
+	}
+
+	b, err := Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(value, input) {
+		t.Errorf("value is %v, expected %v", value, input)
+	}
+}
+
+func TestUnmarshal_Error(t *testing.T) {
+	inputs := [][]byte{
+		{},
+		{0xc1},
+		{0xa3, 'f'},
+		{0x92, 0x01},
+		{0x81, 0x01, 0x01},
+		{0xc0, 0xc0},
+		{0xdd, 0xff, 0xff, 0xff, 0xff},
+		{0xd4, 0x01, 0x01},
+	}
+
+	for _, input := range inputs {
+		if value, err := Unmarshal(input); err == nil {
+			t.Errorf("value is %v, expected error for %x", value, input)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Package protobuf implements the subset of the Protocol Buffers wire
+// format needed to encode and decode messages by hand: appending their
+// fields to a buffer, and reading them back one by one.
+package protobuf
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Wire types of the fields of a message.
+const (
+	WireVarint  = 0
+	WireFixed64 = 1
+	WireBytes   = 2
+	WireFixed32 = 5
+)
+
+// ErrMalformed is returned when a message can not be decoded.
+var ErrMalformed = errors.New("protobuf: malformed message")
+
+// appendKey appends the key of a field, made of its number
+// and its wire type.
+func appendKey(b []byte, field, wire int) []byte {
+	return appendVarint(b, uint64(field)<<3|uint64(wire))
+}
+
+// appendVarint appends v encoded as a varint.
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// AppendUint appends an unsigned integer field,
+// i.e. uint32 or uint64.
+func AppendUint(b []byte, field int, v uint64) []byte {
+	return appendVarint(appendKey(b, field, WireVarint), v)
+}
+
+// AppendInt appends a signed integer field, i.e. int32 or int64,
+// which takes ten bytes if negative.
+func AppendInt(b []byte, field int, v int64) []byte {
+	return AppendUint(b, field, uint64(v))
+}
+
+// AppendBool appends a bool field.
+func AppendBool(b []byte, field int, v bool) []byte {
+	if v {
+		return AppendUint(b, field, 1)
+	}
+	return AppendUint(b, field, 0)
+}
+
+// AppendDouble appends a double field.
+func AppendDouble(b []byte, field int, v float64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(appendKey(b, field, WireFixed64), buf[:]...)
+}
+
+// AppendBytes appends a bytes field, which is also the
+// encoding of an embedded message.
+func AppendBytes(b []byte, field int, v []byte) []byte {
+	b = appendVarint(appendKey(b, field, WireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+// AppendString appends a string field.
+func AppendString(b []byte, field int, v string) []byte {
+	b = appendVarint(appendKey(b, field, WireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+// Reader reads the fields of an encoded message. After calling Next,
+// the value of the field is read with the method of its wire type, or
+// skipped if unknown.
+type Reader struct {
+	b    []byte
+	wire int
+	err  error
+}
+
+// NewReader returns a Reader of the encoded message b.
+func NewReader(b []byte) *Reader {
+	return &Reader{b: b}
+}
+
+// Next advances to the next field, and returns its number and wire
+// type. It returns false at the end of the message, and on errors,
+// which are returned by Err.
+func (r *Reader) Next() (field, wire int, ok bool) {
+	if r.err != nil || len(r.b) == 0 {
+		return 0, 0, false
+	}
+	key := r.varint()
+	if r.err != nil {
+		return 0, 0, false
+	}
+	field, r.wire = int(key>>3), int(key&7)
+	if field == 0 {
+		r.err = ErrMalformed
+		return 0, 0, false
+	}
+	return field, r.wire, true
+}
+
+// Err returns the first error found reading the message, if any.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Uint returns the value of a varint field as an unsigned integer.
+func (r *Reader) Uint() uint64 {
+	if !r.expect(WireVarint) {
+		return 0
+	}
+	return r.varint()
+}
+
+// Int returns the value of a varint field as a signed integer.
+func (r *Reader) Int() int64 {
+	return int64(r.Uint())
+}
+
+// Bool returns the value of a varint field as a bool.
+func (r *Reader) Bool() bool {
+	return r.Uint() != 0
+}
+
+// Double returns the value of a fixed64 field as a double.
+func (r *Reader) Double() float64 {
+	if !r.expect(WireFixed64) || !r.has(8) {
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(r.b))
+	r.b = r.b[8:]
+	return v
+}
+
+// Bytes returns the value of a bytes field, which is also the
+// encoding of an embedded message. It is not copied, so it is
+// only valid as long as the encoded message is.
+func (r *Reader) Bytes() []byte {
+	if !r.expect(WireBytes) {
+		return nil
+	}
+	n := r.varint()
+	if r.err != nil || !r.has(n) {
+		return nil
+	}
+	v := r.b[:n:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// String returns the value of a bytes field as a string.
+func (r *Reader) String() string {
+	return string(r.Bytes())
+}
+
+// Skip skips the value of the current field.
+func (r *Reader) Skip() {
+	switch r.wire {
+	case WireVarint:
+		r.varint()
+	case WireFixed64:
+		if r.has(8) {
+			r.b = r.b[8:]
+		}
+	case WireBytes:
+		r.Bytes()
+	case WireFixed32:
+		if r.has(4) {
+			r.b = r.b[4:]
+		}
+	default:
+		r.err = ErrMalformed
+	}
+}
+
+// expect returns true if the current field has the given wire type,
+// and sets ErrMalformed otherwise.
+func (r *Reader) expect(wire int) bool {
+	if r.err != nil {
+		return false
+	}
+	if r.wire != wire {
+		r.err = ErrMalformed
+		return false
+	}
+	return true
+}
+
+// has returns true if n bytes are left to be read,
+// and sets ErrMalformed otherwise.
+func (r *Reader) has(n uint64) bool {
+	if uint64(len(r.b)) < n {
+		r.err = ErrMalformed
+		return false
+	}
+	return true
+}
+
+// varint reads a varint.
+func (r *Reader) varint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = ErrMalformed
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
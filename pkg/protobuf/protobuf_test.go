@@ -0,0 +1,121 @@
+package protobuf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAppend(t *testing.T) {
+	// From https://developers.google.com/protocol-buffers/docs/encoding
+	inputOutput := []struct {
+		input  []byte
+		output []byte
+	}{
+		{AppendUint(nil, 1, 150), []byte{0x08, 0x96, 0x01}},
+		{AppendString(nil, 2, "testing"), []byte{0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'}},
+		{AppendBytes(nil, 3, AppendUint(nil, 1, 150)), []byte{0x1a, 0x03, 0x08, 0x96, 0x01}},
+		{AppendInt(nil, 1, -1), []byte{0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{AppendBool(nil, 16, true), []byte{0x80, 0x01, 0x01}},
+		{AppendDouble(nil, 1, 1), []byte{0x09, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f}},
+	}
+
+	for _, io := range inputOutput {
+		if !bytes.Equal(io.input, io.output) {
+			t.Errorf("encoding is %x, expected %x", io.input, io.output)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	var b []byte
+	b = AppendUint(b, 1, 150)
+	b = AppendInt(b, 2, -42)
+	b = AppendBool(b, 3, true)
+	b = AppendDouble(b, 4, 3.14)
+	b = AppendString(b, 5, "foo")
+	b = AppendBytes(b, 6, []byte("bar"))
+	b = append(b, 0x3d, 1, 2, 3, 4) // unknown fixed32 field 7
+	b = AppendUint(b, 8, 1)
+
+	r := NewReader(b)
+	var fields []int
+	for {
+		field, _, ok := r.Next()
+		if !ok {
+			break
+		}
+		fields = append(fields, field)
+
+		switch field {
+		case 1:
+			if v := r.Uint(); v != 150 {
+				t.Errorf("field 1 is %v, expected %v", v, 150)
+			}
+		case 2:
+			if v := r.Int(); v != -42 {
+				t.Errorf("field 2 is %v, expected %v", v, -42)
+			}
+		case 3:
+			if v := r.Bool(); !v {
+				t.Errorf("field 3 is %v, expected %v", v, true)
+			}
+		case 4:
+			if v := r.Double(); v != 3.14 {
+				t.Errorf("field 4 is %v, expected %v", v, 3.14)
+			}
+		case 5:
+			if v := r.String(); v != "foo" {
+				t.Errorf("field 5 is %v, expected %v", v, "foo")
+			}
+		case 6:
+			if v := r.Bytes(); string(v) != "bar" {
+				t.Errorf("field 6 is %s, expected %s", v, "bar")
+			}
+		default:
+			r.Skip()
+		}
+	}
+
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 8 {
+		t.Errorf("fields are %v, expected 8 of them", fields)
+	}
+}
+
+func TestReader_Malformed(t *testing.T) {
+	inputs := [][]byte{
+		{0x08},                  // missing varint
+		{0x08, 0x96},            // truncated varint
+		{0x12, 0x07, 't', 'e'},  // truncated bytes
+		{0x09, 0, 0},            // truncated double
+		{0x00, 0x01},            // field 0
+		{0x0b, 0x01},            // unsupported wire type
+		{0x12, 0x01, 'f', 0x08}, // missing varint after a field
+	}
+
+	for _, input := range inputs {
+		r := NewReader(input)
+		for {
+			_, _, ok := r.Next()
+			if !ok {
+				break
+			}
+			r.Skip()
+		}
+		if err := r.Err(); err != ErrMalformed {
+			t.Errorf("%x: err is %v, expected %v", input, err, ErrMalformed)
+		}
+	}
+}
+
+func TestReader_WrongWireType(t *testing.T) {
+	r := NewReader(AppendString(nil, 1, "foo"))
+	if _, _, ok := r.Next(); !ok {
+		t.Fatal("no field")
+	}
+	if v := r.Uint(); v != 0 || r.Err() != ErrMalformed {
+		t.Errorf("value is %v and err %v, expected 0 and %v", v, r.Err(), ErrMalformed)
+	}
+}
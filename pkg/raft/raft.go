@@ -0,0 +1,670 @@
+// Package raft provides a minimal implementation of the Raft
+// consensus algorithm, which replicates a log of entries across
+// a group of nodes, electing a leader among them. See
+// https://raft.github.io/raft.pdf
+//
+// Nodes keep their state in memory, saving it into a Storage if any
+// so it is restored on restart, and their log is not compacted.
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotLeader is returned when proposing an entry
+	// to a node that is not the leader.
+	ErrNotLeader = errors.New("node is not the leader")
+	// ErrTimeout is returned when an entry is not
+	// committed in time.
+	ErrTimeout = errors.New("entry not committed in time")
+	// ErrDiscarded is returned when an entry is
+	// replaced by the one of another leader.
+	ErrDiscarded = errors.New("entry discarded by another leader")
+)
+
+// State is the role of a node in the Raft group.
+type State string
+
+const (
+	// Follower nodes replicate the log of the leader.
+	Follower State = "follower"
+	// Candidate nodes request the votes of the others
+	// to become the leader.
+	Candidate State = "candidate"
+	// Leader nodes accept new entries, and
+	// replicate them to the followers.
+	Leader State = "leader"
+)
+
+// Entry is an entry of the replicated log.
+type Entry struct {
+	Term  uint64 `json:"term"`
+	Index uint64 `json:"index"`
+	// Data is empty for the entry appended by
+	// a new leader to commit the previous ones
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// VoteRequest is sent by a candidate to request the vote of a node.
+type VoteRequest struct {
+	Term         uint64 `json:"term"`
+	Candidate    string `json:"candidate"`
+	LastLogIndex uint64 `json:"last_log_index"`
+	LastLogTerm  uint64 `json:"last_log_term"`
+}
+
+// VoteResponse is the answer of a node to a VoteRequest.
+type VoteResponse struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+// AppendRequest is sent by the leader to replicate its log
+// into a follower, and as a heartbeat if it has no entries.
+type AppendRequest struct {
+	Term         uint64  `json:"term"`
+	Leader       string  `json:"leader"`
+	PrevLogIndex uint64  `json:"prev_log_index"`
+	PrevLogTerm  uint64  `json:"prev_log_term"`
+	Entries      []Entry `json:"entries,omitempty"`
+	LeaderCommit uint64  `json:"leader_commit"`
+}
+
+// AppendResponse is the answer of a node to an AppendRequest.
+type AppendResponse struct {
+	Term    uint64 `json:"term"`
+	Success bool   `json:"success"`
+	// LastIndex is the last index of the log of
+	// the follower, so the leader skips ahead
+	LastIndex uint64 `json:"last_index"`
+}
+
+// Transport sends requests to the other nodes of the group.
+type Transport interface {
+	Vote(peer string, req VoteRequest) (VoteResponse, error)
+	Append(peer string, req AppendRequest) (AppendResponse, error)
+}
+
+// Config is the configuration of a Node.
+type Config struct {
+	// ID identifies the node in the group, and
+	// Peers are the IDs of the other nodes
+	ID    string
+	Peers []string
+
+	Transport Transport
+	// Storage saves the term, the vote and the log of the
+	// node, which are only kept in memory if it is nil
+	Storage Storage
+
+	// Apply is called in order with the data of every committed
+	// entry, except the ones proposed by the node itself, which
+	// are already applied to its state.
+	Apply func(data json.RawMessage)
+	// Reset is called to empty the state of the node when entries
+	// it proposed are discarded. The data of the committed entries
+	// is applied again afterwards.
+	Reset func()
+
+	// HeartbeatInterval is the time between two AppendRequests
+	// of the leader, and ElectionTimeout the minimum time after
+	// the last one for a follower to become a candidate.
+	HeartbeatInterval time.Duration
+	ElectionTimeout   time.Duration
+}
+
+// Status is the status of a Node.
+type Status struct {
+	ID          string   `json:"id"`
+	State       State    `json:"state"`
+	Term        uint64   `json:"term"`
+	Leader      string   `json:"leader,omitempty"`
+	Peers       []string `json:"peers"`
+	CommitIndex uint64   `json:"commit_index"`
+	LastIndex   uint64   `json:"last_index"`
+}
+
+// Node is a node of a Raft group. It contains a mutex to
+// lock and unlock the access to its state.
+type Node struct {
+	config Config
+
+	state    State
+	term     uint64
+	votedFor string
+	leader   string
+	// log starts with an empty entry of index 0
+	log         []Entry
+	commitIndex uint64
+	lastApplied uint64
+	// local contains the indexes of the entries proposed
+	// by the node, which are not applied again
+	local map[uint64]bool
+
+	votes      int
+	nextIndex  map[string]uint64
+	matchIndex map[string]uint64
+	inflight   map[string]bool
+	// deadline is the time the node becomes a candidate
+	// unless it hears from a leader
+	deadline time.Time
+	// committed is closed when the commit index advances
+	committed chan struct{}
+	stop      chan struct{}
+
+	mu sync.Mutex
+}
+
+// New returns a follower Node with an empty log, which starts
+// taking part in the group once Start is called. See Open to
+// restore the Node saved into the Storage of config.
+func New(config Config) *Node {
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = 50 * time.Millisecond
+	}
+	if config.ElectionTimeout <= 0 {
+		config.ElectionTimeout = 10 * config.HeartbeatInterval
+	}
+
+	n := &Node{
+		config:     config,
+		state:      Follower,
+		log:        []Entry{{}},
+		local:      make(map[uint64]bool),
+		nextIndex:  make(map[string]uint64),
+		matchIndex: make(map[string]uint64),
+		inflight:   make(map[string]bool),
+		committed:  make(chan struct{}),
+		stop:       make(chan struct{}),
+	}
+	n.resetDeadline()
+	return n
+}
+
+// Open returns a follower Node like New, restoring the term, the
+// vote and the log saved into the Storage of config, if any. The
+// restored entries are applied once they are known to be committed.
+func Open(config Config) (*Node, error) {
+	n := New(config)
+	if config.Storage == nil {
+		return n, nil
+	}
+
+	state, entries, err := config.Storage.Load()
+	if err != nil {
+		return nil, err
+	}
+	n.term = state.Term
+	n.votedFor = state.VotedFor
+	n.log = append(n.log, entries...)
+	return n, nil
+}
+
+// Start runs the Node until Stop is called.
+func (n *Node) Start() {
+	go n.run()
+}
+
+// Stop stops the Node.
+func (n *Node) Stop() {
+	close(n.stop)
+}
+
+// run ticks the Node every heartbeat interval until it is stopped.
+func (n *Node) run() {
+	ticker := time.NewTicker(n.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n.tick()
+		case <-n.stop:
+			return
+		}
+	}
+}
+
+// tick replicates the log of a leader to its followers,
+// and starts an election if the leader is not heard of.
+func (n *Node) tick() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.state == Leader {
+		n.replicate()
+		return
+	}
+	if time.Now().After(n.deadline) {
+		n.campaign()
+	}
+}
+
+// Status returns the Status of the Node.
+func (n *Node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return Status{
+		ID:          n.config.ID,
+		State:       n.state,
+		Term:        n.term,
+		Leader:      n.leader,
+		Peers:       append([]string{}, n.config.Peers...),
+		CommitIndex: n.commitIndex,
+		LastIndex:   n.lastIndex(),
+	}
+}
+
+// Leader returns the ID of the leader, if known.
+func (n *Node) Leader() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leader
+}
+
+// IsLeader returns whether the Node is the leader.
+func (n *Node) IsLeader() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.state == Leader
+}
+
+// LastIndex returns the index of the last entry of the log.
+func (n *Node) LastIndex() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.lastIndex()
+}
+
+// Propose appends data to the log of the leader, already applied
+// to its state, and returns its index, which is committed once it
+// is replicated to the majority of the group. It returns ErrNotLeader
+// if the Node is not the leader, or the error of its Storage if the
+// entry is not saved.
+func (n *Node) Propose(data json.RawMessage) (uint64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.state != Leader {
+		return 0, ErrNotLeader
+	}
+	index, err := n.append(data)
+	if err != nil {
+		return 0, err
+	}
+	n.local[index] = true
+	n.replicate()
+	return index, nil
+}
+
+// Wait waits until the entry of the given index, proposed in the
+// current term, is committed, or returns ErrTimeout after timeout.
+// It returns ErrDiscarded if the entry is replaced by another one.
+func (n *Node) Wait(index uint64, timeout time.Duration) error {
+	n.mu.Lock()
+	if index == 0 || index > n.lastIndex() {
+		n.mu.Unlock()
+		return ErrDiscarded
+	}
+	term := n.log[index].Term
+	n.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		n.mu.Lock()
+		if index > n.lastIndex() || n.log[index].Term != term {
+			n.mu.Unlock()
+			return ErrDiscarded
+		}
+		if n.commitIndex >= index {
+			n.mu.Unlock()
+			return nil
+		}
+		committed := n.committed
+		n.mu.Unlock()
+
+		select {
+		case <-committed:
+		case <-timer.C:
+			return ErrTimeout
+		}
+	}
+}
+
+// Resync empties the state of the Node through Reset, and applies
+// again the committed entries, discarding the changes of the state
+// that could not be proposed.
+func (n *Node) Resync() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.reset()
+}
+
+// HandleVote answers the VoteRequest of a candidate.
+func (n *Node) HandleVote(req VoteRequest) VoteResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term > n.term {
+		if err := n.becomeFollower(req.Term, ""); err != nil {
+			return VoteResponse{Term: n.term}
+		}
+	}
+	if req.Term < n.term {
+		return VoteResponse{Term: n.term}
+	}
+
+	last := n.log[n.lastIndex()]
+	upToDate := req.LastLogTerm > last.Term ||
+		(req.LastLogTerm == last.Term && req.LastLogIndex >= last.Index)
+	if (n.votedFor == "" || n.votedFor == req.Candidate) && upToDate {
+		// the vote is saved before it is granted
+		if n.votedFor == "" {
+			n.votedFor = req.Candidate
+			if err := n.saveState(); err != nil {
+				n.votedFor = ""
+				return VoteResponse{Term: n.term}
+			}
+		}
+		n.resetDeadline()
+		return VoteResponse{Term: n.term, Granted: true}
+	}
+	return VoteResponse{Term: n.term}
+}
+
+// HandleAppend answers the AppendRequest of a leader, appending its
+// entries to the log, and applying the committed ones. It does not
+// succeed if the entries can not be saved into the Storage.
+func (n *Node) HandleAppend(req AppendRequest) AppendResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term < n.term {
+		return AppendResponse{Term: n.term, LastIndex: n.lastIndex()}
+	}
+	if req.Term > n.term || n.state != Follower {
+		votedFor := n.votedFor
+		if req.Term > n.term {
+			votedFor = ""
+		}
+		if err := n.becomeFollower(req.Term, votedFor); err != nil {
+			return AppendResponse{Term: n.term, LastIndex: n.lastIndex()}
+		}
+	}
+	n.leader = req.Leader
+	n.resetDeadline()
+
+	if req.PrevLogIndex > n.lastIndex() {
+		return AppendResponse{Term: n.term, LastIndex: n.lastIndex()}
+	}
+	if n.log[req.PrevLogIndex].Term != req.PrevLogTerm {
+		return AppendResponse{Term: n.term, LastIndex: req.PrevLogIndex - 1}
+	}
+
+	// entries already in the log are skipped, and the
+	// rest replace the conflicting ones, if any
+	entries := req.Entries
+	for len(entries) > 0 && entries[0].Index <= n.lastIndex() && n.log[entries[0].Index].Term == entries[0].Term {
+		entries = entries[1:]
+	}
+	reset := false
+	if len(entries) > 0 {
+		if err := n.save(entries); err != nil {
+			return AppendResponse{Term: n.term, LastIndex: n.lastIndex()}
+		}
+		for i := entries[0].Index; i <= n.lastIndex(); i++ {
+			reset = reset || n.local[i]
+		}
+		n.log = append(n.log[:entries[0].Index], entries...)
+	}
+
+	if reset {
+		n.reset()
+	}
+	if req.LeaderCommit > n.commitIndex {
+		n.commit(min(req.LeaderCommit, req.PrevLogIndex+uint64(len(req.Entries))))
+	}
+	return AppendResponse{Term: n.term, Success: true, LastIndex: n.lastIndex()}
+}
+
+// campaign makes the Node a candidate, requesting
+// the votes of its peers.
+func (n *Node) campaign() {
+	n.state = Candidate
+	n.term++
+	n.votedFor = n.config.ID
+	n.leader = ""
+	n.votes = 1
+	n.resetDeadline()
+	// votes are not requested until the term is saved,
+	// the Node campaigns again on the next timeout
+	if err := n.saveState(); err != nil {
+		return
+	}
+	if n.hasMajority(n.votes) {
+		n.becomeLeader()
+		return
+	}
+
+	last := n.log[n.lastIndex()]
+	req := VoteRequest{Term: n.term, Candidate: n.config.ID, LastLogIndex: last.Index, LastLogTerm: last.Term}
+	for _, peer := range n.config.Peers {
+		go func(peer string) {
+			res, err := n.config.Transport.Vote(peer, req)
+			if err != nil {
+				return
+			}
+
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if res.Term > n.term {
+				n.becomeFollower(res.Term, "")
+				return
+			}
+			if n.state != Candidate || n.term != req.Term || !res.Granted {
+				return
+			}
+			n.votes++
+			if n.hasMajority(n.votes) {
+				n.becomeLeader()
+			}
+		}(peer)
+	}
+}
+
+// becomeLeader makes the Node the leader, appending an
+// empty entry so the entries of previous terms are committed.
+func (n *Node) becomeLeader() {
+	n.state = Leader
+	n.leader = n.config.ID
+	for _, peer := range n.config.Peers {
+		n.nextIndex[peer] = n.lastIndex() + 1
+		n.matchIndex[peer] = 0
+	}
+	// a leader that can not save its log steps down
+	if _, err := n.append(nil); err != nil {
+		n.becomeFollower(n.term, n.votedFor)
+		return
+	}
+	n.replicate()
+}
+
+// becomeFollower makes the Node a follower in term, having voted for
+// votedFor, and saves them if they changed. The Node becomes a follower
+// even if they are not saved, as it must not lead nor vote in term.
+func (n *Node) becomeFollower(term uint64, votedFor string) error {
+	changed := term != n.term || votedFor != n.votedFor
+	if term > n.term {
+		n.leader = ""
+	}
+	n.state = Follower
+	n.term = term
+	n.votedFor = votedFor
+	n.resetDeadline()
+	if !changed {
+		return nil
+	}
+	return n.saveState()
+}
+
+// replicate sends the entries that each peer lacks, or a heartbeat,
+// unless a previous request to the peer is still in flight.
+func (n *Node) replicate() {
+	if n.hasMajority(1) {
+		n.advanceCommit()
+	}
+
+	for _, peer := range n.config.Peers {
+		if n.inflight[peer] {
+			continue
+		}
+		next := n.nextIndex[peer]
+		if next < 1 {
+			next = 1
+		}
+		req := AppendRequest{
+			Term:         n.term,
+			Leader:       n.config.ID,
+			PrevLogIndex: next - 1,
+			PrevLogTerm:  n.log[next-1].Term,
+			Entries:      append([]Entry{}, n.log[next:]...),
+			LeaderCommit: n.commitIndex,
+		}
+		n.inflight[peer] = true
+
+		go func(peer string) {
+			res, err := n.config.Transport.Append(peer, req)
+
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			n.inflight[peer] = false
+			if err != nil || n.state != Leader || n.term != req.Term {
+				return
+			}
+			if res.Term > n.term {
+				n.becomeFollower(res.Term, "")
+				return
+			}
+			if !res.Success {
+				n.nextIndex[peer] = min(res.LastIndex, req.PrevLogIndex-1) + 1
+				return
+			}
+			match := req.PrevLogIndex + uint64(len(req.Entries))
+			if match > n.matchIndex[peer] {
+				n.matchIndex[peer] = match
+			}
+			n.nextIndex[peer] = n.matchIndex[peer] + 1
+			n.advanceCommit()
+		}(peer)
+	}
+}
+
+// advanceCommit commits the last entry of the current term
+// replicated to the majority of the group.
+func (n *Node) advanceCommit() {
+	for index := n.lastIndex(); index > n.commitIndex; index-- {
+		if n.log[index].Term != n.term {
+			return
+		}
+		replicas := 1
+		for _, match := range n.matchIndex {
+			if match >= index {
+				replicas++
+			}
+		}
+		if n.hasMajority(replicas) {
+			n.commit(index)
+			return
+		}
+	}
+}
+
+// commit sets the commit index, and applies the committed
+// entries that were not proposed by the Node.
+func (n *Node) commit(index uint64) {
+	n.commitIndex = index
+	for n.lastApplied < n.commitIndex {
+		n.lastApplied++
+		if n.local[n.lastApplied] {
+			delete(n.local, n.lastApplied)
+			continue
+		}
+		if data := n.log[n.lastApplied].Data; len(data) > 0 && n.config.Apply != nil {
+			n.config.Apply(data)
+		}
+	}
+	close(n.committed)
+	n.committed = make(chan struct{})
+}
+
+// reset empties the state of the Node, so the
+// committed entries are applied again.
+func (n *Node) reset() {
+	if n.config.Reset != nil {
+		n.config.Reset()
+	}
+	n.local = make(map[uint64]bool)
+	n.lastApplied = 0
+	n.commit(n.commitIndex)
+}
+
+// append appends an entry with data to the log once it is
+// saved, and returns its index.
+func (n *Node) append(data json.RawMessage) (uint64, error) {
+	entry := Entry{Term: n.term, Index: n.lastIndex() + 1, Data: data}
+	if err := n.save([]Entry{entry}); err != nil {
+		return 0, err
+	}
+	n.log = append(n.log, entry)
+	return entry.Index, nil
+}
+
+// save saves entries into the Storage of the Node, if any.
+func (n *Node) save(entries []Entry) error {
+	if n.config.Storage == nil {
+		return nil
+	}
+	return n.config.Storage.Append(entries)
+}
+
+// saveState saves the term and the vote of the
+// Node into its Storage, if any.
+func (n *Node) saveState() error {
+	if n.config.Storage == nil {
+		return nil
+	}
+	return n.config.Storage.SaveState(HardState{Term: n.term, VotedFor: n.votedFor})
+}
+
+// lastIndex returns the index of the last entry of the log.
+func (n *Node) lastIndex() uint64 {
+	return uint64(len(n.log) - 1)
+}
+
+// hasMajority returns whether votes are the
+// majority of the nodes of the group.
+func (n *Node) hasMajority(votes int) bool {
+	return votes > (len(n.config.Peers)+1)/2
+}
+
+// resetDeadline sets the time the Node becomes a candidate
+// to a random time within the election timeout, from now.
+func (n *Node) resetDeadline() {
+	timeout := n.config.ElectionTimeout
+	n.deadline = time.Now().Add(timeout + time.Duration(rand.Int63n(int64(timeout))))
+}
+
+// min returns the minimum of a and b.
+func min(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
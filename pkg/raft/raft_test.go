@@ -0,0 +1,318 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// network is a Transport delivering requests to the
+// nodes of a group in memory, unless disconnected.
+type network struct {
+	nodes        map[string]*Node
+	disconnected map[string]bool
+	mu           sync.Mutex
+}
+
+func (nw *network) node(from, to string) (*Node, error) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	if nw.disconnected[from] || nw.disconnected[to] {
+		return nil, errors.New("disconnected")
+	}
+	return nw.nodes[to], nil
+}
+
+func (nw *network) connect(id string, connected bool) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.disconnected[id] = !connected
+}
+
+// transport is the Transport of the node id.
+type transport struct {
+	nw *network
+	id string
+}
+
+func (t transport) Vote(peer string, req VoteRequest) (VoteResponse, error) {
+	n, err := t.nw.node(t.id, peer)
+	if err != nil {
+		return VoteResponse{}, err
+	}
+	return n.HandleVote(req), nil
+}
+
+func (t transport) Append(peer string, req AppendRequest) (AppendResponse, error) {
+	n, err := t.nw.node(t.id, peer)
+	if err != nil {
+		return AppendResponse{}, err
+	}
+	return n.HandleAppend(req), nil
+}
+
+// replica is the state of a node, the data it applied.
+type replica struct {
+	data []string
+	mu   sync.Mutex
+}
+
+func (r *replica) add(data string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data = append(r.data, data)
+}
+
+func (r *replica) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.data...)
+}
+
+// newGroup starts a group of n nodes.
+func newGroup(n int) (*network, []*Node, []*replica) {
+	nw := &network{nodes: make(map[string]*Node), disconnected: make(map[string]bool)}
+	nodes := make([]*Node, n)
+	replicas := make([]*replica, n)
+
+	for i := range nodes {
+		id := fmt.Sprintf("node%d", i)
+		var peers []string
+		for j := 0; j < n; j++ {
+			if j != i {
+				peers = append(peers, fmt.Sprintf("node%d", j))
+			}
+		}
+		r := &replica{}
+		replicas[i] = r
+		nodes[i] = New(Config{
+			ID:                id,
+			Peers:             peers,
+			Transport:         transport{nw, id},
+			Apply:             func(data json.RawMessage) { r.add(string(data)) },
+			Reset:             func() { r.mu.Lock(); r.data = nil; r.mu.Unlock() },
+			HeartbeatInterval: 5 * time.Millisecond,
+		})
+		nw.nodes[id] = nodes[i]
+	}
+	for _, node := range nodes {
+		node.Start()
+	}
+	return nw, nodes, replicas
+}
+
+// waitLeader waits for a leader among nodes, and returns its position.
+func waitLeader(t *testing.T, nodes []*Node) int {
+	for i := 0; i < 400; i++ {
+		for j, node := range nodes {
+			if node.IsLeader() {
+				return j
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("no leader was elected")
+	return -1
+}
+
+// propose proposes data to the leader, applying it to
+// its replica as it would be done by its state.
+func propose(t *testing.T, leader *Node, r *replica, data string) uint64 {
+	index, err := leader.Propose(json.RawMessage(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.add(data)
+	return index
+}
+
+// waitData waits until the replica contains the expected data.
+func waitData(t *testing.T, r *replica, expected []string) {
+	for i := 0; i < 400; i++ {
+		if reflect.DeepEqual(r.get(), expected) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Errorf("data is %v, expected %v", r.get(), expected)
+}
+
+func TestNode(t *testing.T) {
+	nw, nodes, replicas := newGroup(3)
+	for _, node := range nodes {
+		defer node.Stop()
+	}
+
+	l := waitLeader(t, nodes)
+	for _, node := range nodes {
+		if node != nodes[l] {
+			if _, err := node.Propose(json.RawMessage(`"x"`)); err != ErrNotLeader {
+				t.Errorf("err is %v, expected %v", err, ErrNotLeader)
+			}
+		}
+	}
+
+	index := propose(t, nodes[l], replicas[l], `"a"`)
+	propose(t, nodes[l], replicas[l], `"b"`)
+	if err := nodes[l].Wait(index, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range replicas {
+		waitData(t, r, []string{`"a"`, `"b"`})
+	}
+
+	status := nodes[l].Status()
+	if status.State != Leader || status.Leader != status.ID || status.LastIndex != 3 || len(status.Peers) != 2 {
+		t.Errorf("status is %+v", status)
+	}
+
+	// a new leader is elected without the old one
+	nw.connect(nodes[l].config.ID, false)
+	others := append(append([]*Node{}, nodes[:l]...), nodes[l+1:]...)
+	newLeader := others[waitLeader(t, others)]
+	for i, node := range nodes {
+		if node == newLeader {
+			index = propose(t, node, replicas[i], `"c"`)
+		}
+	}
+	if err := newLeader.Wait(index, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// the old leader discards its entries once reconnected
+	oldIndex := propose(t, nodes[l], replicas[l], `"lost"`)
+	if err := nodes[l].Wait(oldIndex, 20*time.Millisecond); err != ErrTimeout {
+		t.Errorf("err is %v, expected %v", err, ErrTimeout)
+	}
+	discarded := make(chan error)
+	go func() { discarded <- nodes[l].Wait(oldIndex, time.Second) }()
+	time.Sleep(10 * time.Millisecond)
+	nw.connect(nodes[l].config.ID, true)
+	if err := <-discarded; err != ErrDiscarded {
+		t.Errorf("err is %v, expected %v", err, ErrDiscarded)
+	}
+	for _, r := range replicas {
+		waitData(t, r, []string{`"a"`, `"b"`, `"c"`})
+	}
+}
+
+func TestNode_Single(t *testing.T) {
+	_, nodes, replicas := newGroup(1)
+	defer nodes[0].Stop()
+
+	waitLeader(t, nodes)
+	index := propose(t, nodes[0], replicas[0], `"a"`)
+	if err := nodes[0].Wait(index, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes[0].Wait(index+1, time.Second); err != ErrDiscarded {
+		t.Errorf("err is %v, expected %v", err, ErrDiscarded)
+	}
+	if data := replicas[0].get(); !reflect.DeepEqual(data, []string{`"a"`}) {
+		t.Errorf("data is %v, expected %v", data, []string{`"a"`})
+	}
+}
+
+func TestNodeHandleVote(t *testing.T) {
+	n := New(Config{ID: "a", Peers: []string{"b", "c"}})
+	n.log = append(n.log, Entry{Term: 2, Index: 1})
+	n.term = 2
+
+	inputOutput := []struct {
+		input  VoteRequest
+		output VoteResponse
+	}{
+		{VoteRequest{Term: 1, Candidate: "b", LastLogIndex: 1, LastLogTerm: 2}, VoteResponse{Term: 2}},
+		{VoteRequest{Term: 3, Candidate: "b", LastLogIndex: 1, LastLogTerm: 1}, VoteResponse{Term: 3}},
+		{VoteRequest{Term: 3, Candidate: "b", LastLogIndex: 1, LastLogTerm: 2}, VoteResponse{Term: 3, Granted: true}},
+		{VoteRequest{Term: 3, Candidate: "c", LastLogIndex: 2, LastLogTerm: 2}, VoteResponse{Term: 3}},
+		{VoteRequest{Term: 3, Candidate: "b", LastLogIndex: 1, LastLogTerm: 2}, VoteResponse{Term: 3, Granted: true}},
+	}
+
+	for _, io := range inputOutput {
+		if res := n.HandleVote(io.input); res != io.output {
+			t.Errorf("response is %+v, expected %+v for %+v", res, io.output, io.input)
+		}
+	}
+}
+
+func TestNodeHandleAppend(t *testing.T) {
+	var applied []string
+	n := New(Config{ID: "a", Peers: []string{"b", "c"}, Apply: func(data json.RawMessage) {
+		applied = append(applied, string(data))
+	}})
+
+	entries := []Entry{{Term: 1, Index: 1, Data: json.RawMessage(`1`)}, {Term: 1, Index: 2, Data: json.RawMessage(`2`)}}
+	if res := n.HandleAppend(AppendRequest{Term: 1, Leader: "b", Entries: entries, LeaderCommit: 1}); !res.Success || res.LastIndex != 2 {
+		t.Errorf("response is %+v", res)
+	}
+	if n.Leader() != "b" || !reflect.DeepEqual(applied, []string{"1"}) {
+		t.Errorf("leader and applied are %s and %v", n.Leader(), applied)
+	}
+
+	if res := n.HandleAppend(AppendRequest{Term: 0, Leader: "c"}); res.Success || res.Term != 1 {
+		t.Errorf("response is %+v", res)
+	}
+	if res := n.HandleAppend(AppendRequest{Term: 1, Leader: "b", PrevLogIndex: 5, PrevLogTerm: 1}); res.Success || res.LastIndex != 2 {
+		t.Errorf("response is %+v", res)
+	}
+	if res := n.HandleAppend(AppendRequest{Term: 2, Leader: "c", PrevLogIndex: 2, PrevLogTerm: 2}); res.Success || res.LastIndex != 1 {
+		t.Errorf("response is %+v", res)
+	}
+
+	entries = []Entry{{Term: 2, Index: 2, Data: json.RawMessage(`3`)}}
+	if res := n.HandleAppend(AppendRequest{Term: 2, Leader: "c", PrevLogIndex: 1, PrevLogTerm: 1, Entries: entries, LeaderCommit: 2}); !res.Success || res.LastIndex != 2 {
+		t.Errorf("response is %+v", res)
+	}
+	if !reflect.DeepEqual(applied, []string{"1", "3"}) {
+		t.Errorf("applied is %v", applied)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-raft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := OpenFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := Open(Config{ID: "a", Peers: []string{"b", "c"}, Storage: s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := n.HandleVote(VoteRequest{Term: 2, Candidate: "b"}); !res.Granted {
+		t.Fatalf("response is %+v", res)
+	}
+	entries := []Entry{{Term: 2, Index: 1, Data: json.RawMessage(`1`)}}
+	if res := n.HandleAppend(AppendRequest{Term: 2, Leader: "b", Entries: entries}); !res.Success {
+		t.Fatalf("response is %+v", res)
+	}
+	s.Close()
+
+	// the restarted Node does not vote twice in term 2
+	s, err = OpenFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	n, err = Open(Config{ID: "a", Peers: []string{"b", "c"}, Storage: s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := n.Status(); status.Term != 2 || status.LastIndex != 1 {
+		t.Errorf("status is %+v", status)
+	}
+	if res := n.HandleVote(VoteRequest{Term: 2, Candidate: "c", LastLogIndex: 1, LastLogTerm: 2}); res.Granted {
+		t.Errorf("response is %+v, expected vote not granted", res)
+	}
+}
@@ -0,0 +1,157 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// stateFileName is the name of the file
+	// keeping the HardState of a Node
+	stateFileName = "raft-state.json"
+	// logFileName is the name of the file
+	// keeping the log entries of a Node
+	logFileName = "raft.log"
+)
+
+// HardState is the state of a Node that is saved along with its log,
+// so it does not vote twice in the same term after restarting.
+type HardState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"voted_for,omitempty"`
+}
+
+// Storage keeps the HardState and the log of a Node across restarts.
+// The Node saves them before answering requests, and before sending
+// the requests of a new term.
+type Storage interface {
+	// Load returns the saved HardState and log entries, starting
+	// with the one of index 1.
+	Load() (HardState, []Entry, error)
+	// SaveState saves the HardState, replacing the previous one.
+	SaveState(state HardState) error
+	// Append saves entries following the saved ones, replacing
+	// the saved entries of the same index or a higher one.
+	Append(entries []Entry) error
+}
+
+// FileStorage is a Storage keeping the HardState and the log of a Node
+// in files of a directory. Entries are appended to the log file, and
+// the ones they replace are discarded when it is loaded.
+type FileStorage struct {
+	// Dir is the directory containing the files
+	Dir string
+
+	// mu protects the log file
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenFileStorage opens the FileStorage of dir, creating the directory
+// and the log file if they do not exist.
+func OpenFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStorage{Dir: dir, f: f}, nil
+}
+
+// Load returns the saved HardState and log entries. A truncated last
+// entry, caused by an interrupted write, is ignored.
+func (s *FileStorage) Load() (HardState, []Entry, error) {
+	var state HardState
+	b, err := ioutil.ReadFile(filepath.Join(s.Dir, stateFileName))
+	if err == nil {
+		err = json.Unmarshal(b, &state)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return HardState{}, nil, err
+	}
+
+	f, err := os.Open(filepath.Join(s.Dir, logFileName))
+	if err != nil {
+		return HardState{}, nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	dec := json.NewDecoder(f)
+	for {
+		var entry Entry
+		err := dec.Decode(&entry)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return state, entries, nil
+		}
+		if err != nil {
+			return HardState{}, nil, err
+		}
+
+		if entry.Index == 0 || entry.Index > uint64(len(entries))+1 {
+			return HardState{}, nil, fmt.Errorf("raft log entry %d does not follow entry %d", entry.Index, len(entries))
+		}
+		entries = append(entries[:entry.Index-1], entry)
+	}
+}
+
+// SaveState writes the HardState into a temporary file,
+// and renames it once synced, so it is replaced at once.
+func (s *FileStorage) SaveState(state HardState) error {
+	// Do not check error as the HardState type does
+	// not contain types that could cause such case.
+	b, _ := json.Marshal(state)
+
+	path := filepath.Join(s.Dir, stateFileName)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Append writes entries at the end of the log file, and syncs it.
+func (s *FileStorage) Append(entries []Entry) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.f.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// Close closes the log file.
+func (s *FileStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
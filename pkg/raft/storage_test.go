@@ -0,0 +1,92 @@
+package raft
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-raft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := OpenFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, entries, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != (HardState{}) || len(entries) != 0 {
+		t.Errorf("state and entries are %+v and %v, expected empty", state, entries)
+	}
+
+	if err := s.SaveState(HardState{Term: 1, VotedFor: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveState(HardState{Term: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append([]Entry{{Term: 1, Index: 1, Data: json.RawMessage(`1`)}, {Term: 1, Index: 2, Data: json.RawMessage(`2`)}}); err != nil {
+		t.Fatal(err)
+	}
+	// replaces the entry of index 2
+	if err := s.Append([]Entry{{Term: 2, Index: 2, Data: json.RawMessage(`3`)}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a truncated entry is ignored
+	f, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(`{"term":2,"ind`))
+	f.Close()
+
+	s, err = OpenFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	state, entries, err = s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (HardState{Term: 2}); state != expected {
+		t.Errorf("state is %+v, expected %+v", state, expected)
+	}
+	expected := []Entry{{Term: 1, Index: 1, Data: json.RawMessage(`1`)}, {Term: 2, Index: 2, Data: json.RawMessage(`3`)}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("entries are %+v, expected %+v", entries, expected)
+	}
+}
+
+func TestFileStorage_Gap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "piladb-raft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := OpenFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Append([]Entry{{Term: 1, Index: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Load(); err == nil {
+		t.Error("err is nil, expected error")
+	}
+}
@@ -0,0 +1,254 @@
+// Package resp implements the subset of the Redis serialization
+// protocol (RESP) needed by a server: reading commands, either as
+// arrays of bulk strings or inline, and writing replies, and by a
+// client: writing commands and reading replies.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxLineLength is the maximum length of a read line,
+	// i.e. inline commands and headers.
+	MaxLineLength = 64 << 10
+	// MaxBulkLength is the maximum length of a read bulk string.
+	MaxBulkLength = 16 << 20
+	// MaxArgs is the maximum number of arguments of a read command.
+	MaxArgs = 1 << 16
+)
+
+// ErrProtocol is returned when a command does not follow the protocol.
+var ErrProtocol = errors.New("resp: protocol error")
+
+// Reader reads commands from a connection.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a new Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// ReadCommand reads the next command, returning its name followed by
+// its arguments. Empty inline commands are skipped. It returns io.EOF
+// if the connection is closed between commands.
+func (r *Reader) ReadCommand() ([]string, error) {
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			continue
+		}
+		if line[0] != '*' {
+			if args := strings.Fields(line); len(args) > 0 {
+				return args, nil
+			}
+			continue
+		}
+
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n > MaxArgs {
+			return nil, ErrProtocol
+		}
+		if n <= 0 {
+			continue
+		}
+
+		args := make([]string, n)
+		for i := range args {
+			if args[i], err = r.readBulk(); err != nil {
+				return nil, err
+			}
+		}
+		return args, nil
+	}
+}
+
+// Error is an error reply, such as "ERR unknown command".
+type Error string
+
+// Error returns the message of the error reply.
+func (e Error) Error() string {
+	return string(e)
+}
+
+// ReadReply reads the next reply, being it a string for simple
+// strings and bulk strings, an Error for errors, an int64 for
+// integers, nil for null bulk strings and arrays, or an []interface{}
+// of replies for arrays.
+func (r *Reader) ReadReply() (interface{}, error) {
+	line, err := r.readLine()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, ErrProtocol
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, ErrProtocol
+		}
+		return n, nil
+	case '$':
+		if line == "$-1" {
+			return nil, nil
+		}
+		return r.readBulkData(line)
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n > MaxArgs {
+			return nil, ErrProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		replies := make([]interface{}, n)
+		for i := range replies {
+			if replies[i], err = r.ReadReply(); err != nil {
+				return nil, err
+			}
+		}
+		return replies, nil
+	}
+	return nil, ErrProtocol
+}
+
+// readLine reads a line, without its line terminator.
+func (r *Reader) readLine() (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.r.ReadLine()
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		line = append(line, chunk...)
+		if len(line) > MaxLineLength {
+			return "", ErrProtocol
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// readBulk reads a bulk string, as $LENGTH\r\nDATA\r\n.
+func (r *Reader) readBulk() (string, error) {
+	line, err := r.readLine()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return "", err
+	}
+	if line == "" || line[0] != '$' {
+		return "", ErrProtocol
+	}
+	return r.readBulkData(line)
+}
+
+// readBulkData reads the data of a bulk string given its header line.
+func (r *Reader) readBulkData(line string) (string, error) {
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > MaxBulkLength {
+		return "", ErrProtocol
+	}
+
+	b := make([]byte, n+2)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	if b[n] != '\r' || b[n+1] != '\n' {
+		return "", ErrProtocol
+	}
+	return string(b[:n]), nil
+}
+
+// Writer writes replies to a connection. Replies are buffered
+// until Flush is called.
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter returns a new Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// WriteSimple writes a simple string reply, such as OK.
+func (w *Writer) WriteSimple(s string) {
+	fmt.Fprintf(w.w, "+%s\r\n", oneLine(s))
+}
+
+// WriteError writes an error reply. By convention, msg starts
+// with an uppercase error code, such as ERR.
+func (w *Writer) WriteError(msg string) {
+	fmt.Fprintf(w.w, "-%s\r\n", oneLine(msg))
+}
+
+// WriteInt writes an integer reply.
+func (w *Writer) WriteInt(n int64) {
+	fmt.Fprintf(w.w, ":%d\r\n", n)
+}
+
+// WriteBulk writes a bulk string reply.
+func (w *Writer) WriteBulk(b []byte) {
+	fmt.Fprintf(w.w, "$%d\r\n", len(b))
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+// WriteNull writes a null bulk string reply.
+func (w *Writer) WriteNull() {
+	w.w.WriteString("$-1\r\n")
+}
+
+// WriteCommand writes a command, as an array of bulk strings
+// with its name followed by its arguments.
+func (w *Writer) WriteCommand(args ...string) {
+	w.WriteArray(len(args))
+	for _, arg := range args {
+		w.WriteBulk([]byte(arg))
+	}
+}
+
+// WriteArray writes the header of an array reply
+// of n elements, which must be written after it.
+func (w *Writer) WriteArray(n int) {
+	fmt.Fprintf(w.w, "*%d\r\n", n)
+}
+
+// Flush writes the buffered replies to the connection.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// oneLine replaces the line terminators of s,
+// which are not allowed in simple strings and errors.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,139 @@
+package resp
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReader_ReadCommand(t *testing.T) {
+	input := "*2\r\n$4\r\nLLEN\r\n$6\r\ndb/foo\r\n" +
+		"\r\n" +
+		"PING\r\n" +
+		"*0\r\n" +
+		"  lpush  db/foo bar\n" +
+		"*3\r\n$5\r\nLPUSH\r\n$6\r\ndb/foo\r\n$0\r\n\r\n"
+	r := NewReader(strings.NewReader(input))
+
+	expected := [][]string{
+		{"LLEN", "db/foo"},
+		{"PING"},
+		{"lpush", "db/foo", "bar"},
+		{"LPUSH", "db/foo", ""},
+	}
+	for _, e := range expected {
+		args, err := r.ReadCommand()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(args, e) {
+			t.Errorf("args are %q, expected %q", args, e)
+		}
+	}
+
+	if _, err := r.ReadCommand(); err != io.EOF {
+		t.Errorf("err is %v, expected %v", err, io.EOF)
+	}
+}
+
+func TestReader_ReadCommand_Error(t *testing.T) {
+	inputOutput := []struct {
+		input string
+		err   error
+	}{
+		{"*x\r\n", ErrProtocol},
+		{"*1\r\n+PING\r\n", ErrProtocol},
+		{"*1\r\n$-1\r\n", ErrProtocol},
+		{"*1\r\n$4\r\nPINGPONG\r\n", ErrProtocol},
+		{"*1\r\n$33554432\r\n", ErrProtocol},
+		{"*2\r\n$4\r\nPING\r\n", io.ErrUnexpectedEOF},
+		{"*1\r\n$4\r\nPI", io.ErrUnexpectedEOF},
+		{strings.Repeat("a", MaxLineLength+1), ErrProtocol},
+	}
+
+	for _, io := range inputOutput {
+		if _, err := NewReader(strings.NewReader(io.input)).ReadCommand(); err != io.err {
+			t.Errorf("err is %v, expected %v for %q", err, io.err, io.input)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	w.WriteSimple("OK")
+	w.WriteError("ERR foo\r\nbar")
+	w.WriteInt(-42)
+	w.WriteArray(2)
+	w.WriteBulk([]byte("foo"))
+	w.WriteNull()
+	if buf.Len() != 0 {
+		t.Errorf("output is %q before flushing, expected empty", buf.String())
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "+OK\r\n-ERR foo  bar\r\n:-42\r\n*2\r\n$3\r\nfoo\r\n$-1\r\n"
+	if buf.String() != expected {
+		t.Errorf("output is %q, expected %q", buf.String(), expected)
+	}
+}
+
+func TestReader_ReadReply(t *testing.T) {
+	input := "+OK\r\n-ERR foo\r\n:-42\r\n$3\r\nfoo\r\n$-1\r\n*2\r\n$3\r\nbar\r\n*1\r\n:1\r\n*-1\r\n"
+	r := NewReader(strings.NewReader(input))
+
+	expected := []interface{}{
+		"OK",
+		Error("ERR foo"),
+		int64(-42),
+		"foo",
+		nil,
+		[]interface{}{"bar", []interface{}{int64(1)}},
+		nil,
+	}
+	for _, e := range expected {
+		reply, err := r.ReadReply()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(reply, e) {
+			t.Errorf("reply is %#v, expected %#v", reply, e)
+		}
+	}
+
+	if _, err := r.ReadReply(); err != io.ErrUnexpectedEOF {
+		t.Errorf("err is %v, expected %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestReader_ReadReply_Error(t *testing.T) {
+	for _, input := range []string{"\r\n", "?\r\n", ":x\r\n", "$x\r\n", "*x\r\n", "$3\r\nfoobar\r\n"} {
+		if _, err := NewReader(strings.NewReader(input)).ReadReply(); err != ErrProtocol {
+			t.Errorf("err is %v, expected %v for %q", err, ErrProtocol, input)
+		}
+	}
+}
+
+func TestWriter_WriteCommand(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	w.WriteCommand("LRANGE", "foo", "0", "-1")
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(&buf)
+	args, err := r.ReadCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"LRANGE", "foo", "0", "-1"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("args are %q, expected %q", args, expected)
+	}
+}
@@ -0,0 +1,286 @@
+package stack
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// Prioritizer is implemented by the elements pushed into a Heap
+// to set their priority. Elements that do not implement it have
+// priority 0.
+type Prioritizer interface {
+	Priority() float64
+}
+
+// Heap implements the Stacker interface ordering its elements by
+// priority: Pop and Peek return the element with the highest priority,
+// and the last pushed one among those with the same priority.
+// Range and Filter iterate from the last pushed element, like in a
+// Stack, so both can be rebuilt by pushing in the reverse order.
+// It is represented as a binary heap, and contains a mutex
+// to lock and unlock the access to the heap at I/O operations.
+type Heap struct {
+	items heapItems
+	// seq is the sequence number of the next pushed element
+	seq uint64
+	// version is incremented on every modification
+	version uint64
+	mux     sync.Mutex
+}
+
+// heapItem represents an element of the heap, with its
+// priority and the sequence number of its push.
+type heapItem struct {
+	data     interface{}
+	priority float64
+	seq      uint64
+	index    int
+}
+
+// heapItems implements heap.Interface, where the
+// first item has the highest priority.
+type heapItems []*heapItem
+
+func (h heapItems) Len() int { return len(h) }
+
+func (h heapItems) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq > h[j].seq
+}
+
+func (h heapItems) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *heapItems) Push(x interface{}) {
+	item := x.(*heapItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *heapItems) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// bySeq sorts heap items from the last pushed.
+type bySeq []*heapItem
+
+func (s bySeq) Len() int           { return len(s) }
+func (s bySeq) Less(i, j int) bool { return s[i].seq > s[j].seq }
+func (s bySeq) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// byPriority sorts heap items in the order they are popped,
+// without updating their index, unlike heapItems.
+type byPriority []*heapItem
+
+func (s byPriority) Len() int           { return len(s) }
+func (s byPriority) Less(i, j int) bool { return heapItems(s).Less(i, j) }
+func (s byPriority) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// NewHeap returns a blank heap.
+func NewHeap() *Heap {
+	return &Heap{}
+}
+
+// Push adds a new element into the heap, with the
+// priority given by Prioritizer, if implemented.
+func (h *Heap) Push(element interface{}) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	h.push(element)
+}
+
+// PushIf adds a new element into the heap only if fn returns true
+// for the version of the heap, which are checked and pushed
+// atomically. It returns false if fn returned false.
+// The heap is locked while fn is called, so fn must not access it.
+func (h *Heap) PushIf(element interface{}, fn func(version uint64) bool) bool {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if !fn(h.version) {
+		return false
+	}
+	h.push(element)
+	return true
+}
+
+// push adds a new element into the heap, which must be locked.
+func (h *Heap) push(element interface{}) {
+	item := &heapItem{data: element, seq: h.seq}
+	if p, ok := element.(Prioritizer); ok {
+		item.priority = p.Priority()
+	}
+	h.seq++
+	h.version++
+	heap.Push(&h.items, item)
+}
+
+// Pop removes and returns the element with the highest
+// priority. If the heap was empty, it returns false.
+func (h *Heap) Pop() (interface{}, bool) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if len(h.items) == 0 {
+		return nil, false
+	}
+	h.version++
+	return heap.Pop(&h.items).(*heapItem).data, true
+}
+
+// PopIf removes and returns the element with the highest priority
+// only if fn returns true for it and the version of the heap, which
+// are checked and popped atomically. It returns false if the heap
+// was empty or fn returned false.
+// The heap is locked while fn is called, so fn must not access it.
+func (h *Heap) PopIf(fn func(element interface{}, version uint64) bool) (interface{}, bool) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if len(h.items) == 0 || !fn(h.items[0].data, h.version) {
+		return nil, false
+	}
+	h.version++
+	return heap.Pop(&h.items).(*heapItem).data, true
+}
+
+// PopLast removes and returns the last pushed element
+// of the heap. If the heap was empty, it returns false.
+func (h *Heap) PopLast() (interface{}, bool) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if len(h.items) == 0 {
+		return nil, false
+	}
+
+	last := h.items[0]
+	for _, item := range h.items {
+		if item.seq > last.seq {
+			last = item
+		}
+	}
+	h.version++
+	return heap.Remove(&h.items, last.index).(*heapItem).data, true
+}
+
+// Size returns the number of elements that a heap contains.
+func (h *Heap) Size() int {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	return len(h.items)
+}
+
+// Peek returns the element with the highest priority.
+func (h *Heap) Peek() interface{} {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if len(h.items) == 0 {
+		return nil
+	}
+	return h.items[0].data
+}
+
+// Flush flushes the content of the heap.
+func (h *Heap) Flush() {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	h.items = nil
+	h.version++
+}
+
+// Version returns the number of modifications of the heap.
+func (h *Heap) Version() uint64 {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	return h.version
+}
+
+// sorted returns the items of the heap from the last pushed.
+func (h *Heap) sorted() []*heapItem {
+	items := make([]*heapItem, len(h.items))
+	copy(items, h.items)
+	sort.Sort(bySeq(items))
+	return items
+}
+
+// Range calls fn for each element of the heap, starting
+// from the last pushed. Iteration stops if fn returns false.
+// The heap is locked during the iteration, so fn must not
+// modify it.
+func (h *Heap) Range(fn func(element interface{}) bool) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	for _, item := range h.sorted() {
+		if !fn(item.data) {
+			return
+		}
+	}
+}
+
+// Slice returns up to limit elements of the heap, starting from
+// the one with the highest priority and skipping the first offset
+// ones. Unlike Range, it needs to sort a copy of the heap.
+func (h *Heap) Slice(offset, limit int) []interface{} {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	elements := make([]interface{}, 0, sliceCap(len(h.items), offset, limit))
+	if offset >= len(h.items) {
+		return elements
+	}
+
+	items := make([]*heapItem, len(h.items))
+	copy(items, h.items)
+	sort.Sort(byPriority(items))
+	for _, item := range items[offset:] {
+		if len(elements) == limit {
+			break
+		}
+		elements = append(elements, item.data)
+	}
+	return elements
+}
+
+// Filter removes the elements of the heap for which fn returns
+// false, starting from the last pushed, and returns the number of
+// removed elements.
+// The heap is locked during the iteration, so fn must not
+// modify it.
+func (h *Heap) Filter(fn func(element interface{}) bool) int {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	kept := make(heapItems, 0, len(h.items))
+	for _, item := range h.sorted() {
+		if fn(item.data) {
+			item.index = len(kept)
+			kept = append(kept, item)
+		}
+	}
+
+	removed := len(h.items) - len(kept)
+	h.items = kept
+	heap.Init(&h.items)
+	if removed > 0 {
+		h.version++
+	}
+	return removed
+}
@@ -0,0 +1,195 @@
+package stack
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// prioritized is an element with a priority.
+type prioritized struct {
+	value    string
+	priority float64
+}
+
+func (p prioritized) Priority() float64 {
+	return p.priority
+}
+
+func TestHeapStacker(t *testing.T) {
+	var _ Stacker = NewHeap()
+}
+
+func TestHeapPushPop(t *testing.T) {
+	h := NewHeap()
+	h.Push(prioritized{"low", -1})
+	h.Push("zero")
+	h.Push(prioritized{"high", 5})
+	h.Push(prioritized{"mid", 2})
+	h.Push(prioritized{"mid2", 2})
+
+	if h.Size() != 5 {
+		t.Errorf("h.Size() is %v, expected %v", h.Size(), 5)
+	}
+	if peek := h.Peek(); peek != (prioritized{"high", 5}) {
+		t.Errorf("h.Peek() is %v, expected %v", peek, prioritized{"high", 5})
+	}
+
+	expected := []interface{}{
+		prioritized{"high", 5},
+		prioritized{"mid2", 2},
+		prioritized{"mid", 2},
+		"zero",
+		prioritized{"low", -1},
+	}
+	for _, e := range expected {
+		element, ok := h.Pop()
+		if !ok {
+			t.Fatal("h.Pop() not ok")
+		}
+		if element != e {
+			t.Errorf("element is %v, expected %v", element, e)
+		}
+	}
+
+	if _, ok := h.Pop(); ok {
+		t.Error("h.Pop() is ok")
+	}
+	if h.Peek() != nil {
+		t.Errorf("h.Peek() is %v, expected nil", h.Peek())
+	}
+}
+
+func TestHeapPopLast(t *testing.T) {
+	h := NewHeap()
+	h.Push(prioritized{"high", 5})
+	h.Push(prioritized{"low", 1})
+
+	if element, ok := h.PopLast(); !ok || element != (prioritized{"low", 1}) {
+		t.Errorf("element is %v, expected %v", element, prioritized{"low", 1})
+	}
+	if element, ok := h.PopLast(); !ok || element != (prioritized{"high", 5}) {
+		t.Errorf("element is %v, expected %v", element, prioritized{"high", 5})
+	}
+	if _, ok := h.PopLast(); ok {
+		t.Error("h.PopLast() is ok")
+	}
+}
+
+func TestHeap_Concurrent(t *testing.T) {
+	h := NewHeap()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			h.Push(prioritized{"foo", float64(i)})
+			h.Peek()
+		}(i)
+	}
+	wg.Wait()
+
+	if h.Size() != 100 {
+		t.Errorf("h.Size() is %v, expected %v", h.Size(), 100)
+	}
+	if element, _ := h.Pop(); element != (prioritized{"foo", 99}) {
+		t.Errorf("element is %v, expected %v", element, prioritized{"foo", 99})
+	}
+}
+
+func TestHeapFlush(t *testing.T) {
+	h := NewHeap()
+	h.Push(1)
+	h.Push(2)
+	h.Flush()
+
+	if h.Size() != 0 {
+		t.Errorf("h.Size() is %v, expected %v", h.Size(), 0)
+	}
+	if h.Peek() != nil {
+		t.Errorf("h.Peek() is %v, expected nil", h.Peek())
+	}
+}
+
+func TestHeapRange(t *testing.T) {
+	h := NewHeap()
+	h.Push(prioritized{"a", 1})
+	h.Push(prioritized{"b", 3})
+	h.Push(prioritized{"c", 2})
+
+	var elements []interface{}
+	h.Range(func(element interface{}) bool {
+		elements = append(elements, element.(prioritized).value)
+		return element.(prioritized).value != "b"
+	})
+
+	if expected := []interface{}{"c", "b"}; !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+}
+
+func TestHeapFilter(t *testing.T) {
+	h := NewHeap()
+	for i := 1; i <= 5; i++ {
+		h.Push(prioritized{"foo", float64(i)})
+	}
+
+	removed := h.Filter(func(element interface{}) bool {
+		return int(element.(prioritized).priority)%2 == 1
+	})
+
+	if removed != 2 {
+		t.Errorf("removed is %v, expected %v", removed, 2)
+	}
+	if h.Size() != 3 {
+		t.Errorf("h.Size() is %v, expected %v", h.Size(), 3)
+	}
+	for _, expected := range []float64{5, 3, 1} {
+		if element, _ := h.Pop(); element.(prioritized).priority != expected {
+			t.Errorf("priority is %v, expected %v", element.(prioritized).priority, expected)
+		}
+	}
+}
+
+func TestHeapSlice(t *testing.T) {
+	h := NewHeap()
+	h.Push(prioritized{"a", 1})
+	h.Push(prioritized{"b", 3})
+	h.Push(prioritized{"c", 2})
+	h.Push(prioritized{"d", 3})
+
+	inputOutput := []struct {
+		offset, limit int
+		output        []interface{}
+	}{
+		{0, 10, []interface{}{prioritized{"d", 3}, prioritized{"b", 3}, prioritized{"c", 2}, prioritized{"a", 1}}},
+		{1, 2, []interface{}{prioritized{"b", 3}, prioritized{"c", 2}}},
+		{3, 2, []interface{}{prioritized{"a", 1}}},
+		{5, 2, []interface{}{}},
+		{0, 0, []interface{}{}},
+	}
+
+	for _, io := range inputOutput {
+		if elements := h.Slice(io.offset, io.limit); !reflect.DeepEqual(elements, io.output) {
+			t.Errorf("elements are %v, expected %v", elements, io.output)
+		}
+	}
+
+	if element, _ := h.Pop(); element != (prioritized{"d", 3}) {
+		t.Errorf("element is %v, expected %v", element, prioritized{"d", 3})
+	}
+}
+
+func TestHeapVersionPopIf(t *testing.T) {
+	testVersionPopIf(t, NewHeap())
+}
+
+func BenchmarkHeapPushPop(b *testing.B) {
+	h := NewHeap()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		h.Push(prioritized{"element", float64(i % 10)})
+		h.Pop()
+	}
+}
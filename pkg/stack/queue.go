@@ -0,0 +1,256 @@
+package stack
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Queue implements the Stacker interface with FIFO semantics: Pop
+// and Peek return the first pushed element instead of the last one.
+// Range and Filter iterate from the last pushed element, like in a
+// Stack, so both can be rebuilt by pushing in the reverse order.
+// It is represented as a doubly linked list, and contains a mutex
+// to lock and unlock the access to the queue at I/O operations.
+type Queue struct {
+	elements *list.List
+	// version is incremented on every modification
+	version uint64
+	mux     sync.Mutex
+}
+
+// NewQueue returns a blank queue.
+func NewQueue() *Queue {
+	return &Queue{elements: list.New()}
+}
+
+// Push adds a new element at the back of the queue.
+func (q *Queue) Push(element interface{}) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	q.elements.PushBack(element)
+	q.version++
+}
+
+// PushIf adds a new element at the back of the queue only if fn
+// returns true for the version of the queue, which are checked and
+// pushed atomically. It returns false if fn returned false.
+// The queue is locked while fn is called, so fn must not access it.
+func (q *Queue) PushIf(element interface{}, fn func(version uint64) bool) bool {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if !fn(q.version) {
+		return false
+	}
+	q.elements.PushBack(element)
+	q.version++
+	return true
+}
+
+// PushFront adds a new element at the front of the queue,
+// so it is the next one to be popped.
+func (q *Queue) PushFront(element interface{}) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	q.elements.PushFront(element)
+	q.version++
+}
+
+// Pop removes and returns the element at the front of the
+// queue. If the queue was empty, it returns false.
+func (q *Queue) Pop() (interface{}, bool) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	front := q.elements.Front()
+	if front == nil {
+		return nil, false
+	}
+	q.version++
+	return q.elements.Remove(front), true
+}
+
+// PopIf removes and returns the element at the front of the queue
+// only if fn returns true for it and the version of the queue,
+// which are checked and popped atomically. It returns false if the
+// queue was empty or fn returned false.
+// The queue is locked while fn is called, so fn must not access it.
+func (q *Queue) PopIf(fn func(element interface{}, version uint64) bool) (interface{}, bool) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	front := q.elements.Front()
+	if front == nil || !fn(front.Value, q.version) {
+		return nil, false
+	}
+	q.version++
+	return q.elements.Remove(front), true
+}
+
+// PopLast removes and returns the element at the back of the
+// queue, i.e. the last pushed one. If the queue was empty, it
+// returns false.
+func (q *Queue) PopLast() (interface{}, bool) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	back := q.elements.Back()
+	if back == nil {
+		return nil, false
+	}
+	q.version++
+	return q.elements.Remove(back), true
+}
+
+// Rotate moves the element at the front of the queue to its
+// back, and returns it. If the queue was empty, it returns false.
+func (q *Queue) Rotate() (interface{}, bool) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	front := q.elements.Front()
+	if front == nil {
+		return nil, false
+	}
+	q.elements.MoveToBack(front)
+	q.version++
+	return front.Value, true
+}
+
+// Base returns the element at the back of the queue.
+func (q *Queue) Base() interface{} {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	back := q.elements.Back()
+	if back == nil {
+		return nil
+	}
+	return back.Value
+}
+
+// Sweep removes and returns the element at the back of
+// the queue, like PopLast.
+func (q *Queue) Sweep() (interface{}, bool) {
+	return q.PopLast()
+}
+
+// Reorder calls fn with the elements of the queue, starting from the
+// front, and stores them in the order fn leaves them, unless it returns
+// an error, which is returned.
+// The queue is locked while fn is called, so fn must not access it.
+func (q *Queue) Reorder(fn func(elements []interface{}) error) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	elements := make([]interface{}, 0, q.elements.Len())
+	for e := q.elements.Front(); e != nil; e = e.Next() {
+		elements = append(elements, e.Value)
+	}
+	if err := fn(elements); err != nil {
+		return err
+	}
+
+	e := q.elements.Front()
+	for _, element := range elements {
+		e.Value = element
+		e = e.Next()
+	}
+	q.version++
+	return nil
+}
+
+// Size returns the number of elements that a queue contains.
+func (q *Queue) Size() int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	return q.elements.Len()
+}
+
+// Peek returns the element at the front of the queue.
+func (q *Queue) Peek() interface{} {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	front := q.elements.Front()
+	if front == nil {
+		return nil
+	}
+	return front.Value
+}
+
+// Flush flushes the content of the queue.
+func (q *Queue) Flush() {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	q.elements.Init()
+	q.version++
+}
+
+// Version returns the number of modifications of the queue.
+func (q *Queue) Version() uint64 {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	return q.version
+}
+
+// Range calls fn for each element of the queue, starting
+// from the back. Iteration stops if fn returns false.
+// The queue is locked during the iteration, so fn must not
+// modify it.
+func (q *Queue) Range(fn func(element interface{}) bool) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	for e := q.elements.Back(); e != nil; e = e.Prev() {
+		if !fn(e.Value) {
+			return
+		}
+	}
+}
+
+// Slice returns up to limit elements of the queue, starting
+// from the front and skipping the first offset ones.
+func (q *Queue) Slice(offset, limit int) []interface{} {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	elements := make([]interface{}, 0, sliceCap(q.elements.Len(), offset, limit))
+	for e := q.elements.Front(); e != nil && len(elements) < limit; e = e.Next() {
+		if offset > 0 {
+			offset--
+			continue
+		}
+		elements = append(elements, e.Value)
+	}
+	return elements
+}
+
+// Filter removes the elements of the queue for which fn returns
+// false, starting from the back and keeping the order of the rest
+// of them, and returns the number of removed elements.
+// The queue is locked during the iteration, so fn must not
+// modify it.
+func (q *Queue) Filter(fn func(element interface{}) bool) int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	removed := 0
+	for e := q.elements.Back(); e != nil; {
+		prev := e.Prev()
+		if !fn(e.Value) {
+			q.elements.Remove(e)
+			removed++
+		}
+		e = prev
+	}
+	if removed > 0 {
+		q.version++
+	}
+	return removed
+}
@@ -0,0 +1,255 @@
+package stack
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// values returns the elements of the queue, from front to back.
+func (q *Queue) values() []interface{} {
+	var values []interface{}
+	for e := q.elements.Front(); e != nil; e = e.Next() {
+		values = append(values, e.Value)
+	}
+	return values
+}
+
+func TestQueueStacker(t *testing.T) {
+	var _ Stacker = NewQueue()
+}
+
+func TestQueuePushPop(t *testing.T) {
+	queue := NewQueue()
+	queue.Push("foo")
+	queue.Push(8)
+	queue.Push("bar")
+
+	if queue.Size() != 3 {
+		t.Errorf("queue.Size() is %v, expected %v", queue.Size(), 3)
+	}
+	if queue.Peek() != "foo" {
+		t.Errorf("queue.Peek() is %v, expected %v", queue.Peek(), "foo")
+	}
+
+	for _, expected := range []interface{}{"foo", 8, "bar"} {
+		element, ok := queue.Pop()
+		if !ok {
+			t.Fatal("queue.Pop() not ok")
+		}
+		if element != expected {
+			t.Errorf("element is %v, expected %v", element, expected)
+		}
+	}
+
+	if _, ok := queue.Pop(); ok {
+		t.Error("queue.Pop() is ok")
+	}
+	if queue.Peek() != nil {
+		t.Errorf("queue.Peek() is %v, expected nil", queue.Peek())
+	}
+}
+
+func TestQueuePushFrontPopLast(t *testing.T) {
+	queue := NewQueue()
+	queue.Push("foo")
+	queue.PushFront("bar")
+
+	if expected := []interface{}{"bar", "foo"}; !reflect.DeepEqual(queue.values(), expected) {
+		t.Errorf("queue is %v, expected %v", queue.values(), expected)
+	}
+
+	if element, ok := queue.PopLast(); !ok || element != "foo" {
+		t.Errorf("element is %v, expected %v", element, "foo")
+	}
+	if element, ok := queue.PopLast(); !ok || element != "bar" {
+		t.Errorf("element is %v, expected %v", element, "bar")
+	}
+	if _, ok := queue.PopLast(); ok {
+		t.Error("queue.PopLast() is ok")
+	}
+}
+
+func TestQueue_Concurrent(t *testing.T) {
+	queue := NewQueue()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			queue.Push(i)
+			queue.Peek()
+		}(i)
+	}
+	wg.Wait()
+
+	if queue.Size() != 100 {
+		t.Errorf("queue.Size() is %v, expected %v", queue.Size(), 100)
+	}
+}
+
+func TestQueueFlush(t *testing.T) {
+	queue := NewQueue()
+	queue.Push(1)
+	queue.Push(2)
+	queue.Flush()
+
+	if queue.Size() != 0 {
+		t.Errorf("queue.Size() is %v, expected %v", queue.Size(), 0)
+	}
+	if queue.Peek() != nil {
+		t.Errorf("queue.Peek() is %v, expected nil", queue.Peek())
+	}
+}
+
+func TestQueueRange(t *testing.T) {
+	queue := NewQueue()
+	for i := 1; i <= 3; i++ {
+		queue.Push(i)
+	}
+
+	var elements []interface{}
+	queue.Range(func(element interface{}) bool {
+		elements = append(elements, element)
+		return element != 2
+	})
+
+	if expected := []interface{}{3, 2}; !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+}
+
+func TestQueueFilter(t *testing.T) {
+	queue := NewQueue()
+	for i := 1; i <= 5; i++ {
+		queue.Push(i)
+	}
+
+	removed := queue.Filter(func(element interface{}) bool {
+		return element.(int)%2 == 1
+	})
+
+	if removed != 2 {
+		t.Errorf("removed is %v, expected %v", removed, 2)
+	}
+	if expected := []interface{}{1, 3, 5}; !reflect.DeepEqual(queue.values(), expected) {
+		t.Errorf("queue is %v, expected %v", queue.values(), expected)
+	}
+	if queue.Size() != 3 {
+		t.Errorf("queue.Size() is %v, expected %v", queue.Size(), 3)
+	}
+}
+
+func TestQueueRotator(t *testing.T) {
+	var _ Rotator = NewQueue()
+}
+
+func TestQueueRotateBaseSweep(t *testing.T) {
+	queue := NewQueue()
+	if _, ok := queue.Rotate(); ok {
+		t.Error("queue.Rotate() is ok")
+	}
+	if queue.Base() != nil {
+		t.Errorf("queue.Base() is %v, expected nil", queue.Base())
+	}
+
+	queue.Push("one")
+	queue.Push("two")
+	queue.Push("three")
+
+	if element, ok := queue.Rotate(); !ok || element != "one" {
+		t.Errorf("element is %v, expected %v", element, "one")
+	}
+	if expected := []interface{}{"two", "three", "one"}; !reflect.DeepEqual(queue.values(), expected) {
+		t.Errorf("queue is %v, expected %v", queue.values(), expected)
+	}
+	if queue.Base() != "one" {
+		t.Errorf("queue.Base() is %v, expected %v", queue.Base(), "one")
+	}
+	if element, ok := queue.Sweep(); !ok || element != "one" {
+		t.Errorf("element is %v, expected %v", element, "one")
+	}
+	if queue.Peek() != "two" || queue.Size() != 2 {
+		t.Errorf("queue has peek %v and size %v, expected %v and %v", queue.Peek(), queue.Size(), "two", 2)
+	}
+}
+
+func TestQueueReorderer(t *testing.T) {
+	var _ Reorderer = NewQueue()
+}
+
+func TestQueueReorder(t *testing.T) {
+	queue := NewQueue()
+	queue.Push("one")
+	queue.Push("two")
+	queue.Push("three")
+	version := queue.Version()
+
+	err := queue.Reorder(func(elements []interface{}) error {
+		if expected := []interface{}{"one", "two", "three"}; !reflect.DeepEqual(elements, expected) {
+			t.Errorf("elements are %v, expected %v", elements, expected)
+		}
+		elements[0], elements[2] = elements[2], elements[0]
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []interface{}{"three", "two", "one"}; !reflect.DeepEqual(queue.values(), expected) {
+		t.Errorf("queue is %v, expected %v", queue.values(), expected)
+	}
+	if queue.Version() != version+1 {
+		t.Errorf("queue.Version() is %v, expected %v", queue.Version(), version+1)
+	}
+
+	expectedErr := errors.New("not reordered")
+	err = queue.Reorder(func(elements []interface{}) error {
+		elements[0] = "four"
+		return expectedErr
+	})
+	if err != expectedErr {
+		t.Errorf("err is %v, expected %v", err, expectedErr)
+	}
+	if expected := []interface{}{"three", "two", "one"}; !reflect.DeepEqual(queue.values(), expected) {
+		t.Errorf("queue is %v, expected %v", queue.values(), expected)
+	}
+}
+
+func TestQueueSlice(t *testing.T) {
+	queue := NewQueue()
+	for i := 1; i <= 4; i++ {
+		queue.Push(i)
+	}
+
+	inputOutput := []struct {
+		offset, limit int
+		output        []interface{}
+	}{
+		{0, 10, []interface{}{1, 2, 3, 4}},
+		{1, 2, []interface{}{2, 3}},
+		{3, 2, []interface{}{4}},
+		{5, 2, []interface{}{}},
+		{0, 0, []interface{}{}},
+	}
+
+	for _, io := range inputOutput {
+		if elements := queue.Slice(io.offset, io.limit); !reflect.DeepEqual(elements, io.output) {
+			t.Errorf("elements are %v, expected %v", elements, io.output)
+		}
+	}
+}
+
+func TestQueueVersionPopIf(t *testing.T) {
+	testVersionPopIf(t, NewQueue())
+}
+
+func BenchmarkQueuePushPop(b *testing.B) {
+	q := NewQueue()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		q.Push(i)
+		q.Pop()
+	}
+}
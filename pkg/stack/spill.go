@@ -0,0 +1,474 @@
+package stack
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// errSpillClosed is returned when accessing the
+// spilled elements of a closed SpillStack.
+var errSpillClosed = errors.New("spill file is closed")
+
+// errSpillCorrupted is returned when an element stored
+// in the file of a SpillStack can not be located.
+var errSpillCorrupted = errors.New("spill file is corrupted")
+
+// recordHeader is the size in bytes of the header of an element stored
+// in the file of a SpillStack, which contains the length of its data.
+const recordHeader = 4
+
+// Codec encodes and decodes the elements of a
+// SpillStack stored in its file.
+type Codec interface {
+	Encode(element interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// SpillStack implements the Stacker interface with LIFO semantics, like
+// Stack, but keeps in memory only the topmost elements: once they are
+// twice k, the bottommost ones are spilled into a file, keeping k of
+// them, and they are paged in k at a time when the ones in memory are
+// popped. Elements are stored in the file one after another, the
+// topmost last, so spilling and paging in only append to and truncate
+// the end of the file.
+// If the file can not be written, elements are kept in memory, and if
+// it can not be read, the stack behaves as if it was empty. Err
+// returns the first of such errors.
+type SpillStack struct {
+	// top holds the elements in memory, the topmost last
+	top []interface{}
+	// offsets are the positions of the spilled
+	// elements in the file, the topmost last
+	offsets []int64
+	// end is the size of the file
+	end   int64
+	file  *os.File
+	path  string
+	codec Codec
+	k     int
+	err   error
+	// version is incremented on every modification
+	version uint64
+	mux     sync.Mutex
+}
+
+// NewSpillStack returns a blank stack keeping at least k elements in
+// memory, which spills the rest of them into a new file created in dir,
+// encoded with codec.
+func NewSpillStack(dir string, k int, codec Codec) (*SpillStack, error) {
+	if k < 1 {
+		k = 1
+	}
+	file, err := ioutil.TempFile(dir, "piladb-stack-")
+	if err != nil {
+		return nil, err
+	}
+	return &SpillStack{file: file, path: file.Name(), codec: codec, k: k}, nil
+}
+
+// K returns the minimum number of elements kept in memory,
+// unless the stack has less elements.
+func (s *SpillStack) K() int {
+	return s.k
+}
+
+// Path returns the path of the file of the stack.
+func (s *SpillStack) Path() string {
+	return s.path
+}
+
+// Err returns the first error on writing or reading
+// the file of the stack, if any.
+func (s *SpillStack) Err() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.err
+}
+
+// Spilled returns the number of elements stored in the file.
+func (s *SpillStack) Spilled() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return len(s.offsets)
+}
+
+// Close closes and removes the file of the stack. Spilled elements are
+// lost, and the following ones are kept in memory.
+func (s *SpillStack) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	if rmErr := os.Remove(s.path); err == nil {
+		err = rmErr
+	}
+	s.file = nil
+	s.offsets, s.end = nil, 0
+	return err
+}
+
+// Push adds a new element on top of the stack,
+// spilling the bottommost ones if needed.
+func (s *SpillStack) Push(element interface{}) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.push(element)
+}
+
+// PushIf adds a new element on top of the stack only if fn returns
+// true for the version of the stack, which are checked and pushed
+// atomically. It returns false if fn returned false.
+// The stack is locked while fn is called, so fn must not access it.
+func (s *SpillStack) PushIf(element interface{}, fn func(version uint64) bool) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if !fn(s.version) {
+		return false
+	}
+	s.push(element)
+	return true
+}
+
+// push adds a new element on top of the stack, which
+// must be locked, spilling the bottommost ones if needed.
+func (s *SpillStack) push(element interface{}) {
+	s.top = append(s.top, element)
+	if len(s.top) >= 2*s.k {
+		s.spill(len(s.top) - s.k)
+	}
+	s.version++
+}
+
+// Pop removes and returns the element on top of the stack.
+// If the stack was empty, it returns false.
+func (s *SpillStack) Pop() (interface{}, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if !s.ensureTop() {
+		return nil, false
+	}
+	return s.pop(), true
+}
+
+// PopIf removes and returns the element on top of the stack only if
+// fn returns true for it and the version of the stack, which are
+// checked and popped atomically. It returns false if the stack was
+// empty or fn returned false.
+// The stack is locked while fn is called, so fn must not access it.
+func (s *SpillStack) PopIf(fn func(element interface{}, version uint64) bool) (interface{}, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if !s.ensureTop() || !fn(s.top[len(s.top)-1], s.version) {
+		return nil, false
+	}
+	return s.pop(), true
+}
+
+// pop removes and returns the element on top of the stack,
+// which must be locked and have elements in memory.
+func (s *SpillStack) pop() interface{} {
+	last := len(s.top) - 1
+	element := s.top[last]
+	s.top[last] = nil
+	s.top = s.top[:last]
+	s.version++
+	return element
+}
+
+// Size returns the number of elements that a stack contains.
+func (s *SpillStack) Size() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return len(s.top) + len(s.offsets)
+}
+
+// Peek returns the element on top of the stack.
+func (s *SpillStack) Peek() interface{} {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if !s.ensureTop() {
+		return nil
+	}
+	return s.top[len(s.top)-1]
+}
+
+// Flush flushes the content of the stack, truncating its file.
+func (s *SpillStack) Flush() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.top = nil
+	if s.file != nil && len(s.offsets) > 0 {
+		s.setErr(s.file.Truncate(0))
+	}
+	s.offsets, s.end = nil, 0
+	s.version++
+}
+
+// Version returns the number of modifications of the stack.
+func (s *SpillStack) Version() uint64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.version
+}
+
+// Range calls fn for each element of the stack, starting from
+// the top. Iteration stops if fn returns false. Spilled elements
+// are read one at a time, without paging them in.
+// The stack is locked during the iteration, so fn must not
+// modify it.
+func (s *SpillStack) Range(fn func(element interface{}) bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.each(fn)
+}
+
+// Slice returns up to limit elements of the stack, starting
+// from the top and skipping the first offset ones.
+func (s *SpillStack) Slice(offset, limit int) []interface{} {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	elements := make([]interface{}, 0, sliceCap(len(s.top)+len(s.offsets), offset, limit))
+	if limit <= 0 {
+		return elements
+	}
+	s.each(func(element interface{}) bool {
+		if offset > 0 {
+			offset--
+			return true
+		}
+		elements = append(elements, element)
+		return len(elements) < limit
+	})
+	return elements
+}
+
+// Filter removes the elements of the stack for which fn returns
+// false, keeping the order of the rest of them, and returns the
+// number of removed elements. The file is compacted in place, and
+// spilled elements that can not be read are kept.
+// The stack is locked during the iteration, so fn must not
+// modify it.
+func (s *SpillStack) Filter(fn func(element interface{}) bool) int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	removed := 0
+	kept := s.top[:0]
+	for _, element := range s.top {
+		if fn(element) {
+			kept = append(kept, element)
+			continue
+		}
+		removed++
+	}
+	for i := len(kept); i < len(s.top); i++ {
+		s.top[i] = nil
+	}
+	s.top = kept
+
+	if len(s.offsets) > 0 {
+		removed += s.filterFile(fn)
+	}
+	if removed > 0 {
+		s.version++
+	}
+	return removed
+}
+
+// filterFile removes the spilled elements for which fn returns false,
+// moving the kept ones towards the beginning of the file, which is
+// safe as every element is read before it is overwritten. If it fails,
+// the elements not moved yet stay where they were, as elements are
+// located by their offset and header, so gaps between them are fine.
+func (s *SpillStack) filterFile(fn func(element interface{}) bool) int {
+	removed := 0
+	offsets := s.offsets[:0]
+	var w int64
+	for i := range s.offsets {
+		data, err := s.record(i)
+		if err != nil {
+			s.setErr(err)
+			s.offsets = append(offsets, s.offsets[i:]...)
+			return removed
+		}
+
+		element, err := s.codec.Decode(data[recordHeader:])
+		if err == nil && !fn(element) {
+			removed++
+			continue
+		}
+		if w != s.offsets[i] {
+			if _, err := s.file.WriteAt(data, w); err != nil {
+				s.setErr(err)
+				s.offsets = append(offsets, s.offsets[i:]...)
+				return removed
+			}
+		}
+		offsets = append(offsets, w)
+		w += int64(len(data))
+	}
+
+	s.offsets, s.end = offsets, w
+	s.setErr(s.file.Truncate(w))
+	return removed
+}
+
+// each calls fn for each element of the locked stack,
+// starting from the top, until it returns false.
+func (s *SpillStack) each(fn func(element interface{}) bool) {
+	for i := len(s.top) - 1; i >= 0; i-- {
+		if !fn(s.top[i]) {
+			return
+		}
+	}
+	for i := len(s.offsets) - 1; i >= 0; i-- {
+		data, err := s.record(i)
+		var element interface{}
+		if err == nil {
+			element, err = s.codec.Decode(data[recordHeader:])
+		}
+		if err != nil {
+			s.setErr(err)
+			return
+		}
+		if !fn(element) {
+			return
+		}
+	}
+}
+
+// spill writes the n bottommost elements in memory at the end of
+// the file. If it fails, they are kept in memory.
+func (s *SpillStack) spill(n int) {
+	if s.file == nil {
+		return
+	}
+
+	var buf []byte
+	offsets := make([]int64, 0, n)
+	for _, element := range s.top[:n] {
+		data, err := s.codec.Encode(element)
+		if err != nil {
+			s.setErr(err)
+			return
+		}
+		offsets = append(offsets, s.end+int64(len(buf)))
+		var header [recordHeader]byte
+		binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+		buf = append(buf, header[:]...)
+		buf = append(buf, data...)
+	}
+	if _, err := s.file.WriteAt(buf, s.end); err != nil {
+		s.setErr(err)
+		return
+	}
+
+	s.offsets = append(s.offsets, offsets...)
+	s.end += int64(len(buf))
+	// copy the rest, so the spilled elements can be released
+	top := make([]interface{}, len(s.top)-n, 2*s.k)
+	copy(top, s.top[n:])
+	s.top = top
+}
+
+// ensureTop pages in up to k spilled elements if there is none in
+// memory, and returns false if the stack has no element in memory.
+func (s *SpillStack) ensureTop() bool {
+	if len(s.top) > 0 {
+		return true
+	}
+	if len(s.offsets) == 0 {
+		return false
+	}
+	if s.file == nil {
+		s.setErr(errSpillClosed)
+		return false
+	}
+
+	first := len(s.offsets) - s.k
+	if first < 0 {
+		first = 0
+	}
+	start := s.offsets[first]
+	buf := make([]byte, s.end-start)
+	if _, err := s.file.ReadAt(buf, start); err != nil {
+		s.setErr(err)
+		return false
+	}
+
+	top := make([]interface{}, 0, 2*s.k)
+	for i := first; i < len(s.offsets); i++ {
+		data, err := recordData(buf[s.offsets[i]-start:])
+		var element interface{}
+		if err == nil {
+			element, err = s.codec.Decode(data)
+		}
+		if err != nil {
+			s.setErr(err)
+			return false
+		}
+		top = append(top, element)
+	}
+	if err := s.file.Truncate(start); err != nil {
+		s.setErr(err)
+		return false
+	}
+
+	s.top = top
+	s.offsets, s.end = s.offsets[:first], start
+	return true
+}
+
+// record reads the i-th spilled element, with its header.
+func (s *SpillStack) record(i int) ([]byte, error) {
+	if s.file == nil {
+		return nil, errSpillClosed
+	}
+	var header [recordHeader]byte
+	if _, err := s.file.ReadAt(header[:], s.offsets[i]); err != nil {
+		return nil, err
+	}
+	data := make([]byte, recordHeader+binary.BigEndian.Uint32(header[:]))
+	if _, err := s.file.ReadAt(data, s.offsets[i]); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// recordData returns the data of the element
+// stored at the beginning of buf.
+func recordData(buf []byte) ([]byte, error) {
+	if len(buf) < recordHeader {
+		return nil, errSpillCorrupted
+	}
+	n := int64(binary.BigEndian.Uint32(buf))
+	if int64(len(buf)-recordHeader) < n {
+		return nil, errSpillCorrupted
+	}
+	return buf[recordHeader : recordHeader+n], nil
+}
+
+// setErr keeps err if it is the first error of the stack.
+func (s *SpillStack) setErr(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
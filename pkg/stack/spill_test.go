@@ -0,0 +1,246 @@
+package stack
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// jsonCodec encodes the elements of a SpillStack as JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(element interface{}) ([]byte, error) {
+	return json.Marshal(element)
+}
+
+func (jsonCodec) Decode(data []byte) (interface{}, error) {
+	var element interface{}
+	err := json.Unmarshal(data, &element)
+	return element, err
+}
+
+// failingCodec fails to encode any element.
+type failingCodec struct{ jsonCodec }
+
+func (failingCodec) Encode(element interface{}) ([]byte, error) {
+	return nil, errors.New("encoding error")
+}
+
+func newTestSpillStack(t *testing.T, k int, codec Codec) (*SpillStack, func()) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSpillStack(dir, k, codec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// fileSize returns the size of the file of the stack.
+func (s *SpillStack) fileSize(t *testing.T) int64 {
+	info, err := os.Stat(s.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestSpillStackStacker(t *testing.T) {
+	var _ Stacker = &SpillStack{}
+}
+
+func TestNewSpillStack_Error(t *testing.T) {
+	if _, err := NewSpillStack("/this/does/not/exist", 2, jsonCodec{}); err == nil {
+		t.Error("err is nil, expected an error")
+	}
+}
+
+func TestSpillStackPushPop(t *testing.T) {
+	s, cleanup := newTestSpillStack(t, 2, jsonCodec{})
+	defer cleanup()
+
+	for i := 0; i < 9; i++ {
+		s.Push(float64(i))
+	}
+
+	if size := s.Size(); size != 9 {
+		t.Errorf("size is %d, expected %d", size, 9)
+	}
+	// spilled at 4, 6 and 8 elements in memory
+	if spilled := s.Spilled(); spilled != 6 {
+		t.Errorf("spilled is %d, expected %d", spilled, 6)
+	}
+	if peek := s.Peek(); peek != float64(8) {
+		t.Errorf("peek is %v, expected %v", peek, 8)
+	}
+
+	for i := 8; i >= 0; i-- {
+		element, ok := s.Pop()
+		if !ok || element != float64(i) {
+			t.Errorf("pop is %v %t, expected %v %t", element, ok, i, true)
+		}
+	}
+	if _, ok := s.Pop(); ok {
+		t.Error("pop is ok, expected stack to be empty")
+	}
+	if size := s.fileSize(t); size != 0 {
+		t.Errorf("file size is %d, expected %d", size, 0)
+	}
+	if v := s.Version(); v != 18 {
+		t.Errorf("version is %d, expected %d", v, 18)
+	}
+	if err := s.Err(); err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+}
+
+func TestSpillStackPopIf(t *testing.T) {
+	s, cleanup := newTestSpillStack(t, 1, jsonCodec{})
+	defer cleanup()
+
+	s.Push("foo")
+	s.Push("bar")
+	s.Pop()
+
+	if _, ok := s.PopIf(func(element interface{}, version uint64) bool { return version == 1 }); ok {
+		t.Error("PopIf is ok, expected version mismatch")
+	}
+	element, ok := s.PopIf(func(element interface{}, version uint64) bool { return element == "foo" && version == 3 })
+	if !ok || element != "foo" {
+		t.Errorf("PopIf is %v %t, expected %v %t", element, ok, "foo", true)
+	}
+}
+
+func TestSpillStackRangeSlice(t *testing.T) {
+	s, cleanup := newTestSpillStack(t, 2, jsonCodec{})
+	defer cleanup()
+
+	for i := 0; i < 7; i++ {
+		s.Push(float64(i))
+	}
+
+	var elements []interface{}
+	s.Range(func(element interface{}) bool {
+		elements = append(elements, element)
+		return len(elements) < 6
+	})
+	if expected := []interface{}{6.0, 5.0, 4.0, 3.0, 2.0, 1.0}; !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+
+	inputOutput := []struct {
+		offset, limit int
+		output        []interface{}
+	}{
+		{0, 2, []interface{}{6.0, 5.0}},
+		{3, 3, []interface{}{3.0, 2.0, 1.0}},
+		{5, 10, []interface{}{1.0, 0.0}},
+		{7, 10, []interface{}{}},
+		{0, 0, []interface{}{}},
+	}
+
+	for _, io := range inputOutput {
+		if slice := s.Slice(io.offset, io.limit); !reflect.DeepEqual(slice, io.output) {
+			t.Errorf("Slice(%d, %d) is %v, expected %v", io.offset, io.limit, slice, io.output)
+		}
+	}
+}
+
+func TestSpillStackFilter(t *testing.T) {
+	s, cleanup := newTestSpillStack(t, 2, jsonCodec{})
+	defer cleanup()
+
+	for i := 0; i < 9; i++ {
+		s.Push(float64(i))
+	}
+	size := s.fileSize(t)
+
+	removed := s.Filter(func(element interface{}) bool {
+		return int(element.(float64))%3 != 0
+	})
+	if removed != 3 {
+		t.Errorf("removed is %d, expected %d", removed, 3)
+	}
+	if s.fileSize(t) >= size {
+		t.Errorf("file size is %d, expected less than %d", s.fileSize(t), size)
+	}
+
+	var elements []interface{}
+	for {
+		element, ok := s.Pop()
+		if !ok {
+			break
+		}
+		elements = append(elements, element)
+	}
+	if expected := []interface{}{8.0, 7.0, 5.0, 4.0, 2.0, 1.0}; !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+}
+
+func TestSpillStackFlush(t *testing.T) {
+	s, cleanup := newTestSpillStack(t, 1, jsonCodec{})
+	defer cleanup()
+
+	s.Push("foo")
+	s.Push("bar")
+	s.Push("baz")
+	s.Flush()
+
+	if size := s.Size(); size != 0 {
+		t.Errorf("size is %d, expected %d", size, 0)
+	}
+	if size := s.fileSize(t); size != 0 {
+		t.Errorf("file size is %d, expected %d", size, 0)
+	}
+	if peek := s.Peek(); peek != nil {
+		t.Errorf("peek is %v, expected nil", peek)
+	}
+}
+
+func TestSpillStack_EncodingError(t *testing.T) {
+	s, cleanup := newTestSpillStack(t, 1, failingCodec{})
+	defer cleanup()
+
+	s.Push("foo")
+	s.Push("bar")
+
+	if spilled := s.Spilled(); spilled != 0 {
+		t.Errorf("spilled is %d, expected %d", spilled, 0)
+	}
+	if size := s.Size(); size != 2 {
+		t.Errorf("size is %d, expected %d", size, 2)
+	}
+	if err := s.Err(); err == nil || err.Error() != "encoding error" {
+		t.Errorf("err is %v, expected %s", err, "encoding error")
+	}
+}
+
+func TestSpillStackClose(t *testing.T) {
+	s, cleanup := newTestSpillStack(t, 1, jsonCodec{})
+	defer cleanup()
+
+	s.Push("foo")
+	s.Push("bar")
+	path := s.Path()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("err is %v, expected file not to exist", err)
+	}
+	s.Push("baz")
+	s.Push("qux")
+	if size := s.Size(); size != 3 {
+		t.Errorf("size is %d, expected %d", size, 3)
+	}
+}
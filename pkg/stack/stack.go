@@ -4,15 +4,27 @@ package stack
 
 import "sync"
 
+// maxSpareFrames is the maximum number of popped frames
+// a stack keeps to be reused by the next pushes.
+const maxSpareFrames = 64
+
 // Stack implements the Stacker interface, and represents the stack
 // data structure as a linked list, containing a pointer
-// to the first Frame as a head and the size of the stack.
+// to the first Frame as a head, to the last one as a tail,
+// and the size of the stack.
 // It also contain a mutex to lock and unlock
 // the access to the stack at I/O operations.
 type Stack struct {
 	head *frame
+	tail *frame
 	size int
-	mux  sync.Mutex
+	// version is incremented on every modification
+	version uint64
+	// spare are popped frames to be reused, so
+	// pushing after popping does not allocate
+	spare  *frame
+	spares int
+	mux    sync.Mutex
 }
 
 // frame represents an element of the stack. It contains
@@ -35,12 +47,42 @@ func (s *Stack) Push(element interface{}) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	head := &frame{
-		data: element,
-		next: s.head,
+	s.push(element)
+}
+
+// PushIf adds a new element on top of the stack only if fn returns
+// true for the version of the stack, which are checked and pushed
+// atomically. It returns false if fn returned false.
+// The stack is locked while fn is called, so fn must not access it.
+func (s *Stack) PushIf(element interface{}, fn func(version uint64) bool) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if !fn(s.version) {
+		return false
 	}
+	s.push(element)
+	return true
+}
+
+// push adds a new element on top of the
+// stack, which must be locked.
+func (s *Stack) push(element interface{}) {
+	head := s.spare
+	if head != nil {
+		s.spare = head.next
+		s.spares--
+	} else {
+		head = &frame{}
+	}
+	head.data = element
+	head.next = s.head
 	s.head = head
+	if s.tail == nil {
+		s.tail = head
+	}
 	s.size++
+	s.version++
 }
 
 // Pop removes and returns the element on top of the stack,
@@ -53,20 +95,144 @@ func (s *Stack) Pop() (interface{}, bool) {
 	if s.head == nil {
 		return nil, false
 	}
+	return s.pop(), true
+}
+
+// PopIf removes and returns the element on top of the stack only if
+// fn returns true for it and the version of the stack, which are
+// checked and popped atomically. It returns false if the stack was
+// empty or fn returned false.
+// The stack is locked while fn is called, so fn must not access it.
+func (s *Stack) PopIf(fn func(element interface{}, version uint64) bool) (interface{}, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.head == nil || !fn(s.head.data, s.version) {
+		return nil, false
+	}
+	return s.pop(), true
+}
+
+// pop removes and returns the element on top of the
+// non-empty stack, which must be locked.
+func (s *Stack) pop() interface{} {
+	top := s.head
+	element := top.data
+	s.head = top.next
+	if s.head == nil {
+		s.tail = nil
+	}
+	s.size--
+	s.version++
+
+	top.data = nil
+	if s.spares < maxSpareFrames {
+		top.next = s.spare
+		s.spare = top
+		s.spares++
+	} else {
+		top.next = nil
+	}
+	return element
+}
+
+// Rotate moves the element on top of the stack to its bottom,
+// and returns it. If the stack was empty, it returns false.
+func (s *Stack) Rotate() (interface{}, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.head == nil {
+		return nil, false
+	}
+
+	top := s.head
+	if top != s.tail {
+		s.head = top.next
+		top.next = nil
+		s.tail.next = top
+		s.tail = top
+	}
+	s.version++
+	return top.data, true
+}
+
+// Base returns the element at the bottom of the stack.
+func (s *Stack) Base() interface{} {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.tail == nil {
+		return nil
+	}
+	return s.tail.data
+}
+
+// Sweep removes and returns the element at the bottom of the
+// stack. If the stack was empty, it returns false. Unlike Pop,
+// it takes linear time, as it walks the whole stack.
+func (s *Stack) Sweep() (interface{}, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.tail == nil {
+		return nil, false
+	}
 
-	element := s.head.data
-	s.head = s.head.next
+	element := s.tail.data
+	if s.head == s.tail {
+		s.head, s.tail = nil, nil
+	} else {
+		f := s.head
+		for f.next != s.tail {
+			f = f.next
+		}
+		f.next = nil
+		s.tail = f
+	}
 	s.size--
+	s.version++
 	return element, true
 }
 
+// Reorder calls fn with the elements of the stack, starting from the
+// top, and stores them in the order fn leaves them, unless it returns
+// an error, which is returned.
+// The stack is locked while fn is called, so fn must not access it.
+func (s *Stack) Reorder(fn func(elements []interface{}) error) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	elements := make([]interface{}, 0, s.size)
+	for f := s.head; f != nil; f = f.next {
+		elements = append(elements, f.data)
+	}
+	if err := fn(elements); err != nil {
+		return err
+	}
+
+	f := s.head
+	for _, element := range elements {
+		f.data = element
+		f = f.next
+	}
+	s.version++
+	return nil
+}
+
 // Size returns the number of elements that a stack contains.
 func (s *Stack) Size() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
 	return s.size
 }
 
 // Peek returns the element on top of the stack.
 func (s *Stack) Peek() interface{} {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
 	if s.head == nil {
 		return nil
 	}
@@ -80,4 +246,73 @@ func (s *Stack) Flush() {
 
 	s.size = 0
 	s.head = nil
+	s.tail = nil
+	s.version++
+}
+
+// Version returns the number of modifications of the stack.
+func (s *Stack) Version() uint64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.version
+}
+
+// Range calls fn for each element of the stack, starting
+// from the top. Iteration stops if fn returns false.
+// The stack is locked during the iteration, so fn must not
+// modify it.
+func (s *Stack) Range(fn func(element interface{}) bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for f := s.head; f != nil; f = f.next {
+		if !fn(f.data) {
+			return
+		}
+	}
+}
+
+// Slice returns up to limit elements of the stack, starting
+// from the top and skipping the first offset ones.
+func (s *Stack) Slice(offset, limit int) []interface{} {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	elements := make([]interface{}, 0, sliceCap(s.size, offset, limit))
+	for f := s.head; f != nil && len(elements) < limit; f = f.next {
+		if offset > 0 {
+			offset--
+			continue
+		}
+		elements = append(elements, f.data)
+	}
+	return elements
+}
+
+// Filter removes the elements of the stack for which fn returns
+// false, keeping the order of the rest of them, and returns the
+// number of removed elements.
+// The stack is locked during the iteration, so fn must not
+// modify it.
+func (s *Stack) Filter(fn func(element interface{}) bool) int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	removed := 0
+	s.tail = nil
+	for p := &s.head; *p != nil; {
+		if fn((*p).data) {
+			s.tail = *p
+			p = &(*p).next
+			continue
+		}
+		*p = (*p).next
+		s.size--
+		removed++
+	}
+	if removed > 0 {
+		s.version++
+	}
+	return removed
 }
@@ -1,6 +1,11 @@
 package stack
 
-import "testing"
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
 
 func TestNewStack(t *testing.T) {
 	stack := NewStack()
@@ -50,6 +55,33 @@ func TestStackPop(t *testing.T) {
 	}
 }
 
+func TestStackPop_SpareFrames(t *testing.T) {
+	stack := NewStack()
+	for i := 0; i < maxSpareFrames+1; i++ {
+		stack.Push("test")
+	}
+	for i := 0; i < maxSpareFrames+1; i++ {
+		stack.Pop()
+	}
+
+	if stack.spares != maxSpareFrames {
+		t.Errorf("stack.spares is %v, expected %v", stack.spares, maxSpareFrames)
+	}
+	for f := stack.spare; f != nil; f = f.next {
+		if f.data != nil {
+			t.Fatalf("spare frame data is %v, expected nil", f.data)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		stack.Push("test")
+		stack.Pop()
+	})
+	if allocs != 0 {
+		t.Errorf("push and pop allocated %v times, expected none", allocs)
+	}
+}
+
 func TestStackPop_False(t *testing.T) {
 	stack := NewStack()
 	_, ok := stack.Pop()
@@ -105,6 +137,29 @@ func TestStackPeek(t *testing.T) {
 
 }
 
+func TestStack_Concurrent(t *testing.T) {
+	stack := NewStack()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				stack.Push(j)
+				_ = stack.Peek()
+				_ = stack.Size()
+				stack.Pop()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stack.Size() != 0 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 0)
+	}
+}
+
 func TestStackFlush(t *testing.T) {
 	stack := NewStack()
 
@@ -121,3 +176,292 @@ func TestStackFlush(t *testing.T) {
 		t.Errorf("stack is not empty")
 	}
 }
+
+func TestStackRange(t *testing.T) {
+	stack := NewStack()
+	stack.Push("one")
+	stack.Push("two")
+	stack.Push("three")
+
+	var elements []interface{}
+	stack.Range(func(element interface{}) bool {
+		elements = append(elements, element)
+		return true
+	})
+
+	if expected := []interface{}{"three", "two", "one"}; !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+}
+
+func TestStackRange_Stop(t *testing.T) {
+	stack := NewStack()
+	stack.Push("one")
+	stack.Push("two")
+	stack.Push("three")
+
+	var elements []interface{}
+	stack.Range(func(element interface{}) bool {
+		elements = append(elements, element)
+		return element != "two"
+	})
+
+	if expected := []interface{}{"three", "two"}; !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+}
+
+func TestStackFilter(t *testing.T) {
+	stack := NewStack()
+	for i := 0; i < 6; i++ {
+		stack.Push(i)
+	}
+
+	removed := stack.Filter(func(element interface{}) bool {
+		return element.(int)%2 == 0
+	})
+	if removed != 3 {
+		t.Errorf("removed is %d, expected %d", removed, 3)
+	}
+	if stack.Size() != 3 {
+		t.Errorf("stack.Size() is %d, expected %d", stack.Size(), 3)
+	}
+
+	var elements []interface{}
+	stack.Range(func(element interface{}) bool {
+		elements = append(elements, element)
+		return true
+	})
+	if expected := []interface{}{4, 2, 0}; !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+
+	if removed := stack.Filter(func(interface{}) bool { return false }); removed != 3 {
+		t.Errorf("removed is %d, expected %d", removed, 3)
+	}
+	if stack.Peek() != nil || stack.Size() != 0 {
+		t.Errorf("stack is not empty")
+	}
+}
+
+func TestStackReorderer(t *testing.T) {
+	var _ Reorderer = NewStack()
+}
+
+func TestStackReorder(t *testing.T) {
+	stack := NewStack()
+	stack.Push("one")
+	stack.Push("two")
+	stack.Push("three")
+	version := stack.Version()
+
+	err := stack.Reorder(func(elements []interface{}) error {
+		if expected := []interface{}{"three", "two", "one"}; !reflect.DeepEqual(elements, expected) {
+			t.Errorf("elements are %v, expected %v", elements, expected)
+		}
+		elements[0], elements[2] = elements[2], elements[0]
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []interface{}{"one", "two", "three"}; !reflect.DeepEqual(stack.Slice(0, 10), expected) {
+		t.Errorf("stack is %v, expected %v", stack.Slice(0, 10), expected)
+	}
+	if stack.Peek() != "one" || stack.Base() != "three" {
+		t.Errorf("stack has peek %v and base %v, expected %v and %v", stack.Peek(), stack.Base(), "one", "three")
+	}
+	if stack.Version() != version+1 {
+		t.Errorf("stack.Version() is %v, expected %v", stack.Version(), version+1)
+	}
+
+	expectedErr := errors.New("not reordered")
+	err = stack.Reorder(func(elements []interface{}) error {
+		elements[0] = "four"
+		return expectedErr
+	})
+	if err != expectedErr {
+		t.Errorf("err is %v, expected %v", err, expectedErr)
+	}
+	if stack.Peek() != "one" {
+		t.Errorf("stack.Peek() is %v, expected %v", stack.Peek(), "one")
+	}
+}
+
+func TestStackRotator(t *testing.T) {
+	var _ Rotator = NewStack()
+}
+
+func TestStackRotate(t *testing.T) {
+	stack := NewStack()
+	if _, ok := stack.Rotate(); ok {
+		t.Error("stack.Rotate() is ok")
+	}
+
+	stack.Push("one")
+	if element, ok := stack.Rotate(); !ok || element != "one" {
+		t.Errorf("element is %v, expected %v", element, "one")
+	}
+	if stack.Peek() != "one" || stack.Base() != "one" {
+		t.Errorf("stack has peek %v and base %v, expected %v", stack.Peek(), stack.Base(), "one")
+	}
+
+	stack.Push("two")
+	stack.Push("three")
+	if element, ok := stack.Rotate(); !ok || element != "three" {
+		t.Errorf("element is %v, expected %v", element, "three")
+	}
+
+	var elements []interface{}
+	stack.Range(func(element interface{}) bool {
+		elements = append(elements, element)
+		return true
+	})
+	if expected := []interface{}{"two", "one", "three"}; !reflect.DeepEqual(elements, expected) {
+		t.Errorf("elements are %v, expected %v", elements, expected)
+	}
+	if stack.Base() != "three" {
+		t.Errorf("stack.Base() is %v, expected %v", stack.Base(), "three")
+	}
+}
+
+func TestStackSweep(t *testing.T) {
+	stack := NewStack()
+	if _, ok := stack.Sweep(); ok {
+		t.Error("stack.Sweep() is ok")
+	}
+	if stack.Base() != nil {
+		t.Errorf("stack.Base() is %v, expected nil", stack.Base())
+	}
+
+	for _, element := range []string{"one", "two", "three"} {
+		stack.Push(element)
+	}
+	for _, expected := range []string{"one", "two", "three"} {
+		if element, ok := stack.Sweep(); !ok || element != expected {
+			t.Errorf("element is %v, expected %v", element, expected)
+		}
+	}
+	if stack.Size() != 0 || stack.Peek() != nil || stack.Base() != nil {
+		t.Errorf("stack is not empty")
+	}
+
+	stack.Push("four")
+	if stack.Base() != "four" {
+		t.Errorf("stack.Base() is %v, expected %v", stack.Base(), "four")
+	}
+}
+
+func TestStackBase_Filter(t *testing.T) {
+	stack := NewStack()
+	for i := 0; i < 4; i++ {
+		stack.Push(i)
+	}
+
+	stack.Filter(func(element interface{}) bool {
+		return element.(int) != 0
+	})
+	if stack.Base() != 1 {
+		t.Errorf("stack.Base() is %v, expected %v", stack.Base(), 1)
+	}
+
+	_, _ = stack.Pop()
+	_, _ = stack.Pop()
+	_, _ = stack.Pop()
+	if stack.Base() != nil {
+		t.Errorf("stack.Base() is %v, expected nil", stack.Base())
+	}
+}
+
+func TestStackSlice(t *testing.T) {
+	stack := NewStack()
+	for i := 1; i <= 4; i++ {
+		stack.Push(i)
+	}
+
+	inputOutput := []struct {
+		offset, limit int
+		output        []interface{}
+	}{
+		{0, 10, []interface{}{4, 3, 2, 1}},
+		{1, 2, []interface{}{3, 2}},
+		{3, 2, []interface{}{1}},
+		{5, 2, []interface{}{}},
+		{0, 0, []interface{}{}},
+	}
+
+	for _, io := range inputOutput {
+		if elements := stack.Slice(io.offset, io.limit); !reflect.DeepEqual(elements, io.output) {
+			t.Errorf("elements are %v, expected %v", elements, io.output)
+		}
+	}
+}
+
+// testVersionPopIf tests Version, PopIf and PushIf of a Stacker.
+func testVersionPopIf(t *testing.T, s Stacker) {
+	called := false
+	if _, ok := s.PopIf(func(interface{}, uint64) bool { called = true; return true }); ok || called {
+		t.Error("empty Stacker is popped")
+	}
+
+	version := s.Version()
+	s.Push("one")
+	s.Push("two")
+	if v := s.Version(); v != version+2 {
+		t.Errorf("version is %d, expected %d", v, version+2)
+	}
+	top := s.Peek()
+	s.Slice(0, 2)
+	if s.Filter(func(interface{}) bool { return true }); s.Version() != version+2 {
+		t.Errorf("version is %d after reading, expected %d", s.Version(), version+2)
+	}
+
+	if _, ok := s.PopIf(func(element interface{}, v uint64) bool { return v == version }); ok {
+		t.Error("Stacker is popped with an old version")
+	}
+	element, ok := s.PopIf(func(element interface{}, v uint64) bool {
+		return element == top && v == version+2
+	})
+	if !ok || element != top {
+		t.Errorf("element is %v, expected %v", element, top)
+	}
+	if s.Size() != 1 || s.Version() != version+3 {
+		t.Errorf("Stacker has size %d and version %d, expected %d and %d", s.Size(), s.Version(), 1, version+3)
+	}
+
+	s.Flush()
+	if s.Version() != version+4 {
+		t.Errorf("version is %d after flushing, expected %d", s.Version(), version+4)
+	}
+
+	if s.PushIf("three", func(v uint64) bool { return v == version }) || s.Size() != 0 {
+		t.Error("Stacker is pushed with an old version")
+	}
+	if !s.PushIf("three", func(v uint64) bool { return v == version+4 }) {
+		t.Error("Stacker is not pushed with its version")
+	}
+	if s.Peek() != "three" || s.Version() != version+5 {
+		t.Errorf("Stacker has peek %v and version %d, expected %v and %d", s.Peek(), s.Version(), "three", version+5)
+	}
+}
+
+func TestStackVersionPopIf(t *testing.T) {
+	testVersionPopIf(t, NewStack())
+}
+
+func BenchmarkStackPush(b *testing.B) {
+	s := NewStack()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.Push(i)
+	}
+}
+
+func BenchmarkStackPushPop(b *testing.B) {
+	s := NewStack()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.Push(i)
+		s.Pop()
+	}
+}
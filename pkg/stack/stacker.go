@@ -14,4 +14,59 @@ type Stacker interface {
 	Peek() interface{}
 	// Flush flushes a Stack
 	Flush()
+	// Range calls a function for each element of the
+	// Stack, from the last pushed to the first pushed,
+	// until it returns false
+	Range(fn func(element interface{}) bool)
+	// Slice returns up to limit elements of the Stack,
+	// from the topmost, skipping the first offset ones
+	Slice(offset, limit int) []interface{}
+	// Filter removes the elements of the Stack for
+	// which a function returns false
+	Filter(fn func(element interface{}) bool) int
+	// Version returns a number that is incremented
+	// every time the Stack is modified
+	Version() uint64
+	// PopIf pops the topmost element only if a function
+	// returns true for it and the Version of the Stack,
+	// as a single atomic operation
+	PopIf(fn func(element interface{}, version uint64) bool) (interface{}, bool)
+	// PushIf pushes an element only if a function returns
+	// true for the Version of the Stack, as a single
+	// atomic operation
+	PushIf(element interface{}, fn func(version uint64) bool) bool
+}
+
+// Rotator is implemented by the Stackers that can operate on
+// their bottom element, i.e. the opposite of the top one.
+type Rotator interface {
+	// Rotate moves the topmost element to the bottom
+	Rotate() (interface{}, bool)
+	// Base returns the bottommost element
+	Base() interface{}
+	// Sweep removes and returns the bottommost element
+	Sweep() (interface{}, bool)
+}
+
+// Reorderer is implemented by the Stackers whose
+// elements can be reordered in place.
+type Reorderer interface {
+	// Reorder calls a function with the elements, from the
+	// topmost, which may reorder them, and keeps their new
+	// order unless it returns an error, as a single atomic
+	// operation
+	Reorder(fn func(elements []interface{}) error) error
+}
+
+// sliceCap returns the number of elements that Slice returns
+// for a Stacker of a given size.
+func sliceCap(size, offset, limit int) int {
+	n := size - offset
+	if n > limit {
+		n = limit
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n
 }
@@ -5,6 +5,7 @@ package uuid
 import (
 	"crypto/hmac"
 	"crypto/md5"
+	"crypto/rand"
 	"fmt"
 )
 
@@ -24,6 +25,18 @@ func New(s string) UUID {
 	return UUID(fmt.Sprintf("%x", h.Sum(nil)))
 }
 
+// NewRandom creates a new random UUID, i.e. a version 4 UUID,
+// with the same format as the ones created by New.
+func NewRandom() UUID {
+	b := make([]byte, 16)
+	// we ignore errors, since crypto/rand does
+	// not fail on the supported platforms
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return UUID(fmt.Sprintf("%x", b))
+}
+
 // String returns a string representation of the
 // UUID, implementing the Stringer interface.
 func (uuid UUID) String() string {
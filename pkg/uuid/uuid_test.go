@@ -19,6 +19,20 @@ func TestNew(t *testing.T) {
 
 }
 
+func TestNewRandom(t *testing.T) {
+	u := NewRandom()
+	if len(u) != 32 {
+		t.Errorf("u is %v, expected %d characters", u, 32)
+	}
+	if u[12] != '4' {
+		t.Errorf("u is %v, expected version %v", u, 4)
+	}
+
+	if u2 := NewRandom(); u == u2 {
+		t.Errorf("u and u2 are equal")
+	}
+}
+
 func TestUUIDString(t *testing.T) {
 	u := UUID("123e4567e89b12d3a456426655440000")
 	s := u.String()
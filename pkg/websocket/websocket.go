@@ -0,0 +1,300 @@
+// Package websocket implements a minimal subset of the WebSocket
+// protocol (RFC 6455): the opening handshake, and unfragmented
+// text messages, ping, pong and close frames.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// acceptGUID is the magic string used to compute the
+// Sec-WebSocket-Accept header of the handshake.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// MaxPayload is the maximum length of the payload of a read frame.
+const MaxPayload = 1 << 20
+
+// Frame opcodes.
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+var (
+	// ErrBadHandshake is returned when the opening
+	// handshake of a connection is not valid.
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+
+	// ErrPayloadTooLarge is returned when reading a frame
+	// whose payload is longer than MaxPayload.
+	ErrPayloadTooLarge = errors.New("websocket: payload too large")
+)
+
+// Conn represents a WebSocket connection.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	// client determines whether written frames are masked
+	client bool
+
+	// mu serializes the writes of frames
+	mu sync.Mutex
+}
+
+// Upgrade upgrades an HTTP request to a WebSocket connection
+// by hijacking it and completing the opening handshake. If the
+// request is not a valid handshake, ErrBadHandshake is returned
+// and the response is left untouched.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != "GET" ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" ||
+		key == "" {
+		return nil, ErrBadHandshake
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("websocket: response does not support hijacking")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	// clear the timeouts that the HTTP server may have set
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: conn, br: brw.Reader}, nil
+}
+
+// Dial opens a WebSocket connection to a ws:// URL.
+func Dial(rawurl string) (*Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, fmt.Errorf("websocket: unsupported scheme %s", u.Scheme)
+	}
+	u.Scheme = "http"
+
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req, _ := http.NewRequest("GET", u.String(), nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols ||
+		res.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, ErrBadHandshake
+	}
+
+	return &Conn{conn: conn, br: br, client: true}, nil
+}
+
+// WriteText sends a text message.
+func (c *Conn) WriteText(p []byte) error {
+	return c.writeFrame(opText, p)
+}
+
+// Read returns the payload of the next data message. Ping frames
+// are answered transparently. When the peer closes the connection,
+// the close frame is answered and io.EOF is returned.
+func (c *Conn) Read() ([]byte, error) {
+	for {
+		op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+		case opPong:
+		case opClose:
+			c.writeFrame(opClose, nil)
+			return nil, io.EOF
+		default:
+			return payload, nil
+		}
+	}
+}
+
+// Close sends a close frame and closes the underlying connection.
+func (c *Conn) Close() error {
+	c.writeFrame(opClose, nil)
+	return c.conn.Close()
+}
+
+// writeFrame writes a final frame, which is masked if
+// the Conn is the client side of the connection.
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	header := []byte{0x80 | op, 0}
+	switch n := len(payload); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header[1] = 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	if c.client {
+		header[1] |= 0x80
+		mask := make([]byte, 4)
+		if _, err := io.ReadFull(rand.Reader, mask); err != nil {
+			return err
+		}
+		header = append(header, mask...)
+
+		masked := make([]byte, len(payload))
+		copy(masked, payload)
+		maskBytes(mask, masked)
+		payload = masked
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+// readFrame reads a frame, returning its opcode and its
+// unmasked payload.
+func (c *Conn) readFrame() (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.br, header); err != nil {
+		return 0, nil, err
+	}
+	op := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+
+	n := uint64(header[1] & 0x7F)
+	switch n {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(c.br, ext); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(c.br, ext); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext)
+	}
+	if n > MaxPayload {
+		return 0, nil, ErrPayloadTooLarge
+	}
+
+	var mask []byte
+	if masked {
+		mask = make([]byte, 4)
+		if _, err := io.ReadFull(c.br, mask); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		maskBytes(mask, payload)
+	}
+	return op, payload, nil
+}
+
+// maskBytes applies a masking key to a payload in place.
+func maskBytes(mask, payload []byte) {
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+}
+
+// acceptKey computes the Sec-WebSocket-Accept header
+// value of a given Sec-WebSocket-Key.
+func acceptKey(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+acceptGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerContains determines whether a comma-separated
+// header contains a token, case-insensitively.
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[name] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// example of RFC 6455, section 1.3
+	if key := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); key != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("key is %s, expected %s", key, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+	}
+}
+
+func TestUpgrade_BadHandshake(t *testing.T) {
+	valid := func() *http.Request {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Connection", "keep-alive, Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Version", "13")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		return r
+	}
+
+	inputs := []func(r *http.Request){
+		func(r *http.Request) { r.Method = "POST" },
+		func(r *http.Request) { r.Header.Del("Connection") },
+		func(r *http.Request) { r.Header.Set("Upgrade", "h2c") },
+		func(r *http.Request) { r.Header.Set("Sec-WebSocket-Version", "8") },
+		func(r *http.Request) { r.Header.Del("Sec-WebSocket-Key") },
+	}
+
+	for i, input := range inputs {
+		r := valid()
+		input(r)
+		if _, err := Upgrade(httptest.NewRecorder(), r); err != ErrBadHandshake {
+			t.Errorf("err is %v for input %d, expected %v", err, i, ErrBadHandshake)
+		}
+	}
+}
+
+func TestConn(t *testing.T) {
+	messages := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := Upgrade(w, r)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer ws.Close()
+
+		for {
+			p, err := ws.Read()
+			if err == io.EOF {
+				close(messages)
+				return
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := ws.WriteText(p); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	ws, err := Dial(strings.Replace(server.URL, "http", "ws", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	long := strings.Repeat("piladb", 20000)
+	for _, message := range []string{"foo", strings.Repeat("a", 200), long} {
+		if err := ws.writeFrame(opPing, []byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		if err := ws.WriteText([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+
+		// pong frames are skipped
+		p, err := ws.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(p) != message {
+			t.Errorf("message has length %d, expected %d", len(p), len(message))
+		}
+	}
+
+	if err := ws.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, ok := <-messages; ok {
+		t.Error("connection is not closed")
+	}
+}
+
+func TestDial_Error(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	inputs := []string{
+		"%",
+		strings.Replace(server.URL, "http", "wss", 1),
+		"ws://127.0.0.1:0",
+		strings.Replace(server.URL, "http", "ws", 1),
+	}
+
+	for _, input := range inputs {
+		if _, err := Dial(input); err == nil {
+			t.Errorf("err is nil for %s", input)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// Package yaml implements the subset of YAML needed to read documents
+// written by hand: block mappings and sequences, nested by indentation,
+// of scalar values. Flow collections, anchors, tags and multi-line
+// strings are not supported.
+package yaml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// line is a significant line of a document, without
+// indentation nor comments.
+type line struct {
+	n      int
+	indent int
+	text   string
+}
+
+// Unmarshal parses a YAML document and returns its value, made of
+// map[string]interface{}, []interface{}, string, int64, float64,
+// bool and nil values, so it can be encoded to JSON. An empty
+// document is nil.
+func Unmarshal(data []byte) (interface{}, error) {
+	lines, err := split(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	value, i, err := parseNode(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if i < len(lines) {
+		return nil, fmt.Errorf("yaml: line %d: unexpected indentation", lines[i].n)
+	}
+	return value, nil
+}
+
+// split returns the significant lines of a document, skipping
+// empty lines, comments and document markers.
+func split(doc string) ([]line, error) {
+	var lines []line
+	for n, text := range strings.Split(doc, "\n") {
+		text = strings.TrimRight(stripComment(text), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" || trimmed == "..." {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs are not allowed as indentation", n+1)
+		}
+		lines = append(lines, line{n: n + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	return lines, nil
+}
+
+// stripComment removes the comment of a line, if any,
+// i.e. from a # at its start or after a blank, out of quotes.
+func stripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// parseNode parses the mapping or sequence starting at lines[i],
+// whose lines are indented by indent, and returns its value and
+// the index of the line following it.
+func parseNode(lines []line, i, indent int) (interface{}, int, error) {
+	if isItem(lines[i].text) {
+		return parseSequence(lines, i, indent)
+	}
+	return parseMapping(lines, i, indent)
+}
+
+// isItem determines whether text is an item of a sequence.
+func isItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseSequence parses the items of a sequence starting at lines[i].
+func parseSequence(lines []line, i, indent int) (interface{}, int, error) {
+	items := []interface{}{}
+	for i < len(lines) && lines[i].indent == indent && isItem(lines[i].text) {
+		rest := strings.TrimLeft(strings.TrimPrefix(lines[i].text, "-"), " ")
+		if rest == "" {
+			// the item is a nested block, or null
+			if i+1 < len(lines) && lines[i+1].indent > indent {
+				value, next, err := parseNode(lines, i+1, lines[i+1].indent)
+				if err != nil {
+					return nil, 0, err
+				}
+				items, i = append(items, value), next
+				continue
+			}
+			items, i = append(items, nil), i+1
+			continue
+		}
+
+		if !isItem(rest) && !isKey(rest) {
+			value, err := parseScalar(rest)
+			if err != nil {
+				return nil, 0, fmt.Errorf("yaml: line %d: %v", lines[i].n, err)
+			}
+			items, i = append(items, value), i+1
+			continue
+		}
+
+		// the item is a block starting on the same line, whose
+		// lines are indented like its content
+		itemIndent := lines[i].indent + len(lines[i].text) - len(rest)
+		lines[i] = line{n: lines[i].n, indent: itemIndent, text: rest}
+		value, next, err := parseNode(lines, i, itemIndent)
+		if err != nil {
+			return nil, 0, err
+		}
+		items, i = append(items, value), next
+	}
+	return items, i, nil
+}
+
+// isKey determines whether text is a key of a mapping,
+// followed by its value, if any.
+func isKey(text string) bool {
+	_, _, ok := splitKey(text)
+	return ok
+}
+
+// splitKey splits text into the key of a mapping and its value.
+func splitKey(text string) (string, string, bool) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := strings.IndexByte(text[1:], text[0])
+		if end == -1 {
+			return "", "", false
+		}
+		rest := text[end+2:]
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false
+		}
+		return text[1 : end+1], strings.TrimSpace(rest[1:]), true
+	}
+
+	i := strings.Index(text, ": ")
+	if i == -1 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", false
+		}
+		i = len(text) - 1
+	}
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+}
+
+// parseMapping parses the keys of a mapping starting at lines[i].
+func parseMapping(lines []line, i, indent int) (interface{}, int, error) {
+	mapping := make(map[string]interface{})
+	for i < len(lines) && lines[i].indent == indent {
+		key, rest, ok := splitKey(lines[i].text)
+		if !ok {
+			return nil, 0, fmt.Errorf("yaml: line %d: expected key and value, got %s", lines[i].n, lines[i].text)
+		}
+		if _, ok := mapping[key]; ok {
+			return nil, 0, fmt.Errorf("yaml: line %d: duplicated key %s", lines[i].n, key)
+		}
+
+		if rest != "" {
+			value, err := parseScalar(rest)
+			if err != nil {
+				return nil, 0, fmt.Errorf("yaml: line %d: %v", lines[i].n, err)
+			}
+			mapping[key], i = value, i+1
+			continue
+		}
+
+		// the value is a nested block, a sequence
+		// indented like the key, or null
+		i++
+		switch {
+		case i < len(lines) && lines[i].indent > indent:
+			value, next, err := parseNode(lines, i, lines[i].indent)
+			if err != nil {
+				return nil, 0, err
+			}
+			mapping[key], i = value, next
+		case i < len(lines) && lines[i].indent == indent && isItem(lines[i].text):
+			value, next, err := parseSequence(lines, i, indent)
+			if err != nil {
+				return nil, 0, err
+			}
+			mapping[key], i = value, next
+		default:
+			mapping[key] = nil
+		}
+	}
+	return mapping, i, nil
+}
+
+// parseScalar parses a quoted or plain scalar value.
+func parseScalar(text string) (interface{}, error) {
+	switch text[0] {
+	case '"':
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", text)
+		}
+		return s, nil
+	case '\'':
+		if len(text) < 2 || text[len(text)-1] != '\'' {
+			return nil, fmt.Errorf("invalid string %s", text)
+		}
+		return strings.Replace(text[1:len(text)-1], "''", "'", -1), nil
+	case '[', '{':
+		switch text {
+		case "[]":
+			return []interface{}{}, nil
+		case "{}":
+			return map[string]interface{}{}, nil
+		}
+		return nil, fmt.Errorf("flow collections are not supported, got %s", text)
+	case '&', '*', '!', '|', '>':
+		return nil, fmt.Errorf("unsupported value %s", text)
+	}
+
+	switch text {
+	case "null", "Null", "NULL", "~":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil {
+		return f, nil
+	}
+	return text, nil
+}
@@ -0,0 +1,108 @@
+package yaml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshal(t *testing.T) {
+	input := `---
+# databases to provision
+prune: true
+name: "db: one" # quoted
+other: 'it''s'
+ratio: 0.5
+empty:
+nothing: ~
+list: []
+databases:
+  - name: db
+    max_memory: 1024
+    stacks:
+    - name: jobs
+      type: queue
+    -
+      name: events
+      ttl: 1h
+  - name: other
+    tags:
+      - a
+      - 2
+      - false
+nested:
+  key: value
+  "quoted key": 1
+`
+	expected := map[string]interface{}{
+		"prune":   true,
+		"name":    "db: one",
+		"other":   "it's",
+		"ratio":   0.5,
+		"empty":   nil,
+		"nothing": nil,
+		"list":    []interface{}{},
+		"databases": []interface{}{
+			map[string]interface{}{
+				"name":       "db",
+				"max_memory": int64(1024),
+				"stacks": []interface{}{
+					map[string]interface{}{"name": "jobs", "type": "queue"},
+					map[string]interface{}{"name": "events", "ttl": "1h"},
+				},
+			},
+			map[string]interface{}{
+				"name": "other",
+				"tags": []interface{}{"a", int64(2), false},
+			},
+		},
+		"nested": map[string]interface{}{"key": "value", "quoted key": int64(1)},
+	}
+
+	value, err := Unmarshal([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("value is %v, expected %v", value, expected)
+	}
+}
+
+func TestUnmarshal_Sequence(t *testing.T) {
+	value, err := Unmarshal([]byte("- foo\n- - bar\n  - baz\n-\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{"foo", []interface{}{"bar", "baz"}, nil}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("value is %v, expected %v", value, expected)
+	}
+}
+
+func TestUnmarshal_Empty(t *testing.T) {
+	if value, err := Unmarshal([]byte("# nothing\n\n---\n")); value != nil || err != nil {
+		t.Errorf("value is %v, %v, expected nil", value, err)
+	}
+}
+
+func TestUnmarshal_Error(t *testing.T) {
+	inputs := []string{
+		"foo",
+		"foo: bar\n  baz: qux",
+		"foo: bar\nfoo: baz",
+		"foo: [bar, baz]",
+		"foo: {bar: baz}",
+		"foo: &anchor bar",
+		"foo: |",
+		"foo: \"bar",
+		"foo: 'bar",
+		"foo:\n\t- bar",
+		"- foo\nbar: baz",
+		"- foo: \"bar",
+	}
+
+	for _, input := range inputs {
+		if value, err := Unmarshal([]byte(input)); err == nil {
+			t.Errorf("value is %v, expected error for %q", value, input)
+		}
+	}
+}